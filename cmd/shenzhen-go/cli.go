@@ -0,0 +1,530 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/shenzhen-go/graph"
+	"github.com/google/shenzhen-go/parts"
+)
+
+// A subcommand works on graph files without starting the server.
+type subcommand struct {
+	usage string // Arguments, for the usage message.
+	help  string
+	flags func(*flag.FlagSet)
+	run   func(fs *flag.FlagSet, args []string) error
+}
+
+var subcommands = map[string]*subcommand{
+	"fuzz": {
+		usage: "-o dir graph.szgo",
+		help:  "Writes a Go fuzz test of each goroutine reading only strings or byte slices, each in its own directory in dir, seeded from the channels' samples",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("o", "", "Directory to write the fuzz tests into")
+		},
+		run: cmdFuzz,
+	},
+	"generate": {
+		usage: "[-o dir [-gogenerate]] graph.szgo",
+		help:  "Writes the Go source for a graph (to its package in $GOPATH, or to dir/generated.go), and tests of its scenarios and properties",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("o", "", "Directory to write generated.go into, instead of the package in $GOPATH")
+			fs.Bool("gogenerate", false, `Include a "//go:generate shenzhen-go generate ..." line, so "go generate" regenerates it`)
+		},
+		run: cmdGenerate,
+	},
+	"build": {
+		usage: "graph.szgo...",
+		help:  "Generates and builds graphs",
+		run:   eachGraph(func(g *graph.Graph) error { return g.Build() }),
+	},
+	"merge": {
+		usage: "[-o out.szgo] base.szgo ours.szgo theirs.szgo",
+		help:  "Merges the changes from base to theirs into ours, goroutine by goroutine (usable as a git merge driver)",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("o", "", "File to write the merged graph to, instead of ours")
+		},
+		run: cmdMerge,
+	},
+	"parts": {
+		usage: "[-index url] [-dir project] list | install [type[@version]...]",
+		help:  "Lists part specs in a registry index, or installs and pins them in a project (all those in its lock file, if no types are given)",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("index", os.Getenv("SHENZHEN_GO_PART_INDEX"), "URL or path of the part registry index (default $SHENZHEN_GO_PART_INDEX)")
+			fs.String("dir", ".", "Project directory to install parts into")
+		},
+		run: cmdParts,
+	},
+	"run": {
+		usage: "graph.szgo",
+		help:  "Builds and runs a graph",
+		run:   cmdRun,
+	},
+	"split": {
+		usage: "-o dir [-deploy compose|kubernetes [-registry prefix]] graph.szgo",
+		help:  "Splits a graph into services at its remote channels, writing each one's Go source to its own directory in dir, and optionally manifests to deploy them",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("o", "", "Directory to write the services into")
+			fs.String("deploy", "", "Also write a Dockerfile for each service, and docker-compose.yml (compose) or kubernetes.yaml (kubernetes) in dir")
+			fs.String("registry", "", "Prefix of the image names in kubernetes.yaml, e.g. registry.example.com/primes/")
+		},
+		run: cmdSplit,
+	},
+	"test": {
+		usage: "graph.szgo...",
+		help:  "Runs the scenarios of graphs, failing if any fail",
+		run:   eachGraph(testScenarios),
+	},
+	"validate": {
+		usage: "[-strict] [-format text|json|sarif] graph.szgo...",
+		help:  "Checks graphs for problems, failing if there are any errors",
+		flags: func(fs *flag.FlagSet) {
+			fs.Bool("strict", false, "Fail on warnings too")
+			fs.String("format", "text", "Output format: text (to stderr), or json or sarif (to stdout)")
+		},
+		run: cmdValidate,
+	},
+	"watch": {
+		usage: "graph.szgo [-o dir] [-interval d]",
+		help:  "Generates the Go source for a graph whenever the file changes",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("o", "", "Directory to write generated.go into, instead of the package in $GOPATH")
+			fs.Duration("interval", time.Second, "How often to check the file for changes")
+		},
+		run: cmdWatch,
+	},
+}
+
+// runSubcommand runs the subcommand named by args[0], with the rest of args,
+// and returns the exit status.
+func runSubcommand(args []string) int {
+	sc := subcommands[args[0]]
+	if sc == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", args[0])
+		flag.Usage()
+		return 2
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n%s.\n", os.Args[0], args[0], sc.usage, sc.help)
+		fs.PrintDefaults()
+	}
+	if sc.flags != nil {
+		sc.flags(fs)
+	}
+	// Allow flags after the graphs too.
+	var pos []string
+	for rest := args[1:]; ; rest = fs.Args()[1:] {
+		if err := fs.Parse(rest); err != nil {
+			return 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		pos = append(pos, fs.Arg(0))
+	}
+	if len(pos) == 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := sc.run(fs, pos); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// subcommandUsage describes the subcommands, for the usage message.
+func subcommandUsage() string {
+	var names []string
+	for n := range subcommands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, n := range names {
+		fmt.Fprintf(&b, "  %s %s\n    \t%s\n", n, subcommands[n].usage, subcommands[n].help)
+	}
+	return b.String()
+}
+
+// eachGraph makes a subcommand run f on each graph named.
+func eachGraph(f func(*graph.Graph) error) func(*flag.FlagSet, []string) error {
+	return func(_ *flag.FlagSet, args []string) error {
+		for _, p := range args {
+			g, err := graph.LoadJSONFile(p)
+			if err != nil {
+				return err
+			}
+			if err := f(g); err != nil {
+				return fmt.Errorf("%s: %v", p, err)
+			}
+		}
+		return nil
+	}
+}
+
+func oneGraph(args []string) (*graph.Graph, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("want one graph, got %d", len(args))
+	}
+	return graph.LoadJSONFile(args[0])
+}
+
+func cmdFuzz(fs *flag.FlagSet, args []string) error {
+	g, err := oneGraph(args)
+	if err != nil {
+		return err
+	}
+	dir := fs.Lookup("o").Value.String()
+	if dir == "" {
+		return errors.New("fuzz needs -o")
+	}
+	ns := g.FuzzTargets()
+	if len(ns) == 0 {
+		return errors.New("no goroutine reads only strings or byte slices")
+	}
+	for _, n := range ns {
+		h, err := g.Fuzz(n)
+		if err != nil {
+			return err
+		}
+		fd := filepath.Join(dir, graph.FuzzDir(n))
+		if err := h.GenerateTo(fd, ""); err != nil {
+			return fmt.Errorf("%s: %v", n, err)
+		}
+		var buf bytes.Buffer
+		if err := g.WriteFuzzTestTo(&buf, n); err != nil {
+			return fmt.Errorf("%s: %v", n, err)
+		}
+		if err := graph.WriteIfChanged(filepath.Join(fd, "generated_fuzz_test.go"), buf.Bytes()); err != nil {
+			return err
+		}
+		fmt.Printf("%s: go test -fuzz=%s\n", fd, graph.FuzzFuncName(n))
+	}
+	return nil
+}
+
+func cmdGenerate(fs *flag.FlagSet, args []string) error {
+	g, err := oneGraph(args)
+	if err != nil {
+		return err
+	}
+	dir := fs.Lookup("o").Value.String()
+	if fs.Lookup("gogenerate").Value.String() == "true" {
+		if dir == "" {
+			return errors.New("-gogenerate needs -o")
+		}
+		// go generate runs commands in the package directory.
+		ad, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		ag, err := filepath.Abs(args[0])
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(ad, ag)
+		if err != nil {
+			return err
+		}
+		cmd := "shenzhen-go generate -o . -gogenerate " + filepath.ToSlash(rel)
+		return g.GenerateTo(dir, cmd)
+	}
+	return generate(g, dir)
+}
+
+// generate writes the Go source for g to dir/generated.go, or to its package
+// in $GOPATH if dir is empty.
+func generate(g *graph.Graph, dir string) error {
+	if dir == "" {
+		return g.GeneratePackage()
+	}
+	return g.GenerateTo(dir, "")
+}
+
+// Files cmdSplit writes manifests to, by kind.
+var deployFiles = map[string]string{
+	graph.DeployCompose:    "docker-compose.yml",
+	graph.DeployKubernetes: "kubernetes.yaml",
+}
+
+// cmdSplit writes each service of a split graph to dir/name, as
+// generated.go (the goroutines) and main.go (connecting the services), and
+// optionally a deployment manifest.
+func cmdSplit(fs *flag.FlagSet, args []string) error {
+	g, err := oneGraph(args)
+	if err != nil {
+		return err
+	}
+	dir := fs.Lookup("o").Value.String()
+	if dir == "" {
+		return errors.New("split needs -o")
+	}
+	deploy := fs.Lookup("deploy").Value.String()
+	if _, ok := deployFiles[deploy]; deploy != "" && !ok {
+		return fmt.Errorf("unknown kind of deployment %q (want compose or kubernetes)", deploy)
+	}
+	ss, err := g.Split()
+	if err != nil {
+		return err
+	}
+	for _, s := range ss {
+		sd := filepath.Join(dir, s.Name)
+		if err := s.Graph.GenerateTo(sd, ""); err != nil {
+			return fmt.Errorf("service %s: %v", s.Name, err)
+		}
+		var buf bytes.Buffer
+		if err := s.WriteMainTo(&buf); err != nil {
+			return fmt.Errorf("service %s: %v", s.Name, err)
+		}
+		if err := graph.WriteIfChanged(filepath.Join(sd, "main.go"), buf.Bytes()); err != nil {
+			return err
+		}
+		if deploy != "" {
+			buf.Reset()
+			if err := s.WriteDockerfileTo(&buf); err != nil {
+				return fmt.Errorf("service %s: %v", s.Name, err)
+			}
+			if err := graph.WriteIfChanged(filepath.Join(sd, "Dockerfile"), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		fmt.Println(sd)
+	}
+	if deploy == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := g.WriteDeploymentTo(&buf, deploy, ss, fs.Lookup("registry").Value.String()); err != nil {
+		return err
+	}
+	out := filepath.Join(dir, deployFiles[deploy])
+	if err := graph.WriteIfChanged(out, buf.Bytes()); err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+// cmdMerge does a three-way merge. As git expects of a merge driver, the
+// result replaces ours, and conflicts are an error. Conflicting goroutines
+// etc are left as they are in ours.
+func cmdMerge(fs *flag.FlagSet, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("want base, ours, and theirs, got %d graph(s)", len(args))
+	}
+	var srcs [3][]byte
+	for i, p := range args {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		srcs[i] = b
+	}
+	m, conflicts, err := graph.Merge3(srcs[0], srcs[1], srcs[2])
+	if err != nil {
+		return err
+	}
+	out := fs.Lookup("o").Value.String()
+	if out == "" {
+		out = args[1]
+	}
+	var buf bytes.Buffer
+	if err := m.WriteJSONTo(&buf); err != nil {
+		return err
+	}
+	if err := graph.WriteIfChanged(out, buf.Bytes()); err != nil {
+		return err
+	}
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "%s: conflict: %s\n", out, c)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("found %d conflict(s); kept ours for those", len(conflicts))
+	}
+	return nil
+}
+
+func cmdParts(fs *flag.FlagSet, args []string) error {
+	index, dir := fs.Lookup("index").Value.String(), fs.Lookup("dir").Value.String()
+	switch {
+	case args[0] == "install" && len(args) == 1:
+		return parts.InstallLocked(dir)
+	case args[0] != "list" && args[0] != "install":
+		return fmt.Errorf("unknown action %q", args[0])
+	case index == "":
+		return errors.New("no index; use -index or set $SHENZHEN_GO_PART_INDEX")
+	}
+	es, err := parts.FetchIndex(index)
+	if err != nil {
+		return err
+	}
+	if args[0] == "list" {
+		l, err := parts.LoadLock(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range es {
+			mark := " "
+			if le := l[e.Type]; le != nil && le.Version == e.Version {
+				mark = "*"
+			}
+			fmt.Printf("%s %s %s\t%s\n", mark, e.Type, e.Version, e.Description)
+		}
+		return nil
+	}
+	for _, a := range args[1:] {
+		t, v := a, ""
+		if i := strings.LastIndex(a, "@"); i >= 0 {
+			t, v = a[:i], a[i+1:]
+		}
+		e, err := parts.Find(es, t, v)
+		if err != nil {
+			return err
+		}
+		if err := parts.Install(dir, e); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Installed %s %s\n", e.Type, e.Version)
+	}
+	return nil
+}
+
+func cmdRun(_ *flag.FlagSet, args []string) error {
+	g, err := oneGraph(args)
+	if err != nil {
+		return err
+	}
+	return g.Run(os.Stdout, os.Stderr)
+}
+
+// testScenarios runs the scenarios of g, printing how each went.
+func testScenarios(g *graph.Graph) error {
+	rs, err := g.RunScenarios(context.Background())
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range rs {
+		if r.Passed {
+			fmt.Printf("ok   %s\n", r.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s\n%s", r.Name, r.Output)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scenarios failed", failed, len(rs))
+	}
+	return nil
+}
+
+func cmdValidate(fs *flag.FlagSet, args []string) error {
+	strict := fs.Lookup("strict").Value.String() == "true"
+	format := fs.Lookup("format").Value.String()
+	write := map[string]func(io.Writer, []graph.FileDiagnostics) error{
+		"text":  nil,
+		"json":  graph.WriteDiagnosticsJSON,
+		"sarif": graph.WriteSARIF,
+	}
+	wf, ok := write[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	bad := 0
+	var fds []graph.FileDiagnostics
+	for _, p := range args {
+		src, err := ioutil.ReadFile(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", p, err)
+			bad++
+			continue
+		}
+		g, err := graph.LoadJSON(bytes.NewReader(src), p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", p, err)
+			bad++
+			continue
+		}
+		fd := graph.FileDiagnostics{Path: filepath.ToSlash(p), Source: src, Diagnostics: g.Check()}
+		for _, d := range fd.Diagnostics {
+			if wf == nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", p, d)
+			}
+			if d.Severity == graph.Error || strict {
+				bad++
+			}
+		}
+		fds = append(fds, fd)
+	}
+	if wf != nil {
+		if err := wf(os.Stdout, fds); err != nil {
+			return err
+		}
+	}
+	if bad > 0 {
+		return fmt.Errorf("found %d problem(s)", bad)
+	}
+	return nil
+}
+
+// cmdWatch regenerates whenever the graph file changes, until interrupted.
+// Errors (e.g. from the file being half-written) are reported, then it keeps
+// watching.
+func cmdWatch(fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("want one graph, got %d", len(args))
+	}
+	p, dir := args[0], fs.Lookup("o").Value.String()
+	interval := fs.Lookup("interval").Value.(flag.Getter).Get().(time.Duration)
+
+	var last []byte
+	for ; ; time.Sleep(interval) {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			log.Printf("Could not read graph: %v", err)
+			continue
+		}
+		if bytes.Equal(b, last) {
+			continue
+		}
+		last = b
+		g, err := graph.LoadJSON(bytes.NewReader(b), p)
+		if err != nil {
+			log.Printf("Could not load graph: %v", err)
+			continue
+		}
+		if err := generate(g, dir); err != nil {
+			log.Printf("Could not generate Go: %v", err)
+			continue
+		}
+		log.Printf("Generated Go for %s", p)
+	}
+}
@@ -16,18 +16,25 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/google/shenzhen-go/graph"
+	"github.com/google/shenzhen-go/parts"
 	"github.com/google/shenzhen-go/view"
 )
 
@@ -36,29 +43,62 @@ const pingMsg = "Pong!"
 var (
 	serveAddr = flag.String("addr", "localhost", "Address to bind server to")
 	servePort = flag.Int("port", 8088, "Port to serve from")
+	lintCmd   = flag.String("lint", "", `Command used to lint goroutine code, e.g. "go vet" or "staticcheck" (disabled if empty)`)
+	authFile  = flag.String("auth", "", `File of "name:password" lines; if set, everyone must log in`)
+	tlsCert   = flag.String("tls-cert", "", "TLS certificate file; serves HTTPS if set (with -tls-key)")
+	tlsKey    = flag.String("tls-key", "", "TLS private key file")
+
+	basePath        = flag.String("base-path", "", `Path to serve under, e.g. "/shenzhen" behind a reverse proxy`)
+	browserCmd      = flag.String("browser", "", `Command used to open the browser, e.g. "firefox" (the URL is added to the end)`)
+	verbose         = flag.Bool("v", false, "Log more detail")
+	logAsJSON       = flag.Bool("log-json", false, "Log one JSON object per line")
+	noBrowser       = flag.Bool("no-browser", false, "Don't open a browser when ready")
+	onShutdown      = flag.String("on-shutdown", "kill", `What to do with running graphs when shutting down: "kill" them, or "wait" for them (up to -shutdown-timeout)`)
+	shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "How long to wait for requests to finish when shutting down")
+	pluginDir       = flag.String("plugins", "", "Directory to load part plugins from (default: shenzhen-go/plugins in the user config directory)")
+	codeMirror      = flag.String("codemirror", view.CodeMirrorURL, "Where to load the CodeMirror code editor from (plain text boxes are used if empty)")
+	allowRemote     = flag.Bool("allow-remote", false, "Allow binding to addresses other than loopback (building and running also need -auth)")
 )
 
-func open(args ...string) error {
+// open opens a URL in a browser: the one given with -browser, or else the
+// default for the platform.
+func open(url string) error {
+	if c := strings.Fields(*browserCmd); len(c) > 0 {
+		return exec.Command(c[0], append(c[1:], url)...).Start()
+	}
 	switch runtime.GOOS {
 	case "darwin":
-		return exec.Command("open", args...).Run()
-	case "linux":
-		// TODO: Just guessing, fix later.
-		return exec.Command("xdg-open", args...).Run()
+		return exec.Command("open", url).Run()
 	case "windows":
-		return exec.Command("start", args...).Run()
+		// start is built into cmd, and mangles URLs containing &.
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Run()
+	case "android", "ios", "js", "plan9", "wasip1":
+		return fmt.Errorf("don't know how to open a browser on %s", runtime.GOOS)
 	default:
-		fmt.Printf("Ready to open %s\n", strings.Join(args, " "))
-		return nil
+		// Linux and the BSDs, mostly.
+		return exec.Command("xdg-open", url).Run()
+	}
+}
+
+// isLoopback reports whether host only accepts local connections.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
 	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
 
 // TODO: Implement this better.
-func openWhenUp(addr string) {
-	base := fmt.Sprintf("http://%s/", addr)
+func openWhenUp(scheme, addr string) {
+	base := fmt.Sprintf("%s://%s%s/", scheme, addr, view.BasePath)
+	// It's only pinging itself, and may well have a self-signed certificate.
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
 	t := time.NewTicker(100 * time.Millisecond)
 	for range t.C {
-		resp, err := http.Get(base + "ping")
+		resp, err := client.Get(base + "ping")
 		if err != nil {
 			continue
 		}
@@ -70,7 +110,10 @@ func openWhenUp(addr string) {
 		if string(msg) != pingMsg {
 			continue
 		}
-		if err := open(base); err != nil {
+		if *noBrowser {
+			fmt.Printf("Ready at %s\n", base)
+		} else if err := open(base); err != nil {
+			log.Printf("Could not open browser: %v", err)
 			fmt.Printf("Ready to open %s\n", base)
 		}
 		t.Stop()
@@ -78,22 +121,146 @@ func openWhenUp(addr string) {
 	}
 }
 
+// loadPlugins loads part plugins and specs, which graphs may need for any
+// command.
+func loadPlugins() {
+	dir := *pluginDir
+	if dir == "" {
+		d, err := parts.PluginDir()
+		if err != nil {
+			log.Printf("Could not find plugin directory: %v", err)
+			return
+		}
+		dir = d
+	}
+	loaded, err := parts.LoadPlugins(dir)
+	if err != nil {
+		log.Printf("Could not load part plugins: %v", err)
+	}
+	// Parts installed in the project (the current directory) take precedence.
+	for _, d := range []string{parts.ProjectDir, dir} {
+		specs, err := parts.LoadSpecs(d)
+		if err != nil {
+			log.Printf("Could not load part specs: %v", err)
+		}
+		loaded = append(loaded, specs...)
+	}
+	if md, err := graph.MacroDir(); err == nil {
+		macros, err := graph.LoadMacros(md)
+		if err != nil {
+			log.Printf("Could not load macros: %v", err)
+		}
+		loaded = append(loaded, macros...)
+	}
+	for _, p := range loaded {
+		log.Printf("Loaded parts from %s", p)
+	}
+}
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]            Serves the editor\n       %s command [args]     Works on graph files\n\nCommands:\n%s\nFlags:\n", os.Args[0], os.Args[0], subcommandUsage())
+		flag.PrintDefaults()
+	}
 	flag.Parse()
+	loadPlugins()
+	if flag.NArg() > 0 {
+		os.Exit(runSubcommand(flag.Args()))
+	}
+	view.Verbose = *verbose
+	view.StartLogging(os.Stderr, *logAsJSON)
+	view.Linter = strings.Fields(*lintCmd)
+	view.CodeMirrorURL = strings.TrimSuffix(*codeMirror, "/")
+	if err := graph.LoadTheme(); err != nil {
+		log.Printf("Could not load theme: %v", err)
+	}
+	if err := view.DetectDot(); err != nil {
+		log.Printf("Graphviz dot not found (%v); drawing graphs with the built-in layout. Install Graphviz for nicer diagrams.", err)
+	}
 	addr := net.JoinHostPort(*serveAddr, strconv.Itoa(*servePort))
+	if *onShutdown != "kill" && *onShutdown != "wait" {
+		log.Fatalf("Unknown -on-shutdown %q; want kill or wait", *onShutdown)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be used together")
+	}
+	if !isLoopback(*serveAddr) {
+		// Anyone who can reach the server can get it to run code.
+		if !*allowRemote {
+			log.Fatalf("Refusing to serve on %s, which is not a loopback address; use -allow-remote if you really mean it", *serveAddr)
+		}
+		log.Printf("WARNING: serving on %s, so other machines can reach this server", *serveAddr)
+		if *authFile == "" {
+			view.AllowBuild = false
+			log.Print("WARNING: building and running are disabled, since -auth is not set")
+		}
+	}
+
+	if *basePath != "" {
+		view.BasePath = "/" + strings.Trim(*basePath, "/")
+	}
+	bp := view.BasePath
+	http.Handle(bp+"/favicon.ico", view.Favicon)
+	http.Handle(bp+"/theme.css", view.ThemeCSS)
+	http.Handle(bp+"/events", view.Events)
+	http.Handle(bp+"/metrics", view.Metrics)
+	http.Handle(bp+"/parts", view.Parts)
+
+	browser := view.NewBrowser()
+	http.Handle(bp+"/", browser)
+	http.Handle(view.AdminPath, browser)
 
-	http.HandleFunc("/ping", func(w http.ResponseWriter, _ *http.Request) {
+	var handler http.Handler = http.DefaultServeMux
+	if *authFile != "" {
+		auth, err := view.LoadBasicAuth(*authFile)
+		if err != nil {
+			log.Fatalf("Could not load users: %v", err)
+		}
+		handler = auth.Require(handler)
+	}
+	// Pinging doesn't need logging in.
+	top := http.NewServeMux()
+	top.HandleFunc(bp+"/ping", func(w http.ResponseWriter, _ *http.Request) {
 		fmt.Fprintf(w, pingMsg)
 	})
-	http.Handle("/favicon.ico", view.Favicon)
-
-	http.Handle("/", view.NewBrowser())
+	top.Handle("/", handler)
 
 	// As soon as we're serving, launch "open" which should launch a browser,
 	// or ask the user to do so.
-	go openWhenUp(addr)
+	scheme := "http"
+	if *tlsCert != "" {
+		scheme = "https"
+	}
+	go openWhenUp(scheme, addr)
 
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	srv := &http.Server{Addr: addr, Handler: view.LogRequests(top)}
+	allowCleartextHTTP2(srv)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		log.Printf("Got %v; shutting down", <-sig)
+		signal.Stop(sig) // A second signal kills us the usual way.
+		if *onShutdown == "kill" {
+			view.KillRuns()
+		}
+		view.Shutdown()
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Could not finish all requests: %v", err)
+		}
+	}()
+
+	var err error
+	if *tlsCert != "" {
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+	<-stopped
 }
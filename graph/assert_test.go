@@ -0,0 +1,74 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+func TestAssert(t *testing.T) {
+	tests := []struct {
+		assert parts.Assert
+		msg    string // Printed as well as the values.
+		err    string
+	}{
+		{
+			assert: parts.Assert{Check: parts.AssertPredicate, Expr: "x%2 == 1", Action: parts.AssertLog},
+			msg:    "assert: 4 violates x%2 == 1\n",
+		},
+		{
+			assert: parts.Assert{Check: parts.AssertIncreasing, Expr: "x", Action: parts.AssertCount},
+			msg:    "assert: 1 values violated increasing\n",
+		},
+		{
+			assert: parts.Assert{Check: parts.AssertNonIncreasing, Expr: "-x", Action: parts.AssertAbort},
+			msg:    "assert: 5 after 7 violates non-increasing by -x\n",
+			err:    "exit status 1",
+		},
+	}
+	for _, test := range tests {
+		g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+			"gen":  "for _, x := range []int{1, 3, 4, 7, 5} { a <- x }; close(a)",
+			"sink": "for x := range b { fmt.Println(x) }",
+		})
+		a := test.assert
+		a.Input, a.Output = "a", "b"
+		if err := a.Validate(); err != nil {
+			t.Errorf("%v: Validate() = %v", a.String(), err)
+		}
+		g.Nodes["assert"] = &Node{Name: "assert", Multiplicity: 1, Part: &a}
+		if errs, err := g.TypeCheckNode(g.Nodes["assert"]); err != nil || len(errs) > 0 {
+			t.Errorf("%v: TypeCheckNode = %v, %v; want no errors", a.String(), errs, err)
+		}
+		g.Termination = WaitSinks
+		out, _, err := simulate(t, g)
+		if err != nil && !strings.Contains(err.Error(), test.err) || err == nil && test.err != "" {
+			t.Errorf("%v: Simulate() = %v, want error %q", a.String(), err, test.err)
+		}
+		if !strings.Contains(out, test.msg) {
+			t.Errorf("%v: Simulate() printed %q, want %q among it", a.String(), out, test.msg)
+		}
+		if test.err != "" {
+			// Values may or may not be printed before the exit.
+			continue
+		}
+		if got, want := strings.Replace(out, test.msg, "", 1), "1\n3\n4\n7\n5\n"; got != want {
+			t.Errorf("%v: Simulate() printed values %q, want %q", a.String(), got, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// instances counts the goroutines started for some nodes.
+func instances(ns []*Node) uint {
+	t := uint(0)
+	for _, n := range ns {
+		m := n.Multiplicity
+		if m < 1 {
+			m = 1
+		}
+		t += m
+	}
+	return t
+}
+
+// CapacityAdvice suggests a capacity for a channel, with a reason. If there
+// is no advice, it returns the current capacity and an empty reason.
+//
+// Currently the only advice is for unbuffered channels between differing
+// numbers of goroutines: the side with more goroutines spends most of its
+// time blocked waiting its turn, and a buffer lets them all make progress.
+func (g *Graph) CapacityAdvice(channel string) (int, string) {
+	c, found := g.Channels[channel]
+	if !found {
+		return 0, ""
+	}
+	if c.Cap > 0 {
+		return c.Cap, ""
+	}
+	e := g.channelEnds()[channel]
+	w, r := instances(e.writers), instances(e.readers)
+	if w == 0 || r == 0 || w == r {
+		return c.Cap, ""
+	}
+	if w > r {
+		return int(w), fmt.Sprintf("%d goroutines write to this unbuffered channel but only %d read from it, so writers will often block", w, r)
+	}
+	return int(r), fmt.Sprintf("%d goroutines read from this unbuffered channel but only %d write to it, so readers will often block", r, w)
+}
+
+// CapValue evaluates a capacity expression, which can refer to the graph's
+// parameters (with their defaults) and declared constants.
+func (g *Graph) CapValue(expr string) (int, error) {
+	return source.ConstInt(expr, g.AllImports(), g.constDecls())
+}
+
+// constDecls returns the parameters (with their defaults) and declarations,
+// for evaluating expressions outside nodes.
+func (g *Graph) constDecls() []source.Var {
+	vars := g.paramDecls(nil)
+	for _, d := range g.AllDeclarations() {
+		vars = append(vars, source.Var{Decl: "source", Value: d})
+	}
+	return vars
+}
+
+// RefreshCaps sets Cap of channels with a CapExpr to its current value, for
+// after the parameters or declarations change. It returns the first error;
+// channels whose expression can't be evaluated are left alone.
+func (g *Graph) RefreshCaps() error {
+	var first error
+	for _, cn := range g.channelNames() {
+		c := g.Channels[cn]
+		if c.CapExpr == "" {
+			continue
+		}
+		v, err := g.CapValue(c.CapExpr)
+		if err != nil {
+			if first == nil {
+				first = fmt.Errorf("channel %s capacity: %v", cn, err)
+			}
+			continue
+		}
+		c.Cap = v
+	}
+	return first
+}
+
+// checkCapacities reports capacity expressions that can't be evaluated.
+func checkCapacities(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, cn := range g.channelNames() {
+		c := g.Channels[cn]
+		if c.CapExpr == "" {
+			continue
+		}
+		if _, err := g.CapValue(c.CapExpr); err != nil {
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Channel:  cn,
+				Msg:      fmt.Sprintf("capacity %s is not a constant whole number: %v", c.CapExpr, err),
+			})
+		}
+	}
+	return ds
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCapExpr(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"gen":  "a <- 1; close(a); b <- 1; close(b)",
+		"sink": "for range a {}; for range b {}",
+	})
+	g.Params = []*Param{{Name: "bufSize", Kind: "const", Default: "8"}}
+	g.Declarations = "const workers = 2"
+	g.Channels["a"].CapExpr = "bufSize * workers"
+	g.Channels["b"].CapExpr = "missing"
+
+	if err := g.RefreshCaps(); err == nil {
+		t.Error("RefreshCaps() succeeded, but b's capacity refers to nothing")
+	}
+	if got := g.Channels["a"].Cap; got != 16 {
+		t.Errorf("a.Cap after RefreshCaps() = %d, want 16", got)
+	}
+	ds := checkCapacities(g)
+	if len(ds) != 1 || ds[0].Channel != "b" {
+		t.Errorf("checkCapacities = %v, want one diagnostic for b", ds)
+	}
+
+	g.Channels["b"].CapExpr = ""
+	var buf bytes.Buffer
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	if !strings.Contains(buf.String(), "make(chan int, bufSize*workers)") {
+		t.Errorf("generated code doesn't make a with the expression:\n%s", buf.String())
+	}
+	if got, want := g.ChannelSummary("a"), "a (chan int, cap bufSize * workers)"; got != want {
+		t.Errorf("ChannelSummary(a) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Severity describes how bad a Diagnostic is.
+type Severity int
+
+// The different severities, from least to most severe.
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Diagnostic is a problem with a graph found by static analysis.
+type Diagnostic struct {
+	Severity Severity
+	Node     string // Name of the node concerned, if any.
+	Channel  string // Name of the channel concerned, if any.
+	Msg      string
+
+	// Delete is true if deleting the node or channel is a plausible fix.
+	Delete bool
+}
+
+func (d Diagnostic) String() string {
+	s := d.Severity.String() + ": "
+	if d.Node != "" {
+		s += fmt.Sprintf("node %q: ", d.Node)
+	}
+	if d.Channel != "" {
+		s += fmt.Sprintf("channel %s: ", d.Channel)
+	}
+	return s + d.Msg
+}
+
+// checks are all the analyses run by Check.
+var checks = []func(*Graph) []Diagnostic{
+	checkCloses,
+	checkTermination,
+	checkDeadlocks,
+	checkOrphans,
+	checkNames,
+	checkSubgraphs,
+	checkBridges,
+	checkChannelTypes,
+	checkCapacities,
+	checkResources,
+	checkTimeouts,
+	checkDeadLetters,
+	checkOverflows,
+	checkPriorities,
+	checkJournals,
+	checkRemotes,
+	checkFixtures,
+	checkScenarios,
+	checkProperties,
+	checkPartVersions,
+	checkPartConfigs,
+}
+
+// Check runs all the static analyses over the graph. The results are sorted
+// by severity (most severe first), then node, then channel.
+func (g *Graph) Check() []Diagnostic {
+	var ds []Diagnostic
+	for _, c := range checks {
+		ds = append(ds, c(g)...)
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		a, b := ds[i], ds[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if a.Node != b.Node {
+			return a.Node < b.Node
+		}
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+		return a.Msg < b.Msg
+	})
+	return ds
+}
+
+// nodeNames returns the names of all nodes, sorted.
+func (g *Graph) nodeNames() []string {
+	ns := make([]string, 0, len(g.Nodes))
+	for n := range g.Nodes {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+// channelNames returns the names of all channels, sorted.
+func (g *Graph) channelNames() []string {
+	cs := make([]string, 0, len(g.Channels))
+	for c := range g.Channels {
+		cs = append(cs, c)
+	}
+	sort.Strings(cs)
+	return cs
+}
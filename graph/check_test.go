@@ -0,0 +1,207 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"testing"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+// testGraph makes a graph of Code nodes from a map of node names to code.
+func testGraph(t *testing.T, chans map[string]int, code map[string]string) *Graph {
+	g := &Graph{
+		Name:        "test",
+		PackagePath: "example.com/test",
+		Nodes:       make(map[string]*Node),
+		Channels:    make(map[string]*Channel),
+	}
+	for c, cap := range chans {
+		g.Channels[c] = &Channel{Name: c, Type: "int", Cap: cap}
+	}
+	for n, src := range code {
+		p := &parts.Code{Code: src}
+		if err := p.Update(nil); err != nil {
+			t.Fatalf("Code.Update(nil) for %q = %v", n, err)
+		}
+		g.Nodes[n] = &Node{Name: n, Multiplicity: 1, Part: p}
+	}
+	return g
+}
+
+func TestCheckCloses(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"gen1": "a <- 1; close(a)",
+		"gen2": "a <- 2; close(a)",
+		"sink": "for range a {}; for range b {}",
+	})
+	got := checkCloses(g)
+	if len(got) != 2 {
+		t.Fatalf("checkCloses = %v, want 2 diagnostics", got)
+	}
+	for _, d := range got {
+		switch d.Channel {
+		case "a":
+			if d.Severity != Error {
+				t.Errorf("checkCloses for channel a = %v, want error", d)
+			}
+		case "b":
+			if d.Severity != Warning || d.Node != "sink" {
+				t.Errorf("checkCloses for channel b = %v, want warning on sink", d)
+			}
+		default:
+			t.Errorf("checkCloses got unexpected diagnostic %v", d)
+		}
+	}
+}
+
+func TestCheckClosesMultipleWriters(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen1": "a <- 1; close(a)",
+		"gen2": "a <- 2",
+		"sink": "for range a {}",
+	})
+	got := checkCloses(g)
+	if len(got) != 1 || got[0].Node != "gen1" || got[0].Channel != "a" || got[0].Severity != Warning {
+		t.Errorf("checkCloses = %v, want one warning on gen1 for channel a", got)
+	}
+}
+
+func TestCheckDeadlocks(t *testing.T) {
+	tests := []struct {
+		desc  string
+		chans map[string]int
+		code  map[string]string
+		want  int
+	}{
+		{
+			desc:  "pipeline",
+			chans: map[string]int{"a": 0, "b": 0},
+			code: map[string]string{
+				"gen":  "a <- 1",
+				"mid":  "b <- <-a",
+				"sink": "<-b",
+			},
+			want: 0,
+		},
+		{
+			desc:  "unbuffered loop fed from outside",
+			chans: map[string]int{"a": 0, "b": 0, "in": 0},
+			code: map[string]string{
+				"gen": "in <- 1",
+				"x":   "<-in; a <- <-b",
+				"y":   "b <- <-a",
+			},
+			want: 1,
+		},
+		{
+			desc:  "buffered loop fed by nothing",
+			chans: map[string]int{"a": 1, "b": 1},
+			code: map[string]string{
+				"x": "a <- <-b",
+				"y": "b <- <-a",
+			},
+			want: 1,
+		},
+		{
+			desc:  "unbuffered self loop",
+			chans: map[string]int{"a": 0},
+			code: map[string]string{
+				"x": "a <- <-a",
+			},
+			want: 2,
+		},
+	}
+	for _, test := range tests {
+		g := testGraph(t, test.chans, test.code)
+		if got := checkDeadlocks(g); len(got) != test.want {
+			t.Errorf("%s: checkDeadlocks = %v, want %d diagnostics", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestCheckOrphans(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0, "unused": 0, "sunk": 1}, map[string]string{
+		"gen":   "a <- 1",
+		"sink":  "<-a",
+		"other": "b <- 1",
+		"more":  "<-b; sunk <- 2",
+		"alone": "println()",
+	})
+	got := make(map[string]bool)
+	for _, d := range checkOrphans(g) {
+		got[d.Node+"/"+d.Channel] = true
+	}
+	want := map[string]bool{
+		"/unused": true, // not used
+		"/sunk":   true, // never read
+		"alone/":  true, // not connected
+		"more/":   true, // disjoint
+	}
+	for k := range want {
+		if !got[k] {
+			t.Errorf("checkOrphans missing diagnostic for %q", k)
+		}
+	}
+	for k := range got {
+		if !want[k] {
+			t.Errorf("checkOrphans unexpected diagnostic for %q", k)
+		}
+	}
+}
+
+func TestCheckNames(t *testing.T) {
+	g := testGraph(t, map[string]int{"fmt": 0, "len": 0, "fmtCh": 0, "ok": 0}, map[string]string{
+		"a": "fmt <- 1; len <- 2; ok <- 3",
+		"b": "<-fmt; <-len; <-ok; wg.Done()",
+	})
+	g.Imports = []string{"fmt"}
+	got := make(map[string]Severity)
+	for _, d := range checkNames(g) {
+		got[d.Node+"/"+d.Channel] = d.Severity
+	}
+	want := map[string]Severity{
+		"/fmt": Error,
+		"/len": Warning,
+		"b/":   Warning,
+	}
+	if len(got) != len(want) {
+		t.Errorf("checkNames = %v, want %v", got, want)
+	}
+	for k, s := range want {
+		if got[k] != s {
+			t.Errorf("checkNames[%q] = %v, want %v", k, got[k], s)
+		}
+	}
+	if got, want := suggestName("fmt", func(s string) bool { return s == "fmt" || s == "fmtCh" }), "fmtCh2"; got != want {
+		t.Errorf("suggestName = %q, want %q", got, want)
+	}
+}
+
+func TestUniqueChannelName(t *testing.T) {
+	g := testGraph(t, map[string]int{"intCh": 0}, nil)
+	g.Imports = []string{"time"}
+	tests := map[string]string{
+		"int":                "intCh2",
+		"[]time.Time":        "timeCh",
+		"map[string]float64": "float64Ch",
+		"":                   "valueCh",
+	}
+	for typ, want := range tests {
+		if got := g.UniqueChannelName(typ); got != want {
+			t.Errorf("UniqueChannelName(%q) = %q, want %q", typ, got, want)
+		}
+	}
+}
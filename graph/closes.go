@@ -0,0 +1,143 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// closeInfo records which nodes close, and which nodes range over, a channel.
+type closeInfo struct {
+	closers, rangers []*Node
+}
+
+// closeAnalysis finds the closers and rangers of every declared channel.
+// Nodes which can't be analysed are returned as diagnostics.
+func (g *Graph) closeAnalysis() (map[string]*closeInfo, []Diagnostic) {
+	info := make(map[string]*closeInfo, len(g.Channels))
+	for c := range g.Channels {
+		info[c] = new(closeInfo)
+	}
+	var ds []Diagnostic
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		if n.Disabled {
+			if in, out, ok := g.bridge(n); ok {
+				info[in].rangers = append(info[in].rangers, n)
+				if n.Closes(out) {
+					info[out].closers = append(info[out].closers, n)
+				}
+			}
+			continue
+		}
+		u, err := n.ChannelUsage()
+		if err != nil {
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Node:     n.Name,
+				Msg:      fmt.Sprintf("cannot analyse implementation: %v", err),
+			})
+			continue
+		}
+		for _, c := range g.DeclaredChannels(u.Closes) {
+			info[c].closers = append(info[c].closers, n)
+		}
+		for _, c := range g.DeclaredChannels(u.Ranges) {
+			info[c].rangers = append(info[c].rangers, n)
+		}
+	}
+	return info, ds
+}
+
+// checkCloses looks for channels closed more than once, channels closed by
+// one of several writers, and channels ranged over but never closed.
+func checkCloses(g *Graph) []Diagnostic {
+	info, ds := g.closeAnalysis()
+	ends := g.channelEnds()
+	auto := make(map[string]bool)
+	for _, c := range g.AutoClosed() {
+		auto[c] = true
+	}
+	for _, c := range g.channelNames() {
+		if auto[c] {
+			// Run closes it.
+			continue
+		}
+		ci := info[c]
+		switch b := g.Channels[c].Boundary; {
+		case b == Input:
+			// Closed by the caller of Run.
+		case b == Output && len(ci.closers) == 0 && len(g.Writers(c)) > 0:
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Channel:  c,
+				Msg:      "output is never closed, so a caller ranging over it never finishes",
+			})
+		}
+		switch len(ci.closers) {
+		case 0:
+			if g.Channels[c].Boundary == Input {
+				break
+			}
+			for _, n := range ci.rangers {
+				msg := "ranges over the channel, but nothing closes it, so the loop never finishes"
+				if g.Waited(n) {
+					msg += " and Run never returns"
+				}
+				ds = append(ds, Diagnostic{Severity: Warning, Node: n.Name, Channel: c, Msg: msg})
+			}
+		case 1:
+			// Fine, unless there are multiple copies of the closer (below),
+			// or other writers that could send after it closes.
+			closer := ci.closers[0]
+			var others []string
+			for _, w := range ends[c].writers {
+				if w != closer {
+					others = append(others, fmt.Sprintf("%q", w.Name))
+				}
+			}
+			if len(others) > 0 {
+				ds = append(ds, Diagnostic{
+					Severity: Warning,
+					Node:     closer.Name,
+					Channel:  c,
+					Msg:      fmt.Sprintf("closes the channel, but %s also write to it, and sending on a closed channel panics; close it only once every writer is finished", strings.Join(others, ", ")),
+				})
+			}
+		default:
+			names := make([]string, 0, len(ci.closers))
+			for _, n := range ci.closers {
+				names = append(names, fmt.Sprintf("%q", n.Name))
+			}
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Channel:  c,
+				Msg:      fmt.Sprintf("closed by %d nodes (%s), but closing a closed channel panics", len(names), strings.Join(names, ", ")),
+			})
+		}
+		for _, n := range ci.closers {
+			if n.Multiplicity > 1 {
+				ds = append(ds, Diagnostic{
+					Severity: Error,
+					Node:     n.Name,
+					Channel:  c,
+					Msg:      fmt.Sprintf("closes the channel, but has multiplicity %d, and closing a closed channel panics", n.Multiplicity),
+				})
+			}
+		}
+	}
+	return ds
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "github.com/google/shenzhen-go/parts"
+
+// checkPartConfigs reports problems parts find with their own configuration.
+// Disabled nodes aren't in the generated code, so they are only warned about.
+func checkPartConfigs(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, name := range g.nodeNames() {
+		n := g.Nodes[name]
+		sev := Error
+		if n.Disabled {
+			sev = Warning
+		}
+		for _, msg := range ConfigProblems(n) {
+			ds = append(ds, Diagnostic{Severity: sev, Node: name, Msg: msg})
+		}
+	}
+	return ds
+}
+
+// ConfigProblems returns the problems the node's part finds with its
+// configuration, one per field where possible.
+func ConfigProblems(n *Node) []string {
+	err := n.Validate()
+	if err == nil {
+		return nil
+	}
+	es, ok := err.(parts.ConfigErrors)
+	if !ok {
+		return []string{err.Error()}
+	}
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return msgs
+}
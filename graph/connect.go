@@ -0,0 +1,149 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "fmt"
+
+// connector is implemented by parts which can be connected to a channel
+// without the user writing the code.
+type connector interface {
+	ConnectOutput(channel, elemType string) error
+	ConnectInput(channel, elemType string) error
+}
+
+// undeclared returns the channels in cs which aren't declared.
+func (g *Graph) undeclared(cs []string) []string {
+	var r []string
+	for _, c := range cs {
+		if _, found := g.Channels[c]; !found {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+// Connect adds a channel from the src node to the dst node. If src already
+// sends to an undeclared channel (ideally one dst receives from), that is
+// declared. Otherwise a new channel is made, and placeholder code using it is
+// added to each node. The element type is inferred from the values src sends
+// if possible, or else the types of channels src already uses.
+func (g *Graph) Connect(src, dst string) (*Channel, error) {
+	s, d := g.Nodes[src], g.Nodes[dst]
+	if s == nil || d == nil {
+		return nil, fmt.Errorf("nodes %q and %q must both exist", src, dst)
+	}
+
+	name := ""
+	outs, ins := g.undeclared(s.ChannelsWritten()), g.undeclared(d.ChannelsRead())
+	for _, o := range outs {
+		for _, i := range ins {
+			if name == "" && o == i {
+				name = o
+			}
+		}
+	}
+	switch {
+	case name != "":
+	case len(outs) > 0:
+		name = outs[0]
+	case len(ins) > 0:
+		name = ins[0]
+	}
+
+	typ := ""
+	if name != "" {
+		typ = g.SuggestChannelType(name)
+	}
+	if typ == "" {
+		for _, c := range g.DeclaredChannels(append(s.ChannelsRead(), s.ChannelsWritten()...)) {
+			typ = g.Channels[c].Type
+			break
+		}
+	}
+	if typ == "" {
+		typ = "interface{}"
+	}
+
+	if name == "" {
+		name = g.UniqueChannelName(typ)
+	}
+
+	// Wire up copies of the nodes, so nothing changes if either fails.
+	s, err := s.Copy()
+	if err != nil {
+		return nil, err
+	}
+	if src == dst {
+		d = s
+	} else if d, err = d.Copy(); err != nil {
+		return nil, err
+	}
+	if !contains(s.ChannelsWritten(), name) {
+		sc, ok := s.Part.(connector)
+		if !ok {
+			return nil, fmt.Errorf("cannot connect the output of %s parts automatically", s.TypeKey())
+		}
+		if err := sc.ConnectOutput(name, typ); err != nil {
+			return nil, err
+		}
+	}
+	if !contains(d.ChannelsRead(), name) {
+		dc, ok := d.Part.(connector)
+		if !ok {
+			return nil, fmt.Errorf("cannot connect the input of %s parts automatically", d.TypeKey())
+		}
+		if err := dc.ConnectInput(name, typ); err != nil {
+			return nil, err
+		}
+	}
+
+	g.Nodes[src], g.Nodes[dst] = s, d
+	c := &Channel{Name: name, Type: typ}
+	g.Channels[name] = c
+	return c, nil
+}
+
+// AddAfter adds n to the graph, renamed if need be so its name is unique, and
+// if from isn't empty, connects the node called from to it (see Connect). It
+// returns the node as added, which may be a copy of n, and the channel, if
+// any. If connecting fails, the graph is left as it was.
+func (g *Graph) AddAfter(n *Node, from string) (*Node, *Channel, error) {
+	if _, found := g.Nodes[from]; from != "" && !found {
+		return nil, nil, fmt.Errorf("node %q not found", from)
+	}
+	n.Name = g.UniqueNodeName(n.Name)
+	if n.Multiplicity == 0 {
+		n.Multiplicity = 1
+	}
+	g.Nodes[n.Name] = n
+	if from == "" {
+		return n, nil, nil
+	}
+	c, err := g.Connect(from, n.Name)
+	if err != nil {
+		delete(g.Nodes, n.Name)
+		return nil, nil, err
+	}
+	return g.Nodes[n.Name], c, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
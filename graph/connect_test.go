@@ -0,0 +1,48 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"testing"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+func TestAddAfter(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen": "a <- 1; close(a)",
+	})
+	n, c, err := g.AddAfter(&Node{Name: "gen", Part: &parts.Code{}}, "gen")
+	if err != nil {
+		t.Fatalf("AddAfter(gen) = %v", err)
+	}
+	if n.Name != "gen 2" || g.Nodes["gen 2"] != n {
+		t.Errorf("AddAfter(gen) added %q, want gen 2", n.Name)
+	}
+	if c == nil || !contains(n.ChannelsRead(), c.Name) || !contains(g.Nodes["gen"].ChannelsWritten(), c.Name) {
+		t.Errorf("AddAfter(gen) channel = %v, want one from gen to gen 2", c)
+	}
+
+	if _, _, err := g.AddAfter(&Node{Name: "mux", Part: &parts.Multiplexer{}}, "gen"); err == nil {
+		t.Error("AddAfter(mux) succeeded, but Multiplexers can't be connected automatically")
+	}
+	if _, found := g.Nodes["mux"]; found {
+		t.Error("AddAfter(mux) failed but left mux in the graph")
+	}
+
+	if _, _, err := g.AddAfter(&Node{Name: "x", Part: &parts.Code{}}, "nope"); err == nil {
+		t.Error("AddAfter(x, nope) succeeded")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "fmt"
+
+// DeadLetterType is the element type of the dead-letter channel.
+const DeadLetterType = "DeadLetter"
+
+// deadLetterDecl declares DeadLetterType, in graphs with a dead-letter channel.
+const deadLetterDecl = `// DeadLetter is an item a goroutine gave up on, sent to the dead-letter
+// channel with deadLetter.
+type DeadLetter struct {
+	Node string      // The goroutine that gave up.
+	Item interface{} // What it gave up on.
+	Err  error       // Why.
+}`
+
+// SendsDeadLetters reports whether the code of n sends dead letters, so its
+// goroutines get deadLetter.
+func (g *Graph) SendsDeadLetters(n *Node) bool {
+	return g.DeadLetters != "" && !n.Disabled && n.refersTo("deadLetter")
+}
+
+// DeadLetterPrologue returns the code declaring deadLetter for the goroutines
+// of n, or "" if they don't use it.
+func (g *Graph) DeadLetterPrologue(n *Node) string {
+	if !g.SendsDeadLetters(n) {
+		return ""
+	}
+	return fmt.Sprintf(`deadLetter := func(item interface{}, err error) {
+	%s <- DeadLetter{Node: %q, Item: item, Err: err}
+}`, g.DeadLetters, n.Name)
+}
+
+// checkDeadLetters reports a dead-letter channel that isn't usable, and
+// nodes that send to or close it directly rather than with deadLetter: Run
+// closes it once every goroutine using deadLetter has finished.
+func checkDeadLetters(g *Graph) []Diagnostic {
+	dl := g.DeadLetters
+	if dl == "" {
+		return nil
+	}
+	c, ok := g.Channels[dl]
+	if !ok {
+		return []Diagnostic{{
+			Severity: Error,
+			Msg:      fmt.Sprintf("the dead-letter channel %s doesn't exist", dl),
+		}}
+	}
+	var ds []Diagnostic
+	if c.Type != DeadLetterType {
+		ds = append(ds, Diagnostic{
+			Severity: Error,
+			Channel:  dl,
+			Msg:      fmt.Sprintf("the dead-letter channel is a chan %s, not a chan %s", c.Type, DeadLetterType),
+		})
+	}
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		direct := n.Closes(dl)
+		for _, w := range n.ChannelsWritten() {
+			direct = direct || w == dl
+		}
+		if direct {
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Node:     nn,
+				Channel:  dl,
+				Msg:      "sends to or closes the dead-letter channel directly; use deadLetter(item, err), so Run knows when to close it",
+			})
+		}
+	}
+	return ds
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+func TestDeadLetters(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen":  `a <- 1; deadLetter(2, errors.New("two")); close(a)`,
+		"sink": "for range a {}",
+	})
+	g.Imports = []string{"errors"}
+	g.DeadLetters = "dead"
+	g.Channels["dead"] = &Channel{Name: "dead", Type: DeadLetterType}
+	g.Nodes["keep"] = &Node{
+		Name:         "keep",
+		Multiplicity: 1,
+		Wait:         true,
+		Part:         &parts.DeadLetterFile{Input: "dead", Path: `"dead.jsonl"`},
+	}
+
+	if ds := checkDeadLetters(g); len(ds) != 0 {
+		t.Errorf("checkDeadLetters = %v, want none", ds)
+	}
+	if got := g.Readers("dead"); len(got) != 1 || got[0].Name != "keep" {
+		t.Errorf("Readers(dead) = %v, want [keep]", got)
+	}
+	if got := g.Writers("dead"); len(got) != 1 || got[0].Name != "gen" {
+		t.Errorf("Writers(dead) = %v, want [gen]", got)
+	}
+	if got := g.AutoClosed(); len(got) != 1 || got[0] != "dead" {
+		t.Errorf("AutoClosed() = %v, want [dead], even waiting for marked goroutines", got)
+	}
+	errs, err := g.TypeCheckNode(g.Nodes["gen"])
+	if err != nil {
+		t.Fatalf("TypeCheckNode(gen) = %v", err)
+	}
+	if len(errs) > 0 {
+		t.Errorf("TypeCheckNode(gen) = %v, want no errors", errs)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	code := buf.String()
+	for _, want := range []string{
+		`"encoding/json"`,
+		"type DeadLetter struct",
+		`dead <- DeadLetter{Node: "gen", Item: item, Err: err}`,
+		"close(dead)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code doesn't contain %q:\n%s", want, code)
+		}
+	}
+
+	g.Nodes["sink"].Part.(*parts.Code).Code = "for range a {}; dead <- DeadLetter{}"
+	g.Nodes["sink"].Part.Update(nil)
+	if ds := checkDeadLetters(g); len(ds) != 1 || ds[0].Node != "sink" {
+		t.Errorf("checkDeadLetters = %v, want an error for sink sending directly", ds)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// checkDeadlocks looks for cycles of nodes that are likely to deadlock: cycles
+// where every channel is unbuffered, and cycles that nothing outside the cycle
+// sends into.
+func checkDeadlocks(g *Graph) []Diagnostic {
+	arcs := g.arcs()
+	var ds []Diagnostic
+	for _, comp := range g.components() {
+		in := make(map[string]bool, len(comp))
+		for _, n := range comp {
+			in[n.Name] = true
+		}
+
+		// Find the channels within the component, and whether anything
+		// outside it sends into it.
+		chans := make(map[string]bool)
+		fed := false
+		for _, as := range arcs {
+			for _, a := range as {
+				switch {
+				case in[a.from.Name] && in[a.to.Name]:
+					chans[a.channel] = true
+				case in[a.to.Name]:
+					fed = true
+				}
+			}
+		}
+		for _, c := range g.BoundaryChannels(Input) {
+			for _, n := range g.Readers(c.Name) {
+				fed = fed || in[n.Name]
+			}
+		}
+		if len(chans) == 0 {
+			// A single node not connected to itself; no cycle.
+			continue
+		}
+
+		names := make([]string, 0, len(comp))
+		for _, n := range comp {
+			names = append(names, fmt.Sprintf("%q", n.Name))
+		}
+		sort.Strings(names)
+		cs := make([]string, 0, len(chans))
+		buffered := false
+		for c := range chans {
+			cs = append(cs, c)
+			buffered = buffered || g.Channels[c].Cap > 0 || g.Channels[c].Queued()
+		}
+		sort.Strings(cs)
+		cycle := fmt.Sprintf("nodes %s form a cycle via channels %s", strings.Join(names, ", "), strings.Join(cs, ", "))
+		if len(comp) == 1 {
+			cycle = fmt.Sprintf("node %s sends to itself via channels %s", names[0], strings.Join(cs, ", "))
+		}
+
+		if !buffered {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Msg:      cycle + ", which are all unbuffered; this deadlocks if every node in the cycle tries to send at once",
+			})
+		}
+		if !fed {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Msg:      cycle + ", but nothing outside the cycle sends into it; unless a node sends before it receives, they wait on each other forever",
+			})
+		}
+	}
+	return ds
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DeleteEffect is what deleting a node or channel would affect.
+type DeleteEffect struct {
+	// Channels are those the deleted node uses, which would no longer be
+	// connected to it.
+	Channels []string
+
+	// Stranded are channels which would be left with nothing reading from
+	// them, or nothing writing to them.
+	Stranded []string
+
+	// Nodes are those whose implementation refers to the deleted channel,
+	// and so would refer to an undeclared channel.
+	Nodes []string
+
+	// Comments are those attached to the deleted node, which would be
+	// detached.
+	Comments []string
+}
+
+// PreviewDeleteNode returns what deleting the node would affect, without
+// changing anything.
+func (g *Graph) PreviewDeleteNode(name string) (*DeleteEffect, error) {
+	return g.PreviewDeleteNodes([]string{name})
+}
+
+// PreviewDeleteNodes returns what deleting all the named nodes at once would
+// affect, without changing anything.
+func (g *Graph) PreviewDeleteNodes(names []string) (*DeleteEffect, error) {
+	ns, err := g.NodesNamed(names)
+	if err != nil {
+		return nil, err
+	}
+	deleted := make(map[*Node]bool, len(ns))
+	for _, n := range ns {
+		deleted[n] = true
+	}
+	eff := new(DeleteEffect)
+	others := func(ns []*Node) int {
+		c := 0
+		for _, m := range ns {
+			if !deleted[m] {
+				c++
+			}
+		}
+		return c
+	}
+	seen := make(map[string]bool)
+	for _, n := range ns {
+		for _, c := range g.DeclaredChannels(append(n.ChannelsRead(), n.ChannelsWritten()...)) {
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			eff.Channels = append(eff.Channels, c)
+			rs, ws := g.Readers(c), g.Writers(c)
+			if (len(rs) > 0 && others(rs) == 0) || (len(ws) > 0 && others(ws) == 0) {
+				eff.Stranded = append(eff.Stranded, c)
+			}
+		}
+	}
+	sort.Strings(eff.Channels)
+	sort.Strings(eff.Stranded)
+	for _, c := range g.Comments {
+		for _, n := range ns {
+			if c.Node == n.Name {
+				eff.Comments = append(eff.Comments, c.Name)
+			}
+		}
+	}
+	sort.Strings(eff.Comments)
+	return eff, nil
+}
+
+// DeleteNodes deletes the named nodes, detaching their comments. Either all
+// of them are deleted, or (if any don't exist) none are.
+func (g *Graph) DeleteNodes(names []string) error {
+	if _, err := g.NodesNamed(names); err != nil {
+		return err
+	}
+	for _, nn := range names {
+		delete(g.Nodes, nn)
+		g.ReattachComments(nn, "")
+	}
+	return nil
+}
+
+// PreviewDeleteChannel returns what deleting the channel would affect,
+// without changing anything.
+func (g *Graph) PreviewDeleteChannel(name string) (*DeleteEffect, error) {
+	if _, found := g.Channels[name]; !found {
+		return nil, fmt.Errorf("no channel %q", name)
+	}
+	eff := new(DeleteEffect)
+	seen := make(map[string]bool)
+	for _, n := range append(g.Readers(name), g.Writers(name)...) {
+		if !seen[n.Name] {
+			seen[n.Name] = true
+			eff.Nodes = append(eff.Nodes, n.Name)
+		}
+	}
+	sort.Strings(eff.Nodes)
+	return eff, nil
+}
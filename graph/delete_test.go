@@ -0,0 +1,89 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPreviewDelete(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"gen1":  "a <- 1; close(a)",
+		"gen2":  "a <- 2",
+		"relay": "for x := range a { b <- x }; close(b)",
+		"sink":  "for range b {}",
+	})
+	g.Comments = map[string]*Comment{
+		"note":  {Name: "note", Text: "hi", Node: "relay"},
+		"other": {Name: "other", Text: "bye", Node: "sink"},
+	}
+
+	got, err := g.PreviewDeleteNode("relay")
+	if err != nil {
+		t.Fatalf("PreviewDeleteNode(relay) = %v", err)
+	}
+	want := &DeleteEffect{
+		Channels: []string{"a", "b"},
+		Stranded: []string{"a", "b"},
+		Comments: []string{"note"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PreviewDeleteNode(relay) = %+v, want %+v", got, want)
+	}
+
+	// a still has another writer.
+	if got, err := g.PreviewDeleteNode("gen2"); err != nil || got.Stranded != nil {
+		t.Errorf("PreviewDeleteNode(gen2) = %+v, %v, want nothing stranded", got, err)
+	}
+
+	got, err = g.PreviewDeleteChannel("a")
+	if err != nil {
+		t.Fatalf("PreviewDeleteChannel(a) = %v", err)
+	}
+	if want := []string{"gen1", "gen2", "relay"}; !reflect.DeepEqual(got.Nodes, want) {
+		t.Errorf("PreviewDeleteChannel(a).Nodes = %v, want %v", got.Nodes, want)
+	}
+
+	if _, err := g.PreviewDeleteNode("nope"); err == nil {
+		t.Error("PreviewDeleteNode(nope) succeeded")
+	}
+}
+
+func TestDeleteNodes(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen":  "a <- 1; close(a)",
+		"sink": "for range a {}",
+	})
+	eff, err := g.PreviewDeleteNodes([]string{"gen", "sink"})
+	if err != nil {
+		t.Fatalf("PreviewDeleteNodes = %v", err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(eff.Stranded, want) {
+		t.Errorf("PreviewDeleteNodes Stranded = %v, want %v", eff.Stranded, want)
+	}
+	if err := g.DeleteNodes([]string{"gen", "nope"}); err == nil {
+		t.Error("DeleteNodes(gen, nope) succeeded")
+	}
+	if len(g.Nodes) != 2 {
+		t.Errorf("failed DeleteNodes left %d nodes, want 2", len(g.Nodes))
+	}
+	if err := g.DeleteNodes([]string{"gen", "sink"}); err != nil {
+		t.Fatalf("DeleteNodes = %v", err)
+	}
+	if len(g.Nodes) != 0 {
+		t.Errorf("DeleteNodes left %v", g.Nodes)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Kinds of deployment manifest.
+const (
+	DeployCompose    = "compose"
+	DeployKubernetes = "kubernetes"
+)
+
+// deployedService is a service with the flags connecting it to the others.
+type deployedService struct {
+	*Service
+	Args  []string // Flags and values setting remote channel addresses.
+	Ports []string // Ports the service listens on.
+}
+
+// deployment is what the manifest templates need.
+type deployment struct {
+	Graph    string // The name of the graph.
+	Services []*deployedService
+	Registry string // Prefixes image names.
+}
+
+// newDeployment works out how services connect. In a deployment each
+// service is a host of the same name, which readers of remote channels
+// listen on at the port of the channel's address.
+func newDeployment(g *Graph, ss []*Service, registry string) (*deployment, error) {
+	readers := make(map[string]string)
+	for _, s := range ss {
+		for _, c := range s.Listens() {
+			readers[c.Name] = s.Name
+		}
+	}
+	d := &deployment{Graph: g.Name, Registry: registry}
+	for _, s := range ss {
+		ds := &deployedService{Service: s}
+		for _, c := range s.Listens() {
+			port, err := remotePort(c)
+			if err != nil {
+				return nil, err
+			}
+			ds.Args = append(ds.Args, "-"+c.Name+"_addr", ":"+port)
+			ds.Ports = append(ds.Ports, port)
+		}
+		for _, c := range s.Dials() {
+			port, err := remotePort(c)
+			if err != nil {
+				return nil, err
+			}
+			ds.Args = append(ds.Args, "-"+c.Name+"_addr", net.JoinHostPort(readers[c.Name], port))
+		}
+		d.Services = append(d.Services, ds)
+	}
+	return d, nil
+}
+
+// remotePort returns the port of a remote channel's address, which must be
+// a number for manifests.
+func remotePort(c *Channel) (string, error) {
+	_, port, err := net.SplitHostPort(c.Remote)
+	if err != nil {
+		return "", fmt.Errorf("remote channel %s: %v", c.Name, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("remote channel %s: port %q isn't a number", c.Name, port)
+	}
+	return port, nil
+}
+
+// WriteDeploymentTo writes a manifest of the given kind (DeployCompose or
+// DeployKubernetes) for the services of g, which Split returned. Compose
+// builds each service from its directory; Kubernetes runs each as a Job,
+// from the image named registry + service name, with a Service for the ports
+// it listens on.
+func (g *Graph) WriteDeploymentTo(w io.Writer, kind string, ss []*Service, registry string) error {
+	d, err := newDeployment(g, ss, registry)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case DeployCompose:
+		return composeTemplate.Execute(w, d)
+	case DeployKubernetes:
+		return kubernetesTemplate.Execute(w, d)
+	}
+	return fmt.Errorf("unknown kind of deployment %q", kind)
+}
+
+// WriteDockerfileTo writes a Dockerfile building the service from its
+// directory.
+func (s *Service) WriteDockerfileTo(w io.Writer) error {
+	return dockerfileTemplate.Execute(w, s)
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteDeploymentTo(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 2}, map[string]string{
+		"Gen":  "for i := 0; i < 10; i++ { a <- i }; close(a)",
+		"Mid":  "for x := range a { b <- x }; close(b)",
+		"Sink": "for range b {}",
+	})
+	g.Channels["a"].Remote = "localhost:9001"
+	g.Channels["b"].Remote = "localhost:9002"
+	ss, err := g.Split()
+	if err != nil {
+		t.Fatalf("Split = %v", err)
+	}
+
+	tests := []struct {
+		kind string
+		want []string
+	}{
+		{
+			kind: DeployCompose,
+			want: []string{
+				"  gen:\n    build: ./gen\n    command: [\"-a_addr\", \"mid:9001\"]\n",
+				"  mid:\n    build: ./mid\n    command: [\"-a_addr\", \":9001\", \"-b_addr\", \"sink:9002\"]\n    expose: [\"9001\"]\n",
+			},
+		},
+		{
+			kind: DeployKubernetes,
+			want: []string{
+				"kind: Job\nmetadata:\n  name: gen\n",
+				"image: registry.example.com/test/mid\n",
+				"- containerPort: 9002\n",
+				"kind: Service\nmetadata:\n  name: sink\n",
+			},
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := g.WriteDeploymentTo(&buf, test.kind, ss, "registry.example.com/test/"); err != nil {
+			t.Errorf("WriteDeploymentTo(%s) = %v", test.kind, err)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("WriteDeploymentTo(%s) doesn't contain %q:\n%s", test.kind, want, buf.String())
+			}
+		}
+	}
+
+	g.Channels["a"].Remote = "localhost:http"
+	if ss, err = g.Split(); err != nil {
+		t.Fatalf("Split = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := g.WriteDeploymentTo(&buf, DeployCompose, ss, ""); err == nil {
+		t.Error("WriteDeploymentTo with a named port = nil error, want error")
+	}
+}
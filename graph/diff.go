@@ -0,0 +1,282 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is the kind of difference between two versions of a thing.
+type Change string
+
+// The kinds of change.
+const (
+	Added    Change = "added"
+	Removed  Change = "removed"
+	Modified Change = "modified"
+)
+
+// DiffLine is a line in a line-level diff. Op is ' ' for lines in both,
+// '-' for lines only in the old version, and '+' for lines only in the new.
+type DiffLine struct {
+	Op   byte
+	Text string
+}
+
+func (l DiffLine) String() string { return string(l.Op) + l.Text }
+
+// Kind describes the line as "same", "removed", or "added".
+func (l DiffLine) Kind() string {
+	switch l.Op {
+	case '-':
+		return "removed"
+	case '+':
+		return "added"
+	}
+	return "same"
+}
+
+// NodeDiff describes a node that differs.
+type NodeDiff struct {
+	Name    string
+	Change  Change
+	Details []string   // Descriptions of changed fields.
+	Code    []DiffLine // Line diff of the implementation.
+}
+
+// ChannelDiff describes a channel that differs.
+type ChannelDiff struct {
+	Name    string
+	Change  Change
+	Details []string
+}
+
+// GraphDiff describes the differences between two graphs.
+type GraphDiff struct {
+	Details  []string // Changes to graph properties.
+	Nodes    []NodeDiff
+	Channels []ChannelDiff
+}
+
+// Empty is true if there are no differences.
+func (d *GraphDiff) Empty() bool {
+	return len(d.Details) == 0 && len(d.Nodes) == 0 && len(d.Channels) == 0
+}
+
+func paramsString(g *Graph) string {
+	return strings.Join(g.ParamDecls(), "; ")
+}
+
+func changed(what string, before, after interface{}) string {
+	return fmt.Sprintf("%s: %v → %v", what, before, after)
+}
+
+// Diff compares an earlier version of a graph with a later one.
+func Diff(before, after *Graph) *GraphDiff {
+	d := &GraphDiff{}
+	if before.Name != after.Name {
+		d.Details = append(d.Details, changed("name", before.Name, after.Name))
+	}
+	if before.PackagePath != after.PackagePath {
+		d.Details = append(d.Details, changed("package path", before.PackagePath, after.PackagePath))
+	}
+	if o, n := strings.Join(before.Imports, ", "), strings.Join(after.Imports, ", "); o != n {
+		d.Details = append(d.Details, changed("imports", o, n))
+	}
+	if o, n := paramsString(before), paramsString(after); o != n {
+		d.Details = append(d.Details, changed("parameters", o, n))
+	}
+	if before.Declarations != after.Declarations {
+		d.Details = append(d.Details, "declarations changed")
+	}
+	if before.Termination != after.Termination {
+		d.Details = append(d.Details, changed("termination", before.Termination, after.Termination))
+	}
+	if before.Logging != after.Logging {
+		d.Details = append(d.Details, changed("logging", before.Logging, after.Logging))
+	}
+	if before.DeadLetters != after.DeadLetters {
+		d.Details = append(d.Details, changed("dead-letter channel", before.DeadLetters, after.DeadLetters))
+	}
+	if len(before.Scenarios)+len(after.Scenarios) > 0 && !reflect.DeepEqual(before.Scenarios, after.Scenarios) {
+		d.Details = append(d.Details, "scenarios changed")
+	}
+
+	for _, nn := range unionKeys(before.nodeNames(), after.nodeNames()) {
+		o, n := before.Nodes[nn], after.Nodes[nn]
+		switch {
+		case o == nil:
+			d.Nodes = append(d.Nodes, NodeDiff{Name: nn, Change: Added, Code: LineDiff("", n.Impl())})
+		case n == nil:
+			d.Nodes = append(d.Nodes, NodeDiff{Name: nn, Change: Removed, Code: LineDiff(o.Impl(), "")})
+		default:
+			if nd := diffNodes(o, n); nd != nil {
+				d.Nodes = append(d.Nodes, *nd)
+			}
+		}
+	}
+
+	for _, cn := range unionKeys(before.channelNames(), after.channelNames()) {
+		o, n := before.Channels[cn], after.Channels[cn]
+		switch {
+		case o == nil:
+			d.Channels = append(d.Channels, ChannelDiff{Name: cn, Change: Added})
+		case n == nil:
+			d.Channels = append(d.Channels, ChannelDiff{Name: cn, Change: Removed})
+		default:
+			var ds []string
+			if o.Type != n.Type {
+				ds = append(ds, changed("type", o.Type, n.Type))
+			}
+			if o.CapSource() != n.CapSource() {
+				ds = append(ds, changed("capacity", o.CapSource(), n.CapSource()))
+			}
+			if o.Overflow != n.Overflow {
+				ds = append(ds, changed("overflow", overflowName(o.Overflow), overflowName(n.Overflow)))
+			}
+			if o.Priority != n.Priority {
+				ds = append(ds, changed("priority", o.Priority, n.Priority))
+			}
+			if o.Journal != n.Journal {
+				ds = append(ds, changed("journal", o.Journal, n.Journal))
+			}
+			if o.Remote != n.Remote {
+				ds = append(ds, changed("remote address", o.Remote, n.Remote))
+			}
+			if o.Fixture.String() != n.Fixture.String() {
+				ds = append(ds, changed("samples", o.Fixture.String(), n.Fixture.String()))
+			}
+			if len(ds) > 0 {
+				d.Channels = append(d.Channels, ChannelDiff{Name: cn, Change: Modified, Details: ds})
+			}
+		}
+	}
+	return d
+}
+
+// diffNodes compares two nodes with the same name, returning nil if they
+// are the same.
+func diffNodes(o, n *Node) *NodeDiff {
+	var ds []string
+	if o.Multiplicity != n.Multiplicity {
+		ds = append(ds, changed("multiplicity", o.Multiplicity, n.Multiplicity))
+	}
+	if o.Wait != n.Wait {
+		ds = append(ds, changed("wait", o.Wait, n.Wait))
+	}
+	if o.Resources != n.Resources {
+		ds = append(ds, changed("resources", o.Resources, n.Resources))
+	}
+	if o.Timeout != n.Timeout {
+		ds = append(ds, changed("timeout", o.Timeout, n.Timeout))
+	}
+	var code []DiffLine
+	if o.Impl() != n.Impl() {
+		code = LineDiff(o.Impl(), n.Impl())
+	}
+	if o.TypeKey() != n.TypeKey() {
+		ds = append(ds, changed("part type", o.TypeKey(), n.TypeKey()))
+	} else if code == nil {
+		// Parts may differ in ways not visible in the implementation.
+		oj, oerr := json.Marshal(o.Part)
+		nj, nerr := json.Marshal(n.Part)
+		if oerr != nil || nerr != nil || !bytes.Equal(oj, nj) {
+			ds = append(ds, "part settings changed")
+		}
+	}
+	if len(ds) == 0 && code == nil {
+		return nil
+	}
+	return &NodeDiff{Name: n.Name, Change: Modified, Details: ds, Code: code}
+}
+
+// unionKeys merges two sorted lists of names.
+func unionKeys(a, b []string) []string {
+	m := make(map[string]bool, len(a)+len(b))
+	for _, k := range a {
+		m[k] = true
+	}
+	for _, k := range b {
+		m[k] = true
+	}
+	u := make([]string, 0, len(m))
+	for k := range m {
+		u = append(u, k)
+	}
+	sort.Strings(u)
+	return u
+}
+
+// splitLines splits text into lines, ignoring carriage returns and a final
+// line break.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// LineDiff computes a line-level diff between two texts, using the longest
+// common subsequence of lines.
+func LineDiff(before, after string) []DiffLine {
+	a, b := splitLines(before), splitLines(after)
+
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ls []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ls = append(ls, DiffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ls = append(ls, DiffLine{'-', a[i]})
+			i++
+		default:
+			ls = append(ls, DiffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ls = append(ls, DiffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ls = append(ls, DiffLine{'+', b[j]})
+	}
+	return ls
+}
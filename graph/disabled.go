@@ -0,0 +1,81 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "fmt"
+
+// bridge returns the channels a disabled node passes values between, if it
+// is set to bridge and reads and writes exactly one channel each.
+func (g *Graph) bridge(n *Node) (in, out string, ok bool) {
+	if !n.Disabled || !n.Bridge {
+		return "", "", false
+	}
+	rs, ws := g.DeclaredChannels(n.ChannelsRead()), g.DeclaredChannels(n.ChannelsWritten())
+	if len(rs) != 1 || len(ws) != 1 {
+		return "", "", false
+	}
+	return rs[0], ws[0], true
+}
+
+// BridgeImpl returns code passing values straight through a disabled node,
+// or "" if the node doesn't bridge. The output is closed if the node would
+// have closed it.
+func (g *Graph) BridgeImpl(n *Node) string {
+	in, out, ok := g.bridge(n)
+	if !ok {
+		return ""
+	}
+	code := fmt.Sprintf("for x := range %s {\n\t%s <- x\n}", in, out)
+	if n.Closes(out) {
+		code += fmt.Sprintf("\nclose(%s)", out)
+	}
+	return code
+}
+
+// activeChannels returns the channels a node reads and writes in the
+// generated code, including the dead-letter channel if it uses deadLetter:
+// none if it is disabled, unless it bridges.
+func (g *Graph) activeChannels(n *Node) (read, written []string) {
+	if !n.Disabled {
+		w := n.ChannelsWritten()
+		if g.SendsDeadLetters(n) {
+			w = append(w[:len(w):len(w)], g.DeadLetters)
+		}
+		return g.DeclaredChannels(n.ChannelsRead()), g.DeclaredChannels(w)
+	}
+	if in, out, ok := g.bridge(n); ok {
+		return []string{in}, []string{out}
+	}
+	return nil, nil
+}
+
+// checkBridges reports disabled nodes which are set to bridge, but can't.
+func checkBridges(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		if !n.Disabled || !n.Bridge {
+			continue
+		}
+		if _, _, ok := g.bridge(n); !ok {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Node:     nn,
+				Msg:      "disabled and set to bridge, but it doesn't read exactly one channel and write exactly one channel",
+			})
+		}
+	}
+	return ds
+}
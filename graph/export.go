@@ -0,0 +1,124 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// exportArc is an edge in an exported diagram. Either end may be nil, if
+// nothing writes to or reads from the channel.
+type exportArc struct {
+	from, to *Node
+	channel  string
+	label    string
+}
+
+// exportArcs returns connections between nodes, as in arcs, but also includes
+// channels missing a reader or writer, and labels them with the element type.
+func (g *Graph) exportArcs() []exportArc {
+	ends := g.channelEnds()
+	var as []exportArc
+	for _, c := range g.channelNames() {
+		e, label := ends[c], fmt.Sprintf("%s: %s", c, g.Channels[c].Type)
+		ws, rs := e.writers, e.readers
+		if len(ws) == 0 {
+			ws = []*Node{nil}
+		}
+		if len(rs) == 0 {
+			rs = []*Node{nil}
+		}
+		for _, w := range ws {
+			for _, r := range rs {
+				if w == nil && r == nil {
+					continue
+				}
+				as = append(as, exportArc{from: w, to: r, channel: c, label: label})
+			}
+		}
+	}
+	return as
+}
+
+// WriteMermaidTo writes the graph as a Mermaid flowchart, for embedding in
+// Markdown. Channels with no writer (or reader) start (or end) at a small
+// circle named after the channel.
+func (g *Graph) WriteMermaidTo(dst io.Writer) error {
+	b := bufio.NewWriter(dst)
+	quote := func(s string) string {
+		return `"` + strings.Replace(s, `"`, "#quot;", -1) + `"`
+	}
+	ids := make(map[*Node]string, len(g.Nodes))
+	fmt.Fprintln(b, "flowchart TD")
+	for i, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		ids[n] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(b, "    %s[%s]\n", ids[n], quote(n.Name))
+	}
+	end := func(n *Node, c string) string {
+		if n != nil {
+			return ids[n]
+		}
+		id := "c_" + c
+		fmt.Fprintf(b, "    %s((%s))\n", id, quote(c))
+		return id
+	}
+	for _, a := range g.exportArcs() {
+		from, to := end(a.from, a.channel), end(a.to, a.channel)
+		fmt.Fprintf(b, "    %s -->|%s| %s\n", from, quote(a.label), to)
+	}
+	return b.Flush()
+}
+
+// WritePlantUMLTo writes the graph as a PlantUML activity diagram. Nodes
+// which nothing writes to follow the start, and nodes which write to nothing
+// lead to the end.
+func (g *Graph) WritePlantUMLTo(dst io.Writer) error {
+	b := bufio.NewWriter(dst)
+	quote := func(s string) string {
+		return `"` + strings.Replace(s, `"`, "'", -1) + `"`
+	}
+	name := func(n *Node) string {
+		if n == nil {
+			return "(*)"
+		}
+		return quote(n.Name)
+	}
+	fmt.Fprintln(b, "@startuml")
+	fmt.Fprintf(b, "title %s\n", g.Name)
+	as := g.exportArcs()
+	in, out := make(map[*Node]bool), make(map[*Node]bool)
+	for _, a := range as {
+		out[a.from], in[a.to] = true, true
+	}
+	for _, nn := range g.nodeNames() {
+		if n := g.Nodes[nn]; !in[n] {
+			fmt.Fprintf(b, "(*) --> %s\n", name(n))
+		}
+	}
+	for _, a := range as {
+		fmt.Fprintf(b, "%s --> [%s] %s\n", name(a.from), a.label, name(a.to))
+	}
+	for _, nn := range g.nodeNames() {
+		if n := g.Nodes[nn]; !out[n] {
+			fmt.Fprintf(b, "%s --> (*)\n", name(n))
+		}
+	}
+	fmt.Fprintln(b, "@enduml")
+	return b.Flush()
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteMermaidTo(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"gen":  "a <- 1; close(a)",
+		"sink": "for range a {}; for range b {}",
+	})
+	var buf bytes.Buffer
+	if err := g.WriteMermaidTo(&buf); err != nil {
+		t.Fatalf("WriteMermaidTo = %v", err)
+	}
+	for _, want := range []string{
+		`n0["gen"]`,
+		`n0 -->|"a: int"| n1`,
+		`c_b(("b"))`,
+		`c_b -->|"b: int"| n1`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteMermaidTo output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestWritePlantUMLTo(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen":  "a <- 1; close(a)",
+		"sink": "for range a {}",
+	})
+	var buf bytes.Buffer
+	if err := g.WritePlantUMLTo(&buf); err != nil {
+		t.Fatalf("WritePlantUMLTo = %v", err)
+	}
+	for _, want := range []string{
+		`(*) --> "gen"`,
+		`"gen" --> [a: int] "sink"`,
+		`"sink" --> (*)`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WritePlantUMLTo output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// Fixture is sample data for a channel, so that one set of examples serves
+// for running a goroutine by itself (see RunScratch), simulating (see
+// Simulate and NewStepper), and testing. Values are Go expressions.
+// Generator, if set, is a Go expression of i making Count more values, for
+// i from 0.
+type Fixture struct {
+	Values    []string `json:"values,omitempty"`
+	Generator string   `json:"generator,omitempty"`
+	Count     int      `json:"count,omitempty"`
+}
+
+func (f *Fixture) String() string {
+	if f == nil {
+		return ""
+	}
+	s := strings.Join(f.Values, ", ")
+	if f.Generator != "" {
+		if s != "" {
+			s += ", then "
+		}
+		s += fmt.Sprintf("%d of %s", f.Count, f.Generator)
+	}
+	return s
+}
+
+// SampleExprs returns the values of the channel's fixture as Go expressions,
+// or nil if it has none.
+func (c *Channel) SampleExprs() []string {
+	f := c.Fixture
+	if f == nil {
+		return nil
+	}
+	es := append([]string(nil), f.Values...)
+	if f.Generator != "" {
+		for i := 0; i < f.Count; i++ {
+			es = append(es, fmt.Sprintf("func(i int) %s { return %s }(%d)", c.Type, f.Generator, i))
+		}
+	}
+	return es
+}
+
+// Samples returns the sample values (as Go expressions) of every channel
+// with a fixture.
+func (g *Graph) Samples() map[string][]string {
+	ss := make(map[string][]string)
+	for cn, c := range g.Channels {
+		if es := c.SampleExprs(); es != nil {
+			ss[cn] = es
+		}
+	}
+	return ss
+}
+
+// CheckFixture checks the channel's fixture makes values of its type.
+func (g *Graph) CheckFixture(c *Channel) error {
+	f := c.Fixture
+	if f == nil {
+		return nil
+	}
+	if f.Count < 0 {
+		return fmt.Errorf("invalid count [%d < 0]", f.Count)
+	}
+	if (f.Generator == "") != (f.Count == 0) {
+		return fmt.Errorf("a generator needs a count of values to make, and a count needs a generator")
+	}
+	for i, v := range f.Values {
+		if err := g.checkSample(c, v, nil); err != nil {
+			return fmt.Errorf("value %d: %v", i+1, err)
+		}
+	}
+	if f.Generator != "" {
+		if err := g.checkSample(c, f.Generator, []source.Var{{Name: "i", Type: "int"}}); err != nil {
+			return fmt.Errorf("generator: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkSample checks expr, which can refer to params, is a value of the
+// channel's type.
+func (g *Graph) checkSample(c *Channel, expr string, params []source.Var) error {
+	params = append([]source.Var{{Name: "shenzhenSamples", Type: "chan " + c.Type}}, params...)
+	errs, err := source.TypeCheck("shenzhenSamples <- "+expr, g.AllImports(), g.constDecls(), params)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errors.New(errs[0].Msg)
+	}
+	return nil
+}
+
+// checkFixtures reports fixtures which don't make values of their channel's
+// type.
+func checkFixtures(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, cn := range g.channelNames() {
+		if err := g.CheckFixture(g.Channels[cn]); err != nil {
+			ds = append(ds, Diagnostic{Severity: Error, Channel: cn, Msg: fmt.Sprintf("samples: %v", err)})
+		}
+	}
+	return ds
+}
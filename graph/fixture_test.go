@@ -0,0 +1,96 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckFixture(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, nil)
+	g.Imports = []string{"strings"}
+	g.Channels["s"] = &Channel{Name: "s", Type: "string"}
+	tests := []struct {
+		c    string
+		f    *Fixture
+		want string
+	}{
+		{c: "a", f: nil},
+		{c: "a", f: &Fixture{Values: []string{"1", "2 * 3"}, Generator: "i * i", Count: 4}},
+		{c: "s", f: &Fixture{Values: []string{`strings.Repeat("x", 3)`}}},
+		{c: "a", f: &Fixture{Values: []string{"1", `"two"`}}, want: `value 2: cannot use "two"`},
+		{c: "s", f: &Fixture{Generator: "i", Count: 2}, want: "generator: cannot use i"},
+		{c: "a", f: &Fixture{Generator: "i"}, want: "a generator needs a count"},
+		{c: "a", f: &Fixture{Count: -1}, want: "invalid count"},
+	}
+	for _, test := range tests {
+		c := g.Channels[test.c]
+		c.Fixture = test.f
+		err := g.CheckFixture(c)
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("CheckFixture(%s with %v) = %v", test.c, test.f, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("CheckFixture(%s with %v) = %v, want an error containing %q", test.c, test.f, err, test.want)
+		}
+	}
+}
+
+func TestSampleExprs(t *testing.T) {
+	c := &Channel{Name: "a", Type: "int", Fixture: &Fixture{Values: []string{"7"}, Generator: "i * 2", Count: 2}}
+	want := []string{"7", "func(i int) int { return i * 2 }(0)", "func(i int) int { return i * 2 }(1)"}
+	if got := c.SampleExprs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SampleExprs() = %q, want %q", got, want)
+	}
+	if got := (&Channel{Name: "b", Type: "int"}).SampleExprs(); got != nil {
+		t.Errorf("SampleExprs() without a fixture = %q, want nil", got)
+	}
+}
+
+func TestFixturesSimulated(t *testing.T) {
+	g := testGraph(t, map[string]int{"in": 0}, map[string]string{
+		"sink": "for x := range in { fmt.Println(x) }",
+	})
+	g.Channels["in"].Boundary = Input
+	g.Channels["in"].Fixture = &Fixture{Values: []string{"5"}, Generator: "i + 10", Count: 2}
+	g.Termination = WaitAll
+
+	var out strings.Builder
+	err := g.Simulate(context.Background(), 0, func(e SimEvent) {
+		if e.Kind == SimOutput {
+			out.WriteString(e.Value)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Simulate() = %v", err)
+	}
+	if got, want := out.String(), "5\n10\n11\n"; got != want {
+		t.Errorf("Simulate() printed %q, want %q", got, want)
+	}
+
+	s := g.NewStepper(1)
+	for s.Steps < 100 && len(s.Moves()) > 0 {
+		s.Step(0)
+	}
+	if !s.Finished() || s.Steps != 3 {
+		t.Errorf("Stepper finished = %t after %d steps, want true after 3 (one per sample)", s.Finished(), s.Steps)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Neighbourhood returns a graph containing only the named node and the nodes
+// up to depth channels upstream or downstream of it, along with the channels
+// they use and any comments on them. It shares nodes and channels with g, so
+// is only suitable for viewing. It returns nil if there is no such node.
+func (g *Graph) Neighbourhood(name string, depth int) *Graph {
+	start := g.Nodes[name]
+	if start == nil {
+		return nil
+	}
+
+	// Nodes using each channel, in either direction.
+	users := make(map[string][]*Node)
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		for _, c := range g.DeclaredChannels(append(n.ChannelsRead(), n.ChannelsWritten()...)) {
+			users[c] = append(users[c], n)
+		}
+	}
+
+	h := *g
+	h.Nodes = map[string]*Node{name: start}
+	h.Channels = make(map[string]*Channel)
+	h.Comments = make(map[string]*Comment)
+	frontier := []*Node{start}
+	for d := 0; d < depth && len(frontier) > 0; d++ {
+		var next []*Node
+		for _, n := range frontier {
+			for _, c := range g.DeclaredChannels(append(n.ChannelsRead(), n.ChannelsWritten()...)) {
+				for _, m := range users[c] {
+					if h.Nodes[m.Name] == nil {
+						h.Nodes[m.Name] = m
+						next = append(next, m)
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+	for _, n := range h.Nodes {
+		for _, c := range g.DeclaredChannels(append(n.ChannelsRead(), n.ChannelsWritten()...)) {
+			h.Channels[c] = g.Channels[c]
+		}
+	}
+	for k, c := range g.Comments {
+		if h.Nodes[c.Node] != nil {
+			h.Comments[k] = c
+		}
+	}
+	return &h
+}
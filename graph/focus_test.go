@@ -0,0 +1,57 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNeighbourhood(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0, "c": 0}, map[string]string{
+		"first":  "a <- 1; close(a)",
+		"second": "for x := range a { b <- x }; close(b)",
+		"third":  "for x := range b { c <- x }; close(c)",
+		"fourth": "for range c {}",
+	})
+	tests := []struct {
+		depth int
+		nodes []string
+		chans []string
+	}{
+		{0, []string{"second"}, []string{"a", "b"}},
+		{1, []string{"first", "second", "third"}, []string{"a", "b", "c"}},
+		{2, []string{"first", "fourth", "second", "third"}, []string{"a", "b", "c"}},
+	}
+	for _, test := range tests {
+		h := g.Neighbourhood("second", test.depth)
+		var nodes, chans []string
+		for n := range h.Nodes {
+			nodes = append(nodes, n)
+		}
+		for c := range h.Channels {
+			chans = append(chans, c)
+		}
+		sort.Strings(nodes)
+		sort.Strings(chans)
+		if !reflect.DeepEqual(nodes, test.nodes) || !reflect.DeepEqual(chans, test.chans) {
+			t.Errorf("Neighbourhood(second, %d) has nodes %v and channels %v, want %v and %v", test.depth, nodes, chans, test.nodes, test.chans)
+		}
+	}
+	if h := g.Neighbourhood("fifth", 1); h != nil {
+		t.Errorf("Neighbourhood(fifth, 1) = %v, want nil", h)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// Fragment is part of a graph: some nodes and channels, with the groups and
+// imports they use, which can be pasted into another graph. Its JSON is in
+// the same form as a graph file's.
+type Fragment struct {
+	Imports  []string            `json:"imports,omitempty"`
+	Nodes    map[string]*Node    `json:"nodes"`
+	Channels map[string]*Channel `json:"channels,omitempty"`
+	Groups   map[string]*Group   `json:"groups,omitempty"`
+}
+
+// Fragment copies the named nodes and channels, together with the channels
+// the nodes use, and the groups and imports they need.
+func (g *Graph) Fragment(nodes, channels []string) (*Fragment, error) {
+	f := &Fragment{
+		Nodes:    make(map[string]*Node),
+		Channels: make(map[string]*Channel),
+	}
+	used := make(map[string]bool)
+	for _, nn := range nodes {
+		n, found := g.Nodes[nn]
+		if !found {
+			return nil, fmt.Errorf("no node %q", nn)
+		}
+		m, err := n.Copy()
+		if err != nil {
+			return nil, err
+		}
+		f.Nodes[nn] = m
+		channels = append(channels, g.DeclaredChannels(append(n.ChannelsRead(), n.ChannelsWritten()...))...)
+		if gr := g.Groups[n.Group]; gr != nil {
+			if f.Groups == nil {
+				f.Groups = make(map[string]*Group)
+			}
+			c := *gr
+			f.Groups[n.Group] = &c
+		}
+		// Only the imports the code refers to are needed.
+		ids, err := source.FreeIdents(n.Impl())
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			used[id] = true
+		}
+	}
+	for _, cn := range channels {
+		c, found := g.Channels[cn]
+		if !found {
+			return nil, fmt.Errorf("no channel %q", cn)
+		}
+		d := *c
+		f.Channels[cn] = &d
+	}
+	for _, i := range g.Imports {
+		if used[importName(i)] {
+			f.Imports = append(f.Imports, i)
+		}
+	}
+	return f, nil
+}
+
+// Paste adds the contents of the fragment to the graph. Nodes and channels
+// whose names are taken are renamed (and nodes using renamed channels are
+// changed to match). Renamed nodes are unpinned, so they don't cover the
+// originals. It returns the names of the pasted nodes and channels, keyed by
+// their names in the fragment. Either everything is pasted, or (if there is
+// an error) nothing is.
+func (g *Graph) Paste(f *Fragment) (nodes, channels map[string]string, err error) {
+	channels = make(map[string]string, len(f.Channels))
+	taken := func(s string) bool {
+		if _, inFrag := f.Channels[s]; inFrag || g.nameTaken(s) {
+			return true
+		}
+		for _, to := range channels {
+			if to == s {
+				return true
+			}
+		}
+		return false
+	}
+	cns := make([]string, 0, len(f.Channels))
+	for cn := range f.Channels {
+		cns = append(cns, cn)
+	}
+	sort.Strings(cns)
+	for _, cn := range cns {
+		to := cn
+		if _, found := g.Channels[cn]; found {
+			for i := 2; taken(to); i++ {
+				to = fmt.Sprintf("%s%d", cn, i)
+			}
+		}
+		channels[cn] = to
+	}
+
+	nodes = make(map[string]string, len(f.Nodes))
+	added := make(map[string]*Node, len(f.Nodes))
+	nns := make([]string, 0, len(f.Nodes))
+	for nn := range f.Nodes {
+		nns = append(nns, nn)
+	}
+	sort.Strings(nns)
+	for _, nn := range nns {
+		m, err := g.CopyNode(f.Nodes[nn])
+		if err != nil {
+			return nil, nil, err
+		}
+		for from, to := range channels {
+			if from == to {
+				continue
+			}
+			if err := m.RenameChannel(from, to); err != nil {
+				return nil, nil, fmt.Errorf("node %q: %v", nn, err)
+			}
+		}
+		m.Name = nn
+		if _, found := g.Nodes[nn]; found {
+			m.Name = uniqueName(nn, func(s string) bool {
+				_, inGraph := g.Nodes[s]
+				_, inFrag := f.Nodes[s]
+				return inGraph || inFrag || added[s] != nil
+			})
+			m.Pos = nil
+		}
+		nodes[nn] = m.Name
+		added[m.Name] = m
+	}
+
+	// Nothing can go wrong now.
+	for name, m := range added {
+		g.Nodes[name] = m
+	}
+	for cn, to := range channels {
+		c := *f.Channels[cn]
+		c.Name = to
+		g.Channels[to] = &c
+	}
+	for gn, gr := range f.Groups {
+		if _, found := g.Groups[gn]; !found {
+			if g.Groups == nil {
+				g.Groups = make(map[string]*Group)
+			}
+			c := *gr
+			g.Groups[gn] = &c
+		}
+	}
+	for _, i := range f.Imports {
+		if !contains(g.Imports, i) {
+			g.Imports = append(g.Imports, i)
+		}
+	}
+	return nodes, channels, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFragmentPaste(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"gen":   "a <- len(strconv.Itoa(1)); close(a)",
+		"sink":  "for range a {}",
+		"other": "for range b {}",
+	})
+	g.Imports = []string{"fmt", "strconv"}
+	g.Nodes["gen"].Pos = &Position{X: 10, Y: 20}
+
+	f, err := g.Fragment([]string{"gen", "sink"}, nil)
+	if err != nil {
+		t.Fatalf("Fragment(gen, sink) = %v", err)
+	}
+	if want := []string{"strconv"}; !reflect.DeepEqual(f.Imports, want) {
+		t.Errorf("Fragment(gen, sink).Imports = %v, want %v", f.Imports, want)
+	}
+	if _, found := f.Channels["a"]; !found || len(f.Channels) != 1 {
+		t.Errorf("Fragment(gen, sink).Channels = %v, want just a", f.Channels)
+	}
+
+	// Through JSON, as the clipboard would.
+	j, err := json.Marshal(f)
+	if err != nil {
+		t.Fatalf("json.Marshal(fragment) = %v", err)
+	}
+	f = new(Fragment)
+	if err := json.Unmarshal(j, f); err != nil {
+		t.Fatalf("json.Unmarshal(fragment) = %v", err)
+	}
+
+	// Pasting into the same graph renames everything.
+	nodes, channels, err := g.Paste(f)
+	if err != nil {
+		t.Fatalf("Paste = %v", err)
+	}
+	if want := map[string]string{"gen": "gen 2", "sink": "sink 2"}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("Paste nodes = %v, want %v", nodes, want)
+	}
+	if want := map[string]string{"a": "a2"}; !reflect.DeepEqual(channels, want) {
+		t.Errorf("Paste channels = %v, want %v", channels, want)
+	}
+	gen := g.Nodes["gen 2"]
+	if gen == nil {
+		t.Fatal("gen 2 not in graph after Paste")
+	}
+	if gen.Pos != nil {
+		t.Errorf("gen 2 Pos = %v, want nil", gen.Pos)
+	}
+	if impl := gen.Impl(); !strings.Contains(impl, "a2 <-") || !strings.Contains(impl, "close(a2)") {
+		t.Errorf("gen 2 code = %q, want it to use a2", impl)
+	}
+	if _, found := g.Channels["a2"]; !found {
+		t.Error("channel a2 not in graph after Paste")
+	}
+	if g.Nodes["gen"].Pos == nil {
+		t.Error("original gen lost its position")
+	}
+
+	// Pasting into an empty graph keeps the names, and adds the imports.
+	h := testGraph(t, nil, nil)
+	nodes, channels, err = h.Paste(f)
+	if err != nil {
+		t.Fatalf("Paste into empty graph = %v", err)
+	}
+	if want := map[string]string{"gen": "gen", "sink": "sink"}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("Paste nodes = %v, want %v", nodes, want)
+	}
+	if want := map[string]string{"a": "a"}; !reflect.DeepEqual(channels, want) {
+		t.Errorf("Paste channels = %v, want %v", channels, want)
+	}
+	if want := []string{"strconv"}; !reflect.DeepEqual(h.Imports, want) {
+		t.Errorf("Imports after Paste = %v, want %v", h.Imports, want)
+	}
+	if h.Nodes["gen"].Pos == nil {
+		t.Error("gen lost its position pasting into empty graph")
+	}
+
+	if _, err := g.Fragment([]string{"nope"}, nil); err == nil {
+		t.Error("Fragment(nope) succeeded")
+	}
+}
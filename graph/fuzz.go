@@ -0,0 +1,153 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FuzzTimeout is how long the goroutine may take over each fuzzed input
+// before the fuzz test fails, as for a hang.
+const FuzzTimeout = 5 * time.Second
+
+// fuzzTypes are the channel types fuzz targets are made for.
+var fuzzTypes = map[string]bool{"string": true, "[]byte": true}
+
+// Fuzzable reports whether a fuzz target can be made for the node: it reads
+// at least one channel, and only channels of strings or byte slices (other
+// than any it also writes).
+func (g *Graph) Fuzzable(n *Node) bool {
+	h, err := g.Scratch(n.Name)
+	if err != nil {
+		return false
+	}
+	ins := h.BoundaryChannels(Input)
+	for _, c := range ins {
+		if !fuzzTypes[c.Type] {
+			return false
+		}
+	}
+	return len(ins) > 0
+}
+
+// FuzzTargets returns the names of the nodes that are Fuzzable, sorted.
+func (g *Graph) FuzzTargets() []string {
+	var ns []string
+	for _, nn := range g.nodeNames() {
+		if g.Fuzzable(g.Nodes[nn]) {
+			ns = append(ns, nn)
+		}
+	}
+	return ns
+}
+
+// FuzzFuncName returns the name of the fuzz target for the node, e.g.
+// "FuzzParseLines" for "parse lines".
+func FuzzFuncName(node string) string { return funcName("Fuzz", node) }
+
+// FuzzDir returns a name for the directory of the fuzz target for the node,
+// e.g. "fuzz-parse-lines" for "parse lines".
+func FuzzDir(node string) string { return "fuzz-" + strings.TrimPrefix(serviceName(node), "service-") }
+
+// Fuzz returns the graph Scratch makes of the node, as the package named
+// fuzz, which the fuzz target tests (see WriteFuzzTestTo).
+func (g *Graph) Fuzz(node string) (*Graph, error) {
+	if n := g.Nodes[node]; n == nil || !g.Fuzzable(n) {
+		return nil, fmt.Errorf("%s doesn't only read strings or byte slices", node)
+	}
+	h, err := g.Scratch(node)
+	if err != nil {
+		return nil, err
+	}
+	h.PackagePath = "fuzz"
+	return h, nil
+}
+
+// WriteFuzzTestTo writes a Go fuzz test (for go test -fuzz) of the node, for
+// the package of the graph Fuzz makes of it. Each input sends one fuzzed
+// value to each channel the node reads, then closes them, and whatever the
+// node sends is discarded; the test fails if it panics or takes longer than
+// FuzzTimeout. The seed corpus is the samples of the channels' fixtures,
+// taken in step.
+func (g *Graph) WriteFuzzTestTo(w io.Writer, node string) error {
+	h, err := g.Fuzz(node)
+	if err != nil {
+		return err
+	}
+	ins := h.BoundaryChannels(Input)
+	var seeds [][]string
+	var text strings.Builder
+	for i, c := range ins {
+		es := c.SampleExprs()
+		fmt.Fprintln(&text, strings.Join(es, "\n"))
+		for j, e := range es {
+			for len(seeds) <= j {
+				seeds = append(seeds, make([]string, len(ins)))
+			}
+			seeds[j][i] = e
+		}
+	}
+	for _, s := range seeds {
+		for i, e := range s {
+			switch {
+			case e == "":
+				// This channel has fewer samples than another.
+				s[i] = `""`
+				if ins[i].Type == "[]byte" {
+					s[i] = "[]byte(nil)"
+				}
+			case ins[i].Type == "[]byte" && !strings.HasPrefix(e, "[]byte("):
+				// f.Add needs values of exactly the types fuzzed.
+				s[i] = "[]byte(" + e + ")"
+			}
+		}
+	}
+	used := map[string]bool{"testing": true, "time": true}
+	if len(h.BoundaryChannels(Output)) > 0 {
+		used["sync"] = true
+	}
+	for _, i := range g.Imports {
+		if mentionsImport(text.String(), i) {
+			used[i] = true
+		}
+	}
+	imps := make([]string, 0, len(used))
+	for i := range used {
+		imps = append(imps, i)
+	}
+	sort.Strings(imps)
+	buf := &bytes.Buffer{}
+	d := struct {
+		*Graph
+		Node, Func string
+		Imports    []string
+		Inputs     []*Channel
+		Seeds      [][]string
+		Timeout    string
+	}{h, node, FuzzFuncName(node), imps, ins, seeds, Timeout{Duration: FuzzTimeout.String()}.Source()}
+	if err := fuzzTestTemplate.Execute(buf, d); err != nil {
+		return err
+	}
+	if err := gofmt(w, bytes.NewReader(buf.Bytes())); err != nil {
+		// Most likely a sample isn't an expression.
+		return fmt.Errorf("invalid samples: %v", err)
+	}
+	return nil
+}
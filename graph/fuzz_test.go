@@ -0,0 +1,68 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFuzz(t *testing.T) {
+	g := testGraph(t, map[string]int{"nums": 0}, map[string]string{
+		"gen":   `lines <- "4"; raw <- nil; close(lines); close(raw)`,
+		"parse": "for s := range lines { n, _ := strconv.Atoi(s); nums <- 100 / n }; for range raw {}; close(nums)",
+		"print": "for n := range nums { fmt.Println(n) }",
+	})
+	g.Imports = []string{"fmt", "strconv"}
+	g.Channels["lines"] = &Channel{Name: "lines", Type: "string", Fixture: &Fixture{Values: []string{`"1"`, `"25"`}}}
+	g.Channels["raw"] = &Channel{Name: "raw", Type: "[]byte", Fixture: &Fixture{Values: []string{`nil`}}}
+
+	if got := g.FuzzTargets(); len(got) != 1 || got[0] != "parse" {
+		t.Errorf("FuzzTargets() = %v, want [parse]", got)
+	}
+	if got, want := FuzzFuncName("parse lines"), "FuzzParseLines"; got != want {
+		t.Errorf("FuzzFuncName(parse lines) = %q, want %q", got, want)
+	}
+	h, err := g.Fuzz("parse")
+	if err != nil {
+		t.Fatalf("Fuzz(parse) = %v", err)
+	}
+	if got := h.PackageName(); got != "fuzz" {
+		t.Errorf("Fuzz(parse).PackageName() = %q, want fuzz", got)
+	}
+	if _, err := g.Fuzz("print"); err == nil {
+		t.Errorf("Fuzz(print) = nil error, want an error (it reads ints)")
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteFuzzTestTo(&buf, "parse"); err != nil {
+		t.Fatalf("WriteFuzzTestTo = %v", err)
+	}
+	for _, want := range []string{
+		"package fuzz",
+		"func FuzzParse(f *testing.F) {",
+		`f.Add("1", []byte(nil))`,
+		`f.Add("25", []byte(nil))`,
+		"f.Fuzz(func(t *testing.T, v0 string, v1 []byte) {",
+		"lines <- v0",
+		"raw <- v1",
+		"Run(lines, nums, raw)",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteFuzzTestTo wrote:\n%s\nwant it to contain %q", buf.String(), want)
+		}
+	}
+}
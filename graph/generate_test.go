@@ -0,0 +1,91 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteGoGenerateTo(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"first":  "a <- 1; close(a)",
+		"second": "for x := range a { b <- x }; close(b)",
+		"third":  "for range b {}",
+	})
+	const cmd = "shenzhen-go generate -o . -gogenerate ../test.szgo"
+	var first bytes.Buffer
+	if err := g.WriteGoGenerateTo(&first, cmd); err != nil {
+		t.Fatalf("WriteGoGenerateTo() = %v", err)
+	}
+	if want := "\n//go:generate " + cmd + "\n"; !strings.Contains(first.String(), want) {
+		t.Errorf("WriteGoGenerateTo() output lacks %q:\n%s", want, first.String())
+	}
+	for i := 0; i < 10; i++ {
+		var again bytes.Buffer
+		if err := g.WriteGoGenerateTo(&again, cmd); err != nil {
+			t.Fatalf("WriteGoGenerateTo() = %v", err)
+		}
+		if again.String() != first.String() {
+			t.Fatalf("WriteGoGenerateTo() output differs between runs:\n%s\nvs\n%s", first.String(), again.String())
+		}
+	}
+
+	var plain bytes.Buffer
+	if err := g.WriteGoTo(&plain); err != nil {
+		t.Fatalf("WriteGoTo() = %v", err)
+	}
+	if strings.Contains(plain.String(), "go:generate") {
+		t.Errorf("WriteGoTo() output has a go:generate directive:\n%s", plain.String())
+	}
+}
+
+func TestNodeGo(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"first":  "a <- 1; close(a)",
+		"second": "for x := range a { b <- x }; close(b)",
+	})
+	n := g.Nodes["second"]
+	n.Multiplicity, n.Wait = 2, true
+	got, err := g.NodeGo(n)
+	if err != nil {
+		t.Fatalf("NodeGo(second) = %v", err)
+	}
+	want := `var wg sync.WaitGroup
+
+// second
+wg.Add(2)
+for n := 0; n < 2; n++ {
+	go func(instanceNumber int) {
+		defer wg.Done()
+
+		for x := range a {
+			b <- x
+		}
+		close(b)
+	}(n)
+}
+
+// Wait for the end
+wg.Wait()
+`
+	if got != want {
+		t.Errorf("NodeGo(second) =\n%s\nwant\n%s", got, want)
+	}
+	if strings.Contains(got, "first") {
+		t.Errorf("NodeGo(second) includes another node:\n%s", got)
+	}
+}
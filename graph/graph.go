@@ -17,15 +17,18 @@ package graph
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"go/format"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -34,16 +37,109 @@ type Channel struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
 	Cap  int    `json:"cap"`
+
+	// Boundary is Input or Output for channels connecting the graph to the
+	// outside world, which are passed to Run instead of made by it.
+	Boundary string `json:"boundary,omitempty"`
+
+	// CapExpr, if set, is a constant expression for the capacity, which can
+	// refer to parameters and declared constants (e.g. "bufSize"). It is
+	// used in the generated code, and Cap holds its value.
+	CapExpr string `json:"cap_expr,omitempty"`
+
+	// Overflow is what happens to values sent when the buffer is full (see
+	// OverflowPolicies). The default is for senders to wait.
+	Overflow string `json:"overflow,omitempty"`
+
+	// Priority, if set, makes the channel a priority queue: it is an
+	// expression of x, a value sent, and values with smaller keys are
+	// received first (e.g. "-x.Urgency"). Values with equal keys are
+	// received in the order they were sent.
+	Priority string `json:"priority,omitempty"`
+
+	// Journal, if set, is a Go string expression naming a file values sent
+	// are journaled to until a reader receives them, so they survive the
+	// program restarting.
+	Journal string `json:"journal,omitempty"`
+
+	// Remote, if set, is the address (host:port) readers listen on when the
+	// graph is split into services (see Split), making the channel a process
+	// boundary. Otherwise it is an ordinary channel.
+	Remote string `json:"remote,omitempty"`
+
+	// Fixture, if set, is sample data for the channel.
+	Fixture *Fixture `json:"fixture,omitempty"`
+}
+
+// CapSource returns the capacity as Go source: CapExpr if set, otherwise
+// Cap.
+func (c *Channel) CapSource() string {
+	if c.CapExpr != "" {
+		return c.CapExpr
+	}
+	return strconv.Itoa(c.Cap)
+}
+
+// Kinds of boundary channel.
+const (
+	Input  = "input"
+	Output = "output"
+)
+
+// ParamType returns the type of the channel as a parameter of Run: inputs
+// are receive-only and outputs are send-only.
+func (c *Channel) ParamType() string {
+	switch c.Boundary {
+	case Input:
+		return "<-chan " + c.Type
+	case Output:
+		return "chan<- " + c.Type
+	}
+	return "chan " + c.Type
+}
+
+// Comment is a note on the diagram, optionally attached to a node. Comments
+// don't affect the generated code.
+type Comment struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+	Node string `json:"node,omitempty"`
 }
 
 // Graph describes a Go program as a graph. It can be marshalled and unmarshalled to JSON sensibly.
 type Graph struct {
-	SourcePath  string              `json:"-"` // path to the JSON source.
-	Name        string              `json:"name"`
-	PackagePath string              `json:"package_path"`
-	Imports     []string            `json:"imports"`
-	Nodes       map[string]*Node    `json:"nodes"`
-	Channels    map[string]*Channel `json:"channels"`
+	SourcePath   string              `json:"-"` // path to the JSON source.
+	Name         string              `json:"name"`
+	PackagePath  string              `json:"package_path"`
+	Imports      []string            `json:"imports"`
+	Params       []*Param            `json:"params,omitempty"`
+	Declarations string              `json:"declarations,omitempty"`
+	Nodes        map[string]*Node    `json:"nodes"`
+	Channels     map[string]*Channel `json:"channels"`
+	Comments     map[string]*Comment `json:"comments,omitempty"`
+	Groups       map[string]*Group   `json:"groups,omitempty"`
+
+	// Termination is how Run decides which goroutines to wait for:
+	// WaitMarked, WaitSinks, or WaitAll. Except with WaitMarked, Run also
+	// closes channels nothing else closes (see AutoClosed).
+	Termination string `json:"termination,omitempty"`
+
+	// Logging, if set, declares a log/slog logger in the generated code,
+	// available to goroutines as logger. It is the default level, which a
+	// generated -log_level flag overrides.
+	Logging string `json:"logging,omitempty"`
+
+	// DeadLetters, if set, names a channel of DeadLetter, which goroutines
+	// send items they give up on to with deadLetter(item, err). Run closes
+	// it once they have all finished.
+	DeadLetters string `json:"dead_letters,omitempty"`
+
+	// Scenarios are tests of the whole graph (see RunScenarios).
+	Scenarios []*Scenario `json:"scenarios,omitempty"`
+
+	// HideEdgeLabels turns off the type and capacity labels on edges in the
+	// diagram.
+	HideEdgeLabels bool `json:"hide_edge_labels,omitempty"`
 }
 
 // PackageName extracts the name of the package from the package path ("full" package name).
@@ -57,12 +153,19 @@ func (g *Graph) PackageName() string {
 
 // LoadJSON loads a JSON-encoded Graph from an io.Reader.
 func LoadJSON(r io.Reader, sourcePath string) (*Graph, error) {
+	return loadJSON(r, sourcePath, nil)
+}
+
+func loadJSON(r io.Reader, sourcePath string, chain []string) (*Graph, error) {
 	dec := json.NewDecoder(r)
 	var g Graph
 	if err := dec.Decode(&g); err != nil {
 		return nil, err
 	}
 	g.SourcePath = sourcePath
+	g.loadSubgraphs(chain)
+	// Problems are reported by Check.
+	g.RefreshCaps()
 	return &g, nil
 }
 
@@ -83,7 +186,8 @@ func (g *Graph) WriteJSONTo(w io.Writer) error {
 	return enc.Encode(g)
 }
 
-// SaveJSONFile saves the JSON-encoded Graph to the SourcePath.
+// SaveJSONFile saves the JSON-encoded Graph to the SourcePath, and notes the
+// part versions it was saved with.
 func (g *Graph) SaveJSONFile() error {
 	f, err := ioutil.TempFile(filepath.Dir(g.SourcePath), filepath.Base(g.SourcePath))
 	if err != nil {
@@ -96,7 +200,11 @@ func (g *Graph) SaveJSONFile() error {
 	if err := f.Close(); err != nil {
 		return err
 	}
-	return os.Rename(f.Name(), g.SourcePath)
+	if err := os.Rename(f.Name(), g.SourcePath); err != nil {
+		return err
+	}
+	g.recordPartVersions()
+	return nil
 }
 
 // WriteDotTo writes the Dot language view of the graph to the io.Writer.
@@ -104,8 +212,20 @@ func (g *Graph) WriteDotTo(dst io.Writer) error { return dotTemplate.Execute(dst
 
 // WriteGoTo writes the Go language view of the graph to the io.Writer.
 func (g *Graph) WriteGoTo(w io.Writer) error {
+	return g.WriteGoGenerateTo(w, "")
+}
+
+// WriteGoGenerateTo is like WriteGoTo, but the Go includes a go:generate
+// directive to run cmd (unless it is empty), e.g.
+// "shenzhen-go generate -o . ../graph.szgo". The output only depends on g
+// and cmd, so regenerating an unchanged graph changes nothing.
+func (g *Graph) WriteGoGenerateTo(w io.Writer, cmd string) error {
 	buf := &bytes.Buffer{}
-	if err := goTemplate.Execute(buf, g); err != nil {
+	d := struct {
+		*Graph
+		GoGenerate string
+	}{g, cmd}
+	if err := goTemplate.Execute(buf, d); err != nil {
 		return err
 	}
 	return gofmt(w, buf)
@@ -117,8 +237,32 @@ func (g *Graph) WriteGoRunnerTo(w io.Writer) error {
 	return goRunnerTemplate.Execute(w, g)
 }
 
+// NodeGo returns the Go generated for n, as it would appear in the body of
+// Run: its goroutines, and the WaitGroup they use. If the code doesn't
+// format, it is returned unformatted along with the error.
+func (g *Graph) NodeGo(n *Node) (string, error) {
+	h := *g
+	h.Nodes = map[string]*Node{n.Name: n}
+	buf := bytes.NewBufferString("package p\n\nfunc Run() {\n")
+	if err := goTemplate.ExecuteTemplate(buf, "run_body", &h); err != nil {
+		return "", err
+	}
+	buf.WriteString("\n}\n")
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return buf.String(), err
+	}
+	// Keep only the body, unindented.
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	lines = lines[3 : len(lines)-1]
+	for i, l := range lines {
+		lines[i] = strings.TrimPrefix(l, "\t")
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
 // GeneratePackage writes the Go view of the graph to a file called generated.go in
-// ${GOPATH}/src/${g.PackagePath}/.
+// ${GOPATH}/src/${g.PackagePath}/, along with any tests (see TestFiles).
 func (g *Graph) GeneratePackage() error {
 	gopath, ok := os.LookupEnv("GOPATH")
 	if !ok || gopath == "" {
@@ -128,27 +272,109 @@ func (g *Graph) GeneratePackage() error {
 	if err := os.Mkdir(pp, os.FileMode(0755)); err != nil {
 		log.Printf("Could not make path %q, continuing: %v", pp, err)
 	}
-	mp := filepath.Join(pp, "generated.go")
-	f, err := os.Create(mp)
+	return g.GenerateTo(pp, "")
+}
+
+// GenerateTo writes the Go view of the graph to dir/generated.go, with a
+// go:generate directive running cmd if it is not empty (see
+// WriteGoGenerateTo), and any tests (see TestFiles). Test files the graph no
+// longer has are removed.
+func (g *Graph) GenerateTo(dir, cmd string) error {
+	buf := &bytes.Buffer{}
+	if err := g.WriteGoGenerateTo(buf, cmd); err != nil {
+		return err
+	}
+	if err := WriteIfChanged(filepath.Join(dir, "generated.go"), buf.Bytes()); err != nil {
+		return err
+	}
+	for _, t := range g.TestFiles() {
+		tp := filepath.Join(dir, t.Name)
+		if t.Write == nil {
+			if err := os.Remove(tp); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		buf.Reset()
+		if err := t.Write(buf); err != nil {
+			return err
+		}
+		if err := WriteIfChanged(tp, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestFile is a test file generated for the package of a graph.
+type TestFile struct {
+	Name  string
+	Write func(io.Writer) error // Nil if the graph has nothing to test.
+}
+
+// TestFiles returns the test files generated for the package: tests of the
+// scenarios, and of the properties of goroutines.
+func (g *Graph) TestFiles() []TestFile {
+	ts := []TestFile{{Name: "generated_test.go"}, {Name: "generated_property_test.go"}}
+	if len(g.Scenarios) > 0 {
+		ts[0].Write = g.WriteScenarioTestsTo
+	}
+	if len(g.PropertyNodes()) > 0 {
+		ts[1].Write = g.WritePropertyTestsTo
+	}
+	return ts
+}
+
+// WriteIfChanged writes the file, unless it already has the contents, so it
+// isn't rebuilt needlessly. It makes the file's directory if need be, and
+// replaces the file all at once.
+func WriteIfChanged(path string, b []byte) error {
+	if old, err := ioutil.ReadFile(path); err == nil && bytes.Equal(old, b) {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(path))
 	if err != nil {
 		return err
 	}
+	defer os.Remove(f.Name())
 	defer f.Close()
-	if err := g.WriteGoTo(f); err != nil {
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
 		return err
 	}
-	return f.Close()
+	return os.Rename(f.Name(), path)
 }
 
 // Build saves the graph as Go source code and tries to build it.
 func (g *Graph) Build() error {
+	var o bytes.Buffer
+	err := g.BuildContext(context.Background(), &o)
+	if err != nil && o.Len() > 0 {
+		// TODO: better error type
+		return fmt.Errorf("%v:\n%s", err, o.Bytes())
+	}
+	return err
+}
+
+// BuildContext is like Build, but copies what go build prints to out as it
+// goes, and stops the build if ctx is done before it finishes.
+func (g *Graph) BuildContext(ctx context.Context, out io.Writer) error {
 	if err := g.GeneratePackage(); err != nil {
 		return err
 	}
-	o, err := exec.Command(`go`, `build`, g.PackagePath).CombinedOutput()
-	if err != nil {
-		// TODO: better error type
-		return fmt.Errorf("go build: %v:\n%s", err, o)
+	cmd := exec.CommandContext(ctx, `go`, `build`, g.PackagePath)
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go build: %v", err)
 	}
 	return nil
 }
@@ -172,6 +398,12 @@ func (g *Graph) writeTempRunner() (string, error) {
 // Run saves the graph as Go source code, creates a temporary runner, and tries to run it.
 // The stdout and stderr pipes are copied to the given io.Writers.
 func (g *Graph) Run(stdout, stderr io.Writer) error {
+	return g.RunContext(context.Background(), stdout, stderr)
+}
+
+// RunContext is like Run, but kills the program if ctx is done before it
+// finishes.
+func (g *Graph) RunContext(ctx context.Context, stdout, stderr io.Writer) error {
 	// Don't have to explicitly build, but must at least have the file ready
 	// so that go run can build it.
 	if err := g.GeneratePackage(); err != nil {
@@ -184,21 +416,60 @@ func (g *Graph) Run(stdout, stderr io.Writer) error {
 	if err != nil {
 		return err
 	}
-	cmd := exec.Command(`go`, `run`, p)
-	o, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
+	// Run waits for everything printed to be copied.
+	cmd := exec.CommandContext(ctx, `go`, `run`, p)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return cmd.Run()
+}
+
+// ChannelSummary describes a channel briefly, e.g. "raw (chan int, cap 4)".
+func (g *Graph) ChannelSummary(name string) string {
+	c, found := g.Channels[name]
+	if !found {
+		return name
 	}
-	e, err := cmd.StderrPipe()
-	if err != nil {
-		return err
+	return fmt.Sprintf("%s (chan %s, %s)", c.Name, c.Type, c.capNote())
+}
+
+// EdgeLabel is the label for the edges of a channel in the diagram.
+type EdgeLabel struct {
+	// Text is the element type and capacity, e.g. "int, cap 64".
+	Text string
+
+	// OnReaders is set when nothing writes to the channel, so the edges to
+	// readers should be labelled instead of the edges from writers.
+	OnReaders bool
+}
+
+// EdgeLabels returns labels for the edges of each channel in the diagram,
+// keyed by channel name. It returns nil if edge labels are hidden.
+func (g *Graph) EdgeLabels() map[string]EdgeLabel {
+	if g.HideEdgeLabels {
+		return nil
 	}
-	if err := cmd.Start(); err != nil {
-		return err
+	ends := g.channelEnds()
+	ls := make(map[string]EdgeLabel, len(g.Channels))
+	for n, c := range g.Channels {
+		l := EdgeLabel{Text: fmt.Sprintf("%s, %s", c.Type, c.capNote())}
+		if e := ends[n]; e == nil || len(e.writers) == 0 {
+			l.OnReaders = true
+		}
+		ls[n] = l
 	}
-	go io.Copy(stdout, o)
-	go io.Copy(stderr, e)
-	return cmd.Wait()
+	return ls
+}
+
+// BoundaryChannels returns the channels of the given kind (Input or Output),
+// sorted by name. If kind is empty, it returns both kinds.
+func (g *Graph) BoundaryChannels(kind string) []*Channel {
+	var cs []*Channel
+	for _, c := range g.channelNames() {
+		ch := g.Channels[c]
+		if ch.Boundary != "" && (kind == "" || ch.Boundary == kind) {
+			cs = append(cs, ch)
+		}
+	}
+	return cs
 }
 
 // DeclaredChannels returns the given channels which exist in g.Channels.
@@ -211,3 +482,52 @@ func (g *Graph) DeclaredChannels(chans []string) []string {
 	}
 	return r
 }
+
+// UniqueCommentName returns a name for a new comment.
+func (g *Graph) UniqueCommentName() string {
+	for n := len(g.Comments) + 1; ; n++ {
+		s := fmt.Sprintf("comment%d", n)
+		if _, found := g.Comments[s]; !found {
+			return s
+		}
+	}
+}
+
+// ReattachComments moves comments attached to one node to another, for when
+// the node is renamed. If to is empty, the comments are left unattached.
+func (g *Graph) ReattachComments(from, to string) {
+	for _, c := range g.Comments {
+		if c.Node == from {
+			c.Node = to
+		}
+	}
+}
+
+// UniqueNodeName suggests a name for a new node based on base, which isn't
+// the name of any existing node. A trailing number is incremented, so
+// "Worker 2" becomes "Worker 3".
+func (g *Graph) UniqueNodeName(base string) string {
+	return uniqueName(base, func(s string) bool {
+		_, found := g.Nodes[s]
+		return found
+	})
+}
+
+// uniqueName returns base, or if that is taken, base with a number.
+func uniqueName(base string, taken func(string) bool) string {
+	if !taken(base) {
+		return base
+	}
+	n := 2
+	if i := strings.LastIndex(base, " "); i >= 0 {
+		if m, err := strconv.Atoi(base[i+1:]); err == nil {
+			base, n = base[:i], m+1
+		}
+	}
+	for ; ; n++ {
+		s := fmt.Sprintf("%s %d", base, n)
+		if !taken(s) {
+			return s
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultGroupColor is the background colour of groups without one set.
+const DefaultGroupColor = "#eeeeee"
+
+var hexColorRE = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// colorNames are the colour names both Graphviz and CSS understand.
+var colorNames = make(map[string]bool)
+
+func init() {
+	for _, n := range strings.Fields(`
+	aliceblue antiquewhite aqua aquamarine azure beige bisque black
+	blanchedalmond blue blueviolet brown burlywood cadetblue chartreuse
+	chocolate coral cornflowerblue cornsilk crimson cyan darkblue darkcyan
+	darkgoldenrod darkgray darkgreen darkgrey darkkhaki darkmagenta
+	darkolivegreen darkorange darkorchid darkred darksalmon darkseagreen
+	darkslateblue darkslategray darkslategrey darkturquoise darkviolet
+	deeppink deepskyblue dimgray dimgrey dodgerblue firebrick floralwhite
+	forestgreen fuchsia gainsboro ghostwhite gold goldenrod gray green
+	greenyellow grey honeydew hotpink indianred indigo ivory khaki lavender
+	lavenderblush lawngreen lemonchiffon lightblue lightcoral lightcyan
+	lightgoldenrodyellow lightgray lightgreen lightgrey lightpink
+	lightsalmon lightseagreen lightskyblue lightslategray lightslategrey
+	lightsteelblue lightyellow lime limegreen linen magenta maroon
+	mediumaquamarine mediumblue mediumorchid mediumpurple mediumseagreen
+	mediumslateblue mediumspringgreen mediumturquoise mediumvioletred
+	midnightblue mintcream mistyrose moccasin navajowhite navy oldlace olive
+	olivedrab orange orangered orchid palegoldenrod palegreen paleturquoise
+	palevioletred papayawhip peachpuff peru pink plum powderblue purple red
+	rosybrown royalblue saddlebrown salmon sandybrown seagreen seashell
+	sienna silver skyblue slateblue slategray slategrey snow springgreen
+	steelblue tan teal thistle tomato turquoise violet wheat white
+	whitesmoke yellow yellowgreen`) {
+		colorNames[n] = true
+	}
+}
+
+// ValidColor reports whether c is a colour a group may have: "#rrggbb", or
+// a colour name such as "lavender".
+func ValidColor(c string) bool {
+	return hexColorRE.MatchString(c) || colorNames[c]
+}
+
+// Group describes how a named group of nodes is drawn. Nodes belong to a
+// group by naming it; groups don't affect the generated code.
+type Group struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// NodeGroup is a group together with its member nodes, sorted by name.
+type NodeGroup struct {
+	*Group
+	Nodes []*Node
+}
+
+// Group returns the group with the given name, which may be a default if
+// it has no entry in g.Groups.
+func (g *Graph) Group(name string) *Group {
+	if gr, found := g.Groups[name]; found {
+		return gr
+	}
+	return &Group{Name: name, Color: DefaultGroupColor}
+}
+
+// GroupNames returns the sorted names of the groups nodes belong to.
+func (g *Graph) GroupNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, n := range g.Nodes {
+		if n.Group != "" && !seen[n.Group] {
+			seen[n.Group] = true
+			names = append(names, n.Group)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NodeGroups returns the nodes of the graph partitioned by group. The first
+// element is always the nodes without a group, and has an empty name.
+func (g *Graph) NodeGroups() []*NodeGroup {
+	ngs := []*NodeGroup{{Group: &Group{}}}
+	idx := make(map[string]*NodeGroup)
+	for _, gn := range g.GroupNames() {
+		ng := &NodeGroup{Group: g.Group(gn)}
+		idx[gn] = ng
+		ngs = append(ngs, ng)
+	}
+	idx[""] = ngs[0]
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		idx[n.Group].Nodes = append(idx[n.Group].Nodes, n)
+	}
+	return ngs
+}
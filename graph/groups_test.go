@@ -0,0 +1,36 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "testing"
+
+func TestValidColor(t *testing.T) {
+	tests := map[string]bool{
+		DefaultGroupColor: true,
+		"#A0b1C2":         true,
+		"lavender":        true,
+		"":                false,
+		"#abc":            false,
+		"#abcdefg":        false,
+		"Lavender":        false,
+		"nosuchcolour":    false,
+		`red" label="x`:   false,
+	}
+	for c, want := range tests {
+		if got := ValidColor(c); got != want {
+			t.Errorf("ValidColor(%q) = %v, want %v", c, got, want)
+		}
+	}
+}
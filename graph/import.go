@@ -0,0 +1,485 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"encoding/xml"
+	"fmt"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+// ImportFormats maps file extensions to importers of other graph formats.
+var ImportFormats = map[string]func(io.Reader) (*Graph, error){
+	".dot":     ImportDOT,
+	".gv":      ImportDOT,
+	".graphml": ImportGraphML,
+}
+
+// ImportFile imports a graph in one of the ImportFormats, based on the file
+// extension. The imported graph is saved beside the file, with the extension
+// changed to ".szgo".
+func ImportFile(path string) (*Graph, error) {
+	ext := filepath.Ext(path)
+	imp, ok := ImportFormats[strings.ToLower(ext)]
+	if !ok {
+		return nil, fmt.Errorf("cannot import %q files", ext)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g, err := imp(f)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	if g.Name == "" {
+		g.Name = base
+	}
+	g.PackagePath = "example.com/" + packageNameRE.ReplaceAllString(strings.ToLower(base), "")
+	g.SourcePath = strings.TrimSuffix(path, ext) + ".szgo"
+	return g, nil
+}
+
+var packageNameRE = regexp.MustCompile(`[^a-z0-9_]`)
+
+// skeleton is a graph of names, read from another format, which is turned into
+// a graph of goroutines with placeholder code.
+type skeleton struct {
+	name   string
+	nodes  []string
+	docs   map[string]string
+	groups map[string]string
+	edges  [][3]string // From, to, and label.
+}
+
+func (s *skeleton) addNode(n string) {
+	if s.docs == nil {
+		s.docs, s.groups = make(map[string]string), make(map[string]string)
+	}
+	if _, found := s.docs[n]; !found {
+		s.nodes = append(s.nodes, n)
+		s.docs[n] = ""
+	}
+}
+
+// build makes the graph. Every node gets an empty Code part, and each edge is
+// turned into a channel with Connect, which adds code using it. Edge labels
+// which are valid identifiers are used to name the channels.
+func (s *skeleton) build() (*Graph, error) {
+	g := &Graph{
+		Name:     s.name,
+		Nodes:    make(map[string]*Node),
+		Channels: make(map[string]*Channel),
+	}
+	for _, n := range s.nodes {
+		g.Nodes[n] = &Node{
+			Name:         n,
+			Part:         new(parts.Code),
+			Multiplicity: 1,
+			Wait:         true,
+			Doc:          s.docs[n],
+			Group:        s.groups[n],
+		}
+	}
+	for _, e := range s.edges {
+		c, err := g.Connect(e[0], e[1])
+		if err != nil {
+			return nil, err
+		}
+		if l := e[2]; token.IsIdentifier(l) && !g.nameTaken(l) {
+			if err := g.RenameChannel(c.Name, l); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return g, nil
+}
+
+// ImportDOT reads a graph in (a reasonable subset of) the Graphviz DOT
+// language. Nodes in clusters are put in groups named after the cluster.
+func ImportDOT(r io.Reader) (*Graph, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &dotParser{toks: dotTokens(string(src))}
+	s, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("dot: %v", err)
+	}
+	return s.build()
+}
+
+// dotToken is a token of DOT source. Quoted IDs are unquoted and marked as
+// such, so they are never mistaken for keywords or punctuation.
+type dotToken struct {
+	text   string
+	quoted bool
+}
+
+// dotTokens splits DOT source into tokens, skipping comments.
+func dotTokens(src string) []dotToken {
+	var toks []dotToken
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		c := rs[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '#' || (c == '/' && i+1 < len(rs) && rs[i+1] == '/'):
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			i += 2
+			for i+1 < len(rs) && !(rs[i] == '*' && rs[i+1] == '/') {
+				i++
+			}
+			i += 2
+		case c == '"':
+			var b strings.Builder
+			for i++; i < len(rs) && rs[i] != '"'; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					switch rs[i+1] {
+					case '"':
+						i++
+					case '\n':
+						i++
+						continue
+					}
+				}
+				b.WriteRune(rs[i])
+			}
+			i++
+			toks = append(toks, dotToken{text: b.String(), quoted: true})
+		case c == '<':
+			// HTML-like label; keep the text between the outer brackets.
+			depth, j := 0, i
+			for ; j < len(rs); j++ {
+				if rs[j] == '<' {
+					depth++
+				} else if rs[j] == '>' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			toks = append(toks, dotToken{text: string(rs[i+1 : j]), quoted: true})
+			i = j + 1
+		case c == '-' && i+1 < len(rs) && (rs[i+1] == '>' || rs[i+1] == '-'):
+			toks = append(toks, dotToken{text: string(rs[i : i+2])})
+			i += 2
+		case strings.ContainsRune("{}[];,=:", c):
+			toks = append(toks, dotToken{text: string(c)})
+			i++
+		default:
+			j := i
+			if c == '-' { // Negative numeral.
+				j++
+			}
+			for j < len(rs) && (rs[j] == '_' || rs[j] == '.' || unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j])) {
+				j++
+			}
+			if j == i {
+				j++ // Skip anything unexpected.
+			}
+			toks = append(toks, dotToken{text: string(rs[i:j])})
+			i = j
+		}
+	}
+	return toks
+}
+
+type dotParser struct {
+	toks []dotToken
+	pos  int
+	s    skeleton
+}
+
+func (p *dotParser) peek() dotToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return dotToken{}
+}
+
+// is reports whether the next token is the given keyword or punctuation.
+func (p *dotParser) is(text string) bool {
+	t := p.peek()
+	return !t.quoted && strings.EqualFold(t.text, text)
+}
+
+func (p *dotParser) next() dotToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *dotParser) expect(text string) error {
+	if !p.is(text) {
+		return fmt.Errorf("expected %q, got %q", text, p.peek().text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *dotParser) parse() (*skeleton, error) {
+	if p.is("strict") {
+		p.next()
+	}
+	if !p.is("digraph") && !p.is("graph") {
+		return nil, fmt.Errorf("expected graph or digraph, got %q", p.peek().text)
+	}
+	p.next()
+	if !p.is("{") {
+		p.s.name = p.next().text
+	}
+	if _, err := p.block(""); err != nil {
+		return nil, err
+	}
+	return &p.s, nil
+}
+
+// block parses a brace-enclosed list of statements, and returns the nodes
+// mentioned in it (for edges to and from subgraphs).
+func (p *dotParser) block(group string) ([]string, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for !p.is("}") {
+		if p.pos >= len(p.toks) {
+			return nil, fmt.Errorf("unexpected end of input")
+		}
+		if p.is(";") || p.is(",") {
+			p.next()
+			continue
+		}
+		if p.is("graph") || p.is("node") || p.is("edge") {
+			p.next()
+			if _, err := p.attrs(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if t := p.toks; p.pos+1 < len(t) && !t[p.pos+1].quoted && t[p.pos+1].text == "=" {
+			// Graph attribute, e.g. label="x".
+			p.pos += 3
+			continue
+		}
+		ns, err := p.edgeStmt(group)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, ns...)
+	}
+	p.next()
+	return nodes, nil
+}
+
+// operand parses a node ID (with optional port) or a subgraph.
+func (p *dotParser) operand(group string) ([]string, error) {
+	if p.is("subgraph") || p.is("{") {
+		if p.is("subgraph") {
+			p.next()
+			if !p.is("{") {
+				if name := p.next().text; strings.HasPrefix(name, "cluster") {
+					group = strings.TrimLeft(strings.TrimPrefix(name, "cluster"), "_")
+					if group == "" {
+						group = name
+					}
+				}
+			}
+		}
+		return p.block(group)
+	}
+	t := p.next()
+	if t.text == "" && !t.quoted {
+		return nil, fmt.Errorf("unexpected end of input")
+	}
+	if !t.quoted && strings.ContainsAny(t.text, "{}[];,=:") {
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	for p.is(":") { // Ports.
+		p.next()
+		p.next()
+	}
+	p.s.addNode(t.text)
+	if group != "" {
+		p.s.groups[t.text] = group
+	}
+	return []string{t.text}, nil
+}
+
+// edgeStmt parses a node statement, subgraph, or chain of edges.
+func (p *dotParser) edgeStmt(group string) ([]string, error) {
+	from, err := p.operand(group)
+	if err != nil {
+		return nil, err
+	}
+	all := from
+	var edges [][2]string
+	for p.is("->") || p.is("--") {
+		p.next()
+		to, err := p.operand(group)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range from {
+			for _, t := range to {
+				edges = append(edges, [2]string{f, t})
+			}
+		}
+		all, from = append(all, to...), to
+	}
+	attrs, err := p.attrs()
+	if err != nil {
+		return nil, err
+	}
+	if len(edges) == 0 && len(all) == 1 {
+		if l := attrs["label"]; l != "" && l != all[0] && l != `\N` {
+			p.s.docs[all[0]] = l
+		}
+	}
+	for _, e := range edges {
+		p.s.edges = append(p.s.edges, [3]string{e[0], e[1], attrs["label"]})
+	}
+	return all, nil
+}
+
+// attrs parses any attribute lists.
+func (p *dotParser) attrs() (map[string]string, error) {
+	as := make(map[string]string)
+	for p.is("[") {
+		p.next()
+		for !p.is("]") {
+			if p.pos >= len(p.toks) {
+				return nil, fmt.Errorf("unexpected end of input in attributes")
+			}
+			if p.is(",") || p.is(";") {
+				p.next()
+				continue
+			}
+			k := p.next().text
+			if p.is("=") {
+				p.next()
+				as[k] = p.next().text
+			}
+		}
+		p.next()
+	}
+	return as, nil
+}
+
+// graphML is enough of the GraphML format to read nodes and edges.
+type graphML struct {
+	Keys []struct {
+		ID   string `xml:"id,attr"`
+		For  string `xml:"for,attr"`
+		Name string `xml:"attr.name,attr"`
+	} `xml:"key"`
+	Graphs []graphMLGraph `xml:"graph"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLGraph struct {
+	ID    string `xml:"id,attr"`
+	Nodes []struct {
+		ID     string         `xml:"id,attr"`
+		Data   []graphMLData  `xml:"data"`
+		Graphs []graphMLGraph `xml:"graph"`
+	} `xml:"node"`
+	Edges []struct {
+		Source string        `xml:"source,attr"`
+		Target string        `xml:"target,attr"`
+		Data   []graphMLData `xml:"data"`
+	} `xml:"edge"`
+}
+
+// ImportGraphML reads a graph in the GraphML format. Node data with a key
+// named "label" or "name" is used to name the nodes (instead of their IDs),
+// and edge labels name the channels. Nested graphs are flattened.
+func ImportGraphML(r io.Reader) (*Graph, error) {
+	var doc graphML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("graphml: %v", err)
+	}
+	if len(doc.Graphs) == 0 {
+		return nil, fmt.Errorf("graphml: no graph found")
+	}
+	labelKeys := make(map[string]bool)
+	for _, k := range doc.Keys {
+		switch strings.ToLower(k.Name) {
+		case "label", "name":
+			labelKeys[k.ID] = true
+		}
+	}
+	label := func(ds []graphMLData) string {
+		for _, d := range ds {
+			if labelKeys[d.Key] {
+				return strings.TrimSpace(d.Value)
+			}
+		}
+		return ""
+	}
+
+	s := &skeleton{name: doc.Graphs[0].ID}
+	names := make(map[string]string) // IDs to node names.
+	name := func(id string) string {
+		if n, found := names[id]; found {
+			return n
+		}
+		names[id] = id
+		s.addNode(id)
+		return id
+	}
+	var walk func(g *graphMLGraph)
+	walk = func(g *graphMLGraph) {
+		for i := range g.Nodes {
+			n := &g.Nodes[i]
+			nn := label(n.Data)
+			if _, taken := s.docs[nn]; nn == "" || taken {
+				nn = n.ID
+			}
+			names[n.ID] = nn
+			s.addNode(nn)
+			for j := range n.Graphs {
+				walk(&n.Graphs[j])
+			}
+		}
+		for _, e := range g.Edges {
+			s.edges = append(s.edges, [3]string{name(e.Source), name(e.Target), label(e.Data)})
+		}
+	}
+	for i := range doc.Graphs {
+		walk(&doc.Graphs[i])
+	}
+	return s.build()
+}
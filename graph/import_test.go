@@ -0,0 +1,85 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportDOT(t *testing.T) {
+	const src = `digraph pipeline {
+		// A comment.
+		rankdir=LR;
+		node [shape=box];
+		subgraph cluster_front {
+			label="Front";
+			gen [label="Generates numbers"];
+		}
+		gen -> "square it" [label=nums];
+		"square it" -> sink -> log;
+	}`
+	g, err := ImportDOT(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ImportDOT = %v", err)
+	}
+	if g.Name != "pipeline" {
+		t.Errorf("Name = %q, want pipeline", g.Name)
+	}
+	for _, n := range []string{"gen", "square it", "sink", "log"} {
+		if g.Nodes[n] == nil {
+			t.Errorf("node %q missing", n)
+		}
+	}
+	if got := g.Nodes["gen"]; got != nil && (got.Doc != "Generates numbers" || got.Group != "front") {
+		t.Errorf("gen: Doc, Group = %q, %q, want %q, %q", got.Doc, got.Group, "Generates numbers", "front")
+	}
+	if len(g.Channels) != 3 {
+		t.Errorf("got %d channels, want 3", len(g.Channels))
+	}
+	if w := g.Writers("nums"); len(w) != 1 || w[0].Name != "gen" {
+		t.Errorf("Writers(nums) = %v, want [gen]", w)
+	}
+	if r := g.Readers("nums"); len(r) != 1 || r[0].Name != "square it" {
+		t.Errorf("Readers(nums) = %v, want [square it]", r)
+	}
+}
+
+func TestImportGraphML(t *testing.T) {
+	const src = `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+	<key id="d0" for="node" attr.name="label" attr.type="string"/>
+	<graph id="G" edgedefault="directed">
+		<node id="n0"><data key="d0">source</data></node>
+		<node id="n1"><data key="d0">sink</data></node>
+		<edge source="n0" target="n1"/>
+	</graph>
+</graphml>`
+	g, err := ImportGraphML(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ImportGraphML = %v", err)
+	}
+	if g.Nodes["source"] == nil || g.Nodes["sink"] == nil {
+		t.Fatalf("nodes = %v, want source and sink", g.Nodes)
+	}
+	if len(g.Channels) != 1 {
+		t.Fatalf("got %d channels, want 1", len(g.Channels))
+	}
+	for c := range g.Channels {
+		if r := g.Readers(c); len(r) != 1 || r[0].Name != "sink" {
+			t.Errorf("Readers(%s) = %v, want [sink]", c, r)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Inline replaces the Subgraph node called name with the contents of its
+// inner graph: the inverse of Extract. Inner channels bound to outer channels
+// become those channels, and the rest are added, renamed if their names are
+// taken (as are nodes). The inner graph's parameters become parameters of g,
+// with the node's arguments as defaults. It returns the names the inner
+// nodes and channels were given, keyed by their names in the inner graph.
+func (g *Graph) Inline(name string) (nodes, channels map[string]string, err error) {
+	n, found := g.Nodes[name]
+	if !found {
+		return nil, nil, fmt.Errorf("no node %q", name)
+	}
+	s, ok := n.Part.(*Subgraph)
+	if !ok {
+		return nil, nil, fmt.Errorf("node %q is not a subgraph", name)
+	}
+	if s.inner == nil {
+		return nil, nil, fmt.Errorf("subgraph %s isn't loaded: %v", s.Path, s.loadErr)
+	}
+	if n.Multiplicity > 1 {
+		// Each instance would have its own internal channels.
+		return nil, nil, fmt.Errorf("node %q has multiplicity %d; only a single instance can be inlined", name, n.Multiplicity)
+	}
+	if n.Disabled {
+		return nil, nil, fmt.Errorf("node %q is disabled", name)
+	}
+	inner := s.inner
+
+	var params []*Param
+	for _, p := range inner.Params {
+		v := p.Default
+		if a := s.Args[p.Name]; a != "" {
+			v = a
+		}
+		q := *p
+		q.Default = v
+		dup := false
+		for _, o := range g.Params {
+			if o.Name != p.Name {
+				continue
+			}
+			if *o != q {
+				return nil, nil, fmt.Errorf("parameter %s is already a parameter of this graph, with a different value", p.Name)
+			}
+			dup = true
+		}
+		if !dup {
+			params = append(params, &q)
+		}
+	}
+
+	f, err := inner.Fragment(inner.nodeNames(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Choose the new names of the channels: bound channels are replaced by
+	// the outer channels, and the rest are renamed as needed.
+	channels = make(map[string]string, len(f.Channels))
+	taken := func(c string) bool {
+		if g.nameTaken(c) {
+			return true
+		}
+		for _, to := range channels {
+			if to == c {
+				return true
+			}
+		}
+		return false
+	}
+	cns := make([]string, 0, len(f.Channels))
+	for cn := range f.Channels {
+		cns = append(cns, cn)
+	}
+	sort.Strings(cns)
+	for _, cn := range cns {
+		if outer := s.Bindings[cn]; outer != "" {
+			channels[cn] = outer
+		}
+	}
+	for _, cn := range cns {
+		if _, bound := channels[cn]; bound {
+			continue
+		}
+		to := cn
+		for i := 2; taken(to); i++ {
+			to = fmt.Sprintf("%s%d", cn, i)
+		}
+		channels[cn] = to
+	}
+
+	// Rename in two steps, through names no code uses, so that channels can
+	// swap names.
+	tmp := func(i int) string { return fmt.Sprintf("inlining_channel_%d", i) }
+	for nn, m := range f.Nodes {
+		for i, cn := range cns {
+			if err := m.RenameChannel(cn, tmp(i)); err != nil {
+				return nil, nil, fmt.Errorf("node %q: %v", nn, err)
+			}
+		}
+		for i, cn := range cns {
+			if err := m.RenameChannel(tmp(i), channels[cn]); err != nil {
+				return nil, nil, fmt.Errorf("node %q: %v", nn, err)
+			}
+		}
+		m.Pos = nil
+		if m.Group == "" {
+			m.Group = n.Group
+		}
+	}
+	pasted := make(map[string]*Channel)
+	for _, cn := range cns {
+		if s.Bindings[cn] != "" {
+			continue
+		}
+		c := *f.Channels[cn]
+		c.Name, c.Boundary = channels[cn], ""
+		pasted[c.Name] = &c
+	}
+	f.Channels = pasted
+
+	// The node makes way for the nodes replacing it.
+	delete(g.Nodes, name)
+	nodes, _, err = g.Paste(f)
+	if err != nil {
+		g.Nodes[name] = n
+		return nil, nil, err
+	}
+	g.Params = append(g.Params, params...)
+	if d := strings.TrimSpace(inner.Declarations); d != "" && !strings.Contains(g.Declarations, d) {
+		if g.Declarations != "" {
+			g.Declarations += "\n\n"
+		}
+		g.Declarations += d
+	}
+	g.ReattachComments(name, "")
+	return nodes, channels, nil
+}
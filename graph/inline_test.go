@@ -0,0 +1,122 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInline(t *testing.T) {
+	dir := t.TempDir()
+	inner := testGraph(t, map[string]int{"in": 0, "mid": 0, "out": 0}, map[string]string{
+		"first":  "for x := range in { mid <- x * N }; close(mid)",
+		"second": "for x := range mid { out <- x }; close(out)",
+	})
+	inner.Params = []*Param{{Name: "N", Kind: "const", Default: "1"}}
+	var buf bytes.Buffer
+	if err := inner.WriteJSONTo(&buf); err != nil {
+		t.Fatalf("WriteJSONTo() = %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "inner.szgo"), buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	g := testGraph(t, map[string]int{"a": 0, "b": 0, "mid": 0}, map[string]string{
+		"gen":   "a <- 1; close(a); mid <- 1; close(mid)",
+		"first": "for range b {}; for range mid {}",
+	})
+	g.SourcePath = filepath.Join(dir, "outer.szgo")
+	g.Nodes["sub"] = &Node{
+		Name:         "sub",
+		Multiplicity: 1,
+		Group:        "g1",
+		Part: &Subgraph{
+			Path:     "inner.szgo",
+			Bindings: map[string]string{"in": "a", "out": "b"},
+			Args:     map[string]string{"N": "3"},
+		},
+	}
+	g.LoadSubgraphs()
+
+	nodes, channels, err := g.Inline("sub")
+	if err != nil {
+		t.Fatalf("Inline(sub) = %v", err)
+	}
+	if want := map[string]string{"first": "first 2", "second": "second"}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("Inline nodes = %v, want %v", nodes, want)
+	}
+	if want := map[string]string{"in": "a", "mid": "mid2", "out": "b"}; !reflect.DeepEqual(channels, want) {
+		t.Errorf("Inline channels = %v, want %v", channels, want)
+	}
+	if _, found := g.Nodes["sub"]; found {
+		t.Error("sub still in graph after Inline")
+	}
+	if _, found := g.Channels["mid2"]; !found {
+		t.Error("channel mid2 not in graph after Inline")
+	}
+	if _, found := g.Channels["in"]; found {
+		t.Error("bound channel in was added to the graph")
+	}
+	first := g.Nodes["first 2"]
+	if impl := first.Impl(); !strings.Contains(impl, "range a") || !strings.Contains(impl, "mid2 <-") {
+		t.Errorf("first 2 code = %q, want it to use a and mid2", impl)
+	}
+	if first.Group != "g1" {
+		t.Errorf("first 2 group = %q, want g1", first.Group)
+	}
+	if want := []*Param{{Name: "N", Kind: "const", Default: "3"}}; !reflect.DeepEqual(g.Params, want) {
+		t.Errorf("Params after Inline = %v, want %v", g.Params, want)
+	}
+	buf.Reset()
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Errorf("WriteGoTo after Inline = %v", err)
+	}
+
+	if _, _, err := g.Inline("gen"); err == nil {
+		t.Error("Inline(gen) succeeded, but it isn't a subgraph")
+	}
+}
+
+func TestExtractThenInline(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0, "c": 0}, map[string]string{
+		"gen":    "a <- 1; close(a)",
+		"relay":  "for x := range a { b <- x }; close(b)",
+		"filter": "for x := range b { if x > 0 { c <- x } }; close(c)",
+		"sink":   "for range c {}",
+	})
+	g.SourcePath = filepath.Join(t.TempDir(), "outer.szgo")
+	var before bytes.Buffer
+	if err := g.WriteGoTo(&before); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	if _, err := g.Extract([]string{"relay", "filter"}, "middle.szgo", ""); err != nil {
+		t.Fatalf("Extract = %v", err)
+	}
+	if _, _, err := g.Inline("middle"); err != nil {
+		t.Fatalf("Inline = %v", err)
+	}
+	var after bytes.Buffer
+	if err := g.WriteGoTo(&after); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	if before.String() != after.String() {
+		t.Errorf("after Extract and Inline, code = \n%s\nwant\n%s", after.String(), before.String())
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// Journaled reports whether values sent to the channel are journaled.
+func (c *Channel) Journaled() bool { return c.Journal != "" }
+
+// CheckJournalPath type-checks the channel's journal expression, which must
+// be a string.
+func (g *Graph) CheckJournalPath(c *Channel) error {
+	t, err := source.OrderedType(c.Journal, g.AllImports(), g.constDecls(), nil)
+	if err != nil {
+		return err
+	}
+	if t != "string" {
+		return fmt.Errorf("%s has type %s, not string", c.Journal, t)
+	}
+	return nil
+}
+
+// journalImports returns the packages the generated journals use.
+func (g *Graph) journalImports() []string {
+	for _, c := range g.Channels {
+		if c.Journaled() {
+			return []string{"encoding/json", "fmt", "os"}
+		}
+	}
+	return nil
+}
+
+// journalShim returns Go starting the goroutine which holds the values sent
+// to c until they are received from cQueue, journaling them to a file. On
+// starting, values in the journal that weren't received are sent first.
+func (g *Graph) journalShim(c *Channel) string {
+	full := ""
+	if c.Overflow != OverflowExpand {
+		full = fmt.Sprintf("\n\t\tif len(buf) >= %s {\n\t\t\trecv = nil\n\t\t}", c.CapSource())
+	}
+	return fmt.Sprintf(`// Hold values sent to %[1]s until they are received, journaling them to
+// %[3]s so they survive a restart.
+%[1]sQueue := make(chan %[2]s)
+go func() {
+	defer close(%[1]sQueue)
+	in := %[1]s
+	type entry struct {
+		Seq  int  `+"`json:\"seq\"`"+`
+		Ack  bool `+"`json:\"ack,omitempty\"`"+`
+		Item %[2]s `+"`json:\"item\"`"+`
+	}
+	path := %[3]s
+	var buf []entry
+	seq := 0
+	if f, err := os.Open(path); err == nil {
+		// Replay the journal: values sent but not received go first.
+		var sent []entry
+		acked := make(map[int]bool)
+		for dec := json.NewDecoder(f); ; {
+			var e entry
+			if dec.Decode(&e) != nil {
+				// The end, or a write cut short.
+				break
+			}
+			if e.Ack {
+				acked[e.Seq] = true
+			} else {
+				sent = append(sent, e)
+			}
+			if e.Seq >= seq {
+				seq = e.Seq + 1
+			}
+		}
+		f.Close()
+		for _, e := range sent {
+			if !acked[e.Seq] {
+				buf = append(buf, e)
+			}
+		}
+	}
+	// Rewrite the journal with only those values, then append to it.
+	var enc *json.Encoder
+	j, err := os.Create(path + ".tmp")
+	if err == nil {
+		enc = json.NewEncoder(j)
+		for _, e := range buf {
+			if err = enc.Encode(e); err != nil {
+				break
+			}
+		}
+		if cerr := j.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err == nil {
+		j, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "journal %%s: %%v; values sent to %[1]s won't survive a restart\n", path, err)
+		j = nil
+	} else {
+		defer j.Close()
+		enc = json.NewEncoder(j)
+	}
+	write := func(e entry) {
+		if j == nil {
+			return
+		}
+		err := enc.Encode(e)
+		if err == nil {
+			err = j.Sync()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "journal %%s: %%v\n", path, err)
+		}
+	}
+	for in != nil || len(buf) > 0 {
+		recv := in%[4]s
+		var out chan %[2]s
+		var next %[2]s
+		if len(buf) > 0 {
+			out, next = %[1]sQueue, buf[0].Item
+		}
+		select {
+		case x, ok := <-recv:
+			if !ok {
+				in = nil
+				continue
+			}
+			e := entry{Seq: seq, Item: x}
+			seq++
+			write(e)
+			buf = append(buf, e)
+		case out <- next:
+			write(entry{Seq: buf[0].Seq, Ack: true})
+			buf = buf[1:]
+		}
+	}
+}()`, c.Name, c.Type, c.Journal, full)
+}
+
+// checkJournals reports journals that can't work.
+func checkJournals(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	paths := make(map[string]string)
+	for _, cn := range g.channelNames() {
+		c := g.Channels[cn]
+		if !c.Journaled() {
+			continue
+		}
+		bad := func(msg string) {
+			ds = append(ds, Diagnostic{Severity: Error, Channel: cn, Msg: msg})
+		}
+		if err := g.CheckJournalPath(c); err != nil {
+			bad(fmt.Sprintf("journal: %v", err))
+		}
+		if o, found := paths[c.Journal]; found {
+			bad(fmt.Sprintf("shares the journal %s with %s", c.Journal, o))
+		}
+		paths[c.Journal] = cn
+		switch c.Overflow {
+		case OverflowBlock:
+			if c.Cap < 1 {
+				bad("a journaled channel needs a capacity of at least 1, or to grow without limit")
+			}
+		case OverflowDropNewest, OverflowDropOldest:
+			bad("a journaled channel can make senders wait or grow without limit when full, but can't drop values")
+		}
+		if c.Priority != "" {
+			bad("a journaled channel can't have a priority")
+		}
+		if c.Boundary == Output {
+			bad("outputs are received from outside the graph, so they can't be journaled")
+		}
+		if c.Overflows() {
+			// checkOverflows warns about these.
+			continue
+		}
+		for _, n := range g.selfReaders(cn) {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Node:     n.Name,
+				Channel:  cn,
+				Msg:      "both sends to and receives from a journaled channel, so values it sends to itself may be received without being journaled",
+			})
+		}
+	}
+	return ds
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 4}, map[string]string{
+		"gen":  "for i := 0; i < 10; i++ { a <- i }; close(a)",
+		"mid":  "for x := range a { b <- x }; close(b)",
+		"sink": "for range b {}",
+	})
+	g.Channels["a"].Journal = `"a.journal"`
+	g.Channels["b"].Journal = `"a.journal"`
+
+	ds := checkJournals(g)
+	if len(ds) != 2 || ds[0].Channel != "a" || ds[1].Channel != "b" {
+		t.Errorf("checkJournals = %v, want errors for a, which has no capacity, and b, which shares a's journal", ds)
+	}
+	g.Channels["a"].Overflow = OverflowExpand
+	g.Channels["b"].Journal = "42"
+	ds = checkJournals(g)
+	if len(ds) != 1 || ds[0].Channel != "b" {
+		t.Errorf("checkJournals = %v, want an error for b, whose journal isn't a string", ds)
+	}
+	g.Channels["b"].Journal = `"b.journal"`
+	if ds := checkJournals(g); len(ds) != 0 {
+		t.Errorf("checkJournals = %v, want none", ds)
+	}
+	if got, want := g.ChannelSummary("a"), "a (chan int, unbounded, journaled)"; got != want {
+		t.Errorf("ChannelSummary(a) = %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	code := buf.String()
+	for _, want := range []string{
+		`"encoding/json"`,
+		`path := "a.journal"`,
+		`path := "b.journal"`,
+		"if len(buf) >= 4 {",
+		"a := aQueue",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code doesn't contain %q:\n%s", want, code)
+		}
+	}
+}
@@ -0,0 +1,507 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The built-in layout is a simple layered ("Sugiyama-style") layout, used to
+// draw the graph when Graphviz isn't available. It is nowhere near as good as
+// dot, but it's better than nothing.
+
+const (
+	layoutMargin    = 20.0
+	layoutLayerGap  = 70.0
+	layoutVertexGap = 30.0
+	layoutBoxHeight = 36.0
+	layoutCharWidth = 7.5
+)
+
+// vertex is something drawn in the built-in layout: a node, a channel, or a
+// comment.
+type vertex struct {
+	id, label, url, tip string
+	kind                byte // 'n'ode, 'c'hannel, or co'm'ment.
+	node                *Node
+	width, height       float64
+	layer               int
+	x, y                float64 // Centre.
+
+	// For nodes whose parts ask for them, ports maps "i:" or "o:" and a
+	// channel name to where edges for the channel meet the node, relative to
+	// the centre.
+	ports map[string]float64
+	badge string
+}
+
+// layoutEdge joins two vertices.
+type layoutEdge struct {
+	from, to *vertex
+	port     string // Key into the ports of the node end, if it has them.
+	url, tip string
+	label    string
+	closes   bool
+	dashed   bool
+}
+
+type layout struct {
+	verts  []*vertex
+	byID   map[string]*vertex
+	edges  []*layoutEdge
+	layers [][]*vertex
+	minX   float64
+	minY   float64
+	width  float64
+	height float64
+}
+
+func (l *layout) add(v *vertex) {
+	l.verts = append(l.verts, v)
+	l.byID[v.id] = v
+}
+
+// textWidth estimates the width of some text in the diagram.
+func textWidth(s string) float64 {
+	return float64(utf8.RuneCountInString(s)) * layoutCharWidth
+}
+
+// newLayout collects the vertices and edges to draw, the same as in the dot
+// view of the graph.
+func (g *Graph) newLayout() *layout {
+	l := &layout{byID: make(map[string]*vertex)}
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		tip := n.Doc
+		if tip == "" && n.Disabled {
+			tip = "disabled"
+		}
+		r := n.Rendering()
+		v := &vertex{
+			id:     "n:" + nn,
+			label:  strings.Join(append([]string{n.Label()}, r.Lines...), "\n"),
+			url:    "?node=" + url.QueryEscape(nn),
+			tip:    tip,
+			kind:   'n',
+			node:   n,
+			height: layoutBoxHeight + 14*float64(len(r.Lines)),
+			badge:  r.Badge,
+		}
+		for _, ln := range strings.Split(v.label, "\n") {
+			v.width = math.Max(v.width, textWidth(ln)+24)
+		}
+		v.width = math.Max(60, v.width)
+		if r.Ports {
+			v.ports = make(map[string]float64)
+			sides := map[string][]string{
+				"i": g.DeclaredChannels(n.ChannelsRead()),
+				"o": g.DeclaredChannels(n.ChannelsWritten()),
+			}
+			for _, cs := range sides {
+				pw := 0.0
+				for _, c := range cs {
+					pw += textWidth(c) + 12
+				}
+				v.width = math.Max(v.width, pw)
+				if len(cs) > 0 {
+					v.height += 14
+				}
+			}
+			// Spread each side's ports evenly across the width.
+			for dir, cs := range sides {
+				for i, c := range cs {
+					v.ports[dir+":"+c] = (float64(i) + 0.5 - float64(len(cs))/2) * v.width / float64(len(cs))
+				}
+			}
+		}
+		l.add(v)
+	}
+	for _, c := range g.channelNames() {
+		l.add(&vertex{
+			id:     "c:" + c,
+			label:  c,
+			url:    "?channel=" + url.QueryEscape(c),
+			tip:    g.ChannelSummary(c),
+			kind:   'c',
+			width:  2 * (textWidth(c) + 10),
+			height: 10,
+		})
+	}
+	cs := make([]string, 0, len(g.Comments))
+	for c := range g.Comments {
+		cs = append(cs, c)
+	}
+	sort.Strings(cs)
+	for _, c := range cs {
+		cm := g.Comments[c]
+		w := 0.0
+		lines := strings.Split(cm.Text, "\n")
+		for _, ln := range lines {
+			w = math.Max(w, textWidth(ln))
+		}
+		l.add(&vertex{
+			id:     "m:" + c,
+			label:  cm.Text,
+			url:    "?comment=" + url.QueryEscape(c),
+			kind:   'm',
+			width:  w + 20,
+			height: float64(len(lines))*14 + 12,
+		})
+		if to := l.byID["n:"+cm.Node]; to != nil {
+			l.edges = append(l.edges, &layoutEdge{from: l.byID["m:"+c], to: to, url: "?comment=" + url.QueryEscape(c), dashed: true})
+		}
+	}
+	labels := g.EdgeLabels()
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		nv := l.byID["n:"+nn]
+		for _, c := range g.DeclaredChannels(n.ChannelsRead()) {
+			e := &layoutEdge{from: l.byID["c:"+c], to: nv, port: "i:" + c, url: "?channel=" + url.QueryEscape(c), tip: g.ChannelSummary(c), dashed: n.Disabled}
+			if lb := labels[c]; lb.OnReaders {
+				e.label = lb.Text
+			}
+			l.edges = append(l.edges, e)
+		}
+		for _, c := range g.DeclaredChannels(n.ChannelsWritten()) {
+			e := &layoutEdge{from: nv, to: l.byID["c:"+c], port: "o:" + c, url: "?channel=" + url.QueryEscape(c), tip: g.ChannelSummary(c), dashed: n.Disabled}
+			if lb := labels[c]; !lb.OnReaders {
+				e.label = lb.Text
+			}
+			if n.Closes(c) {
+				e.closes = true
+				e.tip += ", closed by " + nn
+			}
+			l.edges = append(l.edges, e)
+		}
+	}
+	return l
+}
+
+// assignLayers puts each vertex in a layer so that edges point downwards,
+// except for edges ignored to break cycles.
+func (l *layout) assignLayers() {
+	out := make(map[*vertex][]*vertex)
+	for _, e := range l.edges {
+		out[e.from] = append(out[e.from], e.to)
+	}
+
+	// Find back edges with a depth-first search, and ignore them.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*vertex]int)
+	forward := make(map[*vertex][]*vertex)
+	var visit func(v *vertex)
+	visit = func(v *vertex) {
+		state[v] = visiting
+		for _, w := range out[v] {
+			switch state[w] {
+			case unvisited:
+				forward[v] = append(forward[v], w)
+				visit(w)
+			case visited:
+				forward[v] = append(forward[v], w)
+			}
+		}
+		state[v] = visited
+	}
+	for _, v := range l.verts {
+		if state[v] == unvisited {
+			visit(v)
+		}
+	}
+
+	// Longest path layering, in topological order.
+	indeg := make(map[*vertex]int)
+	for _, ws := range forward {
+		for _, w := range ws {
+			indeg[w]++
+		}
+	}
+	var queue []*vertex
+	for _, v := range l.verts {
+		if indeg[v] == 0 {
+			queue = append(queue, v)
+		}
+	}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, w := range forward[v] {
+			if v.layer+1 > w.layer {
+				w.layer = v.layer + 1
+			}
+			if indeg[w]--; indeg[w] == 0 {
+				queue = append(queue, w)
+			}
+		}
+	}
+
+	max := 0
+	for _, v := range l.verts {
+		if v.layer > max {
+			max = v.layer
+		}
+	}
+	l.layers = make([][]*vertex, max+1)
+	for _, v := range l.verts {
+		l.layers[v.layer] = append(l.layers[v.layer], v)
+	}
+}
+
+// orderLayers reduces edge crossings by repeatedly sorting each layer by the
+// average position of neighbours in the adjacent layer.
+func (l *layout) orderLayers() {
+	pos := make(map[*vertex]float64)
+	reindex := func(layer []*vertex) {
+		for i, v := range layer {
+			pos[v] = float64(i)
+		}
+	}
+	for _, layer := range l.layers {
+		reindex(layer)
+	}
+	nbrs := func(v *vertex, above bool) []*vertex {
+		var ns []*vertex
+		for _, e := range l.edges {
+			switch {
+			case e.to == v && (e.from.layer < v.layer) == above && e.from.layer != v.layer:
+				ns = append(ns, e.from)
+			case e.from == v && (e.to.layer < v.layer) == above && e.to.layer != v.layer:
+				ns = append(ns, e.to)
+			}
+		}
+		return ns
+	}
+	sweep := func(i int, above bool) {
+		layer := l.layers[i]
+		bary := make(map[*vertex]float64, len(layer))
+		for _, v := range layer {
+			ns := nbrs(v, above)
+			if len(ns) == 0 {
+				bary[v] = pos[v]
+				continue
+			}
+			sum := 0.0
+			for _, n := range ns {
+				sum += pos[n]
+			}
+			bary[v] = sum / float64(len(ns))
+		}
+		sort.SliceStable(layer, func(a, b int) bool { return bary[layer[a]] < bary[layer[b]] })
+		reindex(layer)
+	}
+	for iter := 0; iter < 4; iter++ {
+		for i := 1; i < len(l.layers); i++ {
+			sweep(i, true)
+		}
+		for i := len(l.layers) - 2; i >= 0; i-- {
+			sweep(i, false)
+		}
+	}
+}
+
+// placeVertices assigns coordinates, centring each layer.
+func (l *layout) placeVertices() {
+	widths := make([]float64, len(l.layers))
+	for i, layer := range l.layers {
+		for j, v := range layer {
+			if j > 0 {
+				widths[i] += layoutVertexGap
+			}
+			widths[i] += v.width
+		}
+		l.width = math.Max(l.width, widths[i])
+	}
+	y := layoutMargin
+	for i, layer := range l.layers {
+		h := 0.0
+		for _, v := range layer {
+			h = math.Max(h, v.height)
+		}
+		x := layoutMargin + (l.width-widths[i])/2
+		for _, v := range layer {
+			v.x, v.y = x+v.width/2, y+h/2
+			x += v.width + layoutVertexGap
+		}
+		y += h + layoutLayerGap
+	}
+	l.width += 2 * layoutMargin
+	l.height = y - layoutLayerGap + layoutMargin
+}
+
+// pinVertices moves nodes with a position to it, and then fits the bounds of
+// the diagram around everything. Positions have y increasing upwards (as in
+// Graphviz), whereas the diagram has y increasing downwards.
+func (l *layout) pinVertices() {
+	x0, y0 := math.Inf(1), math.Inf(1)
+	x1, y1 := math.Inf(-1), math.Inf(-1)
+	for _, v := range l.verts {
+		if v.kind == 'n' && v.node.Pos != nil {
+			v.x, v.y = v.node.Pos.X, -v.node.Pos.Y
+		}
+		x0, y0 = math.Min(x0, v.x-v.width/2), math.Min(y0, v.y-v.height/2)
+		x1, y1 = math.Max(x1, v.x+v.width/2), math.Max(y1, v.y+v.height/2)
+	}
+	if len(l.verts) == 0 {
+		return
+	}
+	l.minX, l.minY = x0-layoutMargin, y0-layoutMargin
+	l.width, l.height = x1-x0+2*layoutMargin, y1-y0+2*layoutMargin
+}
+
+// anchor returns where an edge should meet a vertex, heading towards (x, y).
+func (v *vertex) anchor(x, y float64) (float64, float64) {
+	switch v.kind {
+	case 'c':
+		return v.x, v.y
+	default:
+		if y > v.y {
+			return v.x, v.y + v.height/2
+		}
+		return v.x, v.y - v.height/2
+	}
+}
+
+// WriteSVGTo lays out and draws the graph as SVG, without needing Graphviz.
+func (g *Graph) WriteSVGTo(w io.Writer) error {
+	l := g.newLayout()
+	l.assignLayers()
+	l.orderLayers()
+	l.placeVertices()
+	l.pinVertices()
+
+	t := g.Theme()
+	b := bufio.NewWriter(w)
+	esc := html.EscapeString
+	fg := esc(t.Foreground)
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%.0fpt" height="%.0fpt" viewBox="%.0f %.0f %.0f %.0f" font-family="Go, sans-serif" font-size="14" fill="%s">`+"\n",
+		l.width, l.height, l.minX, l.minY, l.width, l.height, fg)
+	fmt.Fprintf(b, `<defs>
+<marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="%s"/></marker>
+<marker id="teearrow" viewBox="0 0 16 10" refX="16" refY="5" markerWidth="12" markerHeight="8" orient="auto"><path d="M6,0 L16,5 L6,10 z" fill="%s"/><path d="M1,0 L1,10" stroke="%s" stroke-width="2"/></marker>
+</defs>
+<rect x="%.0f" y="%.0f" width="%.0f" height="%.0f" fill="%s"/>
+`, fg, fg, fg, l.minX, l.minY, l.width, l.height, esc(t.Background))
+
+	// Groups go underneath everything else.
+	for _, ng := range g.NodeGroups() {
+		if ng.Name == "" {
+			continue
+		}
+		x0, y0, x1, y1 := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+		for _, n := range ng.Nodes {
+			v := l.byID["n:"+n.Name]
+			x0, y0 = math.Min(x0, v.x-v.width/2), math.Min(y0, v.y-v.height/2)
+			x1, y1 = math.Max(x1, v.x+v.width/2), math.Max(y1, v.y+v.height/2)
+		}
+		fill, stroke, text := esc(ng.Color), esc(ng.Color), esc(t.NodeText)
+		if !t.PartColors {
+			fill, stroke, text = "none", fg, fg
+		}
+		fmt.Fprintf(b, `<g class="cluster"><rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" stroke="%s"/><text x="%.1f" y="%.1f" font-size="12" fill="%s">%s</text></g>`+"\n",
+			x0-8, y0-22, x1-x0+16, y1-y0+30, fill, stroke, x0-4, y0-8, text, esc(ng.Name))
+	}
+
+	for _, e := range l.edges {
+		x1, y1 := e.from.anchor(e.to.x, e.to.y)
+		x2, y2 := e.to.anchor(e.from.x, e.from.y)
+		if off, ok := e.from.ports[e.port]; ok {
+			x1 = e.from.x + off
+		}
+		if off, ok := e.to.ports[e.port]; ok {
+			x2 = e.to.x + off
+		}
+		style := fmt.Sprintf(`stroke="%s"`, fg)
+		if e.dashed {
+			style = fmt.Sprintf(`stroke="%s" stroke-dasharray="5,3"`, esc(t.Disabled))
+		}
+		marker := ` marker-end="url(#arrow)"`
+		switch {
+		case e.from.kind == 'm':
+			marker = ""
+		case e.closes:
+			marker = ` marker-end="url(#teearrow)"`
+		}
+		path := fmt.Sprintf("M%.1f,%.1f L%.1f,%.1f", x1, y1, x2, y2)
+		mx, my := (x1+x2)/2, (y1+y2)/2
+		if e.to.layer <= e.from.layer {
+			// Edges going back up curve out to the side, to be visible.
+			cx := math.Max(x1, x2) + 60
+			path = fmt.Sprintf("M%.1f,%.1f Q%.1f,%.1f %.1f,%.1f", x1, y1, cx, my, x2, y2)
+			mx = (x1+x2)/4 + cx/2
+		}
+		fmt.Fprintf(b, `<a xlink:href="%s"><g class="edge"><title>%s</title><path d="%s" fill="none" stroke-width="%g" %s%s/>`,
+			esc(e.url), esc(e.tip), path, 1.5*t.PenWidth, style, marker)
+		if e.label != "" {
+			fmt.Fprintf(b, `<text x="%.1f" y="%.1f" font-family="Go Mono, monospace" font-size="10">%s</text>`, mx+6, my+4, esc(e.label))
+		}
+		b.WriteString("</g></a>\n")
+	}
+
+	for _, v := range l.verts {
+		fmt.Fprintf(b, `<a xlink:href="%s"><g class="%s">`, esc(v.url), map[byte]string{'n': "node", 'c': "channel", 'm': "comment"}[v.kind])
+		if v.tip != "" {
+			fmt.Fprintf(b, `<title>%s</title>`, esc(v.tip))
+		}
+		x, y := v.x-v.width/2, v.y-v.height/2
+		switch v.kind {
+		case 'n':
+			fill, stroke, text, dash := t.Fill(v.node.Style()), t.Foreground, t.NodeText, ""
+			if v.node.Disabled {
+				fill, stroke, text, dash = t.Background, t.Disabled, t.Disabled, ` stroke-dasharray="5,3"`
+			}
+			if v.node.Multiplicity > 1 {
+				fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" stroke="%s" stroke-width="%g"%s/>`, x+4, y-4, v.width, v.height, esc(fill), esc(stroke), t.PenWidth, dash)
+			}
+			fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" stroke="%s" stroke-width="%g"%s/>`, x, y, v.width, v.height, esc(fill), esc(stroke), t.PenWidth, dash)
+			lines := strings.Split(v.label, "\n")
+			for i, ln := range lines {
+				fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="%s">%s</text>`, v.x, v.y+5+14*(float64(i)-float64(len(lines)-1)/2), esc(text), esc(ln))
+			}
+			for k, off := range v.ports {
+				py := y + 12
+				if strings.HasPrefix(k, "o:") {
+					py = y + v.height - 4
+				}
+				fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="middle" font-family="Go Mono, monospace" font-size="10" fill="%s">%s</text>`, v.x+off, py, esc(text), esc(k[2:]))
+			}
+			if v.badge != "" {
+				fmt.Fprintf(b, `<text x="%.1f" y="%.1f" font-size="10">%s</text>`, x+v.width+4, y+10, esc(v.badge))
+			}
+		case 'c':
+			fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="4"/>`, v.x, v.y)
+			fmt.Fprintf(b, `<text x="%.1f" y="%.1f" font-family="Go Mono, monospace" font-size="12">%s</text>`, v.x+8, v.y-6, esc(v.label))
+		case 'm':
+			fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" stroke="%s"/>`, x, y, v.width, v.height, esc(t.CommentFill), fg)
+			for i, ln := range strings.Split(v.label, "\n") {
+				fmt.Fprintf(b, `<text x="%.1f" y="%.1f" font-size="12">%s</text>`, x+10, y+18+float64(i)*14, esc(ln))
+			}
+		}
+		b.WriteString("</g></a>\n")
+	}
+	b.WriteString("</svg>\n")
+	return b.Flush()
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+func TestLayoutLayers(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"gen":    "a <- 1; close(a)",
+		"double": "for x := range a { b <- 2*x }; close(b)",
+		"sink":   "for range b {}",
+	})
+	l := g.newLayout()
+	l.assignLayers()
+	want := map[string]int{"n:gen": 0, "c:a": 1, "n:double": 2, "c:b": 3, "n:sink": 4}
+	for id, layer := range want {
+		if got := l.byID[id].layer; got != layer {
+			t.Errorf("layer of %s = %d, want %d", id, got, layer)
+		}
+	}
+}
+
+func TestLayoutCycle(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 1, "b": 0}, map[string]string{
+		"ping": "a <- 1; for x := range b { a <- x }",
+		"pong": "for x := range a { b <- x }",
+	})
+	var buf bytes.Buffer
+	if err := g.WriteSVGTo(&buf); err != nil {
+		t.Fatalf("WriteSVGTo = %v", err)
+	}
+	d := xml.NewDecoder(&buf)
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("WriteSVGTo wrote invalid XML: %v", err)
+		}
+	}
+}
+
+func TestNodeStyle(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen":  "a <- 1; close(a)",
+		"sink": "for range a {}",
+	})
+	if got, want := g.Nodes["gen"].Style(), sourceStyle; got != want {
+		t.Errorf("gen.Style() = %v, want %v", got, want)
+	}
+	if got, want := g.Nodes["sink"].Style(), sinkStyle; got != want {
+		t.Errorf("sink.Style() = %v, want %v", got, want)
+	}
+	sg := &Node{Name: "inner", Part: &Subgraph{}}
+	if got, want := sg.Label(), "⧉ inner"; got != want {
+		t.Errorf("Subgraph node Label() = %q, want %q", got, want)
+	}
+}
+
+func TestEdgeLabels(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 64, "b": 0}, map[string]string{
+		"gen":  "a <- 1; close(a)",
+		"sink": "for range a {}; for range b {}",
+	})
+	got := g.EdgeLabels()
+	want := map[string]EdgeLabel{
+		"a": {Text: "int, cap 64"},
+		"b": {Text: "int, cap 0", OnReaders: true},
+	}
+	for c, w := range want {
+		if got[c] != w {
+			t.Errorf("EdgeLabels()[%q] = %+v, want %+v", c, got[c], w)
+		}
+	}
+	g.HideEdgeLabels = true
+	if got := g.EdgeLabels(); got != nil {
+		t.Errorf("EdgeLabels() with HideEdgeLabels = %v, want nil", got)
+	}
+}
+
+func TestLayoutPinned(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen":  "a <- 1; close(a)",
+		"sink": "for range a {}",
+	})
+	g.Nodes["sink"].Pos = &Position{X: -300, Y: 200}
+	l := g.newLayout()
+	l.assignLayers()
+	l.orderLayers()
+	l.placeVertices()
+	l.pinVertices()
+	if v := l.byID["n:sink"]; v.x != -300 || v.y != -200 {
+		t.Errorf("sink at (%g, %g), want (-300, -200)", v.x, v.y)
+	}
+	for _, v := range l.verts {
+		if v.x-v.width/2 < l.minX || v.x+v.width/2 > l.minX+l.width || v.y-v.height/2 < l.minY || v.y+v.height/2 > l.minY+l.height {
+			t.Errorf("%s at (%g, %g) is outside the bounds", v.id, v.x, v.y)
+		}
+	}
+}
+
+func TestRenderPorts(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0, "c": 0}, map[string]string{
+		"gen":  "a <- 1; b <- 2; close(a); close(b)",
+		"sink": "for range c {}",
+	})
+	g.Nodes["mux"] = &Node{Name: "mux", Multiplicity: 1, Part: &parts.Multiplexer{Inputs: []string{"a", "b"}, Output: "c"}}
+	if got, want := g.DotLabel(g.Nodes["mux"]), `"{{<i0> a|<i1> b}|⇉\ mux|{<o0> c}}"`; got != want {
+		t.Errorf("DotLabel(mux) = %s, want %s", got, want)
+	}
+	if got, want := g.DotPort(g.Nodes["mux"], "i", "b"), `:"i1"`; got != want {
+		t.Errorf("DotPort(mux, i, b) = %s, want %s", got, want)
+	}
+	if got := g.DotPort(g.Nodes["gen"], "o", "a"); got != "" {
+		t.Errorf("DotPort(gen, o, a) = %s, want empty", got)
+	}
+
+	l := g.newLayout()
+	v := l.byID["n:mux"]
+	if v.ports["i:a"] >= v.ports["i:b"] {
+		t.Errorf("port for a at %g, not left of port for b at %g", v.ports["i:a"], v.ports["i:b"])
+	}
+	if got := v.ports["o:c"]; got != 0 {
+		t.Errorf("port for c at %g, want 0", got)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Default log levels, for Graph.Logging.
+const (
+	LogOff   = ""
+	LogDebug = "debug"
+	LogInfo  = "info"
+	LogWarn  = "warn"
+	LogError = "error"
+)
+
+// LogLevels lists the logging settings, with descriptions.
+var LogLevels = []struct{ Value, Description string }{
+	{LogOff, "No logger"},
+	{LogDebug, "Debug and above"},
+	{LogInfo, "Info and above"},
+	{LogWarn, "Warnings and errors"},
+	{LogError, "Errors only"},
+}
+
+// slogLevels maps the logging settings to the log/slog level constants.
+var slogLevels = map[string]string{
+	LogDebug: "slog.LevelDebug",
+	LogInfo:  "slog.LevelInfo",
+	LogWarn:  "slog.LevelWarn",
+	LogError: "slog.LevelError",
+}
+
+// UsesLogging reports whether the graph or any of its subgraphs has a
+// logger, so the generated package declares one.
+func (g *Graph) UsesLogging() bool { return g.logLevel() != LogOff }
+
+// logLevel returns the default level of the logger: that of the graph, or
+// failing that, of the first subgraph with a logger.
+func (g *Graph) logLevel() string {
+	if g.Logging != LogOff {
+		return g.Logging
+	}
+	for _, nn := range g.nodeNames() {
+		if s, ok := g.Nodes[nn].Part.(*Subgraph); ok && s.inner != nil {
+			if l := s.inner.logLevel(); l != LogOff {
+				return l
+			}
+		}
+	}
+	return LogOff
+}
+
+// LogLevelDefault returns the default value of the generated -log_level flag,
+// as Go source.
+func (g *Graph) LogLevelDefault() string {
+	if l, ok := slogLevels[g.logLevel()]; ok {
+		return l
+	}
+	return "slog.LevelInfo"
+}
+
+// NodeLogs reports whether the code of n refers to the logger, so that the
+// goroutines of n get a logger of their own, saying which node logged.
+func (g *Graph) NodeLogs(n *Node) bool {
+	return g.UsesLogging() && n.refersTo("logger")
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLogging(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen":  `logger.Debug("starting"); a <- 1; close(a)`,
+		"sink": "for range a {}",
+	})
+	g.Nodes["gen"].Multiplicity = 2
+
+	if g.NodeLogs(g.Nodes["gen"]) {
+		t.Error("NodeLogs(gen) = true without a logger")
+	}
+	g.Logging = LogWarn
+	if !g.NodeLogs(g.Nodes["gen"]) || g.NodeLogs(g.Nodes["sink"]) {
+		t.Error("NodeLogs should only be true for gen, which uses the logger")
+	}
+	errs, err := g.TypeCheckNode(g.Nodes["gen"])
+	if err != nil {
+		t.Fatalf("TypeCheckNode(gen) = %v", err)
+	}
+	if len(errs) > 0 {
+		t.Errorf("TypeCheckNode(gen) = %v, want no errors", errs)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	code := buf.String()
+	for _, want := range []string{
+		`"log/slog"`,
+		`flag.TextVar(&logLevel, "log_level", slog.LevelWarn,`,
+		`logger := logger.With("node", "gen", "instance", instanceNumber)`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code doesn't contain %q:\n%s", want, code)
+		}
+	}
+	if strings.Count(code, "logger.With(") != 1 {
+		t.Errorf("generated code should only give gen its own logger:\n%s", code)
+	}
+}
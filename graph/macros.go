@@ -0,0 +1,133 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+// Macros are graphs published as part types: each is used like a subgraph,
+// but is offered when making a goroutine, and only its input and output
+// channels are bound. They are stored as graph files in the macro directory.
+
+// MacroExt is the file extension of macros.
+const MacroExt = ".szgo"
+
+// MacroDir returns the directory macros are stored in.
+func MacroDir() (string, error) {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "shenzhen-go", "macros"), nil
+}
+
+// LoadMacros registers a part type for each macro in dir, named after its
+// file, returning the paths of those registered. It keeps going after
+// errors, returning the first.
+func LoadMacros(dir string) ([]string, error) {
+	ps, err := filepath.Glob(filepath.Join(dir, "*"+MacroExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ps)
+	var loaded []string
+	var first error
+	for _, p := range ps {
+		if err := registerMacro(p); err != nil {
+			if first == nil {
+				first = fmt.Errorf("macro %s: %v", p, err)
+			}
+			continue
+		}
+		loaded = append(loaded, p)
+	}
+	return loaded, first
+}
+
+func registerMacro(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	g, err := LoadJSONFile(abs)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(abs), MacroExt)
+	if err := parts.Register(name, func() interface{} {
+		return &Subgraph{Path: abs, macro: name}
+	}, &parts.Style{Color: "lavender", Shape: "component", Icon: "⧈"}); err != nil {
+		return err
+	}
+	m := parts.Metadata{
+		Name:        g.Name,
+		Description: fmt.Sprintf("A macro: runs the goroutines of %s.", abs),
+	}
+	for _, c := range g.BoundaryChannels("") {
+		m.Fields = append(m.Fields, parts.FieldHelp{
+			Field: fmt.Sprintf("%s %s", c.Boundary, c.Name),
+			Help:  fmt.Sprintf("The channel (of %s) to connect to the macro's %s.", c.Type, c.Boundary),
+		})
+	}
+	parts.SetMetadata(name, m)
+	return nil
+}
+
+// PublishMacro saves a copy of the graph in the macro directory, as a part
+// type called name, and registers it.
+func (g *Graph) PublishMacro(name string) error {
+	if !token.IsIdentifier(name) {
+		return fmt.Errorf("invalid part type %q; it must be a Go identifier", name)
+	}
+	if _, found := parts.Lookup(name); found {
+		return fmt.Errorf("part type %q already exists", name)
+	}
+	if len(g.BoundaryChannels("")) == 0 {
+		return fmt.Errorf("graph has no input or output channels, so a macro of it couldn't be connected to anything")
+	}
+	d, err := MacroDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d, 0755); err != nil {
+		return err
+	}
+	p := filepath.Join(d, name+MacroExt)
+	f, err := ioutil.TempFile(d, name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := g.WriteJSONTo(f); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return err
+	}
+	return registerMacro(p)
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+func TestMacros(t *testing.T) {
+	dir := t.TempDir()
+	inner := testGraph(t, map[string]int{"in": 0, "out": 0}, map[string]string{
+		"pass": "for x := range in { out <- x }; close(out)",
+	})
+	inner.Channels["in"].Boundary = Input
+	inner.Channels["out"].Boundary = Output
+	var buf bytes.Buffer
+	if err := inner.WriteJSONTo(&buf); err != nil {
+		t.Fatalf("WriteJSONTo() = %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "TestPass"+MacroExt), buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	loaded, err := LoadMacros(dir)
+	if err != nil {
+		t.Fatalf("LoadMacros() = %v", err)
+	}
+	if len(loaded) != 1 {
+		t.Fatalf("LoadMacros() loaded %v, want 1 macro", loaded)
+	}
+	defer parts.Unregister("TestPass")
+
+	g, err := LoadJSON(strings.NewReader(`{
+		"name": "outer",
+		"package_path": "example.com/outer",
+		"channels": {
+			"a": {"name": "a", "type": "int"},
+			"b": {"name": "b", "type": "int"}
+		},
+		"nodes": {
+			"p": {"name": "p", "part_type": "TestPass", "part": {"bindings": {"in": "a", "out": "b"}}}
+		}
+	}`), filepath.Join(dir, "outer.szgo"))
+	if err != nil {
+		t.Fatalf("LoadJSON() = %v", err)
+	}
+	n := g.Nodes["p"]
+	s, ok := n.Part.(*Subgraph)
+	if !ok || !s.Macro() {
+		t.Fatalf("part = %T, want a macro", n.Part)
+	}
+	r, w := n.Channels()
+	if want := []string{"a"}; !reflect.DeepEqual(r, want) {
+		t.Errorf("Channels() read = %v, want %v", r, want)
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(w, want) {
+		t.Errorf("Channels() written = %v, want %v", w, want)
+	}
+	if got := len(s.ExposedChannels()); got != 2 {
+		t.Errorf("ExposedChannels() has %d channels, want 2", got)
+	}
+
+	buf.Reset()
+	if err := g.WriteJSONTo(&buf); err != nil {
+		t.Fatalf("WriteJSONTo() = %v", err)
+	}
+	if strings.Contains(buf.String(), `"path"`) {
+		t.Errorf("macro saved with its path:\n%s", buf.String())
+	}
+	for _, d := range g.Check() {
+		if d.Severity == Error {
+			t.Errorf("Check() found error: %v", d)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Merged returns a graph with the properties of g, containing the nodes,
+// channels, comments, and groups of both g and h. Where both have one with the
+// same name, h's wins. Imports are combined. Neither g nor h is changed, but
+// the result shares nodes and channels with them.
+func (g *Graph) Merged(h *Graph) *Graph {
+	m := *g
+	m.Nodes = make(map[string]*Node, len(g.Nodes)+len(h.Nodes))
+	m.Channels = make(map[string]*Channel, len(g.Channels)+len(h.Channels))
+	m.Comments = make(map[string]*Comment, len(g.Comments)+len(h.Comments))
+	m.Groups = make(map[string]*Group, len(g.Groups)+len(h.Groups))
+	for _, x := range []*Graph{g, h} {
+		for k, n := range x.Nodes {
+			m.Nodes[k] = n
+		}
+		for k, c := range x.Channels {
+			m.Channels[k] = c
+		}
+		for k, c := range x.Comments {
+			m.Comments[k] = c
+		}
+		for k, gr := range x.Groups {
+			m.Groups[k] = gr
+		}
+	}
+	m.Imports = append([]string(nil), g.Imports...)
+	have := make(map[string]bool, len(g.Imports))
+	for _, i := range g.Imports {
+		have[i] = true
+	}
+	for _, i := range h.Imports {
+		if !have[i] {
+			have[i] = true
+			m.Imports = append(m.Imports, i)
+		}
+	}
+	return &m
+}
+
+// mapFields are the fields of the graph JSON holding maps of named things,
+// which Merge3 merges thing by thing.
+var mapFields = map[string]string{
+	"nodes":    "goroutine",
+	"channels": "channel",
+	"comments": "comment",
+	"groups":   "group",
+}
+
+// Merge3 does a three-way merge of graph files (as JSON): it applies the
+// changes from base to theirs to ours. Goroutines, channels, comments, and
+// groups are merged individually, so edits to different ones merge cleanly;
+// other properties are merged whole. Where ours and theirs both changed the
+// same thing differently, ours is kept and the conflict is described in
+// conflicts.
+func Merge3(base, ours, theirs []byte) (merged *Graph, conflicts []string, err error) {
+	var b, o, t map[string]json.RawMessage
+	for _, x := range []struct {
+		name string
+		src  []byte
+		dst  *map[string]json.RawMessage
+	}{{"base", base, &b}, {"ours", ours, &o}, {"theirs", theirs, &t}} {
+		if err := json.Unmarshal(x.src, x.dst); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", x.name, err)
+		}
+	}
+
+	out := make(map[string]json.RawMessage)
+	for _, k := range unionKeys(unionKeys(rawKeys(b), rawKeys(o)), rawKeys(t)) {
+		what, isMap := mapFields[k]
+		if !isMap {
+			v, ok := merge3Value(b[k], o[k], t[k])
+			if !ok {
+				conflicts = append(conflicts, fmt.Sprintf("property %s changed on both sides", k))
+			}
+			if v != nil {
+				out[k] = v
+			}
+			continue
+		}
+		var bm, om, tm map[string]json.RawMessage
+		for _, x := range []struct {
+			src json.RawMessage
+			dst *map[string]json.RawMessage
+		}{{b[k], &bm}, {o[k], &om}, {t[k], &tm}} {
+			if len(x.src) == 0 || string(x.src) == "null" {
+				continue
+			}
+			if err := json.Unmarshal(x.src, x.dst); err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", k, err)
+			}
+		}
+		m := make(map[string]json.RawMessage)
+		for _, n := range unionKeys(unionKeys(rawKeys(bm), rawKeys(om)), rawKeys(tm)) {
+			v, ok := merge3Value(bm[n], om[n], tm[n])
+			if !ok {
+				conflicts = append(conflicts, fmt.Sprintf("%s %q changed on both sides", what, n))
+			}
+			if v != nil {
+				m[n] = v
+			}
+		}
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return nil, nil, err
+		}
+		out[k] = raw
+	}
+
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, err = LoadJSON(bytes.NewReader(raw), "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("merged graph: %v", err)
+	}
+	return merged, conflicts, nil
+}
+
+// merge3Value merges one value three ways, where nil means absent. It
+// returns false, with ours, if ours and theirs both changed it differently.
+func merge3Value(base, ours, theirs json.RawMessage) (json.RawMessage, bool) {
+	switch {
+	case sameRaw(ours, theirs), sameRaw(base, theirs):
+		return ours, true
+	case sameRaw(base, ours):
+		return theirs, true
+	}
+	return ours, false
+}
+
+// sameRaw reports whether a and b are the same JSON, ignoring whitespace.
+func sameRaw(a, b json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var x, y bytes.Buffer
+	if json.Compact(&x, a) != nil || json.Compact(&y, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(x.Bytes(), y.Bytes())
+}
+
+func rawKeys(m map[string]json.RawMessage) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMerged(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"first":  "a <- 1; close(a)",
+		"second": "for x := range a { b <- x }; close(b)",
+	})
+	g.Imports = []string{`"fmt"`}
+	h := testGraph(t, map[string]int{"b": 3, "c": 0}, map[string]string{
+		"second": "for x := range b { c <- x }; close(c)",
+		"third":  "for range c {}",
+	})
+	h.Imports = []string{`"fmt"`, `"os"`}
+
+	m := g.Merged(h)
+	var nodes, chans []string
+	for k := range m.Nodes {
+		nodes = append(nodes, k)
+	}
+	for k := range m.Channels {
+		chans = append(chans, k)
+	}
+	sort.Strings(nodes)
+	sort.Strings(chans)
+	if want := []string{"first", "second", "third"}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("nodes = %v, want %v", nodes, want)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(chans, want) {
+		t.Errorf("channels = %v, want %v", chans, want)
+	}
+	if m.Nodes["second"] != h.Nodes["second"] {
+		t.Error("node second not taken from the merged graph")
+	}
+	if got := m.Channels["b"].Cap; got != 3 {
+		t.Errorf("channel b cap = %d, want 3", got)
+	}
+	if want := []string{`"fmt"`, `"os"`}; !reflect.DeepEqual(m.Imports, want) {
+		t.Errorf("imports = %v, want %v", m.Imports, want)
+	}
+	if len(g.Nodes) != 2 || len(g.Imports) != 1 {
+		t.Error("merging changed the original graph")
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"first":  "a <- 1; close(a)",
+		"second": "for x := range a { b <- x }; close(b)",
+		"third":  "for range b {}",
+	})
+	encode := func(g *Graph) []byte {
+		var buf bytes.Buffer
+		if err := g.WriteJSONTo(&buf); err != nil {
+			t.Fatalf("WriteJSONTo() = %v", err)
+		}
+		return buf.Bytes()
+	}
+	clone := func() *Graph {
+		h, err := g.Clone()
+		if err != nil {
+			t.Fatalf("Clone() = %v", err)
+		}
+		return h
+	}
+	base := encode(g)
+
+	// Disjoint changes merge cleanly.
+	ours, theirs := clone(), clone()
+	ours.Nodes["first"].Doc = "ours"
+	ours.Channels["c"] = &Channel{Name: "c", Type: "int"}
+	theirs.Nodes["second"].Doc = "theirs"
+	delete(theirs.Nodes, "third")
+	theirs.Name = "renamed"
+	m, conflicts, err := Merge3(base, encode(ours), encode(theirs))
+	if err != nil {
+		t.Fatalf("Merge3() = %v", err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("Merge3() conflicts = %v, want none", conflicts)
+	}
+	if got := m.Nodes["first"].Doc; got != "ours" {
+		t.Errorf("first.Doc = %q, want ours", got)
+	}
+	if got := m.Nodes["second"].Doc; got != "theirs" {
+		t.Errorf("second.Doc = %q, want theirs", got)
+	}
+	if _, found := m.Nodes["third"]; found {
+		t.Error("third not deleted")
+	}
+	if _, found := m.Channels["c"]; !found {
+		t.Error("channel c not added")
+	}
+	if m.Name != "renamed" {
+		t.Errorf("Name = %q, want renamed", m.Name)
+	}
+
+	// Changing the same node differently conflicts, keeping ours.
+	ours, theirs = clone(), clone()
+	ours.Nodes["first"].Doc = "ours"
+	theirs.Nodes["first"].Doc = "theirs"
+	m, conflicts, err = Merge3(base, encode(ours), encode(theirs))
+	if err != nil {
+		t.Fatalf("Merge3() = %v", err)
+	}
+	if want := []string{`goroutine "first" changed on both sides`}; !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("Merge3() conflicts = %v, want %v", conflicts, want)
+	}
+	if got := m.Nodes["first"].Doc; got != "ours" {
+		t.Errorf("first.Doc = %q, want ours", got)
+	}
+}
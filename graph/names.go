@@ -0,0 +1,189 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// generatedIdents are identifiers declared by the generated code, mapped to
+// a description. Run is package-level; the others are only in scope within Run.
+var generatedIdents = map[string]string{
+	"Run":            "the generated Run function",
+	"wg":             "the WaitGroup used by Run",
+	"n":              "the loop variable used to start multiple instances",
+	"instanceNumber": "the instance number of the goroutine",
+	"logger":         "the logger, if the graph has one",
+	"logLevel":       "the level the logger logs at",
+	"ctx":            "the context of the run, if goroutines have timeouts",
+	"cancel":         "the function cancelling the run, if goroutines have timeouts",
+	"withTimeout":    "the function running code with the goroutine's timeout",
+	"deadLetter":     "the function sending to the dead-letter channel",
+}
+
+// importName guesses the name of an imported package from its path.
+func importName(imp string) string { return path.Base(imp) }
+
+// funcName makes the name of a function from a prefix and a name for people,
+// e.g. "TestScenarioEmptyInput" from "TestScenario" and "empty input".
+func funcName(prefix, name string) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	up := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			up = true
+			continue
+		}
+		if up {
+			r = unicode.ToUpper(r)
+		}
+		b.WriteRune(r)
+		up = false
+	}
+	return b.String()
+}
+
+// suggestName finds a variant of name that doesn't collide with anything
+// in taken.
+func suggestName(name string, taken func(string) bool) string {
+	for i := 0; ; i++ {
+		s := name + "Ch"
+		if i > 0 {
+			s = fmt.Sprintf("%sCh%d", name, i+1)
+		}
+		if !taken(s) {
+			return s
+		}
+	}
+}
+
+// nameTaken reports whether a channel called s would collide with anything.
+func (g *Graph) nameTaken(s string) bool {
+	if _, ch := g.Channels[s]; ch {
+		return true
+	}
+	if _, gen := generatedIdents[s]; gen {
+		return true
+	}
+	if s == "sync" || token.Lookup(s).IsKeyword() || types.Universe.Lookup(s) != nil {
+		return true
+	}
+	for _, i := range g.AllImports() {
+		if importName(i) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// lastIdentRE matches the last identifier in a type, e.g. "Time" in
+// "[]time.Time".
+var lastIdentRE = regexp.MustCompile(`([_a-zA-Z][_a-zA-Z0-9]*)[^_a-zA-Z0-9]*$`)
+
+// UniqueChannelName generates a name for a new channel of the given element
+// type, which doesn't collide with other channels or anything else in scope,
+// e.g. "timeCh" or "timeCh2" for time.Time.
+func (g *Graph) UniqueChannelName(elemType string) string {
+	base := "value"
+	if m := lastIdentRE.FindStringSubmatch(elemType); m != nil {
+		base = strings.ToLower(m[1][:1]) + m[1][1:]
+	}
+	return suggestName(base, g.nameTaken)
+}
+
+// checkNames looks for collisions between channel names, imports, and names
+// used by the generated code, as well as goroutine code accidentally referring
+// to the generated code's own variables.
+func checkNames(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+
+	imps := map[string]string{"sync": "sync"}
+	for _, i := range g.Imports {
+		n := importName(i)
+		if prev, found := imps[n]; found && prev != i {
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Msg:      fmt.Sprintf("imports %q and %q are both called %s", prev, i, n),
+			})
+		}
+		imps[n] = i
+	}
+
+	for _, c := range g.channelNames() {
+		var sev Severity
+		var why string
+		switch {
+		case token.Lookup(c).IsKeyword():
+			sev, why = Error, "is a Go keyword"
+		case imps[c] != "":
+			sev, why = Error, fmt.Sprintf("collides with the imported package %q", imps[c])
+		case c == "Run":
+			sev, why = Error, "collides with "+generatedIdents[c]
+		case generatedIdents[c] != "":
+			sev, why = Warning, "is shadowed inside Run by "+generatedIdents[c]
+		case types.Universe.Lookup(c) != nil:
+			sev, why = Warning, fmt.Sprintf("shadows the predeclared identifier %s", c)
+		default:
+			continue
+		}
+		ds = append(ds, Diagnostic{
+			Severity: sev,
+			Channel:  c,
+			Msg:      fmt.Sprintf("the name %s; consider renaming it to %s", why, suggestName(c, g.nameTaken)),
+		})
+	}
+
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		if strings.ContainsAny(n.Name, "\r\n") {
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Node:     n.Name,
+				Msg:      "the name contains a line break, which breaks the comment in the generated code",
+			})
+		}
+		free, err := source.FreeIdents(n.Impl())
+		if err != nil {
+			// Reported by other checks.
+			continue
+		}
+		for _, id := range free {
+			// Run is fine to refer to (if unwise), instanceNumber is
+			// intended for use, and n only exists with multiple instances.
+			if id != "wg" && !(id == "n" && n.Multiplicity > 1) {
+				continue
+			}
+			if _, ch := g.Channels[id]; ch {
+				// Reported above.
+				continue
+			}
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Node:     n.Name,
+				Msg:      fmt.Sprintf("the code uses %s without declaring it, so it refers to %s", id, generatedIdents[id]),
+			})
+		}
+	}
+	return ds
+}
@@ -19,14 +19,19 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"strings"
 
 	"github.com/google/shenzhen-go/parts"
+	"github.com/google/shenzhen-go/source"
 )
 
 // While being developed, check the interface is matched.
 var (
 	_ = Part(&parts.Code{})
 	_ = Part(&parts.Filter{})
+	_ = Part(&parts.DeadLetterFile{})
+	_ = Part(&parts.Assert{})
+	_ = Part(&parts.Map{})
 	//_ = Part(&parts.Multiplexer{})
 )
 
@@ -42,9 +47,17 @@ type Part interface {
 	// Impl returns Go source code implementing the part.
 	Impl() string
 
+	// RenameChannel changes any uses of the channel from to refer to to.
+	RenameChannel(from, to string) error
+
 	// Update sets fields in the part based on info in the given Request.
 	Update(*http.Request) error
 
+	// Validate checks the part's configuration, e.g. that required fields
+	// are set and expressions parse, ideally returning parts.ConfigErrors.
+	// Checks involving the rest of the graph are done by Check.
+	Validate() error
+
 	// TypeKey returns the "type" of part.
 	TypeKey() string
 }
@@ -56,6 +69,77 @@ type Node struct {
 	Name         string
 	Multiplicity uint
 	Wait         bool
+	Group        string
+	Doc          string
+
+	// Disabled nodes are left out of the generated code. If Bridge is also
+	// set, values are passed straight from the node's input to its output.
+	Disabled bool
+	Bridge   bool
+
+	// Pos, if set, pins the node to a position in the diagram.
+	Pos *Position
+
+	// PartVersion is the version of the part type the node was last saved
+	// with, for versioned part types (see VersionedPart).
+	PartVersion string
+
+	// Resources are hints for the generated code about what the node's
+	// goroutines need.
+	Resources Resources
+
+	// Timeout limits how long the node's goroutines spend on each message.
+	Timeout Timeout
+}
+
+// VersionedPart is implemented by parts whose types have versions, e.g. those
+// installed from a part registry.
+type VersionedPart interface {
+	PartVersion() string
+}
+
+// ImportingPart is implemented by parts whose implementations use packages,
+// which the generated code then imports.
+type ImportingPart interface {
+	Imports() []string
+}
+
+// MappingPart is implemented by parts which send a function (a Go expression
+// of x) of each value from an input to an output, so that properties claimed
+// of the function can be tested (see WritePropertyTestsTo).
+type MappingPart interface {
+	Mapping() (input, output, expr string)
+	Properties() []parts.Property
+}
+
+// Upgrader is implemented by parts whose JSON form has changed, so graphs
+// saved with an older form still load. Formats are numbered from 0 (the
+// original form) up, and saved with the node.
+type Upgrader interface {
+	// PartFormat returns the number of the current format.
+	PartFormat() int
+
+	// UpgradeFrom converts the part's JSON from an older format to the
+	// current one.
+	UpgradeFrom(format int, raw json.RawMessage) (json.RawMessage, error)
+}
+
+// Position is a point in the diagram, in points (1/72 inch) with y increasing
+// upwards, as used by Graphviz.
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Positioned reports whether any nodes are pinned to a position, in which
+// case the diagram is laid out around them.
+func (g *Graph) Positioned() bool {
+	for _, n := range g.Nodes {
+		if n.Pos != nil {
+			return true
+		}
+	}
+	return false
 }
 
 // ChannelsRead returns the channels read from by this node. It is a convenience
@@ -65,21 +149,153 @@ func (n *Node) ChannelsRead() []string {
 	return r
 }
 
-// ChannelsWritten returns the channels written to by this node. It is a convenience
-// function for the templates, which can't do multiple returns.
+// ChannelsWritten returns the channels written to by this node, including any
+// its timeout sends errors to. It is a convenience function for the
+// templates, which can't do multiple returns.
 func (n *Node) ChannelsWritten() []string {
 	_, w := n.Part.Channels()
+	if c := n.Timeout.Errors; c != "" && n.Timeout.Action == TimeoutError {
+		for _, x := range w {
+			if x == c {
+				return w
+			}
+		}
+		w = append(w[:len(w):len(w)], c)
+	}
 	return w
 }
 
+// RenameChannel renames a channel in the part, and in the timeout.
+func (n *Node) RenameChannel(from, to string) error {
+	if err := n.Part.RenameChannel(from, to); err != nil {
+		return err
+	}
+	if n.Timeout.Errors == from {
+		n.Timeout.Errors = to
+	}
+	return nil
+}
+
+// refersTo reports whether the node's implementation refers to id without
+// declaring it, e.g. to use something the generated code provides.
+func (n *Node) refersTo(id string) bool {
+	free, err := source.FreeIdents(n.Impl())
+	if err != nil {
+		return false
+	}
+	for _, f := range free {
+		if f == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelUsage analyses the implementation of the node to find how it uses
+// channels, including which it ranges over and closes.
+func (n *Node) ChannelUsage() (*source.ChannelUsage, error) {
+	return source.ExtractChannelUsage(n.Part.Impl())
+}
+
+// Closes reports whether the node closes the given channel. It is a convenience
+// function for the templates.
+func (n *Node) Closes(channel string) bool {
+	u, err := n.ChannelUsage()
+	if err != nil {
+		return false
+	}
+	for _, c := range u.Closes {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// DocLines returns the lines of the node's documentation. It is a convenience
+// function for the templates, to write it as a comment.
+func (n *Node) DocLines() []string {
+	if d := strings.TrimSpace(n.Doc); d != "" {
+		return strings.Split(d, "\n")
+	}
+	return nil
+}
+
+// Code parts could be doing anything, so they are styled by whether they are a
+// source or a sink of values instead.
+var (
+	sourceStyle = parts.Style{Color: "palegreen", Shape: "box"}
+	sinkStyle   = parts.Style{Color: "lightpink", Shape: "box"}
+)
+
+// Style returns how the node should be drawn, based on the type of its part.
+func (n *Node) Style() parts.Style {
+	if s, ok := parts.StyleOf(n.Part.TypeKey()); ok {
+		return s
+	}
+	if n.Part.TypeKey() == "Code" {
+		r, w := n.Part.Channels()
+		switch {
+		case len(r) == 0 && len(w) > 0:
+			return sourceStyle
+		case len(w) == 0 && len(r) > 0:
+			return sinkStyle
+		}
+	}
+	return parts.DefaultStyle
+}
+
+// Label returns the node's name, preceded by the icon for its part type.
+func (n *Node) Label() string {
+	if i := n.Style().Icon; i != "" {
+		return i + " " + n.Name
+	}
+	return n.Name
+}
+
 func (n *Node) String() string { return n.Name }
 
+// Copy returns a deep copy of the node, including its part.
+func (n *Node) Copy() (*Node, error) {
+	j, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	m := new(Node)
+	if err := json.Unmarshal(j, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CopyNode is like n.Copy, but the copy is ready to use in g: the inner
+// graphs of subgraphs are loaded.
+func (g *Graph) CopyNode(n *Node) (*Node, error) {
+	m, err := n.Copy()
+	if err != nil {
+		return nil, err
+	}
+	h := *g
+	h.Nodes = map[string]*Node{m.Name: m}
+	h.LoadSubgraphs()
+	return m, nil
+}
+
 type jsonNode struct {
 	Name         string          `json:"name"`
 	Wait         bool            `json:"wait"`
 	Multiplicity uint            `json:"multiplicity"`
 	Part         json.RawMessage `json:"part"`
 	PartType     string          `json:"part_type"`
+	PartVersion  string          `json:"part_version,omitempty"`
+	PartFormat   int             `json:"part_format,omitempty"`
+	Group        string          `json:"group,omitempty"`
+	Doc          string          `json:"doc,omitempty"`
+	Disabled     bool            `json:"disabled,omitempty"`
+	Bridge       bool            `json:"bridge,omitempty"`
+	Pos          *Position       `json:"pos,omitempty"`
+	Resources    *Resources      `json:"resources,omitempty"`
+	Timeout      *Timeout        `json:"timeout,omitempty"`
 }
 
 // MarshalJSON encodes the node and part as JSON.
@@ -88,15 +304,43 @@ func (n *Node) MarshalJSON() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if n.Multiplicity < 1 {
-		n.Multiplicity = 1
+	// Nodes are marshalled under read locks, so leave n be.
+	mult := n.Multiplicity
+	if mult < 1 {
+		mult = 1
+	}
+	// Record the version being saved with.
+	version := n.PartVersion
+	if vp, ok := n.Part.(VersionedPart); ok {
+		version = vp.PartVersion()
+	}
+	format := 0
+	if u, ok := n.Part.(Upgrader); ok {
+		format = u.PartFormat()
+	}
+	var res *Resources
+	if !n.Resources.IsZero() {
+		res = &n.Resources
+	}
+	var timeout *Timeout
+	if !n.Timeout.IsZero() {
+		timeout = &n.Timeout
 	}
 	return json.Marshal(&jsonNode{
 		Part:         p,
 		PartType:     n.Part.TypeKey(),
+		PartVersion:  version,
+		PartFormat:   format,
 		Name:         n.Name,
 		Wait:         n.Wait,
-		Multiplicity: n.Multiplicity,
+		Multiplicity: mult,
+		Group:        n.Group,
+		Doc:          n.Doc,
+		Disabled:     n.Disabled,
+		Bridge:       n.Bridge,
+		Pos:          n.Pos,
+		Resources:    res,
+		Timeout:      timeout,
 	})
 }
 
@@ -106,12 +350,25 @@ func (n *Node) UnmarshalJSON(j []byte) error {
 	if err := json.Unmarshal(j, &mp); err != nil {
 		return err
 	}
-	pf, ok := parts.Factories[mp.PartType]
+	pf, ok := parts.Lookup(mp.PartType)
 	if !ok {
 		return fmt.Errorf("unknown part type %q", mp.PartType)
 	}
 	p := pf()
-	if err := json.Unmarshal(mp.Part, p); err != nil {
+	raw := mp.Part
+	if u, ok := p.(Upgrader); ok && mp.PartFormat != u.PartFormat() {
+		if mp.PartFormat > u.PartFormat() {
+			return fmt.Errorf("%s part is in format %d, but this version of shenzhen-go only knows up to %d", mp.PartType, mp.PartFormat, u.PartFormat())
+		}
+		up, err := u.UpgradeFrom(mp.PartFormat, raw)
+		if err != nil {
+			return fmt.Errorf("upgrading %s part from format %d: %v", mp.PartType, mp.PartFormat, err)
+		}
+		raw = up
+	} else if !ok && mp.PartFormat != 0 {
+		return fmt.Errorf("%s part is in format %d, but this version of shenzhen-go only knows 0", mp.PartType, mp.PartFormat)
+	}
+	if err := json.Unmarshal(raw, p); err != nil {
 		return err
 	}
 	ip, ok := p.(Part)
@@ -124,6 +381,20 @@ func (n *Node) UnmarshalJSON(j []byte) error {
 	n.Name = mp.Name
 	n.Wait = mp.Wait
 	n.Multiplicity = mp.Multiplicity
+	n.Group = mp.Group
+	n.Doc = mp.Doc
+	n.Disabled = mp.Disabled
+	n.Bridge = mp.Bridge
+	n.Pos = mp.Pos
+	n.PartVersion = mp.PartVersion
+	n.Resources = Resources{}
+	if mp.Resources != nil {
+		n.Resources = *mp.Resources
+	}
+	n.Timeout = Timeout{}
+	if mp.Timeout != nil {
+		n.Timeout = *mp.Timeout
+	}
 	n.Part = ip
 	return n.Part.Update(nil)
 }
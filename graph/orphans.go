@@ -0,0 +1,106 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// checkOrphans looks for nodes and channels not connected to anything, channels
+// missing a reader or writer, and parts of the graph disjoint from the rest.
+func checkOrphans(g *Graph) []Diagnostic {
+	ends := g.channelEnds()
+	var ds []Diagnostic
+
+	for _, c := range g.channelNames() {
+		e, b := ends[c], g.Channels[c].Boundary
+		switch {
+		case len(e.readers) == 0 && len(e.writers) == 0:
+			ds = append(ds, Diagnostic{Severity: Warning, Channel: c, Msg: "not used by any node", Delete: true})
+		case len(e.readers) == 0 && b != Output:
+			ds = append(ds, Diagnostic{Severity: Warning, Channel: c, Msg: "written to but never read, so writers block once it is full"})
+		case len(e.writers) == 0 && b != Input:
+			ds = append(ds, Diagnostic{Severity: Warning, Channel: c, Msg: "read from but never written to or closed, so readers wait forever"})
+		}
+	}
+
+	// Find weakly connected components with a union-find over nodes, joining
+	// nodes that share a channel.
+	parent := make(map[string]string, len(g.Nodes))
+	var find func(string) string
+	find = func(n string) string {
+		if parent[n] == n {
+			return n
+		}
+		parent[n] = find(parent[n])
+		return parent[n]
+	}
+	for n := range g.Nodes {
+		parent[n] = n
+	}
+	connected := make(map[string]bool)
+	for _, e := range ends {
+		var first string
+		for _, ns := range [][]*Node{e.writers, e.readers} {
+			for _, n := range ns {
+				connected[n.Name] = true
+				if first == "" {
+					first = n.Name
+					continue
+				}
+				parent[find(n.Name)] = find(first)
+			}
+		}
+	}
+
+	comps := make(map[string][]string)
+	for _, n := range g.nodeNames() {
+		if !connected[n] {
+			ds = append(ds, Diagnostic{Severity: Warning, Node: n, Msg: "not connected to any channels", Delete: true})
+			continue
+		}
+		r := find(n)
+		comps[r] = append(comps[r], n)
+	}
+	if len(comps) < 2 {
+		return ds
+	}
+
+	// Report every component except the biggest.
+	var cs [][]string
+	for _, c := range comps {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if len(cs[i]) != len(cs[j]) {
+			return len(cs[i]) > len(cs[j])
+		}
+		return cs[i][0] < cs[j][0]
+	})
+	for _, c := range cs[1:] {
+		q := make([]string, 0, len(c))
+		for _, n := range c {
+			q = append(q, fmt.Sprintf("%q", n))
+		}
+		ds = append(ds, Diagnostic{
+			Severity: Warning,
+			Node:     c[0],
+			Msg:      fmt.Sprintf("nodes %s are disjoint from the rest of the graph", strings.Join(q, ", ")),
+		})
+	}
+	return ds
+}
@@ -0,0 +1,237 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Overflow policies, for Channel.Overflow: what happens to values sent to a
+// channel whose buffer is full.
+const (
+	// OverflowBlock makes the sender wait, as channels usually do.
+	OverflowBlock = ""
+
+	// OverflowDropNewest drops the value being sent.
+	OverflowDropNewest = "drop-newest"
+
+	// OverflowDropOldest drops the value that has waited longest, to make
+	// room for the one being sent.
+	OverflowDropOldest = "drop-oldest"
+
+	// OverflowExpand grows the buffer without limit.
+	OverflowExpand = "expand"
+)
+
+// OverflowPolicies lists the overflow policies, with descriptions.
+var OverflowPolicies = []struct{ Value, Description string }{
+	{OverflowBlock, "Senders wait"},
+	{OverflowDropNewest, "Drop the value being sent"},
+	{OverflowDropOldest, "Drop the oldest value waiting"},
+	{OverflowExpand, "Grow the buffer without limit"},
+}
+
+// overflowName returns the policy, calling the default "block".
+func overflowName(p string) string {
+	if p == OverflowBlock {
+		return "block"
+	}
+	return p
+}
+
+// Overflows reports whether the channel has a policy other than blocking.
+// Senders to such channels never wait.
+func (c *Channel) Overflows() bool { return c.Overflow != OverflowBlock }
+
+// Queued reports whether the channel's values are held by a goroutine
+// started by Run, which readers receive from instead: channels with overflow
+// policies, priorities or journals.
+func (c *Channel) Queued() bool { return c.Overflows() || c.Priority != "" || c.Journaled() }
+
+// Make returns Go making the channel. Queued channels are buffered by their
+// goroutine, so they are made unbuffered.
+func (c *Channel) Make() string {
+	if c.Queued() {
+		return fmt.Sprintf("make(chan %s)", c.Type)
+	}
+	return fmt.Sprintf("make(chan %s, %s)", c.Type, c.CapSource())
+}
+
+// capNote describes the capacity, overflow policy, priority, journal and
+// remote address, for labels.
+func (c *Channel) capNote() string {
+	n := "cap " + c.CapSource()
+	switch c.Overflow {
+	case OverflowDropNewest:
+		n += ", drops newest"
+	case OverflowDropOldest:
+		n += ", drops oldest"
+	case OverflowExpand:
+		n = "unbounded"
+	}
+	if c.Priority != "" {
+		n += ", by " + c.Priority
+	}
+	if c.Journaled() {
+		n += ", journaled"
+	}
+	if c.Remote != "" {
+		n += ", remote at " + c.Remote
+	}
+	return n
+}
+
+// QueuedChannels returns the queued channels, sorted by name.
+func (g *Graph) QueuedChannels() []*Channel {
+	var cs []*Channel
+	for _, cn := range g.channelNames() {
+		if c := g.Channels[cn]; c.Queued() && c.Boundary != Output {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// QueueShim returns Go starting the goroutine which holds the values sent
+// to c until they are received from cQueue, applying c's policy, priority
+// or journal.
+func (g *Graph) QueueShim(c *Channel) (string, error) {
+	if c.Journaled() {
+		return g.journalShim(c), nil
+	}
+	if c.Priority != "" {
+		return g.priorityShim(c)
+	}
+	var add, what string
+	switch c.Overflow {
+	case OverflowDropNewest:
+		what = fmt.Sprintf("dropping new values while %s are waiting", c.CapSource())
+		add = fmt.Sprintf("if len(buf) < %s {\n\tbuf = append(buf, x)\n}", c.CapSource())
+	case OverflowDropOldest:
+		what = fmt.Sprintf("dropping the oldest value when %s are waiting", c.CapSource())
+		add = fmt.Sprintf("if len(buf) == %s {\n\tbuf = buf[1:]\n}\nbuf = append(buf, x)", c.CapSource())
+	default:
+		what = "however many are waiting"
+		add = "buf = append(buf, x)"
+	}
+	return fmt.Sprintf(`// Hold values sent to %[1]s until they are received, %[4]s.
+%[1]sQueue := make(chan %[2]s)
+go func() {
+	defer close(%[1]sQueue)
+	in := %[1]s
+	var buf []%[2]s
+	for in != nil || len(buf) > 0 {
+		var out chan %[2]s
+		var next %[2]s
+		if len(buf) > 0 {
+			out, next = %[1]sQueue, buf[0]
+		}
+		select {
+		case x, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			%[3]s
+		case out <- next:
+			buf = buf[1:]
+		}
+	}
+}()`, c.Name, c.Type, add, what), nil
+}
+
+// queuedReads returns the queued channels n reads, but doesn't write.
+func (g *Graph) queuedReads(n *Node) []string {
+	written := make(map[string]bool)
+	for _, c := range n.ChannelsWritten() {
+		written[c] = true
+	}
+	var cs []string
+	for _, c := range g.DeclaredChannels(n.ChannelsRead()) {
+		if ch := g.Channels[c]; ch.Queued() && ch.Boundary != Output && !written[c] {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// QueuePrologue returns the code having n receive from the goroutines
+// holding values for queued channels, or "" if n reads none.
+func (g *Graph) QueuePrologue(n *Node) string {
+	cs := g.queuedReads(n)
+	if len(cs) == 0 {
+		return ""
+	}
+	rhs := make([]string, len(cs))
+	for i, c := range cs {
+		rhs[i] = c + "Queue"
+	}
+	return fmt.Sprintf("%s := %s", strings.Join(cs, ", "), strings.Join(rhs, ", "))
+}
+
+// checkOverflows reports overflow policies that can't work.
+func checkOverflows(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, cn := range g.channelNames() {
+		c := g.Channels[cn]
+		switch c.Overflow {
+		case OverflowBlock:
+			continue
+		case OverflowDropNewest, OverflowDropOldest:
+			if c.Cap < 1 {
+				ds = append(ds, Diagnostic{
+					Severity: Error,
+					Channel:  cn,
+					Msg:      fmt.Sprintf("%s needs a capacity of at least 1", c.Overflow),
+				})
+			}
+		case OverflowExpand:
+		default:
+			ds = append(ds, Diagnostic{Severity: Error, Channel: cn, Msg: fmt.Sprintf("unknown overflow policy %q", c.Overflow)})
+			continue
+		}
+		if c.Boundary == Output {
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Channel:  cn,
+				Msg:      "outputs are received from outside the graph, so they can't have an overflow policy",
+			})
+		}
+		for _, n := range g.selfReaders(cn) {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Node:     n.Name,
+				Channel:  cn,
+				Msg:      "both sends to and receives from a channel with an overflow policy, so it receives without the policy, competing with the goroutine applying it",
+			})
+		}
+	}
+	return ds
+}
+
+// selfReaders returns the nodes which both read and write a channel.
+func (g *Graph) selfReaders(channel string) []*Node {
+	var ns []*Node
+	for _, n := range g.Readers(channel) {
+		for _, w := range n.ChannelsWritten() {
+			if w == channel {
+				ns = append(ns, n)
+				break
+			}
+		}
+	}
+	return ns
+}
@@ -0,0 +1,63 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOverflow(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 2, "b": 0}, map[string]string{
+		"gen":  "for i := 0; i < 10; i++ { a <- i }; close(a)",
+		"mid":  "for x := range a { b <- x }; close(b)",
+		"sink": "for range b {}",
+	})
+	g.Channels["a"].Overflow = OverflowDropOldest
+	g.Channels["b"].Overflow = OverflowDropNewest
+
+	ds := checkOverflows(g)
+	if len(ds) != 1 || ds[0].Channel != "b" || ds[0].Severity != Error {
+		t.Errorf("checkOverflows = %v, want an error for b, which has no capacity", ds)
+	}
+	g.Channels["b"].Overflow = OverflowExpand
+	if ds := checkOverflows(g); len(ds) != 0 {
+		t.Errorf("checkOverflows = %v, want none", ds)
+	}
+	if got, want := g.QueuePrologue(g.Nodes["mid"]), "a := aQueue"; got != want {
+		t.Errorf("QueuePrologue(mid) = %q, want %q", got, want)
+	}
+	if got, want := g.ChannelSummary("a"), "a (chan int, cap 2, drops oldest)"; got != want {
+		t.Errorf("ChannelSummary(a) = %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	code := buf.String()
+	for _, want := range []string{
+		"a = make(chan int)\n",
+		"aQueue := make(chan int)",
+		"if len(buf) == 2 {",
+		"bQueue := make(chan int)",
+		"b := bQueue",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code doesn't contain %q:\n%s", want, code)
+		}
+	}
+}
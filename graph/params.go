@@ -0,0 +1,108 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// Param is a parameter of a graph: either a type or a constant. Each Subgraph
+// instance of the graph can give it a different value; otherwise (and when
+// the graph is generated as a package by itself) the default is used.
+type Param struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`           // "type" or "const".
+	Type    string `json:"type,omitempty"` // Type of a constant, if any.
+	Default string `json:"default"`
+}
+
+// Decl returns the declaration of the parameter with the given value.
+func (p *Param) Decl(value string) source.Var {
+	if p.Kind == "type" {
+		return source.Var{Name: p.Name, Type: value, Decl: "type"}
+	}
+	return source.Var{Name: p.Name, Type: p.Type, Value: value, Decl: "const"}
+}
+
+func (p *Param) String() string { return p.Decl(p.Default).String() }
+
+// ParseParam parses a parameter written as a Go declaration, either a type
+// alias ("type T = int") or a constant ("const N int = 4").
+func ParseParam(decl string) (*Param, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package p; "+decl, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Decls) != 1 {
+		return nil, fmt.Errorf("want exactly one declaration, got %d", len(f.Decls))
+	}
+	gd, ok := f.Decls[0].(*ast.GenDecl)
+	if !ok || len(gd.Specs) != 1 {
+		return nil, fmt.Errorf("want a single type or const declaration")
+	}
+	str := func(n ast.Node) string {
+		if n == nil {
+			return ""
+		}
+		var b strings.Builder
+		printer.Fprint(&b, fset, n)
+		return b.String()
+	}
+	switch sp := gd.Specs[0].(type) {
+	case *ast.TypeSpec:
+		if !sp.Assign.IsValid() {
+			return nil, fmt.Errorf("type parameter %s must be an alias (type %s = ...)", sp.Name.Name, sp.Name.Name)
+		}
+		return &Param{Name: sp.Name.Name, Kind: "type", Default: str(sp.Type)}, nil
+	case *ast.ValueSpec:
+		if gd.Tok != token.CONST || len(sp.Names) != 1 || len(sp.Values) != 1 {
+			return nil, fmt.Errorf("want a single constant with a value")
+		}
+		return &Param{Name: sp.Names[0].Name, Kind: "const", Type: str(sp.Type), Default: str(sp.Values[0])}, nil
+	}
+	return nil, fmt.Errorf("want a type or const declaration")
+}
+
+// paramDecls returns declarations for the parameters of the graph, with
+// values from args where given, and defaults otherwise.
+func (g *Graph) paramDecls(args map[string]string) []source.Var {
+	vs := make([]source.Var, 0, len(g.Params))
+	for _, p := range g.Params {
+		v := p.Default
+		if a := args[p.Name]; a != "" {
+			v = a
+		}
+		vs = append(vs, p.Decl(v))
+	}
+	return vs
+}
+
+// ParamDecls returns the declarations of the parameters with their defaults,
+// as Go source. It is a convenience function for the templates.
+func (g *Graph) ParamDecls() []string {
+	ds := make([]string, 0, len(g.Params))
+	for _, v := range g.paramDecls(nil) {
+		ds = append(ds, v.String())
+	}
+	return ds
+}
@@ -0,0 +1,49 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseParam(t *testing.T) {
+	tests := []struct {
+		decl    string
+		want    *Param
+		wantErr bool
+	}{
+		{decl: "type T = map[string]int", want: &Param{Name: "T", Kind: "type", Default: "map[string]int"}},
+		{decl: "const N int = 4", want: &Param{Name: "N", Kind: "const", Type: "int", Default: "4"}},
+		{decl: `const S = "x"`, want: &Param{Name: "S", Kind: "const", Default: `"x"`}},
+		{decl: "type T int", wantErr: true},
+		{decl: "var V = 3", wantErr: true},
+		{decl: "const A, B = 1, 2", wantErr: true},
+		{decl: "func f() {}", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseParam(test.decl)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("ParseParam(%q) error = %v, want error %t", test.decl, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseParam(%q) = %+v, want %+v", test.decl, got, test.want)
+		}
+		if got != nil && got.String() != test.decl {
+			t.Errorf("ParseParam(%q).String() = %q, want the same", test.decl, got.String())
+		}
+	}
+}
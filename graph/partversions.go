@@ -0,0 +1,49 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "fmt"
+
+// recordPartVersions notes that the nodes are saved with the versions of
+// their part types now installed.
+func (g *Graph) recordPartVersions() {
+	for _, n := range g.Nodes {
+		if vp, ok := n.Part.(VersionedPart); ok {
+			n.PartVersion = vp.PartVersion()
+		}
+	}
+}
+
+// checkPartVersions reports nodes saved with a different version of their
+// part type than the one now installed, since the code they generate may
+// have changed.
+func checkPartVersions(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, name := range g.nodeNames() {
+		n := g.Nodes[name]
+		vp, ok := n.Part.(VersionedPart)
+		if !ok {
+			continue
+		}
+		if v := vp.PartVersion(); v != "" && n.PartVersion != "" && v != n.PartVersion {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Node:     name,
+				Msg:      fmt.Sprintf("saved with %s %s, but %s is installed", n.TypeKey(), n.PartVersion, v),
+			})
+		}
+	}
+	return ds
+}
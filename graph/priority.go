@@ -0,0 +1,145 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// PriorityKeyType type-checks the channel's priority expression, with x as a
+// value sent, and returns the type of the keys.
+func (g *Graph) PriorityKeyType(c *Channel) (string, error) {
+	return source.OrderedType(c.Priority, g.AllImports(), g.constDecls(), []source.Var{{Name: "x", Type: c.Type}})
+}
+
+// priorityShim returns Go starting the goroutine which holds the values sent
+// to c in a heap until they are received from cQueue, smallest key first.
+func (g *Graph) priorityShim(c *Channel) (string, error) {
+	kt, err := g.PriorityKeyType(c)
+	if err != nil {
+		return "", fmt.Errorf("channel %s priority: %v", c.Name, err)
+	}
+	what, full := "however many are waiting", ""
+	if c.Overflow != OverflowExpand {
+		what = fmt.Sprintf("up to %s at a time", c.CapSource())
+		full = fmt.Sprintf("\n\t\tif len(h) >= %s {\n\t\t\trecv = nil\n\t\t}", c.CapSource())
+	}
+	return fmt.Sprintf(`// Hold values sent to %[1]s until they are received, smallest %[3]s first, %[4]s.
+%[1]sQueue := make(chan %[2]s)
+go func() {
+	defer close(%[1]sQueue)
+	in := %[1]s
+	key := func(x %[2]s) %[5]s { return %[3]s }
+	type held struct {
+		key %[5]s
+		seq int
+		x   %[2]s
+	}
+	var h []held
+	seq := 0
+	less := func(i, j int) bool {
+		return h[i].key < h[j].key || h[i].key == h[j].key && h[i].seq < h[j].seq
+	}
+	for in != nil || len(h) > 0 {
+		recv := in%[6]s
+		var out chan %[2]s
+		var next %[2]s
+		if len(h) > 0 {
+			out, next = %[1]sQueue, h[0].x
+		}
+		select {
+		case x, ok := <-recv:
+			if !ok {
+				in = nil
+				continue
+			}
+			h = append(h, held{key: key(x), seq: seq, x: x})
+			seq++
+			for i := len(h) - 1; i > 0 && less(i, (i-1)/2); i = (i - 1) / 2 {
+				h[i], h[(i-1)/2] = h[(i-1)/2], h[i]
+			}
+		case out <- next:
+			last := len(h) - 1
+			h[0] = h[last]
+			h = h[:last]
+			for i := 0; ; {
+				m := i
+				for _, k := range []int{2*i + 1, 2*i + 2} {
+					if k < len(h) && less(k, m) {
+						m = k
+					}
+				}
+				if m == i {
+					break
+				}
+				h[i], h[m] = h[m], h[i]
+				i = m
+			}
+		}
+	}
+}()`, c.Name, c.Type, c.Priority, what, kt, full), nil
+}
+
+// checkPriorities reports priority expressions that can't be used.
+func checkPriorities(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, cn := range g.channelNames() {
+		c := g.Channels[cn]
+		if c.Priority == "" {
+			continue
+		}
+		if _, err := g.PriorityKeyType(c); err != nil {
+			ds = append(ds, Diagnostic{Severity: Error, Channel: cn, Msg: fmt.Sprintf("priority: %v", err)})
+		}
+		switch c.Overflow {
+		case OverflowBlock:
+			if c.Cap < 1 {
+				ds = append(ds, Diagnostic{
+					Severity: Error,
+					Channel:  cn,
+					Msg:      "a priority queue needs a capacity of at least 1, or to grow without limit, to have values to choose between",
+				})
+			}
+		case OverflowDropNewest, OverflowDropOldest:
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Channel:  cn,
+				Msg:      "a priority queue can make senders wait or grow without limit when full, but can't drop values",
+			})
+		}
+		if c.Boundary == Output {
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Channel:  cn,
+				Msg:      "outputs are received from outside the graph, so they can't have a priority",
+			})
+		}
+		if c.Overflows() {
+			// checkOverflows warns about these.
+			continue
+		}
+		for _, n := range g.selfReaders(cn) {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Node:     n.Name,
+				Channel:  cn,
+				Msg:      "both sends to and receives from a priority channel, so it receives values in the order sent, competing with the priority queue",
+			})
+		}
+	}
+	return ds
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPriority(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 4}, map[string]string{
+		"gen":  "for i := 0; i < 10; i++ { a <- i }; close(a)",
+		"mid":  "for x := range a { b <- x }; close(b)",
+		"sink": "for range b {}",
+	})
+	g.Channels["a"].Priority = "-x"
+	g.Channels["b"].Priority = "x.Nope"
+
+	ds := checkPriorities(g)
+	if len(ds) != 2 || ds[0].Channel != "a" || ds[1].Channel != "b" {
+		t.Errorf("checkPriorities = %v, want errors for a, which has no capacity, and b, whose key doesn't type-check", ds)
+	}
+	g.Channels["a"].Overflow = OverflowExpand
+	g.Channels["b"].Priority = "x % 3"
+	if ds := checkPriorities(g); len(ds) != 0 {
+		t.Errorf("checkPriorities = %v, want none", ds)
+	}
+	if got, want := g.QueuePrologue(g.Nodes["sink"]), "b := bQueue"; got != want {
+		t.Errorf("QueuePrologue(sink) = %q, want %q", got, want)
+	}
+	if got, want := g.ChannelSummary("b"), "b (chan int, cap 4, by x % 3)"; got != want {
+		t.Errorf("ChannelSummary(b) = %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	code := buf.String()
+	for _, want := range []string{
+		"key := func(x int) int { return -x }",
+		"key := func(x int) int { return x % 3 }",
+		"if len(h) >= 4 {",
+		"a := aQueue",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code doesn't contain %q:\n%s", want, code)
+		}
+	}
+	if strings.Count(code, "if len(h) >=") != 1 {
+		t.Errorf("generated code limits both queues, want only b limited:\n%s", code)
+	}
+}
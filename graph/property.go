@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/shenzhen-go/parts"
+	"github.com/google/shenzhen-go/source"
+)
+
+// PropertyNodes returns the names of the nodes with properties to test (see
+// MappingPart), sorted.
+func (g *Graph) PropertyNodes() []string {
+	var ns []string
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		if mp, ok := n.Part.(MappingPart); ok && !n.Disabled && len(mp.Properties()) > 0 {
+			ns = append(ns, nn)
+		}
+	}
+	return ns
+}
+
+// mapping returns the node's function, and the channels it maps between.
+func (g *Graph) mapping(n *Node) (mp MappingPart, in, out *Channel, err error) {
+	mp, ok := n.Part.(MappingPart)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%s doesn't map values", n.Name)
+	}
+	i, o, _ := mp.Mapping()
+	in, out = g.Channels[i], g.Channels[o]
+	if in == nil || out == nil {
+		return nil, nil, nil, fmt.Errorf("%s maps between missing channels", n.Name)
+	}
+	return mp, in, out, nil
+}
+
+// propertyImports returns the imports of the graph, and reflect, which
+// properties may use.
+func (g *Graph) propertyImports() []string {
+	imps := g.AllImports()
+	for _, i := range imps {
+		if i == "reflect" {
+			return imps
+		}
+	}
+	return append(imps, "reflect")
+}
+
+// CheckProperties checks the properties of the node are boolean
+// expressions of x and y, the types of its input and output.
+func (g *Graph) CheckProperties(n *Node) error {
+	mp, in, out, err := g.mapping(n)
+	if err != nil {
+		return err
+	}
+	_, _, expr := mp.Mapping()
+	// The same as the generated test does.
+	f := fmt.Sprintf("f := func(x %s) %s { return %s }\n", in.Type, out.Type, expr)
+	for _, p := range mp.Properties() {
+		body := f + fmt.Sprintf("_ = func(x %s) bool { return func(y %s) bool { return %s }(f(x)) }", in.Type, out.Type, p.Expr)
+		errs, err := source.TypeCheck(body, g.propertyImports(), g.constDecls(), nil)
+		if err != nil {
+			return err
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%s: %s", p.Name, errs[0].Msg)
+		}
+	}
+	return nil
+}
+
+// checkProperties reports properties which aren't boolean expressions of
+// their node's input and output.
+func checkProperties(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, nn := range g.PropertyNodes() {
+		if err := g.CheckProperties(g.Nodes[nn]); err != nil {
+			ds = append(ds, Diagnostic{Severity: Error, Node: nn, Msg: fmt.Sprintf("property %v", err)})
+		}
+	}
+	return ds
+}
+
+// propertyTest is the data for one test in propertyTestTemplate.
+type propertyTest struct {
+	Node, Func, Expr string
+	In, Out          *Channel
+	Properties       []parts.Property
+}
+
+// WritePropertyTestsTo writes a test file for the package generated from the
+// graph, with a property-based test (using testing/quick) of each node with
+// properties (see PropertyNodes). Each checks its node's properties for
+// random values of its input's type.
+func (g *Graph) WritePropertyTestsTo(w io.Writer) error {
+	ns := g.PropertyNodes()
+	if len(ns) == 0 {
+		return errors.New("no goroutine has properties to test")
+	}
+	var text strings.Builder
+	ts := make([]propertyTest, 0, len(ns))
+	for _, nn := range ns {
+		mp, in, out, err := g.mapping(g.Nodes[nn])
+		if err != nil {
+			return err
+		}
+		_, _, expr := mp.Mapping()
+		t := propertyTest{Node: nn, Func: funcName("TestPropertiesOf", nn), Expr: expr, In: in, Out: out, Properties: mp.Properties()}
+		fmt.Fprintln(&text, expr)
+		for _, p := range t.Properties {
+			fmt.Fprintln(&text, p.Expr)
+		}
+		ts = append(ts, t)
+	}
+	used := map[string]bool{"testing": true, "testing/quick": true}
+	for _, i := range g.propertyImports() {
+		if mentionsImport(text.String(), i) {
+			used[i] = true
+		}
+	}
+	imps := make([]string, 0, len(used))
+	for i := range used {
+		imps = append(imps, i)
+	}
+	sort.Strings(imps)
+	buf := &bytes.Buffer{}
+	d := struct {
+		*Graph
+		Imports []string
+		Tests   []propertyTest
+	}{g, imps, ts}
+	if err := propertyTestTemplate.Execute(buf, d); err != nil {
+		return err
+	}
+	if err := gofmt(w, bytes.NewReader(buf.Bytes())); err != nil {
+		// Most likely a property isn't an expression.
+		return fmt.Errorf("invalid properties: %v", err)
+	}
+	return nil
+}
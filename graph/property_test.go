@@ -0,0 +1,73 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+func TestProperties(t *testing.T) {
+	g := testGraph(t, map[string]int{"in": 0, "out": 0, "n": 0}, nil)
+	g.Imports = []string{"strings"}
+	g.Channels["in"].Type = "string"
+	g.Channels["out"].Type = "string"
+	g.Nodes["upper"] = &Node{Name: "upper", Multiplicity: 1, Part: &parts.Map{
+		Input: "in", Output: "out", Expr: "strings.ToUpper(x)",
+		Idempotent: true, PreservesLength: true, Property: "strings.EqualFold(x, y)",
+	}}
+	g.Nodes["count"] = &Node{Name: "count", Multiplicity: 1, Part: &parts.Map{
+		Input: "in", Output: "n", Expr: "len(x)",
+	}}
+
+	if got := g.PropertyNodes(); len(got) != 1 || got[0] != "upper" {
+		t.Errorf("PropertyNodes() = %v, want [upper]", got)
+	}
+	if err := g.CheckProperties(g.Nodes["upper"]); err != nil {
+		t.Errorf("CheckProperties(upper) = %v, want nil", err)
+	}
+	// f(y) doesn't make sense when the output is a different type.
+	g.Nodes["count"].Part.(*parts.Map).Idempotent = true
+	if err := g.CheckProperties(g.Nodes["count"]); err == nil || !strings.Contains(err.Error(), "idempotent") {
+		t.Errorf("CheckProperties(count) = %v, want an error about idempotent", err)
+	}
+	g.Nodes["count"].Part.(*parts.Map).Idempotent = false
+
+	var buf bytes.Buffer
+	if err := g.WritePropertyTestsTo(&buf); err != nil {
+		t.Fatalf("WritePropertyTestsTo = %v", err)
+	}
+	for _, want := range []string{
+		`"reflect"`,
+		`"strings"`,
+		`"testing/quick"`,
+		"func TestPropertiesOfUpper(t *testing.T) {",
+		"f := func(x string) string { return strings.ToUpper(x) }",
+		"quick.Check(",
+		"reflect.DeepEqual(f(y), y)",
+		"len(y) == len(x)",
+		"strings.EqualFold(x, y)",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WritePropertyTestsTo wrote:\n%s\nwant it to contain %q", buf.String(), want)
+		}
+	}
+	if got := g.TestFiles(); got[0].Write != nil || got[1].Write == nil {
+		t.Errorf("TestFiles() wants scenario tests %t, property tests %t; want false, true", got[0].Write != nil, got[1].Write != nil)
+	}
+}
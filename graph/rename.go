@@ -0,0 +1,84 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "fmt"
+
+// RenameEffect describes how renaming a channel changes one node.
+type RenameEffect struct {
+	Node          string
+	Before, After string // The node's implementation.
+}
+
+// renamed returns copies of every node affected by renaming a channel, with
+// the rename applied.
+func (g *Graph) renamed(from, to string) (map[string]*Node, error) {
+	ns := make(map[string]*Node)
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		m, err := g.CopyNode(n)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.RenameChannel(from, to); err != nil {
+			return nil, fmt.Errorf("node %q: %v", nn, err)
+		}
+		if m.Impl() != n.Impl() || m.Timeout != n.Timeout {
+			ns[nn] = m
+		}
+	}
+	return ns, nil
+}
+
+// PreviewRenameChannel returns the effect renaming a channel would have on
+// each node, without changing anything.
+func (g *Graph) PreviewRenameChannel(from, to string) ([]RenameEffect, error) {
+	ns, err := g.renamed(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var effs []RenameEffect
+	for _, nn := range g.nodeNames() {
+		if m, ok := ns[nn]; ok {
+			effs = append(effs, RenameEffect{Node: nn, Before: g.Nodes[nn].Impl(), After: m.Impl()})
+		}
+	}
+	return effs, nil
+}
+
+// RenameChannel renames a channel, and rewrites every node using it to use
+// the new name. Either every node is rewritten, or (if there is an error)
+// nothing is changed.
+func (g *Graph) RenameChannel(from, to string) error {
+	c, found := g.Channels[from]
+	if !found {
+		return fmt.Errorf("no channel %q", from)
+	}
+	if _, found := g.Channels[to]; found {
+		return fmt.Errorf("channel %q already exists", to)
+	}
+	ns, err := g.renamed(from, to)
+	if err != nil {
+		return err
+	}
+	for nn, m := range ns {
+		g.Nodes[nn].Part, g.Nodes[nn].Timeout = m.Part, m.Timeout
+	}
+	delete(g.Channels, from)
+	c.Name = to
+	g.Channels[to] = c
+	g.renameScenarioChannel(from, to)
+	return nil
+}
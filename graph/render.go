@@ -0,0 +1,97 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+// Renderer is implemented by parts which add to how their node is drawn.
+type Renderer interface {
+	Render() parts.Rendering
+}
+
+// Rendering returns what the node's part adds to how the node is drawn.
+func (n *Node) Rendering() parts.Rendering {
+	if r, ok := n.Part.(Renderer); ok {
+		return r.Render()
+	}
+	return parts.Rendering{}
+}
+
+// recordEscape escapes text for a Graphviz record label.
+func recordEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '{', '}', '|', '<', '>', '"', '\\', ' ':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// DotLabel returns the quoted dot label of the node: its name and any lines
+// from its part, or, if the part asks for ports, a record with a port for
+// each channel.
+func (g *Graph) DotLabel(n *Node) string {
+	r := n.Rendering()
+	text := strings.Join(append([]string{n.Label()}, r.Lines...), "\n")
+	if !r.Ports {
+		return fmt.Sprintf("%q", text)
+	}
+	ports := func(prefix string, cs []string) string {
+		fs := make([]string, len(cs))
+		for i, c := range cs {
+			fs[i] = fmt.Sprintf("<%s%d> %s", prefix, i, recordEscape(c))
+		}
+		return "{" + strings.Join(fs, "|") + "}"
+	}
+	fs := []string{recordEscape(text)}
+	if rs := g.DeclaredChannels(n.ChannelsRead()); len(rs) > 0 {
+		fs = append([]string{ports("i", rs)}, fs...)
+	}
+	if ws := g.DeclaredChannels(n.ChannelsWritten()); len(ws) > 0 {
+		fs = append(fs, ports("o", ws))
+	}
+	return `"{` + strings.Join(fs, "|") + `}"`
+}
+
+// DotPort returns the port (e.g. `:"o1"`) of the node where an edge for the
+// channel should meet it, or "" if the node has no ports. dir is "i" for
+// channels read, or "o" for channels written.
+func (g *Graph) DotPort(n *Node, dir, c string) string {
+	if !n.Rendering().Ports {
+		return ""
+	}
+	cs := g.DeclaredChannels(n.ChannelsRead())
+	if dir == "o" {
+		cs = g.DeclaredChannels(n.ChannelsWritten())
+	}
+	for i, x := range cs {
+		if x == c {
+			return fmt.Sprintf(`:"%s%d"`, dir, i)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+// Replacement is one possible replacement in the code of a node.
+type Replacement struct {
+	Node          string
+	Index         int    // Which match in the node's code, from 0.
+	Line          int    // Line number of the start of the match (from 1).
+	Before, After string // The line(s) containing the match, before and after.
+}
+
+// Replacer finds and replaces text in the code of Code nodes.
+type Replacer struct {
+	Find    *regexp.Regexp
+	Replace string // As for regexp.Expand; $ must be escaped as $$ for literal text.
+}
+
+// LiteralReplacer returns a Replacer which replaces find with replace, both
+// taken literally.
+func LiteralReplacer(find, replace string) *Replacer {
+	return &Replacer{
+		Find:    regexp.MustCompile(regexp.QuoteMeta(find)),
+		Replace: strings.Replace(replace, "$", "$$", -1),
+	}
+}
+
+// apply replaces the matches in src selected by sel, which is given the index
+// of each match.
+func (r *Replacer) apply(src string, sel func(int) bool) string {
+	var out []byte
+	last := 0
+	for i, m := range r.Find.FindAllStringSubmatchIndex(src, -1) {
+		if !sel(i) {
+			continue
+		}
+		out = append(out, src[last:m[0]]...)
+		out = r.Find.ExpandString(out, r.Replace, src, m)
+		last = m[1]
+	}
+	return string(append(out, src[last:]...))
+}
+
+// lineAround returns the whole lines of src containing [start, end).
+func lineAround(src string, start, end int) string {
+	s := strings.LastIndex(src[:start], "\n") + 1
+	e := strings.Index(src[end:], "\n")
+	if e < 0 {
+		return src[s:]
+	}
+	return src[s : end+e]
+}
+
+// Replacements lists every replacement r would make, in node name order.
+func (g *Graph) Replacements(r *Replacer) []Replacement {
+	var rs []Replacement
+	for _, nn := range g.nodeNames() {
+		c, ok := g.Nodes[nn].Part.(*parts.Code)
+		if !ok {
+			continue
+		}
+		for i, m := range r.Find.FindAllStringSubmatchIndex(c.Code, -1) {
+			before := lineAround(c.Code, m[0], m[1])
+			// Replace just this match, within its lines.
+			ls := strings.LastIndex(c.Code[:m[0]], "\n") + 1
+			after := string(r.Find.ExpandString([]byte(before[:m[0]-ls]), r.Replace, c.Code, m)) + before[m[1]-ls:]
+			rs = append(rs, Replacement{
+				Node:   nn,
+				Index:  i,
+				Line:   strings.Count(c.Code[:m[0]], "\n") + 1,
+				Before: before,
+				After:  after,
+			})
+		}
+	}
+	return rs
+}
+
+// Replace makes the replacements selected by sel, which is given the node name
+// and index of each match. It returns the names of nodes changed.
+func (g *Graph) Replace(r *Replacer, sel func(node string, index int) bool) ([]string, error) {
+	var changed []string
+	for _, nn := range g.nodeNames() {
+		c, ok := g.Nodes[nn].Part.(*parts.Code)
+		if !ok {
+			continue
+		}
+		code := r.apply(c.Code, func(i int) bool { return sel(nn, i) })
+		if code == c.Code {
+			continue
+		}
+		old := c.Code
+		c.Code = code
+		if err := c.Update(nil); err != nil {
+			// Leave the node as it was.
+			c.Code = old
+			return changed, fmt.Errorf("node %q: %v", nn, err)
+		}
+		changed = append(changed, nn)
+	}
+	return changed, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Resources are optional hints about what the goroutines of a node need,
+// which are generated into the code that starts them. They suit pipelines
+// mixing CPU-heavy and IO-heavy stages.
+type Resources struct {
+	// Procs asks for at least this many goroutines to run in parallel: Run
+	// raises GOMAXPROCS to the largest Procs of any node, if it is lower.
+	Procs int `json:"procs,omitempty"`
+
+	// LockOSThread locks each goroutine to an OS thread of its own, for code
+	// relying on thread-local state (as some C libraries do).
+	LockOSThread bool `json:"lock_os_thread,omitempty"`
+
+	// Semaphore names a limit shared by every node naming it: at most Slots
+	// of their goroutines run at once (e.g. to limit open files). Each
+	// goroutine waits for a slot before starting, and frees it on finishing.
+	Semaphore string `json:"semaphore,omitempty"`
+	Slots     int    `json:"slots,omitempty"`
+}
+
+// IsZero reports whether there are no hints.
+func (r Resources) IsZero() bool { return r == Resources{} }
+
+func (r Resources) String() string {
+	var s []string
+	if r.Procs > 0 {
+		s = append(s, fmt.Sprintf("at least %d procs", r.Procs))
+	}
+	if r.LockOSThread {
+		s = append(s, "locked to an OS thread")
+	}
+	if r.Semaphore != "" {
+		s = append(s, fmt.Sprintf("semaphore %s (%d slots)", r.Semaphore, r.Slots))
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ", ")
+}
+
+// ResourcePrologue returns the code each goroutine of the node runs first,
+// to acquire what its Resources ask for.
+func (n *Node) ResourcePrologue() string {
+	var b strings.Builder
+	if n.Resources.LockOSThread {
+		b.WriteString("runtime.LockOSThread()\ndefer runtime.UnlockOSThread()\n")
+	}
+	if s := n.Resources.Semaphore; s != "" {
+		fmt.Fprintf(&b, "%sSemaphore <- struct{}{}\ndefer func() { <-%sSemaphore }()\n", s, s)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Semaphore is a limit on how many goroutines run at once, shared by the
+// nodes naming it in their Resources.
+type Semaphore struct {
+	Name  string
+	Slots int
+}
+
+// Semaphores returns the semaphores used by enabled nodes, sorted by name.
+// Where nodes disagree on the number of slots, the largest wins.
+func (g *Graph) Semaphores() []Semaphore {
+	slots := make(map[string]int)
+	for _, n := range g.Nodes {
+		r := n.Resources
+		if n.Disabled || r.Semaphore == "" {
+			continue
+		}
+		s := r.Slots
+		if s < 1 {
+			s = 1
+		}
+		if s > slots[r.Semaphore] {
+			slots[r.Semaphore] = s
+		}
+	}
+	ss := make([]Semaphore, 0, len(slots))
+	for name, s := range slots {
+		ss = append(ss, Semaphore{Name: name, Slots: s})
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Name < ss[j].Name })
+	return ss
+}
+
+// Procs returns the largest Procs hint of any enabled node, or 0.
+func (g *Graph) Procs() int {
+	p := 0
+	for _, n := range g.Nodes {
+		if !n.Disabled && n.Resources.Procs > p {
+			p = n.Resources.Procs
+		}
+	}
+	return p
+}
+
+// needsRuntime reports whether the generated code for the graph itself (not
+// its subgraphs) uses the runtime package.
+func (g *Graph) needsRuntime() bool {
+	if g.Procs() > 0 {
+		return true
+	}
+	for _, n := range g.Nodes {
+		if !n.Disabled && n.Resources.LockOSThread {
+			return true
+		}
+	}
+	return false
+}
+
+// checkResources reports semaphores with unusable names, and semaphores
+// given different numbers of slots by different nodes.
+func checkResources(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	slots := make(map[string]map[int]bool)
+	for _, nn := range g.nodeNames() {
+		r := g.Nodes[nn].Resources
+		if r.Semaphore == "" {
+			continue
+		}
+		if !token.IsIdentifier(r.Semaphore) {
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Node:     nn,
+				Msg:      fmt.Sprintf("semaphore name %q is not a Go identifier", r.Semaphore),
+			})
+		}
+		if slots[r.Semaphore] == nil {
+			slots[r.Semaphore] = make(map[int]bool)
+		}
+		slots[r.Semaphore][r.Slots] = true
+	}
+	for _, s := range g.Semaphores() {
+		if len(slots[s.Name]) > 1 {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Msg:      fmt.Sprintf("goroutines give semaphore %s different numbers of slots; it has %d, the largest", s.Name, s.Slots),
+			})
+		}
+	}
+	return ds
+}
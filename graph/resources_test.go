@@ -0,0 +1,80 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResources(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"read":  "for range a {}",
+		"write": "a <- 1; close(a)",
+		"spare": "",
+	})
+	g.Nodes["read"].Resources = Resources{Procs: 4, Semaphore: "files", Slots: 2}
+	g.Nodes["write"].Resources = Resources{LockOSThread: true, Semaphore: "files", Slots: 3}
+
+	if got, want := g.Procs(), 4; got != want {
+		t.Errorf("Procs() = %d, want %d", got, want)
+	}
+	if got, want := g.Semaphores(), []Semaphore{{Name: "files", Slots: 3}}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("Semaphores() = %v, want %v", got, want)
+	}
+	ds := checkResources(g)
+	if len(ds) != 1 || ds[0].Severity != Warning {
+		t.Errorf("checkResources = %v, want one warning about slots", ds)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	code := buf.String()
+	for _, want := range []string{
+		`"runtime"`,
+		"filesSemaphore := make(chan struct{}, 3)",
+		"runtime.GOMAXPROCS(4)",
+		"runtime.LockOSThread()",
+		"filesSemaphore <- struct{}{}",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code doesn't contain %q:\n%s", want, code)
+		}
+	}
+
+	j, err := json.Marshal(g.Nodes["write"])
+	if err != nil {
+		t.Fatalf("Marshal = %v", err)
+	}
+	var n Node
+	if err := json.Unmarshal(j, &n); err != nil {
+		t.Fatalf("Unmarshal = %v", err)
+	}
+	if n.Resources != g.Nodes["write"].Resources {
+		t.Errorf("Resources after round trip = %v, want %v", n.Resources, g.Nodes["write"].Resources)
+	}
+	if j, _ := json.Marshal(g.Nodes["spare"]); bytes.Contains(j, []byte("resources")) {
+		t.Errorf("node without resources marshalled them: %s", j)
+	}
+
+	g.Nodes["read"].Resources.Semaphore = "not ok"
+	if ds := checkResources(g); len(ds) == 0 || ds[0].Severity != Error {
+		t.Errorf("checkResources = %v, want an error for the semaphore name", ds)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// FileDiagnostics are the diagnostics for one graph file. Source is the
+// file's contents, if available, for finding line numbers.
+type FileDiagnostics struct {
+	Path        string
+	Source      []byte
+	Diagnostics []Diagnostic
+}
+
+// jsonDiagnostic is the JSON form of a Diagnostic.
+type jsonDiagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	Node     string `json:"node,omitempty"`
+	Channel  string `json:"channel,omitempty"`
+	Message  string `json:"message"`
+}
+
+// line finds the line in src (as written by WriteJSONTo) where d's node or
+// channel is defined. It returns 0 if it can't tell.
+func (fd *FileDiagnostics) line(d Diagnostic) int {
+	section, name := "nodes", d.Node
+	if name == "" {
+		section, name = "channels", d.Channel
+	}
+	if name == "" || len(fd.Source) == 0 {
+		return 0
+	}
+	key, err := json.Marshal(name)
+	if err != nil {
+		return 0
+	}
+	want := append(append([]byte("\t\t"), key...), ": {"...)
+	in := false
+	for i, l := range bytes.Split(fd.Source, []byte("\n")) {
+		switch {
+		case bytes.HasPrefix(l, []byte("\t\""+section+"\": {")):
+			in = true
+		case in && bytes.Equal(bytes.TrimRight(l, "\r"), want):
+			return i + 1
+		case in && bytes.HasPrefix(l, []byte("\t}")):
+			in = false
+		}
+	}
+	return 0
+}
+
+// WriteDiagnosticsJSON writes the diagnostics as a JSON array of objects,
+// each with the file, line, severity, node, channel, and message.
+func WriteDiagnosticsJSON(w io.Writer, fds []FileDiagnostics) error {
+	out := []jsonDiagnostic{}
+	for i := range fds {
+		fd := &fds[i]
+		for _, d := range fd.Diagnostics {
+			out = append(out, jsonDiagnostic{
+				File:     fd.Path,
+				Line:     fd.line(d),
+				Severity: d.Severity.String(),
+				Node:     d.Node,
+				Channel:  d.Channel,
+				Message:  d.Msg,
+			})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(out)
+}
+
+// The SARIF 2.1.0 subset needed to report diagnostics.
+type (
+	sarifLog struct {
+		Version string     `json:"version"`
+		Schema  string     `json:"$schema"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver struct {
+			Name           string      `json:"name"`
+			InformationURI string      `json:"informationUri"`
+			Rules          []sarifRule `json:"rules"`
+		} `json:"driver"`
+	}
+	sarifRule struct {
+		ID               string    `json:"id"`
+		ShortDescription sarifText `json:"shortDescription"`
+	}
+	sarifText struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifText       `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifLocation struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region *sarifRegion `json:"region,omitempty"`
+		} `json:"physicalLocation"`
+		LogicalLocations []sarifLogical `json:"logicalLocations,omitempty"`
+	}
+	sarifRegion struct {
+		StartLine int `json:"startLine"`
+	}
+	sarifLogical struct {
+		Name string `json:"name"`
+		Kind string `json:"kind"`
+	}
+)
+
+// Diagnostics don't have IDs, so SARIF rules are by what they concern.
+var sarifRules = []sarifRule{
+	{"goroutine", sarifText{"Problem with a goroutine"}},
+	{"channel", sarifText{"Problem with a channel"}},
+	{"graph", sarifText{"Problem with the graph"}},
+}
+
+// WriteSARIF writes the diagnostics as a SARIF 2.1.0 log, which CI systems
+// can use to annotate changes.
+func WriteSARIF(w io.Writer, fds []FileDiagnostics) error {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "shenzhen-go"
+	run.Tool.Driver.InformationURI = "https://github.com/google/shenzhen-go"
+	run.Tool.Driver.Rules = sarifRules
+	for i := range fds {
+		fd := &fds[i]
+		for _, d := range fd.Diagnostics {
+			r := sarifResult{
+				RuleID:  "graph",
+				Level:   d.Severity.String(),
+				Message: sarifText{d.String()},
+			}
+			var loc sarifLocation
+			loc.PhysicalLocation.ArtifactLocation.URI = fd.Path
+			if l := fd.line(d); l > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: l}
+			}
+			switch {
+			case d.Node != "":
+				r.RuleID = "goroutine"
+				loc.LogicalLocations = []sarifLogical{{Name: d.Node, Kind: "function"}}
+			case d.Channel != "":
+				r.RuleID = "channel"
+				loc.LogicalLocations = []sarifLogical{{Name: d.Channel, Kind: "variable"}}
+			}
+			r.Locations = []sarifLocation{loc}
+			run.Results = append(run.Results, r)
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(&sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	})
+}
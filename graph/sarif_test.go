@@ -0,0 +1,71 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteDiagnostics(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "unused": 0}, map[string]string{
+		"first":  "a <- 1; close(a)",
+		"second": "for range a {}",
+	})
+	var src bytes.Buffer
+	if err := g.WriteJSONTo(&src); err != nil {
+		t.Fatalf("WriteJSONTo() = %v", err)
+	}
+	fds := []FileDiagnostics{{Path: "test.szgo", Source: src.Bytes(), Diagnostics: g.Check()}}
+
+	var buf bytes.Buffer
+	if err := WriteDiagnosticsJSON(&buf, fds); err != nil {
+		t.Fatalf("WriteDiagnosticsJSON() = %v", err)
+	}
+	var ds []jsonDiagnostic
+	if err := json.Unmarshal(buf.Bytes(), &ds); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	found := false
+	for _, d := range ds {
+		if d.Channel != "unused" {
+			continue
+		}
+		found = true
+		if d.Severity != "warning" || d.File != "test.szgo" {
+			t.Errorf("diagnostic = %+v, want a warning in test.szgo", d)
+		}
+		lines := bytes.Split(src.Bytes(), []byte("\n"))
+		if d.Line < 1 || !bytes.Equal(lines[d.Line-1], []byte("\t\t\"unused\": {")) {
+			t.Errorf("diagnostic line = %d, not where channel unused is", d.Line)
+		}
+	}
+	if !found {
+		t.Errorf("no diagnostic about channel unused in %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteSARIF(&buf, fds); err != nil {
+		t.Fatalf("WriteSARIF() = %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != len(ds) {
+		t.Errorf("SARIF log = %s, want one run with %d results", buf.String(), len(ds))
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultScenarioTimeout is how long scenarios without a timeout may take.
+const DefaultScenarioTimeout = 10 * time.Second
+
+// Scenario is a named test of the whole graph: values sent to its inputs, and
+// the values expected from its outputs, in order, before it finishes.
+// Values are Go expressions, by channel. Inputs without values get those of
+// their fixture, if any, and outputs without values aren't checked. Timeout,
+// as for time.ParseDuration, limits how long Run may take.
+type Scenario struct {
+	Name    string              `json:"name"`
+	Inputs  map[string][]string `json:"inputs,omitempty"`
+	Outputs map[string][]string `json:"outputs,omitempty"`
+	Timeout string              `json:"timeout,omitempty"`
+}
+
+// TestName returns the name of the test generated for the scenario, e.g.
+// "TestScenarioEmptyInput" for "empty input".
+func (s *Scenario) TestName() string { return funcName("TestScenario", s.Name) }
+
+// timeout returns the timeout as a Timeout, for its Source.
+func (s *Scenario) timeout() Timeout {
+	if s.Timeout == "" {
+		return Timeout{Duration: DefaultScenarioTimeout.String()}
+	}
+	return Timeout{Duration: s.Timeout}
+}
+
+// Scenario returns the scenario called name, or nil if there isn't one.
+func (g *Graph) Scenario(name string) *Scenario {
+	for _, s := range g.Scenarios {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// DeleteScenario deletes the scenario called name, if there is one.
+func (g *Graph) DeleteScenario(name string) {
+	for i, s := range g.Scenarios {
+		if s.Name == name {
+			g.Scenarios = append(g.Scenarios[:i:i], g.Scenarios[i+1:]...)
+			return
+		}
+	}
+}
+
+// renameScenarioChannel changes uses of the channel from in scenarios to to.
+func (g *Graph) renameScenarioChannel(from, to string) {
+	for _, s := range g.Scenarios {
+		for _, m := range []map[string][]string{s.Inputs, s.Outputs} {
+			if vs, found := m[from]; found {
+				delete(m, from)
+				m[to] = vs
+			}
+		}
+	}
+}
+
+// CheckScenario checks the scenario's channels are inputs and outputs, that
+// its values are of their types, and its timeout.
+func (g *Graph) CheckScenario(s *Scenario) error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("the name is empty")
+	}
+	for _, t := range g.Scenarios {
+		if t != s && t.TestName() == s.TestName() {
+			return fmt.Errorf("the name is too like that of %q", t.Name)
+		}
+	}
+	for _, b := range []string{Input, Output} {
+		m := s.Inputs
+		if b == Output {
+			m = s.Outputs
+		}
+		cs := make([]string, 0, len(m))
+		for cn := range m {
+			cs = append(cs, cn)
+		}
+		sort.Strings(cs)
+		for _, cn := range cs {
+			c := g.Channels[cn]
+			if c == nil || c.Boundary != b {
+				return fmt.Errorf("%s isn't an %s of the graph", cn, b)
+			}
+			for i, v := range m[cn] {
+				if err := g.checkSample(c, v, nil); err != nil {
+					return fmt.Errorf("%s value %d: %v", cn, i+1, err)
+				}
+			}
+		}
+	}
+	if s.Timeout != "" {
+		d, err := time.ParseDuration(s.Timeout)
+		if err != nil {
+			return fmt.Errorf("timeout: %v", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("timeout: %v isn't positive", d)
+		}
+	}
+	return nil
+}
+
+// checkScenarios reports problems with scenarios.
+func checkScenarios(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, s := range g.Scenarios {
+		if err := g.CheckScenario(s); err != nil {
+			ds = append(ds, Diagnostic{Severity: Error, Msg: fmt.Sprintf("scenario %q: %v", s.Name, err)})
+		}
+	}
+	return ds
+}
+
+// scenarioChannel is a boundary channel, and its values, in a scenario test.
+type scenarioChannel struct {
+	*Channel
+	Values  []string
+	Checked bool
+}
+
+// scenarioTest is the data for one test in scenarioTestTemplate.
+type scenarioTest struct {
+	*Scenario
+	Inputs, Outputs []scenarioChannel
+	Timeout         string
+}
+
+// WriteScenarioTestsTo writes a test file for the package generated from the
+// graph, with a test of each scenario (see Scenario.TestName). Each resets
+// the package's channels first, but scenarios leaving goroutines running
+// (e.g. by timing out) can disturb those after, so RunScenarios runs each
+// one in its own process.
+func (g *Graph) WriteScenarioTestsTo(w io.Writer) error {
+	var text strings.Builder
+	used := make(map[string]bool)
+	ts := make([]scenarioTest, 0, len(g.Scenarios))
+	for _, s := range g.Scenarios {
+		t := scenarioTest{Scenario: s, Timeout: s.timeout().Source()}
+		used["testing"], used["time"] = true, true
+		for _, c := range g.BoundaryChannels(Input) {
+			vs, given := s.Inputs[c.Name]
+			if !given {
+				vs = c.SampleExprs()
+			}
+			t.Inputs = append(t.Inputs, scenarioChannel{Channel: c, Values: vs})
+			fmt.Fprintln(&text, c.Type, strings.Join(vs, "\n"))
+		}
+		for _, c := range g.BoundaryChannels(Output) {
+			vs, given := s.Outputs[c.Name]
+			t.Outputs = append(t.Outputs, scenarioChannel{Channel: c, Values: vs, Checked: given})
+			used["sync"] = true
+			used["reflect"] = used["reflect"] || given
+			fmt.Fprintln(&text, c.Type, strings.Join(vs, "\n"))
+		}
+		ts = append(ts, t)
+	}
+	for _, i := range g.Imports {
+		if mentionsImport(text.String(), i) {
+			used[i] = true
+		}
+	}
+	imps := make([]string, 0, len(used))
+	for i, u := range used {
+		if u {
+			imps = append(imps, i)
+		}
+	}
+	sort.Strings(imps)
+	buf := &bytes.Buffer{}
+	d := struct {
+		*Graph
+		Imports []string
+		Tests   []scenarioTest
+	}{g, imps, ts}
+	if err := scenarioTestTemplate.Execute(buf, d); err != nil {
+		return err
+	}
+	if err := gofmt(w, bytes.NewReader(buf.Bytes())); err != nil {
+		// Most likely a value isn't an expression.
+		return fmt.Errorf("invalid scenario values: %v", err)
+	}
+	return nil
+}
+
+// ScenarioResult is the outcome of running a scenario.
+type ScenarioResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Output string `json:"output"` // What the test printed.
+}
+
+// RunScenarios builds the tests of the scenarios (see WriteScenarioTestsTo),
+// and runs each in turn by itself. Errors building them are returned,
+// but failing scenarios are only reported in the results.
+func (g *Graph) RunScenarios(ctx context.Context) ([]ScenarioResult, error) {
+	if len(g.Scenarios) == 0 {
+		return nil, nil
+	}
+	for _, s := range g.Scenarios {
+		if err := g.CheckScenario(s); err != nil {
+			return nil, fmt.Errorf("scenario %q: %v", s.Name, err)
+		}
+	}
+	var gen, tests bytes.Buffer
+	if err := g.WriteGoTo(&gen); err != nil {
+		return nil, err
+	}
+	if err := g.WriteScenarioTestsTo(&tests); err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "shenzhen-go-scenarios")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "generated.go"), gen.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "generated_test.go"), tests.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	build := exec.CommandContext(ctx, `go`, `test`, `-c`, `-o`, `scenarios.test`, `generated.go`, `generated_test.go`)
+	build.Dir = dir
+	if o, err := build.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("go test -c: %v:\n%s", err, o)
+	}
+	rs := make([]ScenarioResult, 0, len(g.Scenarios))
+	for _, s := range g.Scenarios {
+		cmd := exec.CommandContext(ctx, filepath.Join(dir, "scenarios.test"), `-test.run`, "^"+s.TestName()+"$", `-test.v`)
+		cmd.Dir = dir
+		o, err := cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return rs, ctx.Err()
+		}
+		rs = append(rs, ScenarioResult{Name: s.Name, Passed: err == nil, Output: string(o)})
+	}
+	return rs, nil
+}
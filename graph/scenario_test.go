@@ -0,0 +1,124 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func scenarioGraph(t *testing.T) *Graph {
+	g := testGraph(t, map[string]int{"in": 0, "mid": 2, "out": 0}, map[string]string{
+		"double": "for x := range in { mid <- 2 * x }; close(mid)",
+		"relay":  "for x := range mid { out <- x }",
+	})
+	g.Channels["in"].Boundary = Input
+	g.Channels["in"].Fixture = &Fixture{Values: []string{"7"}}
+	g.Channels["out"].Boundary = Output
+	g.Termination = WaitAll
+	g.Scenarios = []*Scenario{
+		{Name: "doubles", Inputs: map[string][]string{"in": {"1", "2"}}, Outputs: map[string][]string{"out": {"2", "4"}}},
+		{Name: "samples", Timeout: "90s"},
+	}
+	return g
+}
+
+func TestScenarioTests(t *testing.T) {
+	g := scenarioGraph(t)
+	if ds := checkScenarios(g); len(ds) != 0 {
+		t.Errorf("checkScenarios = %v, want none", ds)
+	}
+	var buf bytes.Buffer
+	if err := g.WriteScenarioTestsTo(&buf); err != nil {
+		t.Fatalf("WriteScenarioTestsTo = %v", err)
+	}
+	for _, want := range []string{
+		`"reflect"`,
+		"mid = make(chan int, 2)",
+		"func TestScenarioDoubles(t *testing.T) {",
+		"range []int{1, 2}",
+		"Run(in, out)",
+		"case <-time.After(10 * time.Second):",
+		"want := []int{2, 4}; !reflect.DeepEqual(outGot, want)",
+		"func TestScenarioSamples(t *testing.T) {",
+		"range []int{7}",
+		"case <-time.After(90 * time.Second):",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteScenarioTestsTo wrote:\n%s\nwant it to contain %q", buf.String(), want)
+		}
+	}
+	if got := strings.Count(buf.String(), "reflect.DeepEqual"); got != 1 {
+		t.Errorf("WriteScenarioTestsTo checks outputs %d times, want once (samples doesn't expect anything)", got)
+	}
+
+	if err := g.RenameChannel("out", "result"); err != nil {
+		t.Fatalf("RenameChannel(out, result) = %v", err)
+	}
+	if got := g.Scenario("doubles").Outputs["result"]; len(got) != 2 {
+		t.Errorf("after renaming, doubles expects %v from result, want [2 4]", got)
+	}
+	g.DeleteScenario("samples")
+	if len(g.Scenarios) != 1 || g.Scenario("samples") != nil {
+		t.Errorf("after DeleteScenario(samples), Scenarios = %v", g.Scenarios)
+	}
+}
+
+func TestCheckScenario(t *testing.T) {
+	g := scenarioGraph(t)
+	for _, s := range []*Scenario{
+		{Name: ""},
+		{Name: "Doubles!"},
+		{Name: "x", Inputs: map[string][]string{"mid": {"1"}}},
+		{Name: "x", Inputs: map[string][]string{"out": {"1"}}},
+		{Name: "x", Outputs: map[string][]string{"out": {`"two"`}}},
+		{Name: "x", Timeout: "soon"},
+		{Name: "x", Timeout: "-1s"},
+	} {
+		if err := g.CheckScenario(s); err == nil {
+			t.Errorf("CheckScenario(%+v) = nil, want an error", s)
+		}
+	}
+}
+
+func TestGenerateToRemovesStaleTests(t *testing.T) {
+	g := scenarioGraph(t)
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := g.GenerateTo(dir, ""); err != nil {
+		t.Fatalf("GenerateTo() = %v", err)
+	}
+	tp := filepath.Join(dir, "generated_test.go")
+	fi, err := os.Stat(tp)
+	if err != nil {
+		t.Fatalf("after GenerateTo(), Stat(generated_test.go) = %v", err)
+	}
+	if m := fi.Mode().Perm(); m != 0644 {
+		t.Errorf("generated_test.go mode = %v, want %v", m, os.FileMode(0644))
+	}
+
+	g.Scenarios = nil
+	if err := g.GenerateTo(dir, ""); err != nil {
+		t.Fatalf("GenerateTo() without scenarios = %v", err)
+	}
+	if _, err := os.Stat(tp); !os.IsNotExist(err) {
+		t.Errorf("after GenerateTo() without scenarios, Stat(generated_test.go) = %v, want not found", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "generated.go")); err != nil {
+		t.Errorf("after GenerateTo(), Stat(generated.go) = %v", err)
+	}
+}
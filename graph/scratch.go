@@ -0,0 +1,150 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Scratch returns a graph of just the node, in which the channels it reads
+// are inputs and those it writes are outputs, so it can be run by itself
+// (see RunScratch). Run waits for it, and closes any outputs it doesn't
+// close itself once it finishes.
+func (g *Graph) Scratch(node string) (*Graph, error) {
+	n := g.Nodes[node]
+	if n == nil {
+		return nil, fmt.Errorf("no goroutine called %q", node)
+	}
+	if n.Disabled {
+		return nil, fmt.Errorf("%s is disabled", node)
+	}
+	h := *g
+	h.SourcePath, h.PackagePath = "", "main"
+	h.Nodes = map[string]*Node{node: n}
+	h.Channels = make(map[string]*Channel)
+	h.Comments, h.Groups, h.Scenarios = nil, nil, nil
+	h.Termination = WaitAll
+	rs, ws := g.activeChannels(n)
+	for i, cs := range [][]string{rs, ws} {
+		b := Input
+		if i == 1 {
+			b = Output
+		}
+		for _, cn := range cs {
+			if c := h.Channels[cn]; c != nil {
+				// Read and written, so it can't be either.
+				c.Boundary = ""
+				continue
+			}
+			o := g.Channels[cn]
+			h.Channels[cn] = &Channel{Name: cn, Type: o.Type, Cap: o.Cap, CapExpr: o.CapExpr, Boundary: b, Fixture: o.Fixture}
+		}
+	}
+	if _, found := h.Channels[h.DeadLetters]; !found {
+		h.DeadLetters = ""
+	}
+	h.Imports = h.usedImports()
+	return &h, nil
+}
+
+// WriteScratchMainTo writes a main function for the graph Scratch makes of
+// the node, which sends samples (Go expressions, by input) to the inputs
+// before calling Run, and prints what it sends to its outputs. Inputs
+// without samples get those of their fixture, if any.
+func (g *Graph) WriteScratchMainTo(w io.Writer, node string, samples map[string][]string) error {
+	h, err := g.Scratch(node)
+	if err != nil {
+		return err
+	}
+	for c := range samples {
+		if ch := h.Channels[c]; ch == nil || ch.Boundary != Input {
+			return fmt.Errorf("%s isn't an input of %s", c, node)
+		}
+	}
+	all := make(map[string][]string)
+	var text strings.Builder
+	for _, c := range h.BoundaryChannels(Input) {
+		ss, given := samples[c.Name]
+		if !given {
+			ss = c.SampleExprs()
+		}
+		all[c.Name] = ss
+		fmt.Fprintln(&text, c.Type, strings.Join(ss, "\n"))
+	}
+	imps := []string{"flag"}
+	if len(h.BoundaryChannels(Output)) > 0 {
+		imps = append(imps, "fmt", "sync")
+	}
+	for _, i := range g.Imports {
+		if mentionsImport(text.String(), i) && i != "flag" && i != "fmt" && i != "sync" {
+			imps = append(imps, i)
+		}
+	}
+	sort.Strings(imps)
+	buf := &bytes.Buffer{}
+	d := struct {
+		*Graph
+		Imports []string
+		Samples map[string][]string
+	}{h, imps, all}
+	if err := scratchMainTemplate.Execute(buf, d); err != nil {
+		return err
+	}
+	if err := gofmt(w, bytes.NewReader(buf.Bytes())); err != nil {
+		// Most likely a sample isn't an expression.
+		return fmt.Errorf("invalid samples: %v", err)
+	}
+	return nil
+}
+
+// RunScratch runs a node by itself (see Scratch), with samples sent to the
+// channels it reads (see WriteScratchMainTo), and prints what it sends to stdout. Compile errors and
+// anything else the node writes go to stderr.
+func (g *Graph) RunScratch(ctx context.Context, node string, samples map[string][]string, stdout, stderr io.Writer) error {
+	h, err := g.Scratch(node)
+	if err != nil {
+		return err
+	}
+	var gen, main bytes.Buffer
+	if err := h.WriteGoTo(&gen); err != nil {
+		return err
+	}
+	if err := g.WriteScratchMainTo(&main, node, samples); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "shenzhen-go-scratch")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "generated.go"), gen.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), main.Bytes(), 0644); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, `go`, `run`, `generated.go`, `main.go`)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, stdout, stderr
+	return cmd.Run()
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestScratch(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 4, "c": 0}, map[string]string{
+		"gen":   "a <- 1; close(a)",
+		"relay": "for x := range a { b <- x }",
+		"sink":  "for range b {}; for range c {}",
+	})
+	g.Imports = []string{"fmt"}
+	h, err := g.Scratch("relay")
+	if err != nil {
+		t.Fatalf("Scratch(relay) = %v", err)
+	}
+	if got := len(h.Nodes); got != 1 {
+		t.Errorf("Scratch(relay) has %d nodes, want 1", got)
+	}
+	for c, want := range map[string]string{"a": Input, "b": Output} {
+		if ch := h.Channels[c]; ch == nil || ch.Boundary != want {
+			t.Errorf("Scratch(relay).Channels[%q] = %+v, want boundary %q", c, ch, want)
+		}
+	}
+	if _, found := h.Channels["c"]; found {
+		t.Errorf("Scratch(relay) has channel c, which relay doesn't use")
+	}
+	if h.Imports != nil {
+		t.Errorf("Scratch(relay).Imports = %v, want none (relay doesn't use fmt)", h.Imports)
+	}
+	// Run closes b, which relay doesn't.
+	if got := h.AutoClosed(); len(got) != 1 || got[0] != "b" {
+		t.Errorf("Scratch(relay).AutoClosed() = %v, want [b]", got)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteScratchMainTo(&buf, "relay", map[string][]string{"a": {"1", "2 + 3"}}); err != nil {
+		t.Fatalf("WriteScratchMainTo = %v", err)
+	}
+	for _, want := range []string{
+		"a := make(chan int, 2)",
+		"range []int{1, 2 + 3}",
+		`fmt.Println("b:", x)`,
+		"Run(a, b)",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteScratchMainTo wrote:\n%s\nwant it to contain %q", buf.String(), want)
+		}
+	}
+	if err := g.WriteScratchMainTo(&buf, "relay", map[string][]string{"b": {"1"}}); err == nil {
+		t.Errorf("WriteScratchMainTo with samples for an output = nil, want an error")
+	}
+	if err := g.WriteScratchMainTo(&buf, "relay", map[string][]string{"a": {"1 +"}}); err == nil {
+		t.Errorf("WriteScratchMainTo with an invalid sample = nil, want an error")
+	}
+	if _, err := g.Scratch("nope"); err == nil {
+		t.Errorf("Scratch(nope) = nil error, want an error")
+	}
+}
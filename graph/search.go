@@ -0,0 +1,61 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Match is a search result.
+type Match struct {
+	Node    string // Name of the node matched, if a node matched.
+	Channel string // Name of the channel matched, if a channel matched.
+	Field   string // Which part matched: "name", "code", or "type".
+	Line    int    // For code, the line number of the match (from 1).
+	Text    string // The matching line or value.
+}
+
+// SearchRegexp returns a regexp for finding q as literal text, ignoring case.
+func SearchRegexp(q string) *regexp.Regexp {
+	return regexp.MustCompile("(?i)" + regexp.QuoteMeta(q))
+}
+
+// Search finds nodes whose name or implementation matches re, and channels
+// whose name or type matches re. Nodes come first, then channels, each in
+// name order.
+func (g *Graph) Search(re *regexp.Regexp) []Match {
+	var ms []Match
+	for _, nn := range g.nodeNames() {
+		if re.MatchString(nn) {
+			ms = append(ms, Match{Node: nn, Field: "name", Text: nn})
+		}
+		for i, l := range strings.Split(g.Nodes[nn].Impl(), "\n") {
+			l = strings.TrimSuffix(l, "\r")
+			if re.MatchString(l) {
+				ms = append(ms, Match{Node: nn, Field: "code", Line: i + 1, Text: l})
+			}
+		}
+	}
+	for _, cn := range g.channelNames() {
+		if re.MatchString(cn) {
+			ms = append(ms, Match{Channel: cn, Field: "name", Text: cn})
+		}
+		if t := g.Channels[cn].Type; re.MatchString(t) {
+			ms = append(ms, Match{Channel: cn, Field: "type", Text: t})
+		}
+	}
+	return ms
+}
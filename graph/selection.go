@@ -0,0 +1,224 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NodesNamed returns the named nodes, or an error if any don't exist.
+func (g *Graph) NodesNamed(names []string) ([]*Node, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no nodes given")
+	}
+	ns := make([]*Node, 0, len(names))
+	for _, nn := range names {
+		n, found := g.Nodes[nn]
+		if !found {
+			return nil, fmt.Errorf("no node %q", nn)
+		}
+		ns = append(ns, n)
+	}
+	return ns, nil
+}
+
+// ExtractPlan is how extracting nodes into a subgraph would rewire the
+// channels they use.
+type ExtractPlan struct {
+	// Inputs are channels the rest of the graph writes and the nodes only
+	// read, and Outputs are channels the nodes only write. Both become
+	// boundary channels of the new graph.
+	Inputs, Outputs []string
+
+	// Bound are other channels shared with the rest of the graph, which the
+	// new graph both reads and writes.
+	Bound []string
+
+	// Internal are channels only the nodes use, which move into the new
+	// graph.
+	Internal []string
+}
+
+// PreviewExtract returns how Extract would rewire the channels of the named
+// nodes, without changing anything.
+func (g *Graph) PreviewExtract(names []string) (*ExtractPlan, error) {
+	ns, err := g.NodesNamed(names)
+	if err != nil {
+		return nil, err
+	}
+	inside := make(map[string]bool, len(ns))
+	for _, nn := range names {
+		inside[nn] = true
+	}
+	outside := make(map[string]bool)
+	for cn, c := range g.Channels {
+		if c.Boundary != "" {
+			outside[cn] = true
+		}
+	}
+	for nn, n := range g.Nodes {
+		if inside[nn] {
+			continue
+		}
+		for _, c := range append(n.ChannelsRead(), n.ChannelsWritten()...) {
+			outside[c] = true
+		}
+	}
+	read, written := make(map[string]bool), make(map[string]bool)
+	var used []string
+	for _, n := range ns {
+		for _, c := range g.DeclaredChannels(n.ChannelsRead()) {
+			read[c] = true
+		}
+		for _, c := range g.DeclaredChannels(n.ChannelsWritten()) {
+			written[c] = true
+		}
+		used = append(used, g.DeclaredChannels(append(n.ChannelsRead(), n.ChannelsWritten()...))...)
+	}
+	sort.Strings(used)
+	p := new(ExtractPlan)
+	for i, c := range used {
+		if i > 0 && used[i-1] == c {
+			continue
+		}
+		switch {
+		case !outside[c]:
+			p.Internal = append(p.Internal, c)
+		case !written[c]:
+			p.Inputs = append(p.Inputs, c)
+		case !read[c]:
+			p.Outputs = append(p.Outputs, c)
+		default:
+			p.Bound = append(p.Bound, c)
+		}
+	}
+	return p, nil
+}
+
+// Extract moves the named nodes into a new graph, saved at file (relative to
+// g), and replaces them with a Subgraph node running it: the pipeline
+// equivalent of extracting a function. Channels are rewired as described by
+// PreviewExtract; channels still used by the rest of the graph are bound to
+// the inner graph's channels of the same name. The new node is called name,
+// or is named after the file if name is empty, and is pinned where the pinned
+// nodes were on average. An existing file is never overwritten.
+func (g *Graph) Extract(names []string, file, name string) (*Node, error) {
+	ns, err := g.NodesNamed(names)
+	if err != nil {
+		return nil, err
+	}
+	if file == "" {
+		return nil, fmt.Errorf("no graph file given")
+	}
+	base := strings.TrimSuffix(path.Base(filepath.ToSlash(file)), ".szgo")
+	if name == "" {
+		name = base
+	}
+	if _, found := g.Nodes[name]; found && !contains(names, name) {
+		return nil, fmt.Errorf("node %q already exists", name)
+	}
+	plan, err := g.PreviewExtract(names)
+	if err != nil {
+		return nil, err
+	}
+	f, err := g.Fragment(names, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	inner := &Graph{
+		Name:         base,
+		PackagePath:  g.PackagePath + "/" + base,
+		Imports:      f.Imports,
+		Params:       g.Params,
+		Declarations: g.Declarations,
+		Nodes:        f.Nodes,
+		Channels:     f.Channels,
+		Groups:       f.Groups,
+	}
+	if inner.Imports == nil {
+		inner.Imports = []string{}
+	}
+	sg := &Subgraph{
+		Path:     filepath.ToSlash(file),
+		Bindings: make(map[string]string),
+	}
+	bind := func(cs []string, boundary string) {
+		for _, c := range cs {
+			sg.Bindings[c] = c
+			inner.Channels[c].Boundary = boundary
+		}
+	}
+	bind(plan.Inputs, Input)
+	bind(plan.Outputs, Output)
+	bind(plan.Bound, "")
+
+	// Write the inner graph before changing anything, never overwriting.
+	fp := file
+	if !filepath.IsAbs(fp) {
+		fp = filepath.Join(filepath.Dir(g.SourcePath), fp)
+	}
+	out, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := inner.WriteJSONTo(out); err != nil {
+		out.Close()
+		os.Remove(fp)
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(fp)
+		return nil, err
+	}
+
+	n := &Node{
+		Part:         sg,
+		Name:         name,
+		Multiplicity: 1,
+		Group:        ns[0].Group,
+	}
+	var pos Position
+	pinned := 0
+	for _, m := range ns {
+		n.Wait = n.Wait || m.Wait
+		if m.Group != n.Group {
+			n.Group = ""
+		}
+		if m.Pos != nil {
+			pos.X += m.Pos.X
+			pos.Y += m.Pos.Y
+			pinned++
+		}
+	}
+	if pinned > 0 {
+		n.Pos = &Position{X: pos.X / float64(pinned), Y: pos.Y / float64(pinned)}
+	}
+	for _, c := range plan.Internal {
+		delete(g.Channels, c)
+	}
+	for _, nn := range names {
+		delete(g.Nodes, nn)
+		g.ReattachComments(nn, name)
+	}
+	g.Nodes[name] = n
+	g.LoadSubgraphs()
+	return n, nil
+}
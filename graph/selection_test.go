@@ -0,0 +1,120 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0, "c": 0}, map[string]string{
+		"gen":    "a <- 1; close(a)",
+		"relay":  "for x := range a { b <- x }; close(b)",
+		"filter": "for x := range b { if x > 0 { c <- x } }; close(c)",
+		"sink":   "for range c {}",
+	})
+	g.SourcePath = filepath.Join(t.TempDir(), "outer.szgo")
+	g.Comments = map[string]*Comment{"note": {Name: "note", Text: "hi", Node: "relay"}}
+	g.Nodes["relay"].Pos = &Position{X: 10, Y: 100}
+	g.Nodes["filter"].Pos = &Position{X: 30, Y: 50}
+
+	n, err := g.Extract([]string{"relay", "filter"}, "middle.szgo", "")
+	if err != nil {
+		t.Fatalf("Extract = %v", err)
+	}
+	if n.Name != "middle" || g.Nodes["middle"] != n {
+		t.Errorf("Extract made node %q, want middle in the graph", n.Name)
+	}
+	if _, found := g.Nodes["relay"]; found {
+		t.Error("relay still in graph after Extract")
+	}
+	if _, found := g.Channels["b"]; found {
+		t.Error("channel b still in graph after Extract, but only the extracted nodes use it")
+	}
+	if want := (&Position{X: 20, Y: 75}); !reflect.DeepEqual(n.Pos, want) {
+		t.Errorf("new node Pos = %v, want %v", n.Pos, want)
+	}
+	if got := g.Comments["note"].Node; got != "middle" {
+		t.Errorf("comment attached to %q, want middle", got)
+	}
+
+	s, ok := n.Part.(*Subgraph)
+	if !ok || s.inner == nil {
+		t.Fatalf("Extract made a %T, want a loaded Subgraph", n.Part)
+	}
+	if want := map[string]string{"a": "a", "c": "c"}; !reflect.DeepEqual(s.Bindings, want) {
+		t.Errorf("Bindings = %v, want %v", s.Bindings, want)
+	}
+	if got := s.inner.Channels["a"].Boundary; got != Input {
+		t.Errorf("inner channel a is %q, want input", got)
+	}
+	if got := s.inner.Channels["c"].Boundary; got != Output {
+		t.Errorf("inner channel c is %q, want output", got)
+	}
+	if got := len(s.inner.Nodes); got != 2 {
+		t.Errorf("inner graph has %d nodes, want 2", got)
+	}
+	r, w := n.Channels()
+	if want := []string{"a"}; !reflect.DeepEqual(r, want) {
+		t.Errorf("Channels() read = %v, want %v", r, want)
+	}
+	if want := []string{"c"}; !reflect.DeepEqual(w, want) {
+		t.Errorf("Channels() written = %v, want %v", w, want)
+	}
+	var buf bytes.Buffer
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo after Extract = %v", err)
+	}
+	if !strings.Contains(buf.String(), "// Subgraph middle.szgo") {
+		t.Errorf("generated code doesn't run the subgraph:\n%s", buf.String())
+	}
+
+	// The file exists now, so it isn't overwritten.
+	if _, err := g.Extract([]string{"gen"}, "middle.szgo", ""); err == nil {
+		t.Error("Extract to an existing file succeeded")
+	}
+	if _, found := g.Nodes["gen"]; !found {
+		t.Error("gen removed by a failed Extract")
+	}
+}
+
+func TestPreviewExtract(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0, "c": 0, "d": 0}, map[string]string{
+		"gen":   "a <- 1; close(a)",
+		"relay": "for x := range a { b <- x; d <- x }; close(b); close(d)",
+		"loop":  "for x := range b { if x > 0 { c <- x } }; for range d {}",
+		"back":  "for x := range c { d <- x }",
+	})
+	got, err := g.PreviewExtract([]string{"relay", "loop"})
+	if err != nil {
+		t.Fatalf("PreviewExtract = %v", err)
+	}
+	want := &ExtractPlan{
+		Inputs:   []string{"a"},
+		Outputs:  []string{"c"},
+		Bound:    []string{"d"},
+		Internal: []string{"b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PreviewExtract = %+v, want %+v", got, want)
+	}
+	if _, err := g.PreviewExtract([]string{"nope"}); err == nil {
+		t.Error("PreviewExtract(nope) succeeded")
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// Kinds of SimEvent.
+const (
+	SimSend    = "send"    // Node sent Value to Channel.
+	SimReceive = "receive" // Node received Value from Channel.
+	SimClose   = "close"   // Node closed Channel.
+	SimOutput  = "output"  // Node printed Value.
+	SimBlocked = "blocked" // Node is waiting to do Value, e.g. "send to raw".
+	SimRunning = "running" // Node stopped waiting.
+)
+
+// SimEvent is something that happened in a simulation. Node is empty for
+// things Run would do, such as closing auto-closed channels, and for
+// receives from outputs of the graph.
+type SimEvent struct {
+	Kind    string `json:"kind"`
+	Node    string `json:"node,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Waiting int    `json:"waiting"` // Values buffered in Channel afterwards.
+}
+
+// simSteps is how many statements a simulation may execute, so that
+// something like a generator without an end doesn't run forever.
+const simSteps = 1000000
+
+// Simulate runs the graph without building it, by interpreting each
+// goroutine's code (see source.Machine), and reports what happens to event.
+// It pauses for delay after each send and receive, so the flow of values
+// can be watched. Only simple code can be simulated, and channels behave as
+// ordinary buffered channels: overflow policies, priorities, journals and
+// remote addresses are ignored. Inputs of the graph are sent the values of
+// their fixtures (if any) and closed, and outputs are drained. Simulate returns when Run would, or at the first problem,
+// such as code it can't simulate or every goroutine being blocked.
+func (g *Graph) Simulate(ctx context.Context, delay time.Duration, event func(SimEvent)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := &simulation{
+		ctx:     ctx,
+		cancel:  cancel,
+		delay:   delay,
+		event:   event,
+		steps:   simSteps,
+		chans:   make(map[string]*source.Chan, len(g.Channels)),
+		blocked: make(map[int]string),
+	}
+	consts := make(map[string]interface{})
+	for _, p := range g.Params {
+		if p.Kind != "const" {
+			continue
+		}
+		m := &source.Machine{Ctx: ctx, Steps: &s.steps}
+		v, err := m.Eval(p.Default, consts)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %v", p.Name, err)
+		}
+		consts[p.Name] = v
+	}
+	for _, cn := range g.channelNames() {
+		c := g.Channels[cn]
+		if c.Cap > source.MaxMake {
+			return fmt.Errorf("channel %s: capacity %d is too big to simulate", cn, c.Cap)
+		}
+		ch := &source.Chan{Name: cn, C: make(chan interface{}, c.Cap)}
+		s.chans[cn] = ch
+		switch c.Boundary {
+		case Input:
+			var vs []interface{}
+			for i, e := range c.SampleExprs() {
+				m := &source.Machine{Ctx: ctx, Steps: &s.steps}
+				v, err := m.Eval(e, consts)
+				if err != nil {
+					return fmt.Errorf("channel %s sample %d: %v", cn, i+1, err)
+				}
+				vs = append(vs, v)
+			}
+			go s.feed(ch, vs)
+		case Output:
+			go s.drain(ch)
+		}
+	}
+
+	// Count writers of the channels Run closes, and the goroutines it waits
+	// for.
+	writers := make(map[string]int)
+	waited := 0
+	type instance struct {
+		node   *Node
+		code   string
+		number int // -1 without multiplicity
+	}
+	var insts []instance
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		code := n.Impl()
+		if n.Disabled {
+			code = g.BridgeImpl(n)
+		}
+		if code == "" {
+			continue
+		}
+		if n.Multiplicity <= 1 {
+			insts = append(insts, instance{n, code, -1})
+		}
+		for i := 0; n.Multiplicity > 1 && i < int(n.Multiplicity); i++ {
+			insts = append(insts, instance{n, code, i})
+		}
+	}
+	for _, in := range insts {
+		for _, c := range g.AutoCloses(in.node) {
+			writers[c]++
+		}
+		if g.Waited(in.node) {
+			waited++
+		}
+	}
+	if waited == 0 {
+		// Run returns straight away.
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for _, in := range insts {
+		in := in
+		vars := make(map[string]interface{}, len(s.chans)+len(consts)+1)
+		for k, v := range consts {
+			vars[k] = v
+		}
+		for k, c := range s.chans {
+			vars[k] = c
+		}
+		if in.number >= 0 {
+			vars["instanceNumber"] = in.number
+		}
+		isWaited := g.Waited(in.node)
+		closes := g.AutoCloses(in.node)
+		m := s.machine(in.node.Name, &wg)
+		s.start(&wg, func() error {
+			err := m.Run(in.code, vars)
+			if err != nil && ctx.Err() == nil {
+				err = fmt.Errorf("%s: %v", in.node.Name, err)
+			}
+			for _, c := range closes {
+				s.mu.Lock()
+				writers[c]--
+				last := writers[c] == 0
+				s.mu.Unlock()
+				if last && ctx.Err() == nil {
+					close(s.chans[c].C)
+					s.emit(SimEvent{Kind: SimClose, Channel: c})
+				}
+			}
+			if isWaited {
+				s.mu.Lock()
+				waited--
+				if waited == 0 {
+					s.finished = true
+					cancel()
+				}
+				s.mu.Unlock()
+			}
+			return err
+		})
+	}
+	go s.watch()
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil && !s.finished {
+		return ctx.Err()
+	}
+	return s.err
+}
+
+// simulation is the state of Simulate.
+type simulation struct {
+	ctx    context.Context
+	cancel func()
+	delay  time.Duration
+	event  func(SimEvent)
+	steps  int64
+	chans  map[string]*source.Chan
+
+	mu       sync.Mutex
+	alive    int            // goroutines running
+	blocked  map[int]string // operations goroutines are blocked on
+	nextOp   int
+	progress int // incremented by each event
+	finished bool
+	err      error
+}
+
+func (s *simulation) emit(e SimEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return
+	}
+	if c := s.chans[e.Channel]; c != nil {
+		e.Waiting = len(c.C)
+	}
+	s.progress++
+	s.event(e)
+}
+
+// pause waits for the delay, unless the simulation ends first.
+func (s *simulation) pause() {
+	t := time.NewTimer(s.delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-s.ctx.Done():
+	}
+}
+
+// fail records the first error, and ends the simulation.
+func (s *simulation) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil && !s.finished {
+		s.err = err
+	}
+	s.cancel()
+}
+
+// start runs f as a goroutine of the simulation.
+func (s *simulation) start(wg *sync.WaitGroup, f func() error) {
+	s.mu.Lock()
+	s.alive++
+	s.mu.Unlock()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := f()
+		s.mu.Lock()
+		s.alive--
+		s.mu.Unlock()
+		if err != nil && s.ctx.Err() == nil {
+			s.fail(err)
+		}
+	}()
+}
+
+// machine returns a Machine which reports events for the node.
+func (s *simulation) machine(node string, wg *sync.WaitGroup) *source.Machine {
+	m := &source.Machine{
+		Ctx:   s.ctx,
+		Steps: &s.steps,
+		Print: func(v string) {
+			s.emit(SimEvent{Kind: SimOutput, Node: node, Value: v})
+		},
+		Sent: func(c *source.Chan, v interface{}) {
+			if c.Name == "" {
+				return
+			}
+			s.emit(SimEvent{Kind: SimSend, Node: node, Channel: c.Name, Value: fmt.Sprint(v)})
+			s.pause()
+		},
+		Received: func(c *source.Chan, v interface{}, ok bool) {
+			if c.Name == "" || !ok {
+				return
+			}
+			s.emit(SimEvent{Kind: SimReceive, Node: node, Channel: c.Name, Value: fmt.Sprint(v)})
+			s.pause()
+		},
+		Closed: func(c *source.Chan) {
+			if c.Name != "" {
+				s.emit(SimEvent{Kind: SimClose, Node: node, Channel: c.Name})
+			}
+		},
+		Block: func(op string) func() {
+			s.mu.Lock()
+			id := s.nextOp
+			s.nextOp++
+			s.blocked[id] = node + ": " + op
+			s.mu.Unlock()
+			s.emit(SimEvent{Kind: SimBlocked, Node: node, Value: op})
+			return func() {
+				s.mu.Lock()
+				delete(s.blocked, id)
+				s.mu.Unlock()
+				s.emit(SimEvent{Kind: SimRunning, Node: node})
+			}
+		},
+	}
+	m.Go = func(f func() error) {
+		s.start(wg, func() error {
+			if err := f(); err != nil {
+				return fmt.Errorf("%s: %v", node, err)
+			}
+			return nil
+		})
+	}
+	return m
+}
+
+// feed sends values to an input of the graph, then closes it.
+func (s *simulation) feed(c *source.Chan, vs []interface{}) {
+	defer close(c.C)
+	for _, v := range vs {
+		select {
+		case c.C <- v:
+			s.emit(SimEvent{Kind: SimSend, Channel: c.Name, Value: fmt.Sprint(v)})
+			s.pause()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// drain receives from an output of the graph until it is closed.
+func (s *simulation) drain(c *source.Chan) {
+	for {
+		select {
+		case v, ok := <-c.C:
+			if !ok {
+				return
+			}
+			s.emit(SimEvent{Kind: SimReceive, Channel: c.Name, Value: fmt.Sprint(v)})
+			s.pause()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// watch reports a deadlock when every goroutine has been blocked for a
+// while without anything happening.
+func (s *simulation) watch() {
+	const ticks = 5
+	t := time.NewTicker(20 * time.Millisecond)
+	defer t.Stop()
+	still, last := 0, -1
+	for {
+		select {
+		case <-t.C:
+		case <-s.ctx.Done():
+			return
+		}
+		s.mu.Lock()
+		stuck := s.alive > 0 && len(s.blocked) >= s.alive && s.progress == last
+		last = s.progress
+		var ops []string
+		for _, op := range s.blocked {
+			ops = append(ops, op)
+		}
+		s.mu.Unlock()
+		if !stuck {
+			still = 0
+			continue
+		}
+		if still++; still < ticks {
+			continue
+		}
+		sort.Strings(ops)
+		s.fail(fmt.Errorf("deadlock: every goroutine is blocked (%s)", strings.Join(ops, "; ")))
+		return
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func simulate(t *testing.T, g *Graph) (output string, events []SimEvent, err error) {
+	t.Helper()
+	var b strings.Builder
+	err = g.Simulate(context.Background(), 0, func(e SimEvent) {
+		events = append(events, e)
+		if e.Kind == SimOutput {
+			b.WriteString(e.Value)
+		}
+	})
+	return b.String(), events, err
+}
+
+func TestSimulate(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 2, "b": 0}, map[string]string{
+		"gen":   "for i := 1; i <= 4; i++ { a <- i * 10 }",
+		"relay": "for x := range a { b <- x }; close(b)",
+		"sink":  "for x := range b { fmt.Println(x) }",
+	})
+	g.Termination = WaitSinks
+	out, events, err := simulate(t, g)
+	if err != nil {
+		t.Fatalf("Simulate() = %v", err)
+	}
+	if want := "10\n20\n30\n40\n"; out != want {
+		t.Errorf("Simulate() printed %q, want %q", out, want)
+	}
+	// Run closes a, since nothing else does.
+	closed := false
+	for _, e := range events {
+		if e.Kind == SimClose && e.Channel == "a" && e.Node == "" {
+			closed = true
+		}
+		if e.Kind == SimSend && e.Channel == "a" && (e.Waiting < 0 || e.Waiting > 2) {
+			t.Errorf("event %+v has %d waiting in a channel of capacity 2", e, e.Waiting)
+		}
+	}
+	if !closed {
+		t.Errorf("Simulate() didn't close a; events = %+v", events)
+	}
+}
+
+func TestSimulateProblems(t *testing.T) {
+	tests := []struct {
+		code map[string]string
+		want string
+	}{
+		{
+			code: map[string]string{
+				"gen":  "a <- 1",
+				"sink": "<-a; <-a",
+			},
+			want: "deadlock: every goroutine is blocked (sink: receive from a)",
+		},
+		{
+			code: map[string]string{
+				"gen":  "a <- len(os.Args)",
+				"sink": "<-a",
+			},
+			want: "gen: 1:10: can't simulate os.Args",
+		},
+	}
+	for _, test := range tests {
+		g := testGraph(t, map[string]int{"a": 0}, test.code)
+		g.Termination = WaitAll
+		_, _, err := simulate(t, g)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Simulate(%v) = %v, want %q", test.code, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Snippets are nodes (part and all) saved for reuse across graphs, stored as
+// JSON files in the user's config directory.
+
+const snippetExt = ".json"
+
+// SnippetDir returns the directory snippets are stored in.
+func SnippetDir() (string, error) {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "shenzhen-go", "snippets"), nil
+}
+
+func snippetPath(name string) (string, error) {
+	d, err := SnippetDir()
+	if err != nil {
+		return "", err
+	}
+	// Escaping keeps names like "../x" within the directory.
+	return filepath.Join(d, url.PathEscape(name)+snippetExt), nil
+}
+
+// Snippets lists the names of all saved snippets, sorted.
+func Snippets() ([]string, error) {
+	d, err := SnippetDir()
+	if err != nil {
+		return nil, err
+	}
+	fis, err := ioutil.ReadDir(d)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ns []string
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), snippetExt) {
+			continue
+		}
+		n, err := url.PathUnescape(strings.TrimSuffix(fi.Name(), snippetExt))
+		if err != nil {
+			continue
+		}
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns, nil
+}
+
+// SaveSnippet saves a copy of a node as a snippet, replacing any existing
+// snippet with the same name.
+func SaveSnippet(name string, n *Node) error {
+	p, err := snippetPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	j, err := json.MarshalIndent(n, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, j, 0644)
+}
+
+// LoadSnippet loads a snippet as a new node.
+func LoadSnippet(name string) (*Node, error) {
+	p, err := snippetPath(name)
+	if err != nil {
+		return nil, err
+	}
+	j, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	n := new(Node)
+	if err := json.Unmarshal(j, n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+// newPart makes a part of a registered type.
+func newPart(t *testing.T, typeKey string) Part {
+	t.Helper()
+	pf, ok := parts.Lookup(typeKey)
+	if !ok {
+		t.Fatalf("part type %q is not registered", typeKey)
+	}
+	return pf().(Part)
+}
+
+func TestSpecifiedPart(t *testing.T) {
+	var spec parts.Spec
+	if err := json.Unmarshal([]byte(`{
+		"type": "TestDoubler",
+		"fields": [
+			{"name": "in", "label": "Input", "kind": "input", "required": true},
+			{"name": "out", "label": "Output", "kind": "output", "required": true},
+			{"name": "factor", "kind": "text", "pattern": "[0-9]+"}
+		],
+		"template": "for x := range {{.in}} { {{.out}} <- {{.factor}}*x }\nclose({{.out}})"
+	}`), &spec); err != nil {
+		t.Fatalf("json.Unmarshal(spec) = %v", err)
+	}
+	if err := spec.Register(); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	if err := spec.Register(); err == nil {
+		t.Error("Register() twice succeeded")
+	}
+
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"gen":  "a <- 1; close(a)",
+		"sink": "for range b {}",
+	})
+	p := newPart(t, "TestDoubler")
+	update := func(vs url.Values) error {
+		return p.Update(&http.Request{Form: vs})
+	}
+	if err := update(url.Values{"Field_in": {"a"}, "Field_factor": {"two"}}); err != nil {
+		t.Fatalf("Update() = %v", err)
+	}
+	err := p.Validate()
+	if es, ok := err.(parts.ConfigErrors); !ok || len(es) != 2 {
+		t.Errorf("Validate() = %v, want 2 ConfigErrors (for Output and factor)", err)
+	}
+	if err := update(url.Values{"Field_in": {"a"}, "Field_out": {"b"}, "Field_factor": {"2"}}); err != nil {
+		t.Fatalf("Update() = %v", err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	g.Nodes["double"] = &Node{Name: "double", Multiplicity: 1, Part: p}
+
+	var buf bytes.Buffer
+	if err := g.WriteJSONTo(&buf); err != nil {
+		t.Fatalf("WriteJSONTo() = %v", err)
+	}
+	h, err := LoadJSON(&buf, "")
+	if err != nil {
+		t.Fatalf("LoadJSON() = %v", err)
+	}
+	n := h.Nodes["double"]
+	if got, want := n.Impl(), "for x := range a { b <- 2*x }\nclose(b)"; got != want {
+		t.Errorf("Impl() = %q, want %q", got, want)
+	}
+	if err := h.RenameChannel("a", "c"); err != nil {
+		t.Fatalf("RenameChannel() = %v", err)
+	}
+	r, w := n.Channels()
+	if want := []string{"c"}; !reflect.DeepEqual(r, want) {
+		t.Errorf("Channels() read = %v, want %v", r, want)
+	}
+	if want := []string{"b"}; !reflect.DeepEqual(w, want) {
+		t.Errorf("Channels() written = %v, want %v", w, want)
+	}
+
+	var src bytes.Buffer
+	if err := h.WriteGoTo(&src); err != nil {
+		t.Fatalf("WriteGoTo() = %v", err)
+	}
+	if !strings.Contains(src.String(), "range c") {
+		t.Errorf("WriteGoTo() output lacks the part's code:\n%s", src.String())
+	}
+}
+
+func TestCheckPartVersions(t *testing.T) {
+	spec := &parts.Spec{TypeKey: "TestVersioned", Version: "1.0.0", Template: "// nothing"}
+	if err := spec.Register(); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	g := testGraph(t, nil, nil)
+	g.Nodes["v"] = &Node{Name: "v", Multiplicity: 1, Part: newPart(t, "TestVersioned")}
+
+	var buf bytes.Buffer
+	if err := g.WriteJSONTo(&buf); err != nil {
+		t.Fatalf("WriteJSONTo() = %v", err)
+	}
+	if want := `"part_version": "1.0.0"`; !strings.Contains(buf.String(), want) {
+		t.Errorf("WriteJSONTo() output lacks %s:\n%s", want, buf.String())
+	}
+	if v := g.Nodes["v"].PartVersion; v != "" {
+		t.Errorf("after WriteJSONTo(), PartVersion = %q, want it unchanged", v)
+	}
+	if ds := checkPartVersions(g); len(ds) != 0 {
+		t.Errorf("checkPartVersions() = %v, want none", ds)
+	}
+
+	spec.Version = "1.1.0"
+	h, err := LoadJSON(&buf, filepath.Join(t.TempDir(), "v.szgo"))
+	if err != nil {
+		t.Fatalf("LoadJSON() = %v", err)
+	}
+	ds := checkPartVersions(h)
+	if len(ds) != 1 || ds[0].Node != "v" {
+		t.Errorf("checkPartVersions() = %v, want a warning about v", ds)
+	}
+	if err := h.SaveJSONFile(); err != nil {
+		t.Fatalf("SaveJSONFile() = %v", err)
+	}
+	if ds := checkPartVersions(h); len(ds) != 0 {
+		t.Errorf("after SaveJSONFile(), checkPartVersions() = %v, want none", ds)
+	}
+}
+
+func TestSchematicMultiplexer(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0, "c": 0}, map[string]string{
+		"sink": "for range c {}",
+	})
+	m := new(parts.Multiplexer)
+	if err := m.Validate(); err == nil {
+		t.Error("Validate() of an empty Multiplexer succeeded")
+	}
+	form := url.Values{"Field_inputs": {"a", "b"}, "Field_output": {"c"}}
+	if err := m.Update(&http.Request{Form: form}); err != nil {
+		t.Fatalf("Update() = %v", err)
+	}
+	if err := m.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	g.Nodes["mux"] = &Node{Name: "mux", Multiplicity: 1, Part: m}
+
+	var buf bytes.Buffer
+	if err := g.WriteJSONTo(&buf); err != nil {
+		t.Fatalf("WriteJSONTo() = %v", err)
+	}
+	h, err := LoadJSON(&buf, "")
+	if err != nil {
+		t.Fatalf("LoadJSON() = %v", err)
+	}
+	r, w := h.Nodes["mux"].Channels()
+	if want := []string{"a", "b"}; !reflect.DeepEqual(r, want) {
+		t.Errorf("Channels() read = %v, want %v", r, want)
+	}
+	if want := []string{"c"}; !reflect.DeepEqual(w, want) {
+		t.Errorf("Channels() written = %v, want %v", w, want)
+	}
+}
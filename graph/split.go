@@ -0,0 +1,280 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// A Service is part of a graph split at its remote channels (see Split), to
+// run as a program of its own.
+type Service struct {
+	Name string
+
+	// Graph has the service's goroutines, with the remote channels they use
+	// as inputs and outputs. It generates package main.
+	Graph *Graph
+}
+
+// Listens returns the remote channels the service reads, whose writers
+// connect to it.
+func (s *Service) Listens() []*Channel { return s.Graph.BoundaryChannels(Input) }
+
+// Dials returns the remote channels the service writes, connecting to their
+// readers.
+func (s *Service) Dials() []*Channel { return s.Graph.BoundaryChannels(Output) }
+
+// WriteMainTo writes the rest of the service's main package: a main function
+// connecting the remote channels and calling Run.
+func (s *Service) WriteMainTo(w io.Writer) error {
+	buf := &bytes.Buffer{}
+	if err := serviceMainTemplate.Execute(buf, s); err != nil {
+		return err
+	}
+	return gofmt(w, buf)
+}
+
+// serviceName makes a name suitable for a program, and a host, from a
+// goroutine name, e.g. "Print output" becomes "print-output" and "2 step"
+// becomes "service-2-step".
+func serviceName(node string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(node) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	if b.Len() == 0 {
+		return "service"
+	}
+	if s := b.String(); s[0] < 'a' {
+		// Host names in Kubernetes must start with a letter.
+		return "service-" + s
+	}
+	return b.String()
+}
+
+// Split divides the graph into services at its remote channels. Goroutines
+// connected by other channels are in the same service, and each remote
+// channel must go from one service to another. Each service is named after
+// its first goroutine.
+func (g *Graph) Split() ([]*Service, error) {
+	remote := false
+	for _, cn := range g.channelNames() {
+		c := g.Channels[cn]
+		if c.Boundary != "" {
+			return nil, fmt.Errorf("channel %s is an %s of the graph, but split graphs can only connect to the outside with remote channels", cn, c.Boundary)
+		}
+		remote = remote || c.Remote != ""
+	}
+	if !remote {
+		return nil, errors.New("there are no remote channels to split the graph at")
+	}
+
+	// Group goroutines connected by channels other than remote ones. Each
+	// group is represented by its first goroutine.
+	group := make(map[string]string)
+	var find func(string) string
+	find = func(n string) string {
+		if group[n] == n {
+			return n
+		}
+		r := find(group[n])
+		group[n] = r
+		return r
+	}
+	union := func(a, b string) {
+		ra, rb := find(a), find(b)
+		if rb < ra {
+			ra, rb = rb, ra
+		}
+		group[rb] = ra
+	}
+	for _, nn := range g.nodeNames() {
+		rs, ws := g.activeChannels(g.Nodes[nn])
+		if len(rs)+len(ws) == 0 && g.Nodes[nn].Disabled {
+			// Disabled goroutines that don't bridge generate nothing.
+			continue
+		}
+		group[nn] = nn
+	}
+	ends := g.channelEnds()
+	for _, cn := range g.channelNames() {
+		if g.Channels[cn].Remote != "" {
+			continue
+		}
+		e := ends[cn]
+		ns := append(append([]*Node(nil), e.writers...), e.readers...)
+		for _, n := range ns {
+			union(ns[0].Name, n.Name)
+		}
+	}
+
+	// Each remote channel must connect two groups.
+	side := func(cn, what string, ns []*Node) (string, error) {
+		if len(ns) == 0 {
+			return "", fmt.Errorf("remote channel %s has no %s", cn, what)
+		}
+		r := find(ns[0].Name)
+		for _, n := range ns[1:] {
+			if o := find(n.Name); o != r {
+				return "", fmt.Errorf("remote channel %s has %s in different services (with %s and %s)", cn, what, r, o)
+			}
+		}
+		return r, nil
+	}
+	for _, cn := range g.channelNames() {
+		if g.Channels[cn].Remote == "" {
+			continue
+		}
+		w, err := side(cn, "writers", ends[cn].writers)
+		if err != nil {
+			return nil, err
+		}
+		r, err := side(cn, "readers", ends[cn].readers)
+		if err != nil {
+			return nil, err
+		}
+		if w == r {
+			return nil, fmt.Errorf("remote channel %s connects goroutines which other channels also connect, so it can't split the graph", cn)
+		}
+	}
+
+	// Make a graph for each group.
+	byRoot := make(map[string]*Service)
+	taken := make(map[string]bool)
+	var ss []*Service
+	for _, nn := range g.nodeNames() {
+		if _, found := group[nn]; !found {
+			continue
+		}
+		r := find(nn)
+		s := byRoot[r]
+		if s == nil {
+			name := serviceName(r)
+			for i := 2; taken[name]; i++ {
+				name = fmt.Sprintf("%s-%d", serviceName(r), i)
+			}
+			taken[name] = true
+			h := *g
+			h.SourcePath, h.PackagePath = "", "main"
+			h.Nodes = make(map[string]*Node)
+			h.Channels = make(map[string]*Channel)
+			h.Comments, h.Groups, h.Scenarios = nil, nil, nil
+			s = &Service{Name: name, Graph: &h}
+			byRoot[r] = s
+			ss = append(ss, s)
+		}
+		n := g.Nodes[nn]
+		s.Graph.Nodes[nn] = n
+		rs, ws := g.activeChannels(n)
+		for i, cs := range [][]string{rs, ws} {
+			for _, cn := range cs {
+				c := *g.Channels[cn]
+				if c.Remote != "" {
+					c.Boundary = Input
+					if i == 1 {
+						c.Boundary = Output
+					}
+				}
+				s.Graph.Channels[cn] = &c
+			}
+		}
+	}
+	for _, s := range ss {
+		if _, found := s.Graph.Channels[s.Graph.DeadLetters]; !found {
+			s.Graph.DeadLetters = ""
+		}
+		s.Graph.Imports = s.Graph.usedImports()
+	}
+	return ss, nil
+}
+
+// usedImports returns the imports mentioned by the goroutines, channels,
+// parameters or declarations. A service needn't use everything the whole
+// graph does, and Go doesn't allow unused imports.
+func (g *Graph) usedImports() []string {
+	var b strings.Builder
+	b.WriteString(g.Declarations)
+	for _, p := range g.Params {
+		fmt.Fprintln(&b, p.Type, p.Default)
+	}
+	for _, c := range g.Channels {
+		fmt.Fprintln(&b, c.Type, c.CapExpr, c.Priority, c.Journal)
+	}
+	text := b.String()
+	var is []string
+	for _, i := range g.Imports {
+		name := importName(i)
+		used := mentionsImport(text, i)
+		for _, n := range g.Nodes {
+			used = used || n.refersTo(name)
+		}
+		if used {
+			is = append(is, i)
+		}
+	}
+	return is
+}
+
+// mentionsImport reports whether Go source text (roughly) uses something
+// from the imported package.
+func mentionsImport(text, imp string) bool {
+	return strings.Contains(text, importName(imp)+".")
+}
+
+// checkRemotes reports remote channels that can't work.
+func checkRemotes(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	addrs := make(map[string]string)
+	remote := false
+	for _, cn := range g.channelNames() {
+		c := g.Channels[cn]
+		if c.Remote == "" {
+			continue
+		}
+		remote = true
+		if _, _, err := net.SplitHostPort(c.Remote); err != nil {
+			ds = append(ds, Diagnostic{Severity: Error, Channel: cn, Msg: fmt.Sprintf("remote address: %v", err)})
+		}
+		if o, found := addrs[c.Remote]; found {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Channel:  cn,
+				Msg:      fmt.Sprintf("has the same remote address as %s, so their readers can't run on the same host", o),
+			})
+		}
+		addrs[c.Remote] = cn
+	}
+	if !remote {
+		return nil
+	}
+	if _, err := g.Split(); err != nil {
+		ds = append(ds, Diagnostic{Severity: Error, Msg: fmt.Sprintf("can't split into services: %v", err)})
+	}
+	return ds
+}
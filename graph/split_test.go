@@ -0,0 +1,97 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 2}, map[string]string{
+		"Gen":    "for i := 0; i < 10; i++ { a <- i }; close(a)",
+		"Mid":    "for x := range a { b <- x }; close(b)",
+		"Sink 1": "for range b {}",
+	})
+	if _, err := g.Split(); err == nil {
+		t.Error("Split with no remote channels = nil error, want error")
+	}
+	g.Channels["a"].Remote = "localhost:9001"
+	g.Channels["b"].Remote = "localhost:9001"
+	ds := checkRemotes(g)
+	if len(ds) != 1 || ds[0].Channel != "b" || ds[0].Severity != Warning {
+		t.Errorf("checkRemotes = %v, want a warning for b, which shares a's address", ds)
+	}
+	g.Channels["b"].Remote = "localhost:9002"
+
+	ss, err := g.Split()
+	if err != nil {
+		t.Fatalf("Split = %v", err)
+	}
+	var names []string
+	for _, s := range ss {
+		names = append(names, s.Name)
+	}
+	if got, want := strings.Join(names, " "), "gen mid sink-1"; got != want {
+		t.Fatalf("Split services = %q, want %q", got, want)
+	}
+	mid := ss[1].Graph
+	if got := mid.Channels["a"].Boundary; got != Input {
+		t.Errorf("mid's a.Boundary = %q, want %q", got, Input)
+	}
+	if got := mid.Channels["b"].Boundary; got != Output {
+		t.Errorf("mid's b.Boundary = %q, want %q", got, Output)
+	}
+	if g.Channels["a"].Boundary != "" {
+		t.Error("Split changed the original graph's channels")
+	}
+
+	var buf bytes.Buffer
+	if err := ss[1].WriteMainTo(&buf); err != nil {
+		t.Fatalf("WriteMainTo = %v", err)
+	}
+	code := buf.String()
+	for _, want := range []string{
+		`var aAddr = flag.String("a_addr", "localhost:9001",`,
+		`transport.Listen("a", *aAddr)`,
+		`transport.Dial("b", *bAddr)`,
+		"Run(a, b)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("main doesn't contain %q:\n%s", want, code)
+		}
+	}
+	buf.Reset()
+	if err := mid.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "// Package main") {
+		t.Errorf("service code isn't package main:\n%s", buf.String())
+	}
+
+	// Another channel between Gen and Mid puts them in the same service.
+	h := testGraph(t, map[string]int{"a": 0, "c": 0}, map[string]string{
+		"Gen": "a <- 1; c <- 2",
+		"Mid": "<-a; <-c",
+	})
+	h.Channels["a"].Remote = "localhost:9001"
+	if _, err := h.Split(); err == nil {
+		t.Error("Split with a remote channel within a service = nil error, want error")
+	}
+	if ds := checkRemotes(h); len(ds) != 1 || ds[0].Severity != Error {
+		t.Errorf("checkRemotes = %v, want an error", ds)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Clone returns a deep copy of g.
+func (g *Graph) Clone() (*Graph, error) {
+	var buf bytes.Buffer
+	if err := g.WriteJSONTo(&buf); err != nil {
+		return nil, err
+	}
+	return LoadJSON(&buf, g.SourcePath)
+}
+
+// sameJSON reports whether a and b encode to the same JSON.
+func sameJSON(a, b interface{}) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(x, y)
+}
+
+// ApplyChanges makes the changes to g that turned base into staged, leaving
+// anything else in g (e.g. changes made since base was copied from it) alone.
+// Nodes, channels, comments, and groups are changed whole; graph properties
+// are copied from staged if they were changed at all.
+func (g *Graph) ApplyChanges(base, staged *Graph) {
+	for _, k := range unionKeys(base.nodeNames(), staged.nodeNames()) {
+		o, n := base.Nodes[k], staged.Nodes[k]
+		switch {
+		case n == nil:
+			delete(g.Nodes, k)
+		case o == nil || !sameJSON(o, n):
+			g.Nodes[k] = n
+		}
+	}
+	for _, k := range unionKeys(base.channelNames(), staged.channelNames()) {
+		o, n := base.Channels[k], staged.Channels[k]
+		switch {
+		case n == nil:
+			delete(g.Channels, k)
+		case o == nil || !sameJSON(o, n):
+			g.Channels[k] = n
+		}
+	}
+
+	var bk, sk []string
+	for k := range base.Comments {
+		bk = append(bk, k)
+	}
+	for k := range staged.Comments {
+		sk = append(sk, k)
+	}
+	for _, k := range unionKeys(bk, sk) {
+		o, n := base.Comments[k], staged.Comments[k]
+		switch {
+		case n == nil:
+			delete(g.Comments, k)
+		case o == nil || *o != *n:
+			if g.Comments == nil {
+				g.Comments = make(map[string]*Comment)
+			}
+			g.Comments[k] = n
+		}
+	}
+
+	bk, sk = nil, nil
+	for k := range base.Groups {
+		bk = append(bk, k)
+	}
+	for k := range staged.Groups {
+		sk = append(sk, k)
+	}
+	for _, k := range unionKeys(bk, sk) {
+		o, n := base.Groups[k], staged.Groups[k]
+		switch {
+		case n == nil:
+			delete(g.Groups, k)
+		case o == nil || *o != *n:
+			if g.Groups == nil {
+				g.Groups = make(map[string]*Group)
+			}
+			g.Groups[k] = n
+		}
+	}
+
+	if base.Name != staged.Name {
+		g.Name = staged.Name
+	}
+	if base.PackagePath != staged.PackagePath {
+		g.PackagePath = staged.PackagePath
+	}
+	if !sameJSON(base.Imports, staged.Imports) {
+		g.Imports = staged.Imports
+	}
+	if !sameJSON(base.Params, staged.Params) {
+		g.Params = staged.Params
+	}
+	if base.Declarations != staged.Declarations {
+		g.Declarations = staged.Declarations
+	}
+	if base.Termination != staged.Termination {
+		g.Termination = staged.Termination
+	}
+	if base.Logging != staged.Logging {
+		g.Logging = staged.Logging
+	}
+	if base.DeadLetters != staged.DeadLetters {
+		g.DeadLetters = staged.DeadLetters
+	}
+	if base.HideEdgeLabels != staged.HideEdgeLabels {
+		g.HideEdgeLabels = staged.HideEdgeLabels
+	}
+}
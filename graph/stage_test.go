@@ -0,0 +1,68 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"testing"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+func TestApplyChanges(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"first":  "a <- 1; close(a)",
+		"second": "for x := range a { b <- x }; close(b)",
+		"third":  "for range b {}",
+	})
+	base, err := g.Clone()
+	if err != nil {
+		t.Fatalf("Clone() = %v", err)
+	}
+	staged, err := g.Clone()
+	if err != nil {
+		t.Fatalf("Clone() = %v", err)
+	}
+
+	// Staged: change first, delete third, add a channel.
+	staged.Nodes["first"].Part.(*parts.Code).Code = "a <- 2; close(a)"
+	delete(staged.Nodes, "third")
+	staged.Channels["c"] = &Channel{Name: "c", Type: "int"}
+
+	// Meanwhile, someone else changes second and b.
+	other := &parts.Code{Code: "for x := range a { b <- x * 2 }; close(b)"}
+	if err := other.Update(nil); err != nil {
+		t.Fatalf("Code.Update(nil) = %v", err)
+	}
+	g.Nodes["second"] = &Node{Name: "second", Multiplicity: 1, Part: other}
+	g.Channels["b"].Cap = 5
+
+	g.ApplyChanges(base, staged)
+
+	if got, want := g.Nodes["first"].Impl(), "a <- 2; close(a)"; got != want {
+		t.Errorf("first = %q, want %q", got, want)
+	}
+	if g.Nodes["second"].Part != other {
+		t.Error("second was overwritten, but wasn't staged")
+	}
+	if _, found := g.Nodes["third"]; found {
+		t.Error("third still present, but was deleted")
+	}
+	if _, found := g.Channels["c"]; !found {
+		t.Error("channel c not added")
+	}
+	if got := g.Channels["b"].Cap; got != 5 {
+		t.Errorf("channel b cap = %d, want 5", got)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "strings"
+
+// Stats summarises the size and shape of a graph.
+type Stats struct {
+	Nodes     int            `json:"nodes"`
+	Channels  int            `json:"channels"`
+	CodeLines int            `json:"code_lines"` // Lines of implementation, over all nodes.
+	Parts     map[string]int `json:"parts"`      // Number of nodes using each type of part.
+
+	// The most channels read from or written to by any single node.
+	MaxFanIn      int    `json:"max_fan_in"`
+	MaxFanInNode  string `json:"max_fan_in_node"`
+	MaxFanOut     int    `json:"max_fan_out"`
+	MaxFanOutNode string `json:"max_fan_out_node"`
+
+	// LongestPath is the longest chain of nodes, each sending to the next.
+	// Cycles are counted as a single step.
+	LongestPath []string `json:"longest_path"`
+}
+
+// Stats computes statistics about the graph.
+func (g *Graph) Stats() *Stats {
+	s := &Stats{
+		Nodes:    len(g.Nodes),
+		Channels: len(g.Channels),
+		Parts:    make(map[string]int),
+	}
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		s.Parts[n.TypeKey()]++
+		if impl := strings.TrimSpace(n.Impl()); impl != "" {
+			s.CodeLines += strings.Count(impl, "\n") + 1
+		}
+		if in := len(g.DeclaredChannels(n.ChannelsRead())); in > s.MaxFanIn {
+			s.MaxFanIn, s.MaxFanInNode = in, nn
+		}
+		if out := len(g.DeclaredChannels(n.ChannelsWritten())); out > s.MaxFanOut {
+			s.MaxFanOut, s.MaxFanOutNode = out, nn
+		}
+	}
+	s.LongestPath = g.longestPath()
+	return s
+}
+
+// longestPath finds the longest path through the graph with cycles collapsed.
+func (g *Graph) longestPath() []string {
+	arcs := g.arcs()
+	comps := g.components()
+	compOf := make(map[string]int, len(g.Nodes))
+	for i, c := range comps {
+		for _, n := range c {
+			compOf[n.Name] = i
+		}
+	}
+
+	// Components come in reverse topological order, so every component's
+	// successors are handled before it.
+	length := make([]int, len(comps))
+	next := make([]int, len(comps))
+	best := -1
+	for i, c := range comps {
+		length[i], next[i] = 1, -1
+		for _, n := range c {
+			for _, a := range arcs[n.Name] {
+				j := compOf[a.to.Name]
+				if j != i && length[j]+1 > length[i] {
+					length[i], next[i] = length[j]+1, j
+				}
+			}
+		}
+		if best < 0 || length[i] > length[best] {
+			best = i
+		}
+	}
+
+	var path []string
+	for i := best; i >= 0; i = next[i] {
+		// Name the component by its alphabetically first node.
+		name := comps[i][0].Name
+		for _, n := range comps[i] {
+			if n.Name < name {
+				name = n.Name
+			}
+		}
+		path = append(path, name)
+	}
+	return path
+}
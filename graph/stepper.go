@@ -0,0 +1,294 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Kinds of Move.
+const (
+	MoveSend    = "send"    // From puts a token in the channel's buffer.
+	MoveReceive = "receive" // To takes a token from the channel's buffer.
+	MoveHandoff = "handoff" // From gives a token straight to To.
+)
+
+// Move is one delivery in a Stepper.
+type Move struct {
+	Kind     string
+	From, To string // Names of the goroutines sending and receiving.
+	Channel  string
+}
+
+func (m Move) String() string {
+	switch m.Kind {
+	case MoveSend:
+		return fmt.Sprintf("%s sends a token into the buffer of %s", m.From, m.Channel)
+	case MoveReceive:
+		return fmt.Sprintf("%s receives a token from the buffer of %s", m.To, m.Channel)
+	}
+	return fmt.Sprintf("%s hands a token to %s through %s", m.From, m.To, m.Channel)
+}
+
+// StepProc is a goroutine in a Stepper.
+type StepProc struct {
+	Name    string // The node name, with the instance number if it has several.
+	Node    string
+	Holding bool // Whether it has a token to send.
+	Done    bool
+
+	reads, writes []string
+	pending       []string // Where the token held is still to be sent.
+	left          int      // Tokens a source has still to make.
+}
+
+// StepChan is a channel in a Stepper.
+type StepChan struct {
+	Name   string
+	Cap    int
+	Tokens int // Tokens in the buffer.
+	Closed bool
+
+	writers int // Writers which haven't finished.
+}
+
+// Stepper simulates the topology of a graph, for teaching: the code is
+// ignored, and tokens move one delivery at a time, so blocking, buffering and
+// deadlock can be seen. Each goroutine behaves as though it received a token
+// from any channel it reads, sent it to each channel it writes in turn, and
+// finished once its inputs were closed and empty, closing its outputs when
+// the last writer finishes. Goroutines which read nothing (and inputs of the
+// graph) make a fixed number of tokens, except that inputs with fixtures
+// make one for each sample value; outputs of the graph always receive.
+type Stepper struct {
+	Procs []*StepProc // In name order.
+	Chans []*StepChan // In name order.
+	Steps int
+
+	chans map[string]*StepChan
+}
+
+// NewStepper returns a Stepper for the graph in its initial state, where
+// each source will make the given number of tokens.
+func (g *Graph) NewStepper(tokens int) *Stepper {
+	s := &Stepper{chans: make(map[string]*StepChan, len(g.Channels))}
+	add := func(p *StepProc) {
+		if len(p.reads) == 0 {
+			p.left = tokens
+		}
+		for _, c := range p.writes {
+			s.chans[c].writers++
+		}
+		s.Procs = append(s.Procs, p)
+	}
+	for _, cn := range g.channelNames() {
+		c := &StepChan{Name: cn, Cap: g.Channels[cn].Cap}
+		s.chans[cn] = c
+		s.Chans = append(s.Chans, c)
+	}
+	for _, cn := range g.channelNames() {
+		switch g.Channels[cn].Boundary {
+		case Input:
+			p := &StepProc{Name: "input " + cn, writes: []string{cn}}
+			add(p)
+			if g.Channels[cn].Fixture != nil {
+				p.left = len(g.Channels[cn].SampleExprs())
+			}
+		case Output:
+			add(&StepProc{Name: "output " + cn, reads: []string{cn}})
+		}
+	}
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		rs, ws := g.activeChannels(n)
+		if len(rs) == 0 && len(ws) == 0 {
+			continue
+		}
+		if n.Multiplicity <= 1 {
+			add(&StepProc{Name: nn, Node: nn, reads: rs, writes: ws})
+		}
+		for i := 0; n.Multiplicity > 1 && i < int(n.Multiplicity); i++ {
+			add(&StepProc{Name: fmt.Sprintf("%s #%d", nn, i), Node: nn, reads: rs, writes: ws})
+		}
+	}
+	sort.Slice(s.Procs, func(i, j int) bool { return s.Procs[i].Name < s.Procs[j].Name })
+	s.settle()
+	return s
+}
+
+// settle makes tokens at sources and finishes goroutines which can, until
+// nothing changes.
+func (s *Stepper) settle() {
+	for changed := true; changed; {
+		changed = false
+		for _, p := range s.Procs {
+			if p.Done || p.Holding {
+				continue
+			}
+			if len(p.reads) == 0 && p.left > 0 {
+				p.left--
+				p.hold()
+				changed = true
+				continue
+			}
+			if s.drained(p) {
+				p.Done = true
+				for _, c := range p.writes {
+					ch := s.chans[c]
+					ch.writers--
+					ch.Closed = ch.writers == 0
+				}
+				changed = true
+			}
+		}
+	}
+}
+
+// drained reports whether everything p reads is closed and empty.
+func (s *Stepper) drained(p *StepProc) bool {
+	for _, c := range p.reads {
+		if ch := s.chans[c]; !ch.Closed || ch.Tokens > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hold gives p a token to send to its outputs, if it has any.
+func (p *StepProc) hold() {
+	p.pending = p.writes
+	p.Holding = len(p.pending) > 0
+}
+
+// sent records that p sent its token to the next output.
+func (p *StepProc) sent() {
+	p.pending = p.pending[1:]
+	p.Holding = len(p.pending) > 0
+}
+
+// Sending returns the channel p is trying to send to, or "".
+func (p *StepProc) Sending() string {
+	if !p.Holding {
+		return ""
+	}
+	return p.pending[0]
+}
+
+// Receiving returns the channels p is trying to receive from.
+func (p *StepProc) Receiving() []string {
+	if p.Done || p.Holding {
+		return nil
+	}
+	return p.reads
+}
+
+// Moves returns the deliveries that could happen next: sends to buffers
+// with room, receives from buffers with tokens, and handoffs between a
+// sender and a receiver of an unbuffered channel.
+func (s *Stepper) Moves() []Move {
+	var ms []Move
+	for _, p := range s.Procs {
+		if c := p.Sending(); c != "" && s.chans[c].Tokens < s.chans[c].Cap {
+			ms = append(ms, Move{Kind: MoveSend, From: p.Name, Channel: c})
+		}
+		for _, c := range p.Receiving() {
+			if s.chans[c].Tokens > 0 {
+				ms = append(ms, Move{Kind: MoveReceive, To: p.Name, Channel: c})
+			}
+		}
+	}
+	for _, w := range s.Procs {
+		c := w.Sending()
+		if c == "" || s.chans[c].Cap > 0 {
+			continue
+		}
+		for _, r := range s.Procs {
+			if r == w {
+				continue
+			}
+			for _, rc := range r.Receiving() {
+				if rc == c {
+					ms = append(ms, Move{Kind: MoveHandoff, From: w.Name, To: r.Name, Channel: c})
+				}
+			}
+		}
+	}
+	return ms
+}
+
+// Step makes the i-th of the Moves.
+func (s *Stepper) Step(i int) error {
+	ms := s.Moves()
+	if i < 0 || i >= len(ms) {
+		return fmt.Errorf("there is no move %d (there are %d)", i, len(ms))
+	}
+	m := ms[i]
+	c := s.chans[m.Channel]
+	switch m.Kind {
+	case MoveSend:
+		c.Tokens++
+	case MoveReceive:
+		c.Tokens--
+	}
+	if m.From != "" {
+		s.proc(m.From).sent()
+	}
+	if m.To != "" {
+		s.proc(m.To).hold()
+	}
+	s.Steps++
+	s.settle()
+	return nil
+}
+
+func (s *Stepper) proc(name string) *StepProc {
+	for _, p := range s.Procs {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Finished reports whether every goroutine has finished.
+func (s *Stepper) Finished() bool {
+	for _, p := range s.Procs {
+		if !p.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// Deadlocked reports whether no move can be made, but some goroutines
+// haven't finished.
+func (s *Stepper) Deadlocked() bool {
+	return len(s.Moves()) == 0 && !s.Finished()
+}
+
+// Blocked reports whether p is waiting for something, and nothing it waits
+// for can happen next.
+func (s *Stepper) Blocked(p *StepProc) bool {
+	if p.Done {
+		return false
+	}
+	for _, m := range s.Moves() {
+		if m.From == p.Name || m.To == p.Name {
+			return false
+		}
+	}
+	return true
+}
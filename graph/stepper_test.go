@@ -0,0 +1,85 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStepper(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 1, "b": 0}, map[string]string{
+		"gen":   "a <- 1",
+		"relay": "for x := range a { b <- x }",
+		"sink":  "for range b {}",
+	})
+	s := g.NewStepper(2)
+	want := []Move{{Kind: MoveSend, From: "gen", Channel: "a"}}
+	if got := s.Moves(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("initial Moves() = %v, want %v", got, want)
+	}
+	if err := s.Step(0); err != nil {
+		t.Fatalf("Step(0) = %v", err)
+	}
+	// The buffer is full, so gen is blocked with its second token.
+	if !s.Blocked(s.proc("gen")) {
+		t.Errorf("gen isn't blocked with a full buffer")
+	}
+	want = []Move{{Kind: MoveReceive, To: "relay", Channel: "a"}}
+	if got := s.Moves(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Moves() after send = %v, want %v", got, want)
+	}
+	if err := s.Step(0); err != nil {
+		t.Fatalf("Step(0) = %v", err)
+	}
+	want = []Move{
+		{Kind: MoveSend, From: "gen", Channel: "a"},
+		{Kind: MoveHandoff, From: "relay", To: "sink", Channel: "b"},
+	}
+	if got := s.Moves(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Moves() after receive = %v, want %v", got, want)
+	}
+	for s.Steps < 100 && len(s.Moves()) > 0 {
+		if err := s.Step(0); err != nil {
+			t.Fatalf("Step(0) = %v", err)
+		}
+	}
+	if !s.Finished() || s.Deadlocked() {
+		t.Errorf("after %d steps, Finished() = %t, Deadlocked() = %t, want true, false", s.Steps, s.Finished(), s.Deadlocked())
+	}
+	// 2 sends, 2 receives, 2 handoffs.
+	if s.Steps != 6 {
+		t.Errorf("finished after %d steps, want 6", s.Steps)
+	}
+	if err := s.Step(0); err == nil {
+		t.Errorf("Step(0) when finished = nil, want an error")
+	}
+}
+
+func TestStepperDeadlock(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"ping": "for x := range a { b <- x }",
+		"pong": "for x := range b { a <- x }",
+	})
+	s := g.NewStepper(1)
+	if !s.Deadlocked() {
+		t.Errorf("Deadlocked() = false for a cycle without tokens, want true")
+	}
+	for _, p := range s.Procs {
+		if !s.Blocked(p) {
+			t.Errorf("%s isn't blocked", p.Name)
+		}
+	}
+}
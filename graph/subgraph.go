@@ -0,0 +1,457 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+// Subgraph lives here rather than in parts, because it needs to load graphs.
+func init() {
+	style := parts.Style{Color: "lavender", Shape: "component", Icon: "⧉"}
+	if err := parts.Register("Subgraph", func() interface{} { return new(Subgraph) }, &style); err != nil {
+		panic(err)
+	}
+	parts.SetMetadata("Subgraph", parts.Metadata{
+		Name:        "Subgraph",
+		Description: "Runs all the goroutines of another graph, as if they were part of this one.",
+		Fields: []parts.FieldHelp{
+			{Field: "Graph file", Help: "The other graph, relative to this one."},
+			{Field: "Bindings", Help: "The channels of this graph to connect the other graph's input and output channels to."},
+			{Field: "Arguments", Help: "Values for the other graph's parameters; those left empty take their defaults."},
+		},
+	})
+}
+
+var _ = Part(&Subgraph{})
+
+// Subgraph is a part which runs all the goroutines of another graph. Channels
+// of the inner graph can be bound to channels of the outer graph; the rest
+// are made fresh for each instance.
+type Subgraph struct {
+	// Path to the inner graph, relative to the outer graph.
+	Path string `json:"path"`
+
+	// Bindings maps inner channel names to outer channel names.
+	Bindings map[string]string `json:"bindings,omitempty"`
+
+	// Args maps parameters of the inner graph to values. Parameters
+	// without an argument take their default.
+	Args map[string]string `json:"args,omitempty"`
+
+	file    string // Path to the inner graph, relative to the working directory.
+	inner   *Graph
+	loadErr error
+
+	// macro is the part type, if this is a macro (see LoadMacros).
+	macro string
+}
+
+// MarshalJSON encodes the subgraph. Macros don't save their path, which
+// comes from the part type.
+func (s *Subgraph) MarshalJSON() ([]byte, error) {
+	type plain Subgraph // Without the MarshalJSON method.
+	if s.macro == "" {
+		return json.Marshal((*plain)(s))
+	}
+	return json.Marshal(&struct {
+		Bindings map[string]string `json:"bindings,omitempty"`
+		Args     map[string]string `json:"args,omitempty"`
+	}{s.Bindings, s.Args})
+}
+
+// Macro reports whether the subgraph is a macro.
+func (s *Subgraph) Macro() bool { return s.macro != "" }
+
+// AssociateEditor adds a "part_view" template to the given template.
+func (s *Subgraph) AssociateEditor(tmpl *template.Template) error {
+	_, err := tmpl.New("part_view").Parse(`{{if not .Node.Part.Macro}}<div class="formfield">
+		<label for="SubgraphPath">Graph file</label>
+		<input type="text" name="SubgraphPath" required value="{{.Node.Part.Path}}">
+		{{with .Node.Part.File}}<a href="{{base}}/{{.}}">Open</a>{{end}}
+	</div>{{end}}
+	{{if and .Node.Name .Node.Part.Loaded}}
+	<div class="formfield">
+		<button type="submit" formaction="?node={{.Node.Name}}&amp;inline" formnovalidate>Inline</button>
+		<div class="hint">Replace this goroutine with the goroutines and channels of the other graph, to change them here.</div>
+	</div>
+	{{- end}}
+	{{range $p := .Node.Part.InnerParams}}
+	<div class="formfield">
+		<label for="SubgraphArg.{{$p.Name}}">{{$p.Kind}} {{$p.Name}}{{with $p.Type}} ({{.}}){{end}}</label>
+		<input type="text" name="SubgraphArg.{{$p.Name}}" placeholder="{{$p.Default}}" value="{{index $.Node.Part.Args $p.Name}}">
+	</div>
+	{{- end}}
+	{{range $c := .Node.Part.ExposedChannels}}
+	<div class="formfield">
+		<label for="SubgraphBind.{{$c.Name}}">{{with $c.Boundary}}{{.}} {{end}}{{$c.Name}} (chan {{$c.Type}})</label>
+		<select name="SubgraphBind.{{$c.Name}}">
+			<option value="">(internal)</option>
+			{{range $.Graph.Channels -}}
+			<option value="{{.Name}}" {{if eq .Name (index $.Node.Part.Bindings $c.Name)}}selected{{end}}>{{.Name}}</option>
+			{{- end}}
+		</select>
+	</div>
+	{{- end}}`)
+	return err
+}
+
+// Channels returns the outer channels the inner graph reads and writes.
+func (s *Subgraph) Channels() (read, written []string) {
+	if s.inner == nil {
+		return nil, nil
+	}
+	for _, c := range s.inner.channelNames() {
+		outer := s.Bindings[c]
+		if outer == "" {
+			continue
+		}
+		ends := s.inner.channelEnds()[c]
+		if ends == nil {
+			continue
+		}
+		if len(ends.readers) > 0 {
+			read = append(read, outer)
+		}
+		if len(ends.writers) > 0 {
+			written = append(written, outer)
+		}
+	}
+	return read, written
+}
+
+// Loaded reports whether the inner graph has been loaded.
+func (s *Subgraph) Loaded() bool { return s.inner != nil }
+
+// File returns the path to the inner graph relative to the working
+// directory, or "" if it hasn't been loaded.
+func (s *Subgraph) File() string {
+	if s.inner == nil {
+		return ""
+	}
+	return filepath.ToSlash(s.file)
+}
+
+// InnerChannels returns the channels of the inner graph, sorted by name.
+func (s *Subgraph) InnerChannels() []*Channel {
+	if s.inner == nil {
+		return nil
+	}
+	cs := make([]*Channel, 0, len(s.inner.Channels))
+	for _, c := range s.inner.channelNames() {
+		cs = append(cs, s.inner.Channels[c])
+	}
+	return cs
+}
+
+// ExposedChannels returns the inner channels which can be bound to outer
+// channels: all of them, except for macros, which only expose their input and
+// output channels.
+func (s *Subgraph) ExposedChannels() []*Channel {
+	if s.macro == "" {
+		return s.InnerChannels()
+	}
+	if s.inner == nil {
+		return nil
+	}
+	return s.inner.BoundaryChannels("")
+}
+
+// InnerParams returns the parameters of the inner graph.
+func (s *Subgraph) InnerParams() []*Param {
+	if s.inner == nil {
+		return nil
+	}
+	return s.inner.Params
+}
+
+// Render shows the inner graph's file, and counts its goroutines.
+func (s *Subgraph) Render() parts.Rendering {
+	if s.inner == nil || s.macro != "" {
+		return parts.Rendering{}
+	}
+	b := fmt.Sprintf("%d goroutines", len(s.inner.Nodes))
+	if len(s.inner.Nodes) == 1 {
+		b = "1 goroutine"
+	}
+	return parts.Rendering{Lines: []string{filepath.Base(s.Path)}, Badge: b}
+}
+
+// Impl returns the inner graph as the body of a goroutine.
+func (s *Subgraph) Impl() string {
+	if s.inner == nil {
+		return fmt.Sprintf("panic(%q)", fmt.Sprintf("subgraph %s not loaded", s.Path))
+	}
+	b := new(bytes.Buffer)
+	if s.macro != "" {
+		fmt.Fprintf(b, "// Macro %s\n", s.macro)
+	} else {
+		fmt.Fprintf(b, "// Subgraph %s\n", s.Path)
+	}
+	for _, v := range s.inner.paramDecls(s.Args) {
+		fmt.Fprintf(b, "%v\n", v)
+	}
+	used := make(map[string]bool)
+	for _, n := range s.inner.Nodes {
+		for _, c := range append(n.ChannelsRead(), n.ChannelsWritten()...) {
+			used[c] = true
+		}
+	}
+	// Bound channels are declared in one statement, so that each refers to
+	// the outer channel even if an inner channel has the same name.
+	var lhs, rhs []string
+	for _, c := range s.InnerChannels() {
+		if outer := s.Bindings[c.Name]; used[c.Name] && outer != "" {
+			lhs, rhs = append(lhs, c.Name), append(rhs, outer)
+		}
+	}
+	if len(lhs) > 0 {
+		fmt.Fprintf(b, "%s := %s\n", strings.Join(lhs, ", "), strings.Join(rhs, ", "))
+	}
+	for _, c := range s.InnerChannels() {
+		if used[c.Name] && s.Bindings[c.Name] == "" {
+			fmt.Fprintf(b, "%s := %s\n", c.Name, c.Make())
+		}
+	}
+	if err := goTemplate.ExecuteTemplate(b, "run_body", s.inner); err != nil {
+		return fmt.Sprintf("panic(%q)", err.Error())
+	}
+	return b.String()
+}
+
+// Update sets fields based on the given Request. A new path is loaded when
+// the graph next loads its subgraphs.
+func (s *Subgraph) Update(r *http.Request) error {
+	if r == nil {
+		return nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	if p := strings.TrimSpace(r.FormValue("SubgraphPath")); s.macro == "" && p != s.Path {
+		s.Path = p
+		s.inner, s.loadErr = nil, nil
+	}
+	s.Bindings = formMap(r, "SubgraphBind.")
+	s.Args = formMap(r, "SubgraphArg.")
+	return nil
+}
+
+// formMap collects the non-empty form values with keys starting with prefix.
+func formMap(r *http.Request, prefix string) map[string]string {
+	m := make(map[string]string)
+	for k, v := range r.Form {
+		if !strings.HasPrefix(k, prefix) || len(v) == 0 {
+			continue
+		}
+		if a := strings.TrimSpace(v[0]); a != "" {
+			m[strings.TrimPrefix(k, prefix)] = a
+		}
+	}
+	return m
+}
+
+// Validate checks there is a graph file. Whether it loads is up to Check.
+func (s *Subgraph) Validate() error {
+	if s.Path == "" {
+		return parts.ConfigErrors{{Field: "Graph file", Msg: "missing"}}
+	}
+	return nil
+}
+
+// RenameChannel changes bindings to the channel.
+func (s *Subgraph) RenameChannel(from, to string) error {
+	for k, v := range s.Bindings {
+		if v == from {
+			s.Bindings[k] = to
+		}
+	}
+	return nil
+}
+
+// TypeKey returns "Subgraph", or the part type of a macro.
+func (s *Subgraph) TypeKey() string {
+	if s.macro != "" {
+		return s.macro
+	}
+	return "Subgraph"
+}
+
+// LoadSubgraphs loads the inner graphs of any Subgraph nodes that haven't
+// been loaded yet. Problems are reported by Check.
+func (g *Graph) LoadSubgraphs() {
+	g.loadSubgraphs(nil)
+}
+
+// loadSubgraphs loads subgraphs, refusing to load any graph in the chain of
+// graphs that led to this one.
+func (g *Graph) loadSubgraphs(chain []string) {
+	if abs, err := filepath.Abs(g.SourcePath); err == nil {
+		chain = append(chain[:len(chain):len(chain)], abs)
+	}
+	for _, n := range g.Nodes {
+		s, ok := n.Part.(*Subgraph)
+		if !ok || s.inner != nil {
+			continue
+		}
+		s.file = s.Path
+		if !filepath.IsAbs(s.Path) {
+			s.file = filepath.Join(filepath.Dir(g.SourcePath), s.Path)
+		}
+		s.loadErr = nil
+		abs, err := filepath.Abs(s.file)
+		if err != nil {
+			s.loadErr = err
+			continue
+		}
+		for _, p := range chain {
+			if p == abs {
+				s.loadErr = fmt.Errorf("%s includes itself", s.Path)
+			}
+		}
+		if s.loadErr != nil {
+			continue
+		}
+		f, err := os.Open(s.file)
+		if err != nil {
+			s.loadErr = err
+			continue
+		}
+		inner, err := loadJSON(f, s.file, chain)
+		f.Close()
+		if err != nil {
+			s.loadErr = err
+			continue
+		}
+		s.inner = inner
+	}
+}
+
+// AllImports returns the imports of the graph together with those needed by
+// any subgraphs. "sync" is always imported by the generated code, so it is
+// only included if it is in g.Imports.
+func (g *Graph) AllImports() []string {
+	seen := map[string]bool{"sync": true}
+	imps := make([]string, 0, len(g.Imports))
+	for _, i := range g.Imports {
+		seen[i] = true
+		imps = append(imps, i)
+	}
+	var extra []string
+	add := func(is ...string) {
+		for _, i := range is {
+			if !seen[i] {
+				seen[i] = true
+				extra = append(extra, i)
+			}
+		}
+	}
+	if g.needsRuntime() {
+		add("runtime")
+	}
+	add(g.timeoutImports()...)
+	add(g.journalImports()...)
+	if g.Logging != LogOff {
+		add("flag", "log/slog", "os")
+	}
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		if ip, ok := n.Part.(ImportingPart); ok && !n.Disabled {
+			add(ip.Imports()...)
+		}
+		if s, ok := n.Part.(*Subgraph); ok && s.inner != nil {
+			add(s.inner.AllImports()...)
+		}
+	}
+	sort.Strings(extra)
+	return append(imps, extra...)
+}
+
+// AllDeclarations returns the declarations of the graph and its subgraphs.
+// Declarations of subgraphs are written at package scope too, so they can't
+// refer to the parameters of a subgraph. Each distinct set of declarations
+// is only included once, however many instances of a subgraph there are.
+func (g *Graph) AllDeclarations() []string {
+	var ds []string
+	seen := make(map[string]bool)
+	var add func(*Graph)
+	add = func(g *Graph) {
+		if d := strings.TrimSpace(g.Declarations); d != "" && !seen[d] {
+			seen[d] = true
+			ds = append(ds, d)
+		}
+		if g.DeadLetters != "" && !seen[deadLetterDecl] {
+			seen[deadLetterDecl] = true
+			ds = append(ds, deadLetterDecl)
+		}
+		for _, nn := range g.nodeNames() {
+			if s, ok := g.Nodes[nn].Part.(*Subgraph); ok && s.inner != nil {
+				add(s.inner)
+			}
+		}
+	}
+	add(g)
+	return ds
+}
+
+// checkSubgraphs reports subgraphs that couldn't be loaded, and bindings to
+// channels that don't exist.
+func checkSubgraphs(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, nn := range g.nodeNames() {
+		s, ok := g.Nodes[nn].Part.(*Subgraph)
+		if !ok {
+			continue
+		}
+		if s.loadErr != nil {
+			ds = append(ds, Diagnostic{
+				Severity: Error,
+				Node:     nn,
+				Msg:      fmt.Sprintf("could not load subgraph: %v", s.loadErr),
+			})
+		}
+		if s.inner != nil {
+			for _, c := range s.inner.BoundaryChannels("") {
+				if s.Bindings[c.Name] == "" {
+					ds = append(ds, Diagnostic{
+						Severity: Warning,
+						Node:     nn,
+						Msg:      fmt.Sprintf("subgraph %s %s isn't bound to a channel", c.Boundary, c.Name),
+					})
+				}
+			}
+		}
+		for inner, outer := range s.Bindings {
+			if _, found := g.Channels[outer]; !found {
+				ds = append(ds, Diagnostic{
+					Severity: Error,
+					Node:     nn,
+					Msg:      fmt.Sprintf("inner channel %s is bound to %s, which doesn't exist", inner, outer),
+				})
+			}
+		}
+	}
+	return ds
+}
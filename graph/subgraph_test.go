@@ -0,0 +1,85 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSubgraphMissing(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen": "a <- 1; close(a)",
+	})
+	g.SourcePath = filepath.Join(t.TempDir(), "outer.szgo")
+	g.Nodes["sub"] = &Node{Name: "sub", Multiplicity: 1, Part: &Subgraph{
+		Path:     "missing.szgo",
+		Bindings: map[string]string{"in": "a"},
+	}}
+
+	// Not loaded yet, as after LoadJSON.
+	for _, d := range checkSubgraphs(g) {
+		t.Errorf("checkSubgraphs before loading = %v, want nothing", d)
+	}
+	g.LoadSubgraphs()
+	ds := checkSubgraphs(g)
+	if len(ds) != 1 || ds[0].Node != "sub" || !strings.Contains(ds[0].Msg, "could not load subgraph") {
+		t.Errorf("checkSubgraphs = %v, want an error loading sub", ds)
+	}
+}
+
+func TestRenameKeepsSubgraphs(t *testing.T) {
+	dir := t.TempDir()
+	inner := testGraph(t, map[string]int{"in": 0}, map[string]string{
+		"sink": "for range in {}",
+	})
+	var buf bytes.Buffer
+	if err := inner.WriteJSONTo(&buf); err != nil {
+		t.Fatalf("WriteJSONTo() = %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "inner.szgo"), buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"gen":  "a <- 1; close(a); close(b)",
+		"sink": "for range b {}",
+	})
+	g.SourcePath = filepath.Join(dir, "outer.szgo")
+	g.Nodes["sub"] = &Node{Name: "sub", Multiplicity: 1, Part: &Subgraph{
+		Path:     "inner.szgo",
+		Bindings: map[string]string{"in": "a"},
+	}}
+	g.LoadSubgraphs()
+	impl := g.Nodes["sub"].Impl()
+
+	effs, err := g.PreviewRenameChannel("b", "c")
+	if err != nil {
+		t.Fatalf("PreviewRenameChannel(b, c) = %v", err)
+	}
+	for _, e := range effs {
+		if e.Node == "sub" {
+			t.Errorf("PreviewRenameChannel(b, c) affects sub:\n%s\nbecomes\n%s", e.Before, e.After)
+		}
+	}
+	if err := g.RenameChannel("a", "x"); err != nil {
+		t.Fatalf("RenameChannel(a, x) = %v", err)
+	}
+	if got, want := g.Nodes["sub"].Impl(), strings.Replace(impl, "in := a", "in := x", 1); got != want {
+		t.Errorf("sub after RenameChannel(a, x) = %q, want %q", got, want)
+	}
+}
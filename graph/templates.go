@@ -17,85 +17,709 @@ package graph
 import "text/template"
 
 const (
-	dotTemplateSrc = `digraph {
-	graph[rankdir="UD",fontname="Go"];
-	node[shape=box,fontname="Go"];
-	{{range .Nodes}}
-	"{{.Name}}" [URL="?node={{.Name}}"{{if gt .Multiplicity 1}},shape=box3d{{end}}];
+	dotTemplateSrc = `{{$t := .Theme}}digraph {
+	graph[rankdir="UD",fontname="Go",bgcolor="{{$t.Background}}",fontcolor="{{$t.Foreground}}"];
+	node[shape=box,fontname="Go",color="{{$t.Foreground}}",fontcolor="{{$t.NodeText}}",penwidth={{$t.PenWidth}}];
+	edge[color="{{$t.Foreground}}",fontcolor="{{$t.Foreground}}",penwidth={{$t.PenWidth}}];
+	{{- if .Positioned}}
+	graph[layout=neato,inputscale=72,overlap=false,splines=true];
+	{{- end}}
+	{{range .NodeGroups}}
+	{{- if .Name}}
+	subgraph "cluster_{{.Name}}" {
+		label="{{.Name}}";
+		{{- if $t.PartColors}}
+		style=filled;
+		fillcolor="{{.Color}}";
+		color="{{.Color}}";
+		fontcolor="{{$t.NodeText}}";
+		{{- else}}
+		color="{{$t.Foreground}}";
+		{{- end}}
+	{{- end}}
+	{{- range .Nodes}}
+	{{- $style := .Style}}{{$r := .Rendering}}
+	"{{.Name}}" [URL="?node={{.Name}}",label={{$.DotLabel .}}{{with .Pos}},pos="{{.X}},{{.Y}}!"{{end}},shape={{if $r.Ports}}record{{else if gt .Multiplicity 1}}box3d{{else}}{{$style.Shape}}{{end}}
+	{{- with $r.Badge}},xlabel={{printf "%q" .}}{{end}}
+	{{- if .Disabled}},style="filled,dashed",fillcolor="{{$t.Background}}",color="{{$t.Disabled}}",fontcolor="{{$t.Disabled}}"{{else}},style=filled,fillcolor="{{$t.Fill $style}}"{{end}}
+	{{- with .Doc}},tooltip={{printf "%q" .}}{{else}}{{if .Disabled}},tooltip="disabled"{{end}}{{end}}];
+	{{- end}}
+	{{- if .Name}}
+	}
+	{{- end}}
 	{{- end}}
 	{{range .Channels}}
-	"{{.Name}}" [xlabel="{{.Name}}",URL="?channel={{.Name}}",shape=point,fontname="Go Mono"];
+	"{{.Name}}" [xlabel="{{.Name}}",URL="?channel={{.Name}}",fontname="Go Mono",fontcolor="{{$t.Foreground}}"
+	{{- if eq .Boundary "input"}},shape=invtriangle,style=filled,fillcolor="{{$t.Foreground}}",width=0.2,height=0.2,label="",tooltip="graph input"
+	{{- else if eq .Boundary "output"}},shape=triangle,style=filled,fillcolor="{{$t.Foreground}}",width=0.2,height=0.2,label="",tooltip="graph output"
+	{{- else}},shape=point,width=0.12,fillcolor="{{$t.Foreground}}",tooltip={{printf "%q" ($.ChannelSummary .Name)}}{{end}}];
 	{{- end}}
+	{{range .Comments}}
+	"comment:{{.Name}}" [label={{printf "%q" .Text}},URL="?comment={{.Name}}",shape=note,style=filled,fillcolor="{{$t.CommentFill}}",fontcolor="{{$t.Foreground}}",fontsize=10];
+	{{- if index $.Nodes .Node}}
+	"comment:{{.Name}}" -> "{{.Node}}" [URL="?comment={{.Name}}",style=dashed,arrowhead=none];
+	{{- end}}
+	{{- end}}
+	{{- $labels := .EdgeLabels}}
 	{{range $n := .Nodes -}}
 	{{range $.DeclaredChannels .ChannelsRead}}
-	"{{.}}" -> "{{$n.Name}}" [URL="?channel={{.}}"];
+	"{{.}}" -> "{{$n.Name}}"{{$.DotPort $n "i" .}} [URL="?channel={{.}}",tooltip={{printf "%q" ($.ChannelSummary .)}}
+	{{- with index $labels .}}{{if .OnReaders}},label={{printf "%q" .Text}},fontname="Go Mono",fontsize=10{{end}}{{end}}
+	{{- if $n.Disabled}},color="{{$t.Disabled}}",style=dashed{{end}}];
 	{{- end}}
 	{{- range $.DeclaredChannels .ChannelsWritten}}
-	"{{$n.Name}}" -> "{{.}}" [URL="?channel={{.}}"];
+	{{- $tip := $.ChannelSummary .}}{{if $n.Closes .}}{{$tip = printf "%s, closed by %s" $tip $n.Name}}{{end}}
+	"{{$n.Name}}"{{$.DotPort $n "o" .}} -> "{{.}}" [URL="?channel={{.}}",tooltip={{printf "%q" $tip}}{{with index $labels .}}{{if not .OnReaders}},label={{printf "%q" .Text}},fontname="Go Mono",fontsize=10{{end}}{{end}}
+	{{- if $n.Closes .}},arrowhead="teenormal"{{end}}{{if $n.Disabled}},color="{{$t.Disabled}}",style=dashed{{end}}];
+	{{- end}}
+	{{- if and ($.SendsDeadLetters $n) (index $.Channels $.DeadLetters)}}
+	"{{$n.Name}}" -> "{{$.DeadLetters}}" [URL="?channel={{$.DeadLetters}}",tooltip="dead letters",style=dotted];
 	{{- end}}
 	{{- end}}
 }`
 
 	goTemplateSrc = `// Package {{.PackageName}} was automatically generated by Shenzhen Go.
 package {{.PackageName}} {{if ne .PackagePath .PackageName}} // import "{{.PackagePath}}"{{end}}
-
+{{with .GoGenerate}}
+//go:generate {{.}}
+{{end}}
 import (
-	{{range .Imports}}
+	{{range .AllImports}}
 	"{{.}}"
 	{{- end}}
 	"sync"
 )
+{{range .ParamDecls}}
+{{.}}
+{{- end}}
+{{range .AllDeclarations}}
+{{.}}
+{{end}}
+{{- if .UsesLogging}}
+// logLevel is the minimum level logger logs at, set with the -log_level flag.
+var logLevel slog.Level
+
+// logger logs to standard error. Each goroutine using it has its own, which
+// says which goroutine logged.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &logLevel}))
+
+func init() {
+	flag.TextVar(&logLevel, "log_level", {{.LogLevelDefault}}, "minimum level of messages to log: DEBUG, INFO, WARN or ERROR")
+}
+{{end}}
 
 var (
-	{{- range .Channels}}
-	{{.Name}} = make(chan {{.Type}}, {{.Cap}})
-	{{- end}}
+	{{- range .Channels}}{{if not .Boundary}}
+	{{.Name}} = {{.Make}}
+	{{- end}}{{end}}
 )
 
 // Run executes all the goroutines associated with the graph that generated 
 // this package, and waits for any that were marked as "wait for this to 
 // finish" to finish before returning.
-func Run() {
+{{- with .BoundaryChannels ""}}
+//
+// The channels passed in connect the graph to the caller, which should
+// close any inputs when it is finished sending.
+{{- end}}
+func Run({{range $i, $c := .BoundaryChannels ""}}{{if $i}}, {{end}}{{.Name}} {{.ParamType}}{{end}}) {
+	{{template "run_body" .}}
+}`
+
+	// run_body starts the goroutines of a graph and waits for them. It is
+	// also used to inline subgraphs.
+	runBodyTemplateSrc = `{{define "run_body" -}}
 	var wg sync.WaitGroup
-	{{range .Nodes}}
-	
+	{{- range $.AutoClosed}}
+	var {{.}}Writers sync.WaitGroup
+	{{- end}}
+	{{- range $.QueuedChannels}}
+
+	{{$.QueueShim .}}
+	{{- end}}
+	{{- range $.Semaphores}}
+	{{.Name}}Semaphore := make(chan struct{}, {{.Slots}})
+	{{- end}}
+	{{- if $.UsesTimeouts}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	{{- end}}
+	{{- with $.Procs}}
+	if runtime.GOMAXPROCS(0) < {{.}} {
+		runtime.GOMAXPROCS({{.}})
+	}
+	{{- end}}
+	{{range $n := .Nodes}}
+	{{if .Disabled}}
+	// {{.Name}} is disabled.
+	{{- with $.BridgeImpl .}}
+	go func() {
+		{{.}}
+	}()
+	{{- end}}
+	{{- else}}
 	// {{.Name}}
-	{{if .Wait -}}
+	{{- range .DocLines}}
+	// {{.}}
+	{{- end}}
+	{{if $.Waited . -}}
 	wg.Add({{.Multiplicity}})
 	{{- end}}
+	{{- range $.AutoCloses .}}
+	{{.}}Writers.Add({{$n.Multiplicity}})
+	{{- end}}
 	{{if gt .Multiplicity 1 -}}for n:=0; n<{{.Multiplicity}}; n++ {
 		go func(instanceNumber int) {
-			{{if .Wait -}}
+			{{if $.Waited . -}}
 			defer wg.Done()
 			{{end}}
+			{{- range $.AutoCloses .}}
+			defer {{.}}Writers.Done()
+			{{- end}}
+			{{- if $.NodeLogs .}}
+			logger := logger.With("node", {{printf "%q" .Name}}, "instance", instanceNumber)
+			{{- end}}
+			{{- with $.QueuePrologue .}}
+			{{.}}
+			{{- end}}
+			{{- with .ResourcePrologue}}
+			{{.}}
+			{{- end}}
+			{{- with $.TimeoutPrologue .}}
+			{{.}}
+			{{- end}}
+			{{- with $.DeadLetterPrologue .}}
+			{{.}}
+			{{- end}}
 			{{.Impl}}
 		}(n)
 	}
 	{{- else -}}go func() {
-		{{if .Wait -}}
+		{{if $.Waited . -}}
 		defer wg.Done()
 		{{end}}
+		{{- range $.AutoCloses .}}
+		defer {{.}}Writers.Done()
+		{{- end}}
+		{{- if $.NodeLogs .}}
+		logger := logger.With("node", {{printf "%q" .Name}})
+		{{- end}}
+		{{- with $.QueuePrologue .}}
+		{{.}}
+		{{- end}}
+		{{- with .ResourcePrologue}}
+		{{.}}
+		{{- end}}
+		{{- with $.TimeoutPrologue .}}
+		{{.}}
+		{{- end}}
+		{{- with $.DeadLetterPrologue .}}
+		{{.}}
+		{{- end}}
 		{{.Impl}}
 	}()
 	{{- end}}
 	{{- end}}
+	{{- end}}
+	{{- range $.AutoClosed}}
+
+	// Close {{.}} once everything writing to it has finished.
+	go func() {
+		{{.}}Writers.Wait()
+		close({{.}})
+	}()
+	{{- end}}
+
+	{{- if $.CancelsRun}}
+
+	// Wait for the end, or for a goroutine to cancel the run
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+	<-ctx.Done()
+	{{- else}}
 
 	// Wait for the end
 	wg.Wait()
-}`
+	{{- end}}
+{{- end}}`
 
 	goRunnerTemplateSrc = `package main
 
-	import "{{.PackagePath}}"
+import (
+	{{- if .BoundaryChannels "input"}}
+	"bufio"
+	{{- end}}
+	"flag"
+	{{- if .BoundaryChannels ""}}
+	"fmt"
+	{{- end}}
+	{{- if .BoundaryChannels "input"}}
+	"log"
+	"os"
+	{{- end}}
+	{{- if .BoundaryChannels "output"}}
+	"sync"
+	{{- end}}
+
+	"{{.PackagePath}}"
+)
+
+{{range $i, $c := .BoundaryChannels "input" -}}
+var {{.Name}}Flag = flag.String("{{.Name}}", "{{if not $i}}-{{end}}", "File to read values for input {{.Name}} from, one per line (- for stdin, empty for none)")
+{{end}}
+func main() {
+	flag.Parse()
+	{{- range .BoundaryChannels "input"}}
+
+	{{.Name}} := make(chan {{.Type}}, {{.Cap}})
+	go func() {
+		defer close({{.Name}})
+		if *{{.Name}}Flag == "" {
+			return
+		}
+		f := os.Stdin
+		if *{{.Name}}Flag != "-" {
+			var err error
+			if f, err = os.Open(*{{.Name}}Flag); err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			{{if eq .Type "string" -}}
+			{{.Name}} <- sc.Text()
+			{{- else -}}
+			var x {{.Type}}
+			if _, err := fmt.Sscan(sc.Text(), &x); err != nil {
+				log.Fatalf("input {{.Name}}: %v", err)
+			}
+			{{.Name}} <- x
+			{{- end}}
+		}
+	}()
+	{{- end}}
+	{{- with .BoundaryChannels "output"}}
+
+	var wg sync.WaitGroup
+	{{- range .}}
+	{{.Name}} := make(chan {{.Type}}, {{.Cap}})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for x := range {{.Name}} {
+			fmt.Println("{{.Name}}:", x)
+		}
+	}()
+	{{- end}}
+	{{- end}}
+
+	{{.PackageName}}.Run({{range $i, $c := .BoundaryChannels ""}}{{if $i}}, {{end}}{{.Name}}{{end}})
+	{{- if .BoundaryChannels "output"}}
+
+	// Print anything left once the outputs are closed.
+	wg.Wait()
+	{{- end}}
+}
+`
+	scratchMainTemplateSrc = `// Command scratch runs a goroutine of {{.Name}} by itself, with sample
+// inputs.
+package main
+
+import (
+	{{- range .Imports}}
+	"{{.}}"
+	{{- end}}
+)
+
+func main() {
+	flag.Parse()
+	{{- range .BoundaryChannels "input"}}
+	{{- $samples := index $.Samples .Name}}
+
+	{{.Name}} := make(chan {{.Type}}, {{len $samples}})
+	for _, x := range []{{.Type}}{ {{- range $i, $s := $samples}}{{if $i}}, {{end}}{{$s}}{{end -}} } {
+		{{.Name}} <- x
+	}
+	close({{.Name}})
+	{{- end}}
+	{{- with .BoundaryChannels "output"}}
+
+	var wg sync.WaitGroup
+	{{- range .}}
+	{{.Name}} := make(chan {{.Type}}, {{.Cap}})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for x := range {{.Name}} {
+			fmt.Println("{{.Name}}:", x)
+		}
+	}()
+	{{- end}}
+	{{- end}}
+
+	Run({{range $i, $c := .BoundaryChannels ""}}{{if $i}}, {{end}}{{.Name}}{{end}})
+	{{- if .BoundaryChannels "output"}}
+
+	// Print anything left once the outputs are closed.
+	wg.Wait()
+	{{- end}}
+}
+`
+
+	scenarioTestTemplateSrc = `// Tests of the scenarios of {{.Name}}, which were automatically generated
+// by Shenzhen Go.
+package {{.PackageName}}
+{{with .Imports}}
+import (
+	{{- range .}}
+	"{{.}}"
+	{{- end}}
+)
+{{end}}
+// resetChannels remakes the channels, which the previous test closed.
+func resetChannels() {
+	{{- range .Channels}}{{if not .Boundary}}
+	{{.Name}} = {{.Make}}
+	{{- end}}{{end}}
+}
+{{range .Tests}}
+// {{.TestName}} runs the {{printf "%q" .Name}} scenario.
+func {{.TestName}}(t *testing.T) {
+	resetChannels()
+	{{- range .Inputs}}
+
+	{{.Name}} := make(chan {{.Type}})
+	go func() {
+		for _, x := range []{{.Type}}{ {{- range $i, $v := .Values}}{{if $i}}, {{end}}{{$v}}{{end -}} } {
+			{{.Name}} <- x
+		}
+		close({{.Name}})
+	}()
+	{{- end}}
+	{{- range .Outputs}}
+	{{.Name}} := make(chan {{.Type}}, {{.CapSource}})
+	{{.Name}}Got := []{{.Type}}{}
+	{{- end}}
+
+	done := make(chan struct{})
+	go func() {
+		{{- with .Outputs}}
+		var wg sync.WaitGroup
+		{{- range .}}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for x := range {{.Name}} {
+				{{.Name}}Got = append({{.Name}}Got, x)
+			}
+		}()
+		{{- end}}
+		{{- end}}
+		Run({{range $i, $c := $.BoundaryChannels ""}}{{if $i}}, {{end}}{{.Name}}{{end}})
+		{{- if .Outputs}}
+		wg.Wait()
+		{{- end}}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After({{.Timeout}}):
+		t.Fatal("didn't finish in time: Run didn't return, or an output wasn't closed")
+	}
+	{{- range .Outputs}}{{if .Checked}}
+	if want := []{{.Type}}{ {{- range $i, $v := .Values}}{{if $i}}, {{end}}{{$v}}{{end -}} }; !reflect.DeepEqual({{.Name}}Got, want) {
+		t.Errorf("{{.Name}} got %v, want %v", {{.Name}}Got, want)
+	}
+	{{- end}}{{end}}
+}
+{{end}}`
+
+	fuzzTestTemplateSrc = `// Fuzz test of the goroutine {{.Node}} of {{.Name}}, which was
+// automatically generated by Shenzhen Go. Run it with:
+//
+//	go test -fuzz={{.Func}}
+package {{.PackageName}}
+
+import (
+	{{- range .Imports}}
+	"{{.}}"
+	{{- end}}
+)
+
+// resetChannels remakes the channels, which the previous input closed.
+func resetChannels() {
+	{{- range .Channels}}{{if not .Boundary}}
+	{{.Name}} = {{.Make}}
+	{{- end}}{{end}}
+}
+
+// {{.Func}} runs {{.Node}} with fuzzed values sent to the channels it reads.
+func {{.Func}}(f *testing.F) {
+	{{- range .Seeds}}
+	f.Add({{range $i, $e := .}}{{if $i}}, {{end}}{{$e}}{{end}})
+	{{- end}}
+	f.Fuzz(func(t *testing.T{{range $i, $c := .Inputs}}, v{{$i}} {{.Type}}{{end}}) {
+		resetChannels()
+		{{- range $i, $c := .Inputs}}
+		{{.Name}} := make(chan {{.Type}}, 1)
+		{{.Name}} <- v{{$i}}
+		close({{.Name}})
+		{{- end}}
+		{{- range .BoundaryChannels "output"}}
+		{{.Name}} := make(chan {{.Type}}, {{.CapSource}})
+		{{- end}}
+
+		done := make(chan struct{})
+		go func() {
+			{{- with .BoundaryChannels "output"}}
+			var wg sync.WaitGroup
+			{{- range .}}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range {{.Name}} {
+				}
+			}()
+			{{- end}}
+			{{- end}}
+			Run({{range $i, $c := .BoundaryChannels ""}}{{if $i}}, {{end}}{{.Name}}{{end}})
+			{{- if .BoundaryChannels "output"}}
+			wg.Wait()
+			{{- end}}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After({{.Timeout}}):
+			t.Fatal("didn't finish in time: Run didn't return, or an output wasn't closed")
+		}
+	})
+}
+`
+
+	propertyTestTemplateSrc = `// Property-based tests of goroutines of {{.Name}}, which were
+// automatically generated by Shenzhen Go.
+package {{.PackageName}}
+
+import (
+	{{- range .Imports}}
+	"{{.}}"
+	{{- end}}
+)
+{{range .Tests}}
+// {{.Func}} checks the properties claimed of the expression of
+// {{.Node}} for random values.
+func {{.Func}}(t *testing.T) {
+	f := func(x {{.In.Type}}) {{.Out.Type}} { return {{.Expr}} }
+	{{- $t := .}}
+	{{- range .Properties}}
+
+	// {{.Name}}
+	if err := quick.Check(func(x {{$t.In.Type}}) bool {
+		return func(y {{$t.Out.Type}}) bool { return {{.Expr}} }(f(x))
+	}, nil); err != nil {
+		t.Errorf("not %s: %v", {{printf "%q" .Name}}, err)
+	}
+	{{- end}}
+}
+{{end}}`
+
+	serviceMainTemplateSrc = `// Command {{.Name}} runs part of {{.Graph.Name}}, which Shenzhen Go split
+// into services at its remote channels.
+package main
+
+import (
+	"encoding/gob"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// A Transport carries the values sent on remote channels between services,
+// gob-encoded. The default uses TCP. To use another (such as gRPC or NATS),
+// assign it to transport in an init function in a file of your own.
+type Transport interface {
+	// Listen waits for the writer of a channel to connect at addr.
+	Listen(channel, addr string) (io.ReadCloser, error)
+
+	// Dial connects to the reader of a channel at addr.
+	Dial(channel, addr string) (io.WriteCloser, error)
+}
+
+var transport Transport = tcpTransport{}
 
-	func main() {
-		{{.PackageName}}.Run()
+// tcpTransport connects services with TCP.
+type tcpTransport struct{}
+
+func (tcpTransport) Listen(_, addr string) (io.ReadCloser, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	return l.Accept()
+}
+
+func (tcpTransport) Dial(_, addr string) (io.WriteCloser, error) {
+	// The reader might not be listening yet, so keep trying for a while.
+	for i := 0; ; i++ {
+		c, err := net.Dial("tcp", addr)
+		if err == nil || i == 50 {
+			return c, err
+		}
+		time.Sleep(200 * time.Millisecond)
 	}
+}
+{{range .Listens}}
+var {{.Name}}Addr = flag.String("{{.Name}}_addr", {{printf "%q" .Remote}}, "Address to listen on for remote channel {{.Name}}")
+{{- end}}
+{{- range .Dials}}
+var {{.Name}}Addr = flag.String("{{.Name}}_addr", {{printf "%q" .Remote}}, "Address of the service reading remote channel {{.Name}}")
+{{- end}}
+
+func main() {
+	flag.Parse()
+	var wg sync.WaitGroup
+	{{- range .Listens}}
+
+	{{.Name}} := make(chan {{.Type}}, {{.CapSource}})
+	go func() {
+		defer close({{.Name}})
+		r, err := transport.Listen("{{.Name}}", *{{.Name}}Addr)
+		if err != nil {
+			log.Fatalf("remote channel {{.Name}}: %v", err)
+		}
+		defer r.Close()
+		dec := gob.NewDecoder(r)
+		for {
+			var x {{.Type}}
+			if err := dec.Decode(&x); err != nil {
+				if err != io.EOF {
+					log.Printf("remote channel {{.Name}}: %v", err)
+				}
+				return
+			}
+			{{.Name}} <- x
+		}
+	}()
+	{{- end}}
+	{{- range .Dials}}
+
+	{{.Name}} := make(chan {{.Type}}, {{.CapSource}})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w, err := transport.Dial("{{.Name}}", *{{.Name}}Addr)
+		if err != nil {
+			log.Fatalf("remote channel {{.Name}}: %v", err)
+		}
+		enc := gob.NewEncoder(w)
+		for x := range {{.Name}} {
+			if err := enc.Encode(x); err != nil {
+				log.Fatalf("remote channel {{.Name}}: %v", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			log.Printf("remote channel {{.Name}}: %v", err)
+		}
+	}()
+	{{- end}}
+
+	Run({{range $i, $c := .Graph.BoundaryChannels ""}}{{if $i}}, {{end}}{{.Name}}{{end}})
+
+	// Finish sending to the other services.
+	wg.Wait()
+}
+`
+	dockerfileTemplateSrc = `# Builds the {{.Name}} service of {{.Graph.Name}}.
+FROM golang:1.22 AS build
+WORKDIR /src
+COPY . .
+RUN test -f go.mod || (go mod init {{.Name}} && go mod tidy)
+RUN CGO_ENABLED=0 go build -o /service .
+
+FROM scratch
+COPY --from=build /service /service
+ENTRYPOINT ["/service"]
+`
+
+	composeTemplateSrc = `# The services of {{.Graph}}, which Shenzhen Go split at its remote channels.
+services:
+{{- range .Services}}
+  {{.Name}}:
+    build: ./{{.Name}}
+    {{- with .Args}}
+    command: [{{range $i, $a := .}}{{if $i}}, {{end}}{{printf "%q" $a}}{{end}}]
+    {{- end}}
+    {{- with .Ports}}
+    expose: [{{range $i, $p := .}}{{if $i}}, {{end}}{{printf "%q" $p}}{{end}}]
+    {{- end}}
+{{- end}}
+`
+
+	kubernetesTemplateSrc = `# The services of {{.Graph}}, which Shenzhen Go split at its remote channels.
+{{- range .Services}}
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{.Name}}
+spec:
+  backoffLimit: 0
+  template:
+    metadata:
+      labels:
+        app: {{.Name}}
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: {{.Name}}
+        image: {{$.Registry}}{{.Name}}
+        {{- with .Args}}
+        args: [{{range $i, $a := .}}{{if $i}}, {{end}}{{printf "%q" $a}}{{end}}]
+        {{- end}}
+        {{- with .Ports}}
+        ports:
+        {{- range .}}
+        - containerPort: {{.}}
+        {{- end}}
+        {{- end}}
+{{- if .Ports}}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}
+spec:
+  selector:
+    app: {{.Name}}
+  ports:
+  {{- range .Ports}}
+  - name: port-{{.}}
+    port: {{.}}
+  {{- end}}
+{{- end}}
+{{- end}}
 `
 )
 
 var (
 	dotTemplate      = template.Must(template.New("dot").Parse(dotTemplateSrc))
-	goTemplate       = template.Must(template.New("golang").Parse(goTemplateSrc))
+	goTemplate       = template.Must(template.Must(template.New("golang").Parse(goTemplateSrc)).Parse(runBodyTemplateSrc))
 	goRunnerTemplate = template.Must(template.New("golang-runner").Parse(goRunnerTemplateSrc))
+
+	scratchMainTemplate  = template.Must(template.New("scratch-main").Parse(scratchMainTemplateSrc))
+	scenarioTestTemplate = template.Must(template.New("scenario-test").Parse(scenarioTestTemplateSrc))
+	fuzzTestTemplate     = template.Must(template.New("fuzz-test").Parse(fuzzTestTemplateSrc))
+	propertyTestTemplate = template.Must(template.New("property-test").Parse(propertyTestTemplateSrc))
+	serviceMainTemplate  = template.Must(template.New("service-main").Parse(serviceMainTemplateSrc))
+	dockerfileTemplate   = template.Must(template.New("dockerfile").Parse(dockerfileTemplateSrc))
+	composeTemplate      = template.Must(template.New("compose").Parse(composeTemplateSrc))
+	kubernetesTemplate   = template.Must(template.New("kubernetes").Parse(kubernetesTemplateSrc))
 )
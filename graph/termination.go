@@ -0,0 +1,193 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Ways Run can decide which goroutines to wait for, for Graph.Termination.
+const (
+	// WaitMarked waits for the nodes with Wait set.
+	WaitMarked = ""
+
+	// WaitSinks waits for the nodes at the ends of the pipeline: those
+	// whose output goes to no other node.
+	WaitSinks = "sinks"
+
+	// WaitAll waits for every node.
+	WaitAll = "all"
+)
+
+// Terminations lists the termination settings, with descriptions.
+var Terminations = []struct{ Value, Description string }{
+	{WaitMarked, "The goroutines marked Wait"},
+	{WaitSinks, "The goroutines at the ends of the pipeline"},
+	{WaitAll, "Every goroutine"},
+}
+
+// waited returns the nodes Run waits for.
+func (g *Graph) waited() map[*Node]bool {
+	w := make(map[*Node]bool, len(g.Nodes))
+	switch g.Termination {
+	case WaitSinks:
+		// Whole components, so that a cycle at the end is waited for.
+		arcs := g.arcs()
+		for _, comp := range g.components() {
+			in := make(map[*Node]bool, len(comp))
+			for _, n := range comp {
+				in[n] = true
+			}
+			sink := true
+			for _, n := range comp {
+				for _, a := range arcs[n.Name] {
+					if !in[a.to] {
+						sink = false
+					}
+				}
+			}
+			if sink {
+				for _, n := range comp {
+					w[n] = true
+				}
+			}
+		}
+	case WaitAll:
+		for _, n := range g.Nodes {
+			w[n] = true
+		}
+	default:
+		for _, n := range g.Nodes {
+			if n.Wait {
+				w[n] = true
+			}
+		}
+	}
+	for n := range w {
+		if n.Disabled {
+			delete(w, n)
+		}
+	}
+	return w
+}
+
+// Waited reports whether Run waits for the node to finish, which depends on
+// g.Termination.
+func (g *Graph) Waited(n *Node) bool { return g.waited()[n] }
+
+// AutoClosed returns the channels which Run closes once everything writing
+// to them has finished, sorted by name. These are the dead-letter channel,
+// and unless g.Termination is WaitMarked, the channels ranged over (or
+// outputs) which no node closes.
+func (g *Graph) AutoClosed() []string {
+	info, _ := g.closeAnalysis()
+	ends := g.channelEnds()
+	var cs []string
+	for _, c := range g.channelNames() {
+		ch, ci := g.Channels[c], info[c]
+		if c == g.DeadLetters {
+			// Only deadLetter sends to it (see checkDeadLetters).
+			if len(ends[c].writers) > 0 {
+				cs = append(cs, c)
+			}
+			continue
+		}
+		if g.Termination == WaitMarked {
+			continue
+		}
+		if ch.Boundary == Input || len(ci.closers) > 0 || len(ends[c].writers) == 0 {
+			continue
+		}
+		if len(ci.rangers) == 0 && ch.Boundary != Output {
+			// Closing could change what receivers see.
+			continue
+		}
+		bridged := false
+		for _, w := range ends[c].writers {
+			bridged = bridged || w.Disabled
+		}
+		if !bridged {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// AutoCloses returns the channels of g.AutoClosed that n writes to.
+func (g *Graph) AutoCloses(n *Node) []string {
+	if n.Disabled {
+		return nil
+	}
+	written := make(map[string]bool)
+	_, ws := g.activeChannels(n)
+	for _, c := range ws {
+		written[c] = true
+	}
+	var cs []string
+	for _, c := range g.AutoClosed() {
+		if written[c] {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// checkTermination looks for nodes Run doesn't wait for, where nothing
+// downstream is waited for either: Run can return (and the program exit)
+// while they are still handling what they receive.
+func checkTermination(g *Graph) []Diagnostic {
+	if len(g.Nodes) == 0 {
+		return nil
+	}
+	waited := g.waited()
+	if len(waited) == 0 {
+		return []Diagnostic{{
+			Severity: Warning,
+			Msg:      "Run doesn't wait for any goroutine, so it returns straight away",
+		}}
+	}
+	arcs := g.arcs()
+	// downstreamWaited reports whether n, or anything downstream of it, is
+	// waited for.
+	downstreamWaited := func(n *Node) bool {
+		seen := map[*Node]bool{n: true}
+		queue := []*Node{n}
+		for len(queue) > 0 {
+			m := queue[0]
+			queue = queue[1:]
+			if waited[m] {
+				return true
+			}
+			for _, a := range arcs[m.Name] {
+				if !seen[a.to] {
+					seen[a.to] = true
+					queue = append(queue, a.to)
+				}
+			}
+		}
+		return false
+	}
+	var ds []Diagnostic
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		if n.Disabled || len(g.DeclaredChannels(n.ChannelsRead())) == 0 {
+			continue
+		}
+		if !downstreamWaited(n) {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Node:     nn,
+				Msg:      "isn't waited for, and nor is anything downstream of it, so Run can return before it finishes and what it receives could be lost; wait for it, or for something after it",
+			})
+		}
+	}
+	return ds
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func waitedNames(g *Graph) []string {
+	var ns []string
+	for n := range g.waited() {
+		ns = append(ns, n.Name)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+func TestWaited(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"gen":   "a <- 1; close(a)",
+		"relay": "for x := range a { b <- x }; close(b)",
+		"sink":  "for range b {}",
+	})
+	g.Nodes["gen"].Wait = true
+
+	if got, want := waitedNames(g), []string{"gen"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("waited with WaitMarked = %v, want %v", got, want)
+	}
+	g.Termination = WaitSinks
+	if got, want := waitedNames(g), []string{"sink"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("waited with WaitSinks = %v, want %v", got, want)
+	}
+	g.Termination = WaitAll
+	if got, want := waitedNames(g), []string{"gen", "relay", "sink"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("waited with WaitAll = %v, want %v", got, want)
+	}
+}
+
+func TestAutoClosed(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen1": "a <- 1",
+		"gen2": "a <- 2",
+		"sink": "for range a {}",
+	})
+	g.Nodes["gen2"].Multiplicity = 3
+	if got := g.AutoClosed(); got != nil {
+		t.Errorf("AutoClosed with WaitMarked = %v, want nil", got)
+	}
+
+	g.Termination = WaitSinks
+	if got, want := g.AutoClosed(), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AutoClosed with WaitSinks = %v, want %v", got, want)
+	}
+	for _, d := range checkCloses(g) {
+		if d.Channel == "a" {
+			t.Errorf("checkCloses reported %v, but Run closes a", d)
+		}
+	}
+	var buf bytes.Buffer
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	code := buf.String()
+	for _, want := range []string{"aWriters.Add(3)", "defer aWriters.Done()", "aWriters.Wait()\n\t\tclose(a)"} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code doesn't contain %q:\n%s", want, code)
+		}
+	}
+
+	// Once something closes it, Run leaves it alone.
+	g.Nodes["gen1"].Part = testGraph(t, nil, map[string]string{"x": "a <- 1; close(a)"}).Nodes["x"].Part
+	if got := g.AutoClosed(); got != nil {
+		t.Errorf("AutoClosed with a closer = %v, want nil", got)
+	}
+}
+
+func TestCheckTermination(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0}, map[string]string{
+		"gen":  "a <- 1; close(a)",
+		"sink": "for range a {}",
+	})
+	got := checkTermination(g)
+	if len(got) != 1 || got[0].Node != "" {
+		t.Errorf("checkTermination with nothing waited = %v, want one graph warning", got)
+	}
+
+	g.Nodes["gen"].Wait = true
+	got = checkTermination(g)
+	if len(got) != 1 || got[0].Node != "sink" {
+		t.Errorf("checkTermination waiting for gen = %v, want a warning about sink", got)
+	}
+
+	g.Nodes["sink"].Wait = true
+	if got := checkTermination(g); len(got) != 0 {
+		t.Errorf("checkTermination waiting for both = %v, want none", got)
+	}
+
+	g.Nodes["gen"].Wait, g.Nodes["sink"].Wait = false, false
+	g.Termination = WaitSinks
+	if got := checkTermination(g); len(got) != 0 {
+		t.Errorf("checkTermination with WaitSinks = %v, want none", got)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+// Theme is a set of colours for the diagram and the pages around it. Colours
+// are anything both Graphviz and CSS understand, e.g. "#rrggbb".
+type Theme struct {
+	Name string
+
+	Background string
+	Foreground string // Text, lines, and channels.
+	Disabled   string // Disabled goroutines.
+	Link       string
+	Error      string
+	Warning    string
+	Panel      string // Background of code on pages.
+
+	// PartColors is whether goroutines are filled according to their part
+	// type (see parts.StyleOf). If not, they are all filled with NodeFill.
+	PartColors bool
+	NodeFill   string
+	NodeText   string
+
+	CommentFill string
+	PenWidth    float64 // Thickness of edges and outlines.
+}
+
+// Fill returns the fill colour for a node with the given style.
+func (t *Theme) Fill(s parts.Style) string {
+	if t.PartColors {
+		return s.Color
+	}
+	return t.NodeFill
+}
+
+// Themes are the available themes, by name.
+var Themes = map[string]*Theme{
+	"light": {
+		Name:        "light",
+		Background:  "#ffffff",
+		Foreground:  "#000000",
+		Disabled:    "#999999",
+		Link:        "#0000ee",
+		Error:       "#cc0000",
+		Warning:     "#bb6600",
+		Panel:       "#f4f4f4",
+		PartColors:  true,
+		NodeFill:    "#ffffff",
+		NodeText:    "#000000",
+		CommentFill: "lightyellow",
+		PenWidth:    1,
+	},
+	"dark": {
+		Name:        "dark",
+		Background:  "#1e1e1e",
+		Foreground:  "#dddddd",
+		Disabled:    "#777777",
+		Link:        "#8ab4f8",
+		Error:       "#ff6666",
+		Warning:     "#ffbb33",
+		Panel:       "#2a2a2a",
+		PartColors:  true, // The fills are light enough for NodeText.
+		NodeFill:    "#ffffff",
+		NodeText:    "#000000",
+		CommentFill: "#555533",
+		PenWidth:    1,
+	},
+	"high-contrast": {
+		Name:        "high-contrast",
+		Background:  "#000000",
+		Foreground:  "#ffffff",
+		Disabled:    "#bbbbbb",
+		Link:        "#ffff00",
+		Error:       "#ff8080",
+		Warning:     "#ffff00",
+		Panel:       "#000000",
+		PartColors:  false,
+		NodeFill:    "#000000",
+		NodeText:    "#ffffff",
+		CommentFill: "#000000",
+		PenWidth:    2,
+	},
+}
+
+// DefaultTheme is used until another is chosen.
+const DefaultTheme = "light"
+
+var currentTheme = struct {
+	sync.Mutex
+	*Theme
+}{Theme: Themes[DefaultTheme]}
+
+// ThemeNames returns the names of the available themes, sorted.
+func ThemeNames() []string {
+	ns := make([]string, 0, len(Themes))
+	for n := range Themes {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+// CurrentTheme returns the theme in use.
+func CurrentTheme() *Theme {
+	currentTheme.Lock()
+	defer currentTheme.Unlock()
+	return currentTheme.Theme
+}
+
+// Theme returns the theme in use. It is a convenience for the templates.
+func (g *Graph) Theme() *Theme { return CurrentTheme() }
+
+// themePath returns the file the user's choice of theme is stored in.
+func themePath() (string, error) {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "shenzhen-go", "theme"), nil
+}
+
+// LoadTheme uses the theme the user chose last (with SetTheme), if any.
+func LoadTheme() error {
+	p, err := themePath()
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSpace(string(b))
+	t, ok := Themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q in %s", name, p)
+	}
+	currentTheme.Lock()
+	currentTheme.Theme = t
+	currentTheme.Unlock()
+	return nil
+}
+
+// SetTheme changes the theme in use, and saves the choice for next time.
+func SetTheme(name string) error {
+	t, ok := Themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q", name)
+	}
+	currentTheme.Lock()
+	currentTheme.Theme = t
+	currentTheme.Unlock()
+	p, err := themePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, []byte(name+"\n"), 0644)
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestThemesComplete(t *testing.T) {
+	for name, th := range Themes {
+		if th.Name != name {
+			t.Errorf("Themes[%q].Name = %q", name, th.Name)
+		}
+		v := reflect.ValueOf(th).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.Kind() == reflect.String && f.String() == "" {
+				t.Errorf("Themes[%q].%s is empty", name, v.Type().Field(i).Name)
+			}
+		}
+	}
+	if Themes[DefaultTheme] == nil {
+		t.Errorf("DefaultTheme %q is not in Themes", DefaultTheme)
+	}
+}
+
+func TestSetTheme(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if err := SetTheme("dark"); err != nil {
+		t.Fatalf("SetTheme(dark) = %v", err)
+	}
+	currentTheme.Theme = Themes[DefaultTheme]
+	if err := LoadTheme(); err != nil {
+		t.Fatalf("LoadTheme() = %v", err)
+	}
+	if got := CurrentTheme().Name; got != "dark" {
+		t.Errorf("after LoadTheme, CurrentTheme().Name = %q, want dark", got)
+	}
+	if err := SetTheme("plaid"); err == nil {
+		t.Error("SetTheme(plaid) = nil, want error")
+	}
+	currentTheme.Theme = Themes[DefaultTheme]
+}
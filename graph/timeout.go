@@ -0,0 +1,222 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"time"
+)
+
+// What a goroutine does when a message takes too long, for Timeout.Action.
+const (
+	// TimeoutSkip gives up on the message and carries on.
+	TimeoutSkip = ""
+
+	// TimeoutError also sends an error to the Errors channel.
+	TimeoutError = "error"
+
+	// TimeoutCancel cancels the whole run: Run returns without waiting
+	// for the rest of the goroutines.
+	TimeoutCancel = "cancel"
+)
+
+// TimeoutActions lists the timeout actions, with descriptions.
+var TimeoutActions = []struct{ Value, Description string }{
+	{TimeoutSkip, "Skip the message"},
+	{TimeoutError, "Send an error to a channel"},
+	{TimeoutCancel, "Cancel the whole run"},
+}
+
+// Timeout limits how long the goroutines of a node spend on each message.
+// The generated code gives them withTimeout, which runs a function with a
+// context.WithTimeout context, and reports whether it finished in time.
+// Once the time is up it still waits for the function to return, so the
+// function should give up when the context is done, including on sends:
+//
+//	for x := range in {
+//		withTimeout(func(ctx context.Context) {
+//			select {
+//			case out <- work(ctx, x):
+//			case <-ctx.Done():
+//			}
+//		})
+//	}
+type Timeout struct {
+	Duration string `json:"duration,omitempty"` // As for time.ParseDuration.
+	Action   string `json:"action,omitempty"`
+	Errors   string `json:"errors,omitempty"` // The chan error for TimeoutError.
+}
+
+// IsZero reports whether there is no timeout.
+func (t Timeout) IsZero() bool { return t.Duration == "" }
+
+func (t Timeout) String() string {
+	if t.IsZero() {
+		return "none"
+	}
+	switch t.Action {
+	case TimeoutError:
+		return fmt.Sprintf("%s, then send an error to %s", t.Duration, t.Errors)
+	case TimeoutCancel:
+		return fmt.Sprintf("%s, then cancel the run", t.Duration)
+	}
+	return fmt.Sprintf("%s, then skip the message", t.Duration)
+}
+
+// Source returns the duration as Go source, in the largest unit that
+// divides it, e.g. "90 * time.Second".
+func (t Timeout) Source() string {
+	d, err := time.ParseDuration(t.Duration)
+	if err != nil {
+		// Reported by checkTimeouts.
+		return "0"
+	}
+	for _, u := range []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "Hour"},
+		{time.Minute, "Minute"},
+		{time.Second, "Second"},
+		{time.Millisecond, "Millisecond"},
+		{time.Microsecond, "Microsecond"},
+	} {
+		if d%u.d == 0 {
+			return fmt.Sprintf("%d * time.%s", d/u.d, u.name)
+		}
+	}
+	return fmt.Sprintf("%d * time.Nanosecond", d)
+}
+
+// NodeTimesOut reports whether n has a timeout that its code uses, so that
+// its goroutines get withTimeout.
+func (g *Graph) NodeTimesOut(n *Node) bool {
+	return !n.Disabled && !n.Timeout.IsZero() && n.refersTo("withTimeout")
+}
+
+// TimeoutPrologue returns the code declaring withTimeout for the goroutines
+// of n, or "" if they don't use it. withTimeout never returns before f does,
+// so f can't send on channels the goroutine closes afterwards.
+func (g *Graph) TimeoutPrologue(n *Node) string {
+	if !g.NodeTimesOut(n) {
+		return ""
+	}
+	t := n.Timeout
+	var action string
+	if g.UsesLogging() {
+		action += fmt.Sprintf("logger.Warn(\"gave up on a message\", \"node\", %q, \"after\", %s)\n", n.Name, t.Source())
+	}
+	switch t.Action {
+	case TimeoutError:
+		action += fmt.Sprintf("%s <- fmt.Errorf(\"%%s: gave up on a message after %%v\", %q, %s)\n", t.Errors, n.Name, t.Source())
+	case TimeoutCancel:
+		action += "cancel()\n"
+	}
+	if action != "" {
+		action = "if ctx.Err() == context.DeadlineExceeded {\n" + action + "}\n"
+	}
+	return fmt.Sprintf(`withTimeout := func(f func(ctx context.Context)) bool {
+	ctx, stop := context.WithTimeout(ctx, %s)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(ctx)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+	}
+	%s<-done
+	return false
+}`, t.Source(), action)
+}
+
+// UsesTimeouts reports whether any node uses withTimeout, so that Run has a
+// context for them.
+func (g *Graph) UsesTimeouts() bool {
+	for _, n := range g.Nodes {
+		if g.NodeTimesOut(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// CancelsRun reports whether any goroutine can cancel the run, in which case
+// Run stops waiting once the run is cancelled.
+func (g *Graph) CancelsRun() bool {
+	for _, n := range g.Nodes {
+		if g.NodeTimesOut(n) && n.Timeout.Action == TimeoutCancel {
+			return true
+		}
+	}
+	return false
+}
+
+// timeoutImports returns the packages the generated timeouts use.
+func (g *Graph) timeoutImports() []string {
+	if !g.UsesTimeouts() {
+		return nil
+	}
+	imps := []string{"context", "time"}
+	for _, n := range g.Nodes {
+		if g.NodeTimesOut(n) && n.Timeout.Action == TimeoutError {
+			return append(imps, "fmt")
+		}
+	}
+	return imps
+}
+
+// checkTimeouts reports timeouts that can't work, or that the code of the
+// node never uses.
+func checkTimeouts(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		t := n.Timeout
+		if t.IsZero() {
+			continue
+		}
+		errorf := func(format string, args ...interface{}) {
+			ds = append(ds, Diagnostic{Severity: Error, Node: nn, Msg: fmt.Sprintf(format, args...)})
+		}
+		if d, err := time.ParseDuration(t.Duration); err != nil {
+			errorf("timeout %q is not a duration", t.Duration)
+		} else if d <= 0 {
+			errorf("timeout %s is not positive", t.Duration)
+		}
+		switch t.Action {
+		case TimeoutSkip, TimeoutCancel:
+		case TimeoutError:
+			if c, ok := g.Channels[t.Errors]; !ok {
+				errorf("timeout errors go to %q, which is not a channel", t.Errors)
+			} else if c.Type != "error" {
+				errorf("timeout errors go to %s, which is a chan %s, not a chan error", t.Errors, c.Type)
+			}
+		default:
+			errorf("unknown timeout action %q", t.Action)
+		}
+		if !n.Disabled && !g.NodeTimesOut(n) {
+			ds = append(ds, Diagnostic{
+				Severity: Warning,
+				Node:     nn,
+				Msg:      "the goroutine has a timeout, but its code never calls withTimeout, so it has no effect",
+			})
+		}
+	}
+	return ds
+}
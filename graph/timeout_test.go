@@ -0,0 +1,130 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestTimeoutSource(t *testing.T) {
+	for _, test := range []struct{ in, want string }{
+		{"1h", "1 * time.Hour"},
+		{"90s", "90 * time.Second"},
+		{"1.5s", "1500 * time.Millisecond"},
+		{"3ns", "3 * time.Nanosecond"},
+	} {
+		if got := (Timeout{Duration: test.in}).Source(); got != test.want {
+			t.Errorf("Timeout{%q}.Source() = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"gen":  "a <- 1; close(a)",
+		"work": "for x := range a { withTimeout(func(ctx context.Context) { b <- x }) }; close(b)",
+		"sink": "for range b {}",
+	})
+	g.Channels["errs"] = &Channel{Name: "errs", Type: "error"}
+	g.Nodes["work"].Timeout = Timeout{Duration: "2s", Action: TimeoutError, Errors: "errs"}
+	g.Nodes["sink"].Timeout = Timeout{Duration: "1m", Action: TimeoutCancel}
+
+	if got := g.Nodes["work"].ChannelsWritten(); len(got) != 2 || got[1] != "errs" {
+		t.Errorf("work.ChannelsWritten() = %v, want [b errs]", got)
+	}
+	if !g.NodeTimesOut(g.Nodes["work"]) || g.NodeTimesOut(g.Nodes["sink"]) {
+		t.Error("NodeTimesOut should only be true for work, which calls withTimeout")
+	}
+	if g.CancelsRun() {
+		t.Error("CancelsRun() = true, but sink never calls withTimeout")
+	}
+	ds := checkTimeouts(g)
+	if len(ds) != 1 || ds[0].Node != "sink" || ds[0].Severity != Warning {
+		t.Errorf("checkTimeouts = %v, want one warning for sink", ds)
+	}
+	errs, err := g.TypeCheckNode(g.Nodes["work"])
+	if err != nil {
+		t.Fatalf("TypeCheckNode(work) = %v", err)
+	}
+	if len(errs) > 0 {
+		t.Errorf("TypeCheckNode(work) = %v, want no errors", errs)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteGoTo(&buf); err != nil {
+		t.Fatalf("WriteGoTo = %v", err)
+	}
+	code := buf.String()
+	for _, want := range []string{
+		`"context"`,
+		"ctx, cancel := context.WithCancel(context.Background())",
+		"context.WithTimeout(ctx, 2*time.Second)",
+		`errs <- fmt.Errorf("%s: gave up on a message after %v", "work", 2*time.Second)`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code doesn't contain %q:\n%s", want, code)
+		}
+	}
+
+	if err := g.RenameChannel("errs", "problems"); err != nil {
+		t.Fatalf("RenameChannel(errs, problems) = %v", err)
+	}
+	if got := g.Nodes["work"].Timeout.Errors; got != "problems" {
+		t.Errorf("timeout errors go to %q after renaming, want problems", got)
+	}
+}
+
+func TestTimeoutWaits(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and runs a program")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go tool")
+	}
+	// The first send outlasts the timeout, and the goroutine closes b as soon
+	// as it is done, then lingers so that a late send would panic.
+	g := testGraph(t, map[string]int{"a": 0, "b": 0}, map[string]string{
+		"work": `for x := range a {
+			if !withTimeout(func(ctx context.Context) { time.Sleep(300 * time.Millisecond); b <- x }) {
+				fmt.Println("timed out")
+			}
+			withTimeout(func(ctx context.Context) {
+				select {
+				case b <- -x:
+				case <-ctx.Done():
+				}
+			})
+		}
+		close(b)
+		time.Sleep(500 * time.Millisecond)`,
+	})
+	g.Imports = []string{"fmt", "time"}
+	g.Nodes["work"].Timeout = Timeout{Duration: "50ms"}
+
+	var stdout, stderr bytes.Buffer
+	if err := g.RunScratch(context.Background(), "work", map[string][]string{"a": {"1"}}, &stdout, &stderr); err != nil {
+		t.Fatalf("RunScratch = %v:\n%s", err, stderr.String())
+	}
+	// The node's output and what it sends are printed by different goroutines.
+	for _, want := range []string{"b: 1\n", "timed out\n", "b: -1\n"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("RunScratch printed %q, want it to contain %q", stdout.String(), want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// channelEnds records the nodes at either end of a channel.
+type channelEnds struct {
+	readers, writers []*Node
+}
+
+// channelEnds finds the readers and writers of every declared channel, in
+// the generated code (so disabled nodes are left out, unless they bridge).
+// Nodes are listed in name order.
+func (g *Graph) channelEnds() map[string]*channelEnds {
+	ends := make(map[string]*channelEnds, len(g.Channels))
+	for c := range g.Channels {
+		ends[c] = new(channelEnds)
+	}
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		rs, ws := g.activeChannels(n)
+		for _, c := range rs {
+			ends[c].readers = append(ends[c].readers, n)
+		}
+		for _, c := range ws {
+			ends[c].writers = append(ends[c].writers, n)
+		}
+	}
+	return ends
+}
+
+// Readers returns the nodes which read from the channel, in name order.
+func (g *Graph) Readers(channel string) []*Node {
+	if e := g.channelEnds()[channel]; e != nil {
+		return e.readers
+	}
+	return nil
+}
+
+// Writers returns the nodes which write to the channel, in name order.
+func (g *Graph) Writers(channel string) []*Node {
+	if e := g.channelEnds()[channel]; e != nil {
+		return e.writers
+	}
+	return nil
+}
+
+// arc is a connection from one node to another via a channel.
+type arc struct {
+	from, to *Node
+	channel  string
+}
+
+// arcs returns all connections between nodes, grouped by the writing node.
+func (g *Graph) arcs() map[string][]arc {
+	ends := g.channelEnds()
+	out := make(map[string][]arc)
+	for _, c := range g.channelNames() {
+		e := ends[c]
+		for _, w := range e.writers {
+			for _, r := range e.readers {
+				out[w.Name] = append(out[w.Name], arc{from: w, to: r, channel: c})
+			}
+		}
+	}
+	return out
+}
+
+// components finds the strongly connected components of the graph of nodes
+// (using Tarjan's algorithm). Within each component, every node can reach every
+// other node, so a component with more than one node contains a cycle.
+// Components are returned in reverse topological order.
+func (g *Graph) components() [][]*Node {
+	arcs := g.arcs()
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []*Node
+	var comps [][]*Node
+
+	var strongConnect func(n *Node)
+	strongConnect = func(n *Node) {
+		index[n.Name] = len(index)
+		low[n.Name] = index[n.Name]
+		stack = append(stack, n)
+		onStack[n.Name] = true
+
+		for _, a := range arcs[n.Name] {
+			m := a.to
+			if _, seen := index[m.Name]; !seen {
+				strongConnect(m)
+				if low[m.Name] < low[n.Name] {
+					low[n.Name] = low[m.Name]
+				}
+			} else if onStack[m.Name] && index[m.Name] < low[n.Name] {
+				low[n.Name] = index[m.Name]
+			}
+		}
+
+		if low[n.Name] != index[n.Name] {
+			return
+		}
+		var comp []*Node
+		for {
+			m := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[m.Name] = false
+			comp = append(comp, m)
+			if m == n {
+				break
+			}
+		}
+		comps = append(comps, comp)
+	}
+
+	for _, nn := range g.nodeNames() {
+		if _, seen := index[nn]; !seen {
+			strongConnect(g.Nodes[nn])
+		}
+	}
+	return comps
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// nodeContext returns the context the generated code puts the implementation
+// of a node in: the graph's imports, parameters, and declarations, every
+// channel declared at its type, and the instance number if there are multiple
+// instances.
+func (g *Graph) nodeContext(n *Node) (imports []string, vars, params []source.Var) {
+	all := g.AllImports()
+	imports = make([]string, 0, len(all)+1)
+	hasSync, hasContext := false, false
+	for _, i := range all {
+		imports = append(imports, i)
+		hasSync = hasSync || i == "sync"
+		hasContext = hasContext || i == "context"
+	}
+	if !hasSync {
+		// The generated code always imports sync.
+		imports = append(imports, "sync")
+	}
+	if !hasContext && !n.Timeout.IsZero() {
+		// withTimeout needs it, and using withTimeout imports it.
+		imports = append(imports, "context")
+	}
+
+	vars = make([]source.Var, 0, len(g.Channels))
+	for _, c := range g.Channels {
+		vars = append(vars, source.Var{Name: c.Name, Type: c.ParamType()})
+	}
+	// Map ordering is random, but error ordering shouldn't be.
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	vars = append(g.paramDecls(nil), vars...)
+	if g.UsesLogging() {
+		vars = append(vars, source.Var{Name: "logger", Type: "*slog.Logger"})
+	}
+	for _, d := range g.AllDeclarations() {
+		vars = append(vars, source.Var{Decl: "source", Value: d})
+	}
+
+	if n.Multiplicity > 1 {
+		params = append(params, source.Var{Name: "instanceNumber", Type: "int"})
+	}
+	if g.DeadLetters != "" {
+		params = append(params, source.Var{Name: "deadLetter", Type: "func(item interface{}, err error)"})
+	}
+	if !n.Timeout.IsZero() {
+		params = append(params, source.Var{Name: "withTimeout", Type: "func(func(ctx context.Context)) bool"})
+	}
+	return imports, vars, params
+}
+
+// TypeCheckNode type-checks the implementation of a node in isolation, in the
+// same context the generated code would put it in.
+func (g *Graph) TypeCheckNode(n *Node) ([]source.Error, error) {
+	imps, vars, params := g.nodeContext(n)
+	return source.TypeCheck(n.Impl(), imps, vars, params)
+}
+
+// SyntaxCheckNode parses body as if it were the implementation of a node,
+// in the same context the generated code would put it in, and returns any
+// syntax errors.
+func (g *Graph) SyntaxCheckNode(n *Node, body string) ([]source.Error, error) {
+	imps, vars, params := g.nodeContext(n)
+	return source.SyntaxCheck(body, imps, vars, params)
+}
+
+// CompleteNode suggests completions for the identifier at the byte offset in
+// body, as if body were the implementation of n.
+func (g *Graph) CompleteNode(n *Node, body string, offset int) ([]source.Completion, error) {
+	imps, vars, params := g.nodeContext(n)
+	return source.Complete(body, offset, imps, vars, params)
+}
+
+// LintNode runs a linter command (e.g. "go vet") over the implementation of
+// a node, in the same context the generated code would put it in.
+func (g *Graph) LintNode(n *Node, linter []string) ([]source.Error, error) {
+	imps, vars, params := g.nodeContext(n)
+	return source.Lint(linter, n.Impl(), imps, vars, params)
+}
+
+// SuggestChannelType infers a likely element type for a channel, from the
+// values nodes send to it. The most common type sent wins. It returns "" if
+// nothing can be inferred.
+func (g *Graph) SuggestChannelType(channel string) string {
+	count := make(map[string]int)
+	best := ""
+	for _, nn := range g.nodeNames() {
+		n := g.Nodes[nn]
+		writes := false
+		for _, c := range n.ChannelsWritten() {
+			writes = writes || c == channel
+		}
+		if !writes {
+			continue
+		}
+		imps, vars, params := g.nodeContext(n)
+		for i, v := range vars {
+			if v.Name == channel {
+				vars = append(vars[:i], vars[i+1:]...)
+				break
+			}
+		}
+		ts, err := source.SendTypes(n.Impl(), imps, vars, params, channel)
+		if err != nil {
+			continue
+		}
+		for _, t := range ts {
+			count[t]++
+			if count[t] > count[best] {
+				best = t
+			}
+		}
+	}
+	return best
+}
+
+// CheckChannelType checks that t is a valid element type for a channel in
+// the graph: it must be syntactically a type, and any names in it must refer
+// to types from the imports, parameters, or declarations of the graph.
+func (g *Graph) CheckChannelType(t string) error {
+	if err := source.ParseType(t); err != nil {
+		return err
+	}
+	imps, _, _ := g.nodeContext(&Node{})
+	vars := append(g.paramDecls(nil), source.Var{Name: "_", Type: "chan " + t})
+	for _, d := range g.AllDeclarations() {
+		vars = append(vars, source.Var{Decl: "source", Value: d})
+	}
+	errs, err := source.TypeCheck("", imps, vars, nil)
+	if err != nil {
+		// Not being able to check isn't the type's fault.
+		return nil
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	return fmt.Errorf("invalid type %q: %s", t, strings.Join(msgs, "; "))
+}
+
+// checkChannelTypes reports channels with invalid types.
+func checkChannelTypes(g *Graph) []Diagnostic {
+	var ds []Diagnostic
+	for _, c := range g.channelNames() {
+		if err := g.CheckChannelType(g.Channels[c].Type); err != nil {
+			ds = append(ds, Diagnostic{Severity: Error, Channel: c, Msg: err.Error()})
+		}
+	}
+	return ds
+}
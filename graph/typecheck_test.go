@@ -0,0 +1,46 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "testing"
+
+func TestSuggestChannelType(t *testing.T) {
+	g := testGraph(t, map[string]int{"a": 0, "b": 0, "c": 0, "d": 0, "e": 0, "f": 0}, map[string]string{
+		"basic":     "a <- 1",
+		"composite": `b <- map[string][]int{"x": {1}}`,
+		"imported":  "c <- time.Second",
+		"tie1":      `d <- "s"`,
+		"tie2":      "d <- 1",
+		"most1":     "e <- 1",
+		"most2":     `e <- "s"; e <- "t"`,
+		"none":      "f <- nil; for range a {}",
+	})
+	g.Imports = []string{"time"}
+	tests := []struct {
+		channel, want string
+	}{
+		{"a", "int"},
+		{"b", "map[string][]int"},
+		{"c", "time.Duration"},
+		{"d", "string"}, // A tie goes to the first goroutine, by name.
+		{"e", "string"},
+		{"f", ""},
+	}
+	for _, test := range tests {
+		if got := g.SuggestChannelType(test.channel); got != test.want {
+			t.Errorf("SuggestChannelType(%q) = %q, want %q", test.channel, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/format"
+	"html/template"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+// counter is a part whose JSON has changed: format 0 was {"n": 3}, format 1
+// is {"count": 3, "output": "..."}.
+type counter struct {
+	Count  int    `json:"count"`
+	Output string `json:"output"`
+}
+
+func (c *counter) AssociateEditor(*template.Template) error { return nil }
+func (c *counter) Channels() (read, written []string)       { return nil, []string{c.Output} }
+func (c *counter) Impl() string                             { return "" }
+func (c *counter) RenameChannel(from, to string) error      { return nil }
+func (c *counter) Update(*http.Request) error               { return nil }
+func (c *counter) Validate() error                          { return nil }
+func (c *counter) TypeKey() string                          { return "TestCounter" }
+func (c *counter) PartFormat() int                          { return 1 }
+func (c *counter) UpgradeFrom(format int, raw json.RawMessage) (json.RawMessage, error) {
+	var old struct{ N int }
+	if err := json.Unmarshal(raw, &old); err != nil {
+		return nil, err
+	}
+	return json.Marshal(&counter{Count: old.N, Output: "out"})
+}
+
+func TestUpgradePart(t *testing.T) {
+	if err := parts.Register("TestCounter", func() interface{} { return new(counter) }, nil); err != nil {
+		t.Fatalf("parts.Register() = %v", err)
+	}
+	defer parts.Unregister("TestCounter")
+
+	n := new(Node)
+	if err := json.Unmarshal([]byte(`{"name": "c", "part_type": "TestCounter", "part": {"n": 3}}`), n); err != nil {
+		t.Fatalf("json.Unmarshal(format 0) = %v", err)
+	}
+	if c := n.Part.(*counter); c.Count != 3 || c.Output != "out" {
+		t.Errorf("upgraded part = %+v, want count 3, output out", c)
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(n); err != nil {
+		t.Fatalf("Encode() = %v", err)
+	}
+	if want := `"part_format":1`; !strings.Contains(buf.String(), want) {
+		t.Errorf("encoded node lacks %s: %s", want, buf.String())
+	}
+	m := new(Node)
+	if err := json.Unmarshal(buf.Bytes(), m); err != nil {
+		t.Fatalf("json.Unmarshal(format 1) = %v", err)
+	}
+	if c := m.Part.(*counter); c.Count != 3 {
+		t.Errorf("reloaded part = %+v, want count 3", c)
+	}
+
+	if err := json.Unmarshal([]byte(`{"name": "c", "part_type": "TestCounter", "part_format": 2, "part": {}}`), n); err == nil {
+		t.Error("json.Unmarshal(format 2) succeeded")
+	}
+}
+
+func TestUpgradeFilter(t *testing.T) {
+	for _, test := range []struct {
+		json    string
+		wantAll bool
+		want    []string // in order, in the generated code
+	}{
+		{
+			json: `{"name": "f", "part_type": "Filter", "part": {"input": "in", "paths": [{"pred": "x > 0", "output": "pos"}]}}`,
+			want: []string{"if x > 0 {", "pos <- x", "close(pos)"},
+		},
+		{
+			json:    `{"name": "f", "part_type": "Filter", "part": {"input": "in", "paths": [{"pred": "x > 0", "output": "pos"}, {"pred": "x > 9", "output": "big"}]}}`,
+			wantAll: true,
+			want:    []string{"if x > 0 {", "sent = true", "if x > 9 {", "close(pos)", "close(big)"},
+		},
+		{
+			json: `{"name": "f", "part_type": "Filter", "part_format": 1, "part": {"input": "in", "paths": [{"pred": "x > 0", "output": "pos"}, {"pred": "x < 0", "output": "neg"}], "default": "zero"}}`,
+			want: []string{"if x > 0 {", "} else if x < 0 {", "} else {", "zero <- x", "close(zero)"},
+		},
+	} {
+		n := new(Node)
+		if err := json.Unmarshal([]byte(test.json), n); err != nil {
+			t.Fatalf("json.Unmarshal(%s) = %v", test.json, err)
+		}
+		f := n.Part.(*parts.Filter)
+		if f.All != test.wantAll {
+			t.Errorf("%s: All = %t, want %t", test.json, f.All, test.wantAll)
+		}
+		impl := f.Impl()
+		if _, err := format.Source([]byte("package p\nfunc f() {\n" + impl + "\n}")); err != nil {
+			t.Errorf("%s: Impl() isn't Go: %v\n%s", test.json, err, impl)
+		}
+		rest := impl
+		for _, w := range test.want {
+			i := strings.Index(rest, w)
+			if i < 0 {
+				t.Errorf("%s: Impl() lacks %q in order:\n%s", test.json, w, impl)
+				break
+			}
+			rest = rest[i+len(w):]
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parts
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	html "html/template"
+	"net/http"
+	"net/url"
+	"text/template"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// Checks an Assert can make.
+const (
+	AssertPredicate     = "predicate"
+	AssertIncreasing    = "increasing"
+	AssertNonDecreasing = "non-decreasing"
+	AssertDecreasing    = "decreasing"
+	AssertNonIncreasing = "non-increasing"
+)
+
+// Things an Assert can do about a violation.
+const (
+	AssertLog   = "log"
+	AssertCount = "count"
+	AssertAbort = "abort"
+)
+
+// assertOrders maps ordering checks to the comparison each value must make
+// with the one before.
+var assertOrders = map[string]string{
+	AssertIncreasing:    "<",
+	AssertNonDecreasing: "<=",
+	AssertDecreasing:    ">",
+	AssertNonIncreasing: ">=",
+}
+
+const assertTmplSrc = `{{if eq .Action "count"}}violations := 0
+{{end -}}
+{{if .Ordered -}}
+if prev, ok := <-{{.Input}}; ok {
+    {{- if .Output}}
+    {{.Output}} <- prev
+    {{- end}}
+    for x := range {{.Input}} {
+        if !({{.Before}} {{.Op}} {{.After}}) {
+            {{template "violation" .}}
+        }
+        {{- if .Output}}
+        {{.Output}} <- x
+        {{- end}}
+        prev = x
+    }
+}
+{{- else -}}
+for x := range {{.Input}} {
+    if !({{.Expr}}) {
+        {{template "violation" .}}
+    }
+    {{- if .Output}}
+    {{.Output}} <- x
+    {{- end}}
+}
+{{- end}}
+{{- if eq .Action "count"}}
+if violations > 0 {
+    fmt.Fprintf(os.Stderr, "assert: %d values violated %s\n", violations, {{printf "%q" .String}})
+}
+{{- end}}
+{{- if .Output}}
+close({{.Output}})
+{{- end}}
+{{define "violation" -}}
+{{if eq .Action "count" -}}
+violations++
+{{- else -}}
+{{if .Ordered -}}
+fmt.Fprintf(os.Stderr, "assert: %v after %v violates %s\n", x, prev, {{printf "%q" .String}})
+{{- else -}}
+fmt.Fprintf(os.Stderr, "assert: %v violates %s\n", x, {{printf "%q" .String}})
+{{- end}}
+{{- if eq .Action "abort"}}
+            os.Exit(1)
+{{- end}}
+{{- end}}
+{{- end}}
+`
+
+var assertTmpl = template.Must(template.New("assert").Parse(assertTmplSrc))
+
+// Assert checks every value passing from its input to its output: that a
+// predicate is true of it, or that it is in order with the value before. It
+// documents (and enforces) what one stage expects of another.
+type Assert struct {
+	Input  string `json:"input"`
+	Output string `json:"output,omitempty"` // If unset, values are dropped.
+	Check  string `json:"check"`
+	Expr   string `json:"expr"`   // A predicate, or the key values are ordered by; the value is x.
+	Action string `json:"action"` // What to do about violations.
+}
+
+// assertSchema is all the editor needs to know.
+var assertSchema = Schema{
+	{Name: "input", Label: "Input", Kind: KindInput, Required: true},
+	{Name: "output", Label: "Output", Kind: KindOutput},
+	{Name: "check", Label: "Check", Kind: KindEnum, Default: AssertPredicate, Options: []string{
+		AssertPredicate, AssertIncreasing, AssertNonDecreasing, AssertDecreasing, AssertNonIncreasing,
+	}},
+	{Name: "expr", Label: "Expression", Kind: KindText, Required: true, Default: "x"},
+	{Name: "action", Label: "On violation", Kind: KindEnum, Default: AssertLog, Options: []string{
+		AssertLog, AssertCount, AssertAbort,
+	}},
+}
+
+// newAssert makes an Assert with the default check and action.
+func newAssert() interface{} {
+	a := new(Assert)
+	a.SetFieldValues(assertSchema.Defaults())
+	return a
+}
+
+// Schema describes the channels, check, and action.
+func (a *Assert) Schema() Schema { return assertSchema }
+
+// FieldValues returns the channels, check, and action.
+func (a *Assert) FieldValues() url.Values {
+	return url.Values{
+		"input":  {a.Input},
+		"output": {a.Output},
+		"check":  {a.Check},
+		"expr":   {a.Expr},
+		"action": {a.Action},
+	}
+}
+
+// SetFieldValues sets the channels, check, and action.
+func (a *Assert) SetFieldValues(vs url.Values) error {
+	a.Input, a.Output = vs.Get("input"), vs.Get("output")
+	a.Check, a.Expr, a.Action = vs.Get("check"), vs.Get("expr"), vs.Get("action")
+	return nil
+}
+
+// AssociateEditor adds a "part_view" template to the given template.
+func (a *Assert) AssociateEditor(tmpl *html.Template) error { return SchemaEditor(tmpl) }
+
+// Update sets the channels, check, and action from the given Request.
+func (a *Assert) Update(r *http.Request) error { return UpdateSchematic(a, r) }
+
+// Channels returns the input, and the output if there is one.
+func (a *Assert) Channels() (read, written []string) { return assertSchema.Channels(a.FieldValues()) }
+
+// Imports returns the packages the implementation uses.
+func (a *Assert) Imports() []string { return []string{"fmt", "os"} }
+
+// Ordered reports whether the check is of the order of values, rather than a
+// predicate.
+func (a *Assert) Ordered() bool { return assertOrders[a.Check] != "" }
+
+// Op returns the comparison ordered values must make with the one before.
+func (a *Assert) Op() string { return assertOrders[a.Check] }
+
+// Before returns the key of the value before, i.e. the expression applied to
+// prev instead of x.
+func (a *Assert) Before() string {
+	b, err := source.RenameIdent(a.Expr, "x", "prev")
+	if err != nil {
+		return a.Expr
+	}
+	return "(" + b + ")"
+}
+
+// After returns the key of the value.
+func (a *Assert) After() string { return "(" + a.Expr + ")" }
+
+// String describes the check, e.g. "x > 0" or "increasing by x.Time".
+func (a *Assert) String() string {
+	if !a.Ordered() {
+		return a.Expr
+	}
+	if a.Expr == "x" {
+		return a.Check
+	}
+	return a.Check + " by " + a.Expr
+}
+
+// Impl returns the content of a goroutine checking values.
+func (a *Assert) Impl() string {
+	b := new(bytes.Buffer)
+	assertTmpl.Execute(b, a)
+	return b.String()
+}
+
+// Validate checks the fields, and that the expression parses.
+func (a *Assert) Validate() error {
+	if err := ValidateSchematic(a); err != nil {
+		return err
+	}
+	if _, err := parser.ParseExpr(a.Expr); err != nil {
+		var es ConfigErrors
+		es.Add("Expression", fmt.Sprintf("%q is not an expression: %v", a.Expr, err))
+		return es.Err()
+	}
+	return nil
+}
+
+// RenameChannel changes the channels, and any use in the expression.
+func (a *Assert) RenameChannel(from, to string) error {
+	vs := a.FieldValues()
+	if err := a.Schema().RenameChannel(vs, from, to); err != nil {
+		return err
+	}
+	return a.SetFieldValues(vs)
+}
+
+// Render shows the check under the node's name.
+func (a *Assert) Render() Rendering { return Rendering{Lines: []string{a.String()}} }
+
+// TypeKey returns "Assert".
+func (*Assert) TypeKey() string { return "Assert" }
@@ -15,8 +15,10 @@
 package parts
 
 import (
+	"fmt"
 	"html/template"
 	"net/http"
+	"strings"
 
 	"github.com/google/shenzhen-go/source"
 )
@@ -47,6 +49,44 @@ func (c *Code) Update(r *http.Request) error {
 	if r != nil {
 		code = r.FormValue("Code")
 	}
+	// Keep the code even if it is broken, so it can be fixed.
+	c.Code = code
+	s, d, err := source.ExtractChannelIdents(code)
+	if err != nil {
+		return err
+	}
+	c.chansRd, c.chansWr = s, d
+	return nil
+}
+
+// Validate does nothing, since the code is parsed when it's updated, and
+// type-checked in the editor.
+func (c *Code) Validate() error { return nil }
+
+// RenameChannel rewrites the code to use the new channel name.
+func (c *Code) RenameChannel(from, to string) error {
+	code, err := source.RenameIdent(c.Code, from, to)
+	if err != nil {
+		return err
+	}
+	c.Code = code
+	return c.Update(nil)
+}
+
+// ConnectOutput adds placeholder code sending to the channel.
+func (c *Code) ConnectOutput(channel, elemType string) error {
+	return c.appendCode(fmt.Sprintf("// TODO: send real values.\n%s <- *new(%s)", channel, elemType))
+}
+
+// ConnectInput adds placeholder code receiving from the channel.
+func (c *Code) ConnectInput(channel, elemType string) error {
+	return c.appendCode(fmt.Sprintf("for v := range %s {\n\t_ = v // TODO: use the values.\n}", channel))
+}
+
+func (c *Code) appendCode(code string) error {
+	if strings.TrimSpace(c.Code) != "" {
+		code = strings.TrimRight(c.Code, "\n") + "\n" + code
+	}
 	s, d, err := source.ExtractChannelIdents(code)
 	if err != nil {
 		return err
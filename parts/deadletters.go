@@ -0,0 +1,123 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parts
+
+import (
+	"bytes"
+	html "html/template"
+	"net/http"
+	"net/url"
+	"text/template"
+)
+
+const deadLetterFileTmplSrc = `dlFile, err := os.OpenFile({{.Path}}, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+if err != nil {
+    fmt.Fprintf(os.Stderr, "dead letters: %v\n", err)
+    // Keep senders from blocking.
+    for range {{.Input}} {
+    }
+    return
+}
+defer dlFile.Close()
+dlEnc := json.NewEncoder(dlFile)
+for dl := range {{.Input}} {
+    dlRec := struct {
+        Time  time.Time   ` + "`json:\"time\"`" + `
+        Node  string      ` + "`json:\"node\"`" + `
+        Error string      ` + "`json:\"error\"`" + `
+        Item  interface{} ` + "`json:\"item\"`" + `
+    }{time.Now(), dl.Node, "", dl.Item}
+    if dl.Err != nil {
+        dlRec.Error = dl.Err.Error()
+    }
+    if err := dlEnc.Encode(dlRec); err != nil {
+        // The item doesn't marshal, so write what it prints as.
+        dlRec.Item = fmt.Sprintf("%+v", dl.Item)
+        dlEnc.Encode(dlRec)
+    }
+}
+`
+
+var deadLetterFileTmpl = template.Must(template.New("deadLetterFile").Parse(deadLetterFileTmplSrc))
+
+// DeadLetterFile appends the dead letters it reads to a file, one JSON object
+// per line. Its input is usually the graph's dead-letter channel.
+type DeadLetterFile struct {
+	Input string `json:"input"`
+	Path  string `json:"path"` // A Go string expression.
+}
+
+// deadLetterFileSchema is all the editor needs to know.
+var deadLetterFileSchema = Schema{
+	{Name: "input", Label: "Input", Kind: KindInput, Required: true},
+	{Name: "path", Label: "File", Kind: KindText, Required: true, Default: `"dead_letters.jsonl"`},
+}
+
+// newDeadLetterFile makes a DeadLetterFile with the default file.
+func newDeadLetterFile() interface{} {
+	d := new(DeadLetterFile)
+	d.SetFieldValues(deadLetterFileSchema.Defaults())
+	return d
+}
+
+// Schema describes the input and file.
+func (d *DeadLetterFile) Schema() Schema { return deadLetterFileSchema }
+
+// FieldValues returns the input and file.
+func (d *DeadLetterFile) FieldValues() url.Values {
+	return url.Values{"input": {d.Input}, "path": {d.Path}}
+}
+
+// SetFieldValues sets the input and file.
+func (d *DeadLetterFile) SetFieldValues(vs url.Values) error {
+	d.Input, d.Path = vs.Get("input"), vs.Get("path")
+	return nil
+}
+
+// AssociateEditor adds a "part_view" template to the given template.
+func (d *DeadLetterFile) AssociateEditor(tmpl *html.Template) error { return SchemaEditor(tmpl) }
+
+// Update sets the input and file from the given Request.
+func (d *DeadLetterFile) Update(r *http.Request) error { return UpdateSchematic(d, r) }
+
+// Channels returns the input.
+func (d *DeadLetterFile) Channels() (read, written []string) { return []string{d.Input}, nil }
+
+// Imports returns the packages the implementation uses.
+func (d *DeadLetterFile) Imports() []string {
+	return []string{"encoding/json", "fmt", "os", "time"}
+}
+
+// Impl returns the content of a goroutine writing the dead letters.
+func (d *DeadLetterFile) Impl() string {
+	b := new(bytes.Buffer)
+	deadLetterFileTmpl.Execute(b, d)
+	return b.String()
+}
+
+// Validate checks there are an input and a file.
+func (d *DeadLetterFile) Validate() error { return ValidateSchematic(d) }
+
+// RenameChannel changes the input, and any use in the file expression.
+func (d *DeadLetterFile) RenameChannel(from, to string) error {
+	vs := d.FieldValues()
+	if err := d.Schema().RenameChannel(vs, from, to); err != nil {
+		return err
+	}
+	return d.SetFieldValues(vs)
+}
+
+// TypeKey returns "DeadLetterFile".
+func (*DeadLetterFile) TypeKey() string { return "DeadLetterFile" }
@@ -13,4 +13,23 @@
 // limitations under the License.
 
 // Package parts contains various pre-made bits and pieces to combine into the graph.
+//
+// It is also how other part types are added. A part is a type implementing
+// graph.Part (marshalled to JSON for saving), registered with Register. Its
+// Validate method should report problems as ConfigErrors, which the editor
+// shows field by field. Parts which describe their settings with a Schema
+// (see Schematic) get their editor, form handling, and validation for free.
+// If a part's JSON form has to change, implement graph.Upgrader so graphs
+// saved in the old form keep loading. Parts
+// can be compiled in, or shipped as a Go plugin: a main package built with
+// "go build -buildmode=plugin", against the same version of shenzhen-go,
+// which exports a RegisterParts function:
+//
+//	func RegisterParts() error {
+//		return parts.Register("Counter", func() interface{} { return new(Counter) }, nil)
+//	}
+//
+// Simpler parts need no Go compiler at all: see Spec. Plugins and specs in the
+// plugin directory (see PluginDir) are loaded at startup, and their part types
+// are offered when making a new goroutine.
 package parts
@@ -0,0 +1,56 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parts
+
+import "strings"
+
+// ConfigError is a problem with how a part is configured.
+type ConfigError struct {
+	Field string // The field concerned, as labelled in the editor, if any.
+	Msg   string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Field == "" {
+		return e.Msg
+	}
+	return e.Field + ": " + e.Msg
+}
+
+// ConfigErrors collects the problems with a part, so they can all be shown
+// at once.
+type ConfigErrors []*ConfigError
+
+func (es ConfigErrors) Error() string {
+	ss := make([]string, len(es))
+	for i, e := range es {
+		ss[i] = e.Error()
+	}
+	return strings.Join(ss, "; ")
+}
+
+// Add adds a problem with the field.
+func (es *ConfigErrors) Add(field, msg string) {
+	*es = append(*es, &ConfigError{Field: field, Msg: msg})
+}
+
+// Err returns es as an error, or nil if there are no problems. Validate
+// methods should return this, rather than es, so "no problems" is nil.
+func (es ConfigErrors) Err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es
+}
@@ -13,20 +13,41 @@ package parts
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"go/parser"
 	html "html/template"
 	"net/http"
 	"text/template"
+
+	"github.com/google/shenzhen-go/source"
 )
 
 const filterTemplateSrc = `for x := range {{.Input}} {
-    {{range .Paths -}}
+    {{- if .All}}
+    sent := false
+    {{- range .Paths}}
     if {{.Pred}} {
         {{.Output}} <- x
+        sent = true
+    }
+    {{- end}}
+    {{- with .Default}}
+    if !sent {
+        {{.}} <- x
+    }
+    {{- end}}
+    {{- else}}
+    {{range $i, $p := .Paths}}{{if $i}} else {{end}}if {{$p.Pred}} {
+        {{$p.Output}} <- x
+    }{{end}}
+    {{- with .Default}}{{if $.Paths}} else {{end}}{
+        {{.}} <- x
     }{{end}}
+    {{- end}}
 }
-{{- range .Paths}}
-close({{.Output}})
+{{- range .Outputs}}
+close({{.}})
 {{- end}}`
 
 var filterTemplate = template.Must(template.New("filter").Parse(filterTemplateSrc))
@@ -36,16 +57,21 @@ type pathway struct {
 	Output string `json:"output"`
 }
 
-// Filter tests values from the input and passes it on to one or more
-// outputs based on predicates.
+// Filter routes values from the input to outputs based on predicates. The
+// predicates are tried in order, and each value goes to the output of the
+// first which is true for it, or to the default output if none are.
 type Filter struct {
-	Input string    `json:"input"`
-	Paths []pathway `json:"paths"`
+	Input   string    `json:"input"`
+	Paths   []pathway `json:"paths"`
+	Default string    `json:"default,omitempty"`
+
+	// All sends each value to every output whose predicate is true for it,
+	// rather than only the first. Values matching none go to the default.
+	All bool `json:"all,omitempty"`
 }
 
 // AssociateEditor adds a "part_view" template to the given template.
 func (f *Filter) AssociateEditor(tmpl *html.Template) error {
-	// TODO: UI method of adjusting how many output paths there are.
 	_, err := tmpl.New("part_view").Parse(`<div class="formfield">
 		<label for="FilterInput">Input</label>
 		<select name="FilterInput">
@@ -56,30 +82,72 @@ func (f *Filter) AssociateEditor(tmpl *html.Template) error {
 	</div>
 	{{range $index, $path := .Node.Part.Paths}}
 	<fieldset>
+		<div class="formfield">
+			<label for="FilterPath{{$index}}Predicate">{{if $index}}Else if{{else}}If{{end}}</label>
+			<input type="text" name="FilterPath{{$index}}Predicate" value="{{$path.Pred}}">
+		</div>
 		<div class="formfield">
 			<label for="FilterPath{{$index}}Output">Output</label>
 			<select name="FilterPath{{$index}}Output">
+				<option value="">(remove)</option>
 				{{range $.Graph.Channels -}}
 				<option value="{{.Name}}" {{if eq .Name $path.Output}}selected{{end}}>{{.Name}}</option>
 				{{- end}}
 			</select>
 		</div>
+	</fieldset>
+	{{- end}}
+	<fieldset>
+		<div class="formfield">
+			<label for="FilterPath{{len .Node.Part.Paths}}Predicate">New path</label>
+			<input type="text" name="FilterPath{{len .Node.Part.Paths}}Predicate" placeholder="x > 0">
+		</div>
 		<div class="formfield">
-			<label for="FilterPath{{$index}}Predicate">Predicate</label>
-			<input type="text" name="FilterPath{{$index}}Predicate" required value="{{$path.Pred}}">
+			<label for="FilterPath{{len .Node.Part.Paths}}Output">Output</label>
+			<select name="FilterPath{{len .Node.Part.Paths}}Output">
+				<option value="" selected>(none)</option>
+				{{range .Graph.Channels -}}
+				<option value="{{.Name}}">{{.Name}}</option>
+				{{- end}}
+			</select>
 		</div>
 	</fieldset>
-	{{- end}}`)
+	<div class="formfield">
+		<label for="FilterDefault">Otherwise</label>
+		<select name="FilterDefault">
+			<option value="">(drop the value)</option>
+			{{range .Graph.Channels -}}
+			<option value="{{.Name}}" {{if eq .Name $.Node.Part.Default}}selected{{end}}>{{.Name}}</option>
+			{{- end}}
+		</select>
+	</div>
+	<div class="formfield">
+		<label for="FilterAll">Send to every matching output</label>
+		<input type="checkbox" name="FilterAll" {{if .Node.Part.All}}checked{{end}}>
+	</div>`)
 	return err
 }
 
-// Channels returns the names of all channels used by this goroutine.
-func (f *Filter) Channels() (read, written []string) {
-	o := make([]string, 0, len(f.Paths))
+// Outputs returns the output channels, each once, in order: those of the
+// paths, then the default.
+func (f *Filter) Outputs() []string {
+	o := make([]string, 0, len(f.Paths)+1)
+	seen := make(map[string]bool)
 	for _, p := range f.Paths {
-		o = append(o, p.Output)
+		if !seen[p.Output] {
+			seen[p.Output] = true
+			o = append(o, p.Output)
+		}
 	}
-	return []string{f.Input}, o
+	if f.Default != "" && !seen[f.Default] {
+		o = append(o, f.Default)
+	}
+	return o
+}
+
+// Channels returns the names of all channels used by this goroutine.
+func (f *Filter) Channels() (read, written []string) {
+	return []string{f.Input}, f.Outputs()
 }
 
 // Impl returns the content of a goroutine implementation.
@@ -95,18 +163,111 @@ func (f *Filter) Update(r *http.Request) error {
 		// No secret cached information to refresh.
 		return nil
 	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
 	f.Input = r.FormValue("FilterInput")
+	f.Default = r.FormValue("FilterDefault")
+	f.All = r.FormValue("FilterAll") != ""
 	f.Paths = nil
 	for i := 0; ; i++ {
-		out := r.FormValue(fmt.Sprintf("FilterPath%dOutput", i))
-		pred := r.FormValue(fmt.Sprintf("FilterPath%dPredicate", i))
-		if out == "" {
+		key := fmt.Sprintf("FilterPath%dOutput", i)
+		if _, ok := r.Form[key]; !ok {
 			break
 		}
-		f.Paths = append(f.Paths, pathway{Output: out, Pred: pred})
+		// Paths without an output are removed.
+		if out := r.FormValue(key); out != "" {
+			f.Paths = append(f.Paths, pathway{Output: out, Pred: r.FormValue(fmt.Sprintf("FilterPath%dPredicate", i))})
+		}
 	}
 	return nil
 }
 
+// Validate checks there are an input and some outputs, and that the
+// predicates are expressions.
+func (f *Filter) Validate() error {
+	var es ConfigErrors
+	if f.Input == "" {
+		es.Add("Input", "missing")
+	}
+	if len(f.Paths) == 0 && f.Default == "" {
+		es.Add("Output", "there are no outputs")
+	}
+	for i, p := range f.Paths {
+		if _, err := parser.ParseExpr(p.Pred); err != nil {
+			es.Add(fmt.Sprintf("Predicate %d", i+1), fmt.Sprintf("%q is not an expression: %v", p.Pred, err))
+		}
+	}
+	return es.Err()
+}
+
+// RenameChannel changes the input, outputs, and any predicates referring to
+// the channel.
+func (f *Filter) RenameChannel(from, to string) error {
+	if f.Input == from {
+		f.Input = to
+	}
+	if f.Default == from {
+		f.Default = to
+	}
+	for i := range f.Paths {
+		p := &f.Paths[i]
+		if p.Output == from {
+			p.Output = to
+		}
+		pred, err := source.RenameIdent(p.Pred, from, to)
+		if err != nil {
+			return err
+		}
+		p.Pred = pred
+	}
+	return nil
+}
+
+// ConnectOutput makes the channel the default output, if there isn't one
+// already, or else adds a pathway to the channel which passes nothing until
+// its predicate is edited.
+func (f *Filter) ConnectOutput(channel, elemType string) error {
+	if f.Default == "" {
+		f.Default = channel
+		return nil
+	}
+	f.Paths = append(f.Paths, pathway{Pred: "false", Output: channel})
+	return nil
+}
+
+// ConnectInput makes the channel the input, if there isn't one already.
+func (f *Filter) ConnectInput(channel, elemType string) error {
+	if f.Input != "" {
+		return fmt.Errorf("filter already has input %s", f.Input)
+	}
+	f.Input = channel
+	return nil
+}
+
+// PartFormat returns 1. Filters in format 0 sent values to every matching
+// output, and had no default.
+func (*Filter) PartFormat() int { return 1 }
+
+// UpgradeFrom upgrades a format 0 filter with several paths to send values to
+// every matching output, as it did before.
+func (*Filter) UpgradeFrom(format int, raw json.RawMessage) (json.RawMessage, error) {
+	f := new(Filter)
+	if err := json.Unmarshal(raw, f); err != nil {
+		return nil, err
+	}
+	f.All = len(f.Paths) > 1
+	return json.Marshal(f)
+}
+
+// Render gives each output its own port, and counts the pathways.
+func (f *Filter) Render() Rendering {
+	b := fmt.Sprintf("%d paths", len(f.Paths))
+	if len(f.Paths) == 1 {
+		b = "1 path"
+	}
+	return Rendering{Ports: true, Badge: b}
+}
+
 // TypeKey returns "Filter".
 func (*Filter) TypeKey() string { return "Filter" }
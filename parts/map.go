@@ -0,0 +1,163 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parts
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	html "html/template"
+	"net/http"
+	"net/url"
+	"text/template"
+)
+
+const mapTmplSrc = `for x := range {{.Input}} {
+    {{.Output}} <- {{.Expr}}
+}
+close({{.Output}})
+`
+
+var mapTmpl = template.Must(template.New("map").Parse(mapTmplSrc))
+
+// Property is something claimed of a function from values of one type to
+// another, which generated property-based tests check for many values.
+type Property struct {
+	Name string // For people, e.g. "idempotent".
+
+	// Expr is a Go boolean expression, true of every value x, and y, the
+	// result of applying the function (f) to it.
+	Expr string
+}
+
+// Map sends the result of an expression of each value from its input to its
+// output. Properties claimed of the expression are checked by generated
+// tests.
+type Map struct {
+	Input           string `json:"input"`
+	Output          string `json:"output"`
+	Expr            string `json:"expr"` // Of x.
+	Idempotent      bool   `json:"idempotent,omitempty"`
+	PreservesLength bool   `json:"preserves_length,omitempty"`
+	Property        string `json:"property,omitempty"` // Of x and y.
+}
+
+// mapSchema is all the editor needs to know.
+var mapSchema = Schema{
+	{Name: "input", Label: "Input", Kind: KindInput, Required: true},
+	{Name: "output", Label: "Output", Kind: KindOutput, Required: true},
+	{Name: "expr", Label: "Expression", Kind: KindText, Required: true, Default: "x"},
+	{Name: "idempotent", Label: "Idempotent", Kind: KindBool},
+	{Name: "preserves_length", Label: "Preserves length", Kind: KindBool},
+	{Name: "property", Label: "Property", Kind: KindText},
+}
+
+// newMap makes a Map with the default expression.
+func newMap() interface{} {
+	m := new(Map)
+	m.SetFieldValues(mapSchema.Defaults())
+	return m
+}
+
+// Schema describes the channels, expression, and properties.
+func (m *Map) Schema() Schema { return mapSchema }
+
+// FieldValues returns the channels, expression, and properties.
+func (m *Map) FieldValues() url.Values {
+	return url.Values{
+		"input":            {m.Input},
+		"output":           {m.Output},
+		"expr":             {m.Expr},
+		"idempotent":       {fmt.Sprint(m.Idempotent)},
+		"preserves_length": {fmt.Sprint(m.PreservesLength)},
+		"property":         {m.Property},
+	}
+}
+
+// SetFieldValues sets the channels, expression, and properties.
+func (m *Map) SetFieldValues(vs url.Values) error {
+	m.Input, m.Output, m.Expr = vs.Get("input"), vs.Get("output"), vs.Get("expr")
+	m.Idempotent = vs.Get("idempotent") == "true"
+	m.PreservesLength = vs.Get("preserves_length") == "true"
+	m.Property = vs.Get("property")
+	return nil
+}
+
+// AssociateEditor adds a "part_view" template to the given template.
+func (m *Map) AssociateEditor(tmpl *html.Template) error { return SchemaEditor(tmpl) }
+
+// Update sets the channels, expression, and properties from the given
+// Request.
+func (m *Map) Update(r *http.Request) error { return UpdateSchematic(m, r) }
+
+// Channels returns the input and output.
+func (m *Map) Channels() (read, written []string) { return mapSchema.Channels(m.FieldValues()) }
+
+// Mapping returns the input, output, and expression.
+func (m *Map) Mapping() (input, output, expr string) { return m.Input, m.Output, m.Expr }
+
+// Properties returns the properties claimed of the expression.
+func (m *Map) Properties() []Property {
+	var ps []Property
+	if m.Idempotent {
+		ps = append(ps, Property{"idempotent", "reflect.DeepEqual(f(y), y)"})
+	}
+	if m.PreservesLength {
+		ps = append(ps, Property{"preserves length", "len(y) == len(x)"})
+	}
+	if m.Property != "" {
+		ps = append(ps, Property{m.Property, m.Property})
+	}
+	return ps
+}
+
+// Impl returns the content of a goroutine applying the expression.
+func (m *Map) Impl() string {
+	b := new(bytes.Buffer)
+	mapTmpl.Execute(b, m)
+	return b.String()
+}
+
+// Validate checks the fields, and that the expression and property parse.
+func (m *Map) Validate() error {
+	if err := ValidateSchematic(m); err != nil {
+		return err
+	}
+	var es ConfigErrors
+	if _, err := parser.ParseExpr(m.Expr); err != nil {
+		es.Add("Expression", fmt.Sprintf("%q is not an expression: %v", m.Expr, err))
+	}
+	if m.Property != "" {
+		if _, err := parser.ParseExpr(m.Property); err != nil {
+			es.Add("Property", fmt.Sprintf("%q is not an expression: %v", m.Property, err))
+		}
+	}
+	return es.Err()
+}
+
+// RenameChannel changes the channels, and any use in the expressions.
+func (m *Map) RenameChannel(from, to string) error {
+	vs := m.FieldValues()
+	if err := m.Schema().RenameChannel(vs, from, to); err != nil {
+		return err
+	}
+	return m.SetFieldValues(vs)
+}
+
+// Render shows the expression under the node's name.
+func (m *Map) Render() Rendering { return Rendering{Lines: []string{"x → " + m.Expr}} }
+
+// TypeKey returns "Map".
+func (*Map) TypeKey() string { return "Map" }
@@ -16,6 +16,9 @@ package parts
 
 import (
 	"bytes"
+	html "html/template"
+	"net/http"
+	"net/url"
 	"text/template"
 )
 
@@ -44,6 +47,32 @@ type Multiplexer struct {
 	Output string   `json:"output"`
 }
 
+// multiplexerSchema is all the editor needs to know.
+var multiplexerSchema = Schema{
+	{Name: "inputs", Label: "Inputs", Kind: KindInputs, Required: true},
+	{Name: "output", Label: "Output", Kind: KindOutput, Required: true},
+}
+
+// Schema describes the inputs and output.
+func (m *Multiplexer) Schema() Schema { return multiplexerSchema }
+
+// FieldValues returns the inputs and output.
+func (m *Multiplexer) FieldValues() url.Values {
+	return url.Values{"inputs": m.Inputs, "output": {m.Output}}
+}
+
+// SetFieldValues sets the inputs and output.
+func (m *Multiplexer) SetFieldValues(vs url.Values) error {
+	m.Inputs, m.Output = vs["inputs"], vs.Get("output")
+	return nil
+}
+
+// AssociateEditor adds a "part_view" template to the given template.
+func (m *Multiplexer) AssociateEditor(tmpl *html.Template) error { return SchemaEditor(tmpl) }
+
+// Update sets the inputs and output from the given Request.
+func (m *Multiplexer) Update(r *http.Request) error { return UpdateSchematic(m, r) }
+
 // Channels returns the names of all channels used by this goroutine.
 func (m *Multiplexer) Channels() (read, written []string) { return m.Inputs, []string{m.Output} }
 
@@ -57,5 +86,24 @@ func (m *Multiplexer) Impl() string {
 // Refresh refreshes any cached information.
 func (m *Multiplexer) Refresh() error { return nil }
 
+// Validate checks there are some inputs and an output.
+func (m *Multiplexer) Validate() error { return ValidateSchematic(m) }
+
+// Render gives each input its own port.
+func (m *Multiplexer) Render() Rendering { return Rendering{Ports: true} }
+
+// RenameChannel changes any inputs or the output using the channel.
+func (m *Multiplexer) RenameChannel(from, to string) error {
+	for i, in := range m.Inputs {
+		if in == from {
+			m.Inputs[i] = to
+		}
+	}
+	if m.Output == from {
+		m.Output = to
+	}
+	return nil
+}
+
 // TypeKey returns "Multiplexer".
 func (*Multiplexer) TypeKey() string { return "Multiplexer" }
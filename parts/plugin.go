@@ -0,0 +1,59 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build (linux || darwin || freebsd) && cgo
+
+package parts
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// LoadPlugins loads each part plugin in dir, returning the paths of those
+// loaded. It keeps going after errors, returning the first.
+func LoadPlugins(dir string) ([]string, error) {
+	ps, err := pluginFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var loaded []string
+	var first error
+	for _, p := range ps {
+		if err := loadPlugin(p); err != nil {
+			if first == nil {
+				first = fmt.Errorf("plugin %s: %v", p, err)
+			}
+			continue
+		}
+		loaded = append(loaded, p)
+	}
+	return loaded, first
+}
+
+func loadPlugin(path string) error {
+	pl, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	sym, err := pl.Lookup("RegisterParts")
+	if err != nil {
+		return err
+	}
+	rp, ok := sym.(func() error)
+	if !ok {
+		return fmt.Errorf("RegisterParts is a %T, not a func() error", sym)
+	}
+	return rp()
+}
@@ -0,0 +1,29 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !((linux || darwin || freebsd) && cgo)
+
+package parts
+
+import "errors"
+
+// LoadPlugins would load the part plugins in dir, but Go plugins aren't
+// supported on this platform, so it fails if there are any.
+func LoadPlugins(dir string) ([]string, error) {
+	ps, err := pluginFiles(dir)
+	if err != nil || len(ps) == 0 {
+		return nil, err
+	}
+	return nil, errors.New("part plugins are not supported on this platform")
+}
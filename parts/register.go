@@ -0,0 +1,113 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// registry guards factories, styles and catalog, which plugins, specs and
+// macros add to while the editor is serving.
+var registry sync.RWMutex
+
+// Register adds a part type, so graphs can use it and the editor offers it.
+// f must make parts implementing graph.Part, whose TypeKey is typeKey. style
+// may be nil, for DefaultStyle. Describe the type with SetMetadata. It is an
+// error to register a type twice.
+func Register(typeKey string, f Factory, style *Style) error {
+	if typeKey == "" || f == nil {
+		return fmt.Errorf("part type %q: missing type key or factory", typeKey)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, found := factories[typeKey]; found {
+		return fmt.Errorf("part type %q is already registered", typeKey)
+	}
+	factories[typeKey] = f
+	if style != nil {
+		styles[typeKey] = *style
+	}
+	return nil
+}
+
+// Unregister removes a part type, with its style and metadata.
+func Unregister(typeKey string) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(factories, typeKey)
+	delete(styles, typeKey)
+	delete(catalog, typeKey)
+}
+
+// SetMetadata describes a part type, for Describe.
+func SetMetadata(typeKey string, m Metadata) {
+	registry.Lock()
+	defer registry.Unlock()
+	catalog[typeKey] = m
+}
+
+// Lookup returns the factory for a part type, if it is registered.
+func Lookup(typeKey string) (Factory, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	f, found := factories[typeKey]
+	return f, found
+}
+
+// StyleOf returns the style of a part type, if it has one.
+func StyleOf(typeKey string) (Style, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	s, found := styles[typeKey]
+	return s, found
+}
+
+// TypeKeys returns the registered part types, sorted.
+func TypeKeys() []string {
+	registry.RLock()
+	ks := make([]string, 0, len(factories))
+	for k := range factories {
+		ks = append(ks, k)
+	}
+	registry.RUnlock()
+	sort.Strings(ks)
+	return ks
+}
+
+// PluginExt is the file extension of part plugins.
+const PluginExt = ".so"
+
+// PluginDir returns the directory part plugins are loaded from by default.
+func PluginDir() (string, error) {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "shenzhen-go", "plugins"), nil
+}
+
+// pluginFiles lists the plugins in dir. A missing dir has no plugins.
+func pluginFiles(dir string) ([]string, error) {
+	ps, err := filepath.Glob(filepath.Join(dir, "*"+PluginExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ps)
+	return ps, nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A part registry is an index (a JSON file, served over HTTP or local) listing
+// part specs (see Spec) that can be installed into a project. Installed specs
+// are pinned: the project's lock file records the version, location, and
+// checksum of each, so everyone working on the project (and CI) gets exactly
+// the same parts.
+
+// ProjectDir is where a project's installed part specs are kept, relative to
+// the project's directory.
+const ProjectDir = ".shenzhen-go/parts"
+
+// LockFile records the part specs installed in a project, relative to the
+// project's directory.
+const LockFile = ".shenzhen-go/parts.lock"
+
+// IndexEntry describes one version of a part spec in a registry index.
+type IndexEntry struct {
+	Type        string `json:"type"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+
+	// URL locates the spec, relative to the index.
+	URL string `json:"url"`
+
+	// SHA256 is the hex-encoded SHA-256 checksum of the spec.
+	SHA256 string `json:"sha256"`
+}
+
+// Lock maps part types to the installed index entries, with absolute URLs.
+type Lock map[string]*IndexEntry
+
+// fetch gets the content at u, which may be an http(s) URL or a file path.
+func fetch(u string) ([]byte, error) {
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return ioutil.ReadFile(strings.TrimPrefix(u, "file://"))
+	}
+	resp, err := http.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", u, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// resolve makes ref relative to base, which may be a URL or a file path.
+func resolve(base, ref string) (string, error) {
+	if strings.HasPrefix(base, "http://") || strings.HasPrefix(base, "https://") {
+		b, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+		r, err := url.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+		return b.ResolveReference(r).String(), nil
+	}
+	if strings.Contains(ref, "://") || filepath.IsAbs(ref) {
+		return ref, nil
+	}
+	return filepath.Join(filepath.Dir(strings.TrimPrefix(base, "file://")), ref), nil
+}
+
+// FetchIndex gets the entries of the registry index at indexURL, sorted by
+// type, then version (newest first). Their URLs are made absolute.
+func FetchIndex(indexURL string) ([]*IndexEntry, error) {
+	b, err := fetch(indexURL)
+	if err != nil {
+		return nil, err
+	}
+	var es []*IndexEntry
+	if err := json.Unmarshal(b, &es); err != nil {
+		return nil, fmt.Errorf("index %s: %v", indexURL, err)
+	}
+	for _, e := range es {
+		if e.URL, err = resolve(indexURL, e.URL); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(es, func(i, j int) bool {
+		if es[i].Type != es[j].Type {
+			return es[i].Type < es[j].Type
+		}
+		return newerVersion(es[i].Version, es[j].Version)
+	})
+	return es, nil
+}
+
+// newerVersion reports whether version a is newer than b, comparing
+// dot-separated numbers (e.g. "1.10.0" is newer than "1.9.2").
+func newerVersion(a, b string) bool {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, errx := strconv.Atoi(as[i])
+		y, erry := strconv.Atoi(bs[i])
+		if errx != nil || erry != nil {
+			if as[i] != bs[i] {
+				return as[i] > bs[i]
+			}
+			continue
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return len(as) > len(bs)
+}
+
+// Find returns the entry for the given type and version, or the newest
+// version if version is "".
+func Find(es []*IndexEntry, typeKey, version string) (*IndexEntry, error) {
+	for _, e := range es {
+		if e.Type == typeKey && (version == "" || e.Version == version) {
+			return e, nil
+		}
+	}
+	if version == "" {
+		return nil, fmt.Errorf("part type %q not in index", typeKey)
+	}
+	return nil, fmt.Errorf("part type %q version %q not in index", typeKey, version)
+}
+
+// Install fetches the spec for the entry, checks it, and saves it in the
+// project at dir, pinning it in the lock file.
+func Install(dir string, e *IndexEntry) error {
+	b, err := fetch(e.URL)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, e.SHA256) {
+		return fmt.Errorf("%s: checksum is %s, want %s", e.URL, got, e.SHA256)
+	}
+	var s Spec
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("%s: %v", e.URL, err)
+	}
+	if s.TypeKey != e.Type || s.Version != e.Version {
+		return fmt.Errorf("%s: is %s %s, want %s %s", e.URL, s.TypeKey, s.Version, e.Type, e.Version)
+	}
+	if err := s.compile(); err != nil {
+		return fmt.Errorf("%s: %v", e.URL, err)
+	}
+	pd := filepath.Join(dir, ProjectDir)
+	if err := os.MkdirAll(pd, 0755); err != nil {
+		return err
+	}
+	// Escaping keeps types like "../x" within the directory.
+	if err := ioutil.WriteFile(filepath.Join(pd, url.PathEscape(e.Type)+SpecExt), b, 0644); err != nil {
+		return err
+	}
+	l, err := LoadLock(dir)
+	if err != nil {
+		return err
+	}
+	l[e.Type] = e
+	return l.save(dir)
+}
+
+// LoadLock reads the lock file of the project at dir. A project without one
+// has nothing installed.
+func LoadLock(dir string) (Lock, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, LockFile))
+	if os.IsNotExist(err) {
+		return make(Lock), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l := make(Lock)
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, fmt.Errorf("%s: %v", LockFile, err)
+	}
+	return l, nil
+}
+
+func (l Lock) save(dir string) error {
+	b, err := json.MarshalIndent(l, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, LockFile), append(b, '\n'), 0644)
+}
+
+// InstallLocked installs exactly the specs pinned in the lock file of the
+// project at dir, e.g. after checking out the project.
+func InstallLocked(dir string) error {
+	l, err := LoadLock(dir)
+	if err != nil {
+		return err
+	}
+	types := make([]string, 0, len(l))
+	for t := range l {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		if err := Install(dir, l[t]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parts
+
+import (
+	"fmt"
+	html "html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/shenzhen-go/source"
+)
+
+// Kinds of Field.
+const (
+	KindInput   = "input"   // A channel the part reads.
+	KindOutput  = "output"  // A channel the part writes.
+	KindInputs  = "inputs"  // Any number of channels the part reads.
+	KindOutputs = "outputs" // Any number of channels the part writes.
+	KindText    = "text"    // A line of Go, e.g. an expression.
+	KindCode    = "code"    // Lines of Go.
+	KindEnum    = "enum"    // One of Options.
+	KindBool    = "bool"    // "true" or "false".
+	KindInt     = "int"     // A whole number.
+)
+
+// Field describes a setting of a part, from which the editor form is made.
+type Field struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Help  string `json:"help,omitempty"`
+	Kind  string `json:"kind"`
+
+	// Options are the allowed values of an enum.
+	Options []string `json:"options,omitempty"`
+
+	// Default is the value of the field in new parts.
+	Default string `json:"default,omitempty"`
+
+	// Required fields can't be left empty.
+	Required bool `json:"required,omitempty"`
+
+	// Pattern, if set, is a regular expression values must match.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// IsChannel reports whether the field names channels.
+func (f Field) IsChannel() bool {
+	switch f.Kind {
+	case KindInput, KindOutput, KindInputs, KindOutputs:
+		return true
+	}
+	return false
+}
+
+// Multiple reports whether the field has any number of values.
+func (f Field) Multiple() bool { return f.Kind == KindInputs || f.Kind == KindOutputs }
+
+// Has reports whether v is one of the field's values in vs.
+func (f Field) Has(vs url.Values, v string) bool {
+	for _, x := range vs[f.Name] {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Check checks the values of the field.
+func (f Field) Check(vs []string) *ConfigError {
+	if len(vs) == 0 || (len(vs) == 1 && vs[0] == "") {
+		if f.Required {
+			return &ConfigError{Field: f.Label, Msg: "required"}
+		}
+		return nil
+	}
+	for _, v := range vs {
+		switch f.Kind {
+		case KindEnum:
+			ok := false
+			for _, o := range f.Options {
+				ok = ok || o == v
+			}
+			if !ok {
+				return &ConfigError{Field: f.Label, Msg: fmt.Sprintf("%q is not one of %s", v, strings.Join(f.Options, ", "))}
+			}
+		case KindBool:
+			if v != "true" && v != "false" {
+				return &ConfigError{Field: f.Label, Msg: fmt.Sprintf("%q is not true or false", v)}
+			}
+		case KindInt:
+			if _, err := strconv.Atoi(v); err != nil {
+				return &ConfigError{Field: f.Label, Msg: fmt.Sprintf("%q is not a whole number", v)}
+			}
+		}
+		if f.Pattern == "" {
+			continue
+		}
+		if ok, _ := regexp.MatchString("^(?:"+f.Pattern+")$", v); !ok {
+			return &ConfigError{Field: f.Label, Msg: "must match " + f.Pattern}
+		}
+	}
+	return nil
+}
+
+// Schema describes all the settings of a part.
+type Schema []Field
+
+// check checks the schema itself, filling in missing labels.
+func (s Schema) check() error {
+	seen := make(map[string]bool)
+	for i := range s {
+		f := &s[i]
+		if f.Name == "" || seen[f.Name] {
+			return fmt.Errorf("field %d: missing or duplicate name %q", i, f.Name)
+		}
+		seen[f.Name] = true
+		switch f.Kind {
+		case KindInput, KindOutput, KindInputs, KindOutputs, KindText, KindCode, KindBool, KindInt:
+		case KindEnum:
+			if len(f.Options) == 0 {
+				return fmt.Errorf("field %q: enum without options", f.Name)
+			}
+		default:
+			return fmt.Errorf("field %q: unknown kind %q", f.Name, f.Kind)
+		}
+		if f.Label == "" {
+			f.Label = f.Name
+		}
+		if f.Pattern != "" {
+			if _, err := regexp.Compile(f.Pattern); err != nil {
+				return fmt.Errorf("field %q: %v", f.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Defaults returns the default values of the fields.
+func (s Schema) Defaults() url.Values {
+	vs := make(url.Values)
+	for _, f := range s {
+		if f.Default != "" {
+			vs.Set(f.Name, f.Default)
+		}
+	}
+	return vs
+}
+
+// Check checks values of the fields, returning ConfigErrors.
+func (s Schema) Check(vs url.Values) error {
+	var es ConfigErrors
+	for _, f := range s {
+		if err := f.Check(vs[f.Name]); err != nil {
+			es = append(es, err)
+		}
+	}
+	return es.Err()
+}
+
+// Channels returns the channels named by the values of channel fields.
+func (s Schema) Channels(vs url.Values) (read, written []string) {
+	for _, f := range s {
+		for _, v := range vs[f.Name] {
+			if v == "" {
+				continue
+			}
+			switch f.Kind {
+			case KindInput, KindInputs:
+				read = append(read, v)
+			case KindOutput, KindOutputs:
+				written = append(written, v)
+			}
+		}
+	}
+	return read, written
+}
+
+// RenameChannel changes values of channel fields, and uses in Go fields,
+// referring to the channel.
+func (s Schema) RenameChannel(vs url.Values, from, to string) error {
+	for _, f := range s {
+		for i, v := range vs[f.Name] {
+			switch {
+			case f.IsChannel():
+				if v == from {
+					vs[f.Name][i] = to
+				}
+			case (f.Kind == KindText || f.Kind == KindCode) && v != "":
+				nv, err := source.RenameIdent(v, from, to)
+				if err != nil {
+					return err
+				}
+				vs[f.Name][i] = nv
+			}
+		}
+	}
+	return nil
+}
+
+// FromForm gets values of the fields from the form made by SchemaEditor.
+func (s Schema) FromForm(r *http.Request) url.Values {
+	r.ParseForm()
+	vs := make(url.Values)
+	for _, f := range s {
+		k := "Field_" + f.Name
+		switch {
+		case f.Multiple():
+			for _, v := range r.Form[k] {
+				if v != "" {
+					vs.Add(f.Name, v)
+				}
+			}
+		case f.Kind == KindBool:
+			vs.Set(f.Name, strconv.FormatBool(r.FormValue(k) == "true"))
+		default:
+			vs.Set(f.Name, strings.Replace(r.FormValue(k), "\r\n", "\n", -1))
+		}
+	}
+	return vs
+}
+
+// Schematic is implemented by parts described by a Schema. Such parts can use
+// SchemaEditor, UpdateSchematic, and ValidateSchematic instead of writing
+// their own editor, and can be edited generically (e.g. through the API).
+type Schematic interface {
+	Schema() Schema
+	FieldValues() url.Values
+	SetFieldValues(url.Values) error
+}
+
+// SchemaEditor adds a "part_view" template, which edits the fields of a
+// Schematic part, to the given template.
+func SchemaEditor(tmpl *html.Template) error {
+	_, err := tmpl.New("part_view").Parse(`{{$vs := $.Node.Part.FieldValues}}
+	{{- range $f := $.Node.Part.Schema}}
+	<div class="formfield">
+		<label for="Field_{{.Name}}">{{.Label}}</label>
+		{{if .IsChannel -}}
+		<select name="Field_{{.Name}}" {{if .Multiple}}multiple{{end}}>
+			{{if not (or .Required .Multiple)}}<option value="">None</option>{{end}}
+			{{range $.Graph.Channels -}}
+			<option value="{{.Name}}" {{if $f.Has $vs .Name}}selected{{end}}>{{.Name}}</option>
+			{{- end}}
+		</select>
+		{{- else if eq .Kind "enum" -}}
+		<select name="Field_{{.Name}}">
+			{{range .Options}}<option value="{{.}}" {{if $f.Has $vs .}}selected{{end}}>{{.}}</option>{{end}}
+		</select>
+		{{- else if eq .Kind "bool" -}}
+		<input type="checkbox" name="Field_{{.Name}}" value="true" {{if $f.Has $vs "true"}}checked{{end}}>
+		{{- else if eq .Kind "code" -}}
+		<textarea name="Field_{{.Name}}" rows="10" cols="80" {{if .Required}}required{{end}}>{{$vs.Get .Name}}</textarea>
+		{{- else -}}
+		<input type="{{if eq .Kind "int"}}number{{else}}text{{end}}" name="Field_{{.Name}}" value="{{$vs.Get .Name}}" {{if .Required}}required{{end}} {{with .Pattern}}pattern="{{.}}"{{end}}>
+		{{- end}}
+	</div>
+	{{- end}}`)
+	return err
+}
+
+// UpdateSchematic sets the fields of a Schematic part from the form made by
+// SchemaEditor. Use ValidateSchematic to check them.
+func UpdateSchematic(p Schematic, r *http.Request) error {
+	if r == nil {
+		return nil
+	}
+	return p.SetFieldValues(p.Schema().FromForm(r))
+}
+
+// ValidateSchematic checks the fields of a Schematic part.
+func ValidateSchematic(p Schematic) error {
+	return p.Schema().Check(p.FieldValues())
+}
@@ -0,0 +1,233 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	html "html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// SpecExt is the file extension of part specs.
+const SpecExt = ".json"
+
+// A Spec defines a part type without any Go code being compiled into
+// shenzhen-go: the part has fields described by a Schema, and its code is a
+// template over the field values. Specs are JSON files, e.g.
+//
+//	{
+//		"type": "Doubler",
+//		"description": "Sends each input value, doubled, to the output.",
+//		"fields": [
+//			{"name": "in", "label": "Input", "kind": "input", "help": "Numbers to double."},
+//			{"name": "out", "label": "Output", "kind": "output"}
+//		],
+//		"template": "for x := range {{.in}} { {{.out}} <- 2*x }\nclose({{.out}})"
+//	}
+type Spec struct {
+	TypeKey  string `json:"type"`
+	Version  string `json:"version,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Doc      string `json:"description,omitempty"`
+	Fields   Schema `json:"fields"`
+	Template string `json:"template"`
+	Style    *Style `json:"style,omitempty"`
+
+	tmpl *template.Template
+}
+
+// compile checks the spec, and prepares its template.
+func (s *Spec) compile() error {
+	if s.TypeKey == "" {
+		return fmt.Errorf("missing type")
+	}
+	if err := s.Fields.check(); err != nil {
+		return err
+	}
+	t, err := template.New(s.TypeKey).Option("missingkey=zero").Parse(s.Template)
+	if err != nil {
+		return err
+	}
+	s.tmpl = t
+	return nil
+}
+
+// Register checks the spec and registers its part type.
+func (s *Spec) Register() error {
+	if err := s.compile(); err != nil {
+		return fmt.Errorf("part spec %q: %v", s.TypeKey, err)
+	}
+	if err := Register(s.TypeKey, func() interface{} {
+		p := &Specified{Spec: s}
+		p.SetFieldValues(s.Fields.Defaults())
+		return p
+	}, s.Style); err != nil {
+		return err
+	}
+	m := Metadata{Name: s.Name, Description: s.Doc}
+	if m.Name == "" {
+		m.Name = s.TypeKey
+	}
+	for _, f := range s.Fields {
+		if f.Help != "" {
+			m.Fields = append(m.Fields, FieldHelp{Field: f.Label, Help: f.Help})
+		}
+	}
+	SetMetadata(s.TypeKey, m)
+	return nil
+}
+
+// LoadSpecs registers each part spec in dir, returning the paths of those
+// loaded. It keeps going after errors, returning the first.
+func LoadSpecs(dir string) ([]string, error) {
+	ps, err := filepath.Glob(filepath.Join(dir, "*"+SpecExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ps)
+	var loaded []string
+	var first error
+	for _, p := range ps {
+		if err := loadSpec(p); err != nil {
+			if first == nil {
+				first = fmt.Errorf("%s: %v", p, err)
+			}
+			continue
+		}
+		loaded = append(loaded, p)
+	}
+	return loaded, first
+}
+
+func loadSpec(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s := new(Spec)
+	if err := json.Unmarshal(b, s); err != nil {
+		return err
+	}
+	return s.Register()
+}
+
+// Specified is a part whose type is defined by a Spec. It is marshalled to
+// JSON as its field values. Fields with multiple values are stored
+// comma-separated, but are lists in the template.
+type Specified struct {
+	Spec   *Spec
+	Values map[string]string
+}
+
+// MarshalJSON encodes the field values.
+func (p *Specified) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Values)
+}
+
+// UnmarshalJSON decodes the field values.
+func (p *Specified) UnmarshalJSON(j []byte) error {
+	return json.Unmarshal(j, &p.Values)
+}
+
+// Schema returns the spec's fields.
+func (p *Specified) Schema() Schema { return p.Spec.Fields }
+
+// FieldValues returns the field values.
+func (p *Specified) FieldValues() url.Values {
+	vs := make(url.Values)
+	for _, f := range p.Spec.Fields {
+		v, found := p.Values[f.Name]
+		switch {
+		case !found:
+		case f.Multiple():
+			for _, x := range strings.Split(v, ",") {
+				if x = strings.TrimSpace(x); x != "" {
+					vs.Add(f.Name, x)
+				}
+			}
+		default:
+			vs.Set(f.Name, v)
+		}
+	}
+	return vs
+}
+
+// SetFieldValues sets the field values.
+func (p *Specified) SetFieldValues(vs url.Values) error {
+	m := make(map[string]string, len(p.Spec.Fields))
+	for _, f := range p.Spec.Fields {
+		if x, found := vs[f.Name]; found {
+			m[f.Name] = strings.Join(x, ", ")
+		}
+	}
+	p.Values = m
+	return nil
+}
+
+// AssociateEditor adds a "part_view" template to the given template.
+func (p *Specified) AssociateEditor(tmpl *html.Template) error { return SchemaEditor(tmpl) }
+
+// Channels returns the channels named by channel fields.
+func (p *Specified) Channels() (read, written []string) {
+	return p.Spec.Fields.Channels(p.FieldValues())
+}
+
+// Impl returns the spec's template applied to the field values.
+func (p *Specified) Impl() string {
+	data := make(map[string]interface{})
+	vs := p.FieldValues()
+	for _, f := range p.Spec.Fields {
+		if f.Multiple() {
+			data[f.Name] = vs[f.Name]
+		} else {
+			data[f.Name] = vs.Get(f.Name)
+		}
+	}
+	b := new(bytes.Buffer)
+	if err := p.Spec.tmpl.Execute(b, data); err != nil {
+		return fmt.Sprintf("// %s: %v\n", p.Spec.TypeKey, err)
+	}
+	return b.String()
+}
+
+// Update sets the field values from the given Request. Validate checks them.
+func (p *Specified) Update(r *http.Request) error { return UpdateSchematic(p, r) }
+
+// Validate checks the field values.
+func (p *Specified) Validate() error { return ValidateSchematic(p) }
+
+// RenameChannel changes channel fields, and uses in Go fields, referring to
+// the channel.
+func (p *Specified) RenameChannel(from, to string) error {
+	vs := p.FieldValues()
+	if err := p.Spec.Fields.RenameChannel(vs, from, to); err != nil {
+		return err
+	}
+	return p.SetFieldValues(vs)
+}
+
+// PartVersion returns the spec's version, if it has one.
+func (p *Specified) PartVersion() string { return p.Spec.Version }
+
+// TypeKey returns the spec's type.
+func (p *Specified) TypeKey() string { return p.Spec.TypeKey }
@@ -17,9 +17,138 @@ package parts
 // Factory creates a part.
 type Factory func() interface{}
 
-// Factories translates part type strings into part factories.
-var Factories = map[string]Factory{
-	"Code":        func() interface{} { return new(Code) },
-	"Filter":      func() interface{} { return new(Filter) },
-	"Multiplexer": func() interface{} { return new(Multiplexer) },
+// factories translates part type strings into part factories. Use Lookup.
+var factories = map[string]Factory{
+	"Assert":         newAssert,
+	"Code":           func() interface{} { return new(Code) },
+	"DeadLetterFile": newDeadLetterFile,
+	"Filter":         func() interface{} { return new(Filter) },
+	"Map":            newMap,
+	"Multiplexer":    func() interface{} { return new(Multiplexer) },
+}
+
+// Metadata describes a type of part for people, in the editor and the part
+// catalog.
+type Metadata struct {
+	// Name is a human-friendly name for the part type.
+	Name string
+
+	// Description says what parts of the type do.
+	Description string
+
+	// Fields describe the settings in the editor.
+	Fields []FieldHelp
+}
+
+// FieldHelp explains a setting of a part.
+type FieldHelp struct {
+	Field string // As labelled in the editor.
+	Help  string
+}
+
+// catalog translates part type strings into metadata. Use Describe.
+var catalog = map[string]Metadata{
+	"Assert": {
+		Name:        "Assert",
+		Description: "Passes values from its input to its output, checking each: that a predicate is true of it, or that it is in order with the value before. Documents, and enforces, what one stage expects of another. The output is closed when the input is.",
+		Fields: []FieldHelp{
+			{"Input", "The channel to read values from."},
+			{"Output", "The channel to pass values on to. Without one, values are dropped after checking."},
+			{"Check", "predicate: the expression must be true of every value. The others: each value's key must compare so with the key of the value before."},
+			{"Expression", "A Go expression; the value is x. A boolean for predicate, otherwise the key values are ordered by (x to compare the values themselves)."},
+			{"On violation", "log: print the value to standard error and carry on. count: print how many values violated the check when the input is closed. abort: print the value and exit the program."},
+		},
+	},
+	"Code": {
+		Name:        "Code",
+		Description: "Runs arbitrary Go. Channels it sends to or receives from are connected automatically.",
+	},
+	"DeadLetterFile": {
+		Name:        "Dead letter file",
+		Description: "Appends the dead letters it reads to a file, one JSON object per line, with the time, the goroutine that gave up on the item, the error, and the item.",
+		Fields: []FieldHelp{
+			{"Input", "The channel to read dead letters from, usually the graph's dead-letter channel."},
+			{"File", "A Go string expression: the path of the file to append to."},
+		},
+	},
+	"Filter": {
+		Name:        "Filter",
+		Description: "Reads values from an input, and sends each to the output of the first predicate true for it, or else to the default output. Outputs are closed when the input is.",
+		Fields: []FieldHelp{
+			{"Input", "The channel to read values from."},
+			{"If / Else if", "A Go boolean expression, true for values to send to the output. The value is x. Predicates are tried in order."},
+			{"Output", "A channel to send matching values to. Choose (remove) to remove the path."},
+			{"Otherwise", "The default output, for values no predicate is true for. Without one, they are dropped."},
+			{"Send to every matching output", "Send each value to the outputs of all the predicates true for it, not only the first."},
+		},
+	},
+	"Map": {
+		Name:        "Map",
+		Description: "Sends the result of an expression of each value from its input to its output, closing it when the input is. Properties claimed of the expression are checked, for many random values, by tests generated with the package.",
+		Fields: []FieldHelp{
+			{"Input", "The channel to read values from."},
+			{"Output", "The channel to send results to."},
+			{"Expression", "A Go expression of the value, x, giving the result."},
+			{"Idempotent", "Claim that applying the expression to a result gives the same result (so the input and output types must be the same)."},
+			{"Preserves length", "Claim that each result has the same length as its value (e.g. for strings or slices)."},
+			{"Property", "A Go boolean expression claimed true for every value x and its result y, e.g. strings.HasPrefix(y, x). f applies the expression."},
+		},
+	},
+	"Multiplexer": {
+		Name:        "Multiplexer",
+		Description: "Sends every value from several inputs to one output, closing it when all the inputs are closed.",
+		Fields: []FieldHelp{
+			{"Inputs", "The channels to read values from."},
+			{"Output", "The channel to send all values to."},
+		},
+	},
+}
+
+// Describe returns the metadata for a part type, or minimal metadata if it
+// has none.
+func Describe(typeKey string) Metadata {
+	registry.RLock()
+	defer registry.RUnlock()
+	if m, found := catalog[typeKey]; found {
+		return m
+	}
+	return Metadata{Name: typeKey}
+}
+
+// Rendering is what a part adds to how its node is drawn in the diagram.
+type Rendering struct {
+	// Lines are shown under the node's name.
+	Lines []string
+
+	// Badge is a short note (e.g. a count) shown beside the node.
+	Badge string
+
+	// Ports gives each channel the node uses its own labelled place on the
+	// node, so e.g. several outputs can be told apart.
+	Ports bool
+}
+
+// Style describes how parts of a type are drawn in the diagram.
+type Style struct {
+	// Color is a Graphviz colour name or "#rrggbb" value used to fill nodes.
+	Color string
+
+	// Shape is a Graphviz node shape.
+	Shape string
+
+	// Icon is a short string (e.g. a symbol) shown before the node's name.
+	Icon string
+}
+
+// DefaultStyle is used for parts with no particular style.
+var DefaultStyle = Style{Color: "white", Shape: "box"}
+
+// styles translates part type strings into styles, so that different kinds of
+// part can be told apart in the diagram. Use StyleOf.
+var styles = map[string]Style{
+	"Assert":         {Color: "palegreen", Shape: "hexagon", Icon: "✓"},
+	"DeadLetterFile": {Color: "lightgrey", Shape: "cylinder", Icon: "✉"},
+	"Filter":         {Color: "lightblue", Shape: "invtrapezium", Icon: "▽"},
+	"Map":            {Color: "lightcyan", Shape: "box", Icon: "ƒ"},
+	"Multiplexer":    {Color: "khaki", Shape: "trapezium", Icon: "⇉"},
 }
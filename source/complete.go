@@ -0,0 +1,196 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Completion is a suggestion for the identifier being typed.
+type Completion struct {
+	Label  string `json:"label"`
+	Kind   string `json:"kind"`             // "var", "const", "type", "func", "package", or "field".
+	Detail string `json:"detail,omitempty"` // Usually the type.
+}
+
+// isIdentRune reports whether r can be part of an identifier.
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Complete suggests identifiers to complete the one at the byte offset in
+// body, which is checked as by TypeCheck. After a ".", it suggests the
+// members of the package or value before it; otherwise, everything in scope
+// at that point: channels, parameters, local variables, imported packages,
+// and builtins. Suggestions start with whatever has been typed already, and
+// are sorted by label.
+func Complete(body string, offset int, imports []string, vars, params []Var) ([]Completion, error) {
+	if offset < 0 || offset > len(body) {
+		offset = len(body)
+	}
+	start, end := offset, offset
+	for start > 0 {
+		r, n := utf8.DecodeLastRuneInString(body[:start])
+		if !isIdentRune(r) {
+			break
+		}
+		start -= n
+	}
+	for end < len(body) {
+		r, n := utf8.DecodeRuneInString(body[end:])
+		if !isIdentRune(r) {
+			break
+		}
+		end += n
+	}
+	prefix := body[start:offset]
+
+	// Replace the identifier with a placeholder, so that e.g. "fmt." and
+	// "x := " still parse.
+	s := wrapFuncBody(body[:start]+"_"+body[end:], imports, vars, params)
+
+	checkMu.Lock()
+	defer checkMu.Unlock()
+
+	// Broken code is the norm while typing, so make the most of any errors.
+	f, _ := parser.ParseFile(checkFset, "snippet.go", s.src, parser.AllErrors)
+	if f == nil {
+		return nil, nil
+	}
+	info := &types.Info{
+		Types:  make(map[ast.Expr]types.TypeAndValue),
+		Uses:   make(map[*ast.Ident]types.Object),
+		Scopes: make(map[ast.Node]*types.Scope),
+	}
+	conf := &types.Config{
+		Importer: checkImp,
+		Error:    func(error) {},
+	}
+	pkg, _ := conf.Check("snippet", checkFset, []*ast.File{f}, info)
+	if pkg == nil {
+		return nil, nil
+	}
+	pos := checkFset.File(f.Pos()).Pos(s.offset + start)
+
+	qual := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+	seen := make(map[string]bool)
+	var cs []Completion
+	add := func(obj types.Object) {
+		name := obj.Name()
+		if seen[name] || name == "_" || !strings.HasPrefix(name, prefix) {
+			return
+		}
+		seen[name] = true
+		c := Completion{Label: name}
+		switch o := obj.(type) {
+		case *types.Var:
+			c.Kind = "var"
+			if o.IsField() {
+				c.Kind = "field"
+			}
+		case *types.Const:
+			c.Kind = "const"
+		case *types.TypeName:
+			c.Kind = "type"
+		case *types.Func, *types.Builtin:
+			c.Kind = "func"
+		case *types.PkgName:
+			c.Kind, c.Detail = "package", o.Imported().Path()
+		case *types.Nil:
+			c.Kind = "const"
+		}
+		if c.Detail == "" && c.Kind != "package" {
+			if _, builtin := obj.(*types.Builtin); !builtin {
+				c.Detail = types.TypeString(obj.Type(), qual)
+			}
+		}
+		cs = append(cs, c)
+	}
+
+	if start > 0 && body[start-1] == '.' {
+		var sel *ast.SelectorExpr
+		ast.Inspect(f, func(n ast.Node) bool {
+			if se, ok := n.(*ast.SelectorExpr); ok && se.Sel.Pos() == pos {
+				sel = se
+			}
+			return sel == nil
+		})
+		if sel == nil {
+			return nil, nil
+		}
+		if id, ok := sel.X.(*ast.Ident); ok {
+			if pn, ok := info.Uses[id].(*types.PkgName); ok {
+				sc := pn.Imported().Scope()
+				for _, name := range sc.Names() {
+					if obj := sc.Lookup(name); obj.Exported() {
+						add(obj)
+					}
+				}
+				return sorted(cs), nil
+			}
+		}
+		t := info.Types[sel.X].Type
+		if t == nil {
+			return nil, nil
+		}
+		// Methods with pointer receivers can be called on most values.
+		if _, isPtr := t.(*types.Pointer); !isPtr && !types.IsInterface(t) {
+			t = types.NewPointer(t)
+		}
+		if p, ok := t.(*types.Pointer); ok {
+			if st, ok := p.Elem().Underlying().(*types.Struct); ok {
+				for i := 0; i < st.NumFields(); i++ {
+					add(st.Field(i))
+				}
+			}
+		}
+		ms := types.NewMethodSet(t)
+		for i := 0; i < ms.Len(); i++ {
+			add(ms.At(i).Obj())
+		}
+		return sorted(cs), nil
+	}
+
+	for sc := pkg.Scope().Innermost(pos); sc != nil; sc = sc.Parent() {
+		for _, name := range sc.Names() {
+			obj := sc.Lookup(name)
+			if sc != pkg.Scope() && sc != types.Universe && obj.Pos() > pos {
+				// Declared later on.
+				continue
+			}
+			if obj.Pkg() == pkg && name == "snippet" {
+				continue
+			}
+			add(obj)
+		}
+	}
+	return sorted(cs), nil
+}
+
+func sorted(cs []Completion) []Completion {
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Label < cs[j].Label })
+	return cs
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	imps := []string{"fmt", "strings"}
+	vars := []Var{
+		{Name: "in", Type: "chan int"},
+		{Name: "out", Type: "chan string"},
+		{Decl: "source", Value: "type point struct {\n\tx, y int\n}\n\nfunc (p *point) norm() int { return p.x*p.x + p.y*p.y }"},
+	}
+	params := []Var{{Name: "instanceNumber", Type: "int"}}
+	labels := func(cs []Completion) []string {
+		var ls []string
+		for _, c := range cs {
+			ls = append(ls, c.Label)
+		}
+		return ls
+	}
+	tests := []struct {
+		src  string // | marks the cursor.
+		want []string
+	}{
+		{src: "o|", want: []string{"out"}},
+		{src: "x := 1\nfor range in {\n\tou| <- fmt.Sprint(x)\n}\nouter := 2", want: []string{"out"}},
+		{src: "i|", want: []string{"imag", "in", "instanceNumber", "int", "int16", "int32", "int64", "int8", "iota"}},
+		{src: "out <- strings.ToU|", want: []string{"ToUpper", "ToUpperSpecial"}},
+		{src: "fmt.|", want: nil}, // Checked below.
+		{src: "var p point\n_ = p.|", want: []string{"norm", "x", "y"}},
+		{src: "st|", want: []string{"string", "strings"}},
+	}
+	for _, test := range tests {
+		off := 0
+		for off < len(test.src) && test.src[off] != '|' {
+			off++
+		}
+		src := test.src[:off] + test.src[off+1:]
+		got, err := Complete(src, off, imps, vars, params)
+		if err != nil {
+			t.Fatalf("Complete(%q) err = %v", test.src, err)
+		}
+		if test.src == "fmt.|" {
+			if len(got) < 10 || got[0].Kind == "" {
+				t.Errorf("Complete(%q) = %v, want fmt's exported names", test.src, got)
+			}
+			continue
+		}
+		if ls := labels(got); !reflect.DeepEqual(ls, test.want) {
+			t.Errorf("Complete(%q) = %v, want %v", test.src, ls, test.want)
+		}
+	}
+}
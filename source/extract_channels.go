@@ -21,6 +21,7 @@ import (
 	"go/parser"
 	"go/token"
 	"io"
+	"sort"
 	"text/template"
 )
 
@@ -52,34 +53,48 @@ func (v *findFunc) Visit(node ast.Node) ast.Visitor {
 }
 
 type chanIdents struct {
-	srcs, dsts map[string]bool
+	srcs, dsts, ranges, closes map[string]bool
+}
+
+// freeIdent returns the identifier expressed by e, if it is an identifier not
+// declared within the snippet. Only those can refer to channels in the graph;
+// anything declared locally (e.g. ch := make(chan int)) is the snippet's own
+// business.
+func freeIdent(e ast.Expr) (*ast.Ident, bool) {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		e = p.X
+	}
+	id, ok := e.(*ast.Ident)
+	if !ok || id.Obj != nil {
+		return nil, false
+	}
+	return id, true
 }
 
 func (v *chanIdents) Visit(node ast.Node) ast.Visitor {
 	switch s := node.(type) {
 	case *ast.SendStmt:
-		id, ok := s.Chan.(*ast.Ident)
-		if !ok {
-			return v
+		if id, ok := freeIdent(s.Chan); ok {
+			v.dsts[id.Name] = true
 		}
-		v.dsts[id.Name] = true
 
 	case *ast.UnaryExpr:
 		if s.Op != token.ARROW {
-			return nil
+			return v
 		}
-		id, ok := s.X.(*ast.Ident)
-		if !ok {
-			return nil
+		if id, ok := freeIdent(s.X); ok {
+			v.srcs[id.Name] = true
 		}
-		v.srcs[id.Name] = true
 
 	case *ast.RangeStmt:
-		id, ok := s.X.(*ast.Ident)
-		if !ok {
-			return v
+		if id, ok := freeIdent(s.X); ok {
+			v.srcs[id.Name] = true
+			v.ranges[id.Name] = true
 		}
-		v.srcs[id.Name] = true
 
 	case *ast.CallExpr:
 		// close(ch) is interpreted as writing to ch.
@@ -87,17 +102,13 @@ func (v *chanIdents) Visit(node ast.Node) ast.Visitor {
 			return v
 		}
 		fi, ok := s.Fun.(*ast.Ident)
-		if !ok {
+		if !ok || fi.Name != "close" || fi.Obj != nil {
 			return v
 		}
-		if fi.Name != "close" {
-			return v
+		if id, ok := freeIdent(s.Args[0]); ok {
+			v.dsts[id.Name] = true
+			v.closes[id.Name] = true
 		}
-		id, ok := s.Args[0].(*ast.Ident)
-		if !ok {
-			return v
-		}
-		v.dsts[id.Name] = true
 
 	}
 	return v
@@ -108,17 +119,44 @@ func mapToSlice(m map[string]bool) (s []string) {
 	for k := range m {
 		s = append(s, k)
 	}
+	sort.Strings(s)
 	return
 }
 
+// ChannelUsage describes how a snippet of code uses channels. Each field
+// is sorted.
+type ChannelUsage struct {
+	// Reads and Writes are the channels read from and written to.
+	// Closing a channel counts as writing to it.
+	Reads, Writes []string
+
+	// Ranges are the channels ranged over; such loops only finish once the
+	// channel is closed.
+	Ranges []string
+
+	// Closes are the channels closed.
+	Closes []string
+}
+
 // ExtractChannelIdents extracts identifier names which could be involved in
-// channel reads (srcs) or writes (dsts). dsts only contains channel identifiers
-// written to, but srcs can contain false positives.
+// channel reads (srcs) or writes (dsts). Only identifiers not declared within
+// src are considered, since they are the only ones which could refer to channels
+// declared by the graph. Both results are sorted.
 func ExtractChannelIdents(src string) (srcs, dsts []string, err error) {
+	u, err := ExtractChannelUsage(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u.Reads, u.Writes, nil
+}
+
+// ExtractChannelUsage is like ExtractChannelIdents, but also finds which
+// channels are ranged over and closed.
+func ExtractChannelUsage(src string) (*ChannelUsage, error) {
 	fset := token.NewFileSet()
 	rb := make([]byte, 8)
-	if _, err = rand.Read(rb); err != nil {
-		return nil, nil, err
+	if _, err := rand.Read(rb); err != nil {
+		return nil, err
 	}
 	rn := fmt.Sprintf("zzz%xzzz", rb)
 	pr, pw := io.Pipe()
@@ -131,9 +169,19 @@ func ExtractChannelIdents(src string) (srcs, dsts []string, err error) {
 	}()
 	f, err := parser.ParseFile(fset, rn+".go", pr, 0)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	ci := &chanIdents{
+		srcs:   make(map[string]bool),
+		dsts:   make(map[string]bool),
+		ranges: make(map[string]bool),
+		closes: make(map[string]bool),
 	}
-	ci := &chanIdents{srcs: make(map[string]bool), dsts: make(map[string]bool)}
 	ast.Walk(&findFunc{funcName: rn, subvis: ci}, f)
-	return mapToSlice(ci.srcs), mapToSlice(ci.dsts), nil
+	return &ChannelUsage{
+		Reads:  mapToSlice(ci.srcs),
+		Writes: mapToSlice(ci.dsts),
+		Ranges: mapToSlice(ci.ranges),
+		Closes: mapToSlice(ci.closes),
+	}, nil
 }
@@ -16,12 +16,16 @@ package source
 
 import (
 	"reflect"
-	"sort"
 	"testing"
 )
 
 func TestExtractChannelIdents(t *testing.T) {
-	srcs, dsts, err := extractChannelIdents(`foo <- <-bar
+	tests := []struct {
+		src        string
+		srcs, dsts []string
+	}{
+		{
+			src: `foo <- <-bar
 for range baz {
     select {
     case blarp := <-qux:
@@ -29,16 +33,33 @@ for range baz {
     }
 }
 close(zoop)
-`)
-	if err != nil {
-		t.Fatalf("extractChannelIdents err = %v", err)
-	}
-	sort.Strings(srcs)
-	sort.Strings(dsts)
-	if got, want := srcs, []string{"bar", "baz", "qux"}; !reflect.DeepEqual(got, want) {
-		t.Errorf("extractChannelIdents srcs = %v, want %v", got, want)
+`,
+			srcs: []string{"bar", "baz", "qux"},
+			dsts: []string{"foo", "tuz", "zoop"},
+		},
+		{
+			// Locally declared channels aren't graph channels.
+			src: `local := make(chan int)
+local <- <-in
+for x := range local {
+    (out) <- -(<-more) + x
+}
+close(local)
+`,
+			srcs: []string{"in", "more"},
+			dsts: []string{"out"},
+		},
 	}
-	if got, want := dsts, []string{"foo", "tuz", "zoop"}; !reflect.DeepEqual(got, want) {
-		t.Errorf("extractChannelIdents srcs = %v, want %v", got, want)
+	for _, test := range tests {
+		srcs, dsts, err := ExtractChannelIdents(test.src)
+		if err != nil {
+			t.Fatalf("ExtractChannelIdents(%q) err = %v", test.src, err)
+		}
+		if got, want := srcs, test.srcs; !reflect.DeepEqual(got, want) {
+			t.Errorf("ExtractChannelIdents(%q) srcs = %v, want %v", test.src, got, want)
+		}
+		if got, want := dsts, test.dsts; !reflect.DeepEqual(got, want) {
+			t.Errorf("ExtractChannelIdents(%q) dsts = %v, want %v", test.src, got, want)
+		}
 	}
 }
@@ -0,0 +1,56 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// FreeIdents returns the sorted names of identifiers used but not declared
+// in src, other than field and method names. These are the names src expects
+// its surroundings to provide: channels, imported packages, predeclared
+// identifiers, and so on.
+func FreeIdents(src string) ([]string, error) {
+	s := wrapFuncBody(src, nil, nil, nil)
+	f, err := parser.ParseFile(token.NewFileSet(), "snippet.go", s.src, 0)
+	if err != nil {
+		return nil, err
+	}
+	skip := make(map[*ast.Ident]bool)
+	free := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			skip[x.Sel] = true
+		case *ast.KeyValueExpr:
+			// Could be a struct field name in a composite literal.
+			if id, ok := x.Key.(*ast.Ident); ok {
+				skip[id] = true
+			}
+		case *ast.BranchStmt:
+			if x.Label != nil {
+				skip[x.Label] = true
+			}
+		case *ast.Ident:
+			if x.Obj == nil && !skip[x] && x.Name != "_" && x.Name != "snippet" {
+				free[x.Name] = true
+			}
+		}
+		return true
+	})
+	return mapToSlice(free), nil
+}
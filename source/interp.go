@@ -0,0 +1,1475 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Chan is a channel as a Machine sees it. Values of any type can be sent.
+type Chan struct {
+	Name string // Empty for channels the code makes itself.
+	C    chan interface{}
+}
+
+// A Machine interprets simple Go snippets, such as the code of goroutines,
+// so graphs can be simulated without building them. It understands enough
+// Go for generators, filters and transforms: variables, loops, if, switch
+// and select, channel operations, function literals, go and defer, a few
+// functions from fmt, strings, strconv, math, time and os (the standard
+// streams, and Exit), and sync.WaitGroup.
+// Anything else is an error when it is reached. Values aren't typed:
+// integers are ints, and other numbers are float64s.
+type Machine struct {
+	Ctx context.Context
+
+	// Steps is the number of statements the code may execute, shared with
+	// other Machines. Running out is an error. Making or appending n elements,
+	// or concatenating a string of n bytes, costs n steps.
+	Steps *int64
+
+	// Hooks, any of which may be nil. Block is called before an operation
+	// which might block (such as "send to raw"), and the function it returns
+	// once it completes. Go starts the goroutines the code starts, which
+	// report how they finish.
+	Print    func(s string)
+	Sent     func(c *Chan, v interface{})
+	Received func(c *Chan, v interface{}, ok bool)
+	Closed   func(c *Chan)
+	Block    func(op string) (unblock func())
+	Go       func(f func() error)
+
+	fset *token.FileSet
+	snip *snippet
+}
+
+// Run runs src as the body of a function, with the given variables. A
+// Machine runs one snippet at a time.
+func (m *Machine) Run(src string, vars map[string]interface{}) error {
+	m.fset, m.snip = token.NewFileSet(), wrapFuncBody(src, nil, nil, nil)
+	f, err := parser.ParseFile(m.fset, "snippet.go", m.snip.src, 0)
+	if err != nil {
+		if el, ok := err.(scanner.ErrorList); ok && len(el) > 0 {
+			return m.snip.toError(el[0].Pos, el[0].Msg)
+		}
+		return err
+	}
+	body := f.Decls[len(f.Decls)-1].(*ast.FuncDecl).Body
+	return m.catch(func() {
+		m.call(&closure{body: body, env: globals(vars)}, nil, body.Pos())
+	})
+}
+
+// Eval evaluates a single expression, with the given variables.
+func (m *Machine) Eval(expr string, vars map[string]interface{}) (v interface{}, err error) {
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	m.fset, m.snip = nil, nil
+	err = m.catch(func() { v = m.eval(e, globals(vars)) })
+	return v, err
+}
+
+func globals(vars map[string]interface{}) *scope {
+	s := newScope(nil)
+	for k, v := range vars {
+		s.define(k, v)
+	}
+	return s
+}
+
+// errCanceled unwinds the code when the context is done.
+var errCanceled = errors.New("canceled")
+
+// runError is a problem found while running, at a position.
+type runError struct {
+	pos token.Pos
+	msg string
+}
+
+func (m *Machine) errorf(pos token.Pos, format string, args ...interface{}) {
+	panic(&runError{pos: pos, msg: fmt.Sprintf(format, args...)})
+}
+
+// catch runs f, turning problems into Errors positioned in the snippet.
+func (m *Machine) catch(run func()) (err error) {
+	defer func() {
+		r := recover()
+		switch r := r.(type) {
+		case nil:
+		case *runError:
+			if m.snip == nil || !r.pos.IsValid() {
+				err = Error{Msg: r.msg}
+				return
+			}
+			err = m.snip.toError(m.fset.Position(r.pos), r.msg)
+		case error:
+			if r == errCanceled {
+				err = m.Ctx.Err()
+				return
+			}
+			err = r
+		default:
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	run()
+	return nil
+}
+
+// scope holds variables. Variables are pointers so closures share them.
+type scope struct {
+	vars   map[string]*interface{}
+	parent *scope
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{vars: make(map[string]*interface{}), parent: parent}
+}
+
+func (s *scope) define(name string, v interface{}) {
+	if name != "_" {
+		s.vars[name] = &v
+	}
+}
+
+func (s *scope) lookup(name string) *interface{} {
+	for ; s != nil; s = s.parent {
+		if p := s.vars[name]; p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// closure is a function literal, or the snippet itself.
+type closure struct {
+	params *ast.FieldList
+	body   *ast.BlockStmt
+	env    *scope
+}
+
+// builtin is a function provided by the Machine.
+type builtin func(args []interface{}) []interface{}
+
+// frame is a function call in progress.
+type frame struct {
+	results []interface{}
+	defers  []func()
+}
+
+type flow int
+
+const (
+	flowNormal flow = iota
+	flowBreak
+	flowContinue
+	flowReturn
+)
+
+// MaxMake is the most elements make may make at once (or a simulated
+// channel may buffer, or bytes a string may have), so that code can't
+// exhaust memory before it exhausts its steps.
+const MaxMake = 1 << 20
+
+// step uses up a step, and notices the context being done.
+func (m *Machine) step(pos token.Pos) { m.steps(pos, 1) }
+
+// steps uses up n steps at once.
+func (m *Machine) steps(pos token.Pos, n int) {
+	if m.Steps != nil && atomic.AddInt64(m.Steps, -int64(n)) < 0 {
+		m.errorf(pos, "stopped after too many steps")
+	}
+	select {
+	case <-m.Ctx.Done():
+		panic(errCanceled)
+	default:
+	}
+}
+
+// call calls a closure or builtin.
+func (m *Machine) call(fn interface{}, args []interface{}, pos token.Pos) []interface{} {
+	switch fn := fn.(type) {
+	case builtin:
+		return fn(args)
+	case *closure:
+		env := newScope(fn.env)
+		i := 0
+		if fn.params != nil {
+			for _, p := range fn.params.List {
+				if _, ok := p.Type.(*ast.Ellipsis); ok {
+					m.errorf(p.Pos(), "can't simulate variadic functions")
+				}
+				for _, n := range p.Names {
+					if i >= len(args) {
+						m.errorf(pos, "not enough arguments")
+					}
+					env.define(n.Name, args[i])
+					i++
+				}
+			}
+		}
+		if i != len(args) {
+			m.errorf(pos, "too many arguments")
+		}
+		fr := &frame{}
+		defer func() {
+			for i := len(fr.defers) - 1; i >= 0; i-- {
+				fr.defers[i]()
+			}
+		}()
+		m.execList(fn.body.List, env, fr)
+		return fr.results
+	case nil:
+		m.errorf(pos, "call of nil function")
+	}
+	m.errorf(pos, "can't call %v", fn)
+	return nil
+}
+
+func (m *Machine) execList(list []ast.Stmt, env *scope, fr *frame) flow {
+	for _, s := range list {
+		if f := m.exec(s, env, fr); f != flowNormal {
+			return f
+		}
+	}
+	return flowNormal
+}
+
+func (m *Machine) exec(s ast.Stmt, env *scope, fr *frame) flow {
+	m.step(s.Pos())
+	switch s := s.(type) {
+	case *ast.EmptyStmt:
+	case *ast.ExprStmt:
+		m.evalMulti(s.X, env)
+	case *ast.SendStmt:
+		c := m.chanOf(m.eval(s.Chan, env), s.Chan.Pos())
+		m.send(c, m.eval(s.Value, env), s.Pos())
+	case *ast.IncDecStmt:
+		op := token.ADD
+		if s.Tok == token.DEC {
+			op = token.SUB
+		}
+		m.assign(s.X, m.binary(op, m.eval(s.X, env), 1, s.Pos()), env)
+	case *ast.AssignStmt:
+		m.execAssign(s, env)
+	case *ast.DeclStmt:
+		d, ok := s.Decl.(*ast.GenDecl)
+		if !ok || (d.Tok != token.VAR && d.Tok != token.CONST) {
+			m.errorf(s.Pos(), "can't simulate type declarations")
+		}
+		for _, sp := range d.Specs {
+			vs := sp.(*ast.ValueSpec)
+			for i, n := range vs.Names {
+				var v interface{}
+				if i < len(vs.Values) {
+					v = m.eval(vs.Values[i], env)
+				} else {
+					v = m.zero(vs.Type)
+				}
+				env.define(n.Name, v)
+			}
+		}
+	case *ast.BlockStmt:
+		return m.execList(s.List, newScope(env), fr)
+	case *ast.IfStmt:
+		env = newScope(env)
+		if s.Init != nil {
+			m.exec(s.Init, env, fr)
+		}
+		if m.truth(m.eval(s.Cond, env), s.Cond.Pos()) {
+			return m.execList(s.Body.List, newScope(env), fr)
+		}
+		if s.Else != nil {
+			return m.exec(s.Else, env, fr)
+		}
+	case *ast.ForStmt:
+		return m.execFor(s, env, fr)
+	case *ast.RangeStmt:
+		return m.execRange(s, env, fr)
+	case *ast.SwitchStmt:
+		return m.execSwitch(s, env, fr)
+	case *ast.SelectStmt:
+		return m.execSelect(s, env, fr)
+	case *ast.GoStmt:
+		fn, args := m.evalCall(s.Call, env)
+		start := m.Go
+		if start == nil {
+			start = func(f func() error) { go f() }
+		}
+		start(func() error {
+			return m.catch(func() { m.call(fn, args, s.Pos()) })
+		})
+	case *ast.DeferStmt:
+		fn, args := m.evalCall(s.Call, env)
+		fr.defers = append(fr.defers, func() { m.call(fn, args, s.Pos()) })
+	case *ast.ReturnStmt:
+		fr.results = nil
+		for _, r := range s.Results {
+			fr.results = append(fr.results, m.eval(r, env))
+		}
+		return flowReturn
+	case *ast.BranchStmt:
+		if s.Label == nil {
+			switch s.Tok {
+			case token.BREAK:
+				return flowBreak
+			case token.CONTINUE:
+				return flowContinue
+			}
+		}
+		m.errorf(s.Pos(), "can't simulate %s", s.Tok)
+	default:
+		m.errorf(s.Pos(), "can't simulate this kind of statement")
+	}
+	return flowNormal
+}
+
+func (m *Machine) execAssign(s *ast.AssignStmt, env *scope) {
+	if s.Tok != token.DEFINE && s.Tok != token.ASSIGN {
+		// An assignment operation, such as +=.
+		op := s.Tok - token.ADD_ASSIGN + token.ADD
+		m.assign(s.Lhs[0], m.binary(op, m.eval(s.Lhs[0], env), m.eval(s.Rhs[0], env), s.Pos()), env)
+		return
+	}
+	var vs []interface{}
+	switch {
+	case len(s.Lhs) == len(s.Rhs):
+		for _, r := range s.Rhs {
+			vs = append(vs, m.eval(r, env))
+		}
+	case len(s.Rhs) == 1:
+		if u, ok := s.Rhs[0].(*ast.UnaryExpr); ok && u.Op == token.ARROW && len(s.Lhs) == 2 {
+			v, ok := m.recv(m.chanOf(m.eval(u.X, env), u.X.Pos()), u.Pos())
+			vs = []interface{}{v, ok}
+		} else {
+			vs = m.evalMulti(s.Rhs[0], env)
+		}
+	}
+	if len(vs) != len(s.Lhs) {
+		m.errorf(s.Pos(), "assignment mismatch: %d variables but %d values", len(s.Lhs), len(vs))
+	}
+	for i, l := range s.Lhs {
+		if s.Tok == token.DEFINE {
+			id, ok := l.(*ast.Ident)
+			if !ok {
+				m.errorf(l.Pos(), "non-name on left side of :=")
+			}
+			if p := env.vars[id.Name]; p != nil {
+				*p = vs[i]
+				continue
+			}
+			env.define(id.Name, vs[i])
+			continue
+		}
+		m.assign(l, vs[i], env)
+	}
+}
+
+// assign sets a variable or slice element.
+func (m *Machine) assign(lhs ast.Expr, v interface{}, env *scope) {
+	switch l := lhs.(type) {
+	case *ast.Ident:
+		if l.Name == "_" {
+			return
+		}
+		p := env.lookup(l.Name)
+		if p == nil {
+			m.errorf(l.Pos(), "undefined: %s", l.Name)
+		}
+		*p = v
+	case *ast.IndexExpr:
+		s, ok := m.eval(l.X, env).([]interface{})
+		if !ok {
+			m.errorf(l.Pos(), "can only simulate assigning to elements of slices")
+		}
+		s[m.index(m.eval(l.Index, env), len(s), l.Index.Pos())] = v
+	case *ast.ParenExpr:
+		m.assign(l.X, v, env)
+	default:
+		m.errorf(lhs.Pos(), "can't simulate assigning to this")
+	}
+}
+
+func (m *Machine) execFor(s *ast.ForStmt, env *scope, fr *frame) flow {
+	vars := newScope(env)
+	if s.Init != nil {
+		m.exec(s.Init, vars, fr)
+	}
+	for {
+		m.step(s.Pos())
+		if s.Cond != nil && !m.truth(m.eval(s.Cond, vars), s.Cond.Pos()) {
+			return flowNormal
+		}
+		switch m.execList(s.Body.List, newScope(vars), fr) {
+		case flowBreak:
+			return flowNormal
+		case flowReturn:
+			return flowReturn
+		}
+		// Each iteration has its own variables, as in Go 1.22.
+		next := newScope(env)
+		for k, p := range vars.vars {
+			next.define(k, *p)
+		}
+		vars = next
+		if s.Post != nil {
+			m.exec(s.Post, vars, fr)
+		}
+	}
+}
+
+func (m *Machine) execRange(s *ast.RangeStmt, env *scope, fr *frame) flow {
+	bind := func(k, v interface{}) *scope {
+		body := newScope(env)
+		for _, kv := range []struct {
+			e ast.Expr
+			v interface{}
+		}{{s.Key, k}, {s.Value, v}} {
+			if kv.e == nil {
+				continue
+			}
+			if s.Tok == token.DEFINE {
+				body.define(kv.e.(*ast.Ident).Name, kv.v)
+			} else {
+				m.assign(kv.e, kv.v, env)
+			}
+		}
+		return body
+	}
+	body := func(k, v interface{}) (stop bool, f flow) {
+		switch f := m.execList(s.Body.List, bind(k, v), fr); f {
+		case flowBreak:
+			return true, flowNormal
+		case flowReturn:
+			return true, flowReturn
+		}
+		return false, flowNormal
+	}
+	switch x := m.eval(s.X, env).(type) {
+	case *Chan:
+		for {
+			m.step(s.Pos())
+			v, ok := m.recv(x, s.X.Pos())
+			if !ok {
+				return flowNormal
+			}
+			if stop, f := body(v, nil); stop {
+				return f
+			}
+		}
+	case int:
+		for i := 0; i < x; i++ {
+			m.step(s.Pos())
+			if stop, f := body(i, nil); stop {
+				return f
+			}
+		}
+	case []interface{}:
+		for i, v := range x {
+			m.step(s.Pos())
+			if stop, f := body(i, v); stop {
+				return f
+			}
+		}
+	case string:
+		for i, r := range x {
+			m.step(s.Pos())
+			if stop, f := body(i, int(r)); stop {
+				return f
+			}
+		}
+	case nil:
+		m.errorf(s.X.Pos(), "can't simulate ranging over nil")
+	default:
+		m.errorf(s.X.Pos(), "can't simulate ranging over %T", x)
+	}
+	return flowNormal
+}
+
+func (m *Machine) execSwitch(s *ast.SwitchStmt, env *scope, fr *frame) flow {
+	env = newScope(env)
+	if s.Init != nil {
+		m.exec(s.Init, env, fr)
+	}
+	var tag interface{} = true
+	if s.Tag != nil {
+		tag = m.eval(s.Tag, env)
+	}
+	var match *ast.CaseClause
+	for _, c := range s.Body.List {
+		cc := c.(*ast.CaseClause)
+		if cc.List == nil {
+			if match == nil {
+				match = cc
+			}
+			continue
+		}
+		for _, e := range cc.List {
+			if m.equal(tag, m.eval(e, env), e.Pos()) {
+				return m.execCase(cc.Body, env, fr)
+			}
+		}
+	}
+	if match != nil {
+		return m.execCase(match.Body, env, fr)
+	}
+	return flowNormal
+}
+
+// execCase runs the body of a case or select clause, where break leaves the
+// switch or select.
+func (m *Machine) execCase(body []ast.Stmt, env *scope, fr *frame) flow {
+	for _, s := range body {
+		if b, ok := s.(*ast.BranchStmt); ok && b.Tok == token.FALLTHROUGH {
+			m.errorf(b.Pos(), "can't simulate fallthrough")
+		}
+	}
+	if f := m.execList(body, newScope(env), fr); f != flowBreak {
+		return f
+	}
+	return flowNormal
+}
+
+func (m *Machine) execSelect(s *ast.SelectStmt, env *scope, fr *frame) flow {
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(m.Ctx.Done())}}
+	chans := []*Chan{nil}
+	var ops []string
+	hasDefault := false
+	for _, c := range s.Body.List {
+		cc := c.(*ast.CommClause)
+		var (
+			sc reflect.SelectCase
+			ch *Chan
+		)
+		switch comm := cc.Comm.(type) {
+		case nil:
+			hasDefault = true
+			sc.Dir = reflect.SelectDefault
+		case *ast.SendStmt:
+			ch = m.chanOf(m.eval(comm.Chan, env), comm.Chan.Pos())
+			sc.Dir, sc.Send = reflect.SelectSend, reflect.ValueOf(m.eval(comm.Value, env))
+			if !sc.Send.IsValid() {
+				sc.Send = reflect.Zero(reflect.TypeOf((*interface{})(nil)).Elem())
+			}
+			ops = append(ops, "send to "+ch.label())
+		default:
+			u := recvExpr(comm)
+			if u == nil {
+				m.errorf(cc.Pos(), "can't simulate this select case")
+			}
+			ch = m.chanOf(m.eval(u.X, env), u.X.Pos())
+			sc.Dir = reflect.SelectRecv
+			ops = append(ops, "receive from "+ch.label())
+		}
+		if ch != nil && ch.C != nil {
+			sc.Chan = reflect.ValueOf(ch.C)
+		}
+		cases = append(cases, sc)
+		chans = append(chans, ch)
+	}
+	if !hasDefault && m.Block != nil {
+		unblock := m.Block("select (" + strings.Join(ops, ", ") + ")")
+		defer unblock()
+	}
+	i, v, ok := reflect.Select(cases)
+	if i == 0 {
+		panic(errCanceled)
+	}
+	cc := s.Body.List[i-1].(*ast.CommClause)
+	body := newScope(env)
+	switch cases[i].Dir {
+	case reflect.SelectSend:
+		if m.Sent != nil {
+			m.Sent(chans[i], cases[i].Send.Interface())
+		}
+	case reflect.SelectRecv:
+		var x interface{}
+		if ok {
+			x = v.Interface()
+		}
+		if m.Received != nil {
+			m.Received(chans[i], x, ok)
+		}
+		if a, isAssign := cc.Comm.(*ast.AssignStmt); isAssign {
+			vs := []interface{}{x, ok}
+			for j, l := range a.Lhs {
+				if a.Tok == token.DEFINE {
+					body.define(l.(*ast.Ident).Name, vs[j])
+				} else {
+					m.assign(l, vs[j], env)
+				}
+			}
+		}
+	}
+	return m.execCase(cc.Body, body, fr)
+}
+
+// recvExpr returns the receive in a select case, or nil.
+func recvExpr(s ast.Stmt) *ast.UnaryExpr {
+	var e ast.Expr
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		e = s.X
+	case *ast.AssignStmt:
+		if len(s.Rhs) == 1 {
+			e = s.Rhs[0]
+		}
+	}
+	if u, ok := e.(*ast.UnaryExpr); ok && u.Op == token.ARROW {
+		return u
+	}
+	return nil
+}
+
+// label names the channel for messages.
+func (c *Chan) label() string {
+	if c == nil {
+		return "nil channel"
+	}
+	if c.Name == "" {
+		return "a channel"
+	}
+	return c.Name
+}
+
+func (m *Machine) chanOf(v interface{}, pos token.Pos) *Chan {
+	switch c := v.(type) {
+	case *Chan:
+		return c
+	case nil:
+		return &Chan{}
+	}
+	m.errorf(pos, "%v is not a channel", v)
+	return nil
+}
+
+// block waits on a nil channel: forever, unless the context is done.
+func (m *Machine) block(op string) {
+	if m.Block != nil {
+		defer m.Block(op)()
+	}
+	<-m.Ctx.Done()
+	panic(errCanceled)
+}
+
+func (m *Machine) send(c *Chan, v interface{}, pos token.Pos) {
+	if c.C == nil {
+		m.block("send to nil channel")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*runError); !ok && r != errCanceled {
+				m.errorf(pos, "send on closed channel %s", c.label())
+			}
+			panic(r)
+		}
+	}()
+	select {
+	case c.C <- v:
+	default:
+		unblock := func() {}
+		if m.Block != nil {
+			unblock = m.Block("send to " + c.label())
+		}
+		select {
+		case c.C <- v:
+			unblock()
+		case <-m.Ctx.Done():
+			unblock()
+			panic(errCanceled)
+		}
+	}
+	if m.Sent != nil {
+		m.Sent(c, v)
+	}
+}
+
+func (m *Machine) recv(c *Chan, pos token.Pos) (v interface{}, ok bool) {
+	if c.C == nil {
+		m.block("receive from nil channel")
+	}
+	select {
+	case v, ok = <-c.C:
+	default:
+		unblock := func() {}
+		if m.Block != nil {
+			unblock = m.Block("receive from " + c.label())
+		}
+		select {
+		case v, ok = <-c.C:
+			unblock()
+		case <-m.Ctx.Done():
+			unblock()
+			panic(errCanceled)
+		}
+	}
+	if m.Received != nil {
+		m.Received(c, v, ok)
+	}
+	return v, ok
+}
+
+func (m *Machine) close(c *Chan, pos token.Pos) {
+	if c.C == nil {
+		m.errorf(pos, "close of nil channel")
+	}
+	func() {
+		defer func() {
+			if recover() != nil {
+				m.errorf(pos, "close of closed channel %s", c.label())
+			}
+		}()
+		close(c.C)
+	}()
+	if m.Closed != nil {
+		m.Closed(c)
+	}
+}
+
+// zero returns the zero value of a type.
+func (m *Machine) zero(t ast.Expr) interface{} {
+	switch t := t.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte", "rune":
+			return 0
+		case "float32", "float64":
+			return 0.0
+		case "string":
+			return ""
+		case "bool":
+			return false
+		}
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok && x.Name == "sync" && t.Sel.Name == "WaitGroup" {
+			return &waitGroup{}
+		}
+		if x, ok := t.X.(*ast.Ident); ok && x.Name == "time" && t.Sel.Name == "Duration" {
+			return 0
+		}
+	}
+	return nil
+}
+
+func (m *Machine) truth(v interface{}, pos token.Pos) bool {
+	b, ok := v.(bool)
+	if !ok {
+		m.errorf(pos, "non-boolean condition %v", v)
+	}
+	return b
+}
+
+func (m *Machine) index(v interface{}, n int, pos token.Pos) int {
+	i, ok := v.(int)
+	if !ok {
+		m.errorf(pos, "index %v is not an integer", v)
+	}
+	if i < 0 || i >= n {
+		m.errorf(pos, "index out of range [%d] with length %d", i, n)
+	}
+	return i
+}
+
+// eval evaluates an expression with a single value.
+func (m *Machine) eval(e ast.Expr, env *scope) interface{} {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT:
+			i, err := strconv.ParseInt(e.Value, 0, 64)
+			if err != nil {
+				m.errorf(e.Pos(), "%v", err)
+			}
+			return int(i)
+		case token.FLOAT:
+			f, err := strconv.ParseFloat(e.Value, 64)
+			if err != nil {
+				m.errorf(e.Pos(), "%v", err)
+			}
+			return f
+		case token.STRING:
+			s, err := strconv.Unquote(e.Value)
+			if err != nil {
+				m.errorf(e.Pos(), "%v", err)
+			}
+			return s
+		case token.CHAR:
+			s, err := strconv.Unquote(e.Value)
+			if err != nil {
+				m.errorf(e.Pos(), "%v", err)
+			}
+			return int([]rune(s)[0])
+		}
+	case *ast.Ident:
+		if p := env.lookup(e.Name); p != nil {
+			return *p
+		}
+		switch e.Name {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "nil":
+			return nil
+		}
+		m.errorf(e.Pos(), "undefined: %s", e.Name)
+	case *ast.ParenExpr:
+		return m.eval(e.X, env)
+	case *ast.FuncLit:
+		return &closure{params: e.Type.Params, body: e.Body, env: env}
+	case *ast.UnaryExpr:
+		if e.Op == token.ARROW {
+			v, _ := m.recv(m.chanOf(m.eval(e.X, env), e.X.Pos()), e.Pos())
+			return v
+		}
+		return m.unary(e.Op, m.eval(e.X, env), e.Pos())
+	case *ast.BinaryExpr:
+		l := m.eval(e.X, env)
+		switch e.Op {
+		case token.LAND:
+			return m.truth(l, e.X.Pos()) && m.truth(m.eval(e.Y, env), e.Y.Pos())
+		case token.LOR:
+			return m.truth(l, e.X.Pos()) || m.truth(m.eval(e.Y, env), e.Y.Pos())
+		}
+		return m.binary(e.Op, l, m.eval(e.Y, env), e.OpPos)
+	case *ast.SelectorExpr:
+		if x, ok := e.X.(*ast.Ident); ok && env.lookup(x.Name) == nil {
+			if v, ok := m.pkgMember(x.Name, e.Sel.Name); ok {
+				return v
+			}
+			m.errorf(e.Pos(), "can't simulate %s.%s", x.Name, e.Sel.Name)
+		}
+		if wg, ok := m.eval(e.X, env).(*waitGroup); ok {
+			if v := m.wgMethod(wg, e.Sel.Name, e.Pos()); v != nil {
+				return v
+			}
+		}
+		m.errorf(e.Sel.Pos(), "can't simulate fields or methods, such as %s", e.Sel.Name)
+	case *ast.IndexExpr:
+		x, i := m.eval(e.X, env), m.eval(e.Index, env)
+		switch x := x.(type) {
+		case []interface{}:
+			return x[m.index(i, len(x), e.Index.Pos())]
+		case string:
+			return int(x[m.index(i, len(x), e.Index.Pos())])
+		}
+		m.errorf(e.Pos(), "can only simulate indexing slices and strings")
+	case *ast.SliceExpr:
+		x := m.eval(e.X, env)
+		n := 0
+		switch x := x.(type) {
+		case []interface{}:
+			n = len(x)
+		case string:
+			n = len(x)
+		default:
+			m.errorf(e.Pos(), "can only simulate slicing slices and strings")
+		}
+		lo, hi := 0, n
+		if e.Low != nil {
+			lo = m.index(m.eval(e.Low, env), n+1, e.Low.Pos())
+		}
+		if e.High != nil {
+			hi = m.index(m.eval(e.High, env), n+1, e.High.Pos())
+		}
+		if lo > hi || e.Slice3 {
+			m.errorf(e.Pos(), "can't simulate slice [%d:%d]", lo, hi)
+		}
+		if s, ok := x.(string); ok {
+			return s[lo:hi]
+		}
+		return x.([]interface{})[lo:hi]
+	case *ast.CompositeLit:
+		if _, ok := e.Type.(*ast.ArrayType); !ok {
+			m.errorf(e.Pos(), "can only simulate slice literals")
+		}
+		s := make([]interface{}, 0, len(e.Elts))
+		for _, el := range e.Elts {
+			if _, ok := el.(*ast.KeyValueExpr); ok {
+				m.errorf(el.Pos(), "can't simulate keyed elements")
+			}
+			s = append(s, m.eval(el, env))
+		}
+		return s
+	case *ast.CallExpr:
+		vs := m.evalMulti(e, env)
+		if len(vs) != 1 {
+			m.errorf(e.Pos(), "function call has %d values, not 1", len(vs))
+		}
+		return vs[0]
+	default:
+		m.errorf(e.Pos(), "can't simulate this kind of expression")
+	}
+	m.errorf(e.Pos(), "can't simulate this expression")
+	return nil
+}
+
+// evalMulti evaluates an expression, which may be a call with any number of
+// results.
+func (m *Machine) evalMulti(e ast.Expr, env *scope) []interface{} {
+	c, ok := e.(*ast.CallExpr)
+	if !ok {
+		return []interface{}{m.eval(e, env)}
+	}
+	if id, ok := c.Fun.(*ast.Ident); ok && env.lookup(id.Name) == nil {
+		if vs, ok := m.callBuiltin(id.Name, c, env); ok {
+			return vs
+		}
+	}
+	if p, ok := c.Fun.(*ast.ParenExpr); ok {
+		if _, ok := p.X.(*ast.ChanType); ok {
+			m.errorf(c.Pos(), "can't simulate channel conversions")
+		}
+	}
+	fn, args := m.evalCall(c, env)
+	return m.call(fn, args, c.Pos())
+}
+
+// evalCall evaluates the function and arguments of a call.
+func (m *Machine) evalCall(c *ast.CallExpr, env *scope) (interface{}, []interface{}) {
+	if id, ok := c.Fun.(*ast.Ident); ok && env.lookup(id.Name) == nil {
+		// Builtins can be deferred or started as goroutines too.
+		if _, ok := builtinNames[id.Name]; ok {
+			return builtin(func([]interface{}) []interface{} {
+				vs, _ := m.callBuiltin(id.Name, c, env)
+				return vs
+			}), nil
+		}
+	}
+	fn := m.eval(c.Fun, env)
+	if c.Ellipsis.IsValid() {
+		m.errorf(c.Ellipsis, "can't simulate ... arguments")
+	}
+	args := make([]interface{}, 0, len(c.Args))
+	for _, a := range c.Args {
+		args = append(args, m.eval(a, env))
+	}
+	return fn, args
+}
+
+var builtinNames = map[string]bool{
+	"len": true, "cap": true, "close": true, "append": true, "make": true,
+	"panic": true, "min": true, "max": true, "print": true, "println": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"byte": true, "rune": true, "float32": true, "float64": true, "string": true,
+}
+
+// callBuiltin calls a predeclared function or conversion, if name is one.
+func (m *Machine) callBuiltin(name string, c *ast.CallExpr, env *scope) ([]interface{}, bool) {
+	if !builtinNames[name] {
+		return nil, false
+	}
+	if name == "make" {
+		return []interface{}{m.makeValue(c, env)}, true
+	}
+	args := make([]interface{}, 0, len(c.Args))
+	for _, a := range c.Args {
+		args = append(args, m.eval(a, env))
+	}
+	one := func(v interface{}) ([]interface{}, bool) { return []interface{}{v}, true }
+	need := func(n int) {
+		if len(args) != n {
+			m.errorf(c.Pos(), "%s needs %d argument(s)", name, n)
+		}
+	}
+	switch name {
+	case "len", "cap":
+		need(1)
+		switch x := args[0].(type) {
+		case string:
+			return one(len(x))
+		case []interface{}:
+			if name == "cap" {
+				return one(cap(x))
+			}
+			return one(len(x))
+		case *Chan:
+			if name == "cap" {
+				return one(cap(x.C))
+			}
+			return one(len(x.C))
+		}
+		m.errorf(c.Pos(), "invalid argument for %s: %v", name, args[0])
+	case "close":
+		need(1)
+		m.close(m.chanOf(args[0], c.Args[0].Pos()), c.Pos())
+		return nil, true
+	case "append":
+		if len(args) == 0 {
+			m.errorf(c.Pos(), "append needs a slice")
+		}
+		s, ok := args[0].([]interface{})
+		if !ok && args[0] != nil {
+			m.errorf(c.Pos(), "can only simulate appending to slices")
+		}
+		if c.Ellipsis.IsValid() {
+			more, ok := args[1].([]interface{})
+			if len(args) != 2 || !ok {
+				m.errorf(c.Ellipsis, "can only simulate appending a slice...")
+			}
+			m.steps(c.Pos(), len(more))
+			return one(append(s, more...))
+		}
+		m.steps(c.Pos(), len(args)-1)
+		return one(append(s, args[1:]...))
+	case "panic":
+		need(1)
+		m.errorf(c.Pos(), "panic: %v", args[0])
+	case "min", "max":
+		if len(args) == 0 {
+			m.errorf(c.Pos(), "%s needs arguments", name)
+		}
+		r := args[0]
+		for _, a := range args[1:] {
+			less := m.binary(token.LSS, a, r, c.Pos()).(bool)
+			if less == (name == "min") && !m.equal(a, r, c.Pos()) {
+				r = a
+			}
+		}
+		return one(r)
+	case "print", "println":
+		if m.Print != nil {
+			m.Print(fmt.Sprintln(args...))
+		}
+		return nil, true
+	case "float32", "float64":
+		need(1)
+		return one(m.toFloat(args[0], c.Pos()))
+	case "string":
+		need(1)
+		switch x := args[0].(type) {
+		case string:
+			return one(x)
+		case int:
+			return one(string(rune(x)))
+		}
+		m.errorf(c.Pos(), "can't simulate converting %v to string", args[0])
+	default:
+		// An integer conversion.
+		need(1)
+		switch x := args[0].(type) {
+		case int:
+			return one(x)
+		case float64:
+			return one(int(x))
+		}
+		m.errorf(c.Pos(), "can't simulate converting %v to %s", args[0], name)
+	}
+	return nil, true
+}
+
+// makeValue makes a channel or slice.
+func (m *Machine) makeValue(c *ast.CallExpr, env *scope) interface{} {
+	if len(c.Args) == 0 {
+		m.errorf(c.Pos(), "make needs a type")
+	}
+	n := 0
+	if len(c.Args) > 1 {
+		v, ok := m.eval(c.Args[1], env).(int)
+		if !ok || v < 0 {
+			m.errorf(c.Args[1].Pos(), "invalid size for make")
+		}
+		if v > MaxMake {
+			m.errorf(c.Args[1].Pos(), "make of %d elements is too big to simulate", v)
+		}
+		n = v
+	}
+	m.steps(c.Pos(), n)
+	switch c.Args[0].(type) {
+	case *ast.ChanType:
+		return &Chan{C: make(chan interface{}, n)}
+	case *ast.ArrayType:
+		s := make([]interface{}, n)
+		for i := range s {
+			s[i] = m.zero(c.Args[0].(*ast.ArrayType).Elt)
+		}
+		return s
+	}
+	m.errorf(c.Pos(), "can only simulate making channels and slices")
+	return nil
+}
+
+func (m *Machine) toFloat(v interface{}, pos token.Pos) float64 {
+	switch x := v.(type) {
+	case int:
+		return float64(x)
+	case float64:
+		return x
+	}
+	m.errorf(pos, "%v is not a number", v)
+	return 0
+}
+
+func (m *Machine) unary(op token.Token, v interface{}, pos token.Pos) interface{} {
+	switch x := v.(type) {
+	case int:
+		switch op {
+		case token.SUB:
+			return -x
+		case token.ADD:
+			return x
+		case token.XOR:
+			return ^x
+		}
+	case float64:
+		switch op {
+		case token.SUB:
+			return -x
+		case token.ADD:
+			return x
+		}
+	case bool:
+		if op == token.NOT {
+			return !x
+		}
+	}
+	m.errorf(pos, "can't simulate %s%v", op, v)
+	return nil
+}
+
+func (m *Machine) binary(op token.Token, l, r interface{}, pos token.Pos) interface{} {
+	switch op {
+	case token.EQL:
+		return m.equal(l, r, pos)
+	case token.NEQ:
+		return !m.equal(l, r, pos)
+	}
+	if a, ok := l.(int); ok {
+		if b, ok := r.(int); ok {
+			switch op {
+			case token.ADD:
+				return a + b
+			case token.SUB:
+				return a - b
+			case token.MUL:
+				return a * b
+			case token.QUO, token.REM:
+				if b == 0 {
+					m.errorf(pos, "integer divide by zero")
+				}
+				if op == token.QUO {
+					return a / b
+				}
+				return a % b
+			case token.AND:
+				return a & b
+			case token.OR:
+				return a | b
+			case token.XOR:
+				return a ^ b
+			case token.AND_NOT:
+				return a &^ b
+			case token.SHL, token.SHR:
+				if b < 0 {
+					m.errorf(pos, "negative shift amount")
+				}
+				if op == token.SHL {
+					return a << uint(b)
+				}
+				return a >> uint(b)
+			case token.LSS:
+				return a < b
+			case token.LEQ:
+				return a <= b
+			case token.GTR:
+				return a > b
+			case token.GEQ:
+				return a >= b
+			}
+		}
+	}
+	if a, ok := l.(string); ok {
+		if b, ok := r.(string); ok {
+			switch op {
+			case token.ADD:
+				n := len(a) + len(b)
+				if n > MaxMake {
+					m.errorf(pos, "string of %d bytes is too big to simulate", n)
+				}
+				m.steps(pos, n)
+				return a + b
+			case token.LSS:
+				return a < b
+			case token.LEQ:
+				return a <= b
+			case token.GTR:
+				return a > b
+			case token.GEQ:
+				return a >= b
+			}
+		}
+	}
+	_, lf := l.(float64)
+	_, rf := r.(float64)
+	_, li := l.(int)
+	_, ri := r.(int)
+	if (lf || li) && (rf || ri) {
+		a, b := m.toFloat(l, pos), m.toFloat(r, pos)
+		switch op {
+		case token.ADD:
+			return a + b
+		case token.SUB:
+			return a - b
+		case token.MUL:
+			return a * b
+		case token.QUO:
+			return a / b
+		case token.LSS:
+			return a < b
+		case token.LEQ:
+			return a <= b
+		case token.GTR:
+			return a > b
+		case token.GEQ:
+			return a >= b
+		}
+	}
+	m.errorf(pos, "can't simulate %v %s %v", l, op, r)
+	return nil
+}
+
+// equal compares values as == does, numbers regardless of type.
+func (m *Machine) equal(l, r interface{}, pos token.Pos) bool {
+	_, lf := l.(float64)
+	_, rf := r.(float64)
+	if lf || rf {
+		_, li := l.(int)
+		_, ri := r.(int)
+		if (lf || li) && (rf || ri) {
+			return m.toFloat(l, pos) == m.toFloat(r, pos)
+		}
+	}
+	defer func() {
+		if recover() != nil {
+			m.errorf(pos, "can't compare %v and %v", l, r)
+		}
+	}()
+	return l == r
+}
+
+// waitGroup is sync.WaitGroup, with Wait giving up when the context is done.
+type waitGroup struct {
+	mu   sync.Mutex
+	n    int
+	done chan struct{}
+}
+
+func (m *Machine) wgMethod(wg *waitGroup, name string, pos token.Pos) builtin {
+	switch name {
+	case "Add", "Done":
+		return func(args []interface{}) []interface{} {
+			d := -1
+			if name == "Add" {
+				if len(args) != 1 {
+					m.errorf(pos, "Add needs 1 argument")
+				}
+				n, ok := args[0].(int)
+				if !ok {
+					m.errorf(pos, "%v is not an integer", args[0])
+				}
+				d = n
+			}
+			wg.mu.Lock()
+			defer wg.mu.Unlock()
+			wg.n += d
+			if wg.n < 0 {
+				m.errorf(pos, "negative WaitGroup counter")
+			}
+			if wg.n == 0 && wg.done != nil {
+				close(wg.done)
+				wg.done = nil
+			}
+			return nil
+		}
+	case "Wait":
+		return func([]interface{}) []interface{} {
+			wg.mu.Lock()
+			if wg.n == 0 {
+				wg.mu.Unlock()
+				return nil
+			}
+			if wg.done == nil {
+				wg.done = make(chan struct{})
+			}
+			d := wg.done
+			wg.mu.Unlock()
+			if m.Block != nil {
+				defer m.Block("wait for a WaitGroup")()
+			}
+			select {
+			case <-d:
+			case <-m.Ctx.Done():
+				panic(errCanceled)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// stream is os.Stdout or os.Stderr.
+type stream string
+
+// pkgMember returns a function or value from one of the few packages the
+// Machine provides.
+func (m *Machine) pkgMember(pkg, name string) (interface{}, bool) {
+	str := func(f func(string) string) builtin {
+		return func(args []interface{}) []interface{} {
+			return []interface{}{f(fmt.Sprint(args[0]))}
+		}
+	}
+	str2 := func(f func(string, string) bool) builtin {
+		return func(args []interface{}) []interface{} {
+			return []interface{}{f(fmt.Sprint(args[0]), fmt.Sprint(args[1]))}
+		}
+	}
+	num := func(f func(float64) float64) builtin {
+		return func(args []interface{}) []interface{} {
+			return []interface{}{f(m.toFloat(args[0], token.NoPos))}
+		}
+	}
+	num2 := func(f func(float64, float64) float64) builtin {
+		return func(args []interface{}) []interface{} {
+			return []interface{}{f(m.toFloat(args[0], token.NoPos), m.toFloat(args[1], token.NoPos))}
+		}
+	}
+	printer := func(f func(args []interface{}) string) builtin {
+		return func(args []interface{}) []interface{} {
+			if m.Print != nil {
+				m.Print(f(args))
+			}
+			return nil
+		}
+	}
+	format := func(args []interface{}) (string, []interface{}) {
+		if len(args) == 0 {
+			m.errorf(token.NoPos, "missing format")
+		}
+		return fmt.Sprint(args[0]), args[1:]
+	}
+	// The standard streams both go to Print.
+	fprinter := func(f func(args []interface{}) string) builtin {
+		return printer(func(a []interface{}) string {
+			if len(a) == 0 {
+				m.errorf(token.NoPos, "missing writer")
+			}
+			if _, ok := a[0].(stream); !ok {
+				m.errorf(token.NoPos, "can't simulate writing to %v", a[0])
+			}
+			return f(a[1:])
+		})
+	}
+	switch pkg + "." + name {
+	case "fmt.Print":
+		return printer(func(a []interface{}) string { return fmt.Sprint(a...) }), true
+	case "fmt.Println":
+		return printer(func(a []interface{}) string { return fmt.Sprintln(a...) }), true
+	case "fmt.Printf":
+		return printer(func(a []interface{}) string { f, a := format(a); return fmt.Sprintf(f, a...) }), true
+	case "fmt.Fprint":
+		return fprinter(func(a []interface{}) string { return fmt.Sprint(a...) }), true
+	case "fmt.Fprintln":
+		return fprinter(func(a []interface{}) string { return fmt.Sprintln(a...) }), true
+	case "fmt.Fprintf":
+		return fprinter(func(a []interface{}) string { f, a := format(a); return fmt.Sprintf(f, a...) }), true
+	case "os.Stdout":
+		return stream("stdout"), true
+	case "os.Stderr":
+		return stream("stderr"), true
+	case "os.Exit":
+		return builtin(func(a []interface{}) []interface{} {
+			m.errorf(token.NoPos, "exit status %v", a[0])
+			return nil
+		}), true
+	case "fmt.Sprint":
+		return builtin(func(a []interface{}) []interface{} { return []interface{}{fmt.Sprint(a...)} }), true
+	case "fmt.Sprintln":
+		return builtin(func(a []interface{}) []interface{} { return []interface{}{fmt.Sprintln(a...)} }), true
+	case "fmt.Sprintf":
+		return builtin(func(a []interface{}) []interface{} { f, a := format(a); return []interface{}{fmt.Sprintf(f, a...)} }), true
+	case "fmt.Errorf":
+		return builtin(func(a []interface{}) []interface{} { f, a := format(a); return []interface{}{fmt.Errorf(f, a...)} }), true
+	case "strings.ToUpper":
+		return str(strings.ToUpper), true
+	case "strings.ToLower":
+		return str(strings.ToLower), true
+	case "strings.TrimSpace":
+		return str(strings.TrimSpace), true
+	case "strings.Contains":
+		return str2(strings.Contains), true
+	case "strings.HasPrefix":
+		return str2(strings.HasPrefix), true
+	case "strings.HasSuffix":
+		return str2(strings.HasSuffix), true
+	case "strconv.Itoa":
+		return builtin(func(a []interface{}) []interface{} { return []interface{}{fmt.Sprint(a[0])} }), true
+	case "math.Sqrt":
+		return num(math.Sqrt), true
+	case "math.Abs":
+		return num(math.Abs), true
+	case "math.Floor":
+		return num(math.Floor), true
+	case "math.Ceil":
+		return num(math.Ceil), true
+	case "math.Pow":
+		return num2(math.Pow), true
+	case "math.Mod":
+		return num2(math.Mod), true
+	case "math.Pi":
+		return math.Pi, true
+	case "time.Nanosecond":
+		return int(time.Nanosecond), true
+	case "time.Microsecond":
+		return int(time.Microsecond), true
+	case "time.Millisecond":
+		return int(time.Millisecond), true
+	case "time.Second":
+		return int(time.Second), true
+	case "time.Minute":
+		return int(time.Minute), true
+	case "time.Sleep":
+		return builtin(func(a []interface{}) []interface{} {
+			d, ok := a[0].(int)
+			if !ok {
+				m.errorf(token.NoPos, "%v is not a duration", a[0])
+			}
+			t := time.NewTimer(time.Duration(d))
+			defer t.Stop()
+			select {
+			case <-t.C:
+			case <-m.Ctx.Done():
+				panic(errCanceled)
+			}
+			return nil
+		}), true
+	}
+	return nil, false
+}
@@ -0,0 +1,195 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMachineRun(t *testing.T) {
+	tests := []struct {
+		src  string
+		in   []interface{}
+		want string
+		err  string
+	}{
+		{
+			src: `for n := range in {
+	if n%2 == 0 {
+		continue
+	}
+	fmt.Println(n, n*1.5)
+}`,
+			in:   []interface{}{1, 2, 3},
+			want: "1 1.5\n3 4.5\n",
+		},
+		{
+			src: `var wg sync.WaitGroup
+c := make(chan string, 1)
+for i := 0; i < 3; i++ {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c <- strings.ToUpper(fmt.Sprint("x", i))
+		fmt.Print(<-c, ",")
+	}()
+}
+wg.Wait()
+s := []int{4, 5}
+s = append(s, len(s))
+fmt.Print(s[1:], max(2, 7, 3))`,
+			// Goroutines print in any order, so only the end is checked.
+			want: "[5 2] 7",
+		},
+		{
+			src: `t := 0
+for x := range 5 {
+	switch {
+	case x > 3:
+		break
+	default:
+		t += x
+	}
+}
+select {
+case v, ok := <-in:
+	fmt.Println(t, v, ok)
+}`,
+			want: "6 <nil> false\n",
+		},
+		{
+			src: `x := 1
+x = x / (x - 1)`,
+			err: "2:7: integer divide by zero",
+		},
+		{
+			src: `var m map[string]int
+fmt.Println(m)
+m.Len()`,
+			err: "3:3: can't simulate fields or methods, such as Len",
+		},
+		{
+			src: `close(in)`,
+			err: "1:1: close of closed channel in",
+		},
+	}
+	for _, test := range tests {
+		in := &Chan{Name: "in", C: make(chan interface{}, len(test.in))}
+		for _, v := range test.in {
+			in.C <- v
+		}
+		close(in.C)
+		var (
+			mu  sync.Mutex
+			out strings.Builder
+		)
+		steps := int64(1000)
+		m := &Machine{
+			Ctx:   context.Background(),
+			Steps: &steps,
+			Print: func(s string) {
+				mu.Lock()
+				defer mu.Unlock()
+				out.WriteString(s)
+			},
+		}
+		err := m.Run(test.src, map[string]interface{}{"in": in})
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Run(%q) err = %v, want %q", test.src, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Run(%q) err = %v", test.src, err)
+			continue
+		}
+		if got := out.String(); !strings.HasSuffix(got, test.want) {
+			t.Errorf("Run(%q) printed %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestMachineSteps(t *testing.T) {
+	steps := int64(100)
+	m := &Machine{Ctx: context.Background(), Steps: &steps}
+	err := m.Run("for {\n}", nil)
+	if want := "1:1: stopped after too many steps"; err == nil || err.Error() != want {
+		t.Errorf("Run(infinite loop) err = %v, want %q", err, want)
+	}
+}
+
+func TestMachineMakeSteps(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"_ = make([]int, 1<<40)", "1:17: make of 1099511627776 elements is too big to simulate"},
+		{"_ = make(chan int, 1<<40)", "1:20: make of 1099511627776 elements is too big to simulate"},
+		{"_ = make([]int, 1000)", "1:5: stopped after too many steps"},
+		{"s := make([]int, 50)\ns = append(s, s...)", "2:5: stopped after too many steps"},
+		{"s := \"0123456789\"\nfor i := 0; i < 3; i++ {\n\ts += s\n}", "3:2: stopped after too many steps"},
+	}
+	for _, test := range tests {
+		steps := int64(100)
+		m := &Machine{Ctx: context.Background(), Steps: &steps}
+		err := m.Run(test.src, nil)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Run(%q) err = %v, want %q", test.src, err, test.want)
+		}
+	}
+}
+
+func TestMachineStringTooBig(t *testing.T) {
+	// Without a limit on steps, doubling a string stops at MaxMake.
+	m := &Machine{Ctx: context.Background()}
+	src := "s := \"0123456789\"\nfor {\n\ts += s\n}"
+	err := m.Run(src, nil)
+	if want := "3:2: string of 1310720 bytes is too big to simulate"; err == nil || err.Error() != want {
+		t.Errorf("Run(%q) err = %v, want %q", src, err, want)
+	}
+}
+
+func TestMachineCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var blocked []string
+	m := &Machine{
+		Ctx: ctx,
+		Block: func(op string) func() {
+			blocked = append(blocked, op)
+			cancel()
+			return func() {}
+		},
+	}
+	c := &Chan{Name: "out", C: make(chan interface{})}
+	err := m.Run("out <- 1", map[string]interface{}{"out": c})
+	if err != context.Canceled {
+		t.Errorf("Run(blocked send) err = %v, want %v", err, context.Canceled)
+	}
+	if want := []string{"send to out"}; !reflect.DeepEqual(blocked, want) {
+		t.Errorf("blocked on %q, want %q", blocked, want)
+	}
+}
+
+func TestMachineEval(t *testing.T) {
+	m := &Machine{Ctx: context.Background()}
+	got, err := m.Eval(`x % 3 == 0 && "a"+"b" != "c"`, map[string]interface{}{"x": 9})
+	if err != nil || got != true {
+		t.Errorf("Eval() = %v, %v, want true, nil", got, err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// lintLineRE matches the usual "file:line:col: message" output of linters.
+var lintLineRE = regexp.MustCompile(`snippet\.go:(\d+):(?:(\d+):)?\s*(.*)$`)
+
+// usedImports returns the imports whose package name is referred to in body.
+// Linters generally refuse to analyse code with unused imports.
+func usedImports(body string, imports []string) []string {
+	s := wrapFuncBody(body, nil, nil, nil)
+	f, err := parser.ParseFile(token.NewFileSet(), "snippet.go", s.src, 0)
+	if err != nil {
+		// Let the linter report the problem.
+		return imports
+	}
+	names := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		se, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := se.X.(*ast.Ident); ok && id.Obj == nil {
+			names[id.Name] = true
+		}
+		return true
+	})
+	var used []string
+	for _, i := range imports {
+		if names[path.Base(i)] {
+			used = append(used, i)
+		}
+	}
+	return used
+}
+
+// Lint runs an external linter (such as "go vet" or "staticcheck") over body,
+// wrapped the same way as TypeCheck. The linter is invoked with the path to
+// a file containing the wrapped code appended to linter. Problems it reports
+// are returned relative to body.
+func Lint(linter []string, body string, imports []string, vars, params []Var) ([]Error, error) {
+	if len(linter) == 0 {
+		return nil, fmt.Errorf("no linter")
+	}
+	s := wrapFuncBody(body, usedImports(body, imports), vars, params)
+
+	dir, err := ioutil.TempDir("", "shenzhen-go-lint")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "snippet.go"), s.src, 0644); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(linter[0], append(linter[1:], "snippet.go")...)
+	cmd.Dir = dir
+	out, runErr := cmd.CombinedOutput()
+
+	var errs []Error
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		m := lintLineRE.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(m[1])
+		col, _ := strconv.Atoi(m[2]) // Missing column => 0.
+		errs = append(errs, s.toErrorAt(line, col, m[3]))
+	}
+	if runErr != nil && len(errs) == 0 {
+		// The linter failed without saying anything recognisable.
+		return nil, fmt.Errorf("%s: %v:\n%s", linter[0], runErr, out)
+	}
+	return errs, nil
+}
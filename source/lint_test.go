@@ -0,0 +1,57 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go tool to vet with")
+	}
+	vars := []Var{{Name: "out", Type: "chan string"}}
+	tests := []struct {
+		src  string
+		want []Error
+	}{
+		{
+			src: `out <- fmt.Sprintf("%d", 1)
+close(out)`,
+		},
+		{
+			src: `x := "a"
+out <- fmt.Sprintf("%d", x)`,
+			want: []Error{{Line: 2, Column: 21, Msg: "fmt.Sprintf format %d has arg x of wrong type string"}},
+		},
+	}
+	for _, test := range tests {
+		got, err := Lint([]string{"go", "vet"}, test.src, []string{"fmt", "sync"}, vars, nil)
+		if err != nil {
+			t.Errorf("Lint(%q) error = %v", test.src, err)
+			continue
+		}
+		for i := range got {
+			// Older versions of vet don't say which check found the problem.
+			got[i].Msg = strings.TrimPrefix(got[i].Msg, "printf: ")
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Lint(%q) = %v, want %v", test.src, got, test.want)
+		}
+	}
+}
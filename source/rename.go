@@ -0,0 +1,78 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+)
+
+// RenameIdent rewrites src so that every free use of the identifier from (as
+// returned by FreeIdents) becomes to. Declarations and uses of local
+// variables called from are left alone, as is all the formatting. It is an
+// error if src declares something called to, since the renamed uses could
+// then refer to it instead.
+func RenameIdent(src, from, to string) (string, error) {
+	if from == to {
+		return src, nil
+	}
+	s := wrapFuncBody(src, nil, nil, nil)
+	f, err := parser.ParseFile(token.NewFileSet(), "snippet.go", s.src, 0)
+	if err != nil {
+		return "", err
+	}
+	skip := make(map[*ast.Ident]bool)
+	var offs []int
+	var conflict error
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			skip[x.Sel] = true
+		case *ast.KeyValueExpr:
+			if id, ok := x.Key.(*ast.Ident); ok {
+				skip[id] = true
+			}
+		case *ast.BranchStmt:
+			if x.Label != nil {
+				skip[x.Label] = true
+			}
+		case *ast.Ident:
+			if x.Name == to && x.Obj != nil && conflict == nil {
+				conflict = fmt.Errorf("the code declares its own %s", to)
+			}
+			if x.Name == from && x.Obj == nil && !skip[x] {
+				offs = append(offs, int(x.Pos())-1-s.offset)
+			}
+		}
+		return true
+	})
+	if conflict != nil {
+		return "", conflict
+	}
+	sort.Ints(offs)
+
+	out := make([]byte, 0, len(src)+len(offs)*(len(to)-len(from)))
+	last := 0
+	for _, o := range offs {
+		out = append(out, src[last:o]...)
+		out = append(out, to...)
+		last = o + len(from)
+	}
+	out = append(out, src[last:]...)
+	return string(out), nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import "testing"
+
+func TestRenameIdent(t *testing.T) {
+	src := `for x := range in {
+	out <- x.in + T{in: 1}.in
+}
+{ in := 3; _ = in }
+close(out)`
+	want := `for x := range input {
+	out <- x.in + T{in: 1}.in
+}
+{ in := 3; _ = in }
+close(out)`
+	got, err := RenameIdent(src, "in", "input")
+	if err != nil {
+		t.Fatalf("RenameIdent err = %v", err)
+	}
+	if got != want {
+		t.Errorf("RenameIdent = %q, want %q", got, want)
+	}
+	if _, err := RenameIdent(src, "out", "x"); err == nil {
+		t.Errorf("RenameIdent(out -> x) err = nil, want conflict")
+	}
+}
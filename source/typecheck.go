@@ -0,0 +1,360 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"sync"
+)
+
+// Var is a declaration, used to describe the context of a snippet. Usually
+// it declares a variable, but Decl can make it a type alias or a constant,
+// or (with Decl "source") arbitrary declarations written as Go source.
+type Var struct {
+	Name, Type string
+	Decl       string // "var" (if empty), "type", "const", or "source".
+	Value      string // The value of a constant, or the source.
+}
+
+// String returns v as a Go declaration.
+func (v Var) String() string {
+	switch v.Decl {
+	case "source":
+		return v.Value
+	case "type":
+		return fmt.Sprintf("type %s = %s", v.Name, v.Type)
+	case "const":
+		if v.Type == "" {
+			return fmt.Sprintf("const %s = %s", v.Name, v.Value)
+		}
+		return fmt.Sprintf("const %s %s = %s", v.Name, v.Type, v.Value)
+	}
+	return fmt.Sprintf("var %s %s", v.Name, v.Type)
+}
+
+// Error is a problem found in a snippet. Line and Column are relative to the
+// snippet; a zero Line means the problem is in the surrounding context (such
+// as an invalid channel type).
+type Error struct {
+	Line, Column int
+	Msg          string
+}
+
+func (e Error) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// The source importer is slow to start, but caches packages, so share one.
+// It isn't safe for concurrent use, hence the mutex.
+var (
+	checkMu   sync.Mutex
+	checkFset = token.NewFileSet()
+	checkImp  = importer.ForCompiler(checkFset, "source", nil)
+)
+
+// snippet is a complete Go file wrapping some code, along with enough
+// information to map positions back to the code.
+type snippet struct {
+	src      []byte
+	offset   int // where the code begins
+	end      int // where the code ends, and any source declarations begin
+	declLine int // the line source declarations begin on
+}
+
+// wrapFuncBody places a snippet as a function body in a file, after the given
+// imports and package-level vars. As with ExtractChannelIdents, everything
+// before the snippet is written on the first line to preserve line numbers.
+// Source declarations can span lines, so they are written after the snippet.
+func wrapFuncBody(body string, imports []string, vars, params []Var) *snippet {
+	b := new(bytes.Buffer)
+	b.WriteString("package snippet; ")
+	for _, i := range imports {
+		fmt.Fprintf(b, "import %q; ", i)
+	}
+	var decls []string
+	for _, v := range vars {
+		if v.Decl == "source" {
+			decls = append(decls, v.Value)
+			continue
+		}
+		fmt.Fprintf(b, "%v; ", v)
+	}
+	b.WriteString("func snippet(")
+	for i, p := range params {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(b, "%s %s", p.Name, p.Type)
+	}
+	b.WriteString(") { ")
+	off := b.Len()
+	b.WriteString(body)
+	b.WriteString("\n}\n")
+	end := b.Len()
+	declLine := bytes.Count(b.Bytes(), []byte("\n")) + 1
+	for _, d := range decls {
+		b.WriteString(d)
+		b.WriteString("\n")
+	}
+	return &snippet{src: b.Bytes(), offset: off, end: end, declLine: declLine}
+}
+
+// toError converts a position in the wrapped file to a position in the snippet.
+func (s *snippet) toError(p token.Position, msg string) Error {
+	if p.Offset < s.offset {
+		return Error{Msg: msg}
+	}
+	if p.Offset >= s.end {
+		return Error{Msg: fmt.Sprintf("declarations:%d:%d: %s", p.Line-s.declLine+1, p.Column, msg)}
+	}
+	col := p.Column
+	if p.Line == 1 {
+		col -= s.offset
+	}
+	return Error{Line: p.Line, Column: col, Msg: msg}
+}
+
+// toErrorAt is like toError, for when only the line and column are known.
+// A zero column means the column is unknown.
+func (s *snippet) toErrorAt(line, col int, msg string) Error {
+	if line >= s.declLine {
+		return Error{Msg: fmt.Sprintf("declarations:%d:%d: %s", line-s.declLine+1, col, msg)}
+	}
+	if line != 1 || col == 0 {
+		return Error{Line: line, Column: col, Msg: msg}
+	}
+	return s.toError(token.Position{Line: line, Column: col, Offset: col - 1}, msg)
+}
+
+// parse parses a wrapped snippet. Syntax errors are returned as Errors; the
+// error result is only for other failures.
+func (s *snippet) parse(fset *token.FileSet) (*ast.File, []Error, error) {
+	f, err := parser.ParseFile(fset, "snippet.go", s.src, 0)
+	if err != nil {
+		el, ok := err.(scanner.ErrorList)
+		if !ok {
+			return nil, nil, err
+		}
+		// The parser doesn't always recover from a broken snippet before the
+		// declarations, so only blame the declarations if nothing else.
+		inBody := el.Len() > 0 && el[0].Pos.Offset < s.end
+		errs := make([]Error, 0, len(el))
+		for _, e := range el {
+			if inBody && e.Pos.Offset >= s.end {
+				continue
+			}
+			errs = append(errs, s.toError(e.Pos, e.Msg))
+		}
+		return nil, errs, nil
+	}
+	return f, nil, nil
+}
+
+// check parses and type-checks a wrapped snippet, filling in info if it is
+// not nil. Parse errors prevent type-checking. The lock must be held.
+func (s *snippet) check(info *types.Info) (*ast.File, []Error, error) {
+	f, errs, err := s.parse(checkFset)
+	if f == nil {
+		return nil, errs, err
+	}
+
+	conf := &types.Config{
+		Importer: checkImp,
+		Error: func(err error) {
+			te, ok := err.(types.Error)
+			if !ok {
+				errs = append(errs, Error{Msg: err.Error()})
+				return
+			}
+			p := te.Fset.Position(te.Pos)
+			if te.Soft && p.Offset < s.offset {
+				// Probably an unused import; the generated code has lots of
+				// imports that might not be used by every snippet.
+				return
+			}
+			errs = append(errs, s.toError(p, te.Msg))
+		},
+	}
+	// The returned error is the first error, which is also passed to conf.Error.
+	conf.Check("snippet", checkFset, []*ast.File{f}, info)
+	return f, errs, nil
+}
+
+// TypeCheck parses and type-checks body as the body of a function taking the
+// given parameters, in a package with the given imports and package-level
+// variables. All problems found are returned. The error result is only
+// non-nil if checking could not be attempted.
+func TypeCheck(body string, imports []string, vars, params []Var) ([]Error, error) {
+	s := wrapFuncBody(body, imports, vars, params)
+
+	checkMu.Lock()
+	defer checkMu.Unlock()
+
+	_, errs, err := s.check(nil)
+	return errs, err
+}
+
+// SyntaxCheck parses body as TypeCheck would, but only reports syntax errors.
+// It is much quicker than TypeCheck, so suits checking code as it is typed.
+func SyntaxCheck(body string, imports []string, vars, params []Var) ([]Error, error) {
+	_, errs, err := wrapFuncBody(body, imports, vars, params).parse(token.NewFileSet())
+	return errs, err
+}
+
+// SendTypes type-checks body like TypeCheck, with an extra variable ch of type
+// chan interface{}, and returns the types of the values sent to ch, in the
+// order they appear. Types are written as they would be in the generated
+// package (e.g. "time.Time"). Type errors are ignored where possible.
+func SendTypes(body string, imports []string, vars, params []Var, ch string) ([]string, error) {
+	vars = append(vars[:len(vars):len(vars)], Var{Name: ch, Type: "chan interface{}"})
+	s := wrapFuncBody(body, imports, vars, params)
+
+	checkMu.Lock()
+	defer checkMu.Unlock()
+
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	f, _, err := s.check(info)
+	if err != nil || f == nil {
+		return nil, err
+	}
+	qual := func(p *types.Package) string {
+		if p.Path() == "snippet" {
+			return ""
+		}
+		return p.Name()
+	}
+	var ts []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		ss, ok := n.(*ast.SendStmt)
+		if !ok {
+			return true
+		}
+		id, ok := ss.Chan.(*ast.Ident)
+		if !ok || id.Name != ch {
+			return true
+		}
+		// Must refer to the package-level variable, not something local.
+		if obj := info.Uses[id]; obj == nil || obj.Parent() != obj.Pkg().Scope() {
+			return true
+		}
+		tv, ok := info.Types[ss.Value]
+		if !ok || tv.Type == nil {
+			return true
+		}
+		t := types.Default(tv.Type)
+		if b, ok := t.(*types.Basic); ok && (b.Kind() == types.Invalid || b.Kind() == types.UntypedNil) {
+			// Nil could be any of several types, so says nothing.
+			return true
+		}
+		ts = append(ts, types.TypeString(t, qual))
+		return true
+	})
+	return ts, nil
+}
+
+// ConstInt evaluates expr as a constant expression in a package with the
+// given imports and package-level vars, and returns its value, which must be
+// a non-negative integer that fits in an int (such as a channel capacity).
+func ConstInt(expr string, imports []string, vars []Var) (int, error) {
+	const name = "shenzhenConst"
+	s := wrapFuncBody(fmt.Sprintf("const %s = %s", name, expr), imports, vars, nil)
+
+	checkMu.Lock()
+	defer checkMu.Unlock()
+
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	f, errs, err := s.check(info)
+	if err != nil {
+		return 0, err
+	}
+	if len(errs) > 0 {
+		// Positions within the wrapped expression aren't much use.
+		return 0, fmt.Errorf("%s", errs[0].Msg)
+	}
+	if f == nil {
+		return 0, fmt.Errorf("could not parse %q", expr)
+	}
+	for id, obj := range info.Defs {
+		c, ok := obj.(*types.Const)
+		if !ok || id.Name != name {
+			continue
+		}
+		v := constant.ToInt(c.Val())
+		if v.Kind() != constant.Int {
+			return 0, fmt.Errorf("%s is not a whole number", expr)
+		}
+		i, exact := constant.Int64Val(v)
+		if !exact || i < 0 || int64(int(i)) != i {
+			return 0, fmt.Errorf("%s = %s is out of range", expr, v)
+		}
+		return int(i), nil
+	}
+	return 0, fmt.Errorf("%s is not constant", expr)
+}
+
+// OrderedType type-checks expr as an expression in a function taking the
+// given parameters, and returns its type, which must be ordered so values can
+// be compared with < (such as a priority key). The type is written as it
+// would be in the generated package, as with SendTypes.
+func OrderedType(expr string, imports []string, vars, params []Var) (string, error) {
+	const name = "shenzhenKey"
+	s := wrapFuncBody(fmt.Sprintf("%s := %s; _ = %s", name, expr, name), imports, vars, params)
+
+	checkMu.Lock()
+	defer checkMu.Unlock()
+
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	f, errs, err := s.check(info)
+	if err != nil {
+		return "", err
+	}
+	if len(errs) > 0 {
+		return "", fmt.Errorf("%s", errs[0].Msg)
+	}
+	if f == nil {
+		return "", fmt.Errorf("could not parse %q", expr)
+	}
+	for id, obj := range info.Defs {
+		v, ok := obj.(*types.Var)
+		if !ok || id.Name != name {
+			continue
+		}
+		t := v.Type()
+		if b, ok := t.Underlying().(*types.Basic); !ok || b.Info()&types.IsOrdered == 0 {
+			return "", fmt.Errorf("%s has type %v, which can't be compared with <", expr, t)
+		}
+		return types.TypeString(t, func(p *types.Package) string {
+			if p.Path() == "snippet" {
+				return ""
+			}
+			return p.Name()
+		}), nil
+	}
+	return "", fmt.Errorf("%s has no value", expr)
+}
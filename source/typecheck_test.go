@@ -0,0 +1,201 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTypeCheck(t *testing.T) {
+	imps := []string{"fmt", "sync"}
+	vars := []Var{
+		{Name: "in", Type: "chan int"},
+		{Name: "out", Type: "chan string"},
+		{Name: "T", Type: "float64", Decl: "type"},
+		{Name: "N", Value: "3", Decl: "const"},
+		{Decl: "source", Value: "type point struct {\n\tx, y int\n}\n\nfunc origin() point { return point{} }"},
+	}
+	tests := []struct {
+		src  string
+		want []Error
+	}{
+		{
+			src: `for x := range in {
+	out <- fmt.Sprint(x)
+}
+close(out)`,
+		},
+		{
+			src: `for x := range in {
+	out <- x
+}`,
+			want: []Error{{Line: 2, Column: 9, Msg: "cannot use x (variable of type int) as string value in send"}},
+		},
+		{
+			src:  `out <- "a" +`,
+			want: []Error{{Line: 2, Column: 1, Msg: "expected operand, found '}'"}},
+		},
+		{
+			src: `var a [N]T
+out <- fmt.Sprint(a)`,
+		},
+		{
+			src: `p := origin()
+out <- p.z`,
+			want: []Error{{Line: 2, Column: 10, Msg: "p.z undefined (type point has no field or method z)"}},
+		},
+	}
+	for _, test := range tests {
+		got, err := TypeCheck(test.src, imps, vars, nil)
+		if err != nil {
+			t.Fatalf("TypeCheck(%q) err = %v", test.src, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("TypeCheck(%q) = %v, want %v", test.src, got, test.want)
+		}
+	}
+}
+
+func TestSyntaxCheck(t *testing.T) {
+	vars := []Var{{Name: "out", Type: "chan string"}}
+	tests := []struct {
+		src  string
+		want []Error
+	}{
+		// Type errors aren't syntax errors.
+		{src: `out <- 1`},
+		{
+			src:  `out <- "a" +`,
+			want: []Error{{Line: 2, Column: 1, Msg: "expected operand, found '}'"}},
+		},
+		{
+			src: `for {
+	out <- "a" "b"
+}`,
+			want: []Error{{Line: 2, Column: 13, Msg: "expected ';', found \"b\""}},
+		},
+	}
+	for _, test := range tests {
+		got, err := SyntaxCheck(test.src, nil, vars, nil)
+		if err != nil {
+			t.Fatalf("SyntaxCheck(%q) err = %v", test.src, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SyntaxCheck(%q) = %v, want %v", test.src, got, test.want)
+		}
+	}
+}
+
+func TestConstInt(t *testing.T) {
+	vars := []Var{
+		{Name: "bufSize", Type: "int", Value: "16", Decl: "const"},
+		{Name: "x", Type: "int"},
+		{Decl: "source", Value: "const workers = 4"},
+	}
+	tests := []struct {
+		expr    string
+		want    int
+		wantErr bool
+	}{
+		{expr: "8", want: 8},
+		{expr: "bufSize", want: 16},
+		{expr: "bufSize * workers", want: 64},
+		{expr: "time.Second / time.Millisecond", want: 1000},
+		{expr: "x", wantErr: true},
+		{expr: "nope", wantErr: true},
+		{expr: "2.5", wantErr: true},
+		{expr: "-1", wantErr: true},
+		{expr: "bufSize +", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ConstInt(test.expr, []string{"time"}, vars)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ConstInt(%q) = %d, want error", test.expr, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ConstInt(%q) = %d, %v, want %d", test.expr, got, err, test.want)
+		}
+	}
+}
+
+func TestOrderedType(t *testing.T) {
+	vars := []Var{
+		{Name: "Job", Type: "struct{ Urgency int; Name string; Due time.Time }", Decl: "type"},
+		{Decl: "source", Value: "type Level int"},
+	}
+	params := []Var{{Name: "x", Type: "Job"}}
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "x.Urgency", want: "int"},
+		{expr: "-x.Urgency", want: "int"},
+		{expr: "x.Name", want: "string"},
+		{expr: "x.Due.Unix()", want: "int64"},
+		{expr: "Level(x.Urgency)", want: "Level"},
+		{expr: "x.Due.Sub(time.Time{})", want: "time.Duration"},
+		{expr: "x.Due", wantErr: true},
+		{expr: "x.Nope", wantErr: true},
+		{expr: "x.Urgency >", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := OrderedType(test.expr, []string{"time"}, vars, params)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("OrderedType(%q) = %q, want error", test.expr, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("OrderedType(%q) = %q, %v, want %q", test.expr, got, err, test.want)
+		}
+	}
+}
+
+func TestSendTypes(t *testing.T) {
+	imps := []string{"fmt", "time"}
+	vars := []Var{
+		{Name: "in", Type: "chan int"},
+		{Decl: "source", Value: "type point struct {\n\tx, y int\n}"},
+	}
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{src: `for x := range in {
+	ch <- x
+}`, want: []string{"int"}},
+		{src: `ch <- "a"; ch <- 1.5; ch <- 'r'`, want: []string{"string", "float64", "rune"}},
+		{src: `ch <- []string{"a"}; ch <- map[string]*point{}; ch <- struct{ n int }{1}`, want: []string{"[]string", "map[string]*point", "struct{n int}"}},
+		{src: `ch <- time.Now(); ch <- fmt.Errorf("oops")`, want: []string{"time.Time", "error"}},
+		{src: `ch <- nil; ch <- undefined`},
+		{src: `ch := make(chan int); ch <- 1`},
+		{src: `fmt.Println(<-in)`},
+	}
+	for _, test := range tests {
+		got, err := SendTypes(test.src, imps, vars, nil, "ch")
+		if err != nil {
+			t.Fatalf("SendTypes(%q) err = %v", test.src, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SendTypes(%q) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+)
+
+// ParseType checks that t is syntactically a Go type, such as "int",
+// "map[string][]time.Time", "chan chan error", or "struct{ x, y int }".
+func ParseType(t string) error {
+	e, err := parser.ParseExpr(t)
+	if err != nil {
+		return fmt.Errorf("%q is not a type: %v", t, err)
+	}
+	if !isType(e) {
+		return fmt.Errorf("%q is an expression, not a type", t)
+	}
+	return nil
+}
+
+// isType reports whether e could be a type. Identifiers (and selectors, such
+// as time.Duration) might not be, but that needs type-checking to find out.
+func isType(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.Ident, *ast.ArrayType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType, *ast.MapType, *ast.StructType:
+		return true
+	case *ast.SelectorExpr:
+		_, ok := e.X.(*ast.Ident)
+		return ok
+	case *ast.ParenExpr:
+		return isType(e.X)
+	case *ast.StarExpr:
+		return isType(e.X)
+	case *ast.IndexExpr:
+		// A generic type instantiated with one type argument.
+		return isType(e.X) && isType(e.Index)
+	case *ast.IndexListExpr:
+		if !isType(e.X) {
+			return false
+		}
+		for _, i := range e.Indices {
+			if !isType(i) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
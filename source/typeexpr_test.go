@@ -0,0 +1,42 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import "testing"
+
+func TestParseType(t *testing.T) {
+	tests := []struct {
+		t    string
+		want bool
+	}{
+		{"int", true},
+		{"map[string][]time.Time", true},
+		{"chan chan<- error", true},
+		{"struct{ x, y int }", true},
+		{"func(int) (string, error)", true},
+		{"*[4]interface{ String() string }", true},
+		{"atomic.Pointer[string]", true},
+		{"", false},
+		{"map[string]", false},
+		{"1 + 2", false},
+		{"f()", false},
+		{"a.b.c", false},
+	}
+	for _, test := range tests {
+		if err := ParseType(test.t); (err == nil) != test.want {
+			t.Errorf("ParseType(%q) = %v, want valid = %t", test.t, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// AdminPath is where the admin service (see admin.proto) is served, over
+// gRPC, for tools such as IDE plugins and CI systems. gRPC clients can't add
+// a base path, so it is always at the root.
+const AdminPath = "/shenzhen.admin.v1.Admin/"
+
+// adminMaxMessage is the largest request accepted, as with gRPC's default.
+const adminMaxMessage = 4 << 20
+
+// gRPC status codes used by the admin service.
+const (
+	grpcOK                = 0
+	grpcUnknown           = 2
+	grpcInvalidArgument   = 3
+	grpcNotFound          = 5
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+)
+
+// grpcError is an error with a gRPC status code.
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+func grpcErrorf(code int, format string, args ...interface{}) error {
+	return &grpcError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// serveAdmin handles a call to the admin service. Messages are sent as they
+// are made, and the status follows in the trailers.
+func (b *dirBrowser) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); r.Method != "POST" || ct != "application/grpc" && ct != "application/grpc+proto" {
+		http.Error(w, "Expected a gRPC call", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+
+	err := b.adminCall(w, r)
+	code, msg := grpcOK, ""
+	if err != nil {
+		code, msg = grpcUnknown, err.Error()
+		if e, ok := err.(*grpcError); ok {
+			code = e.code
+		}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", url.PathEscape(msg))
+	}
+}
+
+func (b *dirBrowser) adminCall(w http.ResponseWriter, r *http.Request) error {
+	req, err := readGRPCMessage(r.Body)
+	if err != nil {
+		return err
+	}
+	fs, err := protoStrings(req)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	if fs[1] == "" {
+		return grpcErrorf(grpcInvalidArgument, "no graph path")
+	}
+	// Paths are as in URLs, without any BasePath.
+	gp := path.Clean("/" + fs[1])
+
+	method := r.URL.Path[len(AdminPath):]
+	switch method {
+	case "GetGraph", "Check":
+		l := graphLock(gp)
+		l.Lock()
+		defer l.Unlock()
+		g, err := b.adminLoad(gp)
+		if err != nil {
+			return err
+		}
+		noteGraph(w, g)
+		var m protoMessage
+		if method == "GetGraph" {
+			m, err = graphProto(g)
+		} else {
+			m = checkProto(g.Check())
+		}
+		if err != nil {
+			return grpcErrorf(grpcInternal, "%v", err)
+		}
+		return writeGRPCMessage(w, m)
+
+	case "Build", "Run":
+		if !AllowBuild {
+			return grpcErrorf(grpcPermissionDenied, "building and running are disabled on this server")
+		}
+		// Builds and runs go on for a while, so rather than hold the
+		// graph's lock (see graphLock), they use a copy.
+		l := graphLock(gp)
+		l.Lock()
+		g, err := b.adminLoad(gp)
+		if err == nil {
+			noteGraph(w, g)
+			g, err = g.Clone()
+		}
+		l.Unlock()
+		if err != nil {
+			return err
+		}
+		g.LoadSubgraphs()
+
+		ctx, cancel := context.WithCancel(runCtx)
+		defer cancel()
+		go func() {
+			select {
+			case <-r.Context().Done():
+			case <-ctx.Done():
+			}
+			cancel()
+		}()
+		out := &logStream{w: w}
+		stdout, stderr := out.writer(0), out.writer(1)
+		user := userOf(r)
+		if method == "Build" {
+			Publish(Event{Type: BuildStarted, Graph: gp, User: user})
+			start := time.Now()
+			err = g.BuildContext(ctx, stderr) // go build only prints errors.
+			stats.built(err, time.Since(start))
+			Publish(Event{Type: BuildFinished, Graph: gp, User: user, Error: errString(err)})
+		} else {
+			Publish(Event{Type: RunStarted, Graph: gp, User: user})
+			done := stats.startRun()
+			err = g.RunContext(ctx, stdout, stderr)
+			done(err)
+			Publish(Event{Type: RunFinished, Graph: gp, User: user, Error: errString(err)})
+		}
+		stdout.flush()
+		stderr.flush()
+		if out.err != nil {
+			return out.err
+		}
+		return err
+	}
+	return grpcErrorf(grpcUnimplemented, "unknown method %q", method)
+}
+
+// adminLoad is load, with errors as gRPC statuses.
+func (b *dirBrowser) adminLoad(gp string) (*graph.Graph, error) {
+	g, err := b.load(gp)
+	if os.IsNotExist(err) {
+		return nil, grpcErrorf(grpcNotFound, "no graph %s", gp)
+	}
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "could not load graph %s: %v", gp, err)
+	}
+	g.LoadSubgraphs()
+	return g, nil
+}
+
+// readGRPCMessage reads a whole, uncompressed, gRPC message.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var h [5]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "could not read request: %v", err)
+	}
+	if h[0] != 0 {
+		return nil, grpcErrorf(grpcUnimplemented, "compressed requests aren't supported")
+	}
+	n := binary.BigEndian.Uint32(h[1:])
+	if n > adminMaxMessage {
+		return nil, grpcErrorf(grpcResourceExhausted, "request of %d bytes is too big", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "could not read request: %v", err)
+	}
+	return b, nil
+}
+
+// writeGRPCMessage sends one message, straight away.
+func writeGRPCMessage(w http.ResponseWriter, m protoMessage) error {
+	var h [5]byte
+	binary.BigEndian.PutUint32(h[1:], uint32(len(m)))
+	if _, err := w.Write(append(h[:], m...)); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Edge directions, as in admin.proto.
+const (
+	edgeRead  = 1
+	edgeWrite = 2
+)
+
+// graphProto encodes a Graph message.
+func graphProto(g *graph.Graph) (protoMessage, error) {
+	var m protoMessage
+	m.String(1, g.Name)
+	m.String(2, g.PackagePath)
+	for _, i := range g.Imports {
+		m.Bytes(3, []byte(i))
+	}
+	nns := make([]string, 0, len(g.Nodes))
+	for nn := range g.Nodes {
+		nns = append(nns, nn)
+	}
+	sort.Strings(nns)
+	for _, nn := range nns {
+		n := g.Nodes[nn]
+		var nm protoMessage
+		nm.String(1, n.Name)
+		nm.String(2, n.TypeKey())
+		nm.Uint(3, uint64(n.Multiplicity))
+		nm.Bool(4, n.Wait)
+		nm.String(5, n.Group)
+		nm.Bool(6, n.Disabled)
+		nm.String(7, n.Doc)
+		nm.String(8, n.Impl())
+		m.Bytes(4, nm)
+	}
+	cns := make([]string, 0, len(g.Channels))
+	for cn := range g.Channels {
+		cns = append(cns, cn)
+	}
+	sort.Strings(cns)
+	for _, cn := range cns {
+		c := g.Channels[cn]
+		var cm protoMessage
+		cm.String(1, c.Name)
+		cm.String(2, c.Type)
+		cm.Uint(3, uint64(c.Cap))
+		cm.String(4, c.Boundary)
+		m.Bytes(5, cm)
+	}
+	for _, nn := range nns {
+		n := g.Nodes[nn]
+		for _, e := range []struct {
+			chans []string
+			dir   uint64
+		}{{n.ChannelsRead(), edgeRead}, {n.ChannelsWritten(), edgeWrite}} {
+			for _, c := range e.chans {
+				var em protoMessage
+				em.String(1, nn)
+				em.String(2, c)
+				em.Uint(3, e.dir)
+				m.Bytes(6, em)
+			}
+		}
+	}
+	var j bytes.Buffer
+	if err := g.WriteJSONTo(&j); err != nil {
+		return nil, err
+	}
+	m.String(7, j.String())
+	return m, nil
+}
+
+// checkProto encodes a CheckResponse message.
+func checkProto(ds []graph.Diagnostic) protoMessage {
+	var m protoMessage
+	for _, d := range ds {
+		var dm protoMessage
+		dm.Uint(1, uint64(d.Severity)) // The same values.
+		dm.String(2, d.Node)
+		dm.String(3, d.Channel)
+		dm.String(4, d.Msg)
+		m.Bytes(1, dm)
+	}
+	return m
+}
+
+// logStream sends what is written to its writers as LogLine messages.
+type logStream struct {
+	mu  sync.Mutex // Output and errors are written at once.
+	w   http.ResponseWriter
+	err error // The first error sending.
+}
+
+// writer returns a writer for one of the streams (0 for output, 1 for
+// errors).
+func (s *logStream) writer(stream uint64) *logWriter {
+	return &logWriter{s: s, stream: stream}
+}
+
+// logWriter sends a LogLine for each line written to it.
+type logWriter struct {
+	s      *logStream
+	stream uint64
+	buf    []byte // The start of a line.
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.send(l.buf[:i])
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), l.s.err
+}
+
+// flush sends anything left over that didn't end with a newline.
+func (l *logWriter) flush() {
+	if len(l.buf) > 0 {
+		l.send(l.buf)
+		l.buf = nil
+	}
+}
+
+func (l *logWriter) send(line []byte) {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+	if l.s.err != nil {
+		return
+	}
+	var m protoMessage
+	m.Uint(1, l.stream)
+	m.String(2, string(line))
+	l.s.err = writeGRPCMessage(l.s.w, m)
+}
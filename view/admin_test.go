@@ -0,0 +1,182 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveGraphs serves a browser (see NewBrowser) of a new directory holding
+// the given graph files, until the test ends.
+func serveGraphs(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatalf("WriteFile(%s) = %v", name, err)
+		}
+	}
+	// Graphs are found relative to the working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd() = %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir(%s) = %v", dir, err)
+	}
+	ts := httptest.NewUnstartedServer(NewBrowser())
+	ts.EnableHTTP2 = true // For gRPC.
+	ts.StartTLS()
+	t.Cleanup(func() {
+		ts.Close()
+		os.Chdir(wd)
+	})
+	return ts
+}
+
+const testGraphJSON = `{
+	"name": "test",
+	"package_path": "example.com/test",
+	"imports": ["fmt"],
+	"nodes": {
+		"gen": {"name": "gen", "multiplicity": 1, "part": {"code": "a <- 1; close(a)"}, "part_type": "Code"},
+		"sink": {"name": "sink", "multiplicity": 1, "part": {"code": "for x := range a { fmt.Println(x) }"}, "part_type": "Code"}
+	},
+	"channels": {
+		"a": {"name": "a", "type": "int", "cap": 0},
+		"spare": {"name": "spare", "type": "int", "cap": 0}
+	}
+}`
+
+// callAdmin calls a method of the admin service with a GraphRequest, and
+// returns the messages sent back and the status.
+func callAdmin(t *testing.T, ts *httptest.Server, method, path string) (msgs [][]byte, status, msg string) {
+	t.Helper()
+	var req protoMessage
+	req.String(1, path)
+	body := append([]byte{0, 0, 0, 0, byte(len(req))}, req...)
+	hr, err := http.NewRequest("POST", ts.URL+AdminPath+method, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest = %v", err)
+	}
+	hr.Header.Set("Content-Type", "application/grpc")
+	resp, err := ts.Client().Do(hr)
+	if err != nil {
+		t.Fatalf("%s(%s) = %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s(%s) = %v", method, path, err)
+	}
+	for len(b) >= 5 {
+		n := int(binary.BigEndian.Uint32(b[1:5]))
+		msgs = append(msgs, b[5:5+n])
+		b = b[5+n:]
+	}
+	msg, err = url.PathUnescape(resp.Trailer.Get("Grpc-Message"))
+	if err != nil {
+		t.Errorf("%s(%s) sent an invalid grpc-message: %v", method, path, err)
+	}
+	return msgs, resp.Trailer.Get("Grpc-Status"), msg
+}
+
+func TestAdmin(t *testing.T) {
+	ts := serveGraphs(t, map[string]string{"test.szgo": testGraphJSON})
+
+	msgs, status, _ := callAdmin(t, ts, "GetGraph", "test.szgo")
+	if status != "0" || len(msgs) != 1 {
+		t.Fatalf("GetGraph(test.szgo) sent %d messages, status %s; want 1, 0", len(msgs), status)
+	}
+	fs, err := protoStrings(msgs[0])
+	if err != nil {
+		t.Fatalf("protoStrings(Graph) = %v", err)
+	}
+	if fs[1] != "test" || fs[2] != "example.com/test" {
+		t.Errorf("Graph name, package path = %q, %q; want test, example.com/test", fs[1], fs[2])
+	}
+	// Fields 4, 5, and 6 are repeated, so fs has the last of each.
+	if n, _ := protoStrings([]byte(fs[4])); n[1] != "sink" || n[2] != "Code" {
+		t.Errorf("last Node = %q, a %q; want sink, a Code", n[1], n[2])
+	}
+	if e, _ := protoStrings([]byte(fs[6])); e[1] != "sink" || e[2] != "a" {
+		t.Errorf("last Edge = %q reading %q; want sink reading a", e[1], e[2])
+	}
+	if !strings.Contains(fs[7], `"package_path": "example.com/test"`) {
+		t.Errorf("Graph json = %s, want the graph file", fs[7])
+	}
+
+	msgs, status, _ = callAdmin(t, ts, "Check", "test.szgo")
+	if status != "0" || len(msgs) != 1 {
+		t.Fatalf("Check(test.szgo) sent %d messages, status %s; want 1, 0", len(msgs), status)
+	}
+	if fs, _ := protoStrings(msgs[0]); !strings.Contains(fs[1], "spare") {
+		t.Errorf("Check(test.szgo) = %q, want a diagnostic about spare", fs[1])
+	}
+
+	for _, test := range []struct {
+		method, path, status, msg string
+	}{
+		{"GetGraph", "missing.szgo", "5", "no graph /missing.szgo"},
+		{"GetGraph", "", "3", "no graph path"},
+		{"Frob", "test.szgo", "12", `unknown method "Frob"`},
+	} {
+		if _, status, msg := callAdmin(t, ts, test.method, test.path); status != test.status || msg != test.msg {
+			t.Errorf("%s(%q) status = %s %q, want %s %q", test.method, test.path, status, msg, test.status, test.msg)
+		}
+	}
+
+	defer func(a bool) { AllowBuild = a }(AllowBuild)
+	AllowBuild = false
+	if _, status, _ := callAdmin(t, ts, "Build", "test.szgo"); status != "7" {
+		t.Errorf("Build(test.szgo) with building disabled: status = %s, want 7", status)
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	s := &logStream{w: rec}
+	w := s.writer(1)
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\nthree"))
+	w.flush()
+
+	var got []string
+	b := rec.Body.Bytes()
+	for len(b) >= 5 {
+		n := int(binary.BigEndian.Uint32(b[1:5]))
+		fs, err := protoStrings(b[5 : 5+n])
+		if err != nil {
+			t.Fatalf("protoStrings(LogLine) = %v", err)
+		}
+		got = append(got, fs[2])
+		if b[6] != 1 {
+			t.Errorf("LogLine %q stream = %d, want 1 (stderr)", fs[2], b[6])
+		}
+		b = b[5+n:]
+	}
+	if want := []string{"one", "two", "three"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("LogLines = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/shenzhen-go/graph"
+	"github.com/google/shenzhen-go/parts"
+)
+
+// APIPrefix is the path under which the JSON API is served. A graph at
+// /path/to/graph.szgo is available at /api/v1/path/to/graph.szgo.
+//
+// The API mirrors the pages, with query parameters picking out parts of the
+// graph:
+//
+//	GET, PUT, DELETE         (the graph itself; DELETE only unloads it)
+//	POST ?save               (save the graph to its file)
+//	GET, POST ?nodes         (list or create goroutines)
+//	POST ?nodes&from=name    (create a goroutine connected from another)
+//	GET, PUT, DELETE ?node=name
+//	GET, PUT ?node=name&settings (the goroutine's part, as fields, if it has a schema)
+//	GET, POST ?channels      (list or create channels)
+//	GET, PUT, DELETE ?channel=name
+//
+// Request and response bodies are JSON, in the same form as the graph file.
+// Errors are reported as {"error": {"code": 404, "message": "..."}}.
+const APIPrefix = "/api/v1/"
+
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func apiRespond(w http.ResponseWriter, code int, v interface{}) {
+	if v == nil {
+		w.WriteHeader(code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("Could not encode JSON: %v", err)
+	}
+}
+
+func apiFail(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	var e apiError
+	e.Error.Code = code
+	e.Error.Message = fmt.Sprintf(format, args...)
+	apiRespond(w, code, &e)
+}
+
+// load returns the graph at path, loading it if need be.
+func (b *dirBrowser) load(path string) (*graph.Graph, error) {
+	if g, ok := b.loaded(path); ok && g != nil {
+		return g, nil
+	}
+	g, err := graph.LoadJSONFile(filepath.Join(".", path))
+	if err != nil {
+		return nil, err
+	}
+	b.setLoaded(path, g)
+	return g, nil
+}
+
+func (b *dirBrowser) serveAPI(w http.ResponseWriter, r *http.Request) {
+	path := graphPath(r)
+	q := r.URL.Query()
+	_, nodes := q["nodes"]
+	_, chans := q["channels"]
+	_, node := q["node"]
+	_, channel := q["channel"]
+	whole := !(nodes || chans || node || channel)
+
+	g, err := b.load(path)
+	if err != nil {
+		if whole && r.Method == "PUT" && os.IsNotExist(err) {
+			b.apiPutGraph(w, r, path, http.StatusCreated)
+			return
+		}
+		code := http.StatusBadRequest
+		if os.IsNotExist(err) {
+			code = http.StatusNotFound
+		}
+		apiFail(w, code, "could not load graph %s: %v", path, err)
+		return
+	}
+
+	noteGraph(w, g)
+	switch {
+	case nodes:
+		apiNodes(g, w, r)
+	case node:
+		if _, t := q["settings"]; t {
+			apiSettings(g, q.Get("node"), w, r)
+			return
+		}
+		apiNode(g, q.Get("node"), w, r)
+	case chans:
+		apiChannels(g, w, r)
+	case channel:
+		apiChannel(g, q.Get("channel"), w, r)
+	default:
+		switch r.Method {
+		case "GET":
+			apiRespond(w, http.StatusOK, g)
+		case "PUT":
+			b.apiPutGraph(w, r, path, http.StatusOK)
+		case "DELETE":
+			b.unload(path)
+			apiRespond(w, http.StatusNoContent, nil)
+		case "POST":
+			if _, save := q["save"]; !save {
+				apiFail(w, http.StatusBadRequest, "POST to a graph needs ?save")
+				return
+			}
+			if err := g.SaveJSONFile(); err != nil {
+				apiFail(w, http.StatusInternalServerError, "could not save graph: %v", err)
+				return
+			}
+			apiRespond(w, http.StatusNoContent, nil)
+		default:
+			apiFail(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+		}
+	}
+}
+
+// apiPutGraph replaces (or creates) the graph at path.
+func (b *dirBrowser) apiPutGraph(w http.ResponseWriter, r *http.Request, path string, code int) {
+	g, err := graph.LoadJSON(r.Body, filepath.Join(".", path))
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "invalid graph: %v", err)
+		return
+	}
+	if g.Nodes == nil {
+		g.Nodes = make(map[string]*graph.Node)
+	}
+	if g.Channels == nil {
+		g.Channels = make(map[string]*graph.Channel)
+	}
+	b.setLoaded(path, g)
+	apiRespond(w, code, g)
+}
+
+func apiNodes(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		ns := make([]*graph.Node, 0, len(g.Nodes))
+		for _, n := range g.Nodes {
+			ns = append(ns, n)
+		}
+		sort.Slice(ns, func(i, j int) bool { return ns[i].Name < ns[j].Name })
+		apiRespond(w, http.StatusOK, ns)
+	case "POST":
+		n := new(graph.Node)
+		if err := json.NewDecoder(r.Body).Decode(n); err != nil {
+			apiFail(w, http.StatusBadRequest, "invalid goroutine: %v", err)
+			return
+		}
+		if n.Name = strings.TrimSpace(n.Name); n.Name == "" {
+			apiFail(w, http.StatusBadRequest, "name is empty")
+			return
+		}
+		if _, found := g.Nodes[n.Name]; found {
+			apiFail(w, http.StatusConflict, "goroutine %q already exists", n.Name)
+			return
+		}
+		if from := r.URL.Query().Get("from"); from != "" {
+			m, _, err := g.AddAfter(n, from)
+			if err != nil {
+				apiFail(w, http.StatusBadRequest, "could not connect from %q: %v", from, err)
+				return
+			}
+			apiRespond(w, http.StatusCreated, m)
+			return
+		}
+		g.Nodes[n.Name] = n
+		apiRespond(w, http.StatusCreated, n)
+	default:
+		apiFail(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+	}
+}
+
+func apiNode(g *graph.Graph, name string, w http.ResponseWriter, r *http.Request) {
+	n, found := g.Nodes[name]
+	if !found {
+		apiFail(w, http.StatusNotFound, "goroutine %q not found", name)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		apiRespond(w, http.StatusOK, n)
+	case "PUT":
+		m := new(graph.Node)
+		if err := json.NewDecoder(r.Body).Decode(m); err != nil {
+			apiFail(w, http.StatusBadRequest, "invalid goroutine: %v", err)
+			return
+		}
+		if m.Name = strings.TrimSpace(m.Name); m.Name == "" {
+			m.Name = name
+		}
+		if m.Name != name {
+			if _, found := g.Nodes[m.Name]; found {
+				apiFail(w, http.StatusConflict, "goroutine %q already exists", m.Name)
+				return
+			}
+			delete(g.Nodes, name)
+			g.ReattachComments(name, m.Name)
+		}
+		g.Nodes[m.Name] = m
+		apiRespond(w, http.StatusOK, m)
+	case "DELETE":
+		delete(g.Nodes, name)
+		g.ReattachComments(name, "")
+		apiRespond(w, http.StatusNoContent, nil)
+	default:
+		apiFail(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+	}
+}
+
+// apiPartSettings describes a part by its schema, so clients can edit any
+// such part without knowing its type.
+type apiPartSettings struct {
+	Type     string       `json:"type"`
+	Schema   parts.Schema `json:"schema"`
+	Values   url.Values   `json:"values"`
+	Problems []string     `json:"problems,omitempty"`
+}
+
+func apiSettings(g *graph.Graph, name string, w http.ResponseWriter, r *http.Request) {
+	n, found := g.Nodes[name]
+	if !found {
+		apiFail(w, http.StatusNotFound, "goroutine %q not found", name)
+		return
+	}
+	sp, ok := n.Part.(parts.Schematic)
+	if !ok {
+		apiFail(w, http.StatusNotImplemented, "%s parts have no schema", n.TypeKey())
+		return
+	}
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var s apiPartSettings
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			apiFail(w, http.StatusBadRequest, "invalid settings: %v", err)
+			return
+		}
+		if err := sp.SetFieldValues(s.Values); err != nil {
+			apiFail(w, http.StatusBadRequest, "invalid settings: %v", err)
+			return
+		}
+	default:
+		apiFail(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+		return
+	}
+	apiRespond(w, http.StatusOK, &apiPartSettings{
+		Type:     n.TypeKey(),
+		Schema:   sp.Schema(),
+		Values:   sp.FieldValues(),
+		Problems: graph.ConfigProblems(n),
+	})
+}
+
+// validateChannel checks the fields of a channel, as in the channel editor.
+func validateChannel(g *graph.Graph, c *graph.Channel) error {
+	if !identifierRE.MatchString(c.Name) {
+		return fmt.Errorf("invalid name [%q !~ %q]", c.Name, identifierRE)
+	}
+	if c.CapExpr != "" {
+		v, err := g.CapValue(c.CapExpr)
+		if err != nil {
+			return fmt.Errorf("invalid capacity %q: %v", c.CapExpr, err)
+		}
+		c.Cap = v
+	}
+	if c.Cap < 0 {
+		return fmt.Errorf("invalid capacity [%d < 0]", c.Cap)
+	}
+	switch c.Boundary {
+	case "", graph.Input, graph.Output:
+	default:
+		return fmt.Errorf("invalid boundary %q", c.Boundary)
+	}
+	if err := validOverflow(c.Overflow, c.Boundary, c.Cap); err != nil {
+		return err
+	}
+	if err := g.CheckChannelType(c.Type); err != nil {
+		return err
+	}
+	if err := validPriority(g, c); err != nil {
+		return err
+	}
+	if err := validJournal(g, c); err != nil {
+		return err
+	}
+	if err := validRemote(c); err != nil {
+		return err
+	}
+	return g.CheckFixture(c)
+}
+
+func apiChannels(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		cs := make([]*graph.Channel, 0, len(g.Channels))
+		for _, c := range g.Channels {
+			cs = append(cs, c)
+		}
+		sort.Slice(cs, func(i, j int) bool { return cs[i].Name < cs[j].Name })
+		apiRespond(w, http.StatusOK, cs)
+	case "POST":
+		c := new(graph.Channel)
+		if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+			apiFail(w, http.StatusBadRequest, "invalid channel: %v", err)
+			return
+		}
+		if c.Name == "" {
+			c.Name = g.UniqueChannelName(c.Type)
+		}
+		if err := validateChannel(g, c); err != nil {
+			apiFail(w, http.StatusBadRequest, "invalid channel: %v", err)
+			return
+		}
+		if _, found := g.Channels[c.Name]; found {
+			apiFail(w, http.StatusConflict, "channel %q already exists", c.Name)
+			return
+		}
+		g.Channels[c.Name] = c
+		apiRespond(w, http.StatusCreated, c)
+	default:
+		apiFail(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+	}
+}
+
+func apiChannel(g *graph.Graph, name string, w http.ResponseWriter, r *http.Request) {
+	c, found := g.Channels[name]
+	if !found {
+		apiFail(w, http.StatusNotFound, "channel %q not found", name)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		apiRespond(w, http.StatusOK, c)
+	case "PUT":
+		d := new(graph.Channel)
+		if err := json.NewDecoder(r.Body).Decode(d); err != nil {
+			apiFail(w, http.StatusBadRequest, "invalid channel: %v", err)
+			return
+		}
+		if d.Name == "" {
+			d.Name = name
+		}
+		if err := validateChannel(g, d); err != nil {
+			apiFail(w, http.StatusBadRequest, "invalid channel: %v", err)
+			return
+		}
+		if d.Name != name {
+			// Renaming rewrites the goroutines using the channel.
+			if err := g.RenameChannel(name, d.Name); err != nil {
+				apiFail(w, http.StatusConflict, "could not rename channel: %v", err)
+				return
+			}
+		}
+		c.Type, c.Cap, c.CapExpr, c.Boundary = d.Type, d.Cap, d.CapExpr, d.Boundary
+		c.Overflow, c.Priority, c.Journal, c.Remote = d.Overflow, d.Priority, d.Journal, d.Remote
+		c.Fixture = d.Fixture
+		apiRespond(w, http.StatusOK, c)
+	case "DELETE":
+		delete(g.Channels, name)
+		apiRespond(w, http.StatusNoContent, nil)
+	default:
+		apiFail(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+	}
+}
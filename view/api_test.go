@@ -0,0 +1,130 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// callAPI makes a request of the JSON API, and returns the status and body.
+func callAPI(t *testing.T, ts *httptest.Server, method, path, body string) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+BasePath+APIPrefix+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest = %v", err)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s = %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: reading body: %v", method, path, err)
+	}
+	return resp.StatusCode, b
+}
+
+func TestAPI(t *testing.T) {
+	ts := serveGraphs(t, map[string]string{"test.szgo": testGraphJSON})
+	const sinkJSON = `{"name": "sink2", "multiplicity": 1, "part": {"code": "for range b {}"}, "part_type": "Code"}`
+
+	tests := []struct {
+		method, path, body string
+		code               int
+		want               string // In the body, or the error message.
+	}{
+		{"GET", "test.szgo", "", http.StatusOK, `"name": "test"`},
+		{"GET", "test.szgo?nodes", "", http.StatusOK, `"name": "gen"`},
+
+		// Goroutines.
+		{"POST", "test.szgo?nodes", `{"name": "new", "part": {"code": ""}, "part_type": "Code"}`, http.StatusCreated, `"name": "new"`},
+		{"POST", "test.szgo?nodes", `{"name": "new", "part": {"code": ""}, "part_type": "Code"}`, http.StatusConflict, `goroutine "new" already exists`},
+		{"GET", "test.szgo?node=new", "", http.StatusOK, `"name": "new"`},
+		{"PUT", "test.szgo?node=new", `{"name": "gen", "part": {"code": ""}, "part_type": "Code"}`, http.StatusConflict, `goroutine "gen" already exists`},
+		{"PUT", "test.szgo?node=new", `{"name": "newer", "part": {"code": ""}, "part_type": "Code"}`, http.StatusOK, `"name": "newer"`},
+		{"GET", "test.szgo?node=new", "", http.StatusNotFound, `goroutine "new" not found`},
+		{"DELETE", "test.szgo?node=newer", "", http.StatusNoContent, ""},
+		{"GET", "test.szgo?node=newer", "", http.StatusNotFound, `goroutine "newer" not found`},
+		{"PATCH", "test.szgo?nodes", "", http.StatusMethodNotAllowed, "unsupported method PATCH"},
+
+		// Channels, including renaming one, which rewrites the goroutines.
+		{"POST", "test.szgo?channels", `{"name": "c", "type": "string"}`, http.StatusCreated, `"name": "c"`},
+		{"POST", "test.szgo?channels", `{"name": "c", "type": "string"}`, http.StatusConflict, `channel "c" already exists`},
+		{"PUT", "test.szgo?channel=a", `{"name": "b", "type": "int"}`, http.StatusOK, `"name": "b"`},
+		{"GET", "test.szgo?channel=a", "", http.StatusNotFound, `channel "a" not found`},
+		{"GET", "test.szgo?node=gen", "", http.StatusOK, `"code": "b \u003c- 1; close(b)"`},
+		{"PUT", "test.szgo?channel=b", `{"name": "spare", "type": "int"}`, http.StatusConflict, "could not rename channel"},
+		{"DELETE", "test.szgo?channel=c", "", http.StatusNoContent, ""},
+		{"PATCH", "test.szgo?channel=b", "", http.StatusMethodNotAllowed, "unsupported method PATCH"},
+
+		// Whole graphs.
+		{"GET", "missing.szgo", "", http.StatusNotFound, "could not load graph /missing.szgo"},
+		{"PUT", "new.szgo", strings.Replace(testGraphJSON, `"test"`, `"new"`, 1), http.StatusCreated, `"name": "new"`},
+		{"PUT", "new.szgo", `{"name": "newer", "nodes": {"sink2": ` + sinkJSON + `}}`, http.StatusOK, `"name": "newer"`},
+		{"GET", "new.szgo?node=sink2", "", http.StatusOK, `"name": "sink2"`},
+		{"PUT", "new.szgo", `{`, http.StatusBadRequest, "invalid graph"},
+		{"POST", "test.szgo", "", http.StatusBadRequest, "POST to a graph needs ?save"},
+		{"PATCH", "test.szgo", "", http.StatusMethodNotAllowed, "unsupported method PATCH"},
+		{"DELETE", "test.szgo", "", http.StatusNoContent, ""},
+		{"GET", "test.szgo?channel=b", "", http.StatusNotFound, `channel "b" not found`}, // Reloaded from the file.
+	}
+	for _, test := range tests {
+		code, body := callAPI(t, ts, test.method, test.path, test.body)
+		if code != test.code {
+			t.Errorf("%s %s status = %d, want %d (body %s)", test.method, test.path, code, test.code, body)
+			continue
+		}
+		if code < 400 {
+			if !strings.Contains(string(body), test.want) {
+				t.Errorf("%s %s body = %s, want it to contain %s", test.method, test.path, body, test.want)
+			}
+			continue
+		}
+		var e apiError
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("%s %s body = %s, not an error object: %v", test.method, test.path, body, err)
+			continue
+		}
+		if e.Error.Code != test.code || !strings.Contains(e.Error.Message, test.want) {
+			t.Errorf("%s %s error = %+v, want code %d and a message containing %q", test.method, test.path, e.Error, test.code, test.want)
+		}
+	}
+}
+
+func TestAPIInvalidGraph(t *testing.T) {
+	ts := serveGraphs(t, map[string]string{"bad.szgo": "{"})
+
+	// Opening the page first mustn't leave anything loaded.
+	resp, err := ts.Client().Get(ts.URL + BasePath + "/bad.szgo")
+	if err != nil {
+		t.Fatalf("Get(bad.szgo) = %v", err)
+	}
+	resp.Body.Close()
+
+	code, body := callAPI(t, ts, "GET", "bad.szgo", "")
+	if code != http.StatusBadRequest {
+		t.Fatalf("GET bad.szgo status = %d, want %d (body %s)", code, http.StatusBadRequest, body)
+	}
+	var e apiError
+	if err := json.Unmarshal(body, &e); err != nil || !strings.Contains(e.Error.Message, "could not load graph") {
+		t.Errorf("GET bad.szgo body = %s, want a could not load graph error", body)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// BasicAuth requires requests to log in with HTTP basic authentication.
+type BasicAuth struct {
+	Realm string
+
+	// Users maps user names to the SHA-256 of their passwords.
+	Users map[string][sha256.Size]byte
+}
+
+// LoadBasicAuth reads users from a file of "name:password" lines. Passwords
+// may instead be given as "name:sha256:<hex digest>" to keep them out of the
+// file. Blank lines and lines starting with # are ignored.
+func LoadBasicAuth(path string) (*BasicAuth, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	a := &BasicAuth{
+		Realm: "shenzhen-go",
+		Users: make(map[string][sha256.Size]byte),
+	}
+	sc := bufio.NewScanner(f)
+	for ln := 1; sc.Scan(); ln++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		i := strings.Index(l, ":")
+		if i <= 0 || !userNameRE.MatchString(l[:i]) {
+			return nil, fmt.Errorf("%s:%d: want name:password", path, ln)
+		}
+		name, pw := l[:i], l[i+1:]
+		if h := strings.TrimPrefix(pw, "sha256:"); h != pw {
+			b, err := hex.DecodeString(h)
+			if err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("%s:%d: invalid SHA-256 digest", path, ln)
+			}
+			var d [sha256.Size]byte
+			copy(d[:], b)
+			a.Users[name] = d
+			continue
+		}
+		a.Users[name] = sha256.Sum256([]byte(pw))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(a.Users) == 0 {
+		return nil, fmt.Errorf("%s: no users", path)
+	}
+	return a, nil
+}
+
+// Require wraps h so that only logged-in users reach it.
+func (a *BasicAuth) Require(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, pw, ok := r.BasicAuth(); ok {
+			want, known := a.Users[u]
+			got := sha256.Sum256([]byte(pw))
+			if subtle.ConstantTimeCompare(got[:], want[:]) == 1 && known {
+				h.ServeHTTP(w, r)
+				return
+			}
+			log.Printf("Failed login for %q from %s", u, r.RemoteAddr)
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", a.Realm))
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+	})
+}
@@ -15,12 +15,15 @@
 package view
 
 import (
+	"context"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/google/shenzhen-go/graph"
 )
@@ -32,7 +35,7 @@ const browseTemplateSrc = `<head>
 <h1>SHENZHEN GO</h1>
 	<div>
 		<h2>{{$.Base}}</h2>
-		<a href="{{.Up}}">Up</a> | <a href="?new">New</a>
+		<a href="{{.Up}}">Up</a> | <a href="?new">New</a> | <a href="{{base}}/parts">Parts</a>
 		<table class="browse">
 			{{range $.Entries -}}
 			<tr>
@@ -44,21 +47,103 @@ const browseTemplateSrc = `<head>
 	</div>
 </body>`
 
-var browseTemplate = template.Must(template.New("browse").Parse(browseTemplateSrc))
+var browseTemplate = template.Must(template.New("browse").Funcs(templateFuncs).Parse(browseTemplateSrc))
 
 // dirBrowser serves a way of visually navigating the filesystem.
 type dirBrowser struct {
+	mu           sync.Mutex // Guards the maps, not the graphs (see graphLock).
 	loadedGraphs map[string]*graph.Graph
+	previews     map[previewKey]*preview
 }
 
 // NewBrowser makes a Handler that can browse the filesystem and also multiple
 // graphs stored in the filesystem.
 func NewBrowser() http.Handler {
-	return &dirBrowser{
+	b := &dirBrowser{
 		loadedGraphs: make(map[string]*graph.Graph),
+		previews:     make(map[previewKey]*preview),
+	}
+	stats.graphs = func() int {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return len(b.loadedGraphs)
+	}
+	unsavedGraphs = b.unsaved
+	return b
+}
+
+// graphLocks holds a lock for each graph, by path. Handlers hold the write
+// lock, so changes from several people at once are made one at a time.
+// Requests that go on for a while (builds, runs, WebSockets) let go of it
+// early (see releaseGraph), and then only take the read lock when they look.
+var graphLocks = struct {
+	sync.Mutex
+	m map[string]*sync.RWMutex
+}{m: make(map[string]*sync.RWMutex)}
+
+// graphLock returns the lock for the graph at path.
+func graphLock(path string) *sync.RWMutex {
+	graphLocks.Lock()
+	defer graphLocks.Unlock()
+	l := graphLocks.m[path]
+	if l == nil {
+		l = new(sync.RWMutex)
+		graphLocks.m[path] = l
+	}
+	return l
+}
+
+// A graphHold is a request's hold on the lock of the graph it is about.
+type graphHold struct {
+	once    sync.Once
+	release func()
+}
+
+type graphHoldKey struct{}
+
+// releaseGraph lets go of the lock on r's graph that ServeHTTP took. Requests
+// that go on for a while call it once they have what they need of the graph
+// (see detachGraph). It is safe to call more than once.
+func releaseGraph(r *http.Request) {
+	if h, ok := r.Context().Value(graphHoldKey{}).(*graphHold); ok {
+		h.once.Do(h.release)
 	}
 }
 
+// detachGraph copies g, and then releases it (see releaseGraph), for a
+// request that builds or runs it.
+func detachGraph(g *graph.Graph, r *http.Request) (*graph.Graph, error) {
+	c, err := g.Clone()
+	if err != nil {
+		return nil, err
+	}
+	releaseGraph(r)
+	c.LoadSubgraphs()
+	return c, nil
+}
+
+// loaded returns the graph loaded from path, if it has been.
+func (b *dirBrowser) loaded(path string) (*graph.Graph, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, ok := b.loadedGraphs[path]
+	return g, ok
+}
+
+// setLoaded records g as the graph at path.
+func (b *dirBrowser) setLoaded(path string, g *graph.Graph) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.loadedGraphs[path] = g
+}
+
+// unload forgets the graph at path.
+func (b *dirBrowser) unload(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.loadedGraphs, path)
+}
+
 type entry struct {
 	IsDir bool
 	Path  string
@@ -66,11 +151,40 @@ type entry struct {
 }
 
 func (b *dirBrowser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Printf("%s browse: %s", r.Method, r.URL)
+	if strings.HasPrefix(r.URL.Path, AdminPath) {
+		// Each call locks the graph it is about.
+		b.serveAdmin(w, r)
+		return
+	}
+	gp, user := graphPath(r), identify(w, r)
 
-	path := r.URL.Path
-	if g, ok := b.loadedGraphs[path]; ok {
-		Graph(g, w, r)
+	// Requests hold the graph's lock until they finish (or release it), so
+	// people editing the same graph take turns.
+	l := graphLock(gp)
+	l.Lock()
+	cur, _ := b.loaded(gp)
+	before := namesOf(cur)
+	hold := &graphHold{release: func() {
+		after, _ := b.loaded(gp)
+		publishChanges(gp, user, before, namesOf(after))
+		if after != nil && r.Method == "GET" && !isWebSocket(r) {
+			here.observe(gp, user, r.URL.Query().Get("node"))
+		}
+		l.Unlock()
+	}}
+	r = r.WithContext(context.WithValue(r.Context(), graphHoldKey{}, hold))
+	defer releaseGraph(r)
+
+	if strings.HasPrefix(r.URL.Path, BasePath+APIPrefix) {
+		b.serveAPI(w, r)
+		return
+	}
+
+	path := gp
+	if g, ok := b.loaded(path); ok {
+		if g, r := b.previewed(g, path, user, w, r); g != nil {
+			Graph(g, w, r)
+		}
 		return
 	}
 
@@ -89,13 +203,27 @@ func (b *dirBrowser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	if _, imp := graph.ImportFormats[strings.ToLower(filepath.Ext(base))]; imp && !fi.IsDir() {
+		// Diagrams in other formats are imported as new graphs, saved
+		// alongside them.
+		g, err := graph.ImportFile(base)
+		if err != nil {
+			log.Printf("Could not import graph: %v", err)
+			http.Error(w, fmt.Sprintf("Could not import graph: %v", err), http.StatusBadRequest)
+			return
+		}
+		b.setLoaded(path, g)
+		Graph(g, w, r)
+		return
+	}
 	if !fi.IsDir() {
 		g, err := graph.LoadJSON(f, base)
 		if err != nil {
 			log.Printf("Not a directory or a valid JSON-encoded graph: %v", err)
 			http.NotFound(w, r)
+			return
 		}
-		b.loadedGraphs[path] = g
+		b.setLoaded(path, g)
 		Graph(g, w, r)
 		return
 	}
@@ -114,7 +242,7 @@ func (b *dirBrowser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		e = append(e, entry{
 			IsDir: fi.IsDir(),
 			Name:  fi.Name(),
-			Path:  filepath.Join(path, fi.Name()),
+			Path:  BasePath + filepath.Join(path, fi.Name()),
 		})
 	}
 
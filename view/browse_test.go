@@ -0,0 +1,105 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphLockUpgradeHeader(t *testing.T) {
+	ts := serveGraphs(t, map[string]string{"test.szgo": testGraphJSON})
+	// HTTP/2 doesn't allow the header.
+	tr := ts.Client().Transport.(*http.Transport).Clone()
+	tr.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	c := &http.Client{Transport: tr}
+	// Connect first, so that the request below is quick unless it waits.
+	resp, err := c.Get(ts.URL + APIPrefix + "test.szgo")
+	if err != nil {
+		t.Fatalf("GET test.szgo = %v", err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	l := graphLock("/test.szgo")
+	l.Lock()
+	done := make(chan int)
+	go func() {
+		req, err := http.NewRequest("DELETE", ts.URL+APIPrefix+"test.szgo?channel=spare", nil)
+		if err != nil {
+			done <- 0
+			return
+		}
+		// Saying it's a WebSocket mustn't get out of waiting for the lock.
+		req.Header.Set("Upgrade", "websocket")
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Errorf("DELETE ?channel=spare = %v", err)
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	select {
+	case code := <-done:
+		l.Unlock()
+		t.Fatalf("DELETE ?channel=spare finished (status %d) while the graph was locked", code)
+	case <-time.After(500 * time.Millisecond):
+	}
+	l.Unlock()
+	if code := <-done; code != http.StatusNoContent {
+		t.Errorf("DELETE ?channel=spare status = %d, want %d", code, http.StatusNoContent)
+	}
+}
+
+func TestGraphLockLive(t *testing.T) {
+	ts := serveGraphs(t, map[string]string{"test.szgo": testGraphJSON})
+
+	// HTTP/2 connections can't become WebSockets.
+	conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+	if err != nil {
+		t.Fatalf("Dial = %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /test.szgo?live HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", ts.Listener.Addr())
+	status, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.Contains(status, " 101 ") {
+		t.Fatalf("?live handshake = %q, %v; want 101 Switching Protocols", status, err)
+	}
+
+	// While it stays open, editing goes on.
+	c := ts.Client()
+	c.Timeout = 5 * time.Second
+	code, body := 0, ""
+	resp, err := c.Post(ts.URL+APIPrefix+"test.szgo?channels", "application/json", strings.NewReader(`{"name": "c", "type": "int"}`))
+	if err == nil {
+		code = resp.StatusCode
+		resp.Body.Close()
+	} else {
+		body = err.Error()
+	}
+	if code != http.StatusCreated {
+		t.Errorf("POST ?channels with ?live open = %d %s, want %d", code, body, http.StatusCreated)
+	}
+}
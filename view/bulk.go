@@ -0,0 +1,141 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// Bulk handles operations on several goroutines at once, given as
+// ?bulk=op&node=a&node=b (the nodes may also be in the POSTed form):
+//
+//	delete        delete them (a GET asks first)
+//	wait          set Wait to the Wait field ("on" or not)
+//	multiplicity  set Multiplicity to the Multiplicity field
+//	group         put them in the group named by the Group field
+//	extract       move them into a new subgraph in the file given by the
+//	              File field, replacing them with a goroutine called Name
+//	              (a GET asks where, showing how channels will be rewired)
+//
+// Nothing changes unless all the goroutines exist. It redirects to the graph,
+// or to the new goroutine's editor for extract.
+func Bulk(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("Could not parse form: %v", err), http.StatusBadRequest)
+		return
+	}
+	op, names := r.Form.Get("bulk"), r.Form["node"]
+	fail := func(code int, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		log.Print(msg)
+		http.Error(w, msg, code)
+	}
+	ns, err := g.NodesNamed(names)
+	if err != nil {
+		fail(http.StatusBadRequest, "Could not select goroutines: %v", err)
+		return
+	}
+
+	if op == "delete" && r.Method != "POST" {
+		// Ask first.
+		eff, err := g.PreviewDeleteNodes(names)
+		if err == nil {
+			what := fmt.Sprintf("%d goroutines", len(ns))
+			if len(ns) == 1 {
+				what = ns[0].Name
+			}
+			err = renderDeleteConfirm(w, what, "?", eff)
+		}
+		if err != nil {
+			fail(http.StatusInternalServerError, "Could not preview deleting goroutines: %v", err)
+		}
+		return
+	}
+	if op == "extract" && r.Method != "POST" {
+		bulkExtract(g, names, w, r, nil)
+		return
+	}
+	if r.Method != "POST" {
+		fail(http.StatusMethodNotAllowed, "Unsupported method %s", r.Method)
+		return
+	}
+
+	u := *r.URL
+	u.RawQuery = ""
+	switch op {
+	case "delete":
+		if err := g.DeleteNodes(names); err != nil {
+			fail(http.StatusBadRequest, "Could not delete goroutines: %v", err)
+			return
+		}
+	case "wait":
+		wait := r.FormValue("Wait") == "on"
+		for _, n := range ns {
+			n.Wait = wait
+		}
+	case "multiplicity":
+		mult, err := strconv.Atoi(r.FormValue("Multiplicity"))
+		if err != nil || mult < 1 {
+			fail(http.StatusBadRequest, "Multiplicity %q is not a whole number, at least 1", r.FormValue("Multiplicity"))
+			return
+		}
+		for _, n := range ns {
+			n.Multiplicity = uint(mult)
+		}
+	case "group":
+		gr := strings.TrimSpace(r.FormValue("Group"))
+		for _, n := range ns {
+			n.Group = gr
+		}
+	case "extract":
+		n, err := g.Extract(names, strings.TrimSpace(r.FormValue("File")), strings.TrimSpace(r.FormValue("Name")))
+		if err != nil {
+			bulkExtract(g, names, w, r, err)
+			return
+		}
+		u.RawQuery = url.Values{"node": {n.Name}}.Encode()
+	default:
+		fail(http.StatusBadRequest, "Unknown operation %q", op)
+		return
+	}
+	http.Redirect(w, r, u.String(), http.StatusSeeOther) // should cause GET
+}
+
+// bulkExtract shows the form for extracting the nodes into a subgraph, with
+// the error from the last attempt, if any.
+func bulkExtract(g *graph.Graph, names []string, w http.ResponseWriter, r *http.Request, exErr error) {
+	plan, err := g.PreviewExtract(names)
+	if err != nil {
+		log.Printf("Could not preview extracting subgraph: %v", err)
+		http.Error(w, fmt.Sprintf("Could not preview extracting subgraph: %v", err), http.StatusBadRequest)
+		return
+	}
+	var msg string
+	if exErr != nil {
+		msg = fmt.Sprintf("Could not extract subgraph: %v", exErr)
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := renderExtract(w, names, plan, r.Form, msg); err != nil {
+		log.Printf("Could not render extract form: %v", err)
+		http.Error(w, fmt.Sprintf("Could not render extract form: %v", err), http.StatusInternalServerError)
+	}
+}
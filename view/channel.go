@@ -17,11 +17,12 @@ package view
 import (
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"regexp"
-	"strconv"
+	"strings"
 
 	"github.com/google/shenzhen-go/graph"
 )
@@ -35,33 +36,141 @@ const channelEditorTemplateSrc = `<head>
 	<form method="post">
 		<div class="formfield">
 			<label for="Name">Name</label>
-			<input type="text" name="Name" required pattern="^[_a-zA-Z][_a-zA-Z0-9]*$" title="Must start with a letter or underscore, and only contain letters, digits, or underscores." value="{{.Name}}">
+			<input type="text" name="Name" {{if .Name}}required{{else}}placeholder="Generated if blank"{{end}} pattern="^[_a-zA-Z][_a-zA-Z0-9]*$" title="Must start with a letter or underscore, and only contain letters, digits, or underscores." value="{{with .Form}}{{.Get "Name"}}{{else}}{{if .Name}}{{.Name}}{{else}}{{.NewName}}{{end}}{{end}}">
+			{{with index .FormErrors "Name"}}<div class="errors hint">{{.}}</div>{{end}}
 		</div>
 		<div class="formfield">
 			<label for="Type">Type</label>
-			<input type="text" name="Type" required value="{{.Type}}">
+			<input type="text" name="Type" placeholder="Inferred from goroutine code if blank" value="{{with .Form}}{{.Get "Type"}}{{else}}{{if .Type}}{{.Type}}{{else}}{{.Suggested}}{{end}}{{end}}">
+			{{with index .FormErrors "Type"}}<div class="errors hint">{{.}}</div>{{end}}
+			{{if and .Suggested (ne .Suggested .Type) -}}
+			<div class="hint">Goroutine code suggests {{.Suggested}}</div>
+			{{- end}}
 		</div>
 		<div class="formfield">
 			<label for="Cap">Capacity</label>
-			<input type="text" name="Cap" required pattern="^[0-9]+$" title="Must be a whole number, at least 0." value="{{.Cap}}">
+			<input type="text" name="Cap" required title="A whole number, at least 0, or a constant expression such as bufSize." value="{{with .Form}}{{.Get "Cap"}}{{else}}{{.CapSource}}{{end}}">
+			{{if .CapExpr}}<div class="hint">Currently {{.Cap}}.</div>{{end}}
+			{{with index .FormErrors "Cap"}}<div class="errors hint">{{.}}</div>{{end}}
+			{{if .CapReason -}}
+			<div class="hint">Consider a capacity of {{.CapAdvice}}: {{.CapReason}}.</div>
+			{{- end}}
 		</div>
+		<div class="formfield">
+			<label for="Overflow">When full</label>
+			<select name="Overflow">
+				{{range overflowPolicies}}<option value="{{.Value}}" {{if eq .Value $.Overflow}}selected{{end}}>{{.Description}}</option>{{end}}
+			</select>
+			{{with index .FormErrors "Overflow"}}<div class="errors hint">{{.}}</div>{{end}}
+		</div>
+		<div class="formfield">
+			<label for="Priority">Priority</label>
+			<input type="text" name="Priority" placeholder="Values are received in the order sent" title="An expression of x, a value sent. Values with the smallest keys are received first." value="{{with .Form}}{{.Get "Priority"}}{{else}}{{.Priority}}{{end}}">
+			{{with index .FormErrors "Priority"}}<div class="errors hint">{{.}}</div>{{end}}
+		</div>
+		<div class="formfield">
+			<label for="Journal">Journal</label>
+			<input type="text" name="Journal" placeholder="Values are only held in memory" title="A Go string expression naming a file, such as &quot;work.journal&quot;. Values sent are kept there until received, so they survive a restart." value="{{with .Form}}{{.Get "Journal"}}{{else}}{{.Journal}}{{end}}">
+			{{with index .FormErrors "Journal"}}<div class="errors hint">{{.}}</div>{{end}}
+		</div>
+		<div class="formfield">
+			<label for="Remote">Remote address</label>
+			<input type="text" name="Remote" placeholder="Readers and writers are in the same program" title="host:port for readers to listen on when the graph is split into services." value="{{with .Form}}{{.Get "Remote"}}{{else}}{{.Remote}}{{end}}">
+			{{with index .FormErrors "Remote"}}<div class="errors hint">{{.}}</div>{{end}}
+		</div>
+		<div class="formfield">
+			<label for="Samples">Samples</label>
+			<textarea name="Samples" rows="3" cols="36" placeholder="One Go expression per line" title="Example values, used when trying goroutines by themselves and simulating.">{{with .Form}}{{.Get "Samples"}}{{else}}{{with .Fixture}}{{range .Values}}{{.}}
+{{end}}{{end}}{{end}}</textarea>
+			<input type="text" name="SampleGenerator" placeholder="Then generate: an expression of i" value="{{with .Form}}{{.Get "SampleGenerator"}}{{else}}{{with .Fixture}}{{.Generator}}{{end}}{{end}}">
+			<input type="number" name="SampleCount" min="0" placeholder="How many" value="{{with .Form}}{{.Get "SampleCount"}}{{else}}{{with .Fixture}}{{with .Count}}{{.}}{{end}}{{end}}{{end}}">
+			{{with index .FormErrors "Samples"}}<div class="errors hint">{{.}}</div>{{end}}
+		</div>
+		<div class="formfield">
+			<label for="Boundary">Connects to</label>
+			<select name="Boundary">
+				<option value="" {{if not .Boundary}}selected{{end}}>Nothing outside the graph</option>
+				<option value="input" {{if eq .Boundary "input"}}selected{{end}}>Input to the graph (a parameter of Run)</option>
+				<option value="output" {{if eq .Boundary "output"}}selected{{end}}>Output from the graph (a parameter of Run)</option>
+			</select>
+			{{with index .FormErrors "Boundary"}}<div class="errors hint">{{.}}</div>{{end}}
+		</div>
+		{{if .Name -}}
+		<div class="formfield">
+			<label>Written by</label>
+			<span>{{range .Writers}}<a href="?node={{.Name}}">{{.Name}}</a> {{else}}nothing{{end}}</span>
+		</div>
+		<div class="formfield">
+			<label>Read by</label>
+			<span>{{range .Readers}}<a href="?node={{.Name}}">{{.Name}}</a> {{else}}nothing{{end}}</span>
+		</div>
+		{{- end}}
 		<div class="formfield hcentre">
 			<input type="submit" value="Save">
 			<input type="button" value="Return" onclick="window.location.href='?'">
 		</div>
 	</form>
+	{{if .Name}}<a href="?channel={{.Name}}&amp;delete">Delete this channel</a>{{end}}
+</body>`
+
+const renamePreviewTemplateSrc = `<head>
+	<title>Rename {{.From}}</title><style>` + css + `</style>
+</head>
+<body>
+	<h1>Rename {{.From}} to {{.To}}</h1>
+	<p>Renaming the channel will change these goroutines:</p>
+	{{range .Effects}}
+	<h2><a href="?node={{.Node}}">{{.Node}}</a></h2>
+	<div class="beforeafter">
+		<pre>{{.Before}}</pre>
+		<pre>{{.After}}</pre>
+	</div>
+	{{end}}
+	<form method="post">
+		{{range $k, $vs := .Form}}{{range $vs}}<input type="hidden" name="{{$k}}" value="{{.}}">{{end}}{{end}}
+		<input type="hidden" name="ConfirmRename" value="yes">
+		<div class="formfield hcentre">
+			<input type="submit" value="Rename">
+			<a href="?channel={{.From}}">Cancel</a>
+		</div>
+	</form>
 </body>`
 
 var (
-	channelEditorTemplate = template.Must(template.New("channelEditor").Parse(channelEditorTemplateSrc))
+	channelEditorTemplate = template.Must(template.New("channelEditor").Funcs(templateFuncs).Parse(channelEditorTemplateSrc))
+	renamePreviewTemplate = template.Must(template.New("renamePreview").Funcs(templateFuncs).Parse(renamePreviewTemplateSrc))
 
 	identifierRE = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
 )
 
+// renderChannelEditor renders the editor for e. For new channels, newName is
+// a suggested name. If errs is not nil, the editor shows the values in form
+// instead of those of e, along with the errors.
+func renderChannelEditor(dst io.Writer, g *graph.Graph, e *graph.Channel, newName string, form url.Values, errs formErrors) error {
+	name := e.Name
+	if name == "" {
+		name = newName
+	}
+	sugg := ""
+	if name != "" {
+		sugg = g.SuggestChannelType(name)
+	}
+	capAdv, capWhy := g.CapacityAdvice(e.Name)
+	return channelEditorTemplate.Execute(dst, &struct {
+		*graph.Channel
+		NewName    string
+		Suggested  string
+		CapAdvice  int
+		CapReason  string
+		Readers    []*graph.Node
+		Writers    []*graph.Node
+		Form       url.Values
+		FormErrors formErrors
+	}{e, newName, sugg, capAdv, capWhy, g.Readers(e.Name), g.Writers(e.Name), form, errs})
+}
+
 // Channel handles viewing/editing a channel.
 func Channel(g *graph.Graph, name string, w http.ResponseWriter, r *http.Request) {
-	log.Printf("%s %s", r.Method, r.URL)
-
 	e, found := g.Channels[name]
 	if name != "new" && !found {
 		http.Error(w, fmt.Sprintf("Channel %q not found", name), http.StatusNotFound)
@@ -72,19 +181,40 @@ func Channel(g *graph.Graph, name string, w http.ResponseWriter, r *http.Request
 		e = new(graph.Channel)
 	}
 
+	if _, del := r.URL.Query()["delete"]; del && found {
+		if r.Method != "POST" {
+			// Ask first.
+			eff, err := g.PreviewDeleteChannel(name)
+			if err == nil {
+				err = renderDeleteConfirm(w, name, "?"+url.Values{"channel": {name}}.Encode(), eff)
+			}
+			if err != nil {
+				log.Printf("Could not preview deleting channel: %v", err)
+				http.Error(w, fmt.Sprintf("Could not preview deleting channel: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+		delete(g.Channels, name)
+		u := *r.URL
+		u.RawQuery = ""
+		http.Redirect(w, r, u.String(), http.StatusFound)
+		return
+	}
+
 	var err error
 	switch r.Method {
 	case "POST":
 		err = handleChannelPost(g, e, w, r)
 	case "GET":
-		err = channelEditorTemplate.Execute(w, e)
+		err = renderChannelEditor(w, g, e, r.URL.Query().Get("name"), nil, nil)
 	default:
 		err = fmt.Errorf("unsupported verb %q", r.Method)
 	}
 
 	if err != nil {
-		log.Printf("Could not handle request: %v", err)
-		http.Error(w, "Could not handle request", http.StatusInternalServerError)
+		msg := fmt.Sprintf("Could not handle request: %v", err)
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
 	}
 }
 
@@ -94,42 +224,125 @@ func handleChannelPost(g *graph.Graph, e *graph.Channel, w http.ResponseWriter,
 	}
 
 	// Validate.
-	nn := r.FormValue("Name")
-	if !identifierRE.MatchString(nn) {
-		return fmt.Errorf("invalid name [%q !~ %q]", nn, identifierRE)
+	errs := make(formErrors)
+	nn := strings.TrimSpace(r.FormValue("Name"))
+	if nn != "" && !identifierRE.MatchString(nn) {
+		errs["Name"] = "Must start with a letter or underscore, and only contain letters, digits, or underscores."
+	}
+	if nn == "" && e.Name != "" {
+		errs["Name"] = "The name is empty."
 	}
 
-	ci, err := strconv.Atoi(r.FormValue("Cap"))
+	ci, cx, err := parseCap(g, r.FormValue("Cap"))
 	if err != nil {
-		return err
+		errs["Cap"] = fmt.Sprintf("%q is not a whole number, at least 0, or a constant expression for one: %v", r.FormValue("Cap"), err)
+	}
+
+	ty := strings.TrimSpace(r.FormValue("Type"))
+	if ty == "" {
+		ty = g.SuggestChannelType(nn)
+	}
+	if ty == "" {
+		errs["Type"] = "The type is empty, and could not be inferred from goroutine code."
+	} else if err := g.CheckChannelType(ty); err != nil {
+		errs["Type"] = err.Error()
 	}
-	if ci < 0 {
-		return fmt.Errorf("invalid capacity [%d < 0]", ci)
+	if nn == "" && ty != "" {
+		// New channels are named automatically if need be.
+		nn = g.UniqueChannelName(ty)
+	}
+
+	b := r.FormValue("Boundary")
+	switch b {
+	case "", graph.Input, graph.Output:
+	default:
+		errs["Boundary"] = fmt.Sprintf("Invalid boundary %q.", b)
+	}
+
+	of := r.FormValue("Overflow")
+	if err := validOverflow(of, b, ci); err != nil {
+		errs["Overflow"] = err.Error()
+	}
+
+	pr := strings.TrimSpace(r.FormValue("Priority"))
+	jn := strings.TrimSpace(r.FormValue("Journal"))
+	ra := strings.TrimSpace(r.FormValue("Remote"))
+	nc := &graph.Channel{Type: ty, Cap: ci, Boundary: b, Overflow: of, Priority: pr, Journal: jn, Remote: ra}
+	if err := validPriority(g, nc); err != nil {
+		errs["Priority"] = err.Error()
+	}
+	if err := validJournal(g, nc); err != nil {
+		errs["Journal"] = err.Error()
+	}
+	if err := validRemote(nc); err != nil {
+		errs["Remote"] = err.Error()
+	}
+	fx, err := parseFixture(r.FormValue("Samples"), r.FormValue("SampleGenerator"), r.FormValue("SampleCount"))
+	if err == nil {
+		nc.Fixture = fx
+		err = g.CheckFixture(nc)
+	}
+	if err != nil {
+		errs["Samples"] = err.Error()
+	}
+
+	if _, found := g.Channels[nn]; found && nn != e.Name {
+		errs["Name"] = fmt.Sprintf("There is already a channel called %q.", nn)
+	}
+
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return renderChannelEditor(w, g, e, "", r.PostForm, errs)
+	}
+
+	// Renaming an existing channel rewrites goroutines, so show what would
+	// change and ask for confirmation first.
+	if e.Name != "" && nn != e.Name && r.FormValue("ConfirmRename") == "" {
+		effs, err := g.PreviewRenameChannel(e.Name, nn)
+		if err != nil {
+			return err
+		}
+		if len(effs) > 0 {
+			return renamePreviewTemplate.Execute(w, &struct {
+				From, To string
+				Effects  []graph.RenameEffect
+				Form     url.Values
+			}{e.Name, nn, effs, r.PostForm})
+		}
 	}
 
 	// Update.
-	e.Type = r.FormValue("Type")
-	e.Cap = ci
+	e.Type = ty
+	e.Cap, e.CapExpr = ci, cx
+	e.Boundary = b
+	e.Overflow = of
+	e.Priority = pr
+	e.Journal = jn
+	e.Remote = ra
+	e.Fixture = fx
 
 	// No name change? No need to readjust the map or redirect.
 	// So render the usual editor.
 	if nn == e.Name {
-		return channelEditorTemplate.Execute(w, e)
+		return renderChannelEditor(w, g, e, "", nil, nil)
 	}
 
 	// Do name changes last since they cause a redirect.
 	if e.Name != "" {
-		delete(g.Channels, e.Name)
+		if err := g.RenameChannel(e.Name, nn); err != nil {
+			return err
+		}
+	} else {
+		e.Name = nn
+		g.Channels[nn] = e
 	}
-	e.Name = nn
-	g.Channels[nn] = e
 
 	q := url.Values{
 		"channel": []string{nn},
 	}
 	u := *r.URL
 	u.RawQuery = q.Encode()
-	log.Printf("redirecting to %v", u)
+	Debugf("redirecting to %v", u)
 	http.Redirect(w, r, u.String(), http.StatusSeeOther) // should cause GET
 	return nil
 }
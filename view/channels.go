@@ -0,0 +1,250 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const channelsTemplateSrc = `<head>
+	<title>{{.Name}} channels</title><style>` + css + `</style>
+</head>
+<body>
+<h1>{{.Name}} channels</h1>
+<a href="?">Return</a> | <a href="?channel=new">New channel</a>
+<form method="post">
+	<table class="results">
+		<tr><th></th><th>Name</th><th>Type</th><th>Capacity</th></tr>
+		{{range .Channels -}}
+		<tr>
+			<td><input type="checkbox" name="Select" value="{{.Name}}"></td>
+			<td><a href="?channel={{.Name}}">{{.Name}}</a></td>
+			<td><input type="text" name="Type.{{.Name}}" required value="{{.Type}}"></td>
+			<td><input type="text" name="Cap.{{.Name}}" required size="6" value="{{.CapSource}}" title="A whole number, or a constant expression such as bufSize"></td>
+		</tr>
+		{{- end}}
+	</table>
+	<div class="formfield">
+		<label for="SetType">Set type of selected</label>
+		<input type="text" name="SetType">
+	</div>
+	<div class="formfield">
+		<label for="SetCap">Set capacity of selected</label>
+		<input type="text" name="SetCap" placeholder="e.g. 4 or bufSize">
+	</div>
+	<div class="formfield hcentre">
+		<input type="submit" value="Save">
+	</div>
+</form>
+</body>`
+
+var channelsTemplate = template.Must(template.New("channels").Funcs(templateFuncs).Parse(channelsTemplateSrc))
+
+// Channels handles viewing and editing all the channels at once.
+func Channels(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case "POST":
+		err = handleChannelsPost(g, w, r)
+	case "GET":
+		err = channelsTemplate.Execute(w, g)
+	default:
+		err = fmt.Errorf("unsupported verb %q", r.Method)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Could not handle request: %v", err)
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
+
+// validOverflow checks an overflow policy suits a channel with the boundary
+// and capacity.
+func validOverflow(policy, boundary string, capacity int) error {
+	switch policy {
+	case graph.OverflowBlock:
+		return nil
+	case graph.OverflowDropNewest, graph.OverflowDropOldest:
+		if capacity < 1 {
+			return fmt.Errorf("%s needs a capacity of at least 1", policy)
+		}
+	case graph.OverflowExpand:
+	default:
+		return fmt.Errorf("unknown overflow policy %q", policy)
+	}
+	if boundary == graph.Output {
+		return fmt.Errorf("outputs can't have an overflow policy")
+	}
+	return nil
+}
+
+// validPriority checks a priority expression suits the channel c would
+// become with it.
+func validPriority(g *graph.Graph, c *graph.Channel) error {
+	if c.Priority == "" {
+		return nil
+	}
+	if _, err := g.PriorityKeyType(c); err != nil {
+		return err
+	}
+	switch {
+	case c.Overflow == graph.OverflowDropNewest || c.Overflow == graph.OverflowDropOldest:
+		return fmt.Errorf("priority queues can't drop values")
+	case c.Overflow == graph.OverflowBlock && c.Cap < 1:
+		return fmt.Errorf("priority queues need a capacity of at least 1, or to grow without limit")
+	case c.Boundary == graph.Output:
+		return fmt.Errorf("outputs can't have a priority")
+	}
+	return nil
+}
+
+// validJournal checks a journal suits the channel c would become with it.
+func validJournal(g *graph.Graph, c *graph.Channel) error {
+	if !c.Journaled() {
+		return nil
+	}
+	if err := g.CheckJournalPath(c); err != nil {
+		return err
+	}
+	switch {
+	case c.Overflow == graph.OverflowDropNewest || c.Overflow == graph.OverflowDropOldest:
+		return fmt.Errorf("journaled channels can't drop values")
+	case c.Overflow == graph.OverflowBlock && c.Cap < 1:
+		return fmt.Errorf("journaled channels need a capacity of at least 1, or to grow without limit")
+	case c.Priority != "":
+		return fmt.Errorf("journaled channels can't have a priority")
+	case c.Boundary == graph.Output:
+		return fmt.Errorf("outputs can't be journaled")
+	}
+	return nil
+}
+
+// validRemote checks a remote address suits the channel c would become with
+// it.
+func validRemote(c *graph.Channel) error {
+	if c.Remote == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.Remote); err != nil {
+		return err
+	}
+	if c.Boundary != "" {
+		return fmt.Errorf("inputs and outputs can't be remote")
+	}
+	return nil
+}
+
+// parseFixture parses a fixture from the channel editor: values one per
+// line, a generator expression, and a count. It returns nil if all are
+// empty.
+func parseFixture(values, gen, count string) (*graph.Fixture, error) {
+	f := &graph.Fixture{Generator: strings.TrimSpace(gen)}
+	for _, l := range strings.Split(values, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			f.Values = append(f.Values, l)
+		}
+	}
+	if count = strings.TrimSpace(count); count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a whole number", count)
+		}
+		f.Count = n
+	}
+	if f.Values == nil && f.Generator == "" && f.Count == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// parseCap parses a capacity, which is either a whole number or a constant
+// expression (returned as expr) that evaluates to one.
+func parseCap(g *graph.Graph, s string) (c int, expr string, err error) {
+	s = strings.TrimSpace(s)
+	if c, err := strconv.Atoi(s); err == nil {
+		if c < 0 {
+			return 0, "", fmt.Errorf("invalid capacity [%d < 0]", c)
+		}
+		return c, "", nil
+	}
+	c, err = g.CapValue(s)
+	if err != nil {
+		return 0, "", err
+	}
+	return c, s, nil
+}
+
+func handleChannelsPost(g *graph.Graph, w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	// Validate everything before changing anything.
+	types := make(map[string]string, len(g.Channels))
+	caps := make(map[string]int, len(g.Channels))
+	exprs := make(map[string]string, len(g.Channels))
+	for n := range g.Channels {
+		t := strings.TrimSpace(r.PostFormValue("Type." + n))
+		if t == "" {
+			return fmt.Errorf("channel %s: type is empty", n)
+		}
+		c, x, err := parseCap(g, r.PostFormValue("Cap."+n))
+		if err != nil {
+			return fmt.Errorf("channel %s: %v", n, err)
+		}
+		types[n], caps[n], exprs[n] = t, c, x
+	}
+
+	setType := strings.TrimSpace(r.PostFormValue("SetType"))
+	setCap, setExpr := -1, ""
+	if s := r.PostFormValue("SetCap"); s != "" {
+		c, x, err := parseCap(g, s)
+		if err != nil {
+			return err
+		}
+		setCap, setExpr = c, x
+	}
+	for _, n := range r.PostForm["Select"] {
+		if _, found := g.Channels[n]; !found {
+			return fmt.Errorf("no channel %q", n)
+		}
+		if setType != "" {
+			types[n] = setType
+		}
+		if setCap >= 0 {
+			caps[n], exprs[n] = setCap, setExpr
+		}
+	}
+
+	for n, t := range types {
+		if err := g.CheckChannelType(t); err != nil {
+			return fmt.Errorf("channel %s: %v", n, err)
+		}
+	}
+
+	// Update.
+	for n, c := range g.Channels {
+		c.Type, c.Cap, c.CapExpr = types[n], caps[n], exprs[n]
+	}
+	return channelsTemplate.Execute(w, g)
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// PresenceTimeout is how long after their last request someone is still
+// counted as viewing a graph or node.
+var PresenceTimeout = 2 * time.Minute
+
+// userCookie holds the name people go by when several edit at once.
+const userCookie = "shenzhen_user"
+
+var userNameRE = regexp.MustCompile(`^[\w.@-]{1,32}$`)
+
+// identify returns the name of the person making the request. Anyone without
+// one is given a guest name, which is added to r so later handlers see it.
+func identify(w http.ResponseWriter, r *http.Request) string {
+	if u := userOf(r); u != "" {
+		return u
+	}
+	b := make([]byte, 3)
+	rand.Read(b)
+	c := &http.Cookie{Name: userCookie, Value: "guest-" + hex.EncodeToString(b), Path: BasePath + "/"}
+	http.SetCookie(w, c)
+	r.AddCookie(c)
+	return c.Value
+}
+
+// userOf returns the name of the person making the request, if known. Names
+// people log in with take priority over names they chose.
+func userOf(r *http.Request) string {
+	if u, _, ok := r.BasicAuth(); ok {
+		return u
+	}
+	c, err := r.Cookie(userCookie)
+	if err != nil || !userNameRE.MatchString(c.Value) {
+		return ""
+	}
+	return c.Value
+}
+
+// SetUser handles choosing a name (?iam=name), then returns to the graph.
+func SetUser(w http.ResponseWriter, r *http.Request) {
+	if u, _, ok := r.BasicAuth(); ok {
+		http.Error(w, fmt.Sprintf("Logged in as %s", u), http.StatusBadRequest)
+		return
+	}
+	u := r.URL.Query().Get("iam")
+	if !userNameRE.MatchString(u) {
+		http.Error(w, "Names must be 1 to 32 letters, digits, or ._@-", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: userCookie, Value: u, Path: BasePath + "/"})
+	v := *r.URL
+	v.RawQuery = ""
+	http.Redirect(w, r, v.String(), http.StatusFound)
+}
+
+// presence tracks who is looking at what.
+type presence struct {
+	mu   sync.Mutex
+	seen map[string]map[string]sighting // graph path -> user -> sighting
+
+	// Who last saved each node, by graph path and then node name.
+	editors map[string]map[string]string
+}
+
+type sighting struct {
+	node string
+	at   time.Time
+}
+
+var here = &presence{
+	seen:    make(map[string]map[string]sighting),
+	editors: make(map[string]map[string]string),
+}
+
+// observe records that user is viewing node (or the whole graph, if node is
+// empty) of the graph at path, telling listeners if that's news.
+func (p *presence) observe(path, user, node string) {
+	p.mu.Lock()
+	s := p.seen[path]
+	if s == nil {
+		s = make(map[string]sighting)
+		p.seen[path] = s
+	}
+	old, ok := s[user]
+	now := time.Now()
+	s[user] = sighting{node: node, at: now}
+	p.mu.Unlock()
+
+	if !ok || old.node != node || now.Sub(old.at) > PresenceTimeout {
+		Publish(Event{Type: Presence, Graph: path, Name: node, User: user})
+	}
+}
+
+// viewers lists everyone but user recently seen looking at node in the graph
+// at path. If node is empty, it lists everyone looking at any part of it.
+func (p *presence) viewers(path, node, user string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var vs []string
+	for u, s := range p.seen[path] {
+		if u == user || time.Since(s.at) > PresenceTimeout {
+			continue
+		}
+		if node == "" || s.node == node {
+			vs = append(vs, u)
+		}
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+// edited records that user saved node, and returns who saved it before.
+func (p *presence) edited(path, node, user string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.editors[path]
+	if e == nil {
+		e = make(map[string]string)
+		p.editors[path] = e
+	}
+	prev := e[node]
+	e[node] = user
+	return prev
+}
+
+// nodeVersion returns something that changes whenever n does, so editors
+// can tell if someone else has saved it since they opened it.
+func nodeVersion(n *graph.Node) string {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return ""
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:8])
+}
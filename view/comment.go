@@ -0,0 +1,140 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// TODO: Replace these cobbled-together UIs with Polymer or something.
+const commentEditorTemplateSrc = `<head>
+	<title>{{if .Comment.Name}}{{.Comment.Name}}{{else}}[New]{{end}}</title><style>` + css + `</style>
+</head>
+<body>
+	<h1>{{if .Comment.Name}}{{.Comment.Name}}{{else}}[New]{{end}}</h1>
+	<form method="post">
+		<div class="formfield">
+			<label for="Text">Text</label>
+			<textarea name="Text" rows="10" cols="60" required>{{.Comment.Text}}</textarea>
+		</div>
+		<div class="formfield">
+			<label for="Node">Attached to</label>
+			<select name="Node">
+				<option value="">(nothing)</option>
+				{{range .Nodes}}<option value="{{.}}" {{if eq . $.Comment.Node}}selected{{end}}>{{.}}</option>{{end}}
+			</select>
+		</div>
+		<div class="formfield hcentre">
+			<input type="submit" value="Save">
+			<input type="button" value="Return" onclick="window.location.href='?'">
+		</div>
+	</form>
+	{{if .Comment.Name}}<a href="?comment={{.Comment.Name}}&amp;delete">Delete this comment</a>{{end}}
+</body>`
+
+var commentEditorTemplate = template.Must(template.New("commentEditor").Funcs(templateFuncs).Parse(commentEditorTemplateSrc))
+
+func renderCommentEditor(w http.ResponseWriter, g *graph.Graph, c *graph.Comment) error {
+	names := make([]string, 0, len(g.Nodes))
+	for n := range g.Nodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return commentEditorTemplate.Execute(w, &struct {
+		Comment *graph.Comment
+		Nodes   []string
+	}{c, names})
+}
+
+// Comment handles viewing/editing a comment.
+func Comment(g *graph.Graph, name string, w http.ResponseWriter, r *http.Request) {
+	c, found := g.Comments[name]
+	if name != "new" && !found {
+		http.Error(w, fmt.Sprintf("Comment %q not found", name), http.StatusNotFound)
+		return
+	}
+	if c == nil {
+		c = &graph.Comment{Node: r.URL.Query().Get("attach")}
+	}
+
+	if _, del := r.URL.Query()["delete"]; del && found {
+		delete(g.Comments, name)
+		u := *r.URL
+		u.RawQuery = ""
+		http.Redirect(w, r, u.String(), http.StatusFound)
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case "POST":
+		err = handleCommentPost(g, c, w, r)
+	case "GET":
+		err = renderCommentEditor(w, g, c)
+	default:
+		err = fmt.Errorf("unsupported verb %q", r.Method)
+	}
+
+	if err != nil {
+		log.Printf("Could not handle request: %v", err)
+		http.Error(w, "Could not handle request", http.StatusInternalServerError)
+	}
+}
+
+func handleCommentPost(g *graph.Graph, c *graph.Comment, w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	// Validate.
+	txt := strings.TrimSpace(strings.Replace(r.FormValue("Text"), "\r\n", "\n", -1))
+	if txt == "" {
+		return fmt.Errorf(`text is empty [%q == ""]`, txt)
+	}
+	nn := r.FormValue("Node")
+	if _, found := g.Nodes[nn]; nn != "" && !found {
+		return fmt.Errorf("node %q not found", nn)
+	}
+
+	// Update.
+	c.Text = txt
+	c.Node = nn
+
+	if c.Name != "" {
+		return renderCommentEditor(w, g, c)
+	}
+
+	// New comments need a name, and a redirect.
+	if g.Comments == nil {
+		g.Comments = make(map[string]*graph.Comment)
+	}
+	c.Name = g.UniqueCommentName()
+	g.Comments[c.Name] = c
+
+	q := url.Values{"comment": []string{c.Name}}
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	Debugf("redirecting to %v", u)
+	http.Redirect(w, r, u.String(), http.StatusSeeOther) // should cause GET
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// Connect handles connecting two nodes with a new channel, given as
+// ?connect=src&to=dst. It redirects to the editor for the channel.
+func Connect(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	c, err := g.Connect(q.Get("connect"), q.Get("to"))
+	if err != nil {
+		msg := fmt.Sprintf("Could not connect: %v", err)
+		log.Print(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	u := *r.URL
+	u.RawQuery = url.Values{"channel": []string{c.Name}}.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
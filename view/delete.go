@@ -0,0 +1,58 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"html/template"
+	"io"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const deleteConfirmTemplateSrc = `<head>
+	<title>Delete {{.Name}}</title><style>` + css + `</style>
+</head>
+<body>
+	<h1>Delete {{.Name}}?</h1>
+	{{with .Effect -}}
+	{{with .Channels}}<p>These channels are connected to what will be deleted:
+		{{range $i, $c := .}}{{if $i}}, {{end}}<a href="?channel={{$c}}">{{$c}}</a>{{end}}</p>{{end}}
+	{{with .Stranded}}<div class="errors lint"><p>These channels will be left with nothing reading from them, or nothing
+		writing to them, so goroutines using them could block forever:
+		{{range $i, $c := .}}{{if $i}}, {{end}}<a href="?channel={{$c}}">{{$c}}</a>{{end}}</p></div>{{end}}
+	{{with .Nodes}}<div class="errors lint"><p>These goroutines use the channel, and won't build until they are changed:
+		{{range $i, $n := .}}{{if $i}}, {{end}}<a href="?node={{$n}}">{{$n}}</a>{{end}}</p></div>{{end}}
+	{{with .Comments}}<p>These comments will be detached: {{range $i, $c := .}}{{if $i}}, {{end}}<a href="?comment={{$c}}">{{$c}}</a>{{end}}</p>{{end}}
+	{{if not (or .Channels .Nodes .Comments)}}<p>Nothing else will be affected.</p>{{end}}
+	{{- end}}
+	<form method="post">
+		<div class="formfield hcentre">
+			<input type="submit" value="Delete">
+			<a href="{{.Back}}">Cancel</a>
+		</div>
+	</form>
+</body>`
+
+var deleteConfirmTemplate = template.Must(template.New("deleteConfirm").Funcs(templateFuncs).Parse(deleteConfirmTemplateSrc))
+
+// renderDeleteConfirm asks whether to delete the node or channel called name,
+// showing what else that would affect. Confirming POSTs to the same URL; back
+// is where cancelling goes.
+func renderDeleteConfirm(dst io.Writer, name, back string, eff *graph.DeleteEffect) error {
+	return deleteConfirmTemplate.Execute(dst, &struct {
+		Name, Back string
+		Effect     *graph.DeleteEffect
+	}{name, back, eff})
+}
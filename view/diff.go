@@ -0,0 +1,99 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const diffTemplateSrc = `<head>
+	<title>Changes to {{.Graph.Name}}</title><style>` + css + `</style>
+</head>
+<body>
+<h1>Changes to {{.Graph.Name}}</h1>
+<a href="?">Return</a>
+<p>Comparing {{.Before}} with {{.After}}.</p>
+{{with .Diff -}}
+{{if .Empty}}<p>No differences.</p>{{end}}
+{{with .Details}}
+<h2>Properties</h2>
+<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+{{with .Nodes}}
+<h2>Goroutines</h2>
+{{range .}}
+<h3><a href="?node={{.Name}}">{{.Name}}</a> ({{.Change}})</h3>
+{{with .Details}}<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{with .Code}}<pre class="diff">{{range .}}<span class="{{.Kind}}">{{.}}</span>
+{{end}}</pre>{{end}}
+{{end}}
+{{end}}
+{{with .Channels}}
+<h2>Channels</h2>
+<ul>
+	{{range .}}<li><a href="?channel={{.Name}}">{{.Name}}</a> ({{.Change}}){{range .Details}}; {{.}}{{end}}</li>{{end}}
+</ul>
+{{end}}
+{{- end}}
+</body>`
+
+var diffTemplate = template.Must(template.New("diff").Funcs(templateFuncs).Parse(diffTemplateSrc))
+
+// localPath converts a slash-separated path, as in a URL, into a path within
+// the directory being served.
+func localPath(p string) string {
+	return filepath.Join(".", filepath.FromSlash(filepath.Clean("/"+p)))
+}
+
+// Diff handles showing the changes to a graph. By default the graph is compared
+// with its saved file. ?diff=path compares the graph with another file, and
+// ?diff=path1&to=path2 compares two files.
+func Diff(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	before, after := g.SourcePath, "the unsaved version"
+	if p := q.Get("diff"); p != "" {
+		before = localPath(p)
+	}
+	b, err := graph.LoadJSONFile(before)
+	if err != nil {
+		log.Printf("Could not load graph to compare: %v", err)
+		http.Error(w, fmt.Sprintf("Could not load graph to compare: %v", err), http.StatusNotFound)
+		return
+	}
+	a := g
+	if p := q.Get("to"); p != "" {
+		after = localPath(p)
+		if a, err = graph.LoadJSONFile(after); err != nil {
+			log.Printf("Could not load graph to compare: %v", err)
+			http.Error(w, fmt.Sprintf("Could not load graph to compare: %v", err), http.StatusNotFound)
+			return
+		}
+	}
+	d := &struct {
+		Graph         *graph.Graph
+		Before, After string
+		Diff          *graph.GraphDiff
+	}{g, before, after, graph.Diff(b, a)}
+	if err := diffTemplate.Execute(w, d); err != nil {
+		log.Printf("Could not execute diff template: %v", err)
+		http.Error(w, "Could not execute diff template", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// The types of Event.
+const (
+	NodeAdded      = "node_added"
+	NodeRemoved    = "node_removed"
+	NodeRenamed    = "node_renamed"
+	ChannelAdded   = "channel_added"
+	ChannelRemoved = "channel_removed"
+	ChannelRenamed = "channel_renamed"
+	BuildStarted   = "build_started"
+	BuildFinished  = "build_finished"
+	RunStarted     = "run_started"
+	RunFinished    = "run_finished"
+	NodeChanged    = "node_changed"
+	Conflict       = "conflict" // Someone saved over someone else's changes.
+	Presence       = "presence" // Someone is viewing a node (or the graph).
+)
+
+// Event is something that happened to a graph, as sent to /events listeners.
+type Event struct {
+	Type  string    `json:"type"`
+	Graph string    `json:"graph"`          // URL path of the graph.
+	Name  string    `json:"name,omitempty"` // Node or channel concerned.
+	From  string    `json:"from,omitempty"` // Previous name, when renamed.
+	User  string    `json:"user,omitempty"` // Who did it, if known.
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// eventBus passes events to whoever is listening. Slow listeners miss events
+// rather than holding anything up.
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+var events = &eventBus{subs: make(map[chan Event]struct{})}
+
+// Publish sends an event to every /events listener.
+func Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	for c := range events.subs {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+func (b *eventBus) subscribe() chan Event {
+	c := make(chan Event, 64)
+	b.mu.Lock()
+	b.subs[c] = struct{}{}
+	b.mu.Unlock()
+	return c
+}
+
+func (b *eventBus) unsubscribe(c chan Event) {
+	b.mu.Lock()
+	delete(b.subs, c)
+	b.mu.Unlock()
+}
+
+// Events serves a WebSocket which sends every Event, as JSON, to the client.
+// ?graph=path only sends events for the graph at that path.
+var Events = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	only := strings.TrimPrefix(r.URL.Query().Get("graph"), BasePath)
+	conn, rw, done := acceptWebSocket(w, r)
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+
+	c := events.subscribe()
+	defer events.unsubscribe(c)
+	for {
+		var e Event
+		select {
+		case <-done:
+			return
+		case <-closing:
+			return
+		case e = <-c:
+		}
+		if only != "" && e.Graph != only {
+			continue
+		}
+		msg, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("Could not encode event: %v", err)
+			continue
+		}
+		if err := writeTextFrame(rw.Writer, msg); err != nil {
+			return
+		}
+	}
+})
+
+// graphNames is the names of the nodes and channels in a graph at some moment.
+type graphNames struct {
+	nodes, channels map[string]bool
+}
+
+func namesOf(g *graph.Graph) *graphNames {
+	if g == nil {
+		return nil
+	}
+	n := &graphNames{
+		nodes:    make(map[string]bool, len(g.Nodes)),
+		channels: make(map[string]bool, len(g.Channels)),
+	}
+	for k := range g.Nodes {
+		n.nodes[k] = true
+	}
+	for k := range g.Channels {
+		n.channels[k] = true
+	}
+	return n
+}
+
+// publishChanges publishes the nodes and channels added, removed, or renamed
+// between two snapshots of the graph at path. A single removal and addition
+// together is taken to be a rename.
+func publishChanges(path, user string, before, after *graphNames) {
+	if before == nil || after == nil {
+		return
+	}
+	diff := func(before, after map[string]bool, added, removed, renamed string) {
+		var add, rem []string
+		for k := range after {
+			if !before[k] {
+				add = append(add, k)
+			}
+		}
+		for k := range before {
+			if !after[k] {
+				rem = append(rem, k)
+			}
+		}
+		if len(add) == 1 && len(rem) == 1 {
+			Publish(Event{Type: renamed, Graph: path, Name: add[0], From: rem[0], User: user})
+			return
+		}
+		sort.Strings(add)
+		sort.Strings(rem)
+		for _, k := range rem {
+			Publish(Event{Type: removed, Graph: path, Name: k, User: user})
+		}
+		for _, k := range add {
+			Publish(Event{Type: added, Graph: path, Name: k, User: user})
+		}
+	}
+	diff(before.nodes, after.nodes, NodeAdded, NodeRemoved, NodeRenamed)
+	diff(before.channels, after.channels, ChannelAdded, ChannelRemoved, ChannelRenamed)
+}
+
+// graphPath returns the path of the graph a request is for, whether it is
+// for a page or the API, without any BasePath.
+func graphPath(r *http.Request) string {
+	p := strings.TrimPrefix(r.URL.Path, BasePath)
+	if strings.HasPrefix(p, APIPrefix) {
+		return "/" + strings.TrimPrefix(p, APIPrefix)
+	}
+	return p
+}
+
+// errString is err.Error(), or empty if err is nil.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"html/template"
+	"io"
+	"net/url"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const extractTemplateSrc = `<head>
+	<title>Extract subgraph</title><style>` + css + `</style>
+</head>
+<body>
+	<h1>Extract {{len .Nodes}} {{if eq (len .Nodes) 1}}goroutine{{else}}goroutines{{end}} into a subgraph</h1>
+	<p>{{range $i, $n := .Nodes}}{{if $i}}, {{end}}<a href="?node={{$n}}">{{$n}}</a>{{end}}
+		will move into a new graph file, and be replaced here by one goroutine running it.</p>
+	{{with .Plan -}}
+	{{with .Inputs}}<p>Inputs of the new graph: {{range $i, $c := .}}{{if $i}}, {{end}}<a href="?channel={{$c}}">{{$c}}</a>{{end}}</p>{{end}}
+	{{with .Outputs}}<p>Outputs of the new graph: {{range $i, $c := .}}{{if $i}}, {{end}}<a href="?channel={{$c}}">{{$c}}</a>{{end}}</p>{{end}}
+	{{with .Bound}}<p>Also connected to the new graph: {{range $i, $c := .}}{{if $i}}, {{end}}<a href="?channel={{$c}}">{{$c}}</a>{{end}}</p>{{end}}
+	{{with .Internal}}<p>These channels will move into the new graph: {{range $i, $c := .}}{{if $i}}, {{end}}<a href="?channel={{$c}}">{{$c}}</a>{{end}}</p>{{end}}
+	{{- end}}
+	{{with .Error}}<div class="errors"><p>{{.}}</p></div>{{end}}
+	<form method="post">
+		<div class="formfield">
+			<label for="File">Graph file</label>
+			<input type="text" name="File" required placeholder="worker.szgo" value="{{.Form.Get "File"}}">
+			<div class="hint">Relative to this graph. An existing file won't be overwritten.</div>
+		</div>
+		<div class="formfield">
+			<label for="Name">Goroutine name</label>
+			<input type="text" name="Name" placeholder="Named after the file" value="{{.Form.Get "Name"}}">
+		</div>
+		<div class="formfield hcentre">
+			<input type="submit" value="Extract">
+			<a href="?">Cancel</a>
+		</div>
+	</form>
+</body>`
+
+var extractTemplate = template.Must(template.New("extract").Funcs(templateFuncs).Parse(extractTemplateSrc))
+
+// renderExtract asks where to extract the nodes to, showing how their
+// channels would be rewired. Confirming POSTs to the same URL.
+func renderExtract(dst io.Writer, nodes []string, plan *graph.ExtractPlan, form url.Values, msg string) error {
+	return extractTemplate.Execute(dst, &struct {
+		Nodes []string
+		Plan  *graph.ExtractPlan
+		Form  url.Values
+		Error string
+	}{nodes, plan, form, msg})
+}
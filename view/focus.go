@@ -0,0 +1,78 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const focusTemplateSrc = `<head>
+	<title>{{.Node}} in {{.Graph.Name}}</title><style>` + css + `</style>
+</head>
+<body>
+<h1>{{.Node}} in {{.Graph.Name}}</h1>
+<a href="?">Return</a> | <a href="?node={{.Node}}">Edit {{.Node}}</a>
+<form method="get" class="search">
+	<input type="hidden" name="focus" value="{{.Node}}">
+	<label for="depth">Neighbours within</label>
+	<input type="number" name="depth" min="0" max="99" value="{{.Depth}}"> channels
+	<input type="submit" value="Show">
+</form>
+<div id="diagram">{{.Diagram}}</div>
+</body>`
+
+var focusTemplate = template.Must(template.New("focus").Funcs(templateFuncs).Parse(focusTemplateSrc))
+
+// Focus handles showing the diagram of just one node and its neighbours,
+// given as ?focus=node[&depth=N] (depth defaults to 1).
+func Focus(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name, depth := q.Get("focus"), 1
+	if d := q.Get("depth"); d != "" {
+		var err error
+		if depth, err = strconv.Atoi(d); err != nil || depth < 0 {
+			http.Error(w, fmt.Sprintf("Invalid depth %q", d), http.StatusBadRequest)
+			return
+		}
+	}
+	h := g.Neighbourhood(name, depth)
+	if h == nil {
+		http.Error(w, fmt.Sprintf("Node %q not found", name), http.StatusNotFound)
+		return
+	}
+	var svg bytes.Buffer
+	if err := renderDiagram(&svg, h); err != nil {
+		log.Printf("Could not render diagram: %v", err)
+		http.Error(w, fmt.Sprintf("Could not render diagram: %v", err), http.StatusInternalServerError)
+		return
+	}
+	d := &struct {
+		Graph   *graph.Graph
+		Node    string
+		Depth   int
+		Diagram template.HTML
+	}{g, name, depth, template.HTML(svg.String())}
+	if err := focusTemplate.Execute(w, d); err != nil {
+		log.Printf("Could not execute focus template: %v", err)
+		http.Error(w, "Could not execute focus template", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"sort"
+	"strings"
+)
+
+// formErrors maps the fields of a submitted form to what is wrong with them,
+// so the form can be shown again with the values as submitted, and the
+// problems next to them.
+type formErrors map[string]string
+
+func (e formErrors) Error() string {
+	fs := make([]string, 0, len(e))
+	for f := range e {
+		fs = append(fs, f)
+	}
+	sort.Strings(fs)
+	for i, f := range fs {
+		fs[i] = f + ": " + e[f]
+	}
+	return strings.Join(fs, "; ")
+}
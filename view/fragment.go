@@ -0,0 +1,113 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const pasteTemplateSrc = `<head>
+	<title>Paste into {{.Graph.Name}}</title><style>` + css + `</style>
+</head>
+<body>
+	<h1>Paste into {{.Graph.Name}}</h1>
+	<p>Paste goroutines and channels copied from this or any other graph. Names that
+		are already taken get a number added.</p>
+	{{with .Error}}<div class="errors"><p>{{.}}</p></div>{{end}}
+	<form method="post">
+		<div class="formfield"><textarea name="fragment" rows="20" cols="80" required>{{.Fragment}}</textarea></div>
+		<div class="formfield hcentre">
+			<input type="submit" value="Paste">
+			<a href="?">Cancel</a>
+		</div>
+	</form>
+</body>`
+
+var pasteTemplate = template.Must(template.New("paste").Funcs(templateFuncs).Parse(pasteTemplateSrc))
+
+// Copy handles ?copy&node=a&node=b&channel=c, responding with the JSON of a
+// fragment of the graph containing those nodes and channels (and the
+// channels the nodes use), ready to paste into any graph.
+func Copy(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, err := g.Fragment(q["node"], q["channel"])
+	if err != nil {
+		apiFail(w, http.StatusNotFound, "could not copy: %v", err)
+		return
+	}
+	apiRespond(w, http.StatusOK, f)
+}
+
+// Paste handles ?paste. POSTing fragment JSON (as from Copy) as the body
+// pastes it, responding with the names the nodes and channels were given.
+// Otherwise it shows a form to paste into, which returns to the graph.
+func Paste(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method == "POST" && ct == "application/json" {
+		f := new(graph.Fragment)
+		if err := json.NewDecoder(r.Body).Decode(f); err != nil {
+			apiFail(w, http.StatusBadRequest, "could not decode fragment: %v", err)
+			return
+		}
+		nodes, channels, err := g.Paste(f)
+		if err != nil {
+			apiFail(w, http.StatusBadRequest, "could not paste: %v", err)
+			return
+		}
+		apiRespond(w, http.StatusCreated, map[string]map[string]string{
+			"nodes":    nodes,
+			"channels": channels,
+		})
+		return
+	}
+
+	var src, msg string
+	if r.Method == "POST" {
+		src = r.FormValue("fragment")
+		f := new(graph.Fragment)
+		err := json.NewDecoder(strings.NewReader(src)).Decode(f)
+		if err == nil {
+			_, _, err = g.Paste(f)
+		}
+		if err == nil {
+			u := *r.URL
+			u.RawQuery = ""
+			http.Redirect(w, r, u.String(), http.StatusSeeOther) // should cause GET
+			return
+		}
+		msg = fmt.Sprintf("Could not paste: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := renderPaste(w, g, src, msg); err != nil {
+		log.Printf("Could not render paste form: %v", err)
+		http.Error(w, fmt.Sprintf("Could not render paste form: %v", err), http.StatusInternalServerError)
+	}
+}
+
+func renderPaste(dst io.Writer, g *graph.Graph, src, msg string) error {
+	return pasteTemplate.Execute(dst, &struct {
+		Graph           *graph.Graph
+		Fragment, Error string
+	}{g, src, msg})
+}
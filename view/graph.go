@@ -17,10 +17,13 @@ package view
 import (
 	"bytes"
 	"fmt"
+	"go/parser"
+	"go/token"
 	"html/template"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/shenzhen-go/graph"
 )
@@ -31,16 +34,352 @@ const (
 </head>
 <body>
 <h1>{{$.Graph.Name}}</h1>
+{{if $.Previewing -}}
+<div class="errors">
+	Previewing: your edits are only visible to you until you
+	<form method="post" action="?preview=apply" style="display:inline"><input type="submit" value="apply"></form> or
+	<form method="post" action="?preview=discard" style="display:inline"><input type="submit" value="discard"></form> them.
+	<a href="?shared">Show the shared version</a>
+</div>
+{{- end}}
 <div>
 	<a href="?props">Properties</a> | 
 	<a href="?save">Save</a> | 
-	<a href="?build">Build</a> | 
-	<a href="?run">Run</a> | 
-	New: <a href="?node=new">Goroutine</a> <a href="?channel=new">Channel</a> | 
-	View as: <a href="?go">Go</a> <a href="?dot">Dot</a> <a href="?json">JSON</a>
-	<br><br>
-	{{$.Diagram}}
+	<a href="?diff">Changes</a> | 
+	<a href="?stats">Statistics</a> | 
+	<a href="?report">Report</a> | 
+	<a href="?publish">Publish as a part</a> | 
+	{{if not $.Previewing}}<form method="post" action="?preview=start" style="display:inline"><input type="submit" value="Preview edits privately"></form> | {{end}}
+	{{if $.AllowBuild}}<a href="?build">Build</a> | 
+	<a href="?run">Run</a> | {{end}}
+	<a href="?simulate">Simulate</a> | 
+	<a href="?steps">Step through</a> | 
+	<a href="?scenarios">Scenarios</a> | 
+	New: <a href="?node=new">Goroutine</a> <a href="?node=new&amp;PartType=Subgraph">Subgraph</a> <a href="?channel=new">Channel</a> <a href="?comment=new">Comment</a>
+	<a href="#" id="quickaddlink" title="Or press /">Quick add</a>
+	<a href="?paste" title="Or press Ctrl-V">Paste</a> | 
+	All: <a href="?nodes">Goroutines</a> <a href="?channels">Channels</a> | 
+	View as: <a href="?go">Go</a> <a href="?dot">Dot</a> <a href="?json">JSON</a> <a href="?mermaid">Mermaid</a> <a href="?plantuml">PlantUML</a> | 
+	Edge labels: {{if $.Graph.HideEdgeLabels}}<form method="post" action="?edgelabels=show" style="display:inline"><input type="submit" value="Show"></form>{{else}}<form method="post" action="?edgelabels=hide" style="display:inline"><input type="submit" value="Hide"></form>{{end}}
+	{{- if $.Graph.Positioned}} | <a href="?unpin">Unpin all goroutines</a>{{end}} | 
+	Theme: {{range $.Themes}}{{if eq . $.Graph.Theme.Name}}{{.}}{{else}}<a href="?theme={{.}}">{{.}}</a>{{end}} {{end}}
+	<form method="get" class="search">
+		<select name="image">
+			<option value="png">PNG</option>
+			<option value="pdf">PDF</option>
+			<option value="svg">SVG</option>
+		</select>
+		<select name="fit">
+			<option value="">Actual size</option>
+			<option value="doc">Fit to a page</option>
+			<option value="slides">Fit to a slide</option>
+		</select>
+		<input type="submit" value="Export diagram">
+	</form>
+	<form method="get" class="search">
+		You are <input type="text" name="iam" value="{{$.User}}" size="12" title="Change your name">
+		{{- with $.Viewers}}; also here: {{range $i, $v := .}}{{if $i}}, {{end}}{{$v}}{{end}}{{end}}
+	</form>
+	<form method="get" class="search">
+		<input type="text" name="search" placeholder="Search goroutines and channels">
+	</form>
+	<div id="diagram">{{$.Diagram}}</div>
+</div>
+<form id="selection" class="selection" method="post" action="?bulk" style="display:none">
+	<span class="nodes"></span>
+	<strong class="count"></strong>
+	<button name="bulk" value="delete" formmethod="get">Delete</button> |
+	<select name="Wait">
+		<option value="on">Wait</option>
+		<option value="">Don't wait</option>
+	</select>
+	<button name="bulk" value="wait">Set</button> |
+	<input type="text" name="Multiplicity" size="3" placeholder="×N" title="Multiplicity">
+	<button name="bulk" value="multiplicity">Set</button> |
+	<input type="text" name="Group" size="10" placeholder="Group" list="groups">
+	<datalist id="groups">{{range $.Graph.GroupNames}}<option value="{{.}}">{{end}}</datalist>
+	<button name="bulk" value="group">Set</button> |
+	<button name="bulk" value="extract" formmethod="get">Extract to subgraph</button> |
+	<a href="#" class="clear">Clear</a>
+</form>
+<div id="quickadd" class="palette" style="display:none">
+	<input type="text" placeholder="Part type or snippet" autocomplete="off">
+	<div class="hint"></div>
+	<ul></ul>
+</div>
+<script>
+// nodeName returns the name of the goroutine drawn by an element of the
+// diagram, or null.
+function nodeName(el) {
+	var node = el.closest('g.node');
+	var a = node && (node.querySelector('a') || node.closest('a'));
+	if (!a) return null;
+	var href = a.getAttributeNS('http://www.w3.org/1999/xlink', 'href') || a.getAttribute('href') || '';
+	return new URLSearchParams(href.replace(/^\?/, '')).get('node');
+}
+
+// Show changes to the graph (e.g. from other tabs) as they happen.
+(function() {
+	if (!window.WebSocket) return;
+	var u = new URL('?live', location.href);
+	u.protocol = u.protocol.replace('http', 'ws');
+	new WebSocket(u.href).onmessage = function(e) {
+		document.getElementById('diagram').innerHTML = e.data;
+	};
+})();
+
+// Drag goroutines to pin them in place.
+(function() {
+	var div = document.getElementById('diagram'), drag = null, moved = false;
+	function point(e, frame) {
+		var p = (frame.ownerSVGElement || frame).createSVGPoint();
+		p.x = e.clientX;
+		p.y = e.clientY;
+		return p.matrixTransform(frame.getScreenCTM().inverse());
+	}
+	div.addEventListener('mousedown', function(e) {
+		var name = nodeName(e.target);
+		if (!name || e.altKey) return;
+		var node = e.target.closest('g.node');
+		var frame = node.ownerSVGElement.querySelector('g.graph') || node.ownerSVGElement;
+		var box = node.getBBox();
+		drag = {node: node, name: name, frame: frame, start: point(e, frame), dx: 0, dy: 0,
+			cx: box.x + box.width/2, cy: box.y + box.height/2};
+		moved = false;
+		e.preventDefault();
+	});
+	document.addEventListener('mousemove', function(e) {
+		if (!drag) return;
+		var p = point(e, drag.frame);
+		drag.dx = p.x - drag.start.x;
+		drag.dy = p.y - drag.start.y;
+		moved = moved || Math.abs(drag.dx) + Math.abs(drag.dy) > 3;
+		drag.node.setAttribute('transform', 'translate(' + drag.dx + ',' + drag.dy + ')');
+	});
+	document.addEventListener('mouseup', function() {
+		var d = drag;
+		drag = null;
+		if (!d || !moved) return;
+		// The diagram has y downwards; positions have y upwards.
+		var q = new URLSearchParams({move: d.name, x: d.cx + d.dx, y: -(d.cy + d.dy)});
+		fetch('?' + q, {method: 'POST'}).then(function() { location.reload(); });
+	});
+	// Don't follow the link of a goroutine that was just dragged.
+	div.addEventListener('click', function(e) {
+		if (moved) {
+			e.preventDefault();
+			moved = false;
+		}
+	}, true);
+})();
+
+// selection returns the names of the selected goroutines, most recently
+// selected last.
+function selection() {
+	try {
+		var sel = JSON.parse(sessionStorage.getItem('selected:' + location.pathname));
+		return Array.isArray(sel) ? sel : [];
+	} catch (e) {
+		return [];
+	}
+}
+
+// Add goroutines from the keyboard: / opens a palette of part types and
+// snippets. Alt-click a goroutine to select it, and what is added is
+// connected from it. Shift-Alt-click selects several, to change together.
+(function() {
+	var div = document.getElementById('diagram'), pal = document.getElementById('quickadd');
+	var input = pal.querySelector('input'), hint = pal.querySelector('.hint'), list = pal.querySelector('ul');
+	var bar = document.getElementById('selection');
+	var key = 'selected:' + location.pathname, matches = [], cur = 0, timer;
+	var selected = function() { return selection().slice(-1)[0] || null; };
+	var mark = function() {
+		var sel = selection();
+		div.querySelectorAll('g.node').forEach(function(n) {
+			n.classList.toggle('selected', sel.indexOf(nodeName(n)) >= 0);
+		});
+		var nodes = bar.querySelector('.nodes');
+		nodes.textContent = '';
+		sel.forEach(function(name) {
+			var i = document.createElement('input');
+			i.type = 'hidden';
+			i.name = 'node';
+			i.value = name;
+			nodes.appendChild(i);
+		});
+		bar.querySelector('.count').textContent = sel.length == 1 ? sel[0] + ':' : sel.length + ' goroutines:';
+		bar.style.display = sel.length > 0 ? '' : 'none';
+	};
+	var setSelection = function(sel) {
+		if (sel.length > 0) {
+			sessionStorage.setItem(key, JSON.stringify(sel));
+		} else {
+			sessionStorage.removeItem(key);
+		}
+		mark();
+	};
+	var select = function(name) { setSelection(name ? [name] : []); };
+	div.addEventListener('click', function(e) {
+		var name = e.altKey && nodeName(e.target);
+		if (!name) return;
+		e.preventDefault();
+		var sel = selection(), i = sel.indexOf(name);
+		if (e.shiftKey) {
+			if (i >= 0) {
+				sel.splice(i, 1);
+			} else {
+				sel.push(name);
+			}
+			setSelection(sel);
+			return;
+		}
+		select(sel.length == 1 && i == 0 ? null : name);
+	}, true);
+	bar.querySelector('.clear').onclick = function() {
+		select(null);
+		return false;
+	};
+	bar.addEventListener('submit', function(e) {
+		// Deleted and extracted goroutines will be gone.
+		if (e.submitter && /^(delete|extract)$/.test(e.submitter.value)) sessionStorage.removeItem(key);
+	});
+	// Live updates replace the diagram.
+	new MutationObserver(mark).observe(div, {childList: true});
+	mark();
+
+	var show = function() {
+		list.textContent = '';
+		matches.forEach(function(m, i) {
+			var li = document.createElement('li');
+			li.textContent = m.label + (m.kind == 'snippet' ? ' (snippet)' : '');
+			li.title = m.description || '';
+			if (i == cur) li.className = 'selected';
+			li.onclick = function() {
+				cur = i;
+				add();
+			};
+			list.appendChild(li);
+		});
+	};
+	var search = function() {
+		fetch('?quickadd=' + encodeURIComponent(input.value)).then(function(r) { return r.json(); }).then(function(ms) {
+			matches = ms;
+			cur = 0;
+			show();
+		});
+	};
+	var open = function() {
+		hint.textContent = selected() ? 'Connected from ' + selected() : 'Alt-click a goroutine to connect from it';
+		pal.style.display = '';
+		input.value = '';
+		input.focus();
+		search();
+	};
+	var add = function() {
+		var m = matches[cur];
+		if (!m) return;
+		var body = new URLSearchParams({kind: m.kind, name: m.name, from: selected() || ''});
+		fetch('?quickadd', {method: 'POST', body: body}).then(function(r) {
+			return r.json().then(function(j) {
+				if (!r.ok) {
+					hint.textContent = j.error.message;
+					return;
+				}
+				// Select the new goroutine, ready to add the next.
+				select(j.name);
+				location.reload();
+			});
+		});
+	};
+	document.getElementById('quickaddlink').onclick = function() {
+		open();
+		return false;
+	};
+	document.addEventListener('keydown', function(e) {
+		if (e.key != '/' || pal.style.display != 'none' || /^(INPUT|TEXTAREA|SELECT)$/.test(e.target.tagName)) return;
+		e.preventDefault();
+		open();
+	});
+	input.addEventListener('keydown', function(e) {
+		switch (e.key) {
+		case 'ArrowDown':
+			cur = Math.min(cur+1, matches.length-1);
+			show();
+			break;
+		case 'ArrowUp':
+			cur = Math.max(cur-1, 0);
+			show();
+			break;
+		case 'Enter':
+			add();
+			break;
+		case 'Escape':
+			pal.style.display = 'none';
+			break;
+		default:
+			return;
+		}
+		e.preventDefault();
+	});
+	input.addEventListener('input', function() {
+		clearTimeout(timer);
+		timer = setTimeout(search, 150);
+	});
+})();
+
+// Copy and paste through the clipboard: Ctrl-C copies the selected goroutines
+// (with their channels) as JSON, and Ctrl-V pastes JSON copied from any graph.
+(function() {
+	if (!navigator.clipboard) return;
+	document.addEventListener('keydown', function(e) {
+		if (!(e.ctrlKey || e.metaKey) || /^(INPUT|TEXTAREA|SELECT)$/.test(e.target.tagName)) return;
+		if (window.getSelection().toString() != '') return;
+		switch (e.key) {
+		case 'c':
+			var sel = selection();
+			if (sel.length == 0) return;
+			e.preventDefault();
+			var q = sel.map(function(name) { return 'node=' + encodeURIComponent(name); }).join('&');
+			fetch('?copy&' + q).then(function(r) { return r.text(); }).then(function(t) {
+				return navigator.clipboard.writeText(t);
+			});
+			break;
+		case 'v':
+			e.preventDefault();
+			navigator.clipboard.readText().then(function(t) {
+				return fetch('?paste', {method: 'POST', headers: {'Content-Type': 'application/json'}, body: t});
+			}).then(function(r) {
+				return r.json().then(function(j) {
+					if (!r.ok) {
+						alert(j.error.message);
+						return;
+					}
+					location.reload();
+				});
+			});
+			break;
+		}
+	});
+})();
+</script>
+{{with $.Diagnostics -}}
+<div class="diagnostics">
+	<h2>Problems</h2>
+	<ul>
+		{{range . -}}
+		<li class="{{.Severity}}">{{.Severity}}:
+			{{if .Node}}<a href="?node={{.Node}}">{{.Node}}</a>:{{end}}
+			{{if .Channel}}<a href="?channel={{.Channel}}">{{.Channel}}</a>:{{end}}
+			{{.Msg}}
+			{{if .Delete -}}
+			{{if .Node}}[<a href="?node={{.Node}}&amp;delete">delete</a>]{{end}}
+			{{if .Channel}}[<a href="?channel={{.Channel}}&amp;delete">delete</a>]{{end}}
+			{{- end}}
+		</li>
+		{{- end}}
+	</ul>
 </div>
+{{- end}}
 </body>`
 
 	// TODO: Replace these cobbled-together UIs with Polymer or something.
@@ -66,6 +405,43 @@ const (
 				{{- range .Imports}}{{.}}{{"\n"}}{{end -}}
 			</textarea>
 		</div>
+		<div class="formfield">
+		    <label for="Params">Parameters</label>
+			<textarea name="Params" rows="5" cols="36" placeholder="type T = int">
+				{{- range .Params}}{{.}}{{"\n"}}{{end -}}
+			</textarea>
+		</div>
+		<div class="formfield">
+		    <label for="Declarations">Declarations</label>
+			<textarea name="Declarations" rows="10" cols="80" placeholder="Types, constants, variables, and functions shared by goroutines">
+				{{- .Declarations -}}
+			</textarea>
+		</div>
+		<div class="formfield">
+		    <label for="Termination">Run waits for</label>
+			<select name="Termination">
+				{{range terminations}}<option value="{{.Value}}" {{if eq .Value $.Termination}}selected{{end}}>{{.Description}}</option>{{end}}
+			</select>
+			<div class="hint">Unless it waits for the goroutines marked Wait, Run also closes channels nothing else closes, once everything writing to them has finished.</div>
+		</div>
+		<div class="formfield">
+		    <label for="Logging">Logging</label>
+			<select name="Logging">
+				{{range logLevels}}<option value="{{.Value}}" {{if eq .Value $.Logging}}selected{{end}}>{{.Description}}</option>{{end}}
+			</select>
+			<div class="hint">Goroutines can log with <code>logger</code>, a <code>*slog.Logger</code>. The generated <code>-log_level</code> flag changes the level.</div>
+		</div>
+		<div class="formfield">
+		    <label for="DeadLetters">Dead-letter channel</label>
+			<input name="DeadLetters" type="text" placeholder="None, e.g. deadLetters" value="{{.DeadLetters}}">
+			<div class="hint">Goroutines can give up on items with <code>deadLetter(item, err)</code>, which sends a <code>DeadLetter</code> to this channel. It is made if it doesn't exist; read it with a Dead letter file part to keep them.</div>
+		</div>
+		{{range .GroupNames -}}
+		<div class="formfield">
+			<label for="GroupColor.{{.}}">Group "{{.}}" colour</label>
+			<input name="GroupColor.{{.}}" type="color" value="{{($.Group .).Color}}">
+		</div>
+		{{end -}}
 		<div class="formfield hcentre">
 		    <input type="submit" value="Save">
 			<input type="button" value="Return" onclick="window.location.href='?'">
@@ -76,15 +452,22 @@ const (
 )
 
 var (
-	graphEditorTemplate     = template.Must(template.New("graphEditor").Parse(graphEditorTemplateSrc))
-	graphPropertiesTemplate = template.Must(template.New("graphProperties").Parse(graphPropertiesTemplateSrc))
+	graphEditorTemplate     = template.Must(template.New("graphEditor").Funcs(templateFuncs).Parse(graphEditorTemplateSrc))
+	graphPropertiesTemplate = template.Must(template.New("graphProperties").Funcs(templateFuncs).Parse(graphPropertiesTemplateSrc))
 )
 
+// AllowBuild enables building and running graphs. Since that runs whatever
+// code is in them, it should be off when strangers can reach the server.
+var AllowBuild = true
+
 // Graph handles displaying/editing a graph.
 func Graph(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
-	log.Printf("%s graph: %s", r.Method, r.URL)
+	noteGraph(w, g)
 	q := r.URL.Query()
 
+	// Pick up any subgraphs added or changed since the last request.
+	g.LoadSubgraphs()
+
 	if _, t := q["props"]; t {
 		if err := handlePropsRequest(g, w, r); err != nil {
 			log.Printf("Could not execute graph properties editor template: %v", err)
@@ -101,11 +484,47 @@ func Graph(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if _, t := q["json"]; t {
+		if r.Method == "POST" {
+			UploadJSON(g, w, r)
+			return
+		}
 		outputJSON(g, w)
 		return
 	}
-	if _, t := q["build"]; t {
-		if err := g.Build(); err != nil {
+	if _, t := q["mermaid"]; t {
+		outputMermaid(g, w)
+		return
+	}
+	if _, t := q["plantuml"]; t {
+		outputPlantUML(g, w)
+		return
+	}
+	if _, t := q["fuzz"]; t {
+		outputFuzzTest(g, w, q.Get("fuzz"))
+		return
+	}
+	_, build := q["build"]
+	_, run := q["run"]
+	if (build || run) && !AllowBuild {
+		http.Error(w, "Building and running are disabled on this server", http.StatusForbidden)
+		return
+	}
+	if build || run {
+		// Others may edit the graph while it builds and runs.
+		var err error
+		if g, err = detachGraph(g, r); err != nil {
+			log.Printf("Could not copy graph: %v", err)
+			http.Error(w, fmt.Sprintf("Could not copy graph: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if build {
+		Publish(Event{Type: BuildStarted, Graph: graphPath(r), User: userOf(r)})
+		start := time.Now()
+		err := g.Build()
+		stats.built(err, time.Since(start))
+		Publish(Event{Type: BuildFinished, Graph: graphPath(r), User: userOf(r), Error: errString(err)})
+		if err != nil {
 			w.Header().Set("Content-Type", "text/plain")
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, "Error building:\n%v", err)
@@ -116,15 +535,24 @@ func Graph(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, u.String(), http.StatusFound)
 		return
 	}
-	if _, t := q["run"]; t {
+	if run {
 		w.Header().Set("Content-Type", "text/plain")
-		if err := g.Run(w, w); err != nil {
+		Publish(Event{Type: RunStarted, Graph: graphPath(r), User: userOf(r)})
+		done := stats.startRun()
+		err := g.RunContext(runCtx, w, w)
+		done(err)
+		Publish(Event{Type: RunFinished, Graph: graphPath(r), User: userOf(r), Error: errString(err)})
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, "Error building or running:\n%v", err)
 		}
 		return
 	}
 	if _, t := q["save"]; t {
+		if previewing(r) {
+			http.Error(w, "Apply or discard the preview before saving", http.StatusConflict)
+			return
+		}
 		if err := g.SaveJSONFile(); err != nil {
 			log.Printf("Failed to save JSON file: %v", err)
 		}
@@ -133,6 +561,117 @@ func Graph(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, u.String(), http.StatusFound)
 		return
 	}
+	if v := q.Get("edgelabels"); v != "" {
+		if r.Method != "POST" {
+			http.Error(w, "Edge labels are shown or hidden by POSTing", http.StatusMethodNotAllowed)
+			return
+		}
+		g.HideEdgeLabels = (v == "hide")
+		u := *r.URL
+		u.RawQuery = ""
+		http.Redirect(w, r, u.String(), http.StatusFound)
+		return
+	}
+	if _, t := q["scratch"]; t {
+		Scratch(g, w, r)
+		return
+	}
+	if _, t := q["steps"]; t {
+		Stepper(g, w, r)
+		return
+	}
+	if _, t := q["scenarios"]; t {
+		Scenarios(g, w, r)
+		return
+	}
+	if _, t := q["scenario"]; t {
+		Scenario(g, w, r)
+		return
+	}
+	if _, t := q["simulate"]; t {
+		Simulate(g, w, r)
+		return
+	}
+	if _, t := q["live"]; t {
+		Live(g, w, r)
+		return
+	}
+	if _, t := q["image"]; t {
+		Image(g, w, r)
+		return
+	}
+	if _, t := q["nodes"]; t {
+		Nodes(g, w, r)
+		return
+	}
+	if _, t := q["channels"]; t {
+		Channels(g, w, r)
+		return
+	}
+	if _, t := q["iam"]; t {
+		SetUser(w, r)
+		return
+	}
+	if _, t := q["theme"]; t {
+		SetTheme(w, r)
+		return
+	}
+	if _, t := q["move"]; t {
+		Move(g, w, r)
+		return
+	}
+	if _, t := q["unpin"]; t {
+		Unpin(g, w, r)
+		return
+	}
+	if _, t := q["focus"]; t {
+		Focus(g, w, r)
+		return
+	}
+	if _, t := q["report"]; t {
+		Report(g, w, r)
+		return
+	}
+	if _, t := q["publish"]; t {
+		PublishMacro(g, w, r)
+		return
+	}
+	if _, t := q["validate"]; t {
+		Validate(g, w, r)
+		return
+	}
+	if _, t := q["stats"]; t {
+		Stats(g, w, r)
+		return
+	}
+	if _, t := q["diff"]; t {
+		Diff(g, w, r)
+		return
+	}
+	if _, t := q["search"]; t {
+		Search(g, w, r)
+		return
+	}
+	if _, t := q["connect"]; t {
+		Connect(g, w, r)
+		return
+	}
+	if _, t := q["quickadd"]; t {
+		QuickAdd(g, w, r)
+		return
+	}
+	if _, t := q["bulk"]; t {
+		Bulk(g, w, r)
+		return
+	}
+	if _, t := q["copy"]; t {
+		Copy(g, w, r)
+		return
+	}
+	if _, t := q["paste"]; t {
+		Paste(g, w, r)
+		return
+	}
 	if n := q["node"]; len(n) == 1 {
 		Node(g, n[0], w, r)
 		return
@@ -141,24 +680,35 @@ func Graph(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
 		Channel(g, n[0], w, r)
 		return
 	}
-
-	var dot, svg bytes.Buffer
-	if err := g.WriteDotTo(&dot); err != nil {
-		log.Printf("Could not render to dot: %v", err)
-		http.Error(w, "Could not render to dot", http.StatusInternalServerError)
+	if n := q["comment"]; len(n) == 1 {
+		Comment(g, n[0], w, r)
 		return
 	}
-	if err := dotToSVG(&svg, &dot); err != nil {
-		log.Printf("Could not render dot to SVG: %v", err)
-		http.Error(w, "Could not render dot to SVG", http.StatusInternalServerError)
+
+	var svg bytes.Buffer
+	if err := renderDiagram(&svg, g); err != nil {
+		log.Printf("Could not render diagram: %v", err)
+		http.Error(w, fmt.Sprintf("Could not render diagram: %v", err), http.StatusInternalServerError)
 		return
 	}
 	d := &struct {
-		Diagram template.HTML
-		Graph   *graph.Graph
+		Diagram     template.HTML
+		Graph       *graph.Graph
+		Diagnostics []graph.Diagnostic
+		Themes      []string
+		User        string
+		Viewers     []string
+		AllowBuild  bool
+		Previewing  bool
 	}{
-		Diagram: template.HTML(svg.String()),
-		Graph:   g,
+		Diagram:     template.HTML(svg.String()),
+		Graph:       g,
+		Diagnostics: g.Check(),
+		Themes:      graph.ThemeNames(),
+		User:        userOf(r),
+		Viewers:     here.viewers(graphPath(r), "", userOf(r)),
+		AllowBuild:  AllowBuild,
+		Previewing:  previewing(r),
 	}
 	if err := graphEditorTemplate.Execute(w, d); err != nil {
 		log.Printf("Could not execute graph editor template: %v", err)
@@ -204,10 +754,80 @@ func handlePropsPost(g *graph.Graph, w http.ResponseWriter, r *http.Request) err
 	}
 	imps = imps[:i]
 
+	var params []*graph.Param
+	for _, l := range strings.Split(r.FormValue("Params"), "\n") {
+		if l = strings.TrimSpace(l); l == "" {
+			continue
+		}
+		p, err := graph.ParseParam(l)
+		if err != nil {
+			return fmt.Errorf("parameter %q: %v", l, err)
+		}
+		params = append(params, p)
+	}
+
+	term := r.FormValue("Termination")
+	valid := false
+	for _, t := range graph.Terminations {
+		valid = valid || t.Value == term
+	}
+	if !valid {
+		return fmt.Errorf("unknown termination %q", term)
+	}
+
+	dl := strings.TrimSpace(r.FormValue("DeadLetters"))
+	if dl != "" && !token.IsIdentifier(dl) {
+		return fmt.Errorf("dead-letter channel %q is not a Go identifier", dl)
+	}
+
+	logging := r.FormValue("Logging")
+	valid = false
+	for _, l := range graph.LogLevels {
+		valid = valid || l.Value == logging
+	}
+	if !valid {
+		return fmt.Errorf("unknown log level %q", logging)
+	}
+
+	decls := strings.TrimSpace(strings.Replace(r.FormValue("Declarations"), "\r\n", "\n", -1))
+	if _, err := parser.ParseFile(token.NewFileSet(), "declarations", "package p\n"+decls, 0); err != nil {
+		return fmt.Errorf("declarations: %v", err)
+	}
+
+	colors := make(map[string]string)
+	for _, gn := range g.GroupNames() {
+		c := strings.TrimSpace(r.FormValue("GroupColor." + gn))
+		if c == "" {
+			continue
+		}
+		if !graph.ValidColor(c) {
+			http.Error(w, fmt.Sprintf("Group %q colour %q is not #rrggbb or a colour name", gn, c), http.StatusBadRequest)
+			return nil
+		}
+		colors[gn] = c
+	}
+
 	// Update.
 	g.Name = nm
 	g.PackagePath = pp
 	g.Imports = imps
+	g.Params = params
+	g.Declarations = decls
+	g.Termination = term
+	g.Logging = logging
+	g.DeadLetters = dl
+	if _, found := g.Channels[dl]; dl != "" && !found {
+		g.Channels[dl] = &graph.Channel{Name: dl, Type: graph.DeadLetterType}
+	}
+	// Capacities can depend on the parameters and declarations. Any that
+	// no longer evaluate are reported by Check.
+	g.RefreshCaps()
+	for gn, c := range colors {
+		if g.Groups == nil {
+			g.Groups = make(map[string]*graph.Group)
+		}
+		g.Groups[gn] = &graph.Group{Name: gn, Color: c}
+	}
 
 	return graphPropertiesTemplate.Execute(w, g)
 }
@@ -230,6 +850,40 @@ func outputGoSrc(g *graph.Graph, w http.ResponseWriter) {
 	}
 }
 
+// outputFuzzTest writes the fuzz test of the node (see
+// graph.WriteFuzzTestTo), which goes with the Go of the graph of just the
+// node (see graph.Fuzz).
+func outputFuzzTest(g *graph.Graph, w http.ResponseWriter, node string) {
+	if n := g.Nodes[node]; n == nil || !g.Fuzzable(n) {
+		http.Error(w, fmt.Sprintf("%q isn't a goroutine reading only strings or byte slices", node), http.StatusNotFound)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/golang")
+	if err := g.WriteFuzzTestTo(w, node); err != nil {
+		log.Printf("Could not write fuzz test: %v", err)
+		http.Error(w, "Could not write fuzz test", http.StatusInternalServerError)
+	}
+}
+
+func outputMermaid(g *graph.Graph, w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	if err := g.WriteMermaidTo(w); err != nil {
+		log.Printf("Could not render to Mermaid: %v", err)
+		http.Error(w, "Could not render to Mermaid", http.StatusInternalServerError)
+	}
+}
+
+func outputPlantUML(g *graph.Graph, w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	if err := g.WritePlantUMLTo(w); err != nil {
+		log.Printf("Could not render to PlantUML: %v", err)
+		http.Error(w, "Could not render to PlantUML", http.StatusInternalServerError)
+	}
+}
+
 func outputJSON(g *graph.Graph, w http.ResponseWriter) {
 	h := w.Header()
 	h.Set("Content-Type", "application/json")
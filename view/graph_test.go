@@ -0,0 +1,105 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+func TestPropsGroupColor(t *testing.T) {
+	src := strings.Replace(testGraphJSON, `"name": "gen",`, `"name": "gen", "group": "g",`, 1)
+	ts := serveGraphs(t, map[string]string{"test.szgo": src})
+
+	post := func(color string) int {
+		t.Helper()
+		resp, err := ts.Client().PostForm(ts.URL+"/test.szgo?props", url.Values{
+			"Name":         {"test"},
+			"PackagePath":  {"example.com/test"},
+			"Imports":      {"fmt"},
+			"Termination":  {graph.Terminations[0].Value},
+			"Logging":      {graph.LogLevels[0].Value},
+			"GroupColor.g": {color},
+		})
+		if err != nil {
+			t.Fatalf("POST ?props = %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, c := range []string{"#12ab34", "lavender"} {
+		if code := post(c); code != http.StatusOK {
+			t.Errorf("POST ?props with colour %q status = %d, want %d", c, code, http.StatusOK)
+		}
+	}
+	bad := `red"; label="oops`
+	if code := post(bad); code != http.StatusBadRequest {
+		t.Errorf("POST ?props with colour %q status = %d, want %d", bad, code, http.StatusBadRequest)
+	}
+
+	resp, err := ts.Client().Get(ts.URL + "/test.szgo?dot")
+	if err != nil {
+		t.Fatalf("GET ?dot = %v", err)
+	}
+	defer resp.Body.Close()
+	dot, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading ?dot = %v", err)
+	}
+	if !strings.Contains(string(dot), `"lavender"`) || strings.Contains(string(dot), "oops") {
+		t.Errorf("GET ?dot = %s, want the group filled lavender", dot)
+	}
+}
+
+func TestEdgeLabelsPostOnly(t *testing.T) {
+	ts := serveGraphs(t, map[string]string{"test.szgo": testGraphJSON})
+	c := ts.Client()
+
+	resp, err := c.Get(ts.URL + "/test.szgo?edgelabels=hide")
+	if err != nil {
+		t.Fatalf("GET ?edgelabels=hide = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET ?edgelabels=hide status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	resp, err = c.PostForm(ts.URL+"/test.szgo?edgelabels=hide", nil)
+	if err != nil {
+		t.Fatalf("POST ?edgelabels=hide = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST ?edgelabels=hide status = %d, want %d after the redirect", resp.StatusCode, http.StatusOK)
+	}
+
+	resp, err = c.Get(ts.URL + "/test.szgo")
+	if err != nil {
+		t.Fatalf("GET test.szgo = %v", err)
+	}
+	defer resp.Body.Close()
+	page, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading test.szgo = %v", err)
+	}
+	if !strings.Contains(string(page), `action="?edgelabels=show"`) {
+		t.Error("after POST ?edgelabels=hide, the editor doesn't offer to show edge labels")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// imageFormats maps export formats to their content types.
+var imageFormats = map[string]string{
+	"png": "image/png",
+	"pdf": "application/pdf",
+	"svg": "image/svg+xml",
+}
+
+// imageFits maps page fits to Graphviz sizes in inches, so that large graphs
+// are scaled down to fit.
+var imageFits = map[string]string{
+	"":       "",
+	"doc":    "6.5,9",  // Letter or A4 page, with margins.
+	"slides": "12,6.5", // 16:9 slide, with margins.
+}
+
+// Image handles exporting the diagram as a file, given as
+// ?image=png|pdf|svg[&fit=doc|slides].
+func Image(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format, fit := q.Get("image"), q.Get("fit")
+	ct, ok := imageFormats[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unsupported image format %q", format), http.StatusBadRequest)
+		return
+	}
+	size, ok := imageFits[fit]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unsupported fit %q", fit), http.StatusBadRequest)
+		return
+	}
+
+	var img bytes.Buffer
+	if err := renderImage(&img, g, format, size); err != nil {
+		msg := fmt.Sprintf("Could not export image: %v", err)
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", ct)
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", g.PackageName()+"."+format))
+	if _, err := img.WriteTo(w); err != nil {
+		log.Printf("Could not write image: %v", err)
+	}
+}
+
+func renderImage(dst *bytes.Buffer, g *graph.Graph, format, size string) error {
+	if !HaveDot {
+		if format != "svg" {
+			return fmt.Errorf("exporting %s needs Graphviz (dot) to be installed", format)
+		}
+		dst.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+		return g.WriteSVGTo(dst)
+	}
+	var dot bytes.Buffer
+	if err := g.WriteDotTo(&dot); err != nil {
+		return err
+	}
+	args := []string{"-T" + format}
+	if format == "png" {
+		args = append(args, "-Gdpi=150")
+	}
+	if size != "" {
+		args = append(args, "-Gsize="+size)
+	}
+	return pipeThru(dst, exec.Command("dot", args...), &dot)
+}
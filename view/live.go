@@ -0,0 +1,179 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// LivePollInterval is how often the graph is checked for changes, to push a
+// new diagram to pages open on it.
+var LivePollInterval = time.Second
+
+// websocketGUID is used in the WebSocket handshake (RFC 6455).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Live serves a WebSocket (at ?live) which sends the re-rendered diagram (as
+// SVG) whenever the graph changes, so the graph page can update without a
+// reload. It only ever sends; anything the client sends is ignored. Once
+// connected it releases the graph (see releaseGraph), and takes the read
+// lock (see graphLock) whenever it looks.
+func Live(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	conn, rw, done := acceptWebSocket(w, r)
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+
+	last, err := graphState(g)
+	releaseGraph(r)
+	l := graphLock(graphPath(r))
+	if err != nil {
+		log.Printf("Could not encode graph: %v", err)
+		return
+	}
+	t := time.NewTicker(LivePollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-closing:
+			return
+		case <-t.C:
+		}
+		l.RLock()
+		cur, err := graphState(g)
+		var svg bytes.Buffer
+		var rerr error
+		if err == nil && !bytes.Equal(cur, last) {
+			rerr = renderDiagram(&svg, g)
+		}
+		l.RUnlock()
+		if err != nil {
+			log.Printf("Could not encode graph: %v", err)
+			return
+		}
+		if bytes.Equal(cur, last) {
+			continue
+		}
+		last = cur
+		if rerr != nil {
+			log.Printf("Could not render diagram: %v", rerr)
+			continue
+		}
+		if err := writeTextFrame(rw.Writer, svg.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+// isWebSocket reports whether r asks to open a WebSocket.
+func isWebSocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// acceptWebSocket completes the WebSocket handshake (RFC 6455) and takes over
+// the connection. done is closed when the client goes away. If the handshake
+// fails, an error has been served and conn is nil.
+func acceptWebSocket(w http.ResponseWriter, r *http.Request) (conn net.Conn, rw *bufio.ReadWriter, done <-chan struct{}) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !isWebSocket(r) || key == "" {
+		http.Error(w, "Expected a WebSocket connection", http.StatusBadRequest)
+		return nil, nil, nil
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "WebSocket from another site", http.StatusForbidden)
+		return nil, nil, nil
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, nil, nil
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		log.Printf("Could not hijack connection: %v", err)
+		return nil, nil, nil
+	}
+
+	h := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(h[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, nil
+	}
+
+	// Notice when the client goes away.
+	d := make(chan struct{})
+	go func() {
+		defer close(d)
+		io.Copy(ioutil.Discard, rw)
+	}()
+	return conn, rw, d
+}
+
+// sameOrigin reports whether a WebSocket handshake comes from one of our own
+// pages. Browsers send cookies and credentials with handshakes from any site,
+// and don't stop other sites reading what is sent, so the Origin has to be
+// checked. Clients other than browsers needn't send one.
+func sameOrigin(r *http.Request) bool {
+	o := r.Header.Get("Origin")
+	if o == "" {
+		return true
+	}
+	u, err := url.Parse(o)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// graphState returns something that changes whenever the graph does.
+func graphState(g *graph.Graph) ([]byte, error) {
+	var buf bytes.Buffer
+	err := g.WriteJSONTo(&buf)
+	return buf.Bytes(), err
+}
+
+// writeTextFrame writes msg as a single, unmasked WebSocket text frame.
+func writeTextFrame(w *bufio.Writer, msg []byte) error {
+	w.WriteByte(0x81) // FIN, text.
+	switch n := len(msg); {
+	case n < 126:
+		w.WriteByte(byte(n))
+	case n <= 0xffff:
+		w.WriteByte(126)
+		binary.Write(w, binary.BigEndian, uint16(n))
+	default:
+		w.WriteByte(127)
+		binary.Write(w, binary.BigEndian, uint64(n))
+	}
+	w.Write(msg)
+	return w.Flush()
+}
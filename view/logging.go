@@ -0,0 +1,183 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// Verbose turns on extra logging, mostly useful when debugging.
+var Verbose bool
+
+// logJSON is set by StartLogging.
+var logJSON bool
+
+// Debugf logs, but only if Verbose.
+func Debugf(format string, args ...interface{}) {
+	if Verbose {
+		log.Printf(format, args...)
+	}
+}
+
+// StartLogging sends logs to out. If asJSON, every line logged is a JSON
+// object (with at least "time" and "msg"), for log collectors.
+func StartLogging(out io.Writer, asJSON bool) {
+	logJSON = asJSON
+	if !asJSON {
+		log.SetOutput(out)
+		return
+	}
+	log.SetFlags(0)
+	log.SetOutput(&jsonLines{out: out})
+}
+
+// jsonLines turns each line written into a JSON log entry. Lines which are
+// already JSON objects (from logRequest) are passed through.
+type jsonLines struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (j *jsonLines) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, l := range bytes.SplitAfter(p, []byte("\n")) {
+		l = bytes.TrimRight(l, "\n")
+		if len(l) == 0 {
+			continue
+		}
+		if l[0] != '{' || !json.Valid(l) {
+			var err error
+			l, err = json.Marshal(map[string]string{
+				"time": time.Now().Format(time.RFC3339Nano),
+				"msg":  string(l),
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+		if _, err := j.out.Write(append(l, '\n')); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// LogRequests wraps h to log each request: its method, path, response
+// status, how long it took, and the graph concerned (if any).
+func LogRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &requestRecord{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		d := time.Since(start)
+		stats.request(r.Method, rec.status, d)
+		logRequest(r, rec, d)
+	})
+}
+
+func logRequest(r *http.Request, rec *requestRecord, d time.Duration) {
+	if !logJSON {
+		if rec.graph != "" {
+			log.Printf("%s %s %d %v graph=%q", r.Method, r.URL, rec.status, d, rec.graph)
+			return
+		}
+		log.Printf("%s %s %d %v", r.Method, r.URL, rec.status, d)
+		return
+	}
+	e := struct {
+		Time      string  `json:"time"`
+		Msg       string  `json:"msg"`
+		Method    string  `json:"method"`
+		Path      string  `json:"path"`
+		Query     string  `json:"query,omitempty"`
+		Status    int     `json:"status"`
+		Bytes     int     `json:"bytes"`
+		LatencyMS float64 `json:"latency_ms"`
+		Graph     string  `json:"graph,omitempty"`
+		User      string  `json:"user,omitempty"`
+	}{
+		Time:      time.Now().Format(time.RFC3339Nano),
+		Msg:       "request",
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     r.URL.RawQuery,
+		Status:    rec.status,
+		Bytes:     rec.size,
+		LatencyMS: float64(d) / float64(time.Millisecond),
+		Graph:     rec.graph,
+		User:      userOf(r),
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Could not encode log entry: %v", err)
+		return
+	}
+	log.Print(string(b))
+}
+
+// requestRecord notes what happened to a request, for logRequest.
+type requestRecord struct {
+	http.ResponseWriter
+	status int
+	size   int
+	graph  string
+}
+
+func (r *requestRecord) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *requestRecord) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// Hijack lets WebSockets through.
+func (r *requestRecord) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
+
+// Flush lets streamed output (e.g. from running a graph) through.
+func (r *requestRecord) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// noteGraph records which graph a request is about, for the request log.
+func noteGraph(w http.ResponseWriter, g *graph.Graph) {
+	if rec, ok := w.(*requestRecord); ok {
+		rec.graph = g.Name
+	}
+}
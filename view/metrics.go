@@ -0,0 +1,161 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// serverMetrics counts things about the editor itself, for /metrics.
+type serverMetrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]int64
+	reqSecs  float64
+	builds   map[bool]int64 // by success
+	buildSec float64
+	runs     map[bool]int64
+	runSecs  float64
+	running  int64
+	graphs   func() int
+}
+
+type requestKey struct {
+	method string
+	code   int
+}
+
+var stats = &serverMetrics{
+	requests: make(map[requestKey]int64),
+	builds:   make(map[bool]int64),
+	runs:     make(map[bool]int64),
+}
+
+// methodLabel is the method to count a request under. Clients choose the
+// method, so only the standard ones are counted by name.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+func (m *serverMetrics) request(method string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{methodLabel(method), code}]++
+	m.reqSecs += d.Seconds()
+}
+
+func (m *serverMetrics) built(err error, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.builds[err == nil]++
+	m.buildSec += d.Seconds()
+}
+
+// startRun counts a run as in progress, until the returned func is called
+// with how it went.
+func (m *serverMetrics) startRun() func(error) {
+	start := time.Now()
+	m.mu.Lock()
+	m.running++
+	m.mu.Unlock()
+	return func(err error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.running--
+		m.runs[err == nil]++
+		m.runSecs += time.Since(start).Seconds()
+	}
+}
+
+func result(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "error"
+}
+
+// Metrics serves metrics about the server in the Prometheus text format.
+var Metrics = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	m := stats
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP shenzhen_http_requests_total HTTP requests served, by method and status code.")
+	fmt.Fprintln(w, "# TYPE shenzhen_http_requests_total counter")
+	keys := make([]requestKey, 0, len(m.requests))
+	var n int64
+	for k, c := range m.requests {
+		keys = append(keys, k)
+		n += c
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "shenzhen_http_requests_total{method=%q,code=\"%d\"} %d\n", k.method, k.code, m.requests[k])
+	}
+	fmt.Fprintln(w, "# HELP shenzhen_http_request_duration_seconds Time spent serving HTTP requests.")
+	fmt.Fprintln(w, "# TYPE shenzhen_http_request_duration_seconds summary")
+	fmt.Fprintf(w, "shenzhen_http_request_duration_seconds_sum %g\n", m.reqSecs)
+	fmt.Fprintf(w, "shenzhen_http_request_duration_seconds_count %d\n", n)
+
+	for _, s := range []struct {
+		name, done, help string
+		counts           map[bool]int64
+		secs             float64
+	}{
+		{"build", "built", "Time spent building graphs.", m.builds, m.buildSec},
+		{"run", "run", "Time spent building and running graphs.", m.runs, m.runSecs},
+	} {
+		fmt.Fprintf(w, "# HELP shenzhen_%ss_total Graphs %s, by result.\n", s.name, s.done)
+		fmt.Fprintf(w, "# TYPE shenzhen_%ss_total counter\n", s.name)
+		for _, ok := range []bool{true, false} {
+			fmt.Fprintf(w, "shenzhen_%ss_total{result=%q} %d\n", s.name, result(ok), s.counts[ok])
+		}
+		fmt.Fprintf(w, "# HELP shenzhen_%s_duration_seconds %s\n", s.name, s.help)
+		fmt.Fprintf(w, "# TYPE shenzhen_%s_duration_seconds summary\n", s.name)
+		fmt.Fprintf(w, "shenzhen_%s_duration_seconds_sum %g\n", s.name, s.secs)
+		fmt.Fprintf(w, "shenzhen_%s_duration_seconds_count %d\n", s.name, s.counts[true]+s.counts[false])
+	}
+
+	fmt.Fprintln(w, "# HELP shenzhen_running_processes Graphs running now.")
+	fmt.Fprintln(w, "# TYPE shenzhen_running_processes gauge")
+	fmt.Fprintf(w, "shenzhen_running_processes %d\n", m.running)
+
+	if m.graphs != nil {
+		fmt.Fprintln(w, "# HELP shenzhen_graphs_loaded Graphs loaded into memory.")
+		fmt.Fprintln(w, "# TYPE shenzhen_graphs_loaded gauge")
+		fmt.Fprintf(w, "shenzhen_graphs_loaded %d\n", m.graphs())
+	}
+
+	events.mu.Lock()
+	fmt.Fprintln(w, "# HELP shenzhen_event_listeners Clients listening to /events.")
+	fmt.Fprintln(w, "# TYPE shenzhen_event_listeners gauge")
+	fmt.Fprintf(w, "shenzhen_event_listeners %d\n", len(events.subs))
+	events.mu.Unlock()
+})
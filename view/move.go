@@ -0,0 +1,66 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// Move handles pinning a node to a position in the diagram, given as a POST
+// to ?move=node&x=X&y=Y (in points, y upwards, as in Graphviz).
+func Move(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Moving nodes needs a POST", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	n := g.Nodes[q.Get("move")]
+	if n == nil {
+		http.Error(w, fmt.Sprintf("Node %q not found", q.Get("move")), http.StatusNotFound)
+		return
+	}
+	x, errx := strconv.ParseFloat(q.Get("x"), 64)
+	y, erry := strconv.ParseFloat(q.Get("y"), 64)
+	if errx != nil || erry != nil {
+		http.Error(w, fmt.Sprintf("Invalid position (%q, %q)", q.Get("x"), q.Get("y")), http.StatusBadRequest)
+		return
+	}
+	log.Printf("moving %s to (%g, %g)", n.Name, x, y)
+	n.Pos = &graph.Position{X: x, Y: y}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unpin handles letting nodes be laid out automatically again, given as
+// ?unpin=node, or ?unpin alone for all nodes.
+func Unpin(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("unpin")
+	for _, n := range g.Nodes {
+		if name == "" || n.Name == name {
+			n.Pos = nil
+		}
+	}
+	u := *r.URL
+	u.RawQuery = ""
+	if name != "" {
+		u.RawQuery = url.Values{"node": []string{name}}.Encode()
+	}
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
@@ -16,6 +16,7 @@ package view
 
 import (
 	"fmt"
+	"go/token"
 	"html/template"
 	"io"
 	"log"
@@ -23,45 +24,350 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/shenzhen-go/graph"
 	"github.com/google/shenzhen-go/parts"
+	"github.com/google/shenzhen-go/source"
 )
 
 // TODO: Replace these cobbled-together UIs with Polymer or something.
-// TODO: Some way of deleting nodes.
 const nodeEditorTemplateSrc = `{{with .Node -}}
 <head>
 	<title>{{if .Name}}{{.Name}}{{else}}[New]{{end}}</title><style>` + css + `</style>
 </head>
 <body>
 	<h1>{{if .Name}}{{.Name}}{{else}}[New]{{end}}</h1>
-	Part type: {{.Part.TypeKey}}
-	<form method="post">
+	Part type: <a href="{{base}}/parts#{{.Part.TypeKey}}">{{.Part.TypeKey}}</a>
+	{{with $.Help}}{{with .Description}}<p>{{.}}</p>{{end}}{{with .Fields}}
+	<details>
+		<summary>Help</summary>
+		<dl>
+			{{range .}}<dt>{{.Field}}</dt><dd>{{.Help}}</dd>{{end}}
+		</dl>
+	</details>
+	{{- end}}{{end}}
+	{{with $.Viewers}}<p>Also viewing this goroutine: {{range $i, $v := .}}{{if $i}}, {{end}}{{$v}}{{end}}</p>{{end}}
+	{{with $.Overwrote}}<div class="errors"><p>Your save replaced changes made by {{.}} since you opened this goroutine.</p></div>{{end}}
+	<div class="errors" id="changed" style="display:none"></div>
+	{{if not .Name}}{{with $.PartTypes -}}
+	<form method="get">
+		<input type="hidden" name="node" value="new">
+		<div class="formfield">
+			<label for="PartType">Part type</label>
+			<select name="PartType">
+				{{range .}}<option value="{{.}}" {{if eq . $.Node.Part.TypeKey}}selected{{end}}>{{.}}</option>{{end}}
+			</select>
+			<input type="submit" value="Change">
+		</div>
+	</form>
+	{{- end}}{{with $.Snippets -}}
+	<form method="get">
+		<input type="hidden" name="node" value="new">
+		<div class="formfield">
+			<label for="snippet">Start from snippet</label>
+			<select name="snippet">
+				{{range .}}<option value="{{.}}" {{if eq . $.Snippet}}selected{{end}}>{{.}}</option>{{end}}
+			</select>
+			<input type="submit" value="Use">
+		</div>
+	</form>
+	{{- end}}{{end}}
+	<form method="post" id="editor">
+		<input type="hidden" name="PartType" value="{{.Part.TypeKey}}">
+		<input type="hidden" name="Version" value="{{$.Version}}">
 		<div class="formfield">
 			<label for="Name">Name</label>
-			<input name="Name" type="text" required value="{{.Name}}">
+			<input name="Name" type="text" required value="{{with $.Form}}{{.Get "Name"}}{{else}}{{if .Name}}{{.Name}}{{else}}{{$.NewName}}{{end}}{{end}}">
+			{{with index $.FormErrors "Name"}}<div class="errors hint">{{.}}</div>{{end}}
 		</div>
 		<div class="formfield">
 			<label for="Multiplicity">Multiplicity</label>
-			<input name="Multiplicity" type="text" required pattern="^[1-9][0-9]*$" title="Must be a whole number, at least 1." value="{{if .Multiplicity}}{{.Multiplicity}}{{else}}1{{end}}">
+			<input name="Multiplicity" type="text" required pattern="^[1-9][0-9]*$" title="Must be a whole number, at least 1." value="{{with $.Form}}{{.Get "Multiplicity"}}{{else}}{{if $.Node.Multiplicity}}{{$.Node.Multiplicity}}{{else}}1{{end}}{{end}}">
+			{{with index $.FormErrors "Multiplicity"}}<div class="errors hint">{{.}}</div>{{end}}
 		</div>
 		<div class="formfield">
 			<label for="Wait">Wait for this to finish</label>
+			{{if $.Graph.Termination -}}
+			<input name="Wait" type="checkbox" disabled {{if $.Graph.Waited $.Node}}checked{{end}}>
+			{{if .Wait}}<input name="Wait" type="hidden" value="on">{{end}}
+			<div class="hint">Decided by the graph's <a href="?props">termination setting</a>.</div>
+			{{- else -}}
 			<input name="Wait" type="checkbox" {{if .Wait}}checked{{end}}>
+			{{- end}}
+		</div>
+		<div class="formfield">
+			<label for="Doc">Documentation</label>
+			<textarea name="Doc" rows="3" cols="80" placeholder="What this goroutine is for">{{.Doc}}</textarea>
+		</div>
+		<div class="formfield">
+			<label for="Disabled">Disabled</label>
+			<input name="Disabled" type="checkbox" {{if .Disabled}}checked{{end}}>
+			<label for="Bridge">and pass values straight through</label>
+			<input name="Bridge" type="checkbox" {{if .Bridge}}checked{{end}}>
 		</div>
+		<div class="formfield">
+			<label for="Group">Group</label>
+			<input name="Group" type="text" list="groups" placeholder="None" value="{{.Group}}">
+			<datalist id="groups">
+				{{range $.GroupNames}}<option value="{{.}}">{{end}}
+			</datalist>
+		</div>
+		<details {{if or (not .Resources.IsZero) (index $.FormErrors "Resources")}}open{{end}}>
+			<summary>Resources</summary>
+			<div class="formfield">
+				<label for="Procs">Run with at least</label>
+				<input name="Procs" type="text" pattern="^[0-9]*$" size="4" placeholder="any" value="{{with $.Form}}{{.Get "Procs"}}{{else}}{{with .Resources.Procs}}{{.}}{{end}}{{end}}"> procs (GOMAXPROCS)
+			</div>
+			<div class="formfield">
+				<label for="LockOSThread">Lock each goroutine to an OS thread</label>
+				<input name="LockOSThread" type="checkbox" {{if .Resources.LockOSThread}}checked{{end}}>
+			</div>
+			<div class="formfield">
+				<label for="Semaphore">Share semaphore</label>
+				<input name="Semaphore" type="text" placeholder="none" value="{{with $.Form}}{{.Get "Semaphore"}}{{else}}{{.Resources.Semaphore}}{{end}}">
+				<label for="Slots">with</label>
+				<input name="Slots" type="text" pattern="^[0-9]*$" size="4" placeholder="1" value="{{with $.Form}}{{.Get "Slots"}}{{else}}{{with .Resources.Slots}}{{.}}{{end}}{{end}}"> slots
+				<div class="hint">At most that many goroutines sharing the semaphore run at once, e.g. to limit open files.</div>
+			</div>
+			{{with index $.FormErrors "Resources"}}<div class="errors hint">{{.}}</div>{{end}}
+		</details>
+		<details {{if or (not .Timeout.IsZero) (index $.FormErrors "Timeout")}}open{{end}}>
+			<summary>Timeout</summary>
+			<div class="formfield">
+				<label for="TimeoutDuration">Give up on a message after</label>
+				<input name="TimeoutDuration" type="text" size="8" placeholder="e.g. 30s" value="{{with $.Form}}{{.Get "TimeoutDuration"}}{{else}}{{.Timeout.Duration}}{{end}}">
+			</div>
+			<div class="formfield">
+				<label for="TimeoutAction">Then</label>
+				<select name="TimeoutAction">
+					{{range timeoutActions}}<option value="{{.Value}}" {{if eq .Value $.Node.Timeout.Action}}selected{{end}}>{{.Description}}</option>{{end}}
+				</select>
+				<input name="TimeoutErrors" type="text" list="errorchannels" placeholder="chan error" value="{{.Timeout.Errors}}">
+				<datalist id="errorchannels">
+					{{range $.Graph.Channels}}{{if eq .Type "error"}}<option value="{{.Name}}">{{end}}{{end}}
+				</datalist>
+				<div class="hint">The code handles each message with <code>withTimeout(func(ctx context.Context) { ... })</code>, which reports whether it finished in time. It waits for the function either way, so sends should also <code>select</code> on <code>ctx.Done()</code>.</div>
+			</div>
+			{{with index $.FormErrors "Timeout"}}<div class="errors hint">{{.}}</div>{{end}}
+		</details>
 		{{template "part_view" $ }}
+		{{with index $.FormErrors "Part"}}<div class="errors"><p>{{.}}</p></div>{{end}}
+		{{if $.ConfigErrors -}}
+		<div class="errors">
+			<ul>
+				{{range $.ConfigErrors}}<li>{{.}}</li>{{end}}
+			</ul>
+		</div>
+		{{- end}}
+		{{if $.TypeErrors -}}
+		<div class="errors">
+			<ul>
+				{{range $.TypeErrors}}<li>{{.}}</li>{{end}}
+			</ul>
+		</div>
+		{{- end}}
+		{{if $.LintErrors -}}
+		<div class="errors lint">
+			<ul>
+				{{range $.LintErrors}}<li>{{.}}</li>{{end}}
+			</ul>
+		</div>
+		{{- end}}
 		<div class="formfield hcentre">
 			<input type="submit" value="Save">
 			<input type="button" value="Return" onclick="window.location.href='?'">
 		</div>
 	</form>
+	{{with $.CodeMirror -}}
+	<link rel="stylesheet" href="{{.}}/codemirror.min.css">
+	<link rel="stylesheet" href="{{.}}/addon/hint/show-hint.min.css">
+	<script src="{{.}}/codemirror.min.js"></script>
+	<script src="{{.}}/mode/go/go.min.js"></script>
+	<script src="{{.}}/addon/hint/show-hint.min.js"></script>
+	<script>
+	// Edit code with CodeMirror, completing identifiers with Ctrl-Space or
+	// after a ".".
+	(function() {
+		var ta = document.querySelector('#editor textarea[name=Code]');
+		if (!ta || !window.CodeMirror) return;
+		var hint = function(cm, done) {
+			var cur = cm.getCursor(), tok = cm.getTokenAt(cur);
+			var from = /^[\w$]+$/.test(tok.string) ? tok.start : cur.ch;
+			fetch('?node=' + encodeURIComponent({{$.Node.Name}} || 'new') + '&complete', {
+				method: 'POST',
+				body: new URLSearchParams({Code: cm.getValue(), line: cur.line, ch: cur.ch}),
+			}).then(function(r) { return r.json(); }).then(function(cs) {
+				done({
+					list: cs.map(function(c) {
+						return {text: c.label, displayText: c.label + (c.detail ? '  ' + c.detail : '')};
+					}),
+					from: CodeMirror.Pos(cur.line, from),
+					to: cur,
+				});
+			});
+		};
+		hint.async = true;
+		var cm = CodeMirror.fromTextArea(ta, {
+			mode: 'text/x-go',
+			lineNumbers: true,
+			indentUnit: 4,
+			indentWithTabs: true,
+			extraKeys: {'Ctrl-Space': 'autocomplete'},
+			hintOptions: {hint: hint, completeSingle: false},
+		});
+		cm.on('inputRead', function(cm, change) {
+			if (change.text.join('') == '.') cm.showHint();
+		});
+		// Let the syntax check and code preview see changes.
+		cm.on('change', function() {
+			cm.save();
+			ta.dispatchEvent(new Event('input', {bubbles: true}));
+		});
+		ta.cm = cm;
+	})();
+	</script>
+	{{- end}}
+	<script>
+	// Check the syntax of code as it is typed.
+	(function() {
+		var ta = document.querySelector('#editor textarea[name=Code]'), timer;
+		if (!ta) return;
+		var list = document.createElement('ul');
+		var div = document.createElement('div');
+		div.className = 'errors';
+		div.style.display = 'none';
+		div.appendChild(list);
+		ta.parentNode.insertBefore(div, ta.nextSibling);
+		// offset converts a line and column to an offset into the code.
+		var offset = function(line, col) {
+			var lines = ta.value.split('\n'), o = 0;
+			for (var i = 0; i < line-1 && i < lines.length; i++) o += lines[i].length + 1;
+			return o + Math.max(col-1, 0);
+		};
+		var check = function() {
+			fetch('?node=' + encodeURIComponent({{.Name}} || 'new') + '&syntax', {
+				method: 'POST',
+				body: new URLSearchParams({Code: ta.value}),
+			}).then(function(r) { return r.json(); }).then(function(errs) {
+				list.textContent = '';
+				div.style.display = errs.length ? '' : 'none';
+				errs.forEach(function(e) {
+					var li = document.createElement('li'), a = document.createElement('a');
+					a.href = '#';
+					a.textContent = e.line + ':' + e.column + ': ' + e.msg;
+					a.onclick = function() {
+						if (ta.cm) {
+							ta.cm.focus();
+							ta.cm.setCursor(e.line-1, e.column-1);
+							return false;
+						}
+						var o = offset(e.line, e.column);
+						ta.focus();
+						ta.setSelectionRange(o, o+1);
+						return false;
+					};
+					li.appendChild(a);
+					list.appendChild(li);
+				});
+			});
+		};
+		ta.addEventListener('input', function() {
+			clearTimeout(timer);
+			timer = setTimeout(check, 400);
+		});
+	})();
+	</script>
+	<details id="codepreview">
+		<summary>Preview generated code</summary>
+		<pre></pre>
+	</details>
+	<script>
+	// Show the code the form would generate, as it is edited.
+	(function() {
+		var form = document.getElementById('editor'), details = document.getElementById('codepreview');
+		var pre = details.querySelector('pre'), timer;
+		var refresh = function() {
+			if (!details.open) return;
+			fetch('?node=' + encodeURIComponent({{.Name}} || 'new') + '&code', {
+				method: 'POST',
+				body: new URLSearchParams(new FormData(form)),
+			}).then(function(r) { return r.text(); }).then(function(t) { pre.textContent = t; });
+		};
+		details.addEventListener('toggle', refresh);
+		form.addEventListener('input', function() {
+			clearTimeout(timer);
+			timer = setTimeout(refresh, 500);
+		});
+	})();
+	</script>
+	{{if .Name -}}
+	<form method="get" class="hcentre">
+		<input type="hidden" name="connect" value="{{.Name}}">
+		<label for="to">Send to</label>
+		<select name="to">
+			{{range $.Graph.Nodes}}<option value="{{.Name}}">{{.Name}}</option>{{end}}
+		</select>
+		<input type="submit" value="Connect">
+	</form>
+	<form method="get" class="hcentre">
+		<input type="hidden" name="node" value="{{.Name}}">
+		<input type="hidden" name="duplicate">
+		<input type="submit" value="Duplicate">
+	</form>
+	<form method="get" class="hcentre">
+		<input type="hidden" name="node" value="{{.Name}}">
+		<input type="text" name="save_snippet" required placeholder="Snippet name" value="{{.Name}}">
+		<input type="submit" value="Save as snippet">
+	</form>
+	<a href="?focus={{.Name}}">Show neighbours</a> |
+	{{if $.AllowBuild}}<a href="?scratch={{.Name}}">Try it by itself</a> |{{end}}
+	{{if $.Fuzzable $.Node}}<a href="?fuzz={{.Name}}" title="A go test -fuzz target, seeded from the samples of the channels it reads. shenzhen-go fuzz writes it along with the code it tests.">Fuzz test</a> |{{end}}
+	{{if .Pos}}<a href="?unpin={{.Name}}">Unpin from the diagram</a> |{{end}}
+	<a href="?comment=new&amp;attach={{.Name}}">Add a comment</a> |
+	<a href="?copy&amp;node={{.Name}}" title="Paste it into any graph">Copy as JSON</a> |
+	<a href="?bulk=extract&amp;node={{.Name}}">Extract into a subgraph</a> |
+	<a href="?node={{.Name}}&amp;delete">Delete this goroutine</a>
+	<script>
+	// Warn about changes others save while this is open.
+	(function() {
+		if (!window.WebSocket) return;
+		var name = {{.Name}}, me = {{$.User}};
+		var u = new URL('{{base}}/events?graph=' + encodeURIComponent(location.pathname), location.href);
+		u.protocol = u.protocol.replace('http', 'ws');
+		new WebSocket(u.href).onmessage = function(m) {
+			var e = JSON.parse(m.data), div = document.getElementById('changed');
+			if (e.user == me || (e.name != name && e.from != name)) return;
+			switch (e.type) {
+			case 'node_changed':
+			case 'node_renamed':
+			case 'node_removed':
+				div.textContent = (e.user || 'Someone') + ' saved changes to this goroutine. Saving now will replace them; reload to see them.';
+				div.style.display = '';
+			}
+		};
+	})();
+	</script>
+	{{- end}}
 </body>
 {{- end}}`
 
-var nodeEditorTemplate = template.Must(template.New("nodeEditor").Parse(nodeEditorTemplateSrc))
+var nodeEditorTemplate = template.Must(template.New("nodeEditor").Funcs(templateFuncs).Parse(nodeEditorTemplateSrc))
+
+// CodeMirrorURL is where the CodeMirror 5 editor is loaded from, for editing
+// code. If empty, code is edited in a plain text box.
+var CodeMirrorURL = "https://cdnjs.cloudflare.com/ajax/libs/codemirror/5.65.16"
 
-func renderNodeEditor(dst io.Writer, g *graph.Graph, n *graph.Node) error {
+// Linter is a command (and arguments) used to lint node implementations,
+// e.g. []string{"go", "vet"}. If empty, nodes are not linted.
+var Linter []string
+
+// renderNodeEditor renders the editor for n. For new nodes, newName is a
+// suggested name, and snippet is the snippet it came from (if any). overwrote
+// is whoever made the changes the last save replaced, if anyone. If errs is
+// not nil, n has the values of the form r submitted, which had errs.
+func renderNodeEditor(dst io.Writer, r *http.Request, g *graph.Graph, n *graph.Node, newName, snippet, overwrote string, errs formErrors) error {
 	t, err := nodeEditorTemplate.Clone()
 	if err != nil {
 		return err
@@ -69,25 +375,173 @@ func renderNodeEditor(dst io.Writer, g *graph.Graph, n *graph.Node) error {
 	if err := n.Part.AssociateEditor(t); err != nil {
 		return err
 	}
+	terrs, err := g.TypeCheckNode(n)
+	if err != nil {
+		// Not being able to check isn't fatal to editing.
+		log.Printf("Could not type-check node: %v", err)
+	}
+	var lerrs []source.Error
+	if len(Linter) > 0 && len(terrs) == 0 {
+		// Linters tend to give up on code that doesn't type-check anyway.
+		lerrs, err = g.LintNode(n, Linter)
+		if err != nil {
+			log.Printf("Could not lint node: %v", err)
+		}
+	}
+	var cerrs []string
+	if n.Name != "" {
+		// A new part is bound to be missing things.
+		cerrs = graph.ConfigProblems(n)
+	}
+	version := nodeVersion(n)
+	var form url.Values
+	if errs != nil {
+		form = r.PostForm
+		if v := r.FormValue("Version"); v != "" {
+			// Keep to the version the form was first shown with.
+			version = v
+		}
+	}
+	var snips, pts []string
+	if n.Name == "" {
+		pts = parts.TypeKeys()
+		if snips, err = graph.Snippets(); err != nil {
+			log.Printf("Could not list snippets: %v", err)
+		}
+	}
 	return t.Execute(dst, &struct {
 		*graph.Graph
 		*graph.Node
-	}{g, n})
+		Help         parts.Metadata
+		ConfigErrors []string
+		TypeErrors   []source.Error
+		LintErrors   []source.Error
+		NewName      string
+		Snippet      string
+		Snippets     []string
+		PartTypes    []string
+		User         string
+		Viewers      []string
+		Version      string
+		Overwrote    string
+		CodeMirror   string
+		Form         url.Values
+		FormErrors   formErrors
+		AllowBuild   bool
+	}{g, n, parts.Describe(n.TypeKey()), cerrs, terrs, lerrs, newName, snippet, snips, pts,
+		userOf(r), here.viewers(graphPath(r), n.Name, userOf(r)), version, overwrote, CodeMirrorURL, form, errs, AllowBuild})
 }
 
 // Node handles viewing/editing a node.
 func Node(g *graph.Graph, name string, w http.ResponseWriter, r *http.Request) {
-	log.Printf("%s %s", r.Method, r.URL)
-
 	n, found := g.Nodes[name]
 	if name != "new" && !found {
 		http.Error(w, fmt.Sprintf("Node %q not found", name), http.StatusNotFound)
 		return
 	}
-	if n == nil {
-		n = &graph.Node{
-			Part: &parts.Code{},
+	q := r.URL.Query()
+	snip, newName := q.Get("snippet"), ""
+	switch {
+	case found:
+		// Editing an existing node.
+	case snip != "":
+		m, err := graph.LoadSnippet(snip)
+		if err != nil {
+			log.Printf("Could not load snippet: %v", err)
+			http.Error(w, fmt.Sprintf("Could not load snippet %q: %v", snip, err), http.StatusNotFound)
+			return
 		}
+		n, newName = m, g.UniqueNodeName(m.Name)
+		n.Name = ""
+	default:
+		var p graph.Part = &parts.Code{}
+		// Saving a new node needs a part of the right type.
+		if pf, ok := parts.Lookup(r.FormValue("PartType")); ok {
+			if fp, ok := pf().(graph.Part); ok {
+				p = fp
+			}
+		}
+		n = &graph.Node{Part: p}
+	}
+
+	if sn := q.Get("save_snippet"); sn != "" && found {
+		if err := graph.SaveSnippet(sn, n); err != nil {
+			log.Printf("Could not save snippet: %v", err)
+			http.Error(w, fmt.Sprintf("Could not save snippet: %v", err), http.StatusInternalServerError)
+			return
+		}
+		q := url.Values{"node": []string{n.Name}}
+		u := *r.URL
+		u.RawQuery = q.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+		return
+	}
+
+	if _, dup := q["duplicate"]; dup && found {
+		m, err := n.Copy()
+		if err != nil {
+			log.Printf("Could not copy node: %v", err)
+			http.Error(w, fmt.Sprintf("Could not copy node: %v", err), http.StatusInternalServerError)
+			return
+		}
+		m.Name = g.UniqueNodeName(n.Name)
+		m.Pos = nil // Don't put it exactly on top.
+		g.Nodes[m.Name] = m
+		q := url.Values{"node": []string{m.Name}}
+		u := *r.URL
+		u.RawQuery = q.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+		return
+	}
+
+	if _, del := q["delete"]; del && found {
+		if r.Method != "POST" {
+			// Ask first.
+			eff, err := g.PreviewDeleteNode(name)
+			if err == nil {
+				err = renderDeleteConfirm(w, name, "?"+url.Values{"node": {name}}.Encode(), eff)
+			}
+			if err != nil {
+				log.Printf("Could not preview deleting node: %v", err)
+				http.Error(w, fmt.Sprintf("Could not preview deleting node: %v", err), http.StatusInternalServerError)
+			}
+			return
+		}
+		delete(g.Nodes, name)
+		g.ReattachComments(name, "")
+		u := *r.URL
+		u.RawQuery = ""
+		http.Redirect(w, r, u.String(), http.StatusFound)
+		return
+	}
+
+	if _, inl := q["inline"]; inl && found {
+		if r.Method != "POST" {
+			http.Error(w, "Inlining needs a POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, _, err := g.Inline(name); err != nil {
+			log.Printf("Could not inline subgraph: %v", err)
+			http.Error(w, fmt.Sprintf("Could not inline subgraph: %v", err), http.StatusBadRequest)
+			return
+		}
+		u := *r.URL
+		u.RawQuery = ""
+		http.Redirect(w, r, u.String(), http.StatusSeeOther) // should cause GET
+		return
+	}
+
+	if _, code := q["code"]; code {
+		nodeCode(g, n, w, r)
+		return
+	}
+	if _, syn := q["syntax"]; syn {
+		nodeSyntax(g, n, w, r)
+		return
+	}
+	if _, comp := q["complete"]; comp {
+		nodeComplete(g, n, w, r)
+		return
 	}
 
 	var err error
@@ -95,7 +549,7 @@ func Node(g *graph.Graph, name string, w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		err = handleNodePost(g, n, w, r)
 	case "GET":
-		err = renderNodeEditor(w, g, n)
+		err = renderNodeEditor(w, r, g, n, newName, snip, q.Get("overwrote"), nil)
 	default:
 		err = fmt.Errorf("unsupported verb %q", r.Method)
 	}
@@ -112,57 +566,292 @@ func handleNodePost(g *graph.Graph, n *graph.Node, w http.ResponseWriter, r *htt
 		return err
 	}
 
-	// Validate.
-	nm := strings.TrimSpace(r.FormValue("Name"))
-	if nm == "" {
-		return fmt.Errorf(`name is empty [%q == ""]`, nm)
-	}
-
-	mult, err := strconv.Atoi(r.FormValue("Multiplicity"))
-	if err != nil {
-		return err
-	}
-	if mult < 1 {
-		return fmt.Errorf("multiplicity too small [%d < 1]", mult)
-	}
-
 	// Validate PartType
 	pt := r.FormValue("PartType")
-	if _, ok := parts.Factories[pt]; !ok {
+	if _, ok := parts.Lookup(pt); !ok {
 		return fmt.Errorf("unknown part type %q", pt)
 	}
-
-	// Validate Part itself.
-	part := n.Part
 	if want := n.Part.TypeKey(); pt != want {
 		return fmt.Errorf("cannot change part types [%q != %q]", pt, want)
 	}
-	if err := part.Update(r); err != nil {
+
+	// Last save wins, but say so if it replaced someone else's.
+	user, overwrote := userOf(r), ""
+	v := r.FormValue("Version")
+	stale := n.Name != "" && v != "" && v != nodeVersion(n)
+
+	// Make the changes to a copy, so that if anything is wrong, the editor
+	// can show what was submitted without changing the node.
+	m, err := g.CopyNode(n)
+	if err != nil {
 		return err
 	}
+	errs := make(formErrors)
+	nm := strings.TrimSpace(r.FormValue("Name"))
+	if nm == "" {
+		errs["Name"] = "The name is empty."
+	} else if _, found := g.Nodes[nm]; found && nm != n.Name {
+		errs["Name"] = fmt.Sprintf("There is already a goroutine called %q.", nm)
+	}
+	mult, err := strconv.Atoi(r.FormValue("Multiplicity"))
+	if err != nil || mult < 1 {
+		errs["Multiplicity"] = fmt.Sprintf("%q is not a whole number, at least 1.", r.FormValue("Multiplicity"))
+		mult = int(m.Multiplicity)
+	}
+	setNodeFields(m, r, mult)
+	if res, msg := nodeResources(r); msg != "" {
+		errs["Resources"] = msg
+	} else {
+		m.Resources = res
+	}
+	if t, msg := nodeTimeout(r); msg != "" {
+		errs["Timeout"] = msg
+	} else {
+		m.Timeout = t
+	}
+	if err := m.Part.Update(r); err != nil {
+		errs["Part"] = err.Error()
+	}
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return renderNodeEditor(w, r, g, m, "", "", "", errs)
+	}
+	n = m
 
-	// Update.
-	n.Multiplicity = uint(mult)
-	n.Wait = (r.FormValue("Wait") == "on")
-	n.Part = part
+	// Nobody else sees changes made in a preview.
+	if !previewing(r) {
+		prev := here.edited(graphPath(r), nm, user)
+		if stale {
+			if overwrote = prev; overwrote == "" || overwrote == user {
+				overwrote = "someone else"
+			}
+			Publish(Event{Type: Conflict, Graph: graphPath(r), Name: nm, User: user})
+		}
+		if n.Name != "" {
+			e := Event{Type: NodeChanged, Graph: graphPath(r), Name: nm, User: user}
+			if nm != n.Name {
+				e.From = n.Name
+			}
+			Publish(e)
+		}
+	}
 
 	// No name change? No need to readjust the map or redirect.
 	// So render the usual editor.
 	if nm == n.Name {
-		return renderNodeEditor(w, g, n)
+		g.Nodes[nm] = n
+		return renderNodeEditor(w, r, g, n, "", "", overwrote, nil)
 	}
 
 	// Do name changes last since they cause a redirect.
 	if n.Name != "" {
 		delete(g.Nodes, n.Name)
+		g.ReattachComments(n.Name, nm)
 	}
 	n.Name = nm
 	g.Nodes[nm] = n
 
 	q := url.Values{"node": []string{nm}}
+	if overwrote != "" {
+		q.Set("overwrote", overwrote)
+	}
 	u := *r.URL
 	u.RawQuery = q.Encode()
-	log.Printf("redirecting to %v", u)
+	Debugf("redirecting to %v", u)
 	http.Redirect(w, r, u.String(), http.StatusSeeOther) // should cause GET
 	return nil
 }
+
+// setNodeFields sets the fields every node has from the form.
+func setNodeFields(n *graph.Node, r *http.Request, mult int) {
+	n.Multiplicity = uint(mult)
+	n.Wait = (r.FormValue("Wait") == "on")
+	n.Group = strings.TrimSpace(r.FormValue("Group"))
+	n.Doc = strings.TrimSpace(strings.Replace(r.FormValue("Doc"), "\r\n", "\n", -1))
+	n.Disabled = (r.FormValue("Disabled") == "on")
+	n.Bridge = (r.FormValue("Bridge") == "on")
+}
+
+// nodeResources reads the resource hints from the form. If any are unusable,
+// it also returns a message saying why.
+func nodeResources(r *http.Request) (graph.Resources, string) {
+	res := graph.Resources{
+		LockOSThread: r.FormValue("LockOSThread") == "on",
+		Semaphore:    strings.TrimSpace(r.FormValue("Semaphore")),
+	}
+	for _, f := range []struct {
+		name string
+		dst  *int
+	}{{"Procs", &res.Procs}, {"Slots", &res.Slots}} {
+		v := strings.TrimSpace(r.FormValue(f.name))
+		if v == "" {
+			continue
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			return res, fmt.Sprintf("%s %q is not a whole number.", f.name, v)
+		}
+		*f.dst = i
+	}
+	if res.Semaphore == "" {
+		res.Slots = 0
+	} else if !token.IsIdentifier(res.Semaphore) {
+		return res, fmt.Sprintf("Semaphore %q is not a Go identifier.", res.Semaphore)
+	}
+	return res, ""
+}
+
+// nodeTimeout reads the timeout from the form. If it is unusable, it also
+// returns a message saying why.
+func nodeTimeout(r *http.Request) (graph.Timeout, string) {
+	t := graph.Timeout{
+		Duration: strings.TrimSpace(r.FormValue("TimeoutDuration")),
+		Action:   r.FormValue("TimeoutAction"),
+	}
+	if t.Duration == "" {
+		return graph.Timeout{}, ""
+	}
+	if d, err := time.ParseDuration(t.Duration); err != nil || d <= 0 {
+		return t, fmt.Sprintf("%q is not a positive duration, such as 30s or 1m30s.", t.Duration)
+	}
+	switch t.Action {
+	case graph.TimeoutSkip, graph.TimeoutCancel:
+	case graph.TimeoutError:
+		t.Errors = strings.TrimSpace(r.FormValue("TimeoutErrors"))
+		if t.Errors == "" {
+			return t, "Choose a channel to send errors to."
+		}
+	default:
+		return t, fmt.Sprintf("Unknown action %q.", t.Action)
+	}
+	return t, ""
+}
+
+// nodeCode writes the Go generated for n. When POSTed the node editor's form,
+// it is the Go the node would generate once saved; nothing is changed.
+func nodeCode(g *graph.Graph, n *graph.Node, w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		if n.Name != "" {
+			// Work on a copy of the graph, so the node is left alone.
+			h, err := g.Clone()
+			if err != nil {
+				log.Printf("Could not copy graph: %v", err)
+				http.Error(w, fmt.Sprintf("Could not copy graph: %v", err), http.StatusInternalServerError)
+				return
+			}
+			g, n = h, h.Nodes[n.Name]
+		}
+		if err := n.Part.Update(r); err != nil {
+			http.Error(w, fmt.Sprintf("Could not update part: %v", err), http.StatusBadRequest)
+			return
+		}
+		mult, err := strconv.Atoi(r.FormValue("Multiplicity"))
+		if err != nil || mult < 1 {
+			mult = 1
+		}
+		setNodeFields(n, r, mult)
+		if res, msg := nodeResources(r); msg == "" {
+			n.Resources = res
+		}
+		if t, msg := nodeTimeout(r); msg == "" {
+			n.Timeout = t
+		}
+		if nm := strings.TrimSpace(r.FormValue("Name")); nm != "" {
+			n.Name = nm
+		}
+	}
+	code, err := g.NodeGo(n)
+	if code == "" && err != nil {
+		log.Printf("Could not generate code: %v", err)
+		http.Error(w, fmt.Sprintf("Could not generate code: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		fmt.Fprintf(w, "// Could not format: %v\n\n", err)
+	}
+	io.WriteString(w, code)
+}
+
+// syntaxError is a syntax error in code being edited, as sent to the editor.
+type syntaxError struct {
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Msg    string `json:"msg"`
+}
+
+// nodeSyntax checks the syntax of the POSTed Code, as the implementation of
+// n, and responds with a JSON list of errors.
+func nodeSyntax(g *graph.Graph, n *graph.Node, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Syntax checks must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	errs, err := g.SyntaxCheckNode(n, r.FormValue("Code"))
+	if err != nil {
+		log.Printf("Could not check syntax: %v", err)
+		http.Error(w, fmt.Sprintf("Could not check syntax: %v", err), http.StatusInternalServerError)
+		return
+	}
+	res := make([]syntaxError, 0, len(errs))
+	for _, e := range errs {
+		res = append(res, syntaxError{Line: e.Line, Column: e.Column, Msg: e.Msg})
+	}
+	apiRespond(w, http.StatusOK, res)
+}
+
+// nodeComplete responds with a JSON list of completions for the identifier
+// at the POSTed line and ch (as counted by the editor: from zero, in UTF-16
+// code units) in the POSTed Code, as the implementation of n.
+func nodeComplete(g *graph.Graph, n *graph.Node, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Completions must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	line, err := strconv.Atoi(r.FormValue("line"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad line: %v", err), http.StatusBadRequest)
+		return
+	}
+	ch, err := strconv.Atoi(r.FormValue("ch"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad ch: %v", err), http.StatusBadRequest)
+		return
+	}
+	code := r.FormValue("Code")
+	cs, err := g.CompleteNode(n, code, byteOffset(code, line, ch))
+	if err != nil {
+		log.Printf("Could not complete: %v", err)
+		http.Error(w, fmt.Sprintf("Could not complete: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if cs == nil {
+		cs = []source.Completion{}
+	}
+	apiRespond(w, http.StatusOK, cs)
+}
+
+// byteOffset converts a line and a column in UTF-16 code units, both counted
+// from zero, to a byte offset into s.
+func byteOffset(s string, line, ch int) int {
+	off := 0
+	for ; line > 0; line-- {
+		i := strings.IndexByte(s[off:], '\n')
+		if i < 0 {
+			return len(s)
+		}
+		off += i + 1
+	}
+	for _, r := range s[off:] {
+		if ch <= 0 || r == '\n' {
+			break
+		}
+		ch--
+		if r >= 0x10000 {
+			// Takes a surrogate pair.
+			ch--
+		}
+		off += utf8.RuneLen(r)
+	}
+	return off
+}
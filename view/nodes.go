@@ -0,0 +1,162 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const nodesTemplateSrc = `<head>
+	<title>{{.Graph.Name}} goroutines</title><style>` + css + `</style>
+</head>
+<body>
+<h1>{{.Graph.Name}} goroutines</h1>
+<a href="?">Return</a> | <a href="?node=new">New goroutine</a>
+<form method="get" class="search">
+	<input type="hidden" name="nodes">
+	<input type="hidden" name="sort" value="{{.Sort}}">
+	<input type="text" name="filter" value="{{.Filter}}" placeholder="Filter by name, part type, or channel">
+</form>
+<table class="results">
+	<tr>
+		{{range .Columns -}}
+		<th><a href="?nodes&amp;sort={{.Key}}{{if and (eq .Key $.Sort) (not $.Desc)}}&amp;desc{{end}}&amp;filter={{$.Filter}}">{{.Title}}</a></th>
+		{{- end}}
+	</tr>
+	{{range .Rows -}}
+	<tr>
+		<td><a href="?node={{.Name}}" title="{{.Doc}}">{{.Name}}</a></td>
+		<td>{{.PartType}}</td>
+		<td>{{if .Wait}}✓{{end}}</td>
+		<td>{{.Multiplicity}}</td>
+		<td>{{range .In}}<a href="?channel={{.}}">{{.}}</a> {{end}}</td>
+		<td>{{range .Out}}<a href="?channel={{.}}">{{.}}</a> {{end}}</td>
+		<td>{{.Lines}}</td>
+	</tr>
+	{{- end}}
+</table>
+</body>`
+
+var nodesTemplate = template.Must(template.New("nodes").Funcs(templateFuncs).Parse(nodesTemplateSrc))
+
+type nodeRow struct {
+	Name, PartType string
+	Doc            string
+	Wait           bool
+	Multiplicity   uint
+	In, Out        []string
+	Lines          int
+}
+
+// matches reports whether the row matches a (lowercase) filter.
+func (r *nodeRow) matches(f string) bool {
+	if f == "" {
+		return true
+	}
+	fields := append([]string{r.Name, r.PartType}, r.In...)
+	for _, s := range append(fields, r.Out...) {
+		if strings.Contains(strings.ToLower(s), f) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeColumns are the sortable columns, with functions ordering rows by each.
+var nodeColumns = []struct {
+	Key, Title string
+	less       func(a, b *nodeRow) bool
+}{
+	{"name", "Name", func(a, b *nodeRow) bool { return a.Name < b.Name }},
+	{"part", "Part", func(a, b *nodeRow) bool { return a.PartType < b.PartType }},
+	{"wait", "Wait", func(a, b *nodeRow) bool { return !a.Wait && b.Wait }},
+	{"mult", "Multiplicity", func(a, b *nodeRow) bool { return a.Multiplicity < b.Multiplicity }},
+	{"in", "Reads", func(a, b *nodeRow) bool { return len(a.In) < len(b.In) }},
+	{"out", "Writes", func(a, b *nodeRow) bool { return len(a.Out) < len(b.Out) }},
+	{"lines", "Lines", func(a, b *nodeRow) bool { return a.Lines < b.Lines }},
+}
+
+// Nodes handles listing all the nodes in a table.
+func Nodes(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	d := &struct {
+		Graph   *graph.Graph
+		Sort    string
+		Desc    bool
+		Filter  string
+		Columns interface{}
+		Rows    []*nodeRow
+	}{
+		Graph:   g,
+		Sort:    q.Get("sort"),
+		Filter:  q.Get("filter"),
+		Columns: nodeColumns,
+	}
+	_, d.Desc = q["desc"]
+	if d.Sort == "" {
+		d.Sort = "name"
+	}
+
+	f := strings.ToLower(d.Filter)
+	for _, n := range g.Nodes {
+		row := &nodeRow{
+			Name:         n.Name,
+			PartType:     n.TypeKey(),
+			Doc:          n.Doc,
+			Wait:         g.Waited(n),
+			Multiplicity: n.Multiplicity,
+			In:           g.DeclaredChannels(n.ChannelsRead()),
+			Out:          g.DeclaredChannels(n.ChannelsWritten()),
+		}
+		if impl := strings.TrimSpace(n.Impl()); impl != "" {
+			row.Lines = strings.Count(impl, "\n") + 1
+		}
+		if row.matches(f) {
+			d.Rows = append(d.Rows, row)
+		}
+	}
+
+	less := nodeColumns[0].less
+	for _, c := range nodeColumns {
+		if c.Key == d.Sort {
+			less = c.less
+		}
+	}
+	sort.SliceStable(d.Rows, func(i, j int) bool {
+		a, b := d.Rows[i], d.Rows[j]
+		if d.Desc {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		// Break ties by name, always ascending.
+		return d.Rows[i].Name < d.Rows[j].Name
+	})
+
+	if err := nodesTemplate.Execute(w, d); err != nil {
+		log.Printf("Could not execute nodes template: %v", err)
+		http.Error(w, "Could not execute nodes template", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/google/shenzhen-go/parts"
+)
+
+const partsTemplateSrc = `<head>
+	<title>Parts</title><style>` + css + `</style>
+</head>
+<body>
+<h1>Parts</h1>
+<p>The kinds of goroutine that can be added to a graph.</p>
+{{range .}}
+<h2 id="{{.Type}}">{{with .Style.Icon}}{{.}} {{end}}{{.Name}}{{if ne .Name .Type}} ({{.Type}}){{end}}</h2>
+{{with .Description}}<p>{{.}}</p>{{end}}
+{{with .Fields}}<dl>
+	{{range .}}<dt>{{.Field}}</dt><dd>{{.Help}}</dd>{{end}}
+</dl>{{end}}
+{{- end}}
+</body>`
+
+var partsTemplate = template.Must(template.New("parts").Funcs(templateFuncs).Parse(partsTemplateSrc))
+
+// partField is the help for a field of a part type, in /parts?json.
+type partField struct {
+	Field string `json:"field"`
+	Help  string `json:"help"`
+}
+
+// partType describes a part type, in /parts?json.
+type partType struct {
+	Type        string      `json:"type"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Icon        string      `json:"icon,omitempty"`
+	Fields      []partField `json:"fields,omitempty"`
+}
+
+// Parts serves a catalog of the registered part types. With ?json, it is a
+// JSON list.
+var Parts = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	type entry struct {
+		parts.Metadata
+		Type  string
+		Style parts.Style
+	}
+	var es []entry
+	for _, t := range parts.TypeKeys() {
+		s, _ := parts.StyleOf(t)
+		es = append(es, entry{
+			Metadata: parts.Describe(t),
+			Type:     t,
+			Style:    s,
+		})
+	}
+	if _, j := r.URL.Query()["json"]; j {
+		pts := make([]partType, 0, len(es))
+		for _, e := range es {
+			pt := partType{Type: e.Type, Name: e.Name, Description: e.Description, Icon: e.Style.Icon}
+			for _, f := range e.Fields {
+				pt.Fields = append(pt.Fields, partField{Field: f.Field, Help: f.Help})
+			}
+			pts = append(pts, pt)
+		}
+		apiRespond(w, http.StatusOK, pts)
+		return
+	}
+	if err := partsTemplate.Execute(w, es); err != nil {
+		log.Printf("Could not execute parts template: %v", err)
+		http.Error(w, "Could not execute parts template", http.StatusInternalServerError)
+	}
+})
@@ -0,0 +1,115 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// A preview is someone's private copy of a graph, which they edit without
+// disturbing anyone else until they apply it.
+type preview struct {
+	base  *graph.Graph // The shared graph, when the preview started.
+	graph *graph.Graph // The private copy being edited.
+}
+
+type previewKey struct {
+	path, user string
+}
+
+type previewingKey struct{}
+
+// previewing reports whether r is for someone's private preview, rather than
+// the shared graph.
+func previewing(r *http.Request) bool {
+	p, _ := r.Context().Value(previewingKey{}).(bool)
+	return p
+}
+
+// previewed picks the version of the graph at path that r is for: the user's
+// preview, if they have one (unless they asked for the ?shared version), or
+// else g. It also handles POSTs starting (?preview=start), applying
+// (?preview=apply), and discarding (?preview=discard) previews, in which case
+// it returns nil.
+func (b *dirBrowser) previewed(g *graph.Graph, path, user string, w http.ResponseWriter, r *http.Request) (*graph.Graph, *http.Request) {
+	q := r.URL.Query()
+	k := previewKey{path, user}
+	b.mu.Lock()
+	p := b.previews[k]
+	b.mu.Unlock()
+	back := func() {
+		u := *r.URL
+		u.RawQuery = ""
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	}
+	switch q.Get("preview") {
+	case "start", "apply", "discard":
+		if r.Method != "POST" {
+			http.Error(w, fmt.Sprintf("Unsupported method %s", r.Method), http.StatusMethodNotAllowed)
+			return nil, r
+		}
+	}
+	switch {
+	case q.Get("preview") == "start":
+		if p == nil {
+			var err error
+			p = new(preview)
+			if p.base, err = g.Clone(); err == nil {
+				p.graph, err = g.Clone()
+			}
+			if err != nil {
+				log.Printf("Could not copy graph: %v", err)
+				http.Error(w, fmt.Sprintf("Could not copy graph: %v", err), http.StatusInternalServerError)
+				return nil, r
+			}
+			b.setPreview(k, p)
+		}
+		back()
+		return nil, r
+
+	case q.Get("preview") == "apply":
+		if p != nil {
+			g.ApplyChanges(p.base, p.graph)
+			b.setPreview(k, nil)
+		}
+		back()
+		return nil, r
+
+	case q.Get("preview") == "discard":
+		b.setPreview(k, nil)
+		back()
+		return nil, r
+	}
+	if _, shared := q["shared"]; shared || p == nil {
+		return g, r
+	}
+	return p.graph, r.WithContext(context.WithValue(r.Context(), previewingKey{}, true))
+}
+
+// setPreview records p as the preview for k, or if p is nil, forgets it.
+func (b *dirBrowser) setPreview(k previewKey, p *preview) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p == nil {
+		delete(b.previews, k)
+		return
+	}
+	b.previews[k] = p
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPreviewNeedsPost(t *testing.T) {
+	ts := serveGraphs(t, map[string]string{"test.szgo": testGraphJSON})
+	c := ts.Client()
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	do := func(method, query string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+"/test.szgo"+query, nil)
+		if err != nil {
+			t.Fatalf("NewRequest = %v", err)
+		}
+		req.SetBasicAuth("alice", "")
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s = %v", method, query, err)
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("%s %s: reading body: %v", method, query, err)
+		}
+		return resp.StatusCode, string(b)
+	}
+	previewing := func() bool {
+		t.Helper()
+		code, body := do("GET", "")
+		if code != http.StatusOK {
+			t.Fatalf("GET graph status = %d, want %d", code, http.StatusOK)
+		}
+		return strings.Contains(body, "Previewing:")
+	}
+
+	if previewing() {
+		t.Fatal("previewing before starting a preview")
+	}
+	for _, op := range []string{"start", "apply", "discard"} {
+		if code, _ := do("GET", "?preview="+op); code != http.StatusMethodNotAllowed {
+			t.Errorf("GET ?preview=%s status = %d, want %d", op, code, http.StatusMethodNotAllowed)
+		}
+	}
+	if previewing() {
+		t.Error("GET ?preview=start started a preview")
+	}
+
+	if code, _ := do("POST", "?preview=start"); code != http.StatusFound {
+		t.Errorf("POST ?preview=start status = %d, want %d", code, http.StatusFound)
+	}
+	if !previewing() {
+		t.Error("POST ?preview=start didn't start a preview")
+	}
+	do("GET", "?preview=discard")
+	if !previewing() {
+		t.Error("GET ?preview=discard discarded the preview")
+	}
+	if code, _ := do("POST", "?preview=discard"); code != http.StatusFound {
+		t.Errorf("POST ?preview=discard status = %d, want %d", code, http.StatusFound)
+	}
+	if previewing() {
+		t.Error("POST ?preview=discard didn't discard the preview")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Protocol buffer wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protoMessage is a protocol buffer message in the wire format, built up a
+// field at a time. Only the few kinds of field the admin service sends are
+// supported. As in proto3, fields with zero values are left out.
+type protoMessage []byte
+
+func (m *protoMessage) key(field, wireType int) {
+	*m = binary.AppendUvarint(*m, uint64(field<<3|wireType))
+}
+
+// Uint adds an integer (or enum) field.
+func (m *protoMessage) Uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	m.key(field, protoVarint)
+	*m = binary.AppendUvarint(*m, v)
+}
+
+// Bool adds a bool field.
+func (m *protoMessage) Bool(field int, v bool) {
+	if v {
+		m.Uint(field, 1)
+	}
+}
+
+// String adds a string field.
+func (m *protoMessage) String(field int, s string) {
+	if s != "" {
+		m.Bytes(field, []byte(s))
+	}
+}
+
+// Bytes adds a length-delimited field: bytes, a string, or a message. Unlike
+// the others, it is added even if empty, as elements of repeated fields must
+// be.
+func (m *protoMessage) Bytes(field int, b []byte) {
+	m.key(field, protoBytes)
+	*m = binary.AppendUvarint(*m, uint64(len(b)))
+	*m = append(*m, b...)
+}
+
+var errBadProto = errors.New("invalid protocol buffer")
+
+// protoStrings decodes a message in the wire format, returning the last
+// value of each length-delimited field (strings, bytes, and messages) by
+// field number. Other fields are skipped.
+func protoStrings(b []byte) (map[int]string, error) {
+	fs := make(map[int]string)
+	for len(b) > 0 {
+		k, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errBadProto
+		}
+		b = b[n:]
+		switch k & 7 {
+		case protoVarint:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return nil, errBadProto
+			}
+		case protoFixed64:
+			n = 8
+		case protoFixed32:
+			n = 4
+		case protoBytes:
+			l, m := binary.Uvarint(b)
+			if m <= 0 || l > uint64(len(b)-m) {
+				return nil, errBadProto
+			}
+			fs[int(k>>3)] = string(b[m : m+int(l)])
+			n = m + int(l)
+		default:
+			return nil, errBadProto
+		}
+		if n > len(b) {
+			return nil, errBadProto
+		}
+		b = b[n:]
+	}
+	return fs, nil
+}
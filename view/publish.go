@@ -0,0 +1,76 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const publishTemplateSrc = `<head>
+	<title>Publish {{.Graph.Name}} as a part</title><style>` + css + `</style>
+</head>
+<body>
+<h1>Publish {{.Graph.Name}} as a part</h1>
+<p>This saves a copy of the graph as a new part type, offered when making a
+goroutine in any graph. Its input and output channels become the part's
+connections. Later changes to this graph don't change the part.</p>
+{{with .Error}}<div class="errors"><p>{{.}}</p></div>{{end}}
+<form method="post">
+	<div class="formfield">
+		<label for="Name">Part type</label>
+		<input type="text" name="Name" required pattern="[_a-zA-Z][_a-zA-Z0-9]*" value="{{.Name}}">
+	</div>
+	<div class="formfield hcentre">
+		<input type="submit" value="Publish">
+		<input type="button" value="Return" onclick="window.location.href='?'">
+	</div>
+</form>
+</body>`
+
+var publishTemplate = template.Must(template.New("publish").Funcs(templateFuncs).Parse(publishTemplateSrc))
+
+// PublishMacro handles publishing a graph as a macro part.
+func PublishMacro(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	d := struct {
+		Graph       *graph.Graph
+		Name, Error string
+	}{Graph: g}
+	if r.Method == "POST" {
+		d.Name = strings.TrimSpace(r.FormValue("Name"))
+		if err := g.PublishMacro(d.Name); err != nil {
+			d.Error = err.Error()
+		} else {
+			http.Redirect(w, r, BasePath+"/parts#"+d.Name, http.StatusSeeOther)
+			return
+		}
+	} else {
+		// Suggest a name from the file name, e.g. "primes.szgo" -> "Primes".
+		n := strings.TrimSuffix(filepath.Base(g.SourcePath), filepath.Ext(g.SourcePath))
+		if n != "" {
+			n = strings.ToUpper(n[:1]) + n[1:]
+		}
+		d.Name = n
+	}
+	if err := publishTemplate.Execute(w, d); err != nil {
+		log.Printf("Could not execute publish template: %v", err)
+		http.Error(w, "Could not execute publish template", http.StatusInternalServerError)
+	}
+}
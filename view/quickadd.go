@@ -0,0 +1,142 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/shenzhen-go/graph"
+	"github.com/google/shenzhen-go/parts"
+)
+
+// quickAddMatch is something the quick-add palette can add: a part type or a
+// snippet.
+type quickAddMatch struct {
+	Kind        string `json:"kind"` // "part" or "snippet"
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Description string `json:"description,omitempty"`
+	score       int
+}
+
+// fuzzyScore scores how well pattern matches s, or returns -1 if it doesn't.
+// The runes of pattern must appear in s in order, ignoring case. Matches are
+// better the more runes are consecutive, or at the start of words.
+func fuzzyScore(pattern, s string) int {
+	p := []rune(strings.ToLower(pattern))
+	if len(p) == 0 {
+		return 0
+	}
+	score, i, last := 0, 0, -2
+	prev := ' '
+	for j, r := range []rune(s) {
+		if i < len(p) && unicode.ToLower(r) == p[i] {
+			score++
+			if last == j-1 {
+				score += 2
+			}
+			if !unicode.IsLetter(prev) || (unicode.IsUpper(r) && unicode.IsLower(prev)) {
+				score += 3
+			}
+			last = j
+			i++
+		}
+		prev = r
+	}
+	if i < len(p) {
+		return -1
+	}
+	return score
+}
+
+// QuickAdd handles the quick-add palette. GET ?quickadd=pattern lists the part
+// types and snippets best matching the pattern, as JSON. POST ?quickadd with
+// kind and name (as in the list) adds a goroutine of that part type, or from
+// that snippet, connected from the goroutine called from (if given). It
+// responds with the JSON of the new goroutine.
+func QuickAdd(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		quickAddList(w, r.URL.Query().Get("quickadd"))
+	case "POST":
+		quickAddNode(g, w, r)
+	default:
+		apiFail(w, http.StatusMethodNotAllowed, "unsupported method %s", r.Method)
+	}
+}
+
+func quickAddList(w http.ResponseWriter, pattern string) {
+	ms := []quickAddMatch{}
+	for _, t := range parts.TypeKeys() {
+		m := parts.Describe(t)
+		s := fuzzyScore(pattern, m.Name)
+		if ts := fuzzyScore(pattern, t); ts > s {
+			s = ts
+		}
+		if s >= 0 {
+			ms = append(ms, quickAddMatch{Kind: "part", Name: t, Label: m.Name, Description: m.Description, score: s})
+		}
+	}
+	snips, err := graph.Snippets()
+	if err != nil {
+		// Parts alone are still useful.
+		log.Printf("Could not list snippets: %v", err)
+	}
+	for _, sn := range snips {
+		if s := fuzzyScore(pattern, sn); s >= 0 {
+			ms = append(ms, quickAddMatch{Kind: "snippet", Name: sn, Label: sn, Description: "Snippet", score: s})
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].score > ms[j].score })
+	apiRespond(w, http.StatusOK, ms)
+}
+
+func quickAddNode(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	var n *graph.Node
+	name := r.FormValue("name")
+	switch kind := r.FormValue("kind"); kind {
+	case "part":
+		pf, ok := parts.Lookup(name)
+		if !ok {
+			apiFail(w, http.StatusBadRequest, "unknown part type %q", name)
+			return
+		}
+		p, ok := pf().(graph.Part)
+		if !ok {
+			apiFail(w, http.StatusInternalServerError, "%s parts are not goroutines", name)
+			return
+		}
+		n = &graph.Node{Name: parts.Describe(name).Name, Part: p}
+	case "snippet":
+		var err error
+		if n, err = graph.LoadSnippet(name); err != nil {
+			apiFail(w, http.StatusBadRequest, "could not load snippet %q: %v", name, err)
+			return
+		}
+	default:
+		apiFail(w, http.StatusBadRequest, "unknown kind %q", kind)
+		return
+	}
+	n, _, err := g.AddAfter(n, r.FormValue("from"))
+	if err != nil {
+		apiFail(w, http.StatusBadRequest, "could not add goroutine: %v", err)
+		return
+	}
+	apiRespond(w, http.StatusCreated, n)
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os/exec"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const reportTemplateSrc = `<head>
+	<title>{{.Graph.Name}}</title><style>` + css + `
+	@media print {
+		body { max-width: none; }
+		a { color: inherit; text-decoration: none; }
+		div.noprint { display: none; }
+		h2 { page-break-before: always; }
+		pre { page-break-inside: avoid; }
+	}
+	table.report { border-collapse: collapse; }
+	table.report th, table.report td {
+		border: 1px solid var(--fg, black);
+		padding: 2px 8px;
+		text-align: left;
+		vertical-align: top;
+	}
+	</style>
+</head>
+<body>
+<div class="noprint"><a href="?">Return</a> | <a href="?report=pdf">PDF</a></div>
+{{with .Graph -}}
+<h1>{{.Name}}</h1>
+<p>Package <code>{{.PackagePath}}</code>{{with .SourcePath}}, from <code>{{.}}</code>{{end}}.</p>
+<div>{{$.Diagram}}</div>
+
+{{if .Imports}}<p>Imports: {{range $i, $imp := .Imports}}{{if $i}}, {{end}}<code>{{$imp}}</code>{{end}}</p>{{end}}
+{{with .ParamDecls}}<h3>Parameters</h3>
+<div class="beforeafter"><pre>{{range .}}{{.}}
+{{end}}</pre></div>{{end}}
+{{with .Declarations}}<h3>Declarations</h3>
+<div class="beforeafter"><pre>{{.}}</pre></div>{{end}}
+
+<h2>Channels</h2>
+<table class="report">
+	<tr><th>Name</th><th>Type</th><th>Capacity</th><th>Written by</th><th>Read by</th></tr>
+	{{range .Channels -}}
+	<tr>
+		<td id="channel-{{.Name}}"><code>{{.Name}}</code>{{with .Boundary}} ({{.}}){{end}}</td>
+		<td><code>{{.Type}}</code></td>
+		<td>{{.CapSource}}</td>
+		<td>{{range $.Graph.Writers .Name}}<a href="#node-{{.Name}}">{{.Name}}</a><br>{{else}}—{{end}}</td>
+		<td>{{range $.Graph.Readers .Name}}<a href="#node-{{.Name}}">{{.Name}}</a><br>{{else}}—{{end}}</td>
+	</tr>
+	{{- end}}
+</table>
+
+<h2>Goroutines</h2>
+{{range .Nodes}}
+<h3 id="node-{{.Name}}">{{.Name}}</h3>
+<p>{{.Part.TypeKey}} part{{if gt .Multiplicity 1}}, {{.Multiplicity}} instances{{end}}{{if $.Graph.Waited .}}, waited for{{end}}{{if .Disabled}}, <em>disabled</em>{{end}}{{with .Group}}, in group {{.}}{{end}}{{if not .Resources.IsZero}}, resources: {{.Resources}}{{end}}{{if not .Timeout.IsZero}}, timeout: {{.Timeout}}{{end}}.</p>
+{{range .DocLines}}<p>{{.}}</p>{{end}}
+<p>
+	Reads: {{range $.Graph.DeclaredChannels .ChannelsRead}}<a href="#channel-{{.}}"><code>{{.}}</code></a> {{else}}nothing{{end}}<br>
+	Writes: {{range $.Graph.DeclaredChannels .ChannelsWritten}}<a href="#channel-{{.}}"><code>{{.}}</code></a> {{else}}nothing{{end}}
+</p>
+<div class="beforeafter"><pre>{{.Impl}}</pre></div>
+{{end}}
+{{- end}}
+
+{{with .Diagnostics}}
+<h2>Problems</h2>
+<div class="diagnostics">
+	<ul>
+		{{range .}}<li class="{{.Severity}}">{{.}}</li>{{end}}
+	</ul>
+</div>
+{{end}}
+</body>`
+
+var reportTemplate = template.Must(template.New("report").Funcs(templateFuncs).Parse(reportTemplateSrc))
+
+// Report handles producing a printable report on the graph, with the
+// diagram, documentation, and code of every goroutine, and a table of
+// channels. ?report=pdf converts it to PDF with wkhtmltopdf.
+func Report(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	var svg bytes.Buffer
+	if err := renderDiagram(&svg, g); err != nil {
+		log.Printf("Could not render diagram: %v", err)
+		http.Error(w, fmt.Sprintf("Could not render diagram: %v", err), http.StatusInternalServerError)
+		return
+	}
+	d := &struct {
+		Graph       *graph.Graph
+		Diagram     template.HTML
+		Diagnostics []graph.Diagnostic
+	}{g, template.HTML(svg.String()), g.Check()}
+
+	if r.URL.Query().Get("report") != "pdf" {
+		if err := reportTemplate.Execute(w, d); err != nil {
+			log.Printf("Could not execute report template: %v", err)
+			http.Error(w, "Could not execute report template", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var page, pdf bytes.Buffer
+	if err := reportTemplate.Execute(&page, d); err != nil {
+		log.Printf("Could not execute report template: %v", err)
+		http.Error(w, "Could not execute report template", http.StatusInternalServerError)
+		return
+	}
+	if err := pipeThru(&pdf, exec.Command("wkhtmltopdf", "--quiet", "--print-media-type", "-", "-"), &page); err != nil {
+		msg := fmt.Sprintf("Could not convert report to PDF (is wkhtmltopdf installed?): %v", err)
+		log.Print(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/pdf")
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", g.PackageName()+"-report.pdf"))
+	pdf.WriteTo(w)
+}
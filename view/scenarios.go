@@ -0,0 +1,316 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// ScenariosTimeout limits how long running all the scenarios may take,
+// including building them.
+var ScenariosTimeout = 5 * time.Minute
+
+const scenariosTemplateSrc = `<head>
+	<title>{{.Graph.Name}} scenarios</title><style>` + css + `</style>
+</head>
+<body>
+<h1>{{.Graph.Name}} scenarios</h1>
+<a href="?">Return</a> | <a href="?scenario=new">New scenario</a>
+<p>Each scenario sends values to the graph's inputs, and checks the values
+its outputs send before Run returns and they are closed. The generated
+package gets a test of each.</p>
+{{with .Error}}<div class="errors"><p>{{.}}</p></div>{{end}}
+{{if .Rows}}
+<table class="results">
+	<tr><th>Scenario</th><th>Inputs</th><th>Expected</th><th>Timeout</th>{{if .Ran}}<th>Result</th>{{end}}</tr>
+	{{range .Rows -}}
+	<tr>
+		<td><a href="?scenario={{.Name}}">{{.Name}}</a></td>
+		<td>{{range .Inputs}}{{.}}<br>{{end}}</td>
+		<td>{{range .Outputs}}{{.}}<br>{{end}}</td>
+		<td>{{.Timeout}}</td>
+		{{if $.Ran}}{{with .Result}}
+		<td>{{if .Passed}}passed{{else}}<details><summary>failed</summary><pre>{{.Output}}</pre></details>{{end}}</td>
+		{{- else}}<td>not run</td>{{end}}{{end}}
+	</tr>
+	{{- end}}
+</table>
+{{if .AllowBuild}}
+<form method="post">
+	<div class="formfield hcentre">
+		<input type="submit" value="Run scenarios">
+	</div>
+</form>
+{{end}}
+{{else}}
+<p>There are no scenarios yet.</p>
+{{end}}
+</body>`
+
+const scenarioEditorTemplateSrc = `<head>
+	<title>{{if .Name}}{{.Name}}{{else}}[New scenario]{{end}}</title><style>` + css + `</style>
+</head>
+<body>
+<h1>{{if .Name}}{{.Name}}{{else}}[New scenario]{{end}}</h1>
+<a href="?scenarios">Return to the scenarios</a>
+{{with .Error}}<div class="errors"><p>{{.}}</p></div>{{end}}
+<form method="post">
+	<div class="formfield">
+		<label for="Name">Name</label>
+		<input type="text" name="Name" required value="{{.Scenario.Name}}">
+	</div>
+	<div class="formfield">
+		<label for="Timeout">Timeout</label>
+		<input type="text" name="Timeout" value="{{.Scenario.Timeout}}" placeholder="{{.DefaultTimeout}}">
+	</div>
+	<h2>Inputs</h2>
+	{{range .Inputs}}
+	<div class="formfield">
+		<label for="in_{{.Name}}">{{.Name}} ({{.Type}})</label>
+		<textarea name="in_{{.Name}}" rows="5" cols="40" placeholder="One Go expression per line">{{index $.Values (print "in_" .Name)}}</textarea>
+		{{with .Fixture}}<div class="hint">If empty, the channel's samples: {{.}}</div>{{end}}
+	</div>
+	{{else}}
+	<p>The graph has no inputs. Make a channel an input in its editor.</p>
+	{{end}}
+	<h2>Expected outputs</h2>
+	{{range .Outputs}}
+	<div class="formfield">
+		<label for="out_{{.Name}}">{{.Name}} ({{.Type}})</label>
+		<textarea name="out_{{.Name}}" rows="5" cols="40" placeholder="One Go expression per line">{{index $.Values (print "out_" .Name)}}</textarea>
+		<label><input type="checkbox" name="check_{{.Name}}" value="true" {{if index $.Checked .Name}}checked{{end}}> Check</label>
+		<div class="hint">Unchecked, whatever is sent is accepted. Checked and empty, nothing may be sent.</div>
+	</div>
+	{{else}}
+	<p>The graph has no outputs. Make a channel an output in its editor.</p>
+	{{end}}
+	<div class="formfield hcentre">
+		<input type="submit" value="Save">
+	</div>
+</form>
+{{if .Name}}<a href="?scenario={{.Name}}&amp;delete">Delete this scenario</a>{{end}}
+</body>`
+
+var (
+	scenariosTemplate      = template.Must(template.New("scenarios").Funcs(templateFuncs).Parse(scenariosTemplateSrc))
+	scenarioEditorTemplate = template.Must(template.New("scenarioEditor").Funcs(templateFuncs).Parse(scenarioEditorTemplateSrc))
+)
+
+// Scenarios handles listing the scenarios of a graph, at ?scenarios. POSTing
+// runs them all (see graph.RunScenarios), and shows which passed.
+func Scenarios(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		// Others may edit the graph while the scenarios run.
+		var err error
+		if g, err = detachGraph(g, r); err != nil {
+			log.Printf("Could not copy graph: %v", err)
+			http.Error(w, fmt.Sprintf("Could not copy graph: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	type row struct {
+		Name            string
+		Inputs, Outputs []string
+		Timeout         string
+		Result          *graph.ScenarioResult
+	}
+	d := &struct {
+		Graph      *graph.Graph
+		AllowBuild bool
+		Rows       []*row
+		Ran        bool
+		Error      string
+	}{
+		Graph:      g,
+		AllowBuild: AllowBuild,
+	}
+	for _, s := range g.Scenarios {
+		rw := &row{Name: s.Name, Timeout: s.Timeout}
+		if rw.Timeout == "" {
+			rw.Timeout = graph.DefaultScenarioTimeout.String()
+		}
+		for _, c := range g.BoundaryChannels(graph.Input) {
+			if vs, given := s.Inputs[c.Name]; given {
+				rw.Inputs = append(rw.Inputs, c.Name+": "+strings.Join(vs, ", "))
+			} else if c.Fixture != nil {
+				rw.Inputs = append(rw.Inputs, c.Name+": samples")
+			}
+		}
+		for _, c := range g.BoundaryChannels(graph.Output) {
+			if vs, given := s.Outputs[c.Name]; given {
+				rw.Outputs = append(rw.Outputs, c.Name+": "+strings.Join(vs, ", "))
+			}
+		}
+		d.Rows = append(d.Rows, rw)
+	}
+	if r.Method == "POST" {
+		if !AllowBuild {
+			http.Error(w, "Building and running are disabled on this server", http.StatusForbidden)
+			return
+		}
+		ctx, cancel := context.WithTimeout(runCtx, ScenariosTimeout)
+		defer cancel()
+		done := stats.startRun()
+		rs, err := g.RunScenarios(ctx)
+		done(err)
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("stopped after %v", ScenariosTimeout)
+		}
+		d.Ran, d.Error = true, errString(err)
+		for i := range rs {
+			d.Rows[i].Result = &rs[i]
+		}
+	}
+	if err := scenariosTemplate.Execute(w, d); err != nil {
+		log.Printf("Could not execute scenarios template: %v", err)
+		http.Error(w, "Could not execute scenarios template", http.StatusInternalServerError)
+	}
+}
+
+// Scenario handles viewing and editing a scenario, at ?scenario=name (or
+// new). Values are POSTed in in_<channel> and out_<channel> fields, one Go
+// expression per line; outputs are only checked with check_<channel>.
+func Scenario(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("scenario")
+	s := g.Scenario(name)
+	if name != "new" && s == nil {
+		http.Error(w, fmt.Sprintf("Scenario %q not found", name), http.StatusNotFound)
+		return
+	}
+	back := func() {
+		u := *r.URL
+		u.RawQuery = "scenarios"
+		http.Redirect(w, r, u.String(), http.StatusSeeOther)
+	}
+	if _, del := r.URL.Query()["delete"]; del && s != nil {
+		g.DeleteScenario(name)
+		back()
+		return
+	}
+	d := &struct {
+		Name           string
+		Scenario       *graph.Scenario
+		Inputs         []*graph.Channel
+		Outputs        []*graph.Channel
+		Values         map[string]string // Of the textareas.
+		Checked        map[string]bool
+		DefaultTimeout time.Duration
+		Error          string
+	}{
+		Scenario:       s,
+		Inputs:         g.BoundaryChannels(graph.Input),
+		Outputs:        g.BoundaryChannels(graph.Output),
+		DefaultTimeout: graph.DefaultScenarioTimeout,
+	}
+	if s == nil {
+		d.Scenario = &graph.Scenario{Outputs: make(map[string][]string)}
+		for _, c := range d.Outputs {
+			d.Scenario.Outputs[c.Name] = nil
+		}
+	} else {
+		d.Name = s.Name
+	}
+	if r.Method == "POST" {
+		err := handleScenarioPost(g, s, d.Inputs, d.Outputs, r)
+		if err == nil {
+			back()
+			return
+		}
+		d.Error = err.Error()
+		// Show the values as submitted.
+		d.Scenario = scenarioFromForm(r, d.Inputs, d.Outputs)
+	}
+	d.Values, d.Checked = make(map[string]string), make(map[string]bool)
+	for c, vs := range d.Scenario.Inputs {
+		d.Values["in_"+c] = strings.Join(vs, "\n")
+	}
+	for c, vs := range d.Scenario.Outputs {
+		d.Values["out_"+c] = strings.Join(vs, "\n")
+		d.Checked[c] = true
+	}
+	if err := scenarioEditorTemplate.Execute(w, d); err != nil {
+		log.Printf("Could not execute scenario editor template: %v", err)
+		http.Error(w, "Could not execute scenario editor template", http.StatusInternalServerError)
+	}
+}
+
+// scenarioFromForm makes a scenario from the fields of the scenario editor.
+func scenarioFromForm(r *http.Request, inputs, outputs []*graph.Channel) *graph.Scenario {
+	s := &graph.Scenario{
+		Name:    strings.TrimSpace(r.PostFormValue("Name")),
+		Timeout: strings.TrimSpace(r.PostFormValue("Timeout")),
+	}
+	lines := func(text string) []string {
+		vs := []string{}
+		for _, l := range strings.Split(text, "\n") {
+			if l = strings.TrimSpace(l); l != "" {
+				vs = append(vs, l)
+			}
+		}
+		return vs
+	}
+	for _, c := range inputs {
+		if vs := lines(r.PostFormValue("in_" + c.Name)); len(vs) > 0 {
+			if s.Inputs == nil {
+				s.Inputs = make(map[string][]string)
+			}
+			s.Inputs[c.Name] = vs
+		}
+	}
+	for _, c := range outputs {
+		if r.PostFormValue("check_"+c.Name) == "true" {
+			if s.Outputs == nil {
+				s.Outputs = make(map[string][]string)
+			}
+			s.Outputs[c.Name] = lines(r.PostFormValue("out_" + c.Name))
+		}
+	}
+	return s
+}
+
+// handleScenarioPost updates the scenario s, or adds a new one if s is nil,
+// from the editor, leaving the graph alone if the result doesn't check.
+func handleScenarioPost(g *graph.Graph, s *graph.Scenario, inputs, outputs []*graph.Channel, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	n := scenarioFromForm(r, inputs, outputs)
+	if o := g.Scenario(n.Name); o != nil && o != s {
+		return fmt.Errorf("there is already a scenario called %q", n.Name)
+	}
+	if s == nil {
+		g.Scenarios = append(g.Scenarios, n)
+		if err := g.CheckScenario(n); err != nil {
+			g.DeleteScenario(n.Name)
+			return err
+		}
+		return nil
+	}
+	old := *s
+	*s = *n
+	if err := g.CheckScenario(s); err != nil {
+		*s = old
+		return err
+	}
+	return nil
+}
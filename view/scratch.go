@@ -0,0 +1,133 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// ScratchTimeout limits how long a goroutine run by itself may take,
+// including building it.
+var ScratchTimeout = time.Minute
+
+const scratchTemplateSrc = `<head>
+	<title>Try {{.Node}} in {{.Graph.Name}}</title><style>` + css + `</style>
+</head>
+<body>
+<h1>Try {{.Node}} by itself</h1>
+<a href="?">Return</a> | <a href="?node={{.Node}}">Edit {{.Node}}</a>
+<p>{{.Node}} is built and run on its own, with the samples below sent to the
+channels it reads (which are then closed), and what it sends to the channels it
+writes is printed.</p>
+<form method="post">
+	{{range .Inputs}}
+	<div class="formfield">
+		<label for="samples_{{.Name}}">{{.Name}} ({{.Type}})</label>
+		<textarea name="samples_{{.Name}}" rows="5" cols="40" placeholder="One Go expression per line">{{index $.Samples .Name}}</textarea>
+		{{with .Fixture}}<div class="hint">If empty, the channel's samples: {{.}}</div>{{end}}
+	</div>
+	{{else}}
+	<p>{{.Node}} doesn't read any channels.</p>
+	{{end}}
+	<div class="formfield hcentre">
+		<input type="submit" value="Run">
+	</div>
+</form>
+{{if .Ran}}
+<h2>{{if .Error}}Failed: {{.Error}}{{else}}Output{{end}}</h2>
+<pre>{{.Output}}</pre>
+{{end}}
+</body>`
+
+var scratchTemplate = template.Must(template.New("scratch").Funcs(templateFuncs).Parse(scratchTemplateSrc))
+
+// Scratch handles running a single node by itself (see graph.RunScratch), at
+// ?scratch=node. POSTing samples_<channel> fields, each with one Go
+// expression per line, runs it and shows the output. Channels without any
+// get the samples of their fixtures.
+func Scratch(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	if !AllowBuild {
+		http.Error(w, "Building and running are disabled on this server", http.StatusForbidden)
+		return
+	}
+	if r.Method == "POST" {
+		// Others may edit the graph while the goroutine runs.
+		var err error
+		if g, err = detachGraph(g, r); err != nil {
+			log.Printf("Could not copy graph: %v", err)
+			http.Error(w, fmt.Sprintf("Could not copy graph: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	name := r.URL.Query().Get("scratch")
+	h, err := g.Scratch(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	d := &struct {
+		Graph   *graph.Graph
+		Node    string
+		Inputs  []*graph.Channel
+		Samples map[string]string
+		Ran     bool
+		Output  string
+		Error   string
+	}{
+		Graph:   g,
+		Node:    name,
+		Inputs:  h.BoundaryChannels(graph.Input),
+		Samples: make(map[string]string),
+	}
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		samples := make(map[string][]string)
+		for _, c := range d.Inputs {
+			text := r.PostForm.Get("samples_" + c.Name)
+			d.Samples[c.Name] = text
+			for _, l := range strings.Split(text, "\n") {
+				if l = strings.TrimSpace(l); l != "" {
+					samples[c.Name] = append(samples[c.Name], l)
+				}
+			}
+		}
+		ctx, cancel := context.WithTimeout(runCtx, ScratchTimeout)
+		defer cancel()
+		var out bytes.Buffer
+		done := stats.startRun()
+		err := g.RunScratch(ctx, name, samples, &out, &out)
+		done(err)
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("stopped after %v", ScratchTimeout)
+		}
+		d.Ran, d.Output, d.Error = true, out.String(), errString(err)
+	}
+	if err := scratchTemplate.Execute(w, d); err != nil {
+		log.Printf("Could not execute scratch template: %v", err)
+		http.Error(w, "Could not execute scratch template", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const searchTemplateSrc = `<head>
+	<title>Search {{.Graph.Name}}</title><style>` + css + `</style>
+</head>
+<body>
+<h1>Search {{.Graph.Name}}</h1>
+<a href="?">Return</a>
+<form method="get">
+	<div class="formfield">
+		<label for="search">Find</label>
+		<input type="text" name="search" value="{{.Query}}" autofocus>
+	</div>
+	<div class="formfield">
+		<label for="replace">Replace with</label>
+		<input type="text" name="replace" value="{{.Replace}}">
+	</div>
+	<div class="formfield">
+		<label for="regexp">Regular expression</label>
+		<input type="checkbox" name="regexp" {{if .Regexp}}checked{{end}}>
+	</div>
+	<div class="formfield hcentre">
+		<input type="submit" value="Find">
+		<input type="submit" name="preview" value="Preview replacements">
+	</div>
+</form>
+{{if .Err -}}
+<div class="errors">{{.Err}}</div>
+{{- else if .Replacements -}}
+<form method="post">
+	<table class="results">
+		{{range .Replacements -}}
+		<tr>
+			<td><input type="checkbox" name="Match" value="{{.Index}}:{{.Node}}" checked></td>
+			<td><a href="?node={{.Node}}">{{.Node}}</a>:{{.Line}}</td>
+			<td><pre>{{.Before}}</pre><pre>{{.After}}</pre></td>
+		</tr>
+		{{- end}}
+	</table>
+	<div class="formfield hcentre">
+		<input type="submit" value="Replace selected">
+	</div>
+</form>
+{{- else if .Preview -}}
+<p>Nothing to replace in goroutine code.</p>
+{{- else if .Query -}}
+<table class="results">
+	{{range .Matches -}}
+	<tr>
+		<td>{{if .Node}}<a href="?node={{.Node}}">{{.Node}}</a>{{else}}<a href="?channel={{.Channel}}">{{.Channel}}</a>{{end}}</td>
+		<td>{{.Field}}{{if .Line}}:{{.Line}}{{end}}</td>
+		<td><code>{{.Text}}</code></td>
+	</tr>
+	{{- else}}
+	<tr><td>No matches.</td></tr>
+	{{- end}}
+</table>
+{{- end}}
+</body>`
+
+var searchTemplate = template.Must(template.New("search").Funcs(templateFuncs).Parse(searchTemplateSrc))
+
+// Search handles searching a graph, and replacing text in goroutine code.
+func Search(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	d := &struct {
+		Graph        *graph.Graph
+		Query        string
+		Replace      string
+		Regexp       bool
+		Preview      bool
+		Err          error
+		Matches      []graph.Match
+		Replacements []graph.Replacement
+	}{
+		Graph:   g,
+		Query:   q.Get("search"),
+		Replace: q.Get("replace"),
+		Regexp:  q.Get("regexp") == "on",
+	}
+	_, d.Preview = q["preview"]
+
+	if d.Query != "" {
+		rep := graph.LiteralReplacer(d.Query, d.Replace)
+		if d.Regexp {
+			re, err := regexp.Compile(d.Query)
+			if err != nil {
+				d.Err = err
+			}
+			rep = &graph.Replacer{Find: re, Replace: d.Replace}
+		}
+		if d.Err == nil {
+			switch {
+			case r.Method == "POST":
+				if err := handleReplacePost(g, rep, w, r); err != nil {
+					log.Printf("Could not replace: %v", err)
+					http.Error(w, fmt.Sprintf("Could not replace: %v", err), http.StatusInternalServerError)
+				}
+				return
+			case d.Preview:
+				d.Replacements = g.Replacements(rep)
+			case d.Regexp:
+				d.Matches = g.Search(rep.Find)
+			default:
+				d.Matches = g.Search(graph.SearchRegexp(d.Query))
+			}
+		}
+	}
+
+	if err := searchTemplate.Execute(w, d); err != nil {
+		log.Printf("Could not execute search template: %v", err)
+		http.Error(w, "Could not execute search template", http.StatusInternalServerError)
+	}
+}
+
+func handleReplacePost(g *graph.Graph, rep *graph.Replacer, w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	sel := make(map[string]bool)
+	for _, m := range r.PostForm["Match"] {
+		i := strings.Index(m, ":")
+		if i < 0 {
+			return fmt.Errorf("malformed match %q", m)
+		}
+		if _, err := strconv.Atoi(m[:i]); err != nil {
+			return fmt.Errorf("malformed match %q: %v", m, err)
+		}
+		sel[m] = true
+	}
+	changed, err := g.Replace(rep, func(node string, index int) bool {
+		return sel[fmt.Sprintf("%d:%s", index, node)]
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Replaced text in goroutines %q", changed)
+
+	u := *r.URL
+	u.RawQuery = ""
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+var (
+	// runCtx is cancelled to kill graphs being run.
+	runCtx, killRuns = context.WithCancel(context.Background())
+
+	// closing is closed when the server shuts down, to end WebSockets.
+	closing   = make(chan struct{})
+	closeOnce sync.Once
+
+	// unsavedGraphs lists graphs with changes that haven't been saved.
+	unsavedGraphs func() []string
+)
+
+// KillRuns stops any graphs being run, and any started later.
+func KillRuns() { killRuns() }
+
+// Shutdown ends the WebSockets (which http.Server.Shutdown doesn't track), and
+// warns about graphs with unsaved changes.
+func Shutdown() {
+	closeOnce.Do(func() { close(closing) })
+	if unsavedGraphs == nil {
+		return
+	}
+	for _, p := range unsavedGraphs() {
+		log.Printf("WARNING: %s has unsaved changes, which are lost", p)
+	}
+}
+
+// unsaved lists the loaded graphs which differ from their files.
+func (b *dirBrowser) unsaved() []string {
+	b.mu.Lock()
+	gs := make(map[string]*graph.Graph, len(b.loadedGraphs))
+	for p, g := range b.loadedGraphs {
+		gs[p] = g
+	}
+	b.mu.Unlock()
+
+	var ps []string
+	for p, g := range gs {
+		l := graphLock(p)
+		l.RLock()
+		saved, err := graph.LoadJSONFile(g.SourcePath)
+		if err != nil || !graph.Diff(saved, g).Empty() {
+			ps = append(ps, p)
+		}
+		l.RUnlock()
+	}
+	return ps
+}
@@ -0,0 +1,224 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// SimulateTimeout limits how long a simulation runs.
+var SimulateTimeout = 5 * time.Minute
+
+const simulateTemplateSrc = `<head>
+	<title>Simulate {{.Graph.Name}}</title><style>` + css + `
+	#diagram g.flash path { stroke: orange; stroke-width: 4; }
+	#diagram g.flash circle { fill: orange; }
+	#diagram g.blocked rect { stroke: red; stroke-width: 3; }
+	#output { max-height: 20em; overflow: auto; }
+	</style>
+</head>
+<body>
+<h1>Simulate {{.Graph.Name}}</h1>
+<a href="?">Return</a>
+<p>Shenzhen Go runs simple goroutines itself, so you can watch values flow
+without building. Goroutines outlined in red are waiting; numbers by channels
+are values waiting in their buffers.</p>
+<form id="start" class="search">
+	<label for="delay">Speed</label>
+	<select name="delay">
+		<option value="1000">Slow</option>
+		<option value="300" selected>Medium</option>
+		<option value="50">Fast</option>
+	</select>
+	<input type="submit" value="Start">
+</form>
+<div id="status"></div>
+<div id="diagram">{{.Diagram}}</div>
+<pre id="output"></pre>
+<script>
+(function() {
+	var div = document.getElementById('diagram'), out = document.getElementById('output');
+	var status = document.getElementById('status'), sock = null;
+	// Find the elements drawing each node and channel.
+	var nodes = {}, chans = {};
+	div.querySelectorAll('a').forEach(function(a) {
+		var href = a.getAttributeNS('http://www.w3.org/1999/xlink', 'href') || a.getAttribute('href') || '';
+		var q = new URLSearchParams(href.replace(/^\?/, '')), g = a.querySelector('g');
+		if (!g) return;
+		if (q.get('node')) (nodes[q.get('node')] = nodes[q.get('node')] || []).push(g);
+		if (q.get('channel')) (chans[q.get('channel')] = chans[q.get('channel')] || []).push(g);
+	});
+	function flash(els) {
+		(els || []).forEach(function(g) {
+			g.classList.add('flash');
+			setTimeout(function() { g.classList.remove('flash'); }, 200);
+		});
+	}
+	function waiting(c, n) {
+		(chans[c] || []).forEach(function(g) {
+			if (!g.classList.contains('channel')) return;
+			var t = g.querySelector('text');
+			if (!t) return;
+			if (!t.dataset.name) t.dataset.name = t.textContent;
+			t.textContent = t.dataset.name + (n ? ' (' + n + ')' : '');
+		});
+	}
+	var blocked = {};
+	function block(n, d) {
+		blocked[n] = (blocked[n] || 0) + d;
+		(nodes[n] || []).forEach(function(g) { g.classList.toggle('blocked', blocked[n] > 0); });
+	}
+	document.getElementById('start').onsubmit = function(ev) {
+		ev.preventDefault();
+		if (sock) sock.close();
+		Object.keys(nodes).forEach(function(n) { blocked[n] = 0; block(n, 0); });
+		Object.keys(chans).forEach(function(c) { waiting(c, 0); });
+		out.textContent = '';
+		status.textContent = 'Running…';
+		var u = new URL('?simulate=ws&delay=' + this.delay.value, location.href);
+		u.protocol = u.protocol.replace('http', 'ws');
+		sock = new WebSocket(u.href);
+		sock.onmessage = function(m) {
+			var e = JSON.parse(m.data);
+			switch (e.kind) {
+			case 'send':
+			case 'receive':
+				flash(chans[e.channel]);
+				waiting(e.channel, e.waiting);
+				break;
+			case 'close':
+				out.textContent += (e.node || 'Run') + ' closed ' + e.channel + '\n';
+				break;
+			case 'output':
+				out.textContent += e.value;
+				break;
+			case 'blocked':
+				block(e.node, 1);
+				break;
+			case 'running':
+				block(e.node, -1);
+				break;
+			case 'finished':
+				status.textContent = e.error ? 'Stopped: ' + e.error : 'Finished.';
+				break;
+			}
+			out.scrollTop = out.scrollHeight;
+		};
+	};
+})();
+</script>
+</body>`
+
+var simulateTemplate = template.Must(template.New("simulate").Funcs(templateFuncs).Parse(simulateTemplateSrc))
+
+// Simulate handles simulating a graph (see graph.Simulate): ?simulate serves
+// a page showing the diagram, and ?simulate=ws&delay=ms a WebSocket which
+// sends the events of a simulation as JSON, ending with a "finished" event.
+func Simulate(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("simulate") != "ws" {
+		var svg bytes.Buffer
+		if err := renderDiagram(&svg, g); err != nil {
+			log.Printf("Could not render diagram: %v", err)
+			http.Error(w, fmt.Sprintf("Could not render diagram: %v", err), http.StatusInternalServerError)
+			return
+		}
+		d := &struct {
+			Graph   *graph.Graph
+			Diagram template.HTML
+		}{g, template.HTML(svg.String())}
+		if err := simulateTemplate.Execute(w, d); err != nil {
+			log.Printf("Could not execute simulate template: %v", err)
+			http.Error(w, "Could not execute simulate template", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	delay := 300 * time.Millisecond
+	if d := q.Get("delay"); d != "" {
+		ms, err := strconv.Atoi(d)
+		if err != nil || ms < 0 || ms > 10000 {
+			http.Error(w, fmt.Sprintf("Invalid delay %q", d), http.StatusBadRequest)
+			return
+		}
+		delay = time.Duration(ms) * time.Millisecond
+	}
+	// Simulations go on for a while, so rather than hold the graph's lock
+	// (see graphLock), they run on a copy.
+	g, err := g.Clone()
+	if err != nil {
+		log.Printf("Could not copy graph: %v", err)
+		http.Error(w, fmt.Sprintf("Could not copy graph: %v", err), http.StatusInternalServerError)
+		return
+	}
+	g.LoadSubgraphs()
+
+	conn, rw, done := acceptWebSocket(w, r)
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+	releaseGraph(r)
+
+	ctx, cancel := context.WithTimeout(runCtx, SimulateTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+		case <-closing:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	// Events are reported one at a time.
+	var werr error
+	err = g.Simulate(ctx, delay, func(e graph.SimEvent) {
+		if werr != nil {
+			return
+		}
+		b, err := json.Marshal(e)
+		if err != nil {
+			werr = err
+		} else {
+			werr = writeTextFrame(rw.Writer, b)
+		}
+		if werr != nil {
+			cancel()
+		}
+	})
+	if werr != nil {
+		return
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("stopped after %v", SimulateTimeout)
+	}
+	end := struct {
+		Kind  string `json:"kind"`
+		Error string `json:"error,omitempty"`
+	}{"finished", errString(err)}
+	b, _ := json.Marshal(end)
+	writeTextFrame(rw.Writer, b)
+}
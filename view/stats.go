@@ -0,0 +1,69 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const statsTemplateSrc = `<head>
+	<title>{{.Graph.Name}} statistics</title><style>` + css + `</style>
+</head>
+<body>
+<h1>{{.Graph.Name}} statistics</h1>
+<a href="?">Return</a> | <a href="?stats=json">JSON</a>
+{{with .Stats -}}
+<table class="results">
+	<tr><td>Goroutines</td><td>{{.Nodes}}</td></tr>
+	<tr><td>Channels</td><td>{{.Channels}}</td></tr>
+	<tr><td>Lines of code</td><td>{{.CodeLines}}</td></tr>
+	{{range $k, $v := .Parts}}<tr><td>{{$k}} parts</td><td>{{$v}}</td></tr>{{end}}
+	<tr><td>Maximum fan-in</td><td>{{.MaxFanIn}}{{if .MaxFanInNode}} (<a href="?node={{.MaxFanInNode}}">{{.MaxFanInNode}}</a>){{end}}</td></tr>
+	<tr><td>Maximum fan-out</td><td>{{.MaxFanOut}}{{if .MaxFanOutNode}} (<a href="?node={{.MaxFanOutNode}}">{{.MaxFanOutNode}}</a>){{end}}</td></tr>
+	<tr><td>Longest path</td><td>{{len .LongestPath}}{{range $i, $n := .LongestPath}}{{if $i}} →{{else}}:{{end}} <a href="?node={{$n}}">{{$n}}</a>{{end}}</td></tr>
+</table>
+{{- end}}
+</body>`
+
+var statsTemplate = template.Must(template.New("stats").Funcs(templateFuncs).Parse(statsTemplateSrc))
+
+// Stats handles showing statistics about a graph, as a page or (with
+// ?stats=json) as JSON.
+func Stats(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	s := g.Stats()
+	if r.URL.Query().Get("stats") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(s); err != nil {
+			log.Printf("Could not encode JSON: %v", err)
+			http.Error(w, "Could not encode JSON", http.StatusInternalServerError)
+		}
+		return
+	}
+	d := &struct {
+		Graph *graph.Graph
+		Stats *graph.Stats
+	}{g, s}
+	if err := statsTemplate.Execute(w, d); err != nil {
+		log.Printf("Could not execute stats template: %v", err)
+		http.Error(w, "Could not execute stats template", http.StatusInternalServerError)
+	}
+}
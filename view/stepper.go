@@ -0,0 +1,232 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+const stepperTemplateSrc = `<head>
+	<title>Step through {{.Graph.Name}}</title><style>` + css + `
+	#diagram g.last path { stroke: orange; stroke-width: 4; }
+	#diagram g.last circle { fill: orange; }
+	#diagram g.blocked rect { stroke: red; stroke-width: 3; }
+	#diagram g.holding rect { stroke: orange; stroke-width: 3; }
+	#diagram g.done rect { opacity: 0.4; }
+	</style>
+</head>
+<body>
+<h1>Step through {{.Graph.Name}}</h1>
+<a href="?">Return</a> | <a href="{{.Restart}}">Restart</a>
+{{- with .Back}} | <a href="{{.}}">Back</a>{{end}}
+<p>Tokens stand for values; the code is ignored. Each goroutine receives a
+token, then sends it to each channel it writes in turn. Goroutines outlined
+in orange hold a token, and in red are blocked.</p>
+<form method="get" class="search">
+	<input type="hidden" name="steps" value="">
+	<label for="tokens">Tokens from each source</label>
+	<input type="number" name="tokens" min="0" max="99" value="{{.Tokens}}">
+	<input type="submit" value="Restart">
+</form>
+{{with .Last}}<p>Step {{$.Stepper.Steps}}: {{.}}.</p>{{end}}
+{{- if .Stepper.Deadlocked}}
+<div class="errors">Deadlock! The goroutines that haven't finished are all blocked.</div>
+{{- else if .Stepper.Finished}}
+<p>Finished after {{.Stepper.Steps}} steps.</p>
+{{- else}}
+<h2>Next move</h2>
+<ul>
+	{{range .Moves}}<li><a href="{{.Link}}">{{.Move}}</a></li>
+	{{end}}
+</ul>
+{{- end}}
+<div id="diagram">{{.Diagram}}</div>
+<table class="results">
+	<tr><th>Goroutine</th><th>State</th></tr>
+	{{range .Procs}}<tr><td>{{.Name}}</td><td>{{.State}}</td></tr>
+	{{end}}
+	<tr><th>Channel</th><th>Buffer</th></tr>
+	{{range .Stepper.Chans}}<tr><td>{{.Name}}</td><td>{{.Tokens}} of {{.Cap}}{{if .Closed}}, closed{{end}}</td></tr>
+	{{end}}
+</table>
+<script>
+(function() {
+	var st = {{.JSON}};
+	document.querySelectorAll('#diagram a').forEach(function(a) {
+		var href = a.getAttributeNS('http://www.w3.org/1999/xlink', 'href') || a.getAttribute('href') || '';
+		var q = new URLSearchParams(href.replace(/^\?/, '')), g = a.querySelector('g');
+		if (!g) return;
+		var n = q.get('node'), c = q.get('channel');
+		if (n && st.nodes[n]) g.classList.add(st.nodes[n]);
+		if (c && c == st.last) g.classList.add('last');
+		if (c && st.chans[c] && g.classList.contains('channel')) {
+			var t = g.querySelector('text');
+			if (t) t.textContent += ' [' + st.chans[c] + ']';
+		}
+	});
+})();
+</script>
+</body>`
+
+var stepperTemplate = template.Must(template.New("stepper").Funcs(templateFuncs).Parse(stepperTemplateSrc))
+
+// Stepper handles stepping through an abstract simulation of the graph (see
+// graph.Stepper), at ?steps=i.j.k&tokens=n: the moves made so far are given
+// as indexes into the moves possible at each step, so the page is replayed
+// from the start each time, and going back is just dropping the last.
+func Stepper(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tokens := 3
+	if t := q.Get("tokens"); t != "" {
+		n, err := strconv.Atoi(t)
+		if err != nil || n < 0 || n > 99 {
+			http.Error(w, fmt.Sprintf("Invalid number of tokens %q", t), http.StatusBadRequest)
+			return
+		}
+		tokens = n
+	}
+	s := g.NewStepper(tokens)
+	var (
+		steps []string
+		last  *graph.Move
+	)
+	if v := q.Get("steps"); v != "" {
+		steps = strings.Split(v, ".")
+	}
+	for _, st := range steps {
+		i, err := strconv.Atoi(st)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid step %q", st), http.StatusBadRequest)
+			return
+		}
+		m := s.Moves()
+		if err := s.Step(i); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid step %d: %v", s.Steps+1, err), http.StatusBadRequest)
+			return
+		}
+		last = &m[i]
+	}
+
+	var svg bytes.Buffer
+	if err := renderDiagram(&svg, g); err != nil {
+		log.Printf("Could not render diagram: %v", err)
+		http.Error(w, fmt.Sprintf("Could not render diagram: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// What the script shows on the diagram. Nodes with several instances
+	// show the state of the first which isn't finished.
+	state := struct {
+		Nodes map[string]string `json:"nodes"`
+		Chans map[string]string `json:"chans"`
+		Last  string            `json:"last,omitempty"`
+	}{Nodes: make(map[string]string), Chans: make(map[string]string)}
+	for _, p := range s.Procs {
+		if p.Node == "" || (p.Done && state.Nodes[p.Node] != "") {
+			continue
+		}
+		switch {
+		case p.Done:
+			state.Nodes[p.Node] = "done"
+		case s.Blocked(p):
+			state.Nodes[p.Node] = "blocked"
+		case p.Holding:
+			state.Nodes[p.Node] = "holding"
+		}
+	}
+	for _, c := range s.Chans {
+		state.Chans[c.Name] = fmt.Sprintf("%d/%d", c.Tokens, c.Cap)
+	}
+	if last != nil {
+		state.Last = last.Channel
+	}
+	js, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("Could not encode JSON: %v", err)
+		http.Error(w, "Could not encode JSON", http.StatusInternalServerError)
+		return
+	}
+
+	link := func(steps []string) string {
+		v := url.Values{}
+		v.Set("steps", strings.Join(steps, "."))
+		v.Set("tokens", strconv.Itoa(tokens))
+		return "?" + v.Encode()
+	}
+	type move struct {
+		Move graph.Move
+		Link string
+	}
+	type proc struct{ Name, State string }
+	d := &struct {
+		Graph         *graph.Graph
+		Stepper       *graph.Stepper
+		Tokens        int
+		Moves         []move
+		Procs         []proc
+		Last          *graph.Move
+		Restart, Back string
+		Diagram       template.HTML
+		JSON          template.JS
+	}{
+		Graph:   g,
+		Stepper: s,
+		Tokens:  tokens,
+		Last:    last,
+		Restart: link(nil),
+		Diagram: template.HTML(svg.String()),
+		JSON:    template.JS(js),
+	}
+	for i, m := range s.Moves() {
+		d.Moves = append(d.Moves, move{m, link(append(steps[:len(steps):len(steps)], strconv.Itoa(i)))})
+	}
+	for _, p := range s.Procs {
+		d.Procs = append(d.Procs, proc{p.Name, stepState(s, p)})
+	}
+	if len(steps) > 0 {
+		d.Back = link(steps[:len(steps)-1])
+	}
+	if err := stepperTemplate.Execute(w, d); err != nil {
+		log.Printf("Could not execute stepper template: %v", err)
+		http.Error(w, "Could not execute stepper template", http.StatusInternalServerError)
+	}
+}
+
+// stepState describes what a goroutine is doing.
+func stepState(s *graph.Stepper, p *graph.StepProc) string {
+	if p.Done {
+		return "finished"
+	}
+	what := ""
+	if c := p.Sending(); c != "" {
+		what = "sending to " + c
+	} else {
+		what = "receiving from " + strings.Join(p.Receiving(), " or ")
+	}
+	if s.Blocked(p) {
+		return "blocked " + what
+	}
+	return what
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"log"
+	"net/http"
+	"text/template"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// text/template, since this is CSS rather than HTML; the colours come from
+// the built-in themes.
+var themeCSSTemplate = template.Must(template.New("themeCSS").Parse(`:root {
+	--bg: {{.Background}};
+	--fg: {{.Foreground}};
+	--link: {{.Link}};
+	--error: {{.Error}};
+	--warning: {{.Warning}};
+	--panel: {{.Panel}};
+}
+`))
+
+type themeCSSHandler struct{}
+
+// ThemeCSS serves the colours of the current theme as CSS variables, for the
+// style sheet of every page.
+var ThemeCSS themeCSSHandler
+
+func (themeCSSHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	h := w.Header()
+	h.Set("Content-Type", "text/css")
+	h.Set("Cache-Control", "no-cache") // The theme can change.
+	if err := themeCSSTemplate.Execute(w, graph.CurrentTheme()); err != nil {
+		log.Printf("Could not execute theme CSS template: %v", err)
+	}
+}
+
+// SetTheme handles choosing a theme, given as ?theme=name.
+func SetTheme(w http.ResponseWriter, r *http.Request) {
+	if err := graph.SetTheme(r.URL.Query().Get("theme")); err != nil {
+		log.Printf("Could not set theme: %v", err)
+		http.Error(w, "Could not set theme: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	u := *r.URL
+	u.RawQuery = ""
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
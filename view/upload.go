@@ -0,0 +1,106 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+type uploadDiagnostic struct {
+	Severity string `json:"severity"`
+	Node     string `json:"node,omitempty"`
+	Channel  string `json:"channel,omitempty"`
+	Message  string `json:"message"`
+}
+
+type uploadResult struct {
+	Mode        string             `json:"mode"`
+	DryRun      bool               `json:"dry_run"`
+	Applied     bool               `json:"applied"`
+	Error       string             `json:"error,omitempty"`
+	Diagnostics []uploadDiagnostic `json:"diagnostics"`
+}
+
+// UploadJSON handles POSTing a whole graph, in the same JSON form as ?json
+// outputs, to replace the graph being edited. ?mode=merge adds the uploaded
+// nodes and channels to the graph instead, overwriting those with the same
+// names. ?dryrun only reports what the graph would look like to the checker.
+// Uploads that would leave errors in the graph are refused.
+func UploadJSON(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	res := &uploadResult{
+		Mode:        q.Get("mode"),
+		Diagnostics: []uploadDiagnostic{},
+	}
+	_, res.DryRun = q["dryrun"]
+	if res.Mode == "" {
+		res.Mode = "replace"
+	}
+
+	code := http.StatusOK
+	defer func() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			log.Printf("Could not encode JSON: %v", err)
+		}
+	}()
+
+	up, err := graph.LoadJSON(r.Body, g.SourcePath)
+	if err != nil {
+		code, res.Error = http.StatusBadRequest, "invalid graph: "+err.Error()
+		return
+	}
+	var h *graph.Graph
+	switch res.Mode {
+	case "replace":
+		h = up
+	case "merge":
+		h = g.Merged(up)
+	default:
+		code, res.Error = http.StatusBadRequest, "unknown mode "+res.Mode
+		return
+	}
+	if h.Nodes == nil {
+		h.Nodes = make(map[string]*graph.Node)
+	}
+	if h.Channels == nil {
+		h.Channels = make(map[string]*graph.Channel)
+	}
+
+	bad := false
+	for _, d := range h.Check() {
+		res.Diagnostics = append(res.Diagnostics, uploadDiagnostic{
+			Severity: d.Severity.String(),
+			Node:     d.Node,
+			Channel:  d.Channel,
+			Message:  d.Msg,
+		})
+		bad = bad || d.Severity == graph.Error
+	}
+	if res.DryRun {
+		return
+	}
+	if bad {
+		code, res.Error = http.StatusUnprocessableEntity, "graph has errors; not applied"
+		return
+	}
+	*g = *h
+	res.Applied = true
+}
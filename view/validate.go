@@ -0,0 +1,52 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+
+	"github.com/google/shenzhen-go/graph"
+)
+
+// Validate serves the graph's diagnostics as JSON (?validate) or SARIF
+// (?validate=sarif). Line numbers refer to the graph as it would be saved.
+func Validate(g *graph.Graph, w http.ResponseWriter, r *http.Request) {
+	var src bytes.Buffer
+	if err := g.WriteJSONTo(&src); err != nil {
+		log.Printf("Could not encode JSON: %v", err)
+		http.Error(w, "Could not encode JSON", http.StatusInternalServerError)
+		return
+	}
+	fds := []graph.FileDiagnostics{{
+		Path:        graphPath(r),
+		Source:      src.Bytes(),
+		Diagnostics: g.Check(),
+	}}
+	write := graph.WriteDiagnosticsJSON
+	switch f := r.URL.Query().Get("validate"); f {
+	case "", "json":
+	case "sarif":
+		write = graph.WriteSARIF
+	default:
+		http.Error(w, "Unknown format "+f, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := write(w, fds); err != nil {
+		log.Printf("Could not write diagnostics: %v", err)
+	}
+}
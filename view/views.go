@@ -16,13 +16,51 @@
 package view
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"html/template"
 	"io"
+	"log"
 	"os/exec"
+	"sync"
+
+	"github.com/google/shenzhen-go/graph"
 )
 
+// HaveDot reports whether the Graphviz dot tool is available. If not, graphs
+// are drawn with a built-in (simpler) layout instead. See DetectDot.
+var HaveDot = true
+
+// DetectDot looks for the Graphviz dot tool, and sets HaveDot accordingly.
+func DetectDot() error {
+	_, err := exec.LookPath("dot")
+	HaveDot = err == nil
+	return err
+}
+
+// BasePath is the path the server is mounted at, when that isn't the root
+// (e.g. "/shenzhen" behind a reverse proxy). It has no trailing slash.
+var BasePath = ""
+
+// templateFuncs are available to all page templates.
+var templateFuncs = template.FuncMap{
+	"base":             func() string { return BasePath },
+	"terminations":     func() interface{} { return graph.Terminations },
+	"logLevels":        func() interface{} { return graph.LogLevels },
+	"timeoutActions":   func() interface{} { return graph.TimeoutActions },
+	"overflowPolicies": func() interface{} { return graph.OverflowPolicies },
+}
+
+// css is the style sheet for all pages. Colours come from the theme, via
+// /theme.css (see ThemeCSS).
 const css = `
+	@import url("{{base}}/theme.css");
 	body {
 		font-family: "Go","San Francisco","Helvetica Neue",Helvetica,sans-serif;
+		background: var(--bg, white);
+		color: var(--fg, black);
 		float: none;
 		max-width: 800px;
 		margin: 20 auto 0;
@@ -42,6 +80,13 @@ const css = `
 		margin-right: 15px;
 		width: 30%;
 	}
+	a {
+		color: var(--link, #00e);
+	}
+	input, select, textarea {
+		background: var(--bg, white);
+		color: var(--fg, black);
+	}
 	input {
 		font-family: "Go Mono","Fira Code",sans-serif;
 		font-size: 12pt;
@@ -64,6 +109,89 @@ const css = `
 	div.hcentre {
 		text-align: center;
 	}
+	div.errors {
+		font-family: "Go Mono","Fira Code",sans-serif;
+		color: var(--error, #c00);
+	}
+	div.lint {
+		color: var(--warning, #b60);
+	}
+	div.diagnostics li.error {
+		color: var(--error, #c00);
+	}
+	div.diagnostics li.warning {
+		color: var(--warning, #b60);
+	}
+	div.hint {
+		font-size: 10pt;
+		margin-left: calc(30% + 15px);
+		color: #666;
+	}
+	div.beforeafter {
+		display: flex;
+	}
+	div.beforeafter pre {
+		flex: 1;
+		margin: 4px;
+		padding: 4px;
+		background: var(--panel, #f4f4f4);
+		overflow-x: auto;
+	}
+	form.search {
+		margin: 12px 0;
+	}
+	table.results td {
+		padding-right: 12px;
+		vertical-align: top;
+	}
+	pre.diff span.removed {
+		background: #fdd;
+		color: black;
+	}
+	pre.diff span.added {
+		background: #dfd;
+		color: black;
+	}
+	div.palette {
+		position: fixed;
+		top: 20%;
+		left: 50%;
+		transform: translateX(-50%);
+		width: 500px;
+		padding: 8px;
+		background: var(--panel, #f4f4f4);
+		border: 1px solid #888;
+	}
+	div.palette input[type=text] {
+		width: 100%;
+	}
+	div.palette div.hint {
+		margin: 4px 0;
+	}
+	div.palette ul {
+		list-style: none;
+		margin: 0;
+		padding: 0;
+	}
+	div.palette li {
+		padding: 2px 4px;
+		cursor: pointer;
+	}
+	div.palette li.selected {
+		background: var(--bg, white);
+	}
+	form.selection {
+		position: fixed;
+		bottom: 0;
+		left: 50%;
+		transform: translateX(-50%);
+		padding: 8px;
+		background: var(--panel, #f4f4f4);
+		border: 1px solid #888;
+	}
+	#diagram g.node.selected {
+		filter: drop-shadow(0 0 4px var(--link, #00e));
+	}
 	table.browse {
 		font-family: "Go Mono","Fira Code",sans-serif;
 		font-size: 12pt;
@@ -99,3 +227,59 @@ func pipeThru(dst io.Writer, cmd *exec.Cmd, src io.Reader) error {
 func dotToSVG(dst io.Writer, src io.Reader) error {
 	return pipeThru(dst, exec.Command(`dot`, `-Tsvg`), src)
 }
+
+// diagramCacheSize limits how many rendered diagrams are kept.
+const diagramCacheSize = 64
+
+// diagramCache holds rendered diagrams, keyed by a hash of the dot source, so
+// dot is only run again when something in the diagram changes.
+var diagramCache = struct {
+	sync.Mutex
+	svg map[[sha256.Size]byte][]byte
+}{svg: make(map[[sha256.Size]byte][]byte)}
+
+// renderDiagram draws the graph as SVG, with dot if possible, otherwise with
+// the built-in layout.
+func renderDiagram(dst io.Writer, g *graph.Graph) error {
+	var dot bytes.Buffer
+	if err := g.WriteDotTo(&dot); err != nil {
+		return err
+	}
+	var key [sha256.Size]byte
+	h := sha256.New()
+	h.Write(dot.Bytes())
+	fmt.Fprint(h, HaveDot) // The renderer affects the result too.
+	h.Sum(key[:0])
+
+	diagramCache.Lock()
+	svg, ok := diagramCache.svg[key]
+	diagramCache.Unlock()
+	if ok {
+		_, err := dst.Write(svg)
+		return err
+	}
+
+	var buf bytes.Buffer
+	err := errors.New("dot not available")
+	if HaveDot {
+		if err = dotToSVG(&buf, &dot); err != nil {
+			log.Printf("Could not render dot to SVG, using built-in layout: %v", err)
+		}
+	}
+	if err != nil {
+		buf.Reset()
+		if err := g.WriteSVGTo(&buf); err != nil {
+			return err
+		}
+	}
+
+	diagramCache.Lock()
+	if len(diagramCache.svg) >= diagramCacheSize {
+		// Simpler than tracking usage, and rarely happens.
+		diagramCache.svg = make(map[[sha256.Size]byte][]byte)
+	}
+	diagramCache.svg[key] = buf.Bytes()
+	diagramCache.Unlock()
+	_, err = dst.Write(buf.Bytes())
+	return err
+}